@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/kptm-tools/vulnerability-analysis/pkg/config"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/daemon"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/features"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/services"
+)
+
+// serviceName is the name of the systemd unit and of the Windows service.
+const serviceName = "vulnerability-analysis"
+
+// serviceControl carries the requests of the Windows service manager. Its
+// channels are nil on the other platforms, where signals are used instead.
+type serviceControl struct {
+	stop   <-chan struct{}
+	reload <-chan struct{}
+
+	// stopped reports the shutdown as done to the service manager.
+	stopped func()
+}
+
+// loadEnvFile loads the file named by CONFIG_FILE into the environment.
+func loadEnvFile() error {
+	path := os.Getenv(config.EnvFileVariable)
+	if path == "" {
+		return nil
+	}
+	return config.LoadEnvFile(path)
+}
+
+func setLogLevel(level *slog.LevelVar, name string) error {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(name)); err != nil {
+		return fmt.Errorf("invalid log level %q: %w", name, err)
+	}
+	level.Set(l)
+	return nil
+}
+
+// reloader applies the settings which change without a restart: the log
+// level and the feature flags, refreshed from FEATURE_FLAGS_URL when set.
+type reloader struct {
+	logLevel    *slog.LevelVar
+	remoteFlags *features.RemoteProvider
+}
+
+func (r reloader) reload() {
+	_, _ = daemon.Notify(daemon.StateReloading)
+	defer func() {
+		_, _ = daemon.Notify(daemon.StateReady, daemon.Status("Reloaded at %s", time.Now().UTC().Format(time.RFC3339)))
+	}()
+
+	if err := loadEnvFile(); err != nil {
+		slog.Error("Failed to reload configuration, keeping the current one", slog.Any("error", err))
+		return
+	}
+	c := config.LoadConfig()
+	if err := setLogLevel(r.logLevel, c.LogLevel); err != nil {
+		slog.Error("Failed to reload log level", slog.Any("error", err))
+	}
+	if r.remoteFlags != nil {
+		if err := r.remoteFlags.Refresh(context.Background()); err != nil {
+			slog.Error("Failed to reload remote feature flags", slog.Any("error", err))
+		}
+	} else if flags, err := features.ParseStaticProvider(c.FeatureFlags); err != nil {
+		slog.Error("Failed to reload feature flags", slog.Any("error", err))
+	} else {
+		features.SetDefault(flags)
+	}
+	slog.Info("Reloaded configuration", slog.String("log_level", r.logLevel.Level().String()))
+}
+
+// daemonState writes the PID and health files of the service, and reports
+// its state to systemd.
+type daemonState struct {
+	c         *config.Config
+	startedAt time.Time
+	health    func() daemon.Health
+	cancel    context.CancelFunc
+}
+
+// startDaemon writes the PID file and starts the heartbeat writing the
+// health file and pinging the systemd watchdog.
+func startDaemon(c *config.Config, nvd *services.NVDClient) *daemonState {
+	d := &daemonState{c: c, startedAt: time.Now().UTC()}
+	d.health = func() daemon.Health {
+		h := daemon.Health{
+			Status:    daemon.HealthOK,
+			PID:       os.Getpid(),
+			StartedAt: d.startedAt,
+			Details: map[string]string{
+				"nvd_status":  string(nvd.Status()),
+				"nvd_circuit": string(nvd.CircuitState()),
+			},
+		}
+		if nvd.Status() == services.NVDStatusMaintenance || nvd.CircuitState() == services.CircuitOpen {
+			h.Status = daemon.HealthDegraded
+		}
+		return h
+	}
+
+	if c.PIDFile != "" {
+		if err := daemon.WritePIDFile(c.PIDFile); err != nil {
+			log.Fatalf("Error writing PID file: %s\n", err.Error())
+		}
+	}
+	var ctx context.Context
+	ctx, d.cancel = context.WithCancel(context.Background())
+	go daemon.Heartbeat(ctx, c.HealthFile, c.HealthInterval, d.health)
+	return d
+}
+
+// ready tells systemd the service is up, once subscribed to scan events.
+func (d *daemonState) ready() {
+	notified, err := daemon.Notify(daemon.StateReady, daemon.Status("Analyzing scans"))
+	if err != nil {
+		slog.Warn("Failed to notify systemd", slog.Any("error", err))
+	} else if notified {
+		slog.Info("Notified systemd", slog.Duration("watchdog", daemon.WatchdogInterval()))
+	}
+}
+
+// stop stops the heartbeat, marks the health file as stopping and removes
+// the PID file.
+func (d *daemonState) stop() {
+	_, _ = daemon.Notify(daemon.StateStopping)
+	d.cancel()
+	if d.c.HealthFile != "" {
+		h := d.health()
+		h.Status = daemon.HealthStopping
+		h.UpdatedAt = time.Now().UTC()
+		if err := daemon.WriteHealth(d.c.HealthFile, h); err != nil {
+			slog.Warn("Failed to write health file", slog.Any("error", err))
+		}
+	}
+	if d.c.PIDFile != "" {
+		if err := daemon.RemovePIDFile(d.c.PIDFile); err != nil {
+			slog.Warn("Failed to remove PID file", slog.Any("error", err))
+		}
+	}
+}
+
+// waitForShutdown blocks until SIGINT, SIGTERM or a stop request of the
+// service manager, reloading the configuration on SIGHUP or a parameter
+// change request.
+func waitForShutdown(service serviceControl, reload func()) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	defer signal.Stop(signals)
+
+	for {
+		select {
+		case sig := <-signals:
+			if sig == syscall.SIGHUP {
+				reload()
+				continue
+			}
+		case <-service.reload:
+			reload()
+			continue
+		case <-service.stop:
+		}
+		log.Println("Shutting down gracefully...")
+		return
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"log/slog"
+	"os"
+
+	"github.com/kptm-tools/vulnerability-analysis/pkg/config"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/ics"
+)
+
+// startICSAdvisories loads the CISA ICS advisories stored in
+// ICS_ADVISORIES_DIR and keeps them in sync with the CSAF provider at
+// ICS_ADVISORIES_URL. The index is nil when ICS advisories are disabled.
+func startICSAdvisories(ctx context.Context, c *config.Config) (*ics.Index, error) {
+	if c.ICSAdvisoriesDir == "" && c.ICSAdvisoriesURL == "" {
+		return nil, nil
+	}
+
+	index := ics.NewIndex()
+	if c.ICSAdvisoriesDir != "" {
+		if _, err := os.Stat(c.ICSAdvisoriesDir); err == nil {
+			loaded, err := index.LoadDir(c.ICSAdvisoriesDir)
+			if err != nil && loaded == 0 {
+				return nil, err
+			}
+			if err != nil {
+				slog.Warn("Skipped invalid ICS advisories", slog.Any("error", err))
+			}
+			slog.Info("Loaded ICS advisories", slog.String("dir", c.ICSAdvisoriesDir), slog.Int("advisories", loaded))
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+	}
+
+	if c.ICSAdvisoriesURL != "" {
+		syncer := ics.NewSyncer(c.ICSAdvisoriesURL, c.ICSAdvisoriesDir, index, c.ICSAdvisoriesSyncInterval)
+		go syncer.Run(ctx)
+	}
+
+	return index, nil
+}
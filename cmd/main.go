@@ -1,49 +1,464 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"log/slog"
+	"net/http"
 	"os"
-	"os/signal"
-	"syscall"
+	"strconv"
+	"strings"
 	"time"
 
 	cmmn "github.com/kptm-tools/common/common/pkg/events"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/admission"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/advisory"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/anomaly"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/api"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/blobstore"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/cache"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/classify"
 	"github.com/kptm-tools/vulnerability-analysis/pkg/config"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/cpeextract"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/cpesync"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/cvehistory"
 	"github.com/kptm-tools/vulnerability-analysis/pkg/events"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/features"
 	"github.com/kptm-tools/vulnerability-analysis/pkg/handlers"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/intel"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/metrics"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/offenders"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/output"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/psirt"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/references"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/risk"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/scans"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/search"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/secrets"
 	"github.com/kptm-tools/vulnerability-analysis/pkg/services"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/triage"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/vulnstore"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/warmup"
 	"github.com/lmittmann/tint"
 )
 
 func main() {
 	fmt.Println("Hello Vulnerability Analysis!")
+	if err := loadEnvFile(); err != nil {
+		log.Fatalf("Error loading config file: %s\n", err.Error())
+	}
 	c := config.LoadConfig()
+	service := startService()
+	defer service.stopped()
 
 	// Logger
+	logLevel := new(slog.LevelVar)
+	if err := setLogLevel(logLevel, c.LogLevel); err != nil {
+		log.Fatalf("Error parsing log level: %s\n", err.Error())
+	}
 	slog.SetDefault(slog.New(tint.NewHandler(os.Stdout, &tint.Options{
-		Level:      slog.LevelDebug,
+		Level:      logLevel,
 		TimeFormat: time.Stamp,
 	})))
 
+	// Secrets
+	secretProvider, err := openSecrets(c)
+	if err != nil {
+		log.Fatalf("Error opening secret manager: %s\n", err.Error())
+	}
+	// Secrets clients swap once rotated, the others are only read at startup
+	nvdKeyRefs := []string{c.NvdAPIKey, c.NvdAPIKeys}
+	searchIndexRefs := []string{c.SearchIndexPassword, c.SearchIndexAPIKey}
+	ciscoTokenRefs := []string{c.CiscoOpenVulnToken}
+	if err := resolveSecrets(context.Background(), secretProvider, c); err != nil {
+		log.Fatalf("Error fetching secrets: %s\n", err.Error())
+	}
+
+	// Feature flags
+	flags, err := features.ParseStaticProvider(c.FeatureFlags)
+	if err != nil {
+		log.Fatalf("Error parsing feature flags: %s\n", err.Error())
+	}
+	reload := reloader{logLevel: logLevel}
+	if c.FeatureFlagsURL != "" {
+		remoteFlags := features.NewRemoteProvider(c.FeatureFlagsURL, c.FeatureFlagsRefresh, flags)
+		remoteFlags.Start(context.Background())
+		features.SetDefault(remoteFlags)
+		reload.remoteFlags = remoteFlags
+	} else {
+		features.SetDefault(flags)
+	}
+
+	// Risk model
+	likelihoodMatrix, err := risk.ParseLikelihoodMatrix(c.LikelihoodMatrix)
+	if err != nil {
+		log.Fatalf("Error parsing likelihood matrix: %s\n", err.Error())
+	}
+	cvssPreference, err := services.ParseCVSSPreference(c.CVSSVersionOrder)
+	if err != nil {
+		log.Fatalf("Error parsing CVSS version order: %s\n", err.Error())
+	}
+
+	// Shadow risk scoring
+	if c.ShadowScoresPath != "" {
+		recorder, err := risk.NewFileRecorder(c.ShadowScoresPath)
+		if err != nil {
+			log.Fatalf("Error opening shadow scores file: %s\n", err.Error())
+		}
+		defer recorder.Close()
+		risk.SetRecorder(recorder)
+	}
+
 	// Events
 	eventBus, err := cmmn.NewNatsEventBus(c.GetNatsConnStr())
 	if err != nil {
 		log.Fatalf("Error creating Event Bus: %s\n", err.Error())
 	}
 
+	// Local CVE mirror
+	mirrorStore, err := openMirror(c)
+	if err != nil {
+		log.Fatalf("Error opening CVE mirror: %s\n", err.Error())
+	}
+
+	// NVD API client
+	nvdOpts := mirrorOptions(c, mirrorStore)
+	nvdTransport := newNVDTransport(c)
+	if nvdTransport != nil {
+		nvdOpts = append(nvdOpts, services.WithTransport(nvdTransport))
+	}
+	if c.CPESyncDir != "" {
+		syncStore, err := cpesync.Open(c.CPESyncDir)
+		if err != nil {
+			log.Fatalf("Error opening CPE sync checkpoints: %s\n", err.Error())
+		}
+		slog.Info("Syncing CPEs incrementally",
+			slog.String("dir", c.CPESyncDir),
+			slog.Int("cpes", syncStore.Len()),
+			slog.Duration("max_age", c.CPESyncMaxAge))
+		nvdOpts = append(nvdOpts, services.WithIncrementalSync(syncStore, c.CPESyncMaxAge))
+	}
+	if c.NvdSharedCacheURL != "" {
+		shared, err := cache.Open(c.NvdSharedCacheURL)
+		if err != nil {
+			log.Fatalf("Error opening shared NVD cache: %s\n", err.Error())
+		}
+		slog.Info("Caching NVD lookups outside the process", slog.Duration("ttl", c.NvdSharedCacheTTL))
+		nvdOpts = append(nvdOpts, services.WithSharedCache(shared, c.NvdSharedCacheTTL))
+	}
+	nvdOpts = append(nvdOpts, services.WithCircuitBreaker(c.NvdCircuitBreakerThreshold, c.NvdCircuitBreakerCoolDown, func(change services.CircuitChange) {
+		severity := events.AlertSeverityInfo
+		message := "NVD API requests succeed again, resuming live enrichment"
+		details := map[string]string{"failures": strconv.Itoa(change.Failures)}
+		if change.To == services.CircuitOpen {
+			severity = events.AlertSeverityCritical
+			message = "NVD API requests keep failing, enrichment is degraded to offline sources"
+			details["retry_at"] = change.RetryAt.Format(time.RFC3339)
+			if change.LastError != nil {
+				details["last_error"] = change.LastError.Error()
+			}
+		}
+		if err := events.PublishOperatorAlert(eventBus, events.NewOperatorAlertEvent("nvd", severity, message, details)); err != nil {
+			slog.Error("Failed to publish operator alert", slog.Any("error", err))
+		}
+	}))
+	rotateNVDKeys := rotatesSecrets(c, nvdKeyRefs)
+	if rotateNVDKeys {
+		// Rotated keys replace those of the key ring
+		nvdOpts = append(nvdOpts, services.WithAPIKeys(nvdAPIKeys(c.NvdAPIKey, c.NvdAPIKeys), c.NvdAPIKeyHeader))
+	}
+	nvdClient := newNVDClient(c, nvdOpts...)
+	if rotateNVDKeys {
+		secrets.NewRotation(secretProvider, nvdKeyRefs, []string{c.NvdAPIKey, c.NvdAPIKeys}, c.SecretsRefreshInterval, func(values []string) {
+			nvdClient.ReplaceAPIKeys(nvdAPIKeys(values[0], values[1]))
+		}).Start(context.Background())
+	}
+	lifecycle := startDaemon(c, nvdClient)
+	rateLimit := nvdClient.RateLimit()
+	slog.Info("NVD API rate limit",
+		slog.Bool("enforced", nvdClient.RateLimited()),
+		slog.Int("keys", len(nvdClient.KeyUsage())),
+		slog.Bool("keyed", rateLimit.Keyed),
+		slog.Int("requests", rateLimit.Requests),
+		slog.Duration("window", rateLimit.Window))
+
+	// Local CVE mirror sync
+	if err := startMirrorSync(context.Background(), c, mirrorStore, nvdClient, nvdTransport); err != nil {
+		log.Fatalf("Error starting CVE mirror: %s\n", err.Error())
+	}
+
+	// NVD maintenance detection
+	nvdClient.StartStatusMonitor(context.Background(), c.NvdProbeInterval, c.NvdProbeFailureThreshold, func(change services.NVDStatusChange) {
+		severity := events.AlertSeverityInfo
+		message := "NVD API is available again, resuming live enrichment"
+		details := map[string]string{"since": change.Since.Format(time.RFC3339)}
+		if change.To == services.NVDStatusMaintenance {
+			severity = events.AlertSeverityCritical
+			message = "NVD API appears to be in a maintenance window, switching to offline-only enrichment"
+			if change.LastError != nil {
+				details["last_error"] = change.LastError.Error()
+			}
+		}
+		if err := events.PublishOperatorAlert(eventBus, events.NewOperatorAlertEvent("nvd", severity, message, details)); err != nil {
+			slog.Error("Failed to publish operator alert", slog.Any("error", err))
+		}
+	})
+
+	// Output
+	compression, err := output.ParseEncoding(c.ResultCompression)
+	if err != nil {
+		log.Fatalf("Error parsing result compression: %s\n", err.Error())
+	}
+	oversizeMode, err := output.ParseOversizeMode(c.ResultOversizeMode)
+	if err != nil {
+		log.Fatalf("Error parsing result oversize mode: %s\n", err.Error())
+	}
+	var claimCheckStore blobstore.Store
+	if oversizeMode == output.OversizeClaimCheck {
+		claimCheckStore, err = blobstore.Open(context.Background(), c.ClaimCheckStoreURL)
+		if err != nil {
+			log.Fatalf("Error opening claim check store: %s\n", err.Error())
+		}
+	}
+	var severityRemap output.SeverityRemap
+	if c.SeverityRemapPath != "" {
+		if severityRemap, err = output.LoadSeverityRemap(c.SeverityRemapPath); err != nil {
+			log.Fatalf("Error loading severity remap: %s\n", err.Error())
+		}
+	}
+	var publicationThresholds output.PublicationThresholds
+	if c.PublicationThresholdsPath != "" {
+		if publicationThresholds, err = output.LoadPublicationThresholds(c.PublicationThresholdsPath); err != nil {
+			log.Fatalf("Error loading publication thresholds: %s\n", err.Error())
+		}
+	}
+	outputOpts := output.Options{
+		MaxDescriptionLength:   c.DescriptionMaxLength,
+		MaxVendorCommentLength: c.VendorCommentMaxLength,
+		SanitizeMarkup:         c.SanitizeMarkup,
+		Compression:            compression,
+		CompressionMinSize:     c.ResultCompressionMin,
+		MaxMessageSize:         c.BusMaxMessageSize,
+		OversizeMode:           oversizeMode,
+		ClaimCheckStore:        claimCheckStore,
+		SeverityRemap:          severityRemap,
+		PublicationThresholds:  publicationThresholds,
+		Canonical:              c.ResultCanonicalJSON,
+	}
+
 	// Services
-	nmapService := services.NewNmapService()
+	enrichment := services.Enrichment{Likelihood: likelihoodMatrix, CVSSv2Flags: c.CVSSv2Flags, CVSSPreference: cvssPreference}
+	if c.EnrichmentCacheEntries > 0 {
+		enrichment.Cache = services.NewEnrichmentCache(c.EnrichmentCacheEntries)
+	}
+	// EPSS scores, only looked up for the tenants with the epss feature on
+	epss := intel.NewEPSSClient(c.EPSSURL)
+	nmapOpts := []services.NmapServiceOption{
+		services.WithEnrichment(enrichment),
+		services.WithResultSpill(c.SpillThreshold, c.SpillDir),
+		services.WithCPETrace(c.CPETrace),
+		services.WithExtendedErrorCodes(c.ExtendedErrorCodes),
+		services.WithEPSSScores(epss),
+	}
+	if c.NvdKeywordFallback {
+		switch strings.ToUpper(c.NvdKeywordSeverity) {
+		case "", "LOW", "MEDIUM", "HIGH", "CRITICAL":
+		default:
+			log.Fatalf("Invalid NVD_KEYWORD_SEVERITY %q, expected LOW, MEDIUM, HIGH or CRITICAL\n", c.NvdKeywordSeverity)
+		}
+		nmapOpts = append(nmapOpts, services.WithKeywordFallback(c.NvdKeywordSeverity, c.NvdKeywordMaxCVEs))
+	}
+	if c.NvdCPEResolution {
+		nmapOpts = append(nmapOpts, services.WithCPEResolution())
+	}
+	if c.PriorityEnrichment {
+		var products []string
+		if c.PriorityProducts != "" {
+			products = strings.Split(c.PriorityProducts, ",")
+		}
+		nmapOpts = append(nmapOpts, services.WithPriorityEnrichment(products))
+	}
+	eventOpts := []events.Option{
+		events.WithOutput(outputOpts),
+		events.WithPriorityPublish(c.PriorityEnrichment),
+		events.WithSBOMExport(c.SBOMExport),
+	}
+	if c.SearchIndexURL != "" {
+		indexer := newSearchIndexer(c)
+		if rotatesSecrets(c, searchIndexRefs) {
+			secrets.NewRotation(secretProvider, searchIndexRefs, []string{c.SearchIndexPassword, c.SearchIndexAPIKey}, c.SecretsRefreshInterval, func(values []string) {
+				indexer.ReplaceCredentials(c.SearchIndexUsername, values[0], values[1])
+			}).Start(context.Background())
+		}
+		eventOpts = append(eventOpts, events.WithSearchIndexer(indexer))
+	}
+	var findingStore *vulnstore.Store
+	if c.FindingsPostgresURL != "" {
+		findingStore, err = vulnstore.Open(context.Background(), c.FindingsPostgresURL)
+		if err != nil {
+			log.Fatalf("Error opening vulnerability store: %s\n", err.Error())
+		}
+		defer findingStore.Close()
+		eventOpts = append(eventOpts, events.WithVulnerabilityStore(findingStore))
+	}
+	if c.ReferenceCheck {
+		checker := references.NewChecker(c.ReferenceCheckTTL, c.ReferenceCheckWorkers, c.ReferenceCheckEntries)
+		checker.Start(context.Background())
+		nmapOpts = append(nmapOpts, services.WithReferenceChecker(checker))
+	}
+	if c.LivenessCheck {
+		nmapOpts = append(nmapOpts, services.WithLivenessCheck(services.TCPProber{Timeout: c.LivenessCheckTimeout}))
+	}
+	if c.PSIRTFeeds != "" {
+		registry, err := psirt.NewRegistryFromNames(strings.Split(c.PSIRTFeeds, ","), c.CiscoOpenVulnToken, c.PSIRTFeedTTL)
+		if err != nil {
+			log.Fatalf("Error configuring PSIRT feeds: %s\n", err.Error())
+		}
+		if rotatesSecrets(c, ciscoTokenRefs) {
+			secrets.NewRotation(secretProvider, ciscoTokenRefs, []string{c.CiscoOpenVulnToken}, c.SecretsRefreshInterval, func(values []string) {
+				registry.ReplaceCiscoToken(values[0])
+			}).Start(context.Background())
+		}
+		nmapOpts = append(nmapOpts, services.WithPSIRTRegistry(registry))
+	}
+	icsIndex, err := startICSAdvisories(context.Background(), c)
+	if err != nil {
+		log.Fatalf("Error loading ICS advisories: %s\n", err.Error())
+	}
+	if icsIndex != nil {
+		nmapOpts = append(nmapOpts, services.WithICSIndex(icsIndex))
+	}
+	msrcIndex, err := loadMSRCUpdates(c)
+	if err != nil {
+		log.Fatalf("Error loading MSRC updates: %s\n", err.Error())
+	}
+	if msrcIndex != nil {
+		nmapOpts = append(nmapOpts, services.WithMSRCIndex(msrcIndex))
+	}
+	if c.HostClassification {
+		rules := classify.DefaultRules()
+		if c.HostClassificationRules != "" {
+			if rules, err = classify.LoadRules(c.HostClassificationRules); err != nil {
+				log.Fatalf("Error loading host classification rules: %s\n", err.Error())
+			}
+		}
+		nmapOpts = append(nmapOpts, services.WithHostClassifier(classify.NewEngine(rules)))
+	}
+	if c.CPEExtraction {
+		rules := cpeextract.DefaultRules()
+		if c.CPEExtractionRules != "" {
+			if rules, err = cpeextract.LoadRules(c.CPEExtractionRules); err != nil {
+				log.Fatalf("Error loading CPE extraction rules: %s\n", err.Error())
+			}
+		}
+		extractor, err := cpeextract.NewRuleExtractor(rules)
+		if err != nil {
+			log.Fatalf("Error compiling CPE extraction rules: %s\n", err.Error())
+		}
+		nmapOpts = append(nmapOpts, services.WithCPEExtractors(cpeextract.NewRegistry(extractor)))
+	}
+	var scanStore *scans.Store
+	if c.APIAddr != "" && c.ScanStoreSize > 0 {
+		scanStore = scans.NewStore(c.ScanStoreSize)
+		nmapOpts = append(nmapOpts, services.WithScanStore(scanStore))
+	}
+	nmapService := services.NewNmapService(nvdClient, nmapOpts...)
 
 	// Handlers
 	nmapHandler := handlers.NewNmapHandler(nmapService)
 
+	// Repeat offender hosts
+	var offenderTracker *offenders.Tracker
+	if c.RepeatOffenderScans > 0 {
+		offenderTracker = offenders.NewTracker(c.RepeatOffenderScans, offenders.WithRetention(c.RepeatOffenderRetention))
+		if findingStore != nil {
+			n, err := offenderTracker.Load(context.Background(), findingStore, time.Now())
+			if err != nil {
+				slog.Error("Failed to replay the stored scans into the repeat offenders", slog.Any("error", err))
+			} else {
+				slog.Info("Replayed the stored scans into the repeat offenders", slog.Int("scans", n))
+			}
+		}
+		eventOpts = append(eventOpts, events.WithOffenderTracker(offenderTracker))
+	}
+
+	// Finding volume anomalies
+	if c.AnomalyHistoryScans > 0 {
+		detector := anomaly.NewDetector(c.AnomalyHistoryScans,
+			anomaly.WithSpikeFactor(c.AnomalySpikeFactor),
+			anomaly.WithDropPercent(c.AnomalyDropPercent),
+			anomaly.WithRetention(c.AnomalyRetention))
+		if findingStore != nil {
+			n, err := detector.Load(context.Background(), findingStore, time.Now())
+			if err != nil {
+				slog.Error("Failed to replay the stored scans into the anomaly baselines", slog.Any("error", err))
+			} else {
+				slog.Info("Replayed the stored scans into the anomaly baselines", slog.Int("scans", n))
+			}
+		}
+		eventOpts = append(eventOpts, events.WithAnomalyDetector(detector))
+	}
+
+	// Burst smoothing of scans landing at once
+	if c.ScanAdmissionMaxActive > 0 {
+		eventOpts = append(eventOpts, events.WithScanAdmission(admission.NewController(c.ScanAdmissionMaxActive, c.ScanAdmissionMaxQueued, nvdClient,
+			admission.WithUpdateInterval(c.ScanAdmissionUpdateInterval))))
+	}
+
+	// Dashboard metrics and triage workflow of the published results, served
+	// by the HTTP API
+	var recorder *metrics.Recorder
+	var workflow *triage.Store
+	if c.APIAddr != "" {
+		recorder = metrics.NewRecorder(c.MetricsStep, c.MetricsRetention)
+		workflow, err = openFindingWorkflow(c)
+		if err != nil {
+			log.Fatalf("Error opening finding workflow: %s\n", err.Error())
+		}
+		eventOpts = append(eventOpts, events.WithResultRecorder(recorder), events.WithFindingWorkflow(workflow))
+	}
+	eventHandler := events.NewHandler(eventOpts...)
+
+	// HTTP API
+	if c.APIAddr != "" {
+		var reanalyzer api.Reanalyzer
+		if scanStore != nil {
+			reanalyzer = events.NewReanalyzer(eventBus, eventHandler, nmapService)
+			cvehistory.NewRefresher(nvdClient, scanStore, reanalyzer, c.CVEHistoryRefreshInterval).Start(context.Background())
+		}
+		cveIntel := intel.NewAggregator(nvdClient, enrichment,
+			intel.WithEPSS(epss),
+			intel.WithCacheTTL(c.CVEIntelCacheTTL))
+		var findings api.FindingStore
+		if findingStore != nil {
+			findings = findingStore
+		}
+		advisories := services.NewEnrichmentService(advisory.NewDefaultChain(c.GitHubToken), nvdClient)
+		go serveAPI(c.APIAddr, api.NewHandler(recorder, workflow, reanalyzer, offenderTracker, scanStore, nvdClient, cveIntel, nvdClient, findings, advisories, api.WithCanonicalJSON(c.ResultCanonicalJSON)))
+	}
+
+	// Off-hours CPE cache warm-up
+	if c.CacheWarmupAt != "" {
+		at, err := warmup.ParseTimeOfDay(c.CacheWarmupAt)
+		if err != nil {
+			log.Fatalf("Error parsing CACHE_WARMUP_AT: %s\n", err.Error())
+		}
+		var inventories []warmup.Inventory
+		if c.CacheWarmupInventory != "" {
+			inventories = append(inventories, warmup.FileInventory(c.CacheWarmupInventory))
+		}
+		if scanStore != nil {
+			inventories = append(inventories, warmup.ScanInventory{Store: scanStore})
+		}
+		warmup.NewJob(nvdClient, warmup.Inventories(inventories...), at, c.CacheWarmupMaxDuration).Start(context.Background())
+	}
+
 	err = eventBus.Init(func() error {
-		if err := events.SubscribeToScanStarted(eventBus, nmapHandler); err != nil {
+		if err := eventHandler.SubscribeToScanStarted(eventBus, nmapHandler); err != nil {
 			return err
 		}
-		if err := events.SubscribeToScanCancelled(eventBus); err != nil {
+		if err := eventHandler.SubscribeToScanCancelled(eventBus); err != nil {
 			return err
 		}
 		return nil
@@ -51,15 +466,166 @@ func main() {
 	if err != nil {
 		log.Fatalf("Failed to initialize Event Bus: %s\n", err.Error())
 	}
-	waitForShutdown()
+	lifecycle.ready()
+	waitForShutdown(service, reload.reload)
+	lifecycle.stop()
+
+	for _, usage := range nvdClient.KeyUsage() {
+		slog.Info("NVD API key usage",
+			slog.String("key", usage.Key),
+			slog.Int("requests", usage.Requests),
+			slog.Int("rate_limited", usage.RateLimited),
+			slog.Bool("rejected", usage.Rejected))
+	}
+	if c.NvdAdaptivePacing {
+		slog.Info("NVD API learned request spacing", slog.Duration("spacing", nvdClient.RequestSpacing()))
+	}
+	if enrichment.Cache != nil {
+		stats := enrichment.Cache.Stats()
+		slog.Info("Enrichment cache usage",
+			slog.Int("entries", stats.Entries),
+			slog.Int("hits", stats.Hits),
+			slog.Int("misses", stats.Misses),
+			slog.Int("evicted", stats.Evicted))
+	}
+	if stats, ok := nvdClient.ResponseCacheStats(); ok {
+		slog.Info("NVD API response cache usage",
+			slog.Int("entries", stats.Entries),
+			slog.Int("stored", stats.Stored),
+			slog.Int("revalidated", stats.Revalidated),
+			slog.Int("evicted", stats.Evicted))
+	}
+	if stats, ok := nvdClient.CPECacheStats(); ok {
+		slog.Info("NVD CPE cache usage",
+			slog.Int("entries", stats.Entries),
+			slog.Int("hits", stats.Hits),
+			slog.Int("negative_hits", stats.NegativeHits),
+			slog.Int("misses", stats.Misses),
+			slog.Int("expired", stats.Expired),
+			slog.Int("evicted", stats.Evicted))
+	}
 }
 
-func waitForShutdown() {
-	stop := make(chan os.Signal, 1)
-	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+// newNVDClient returns the NVD API client shared by the services, with the
+// configured API keys, rate limiting and pacing, CVSS and boolean filters,
+// rejected CVE suppression, per-CPE cap, per-CPE deadline and response cache.
+func newNVDClient(c *config.Config, extra ...services.NVDClientOption) *services.NVDClient {
+	opts := []services.NVDClientOption{
+		services.WithAPIKey(c.NvdAPIKey, c.NvdAPIKeyHeader),
+		services.WithMaxCVEsPerCPE(c.NvdMaxCVEsPerCPE),
+		services.WithCPETimeout(c.NvdCPETimeout),
+	}
+	if c.NvdAPIKeys != "" {
+		opts = append(opts, services.WithAPIKeys(nvdAPIKeys(c.NvdAPIKey, c.NvdAPIKeys), c.NvdAPIKeyHeader))
+	}
+	filter, err := services.ParseNVDFilter(c.NvdCVSSV3Severities, c.NvdCVSSV4Severities, c.NvdCVSSV3Metrics, c.NvdFlags)
+	if err != nil {
+		log.Fatalf("Error parsing NVD filter: %s\n", err.Error())
+	}
+	if !filter.IsZero() {
+		slog.Info("Filtering NVD CPE lookups",
+			slog.Any("cvss_v3_severities", filter.CVSSV3Severities),
+			slog.Any("cvss_v4_severities", filter.CVSSV4Severities),
+			slog.String("cvss_v3_metrics", filter.CVSSV3Metrics),
+			slog.Any("flags", filter.Flags))
+		opts = append(opts, services.WithCVSSFilter(filter))
+	}
+	if c.NvdSuppressRejected {
+		opts = append(opts, services.WithRejectedSuppression())
+	}
+	if c.NvdVulnerableOnly {
+		opts = append(opts, services.WithVulnerableOnly())
+	}
+	if c.NvdMatchCriteria {
+		opts = append(opts, services.WithMatchCriteriaExpansion())
+	}
+	if c.NvdAssignerNames {
+		opts = append(opts, services.WithAssignerNames(c.NvdSourceCachePath, c.NvdSourceCacheTTL))
+	}
+	if c.NvdResponseCacheEntries > 0 {
+		opts = append(opts, services.WithResponseCache(c.NvdResponseCacheEntries))
+	}
+	opts = append(opts, services.WithAccessLog(c.NvdAccessLogSize))
+	if c.NvdCPECacheEntries > 0 {
+		opts = append(opts, services.WithCPECache(c.NvdCPECacheEntries, c.NvdCPECacheTTL))
+	}
+	opts = append(opts, services.WithNegativeCPECacheTTL(c.NvdCPENegativeCacheTTL))
+	opts = append(opts, extra...)
+	if !c.NvdRateLimit {
+		opts = append(opts, services.WithRateLimiter(nil))
+	} else if c.NvdAdaptivePacing {
+		opts = append(opts, services.WithAdaptivePacing())
+	}
+	return services.NewNVDClient(opts...)
+}
 
-	// Block until signal is received
-	<-stop
-	log.Println("Shutting down gracefully...")
+// newNVDTransport returns the transport of the requests to nvd.nist.gov, API
+// and data feeds alike, with the configured proxy and TLS options. It returns
+// nil when none is set, keeping the default transport.
+func newNVDTransport(c *config.Config) http.RoundTripper {
+	transportConfig := services.NVDTransportConfig{
+		ProxyURL:           c.NvdProxyURL,
+		CABundle:           c.NvdCABundle,
+		MinTLSVersion:      c.NvdTLSMinVersion,
+		ClientCert:         c.NvdTLSClientCert,
+		ClientKey:          c.NvdTLSClientKey,
+		InsecureSkipVerify: c.NvdTLSInsecureSkipVerify,
+	}
+	if transportConfig.IsZero() {
+		return nil
+	}
+	transport, err := services.NewNVDTransport(transportConfig)
+	if err != nil {
+		log.Fatalf("Error configuring the NVD transport: %s\n", err.Error())
+	}
+	if c.NvdTLSInsecureSkipVerify {
+		slog.Warn("NVD server certificates are not verified, NVD_TLS_INSECURE_SKIP_VERIFY is set")
+	}
+	return transport
+}
+
+// newSearchIndexer returns the indexer exporting findings to the cluster at
+// SEARCH_INDEX_URL. A cluster unreachable at startup isn't fatal: documents
+// get dynamic mappings until the template is installed by the next start.
+func newSearchIndexer(c *config.Config) *search.Indexer {
+	var opts []search.Option
+	if c.SearchIndexAPIKey != "" {
+		opts = append(opts, search.WithAPIKey(c.SearchIndexAPIKey))
+	} else if c.SearchIndexUsername != "" {
+		opts = append(opts, search.WithBasicAuth(c.SearchIndexUsername, c.SearchIndexPassword))
+	}
+	indexer := search.NewIndexer(c.SearchIndexURL, c.SearchIndexPrefix, opts...)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := indexer.EnsureTemplate(ctx); err != nil {
+		slog.Warn("Failed to install the search index template", slog.Any("error", err))
+	} else {
+		slog.Info("Exporting findings to search indices", slog.String("prefix", c.SearchIndexPrefix))
+	}
+	return indexer
+}
+
+// openFindingWorkflow returns the triage workflow store, or nil when the
+// workflow is disabled. Without a journal the workflow is kept in memory.
+func openFindingWorkflow(c *config.Config) (*triage.Store, error) {
+	if !c.FindingWorkflow {
+		return nil, nil
+	}
+	if c.FindingWorkflowJournal == "" {
+		return triage.NewStore(), nil
+	}
+	return triage.Open(c.FindingWorkflowJournal)
+}
 
+func serveAPI(addr string, handler http.Handler) {
+	slog.Info("Serving HTTP API", slog.String("addr", addr))
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	if err := server.ListenAndServe(); err != nil {
+		slog.Error("HTTP API stopped", slog.Any("error", err))
+	}
 }
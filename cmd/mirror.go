@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/kptm-tools/vulnerability-analysis/pkg/config"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/mirror"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/services"
+)
+
+const (
+	mirrorModePrimary = "primary"
+	mirrorModeReplica = "replica"
+
+	mirrorUpstreamAPI   = "api"
+	mirrorUpstreamFeeds = "feeds"
+)
+
+// openMirror sets up the local CVE mirror, or returns nil when disabled. It
+// is loaded from MIRROR_POSTGRES_URL or MIRROR_DIR, or seeded from the
+// embedded snapshot. In offline mode a mirror synced beforehand is required.
+func openMirror(c *config.Config) (*mirror.Store, error) {
+	if c.OfflineMode {
+		return openOfflineMirror(c)
+	}
+	if !c.MirrorSeed && c.MirrorMode == "" && c.MirrorDir == "" && c.MirrorPostgresURL == "" {
+		return nil, nil
+	}
+
+	store, err := loadMirror(c)
+	if err != nil {
+		return nil, err
+	}
+	// The seed only fills a mirror that was never synced
+	if c.MirrorSeed && store.SyncedUntil().IsZero() {
+		seeded, err := store.Seed()
+		if err != nil {
+			return nil, err
+		}
+		slog.Info("Seeded CVE mirror from embedded snapshot", slog.Int("cves", seeded))
+	}
+	return store, nil
+}
+
+// loadMirror loads the persisted mirror, or returns an empty in memory one
+// when neither MIRROR_POSTGRES_URL nor MIRROR_DIR are set.
+func loadMirror(c *config.Config) (*mirror.Store, error) {
+	switch {
+	case c.MirrorPostgresURL != "" && c.MirrorDir != "":
+		return nil, errors.New("MIRROR_POSTGRES_URL and MIRROR_DIR can't both be set")
+	case c.MirrorPostgresURL != "":
+		store, err := mirror.OpenPostgres(context.Background(), c.MirrorPostgresURL)
+		if err != nil {
+			return nil, err
+		}
+		slog.Info("Loaded CVE mirror from Postgres", slog.Int("cves", store.Len()))
+		return store, nil
+	case c.MirrorDir != "":
+		store, err := mirror.Open(c.MirrorDir)
+		if err != nil {
+			return nil, err
+		}
+		slog.Info("Loaded CVE mirror", slog.String("dir", c.MirrorDir), slog.Int("cves", store.Len()))
+		return store, nil
+	default:
+		return mirror.NewStore(), nil
+	}
+}
+
+func openOfflineMirror(c *config.Config) (*mirror.Store, error) {
+	if c.MirrorDir == "" && c.MirrorPostgresURL == "" {
+		return nil, errors.New("MIRROR_DIR or MIRROR_POSTGRES_URL is required in offline mode")
+	}
+	if c.MirrorMode != "" {
+		return nil, errors.New("MIRROR_MODE can't be set in offline mode, sync the mirror before copying it")
+	}
+	store, err := loadMirror(c)
+	if err != nil {
+		return nil, err
+	}
+	if store.Len() == 0 {
+		return nil, errors.New("the mirror is empty, sync it with vulncli mirror sync or load it with vulncli mirror import first")
+	}
+	slog.Info("Enriching offline from CVE mirror",
+		slog.Int("cves", store.Len()),
+		slog.Time("synced_until", store.SyncedUntil()))
+	return store, nil
+}
+
+// mirrorOptions has the NVD client look CVEs up in the mirror, and serve
+// lookups from it while NVD is in maintenance, or always with
+// MIRROR_LOCAL_LOOKUPS or in offline mode.
+func mirrorOptions(c *config.Config, store *mirror.Store) []services.NVDClientOption {
+	if store == nil {
+		return nil
+	}
+	opts := []services.NVDClientOption{services.WithOfflineSource(store)}
+	if c.OfflineMode {
+		return append(opts, services.WithOfflineMode())
+	}
+	if c.MirrorLocalLookups {
+		opts = append(opts, services.WithLocalLookups())
+	}
+	// In parallel mode the mirror races the live API instead of answering first
+	if c.EnrichmentParallel {
+		opts = append(opts, services.WithCVESources(c.EnrichmentSourceTimeout, services.NamedCVESource{Name: "mirror", Source: store}))
+	} else {
+		opts = append(opts, services.WithKnowledgeCache(store))
+	}
+	return opts
+}
+
+// startMirrorSync keeps the mirror synced from NVD on a primary instance, by
+// crawling the API or downloading the data feeds, or from the primary's
+// replication API on a regional replica. The feeds are downloaded through
+// transport, the one of the NVD client, or the default one when nil.
+func startMirrorSync(ctx context.Context, c *config.Config, store *mirror.Store, nvd *services.NVDClient, transport http.RoundTripper) error {
+	if store == nil {
+		return nil
+	}
+
+	var syncer *mirror.Syncer
+	switch c.MirrorMode {
+	case "":
+	case mirrorModePrimary:
+		from, err := time.Parse(time.RFC3339, c.MirrorSyncFrom)
+		if err != nil {
+			return fmt.Errorf("invalid MIRROR_SYNC_FROM: %w", err)
+		}
+		var upstream mirror.Upstream
+		switch c.MirrorUpstream {
+		case mirrorUpstreamAPI:
+			upstream = mirror.NewNVDUpstream(nvd.FetchModifiedRange)
+		case mirrorUpstreamFeeds:
+			// The feeds hold every record, the first sync needs no start
+			upstream, from = mirror.NewFeedUpstream(c.MirrorFeedURL, transport), time.Time{}
+		default:
+			return fmt.Errorf("unknown MIRROR_UPSTREAM: %s", c.MirrorUpstream)
+		}
+		syncer = mirror.NewSyncer(store, upstream, c.MirrorSyncInterval, from)
+		if c.MirrorReplicationAddr != "" {
+			if c.MirrorReplicationToken == "" && !c.MirrorReplicationUnauthenticated {
+				return errors.New("MIRROR_REPLICATION_TOKEN is required to serve the replication API, set MIRROR_REPLICATION_UNAUTHENTICATED to serve it without one or an empty MIRROR_REPLICATION_ADDR not to serve it")
+			}
+			go serveReplication(store, c.MirrorReplicationAddr, c.MirrorReplicationToken)
+		}
+	case mirrorModeReplica:
+		if c.MirrorPrimaryURL == "" {
+			return errors.New("MIRROR_PRIMARY_URL is required for replica mirrors")
+		}
+		syncer = mirror.NewSyncer(store, mirror.NewReplicaUpstream(c.MirrorPrimaryURL, c.MirrorReplicationToken), c.MirrorSyncInterval, time.Time{})
+	default:
+		return fmt.Errorf("unknown MIRROR_MODE: %s", c.MirrorMode)
+	}
+
+	if syncer != nil {
+		go syncer.Run(ctx)
+	}
+	return nil
+}
+
+func serveReplication(store *mirror.Store, addr, token string) {
+	slog.Info("Serving mirror replication API", slog.String("addr", addr), slog.Bool("authenticated", token != ""))
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           mirror.NewReplicationHandler(store, token),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	if err := server.ListenAndServe(); err != nil {
+		slog.Error("Mirror replication API stopped", slog.Any("error", err))
+	}
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"log/slog"
+
+	"github.com/kptm-tools/vulnerability-analysis/pkg/config"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/msrc"
+)
+
+// loadMSRCUpdates loads the MSRC security update guides stored as CVRF JSON
+// in MSRC_UPDATES_DIR. The index is nil when KB mapping is disabled.
+func loadMSRCUpdates(c *config.Config) (*msrc.Index, error) {
+	if c.MSRCUpdatesDir == "" {
+		return nil, nil
+	}
+
+	index := msrc.NewIndex()
+	loaded, err := index.LoadDir(c.MSRCUpdatesDir)
+	if err != nil && loaded == 0 {
+		return nil, err
+	}
+	if err != nil {
+		slog.Warn("Skipped invalid MSRC updates", slog.Any("error", err))
+	}
+	slog.Info("Loaded MSRC updates", slog.String("dir", c.MSRCUpdatesDir), slog.Int("updates", loaded))
+	return index, nil
+}
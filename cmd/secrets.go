@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+
+	"github.com/kptm-tools/vulnerability-analysis/pkg/config"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/secrets"
+)
+
+// openSecrets returns the secret manager of SECRETS_PROVIDER.
+func openSecrets(c *config.Config) (secrets.SecretProvider, error) {
+	switch c.SecretsProvider {
+	case "", "env":
+		return secrets.Env{}, nil
+	case "vault":
+		vault, err := secrets.NewVaultFromEnv(c.SecretsVaultMount, c.SecretsVaultTokenFile)
+		if err != nil {
+			return nil, err
+		}
+		return vault, nil
+	case "aws":
+		manager, err := secrets.NewAWSSecretsManagerFromEnv()
+		if err != nil {
+			return nil, err
+		}
+		return manager, nil
+	case "kubernetes":
+		return secrets.NewKubernetes(c.SecretsDir), nil
+	default:
+		return nil, fmt.Errorf("unknown SECRETS_PROVIDER: %s", c.SecretsProvider)
+	}
+}
+
+// resolveSecrets replaces the configuration values referring to a secret
+// with its value.
+func resolveSecrets(ctx context.Context, provider secrets.SecretProvider, c *config.Config) error {
+	for name, value := range c.SecretFields() {
+		if !secrets.IsRef(*value) {
+			continue
+		}
+		resolved, err := secrets.Resolve(ctx, provider, *value)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		*value = resolved
+		slog.Info("Fetched secret", slog.String("variable", name), slog.String("provider", c.SecretsProvider))
+	}
+	return nil
+}
+
+// rotatesSecrets reports whether the values of refs, any of which refers to a
+// secret, are fetched again every SECRETS_REFRESH_INTERVAL.
+func rotatesSecrets(c *config.Config, refs []string) bool {
+	return c.SecretsRefreshInterval > 0 && slices.ContainsFunc(refs, secrets.IsRef)
+}
+
+// nvdAPIKeys returns the keys of NVD_API_KEY and the comma separated
+// NVD_API_KEYS.
+func nvdAPIKeys(key, keys string) []string {
+	all := []string{key}
+	for _, k := range strings.Split(keys, ",") {
+		all = append(all, strings.TrimSpace(k))
+	}
+	return all
+}
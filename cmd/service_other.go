@@ -0,0 +1,9 @@
+//go:build !windows
+
+package main
+
+// startService returns the requests of the service manager, only received
+// through signals outside Windows.
+func startService() serviceControl {
+	return serviceControl{stopped: func() {}}
+}
@@ -0,0 +1,84 @@
+//go:build windows
+
+package main
+
+import (
+	"log"
+
+	"golang.org/x/sys/windows/svc"
+)
+
+// windowsService relays the requests of the Windows service manager to
+// waitForShutdown.
+type windowsService struct {
+	stop     chan struct{}
+	reload   chan struct{}
+	finished chan struct{}
+}
+
+// startService registers the process with the Windows service manager when
+// started by it, e.g. after
+//
+//	sc.exe create vulnerability-analysis binPath= "C:\Program Files\vulnerability-analysis\vulnerability-analysis.exe" start= auto
+//
+// Stop and shutdown requests stop the service, parameter changes reload its
+// configuration as SIGHUP does.
+func startService() serviceControl {
+	isService, err := svc.IsWindowsService()
+	if err != nil {
+		log.Fatalf("Error detecting the Windows service manager: %s\n", err.Error())
+	}
+	if !isService {
+		return serviceControl{stopped: func() {}}
+	}
+
+	s := &windowsService{
+		stop:     make(chan struct{}),
+		reload:   make(chan struct{}, 1),
+		finished: make(chan struct{}),
+	}
+	returned := make(chan struct{})
+	go func() {
+		defer close(returned)
+		if err := svc.Run(serviceName, s); err != nil {
+			log.Fatalf("Error running as a Windows service: %s\n", err.Error())
+		}
+	}()
+	return serviceControl{
+		stop:   s.stop,
+		reload: s.reload,
+		stopped: func() {
+			close(s.finished)
+			<-returned
+		},
+	}
+}
+
+func (s *windowsService) Execute(_ []string, requests <-chan svc.ChangeRequest, status chan<- svc.Status) (bool, uint32) {
+	const accepted = svc.AcceptStop | svc.AcceptShutdown | svc.AcceptParamChange
+	status <- svc.Status{State: svc.StartPending}
+	status <- svc.Status{State: svc.Running, Accepts: accepted}
+
+	for {
+		select {
+		case req := <-requests:
+			switch req.Cmd {
+			case svc.Interrogate:
+				status <- req.CurrentStatus
+			case svc.ParamChange:
+				select {
+				case s.reload <- struct{}{}:
+				default:
+				}
+			case svc.Stop, svc.Shutdown:
+				status <- svc.Status{State: svc.StopPending}
+				close(s.stop)
+				<-s.finished
+				return false, 0
+			}
+		case <-s.finished:
+			// Stopped on its own, e.g. after a fatal error
+			return false, 0
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/kptm-tools/vulnerability-analysis/pkg/backfill"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/intel"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/search"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/services"
+)
+
+// runBackfill fills the fields added since findings were exported to the
+// search indices. NVD requests stay within the rate limit of the API key and
+// the job resumes from -checkpoint when interrupted.
+func runBackfill(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("backfill", flag.ExitOnError)
+	indexURL := fs.String("index-url", os.Getenv("SEARCH_INDEX_URL"), "Elasticsearch or OpenSearch URL")
+	prefix := fs.String("prefix", envOr("SEARCH_INDEX_PREFIX", "vulnerability-findings"), "prefix of the finding indices")
+	username := fs.String("username", os.Getenv("SEARCH_INDEX_USERNAME"), "search cluster username")
+	password := fs.String("password", os.Getenv("SEARCH_INDEX_PASSWORD"), "search cluster password")
+	apiKey := fs.String("index-api-key", os.Getenv("SEARCH_INDEX_API_KEY"), "search cluster API key")
+	fields := fs.String("fields", "cwes,title", "comma separated fields to backfill: cwes, title, kev and epss")
+	batch := fs.Int("batch", 200, "findings backfilled per batch")
+	interval := fs.Duration("interval", 0, "pacing between batches, on top of the NVD rate limit")
+	checkpoint := fs.String("checkpoint", "backfill-checkpoint.json", "file recording the progress, empty to start over on every run")
+	nvdURL := fs.String("api", "", "NVD API URL, the public API when empty")
+	nvdKey := fs.String("api-key", os.Getenv("NVD_API_KEY"), "NVD API key")
+	epssURL := fs.String("epss-url", os.Getenv("EPSS_URL"), "EPSS API URL, FIRST when empty")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *indexURL == "" {
+		return fmt.Errorf("-index-url or SEARCH_INDEX_URL is required")
+	}
+
+	var opts []search.Option
+	if *apiKey != "" {
+		opts = append(opts, search.WithAPIKey(*apiKey))
+	} else if *username != "" {
+		opts = append(opts, search.WithBasicAuth(*username, *password))
+	}
+	indexer := search.NewIndexer(*indexURL, *prefix, opts...)
+
+	nvd := services.NewNVDClient(services.WithBaseURL(*nvdURL), services.WithAPIKey(*nvdKey, ""))
+	lookup := backfill.NewCVELookup(services.NewEnrichmentService(nil, nvd))
+	backfillFields, err := backfill.Fields(lookup, intel.NewEPSSClient(*epssURL), strings.Split(*fields, ",")...)
+	if err != nil {
+		return err
+	}
+
+	job := &backfill.Job{
+		Store:          indexer,
+		Fields:         backfillFields,
+		BatchSize:      *batch,
+		Interval:       *interval,
+		CheckpointPath: *checkpoint,
+	}
+	start := time.Now()
+	reports, err := job.Run(ctx)
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if encErr := enc.Encode(reports); encErr != nil {
+		return encErr
+	}
+	fmt.Fprintf(os.Stderr, "backfill ran for %s\n", time.Since(start).Round(time.Second))
+	return err
+}
+
+func envOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
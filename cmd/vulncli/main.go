@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/kptm-tools/vulnerability-analysis/pkg/loadtest"
+	"github.com/lmittmann/tint"
+)
+
+const usage = `Usage: vulncli <command> [flags]
+
+Commands:
+  loadtest   Run synthetic scans against a mock NVD server and report throughput
+  seed       Build the embedded CVE seed snapshot from NVD responses or the NVD API
+  mirror     Manage the local CVE mirror (sync, verify, stats, compact, import)
+  backfill   Fill the fields added since findings were exported to the search indices
+  simulate   Run a captured scan event through the local pipeline and print the events it would publish
+  requests   Print the latest NVD requests of a running service and the quota it has left
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	slog.SetDefault(slog.New(tint.NewHandler(os.Stderr, &tint.Options{
+		Level:      slog.LevelWarn,
+		TimeFormat: time.Stamp,
+	})))
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	var err error
+	switch os.Args[1] {
+	case "loadtest":
+		err = runLoadTest(ctx, os.Args[2:])
+	case "seed":
+		err = runSeed(ctx, os.Args[2:])
+	case "mirror":
+		err = runMirror(ctx, os.Args[2:])
+	case "backfill":
+		err = runBackfill(ctx, os.Args[2:])
+	case "simulate":
+		err = runSimulate(ctx, os.Args[2:])
+	case "requests":
+		err = runRequests(ctx, os.Args[2:])
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "vulncli %s: %s\n", os.Args[1], err.Error())
+		os.Exit(1)
+	}
+}
+
+func runLoadTest(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("loadtest", flag.ExitOnError)
+	hosts := fs.Int("hosts", 100, "number of synthetic hosts")
+	cpes := fs.Int("cpes", 5, "number of CPEs (services) per host")
+	concurrency := fs.Int("concurrency", 8, "number of hosts analyzed in parallel")
+	seed := fs.Int64("seed", 1, "random seed for the scan generator")
+	interval := fs.Duration("interval", 0, "pacing between NVD requests per host")
+	latency := fs.Duration("latency", 20*time.Millisecond, "mock NVD response latency")
+	maxVulns := fs.Int("max-vulns", 50, "maximum CVEs returned per CPE by the mock")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	report, err := loadtest.Run(ctx, loadtest.Config{
+		Hosts:           *hosts,
+		CPEsPerHost:     *cpes,
+		Concurrency:     *concurrency,
+		Seed:            *seed,
+		RequestInterval: *interval,
+		MockLatency:     *latency,
+		MaxVulnsPerCPE:  *maxVulns,
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(report.String())
+	return nil
+}
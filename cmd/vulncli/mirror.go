@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/kptm-tools/vulnerability-analysis/pkg/mirror"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/services"
+)
+
+const mirrorUsage = `Usage: vulncli mirror <sync|verify|stats|compact> [flags]
+       vulncli mirror import -pg <dsn> [-batch n] <file>...
+
+The mirror directory must not be in use by a running service while it is
+synced or compacted.
+
+import bulk loads NVD data feeds, saved NVD API responses or mirror
+snapshots into a Postgres mirror. An interrupted import resumes where it
+stopped when run again with the same files, files that changed are loaded
+again. Once every file is loaded, the mirror is synced up to the oldest of
+their timestamps, so pass the complete set of feeds.
+`
+
+func runMirror(ctx context.Context, args []string) error {
+	if len(args) < 1 {
+		fmt.Fprint(os.Stderr, mirrorUsage)
+		os.Exit(2)
+	}
+
+	fs := flag.NewFlagSet("mirror "+args[0], flag.ExitOnError)
+	dir := fs.String("dir", os.Getenv("MIRROR_DIR"), "mirror directory")
+	pg := fs.String("pg", os.Getenv("MIRROR_POSTGRES_URL"), "Postgres mirror DSN, instead of a mirror directory")
+	batch := fs.Int("batch", mirror.DefaultImportBatchSize, "records loaded per transaction by import")
+	primary := fs.String("primary", "", "primary mirror URL, to sync or verify a replica")
+	token := fs.String("token", os.Getenv("MIRROR_REPLICATION_TOKEN"), "replication API token")
+	apiURL := fs.String("api", "", "NVD API URL")
+	apiKey := fs.String("api-key", os.Getenv("NVD_API_KEY"), "NVD API key")
+	interval := fs.Duration("interval", 6*time.Second, "pacing between NVD API requests")
+	rateLimit := fs.Bool("rate-limit", true, "keep NVD API requests within the published rate limit")
+	from := fs.String("from", "1999-01-01T00:00:00Z", "start of the first sync of an empty mirror")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	if args[0] == "import" {
+		return importMirror(ctx, *pg, *batch, fs.Args())
+	}
+	if *dir == "" && *pg == "" {
+		return fmt.Errorf("-dir or MIRROR_DIR, or -pg or MIRROR_POSTGRES_URL, is required")
+	}
+	opts := []services.NVDClientOption{
+		services.WithBaseURL(*apiURL),
+		services.WithAPIKey(*apiKey, os.Getenv("NVD_API_KEY_HEADER")),
+		services.WithRequestInterval(*interval),
+	}
+	if !*rateLimit {
+		opts = append(opts, services.WithRateLimiter(nil))
+	}
+	nvd := services.NewNVDClient(opts...)
+
+	var store *mirror.Store
+	var err error
+	if *pg != "" {
+		store, err = mirror.OpenPostgres(ctx, *pg)
+	} else {
+		store, err = mirror.Open(*dir)
+	}
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "sync":
+		return syncMirror(ctx, nvd, store, *primary, *token, *from)
+	case "verify":
+		return verifyMirror(ctx, nvd, store, *primary, *token)
+	case "stats":
+		return printJSON(store.Stats())
+	case "compact":
+		before := store.Stats()
+		if err := store.Compact(); err != nil {
+			return err
+		}
+		after := store.Stats()
+		fmt.Printf("compacted %d journal entries, %d bytes -> %d bytes\n",
+			before.JournalEntries, before.JournalBytes+before.SnapshotBytes, after.SnapshotBytes)
+		return nil
+	default:
+		fmt.Fprint(os.Stderr, mirrorUsage)
+		os.Exit(2)
+	}
+	return nil
+}
+
+// importMirror bulk loads files into a Postgres mirror, printing the
+// progress after every batch.
+func importMirror(ctx context.Context, dsn string, batchSize int, paths []string) error {
+	if dsn == "" {
+		return fmt.Errorf("-pg or MIRROR_POSTGRES_URL is required")
+	}
+	if len(paths) == 0 {
+		return fmt.Errorf("no file to import")
+	}
+	backend, err := mirror.NewPostgresBackend(ctx, dsn)
+	if err != nil {
+		return err
+	}
+	defer backend.Close()
+
+	importer := mirror.NewImporter(backend)
+	importer.BatchSize = batchSize
+	importer.Progress = func(p mirror.ImportProgress) {
+		switch {
+		case p.Done && p.Loaded == p.Skipped:
+			fmt.Printf("%s: already imported, %d records\n", p.Source, p.Loaded)
+		case p.Done:
+			fmt.Printf("%s: imported %d records\n", p.Source, p.Loaded)
+		default:
+			fmt.Printf("%s: %d records, %.0f/s\n", p.Source, p.Loaded, p.Rate())
+		}
+	}
+
+	start := time.Now()
+	loaded, err := importer.Import(ctx, paths...)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("imported %d records in %s\n", loaded, time.Since(start).Round(time.Second))
+	return nil
+}
+
+func syncMirror(ctx context.Context, nvd *services.NVDClient, store *mirror.Store, primary, token, from string) error {
+	var upstream mirror.Upstream = mirror.NewNVDUpstream(nvd.FetchModifiedRange)
+	if primary != "" {
+		upstream = mirror.NewReplicaUpstream(primary, token)
+	}
+
+	start, err := time.Parse(time.RFC3339, from)
+	if err != nil {
+		return fmt.Errorf("invalid -from: %w", err)
+	}
+
+	synced, err := mirror.NewSyncer(store, upstream, 0, start).SyncOnce(ctx)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("synced %d records, %d in mirror, up to %s\n",
+		synced, store.Len(), store.SyncedUntil().Format(time.RFC3339))
+	return nil
+}
+
+// verifyMirror compares the record count with NVD, or the count and digest
+// with the primary mirror of a replica.
+func verifyMirror(ctx context.Context, nvd *services.NVDClient, store *mirror.Store, primary, token string) error {
+	local := store.Meta()
+	fmt.Printf("local:    %d records, synced until %s, digest %s\n",
+		local.Records, local.SyncedUntil.Format(time.RFC3339), local.Digest)
+
+	if primary != "" {
+		remote, err := mirror.NewReplicaUpstream(primary, token).FetchMeta(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("primary:  %d records, synced until %s, digest %s\n",
+			remote.Records, remote.SyncedUntil.Format(time.RFC3339), remote.Digest)
+
+		if remote.Digest != local.Digest {
+			if remote.SyncedUntil.After(local.SyncedUntil) {
+				return fmt.Errorf("mirror is behind its primary, sync it first")
+			}
+			return fmt.Errorf("mirror records differ from its primary")
+		}
+		fmt.Println("ok")
+		return nil
+	}
+
+	total, err := nvd.FetchTotalCVEs(ctx)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("upstream: %d records\n", total)
+
+	if total != local.Records {
+		return fmt.Errorf("mirror holds %d records, NVD publishes %d", local.Records, total)
+	}
+	fmt.Println("ok")
+	return nil
+}
+
+func printJSON(v any) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
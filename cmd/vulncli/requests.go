@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/kptm-tools/vulnerability-analysis/pkg/services"
+)
+
+// runRequests prints the latest NVD requests of a running service and the
+// quota it has left, from its API, to tell why enrichments are slow.
+func runRequests(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("requests", flag.ExitOnError)
+	apiURL := fs.String("api", envOr("API_URL", "http://localhost:8002"), "URL of the service API")
+	limit := fs.Int("n", 20, "number of requests to print, 0 for every one kept")
+	asJSON := fs.Bool("json", false, "print the report as JSON")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	endpoint := strings.TrimSuffix(*apiURL, "/") + "/api/v1/nvd/requests?" + url.Values{"limit": {strconv.Itoa(*limit)}}.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach the service API: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("service API answered %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	var report services.NVDAccessReport
+	if err := json.NewDecoder(resp.Body).Decode(&report); err != nil {
+		return fmt.Errorf("invalid report: %w", err)
+	}
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(report)
+	}
+	printAccessReport(os.Stdout, report)
+	return nil
+}
+
+func printAccessReport(w io.Writer, report services.NVDAccessReport) {
+	if q := report.Quota; q != nil {
+		fmt.Fprintf(w, "quota: %d/%d requests left per %s", q.Remaining, q.Requests, time.Duration(q.WindowSeconds*float64(time.Second)))
+		if !q.ResetsAt.IsZero() {
+			fmt.Fprintf(w, ", next in %s", time.Until(q.ResetsAt).Round(100*time.Millisecond))
+		}
+		if q.SpacingMS > 0 {
+			fmt.Fprintf(w, ", spaced by %.0fms", q.SpacingMS)
+		}
+		fmt.Fprintln(w)
+		for _, key := range q.Keys {
+			fmt.Fprintf(w, "key %s: %d requests, %d rate limited, rejected %t\n", key.Key, key.Requests, key.RateLimited, key.Rejected)
+		}
+	} else {
+		fmt.Fprintln(w, "quota: requests aren't rate limited")
+	}
+	fmt.Fprintln(w)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "TIME\tSTATUS\tLATENCY\tQUEUED\tTENANT\tSCAN\tREQUEST")
+	for _, r := range report.Requests {
+		status := strconv.Itoa(r.Status)
+		if r.Error != "" {
+			status = "error"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%.0fms\t%.0fms\t%s\t%s\t%s?%s\n",
+			r.Time.Local().Format(time.TimeOnly), status, r.LatencyMS, r.QueuedMS, orDash(r.Tenant), orDash(r.ScanID), r.Endpoint, r.Query)
+	}
+	tw.Flush()
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
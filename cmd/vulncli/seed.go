@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kptm-tools/vulnerability-analysis/nvd/schema"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/mirror"
+)
+
+// runSeed builds a seed snapshot. Records are read from NVD API response
+// files given as arguments, or fetched from the NVD API when no files are
+// given. The snapshot holds, up to -limit, the CVEs of the CISA KEV catalog
+// as flagged by NVD, most recently added first, then the CVEs of the -ids
+// file, most matched first. Other records are left out.
+func runSeed(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("seed", flag.ExitOnError)
+	idsPath := fs.String("ids", "", "file listing the most matched CVE IDs, one per line, most matched first")
+	limit := fs.Int("limit", 5000, "maximum number of CVEs in the snapshot")
+	out := fs.String("out", "pkg/mirror/seed/cves.json.gz", "snapshot output path")
+	apiURL := fs.String("api", "https://services.nvd.nist.gov/rest/json/cves/2.0", "NVD API URL used when no files are given")
+	apiKey := fs.String("api-key", os.Getenv("NVD_API_KEY"), "NVD API key used when no files are given")
+	interval := fs.Duration("interval", 6*time.Second, "pacing between NVD API requests")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	var ids []string
+	if *idsPath != "" {
+		var err error
+		if ids, err = readIDs(*idsPath); err != nil {
+			return err
+		}
+	}
+
+	var byID map[string]schema.Vulnerability
+	var err error
+	if fs.NArg() > 0 {
+		byID, err = seedFromFiles(fs.Args())
+	} else {
+		byID, err = seedFromAPI(ctx, *apiURL, *apiKey, *interval, ids, *limit)
+	}
+	if err != nil {
+		return err
+	}
+	records := rankSeed(byID, ids, *limit)
+	if len(records) == 0 {
+		return fmt.Errorf("no known exploited or listed CVEs to seed")
+	}
+
+	f, err := os.Create(*out)
+	if err != nil {
+		return fmt.Errorf("failed to create snapshot: %w", err)
+	}
+	defer f.Close()
+
+	if err := mirror.WriteSnapshot(f, records); err != nil {
+		return err
+	}
+	fmt.Printf("wrote %d CVEs to %s\n", len(records), *out)
+	return nil
+}
+
+// rankSeed returns up to limit records of byID: the known exploited ones,
+// most recently added to the KEV catalog first, then the ones of ids, in
+// order.
+func rankSeed(byID map[string]schema.Vulnerability, ids []string, limit int) []schema.Vulnerability {
+	var kev []schema.Vulnerability
+	for _, v := range byID {
+		if knownExploited(v) {
+			kev = append(kev, v)
+		}
+	}
+	sort.Slice(kev, func(i, j int) bool {
+		a, b := *kev[i].Cve.CisaExploitAdd, *kev[j].Cve.CisaExploitAdd
+		if a != b {
+			return a > b
+		}
+		return kev[i].Cve.ID < kev[j].Cve.ID
+	})
+
+	records := kev
+	for _, id := range ids {
+		if v, ok := byID[id]; ok && !knownExploited(v) {
+			records = append(records, v)
+		}
+	}
+	if len(records) > limit {
+		records = records[:limit]
+	}
+	return records
+}
+
+func knownExploited(v schema.Vulnerability) bool {
+	return v.Cve.CisaExploitAdd != nil && *v.Cve.CisaExploitAdd != ""
+}
+
+func readIDs(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open CVE ID list: %w", err)
+	}
+	defer f.Close()
+
+	var ids []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			ids = append(ids, strings.ToUpper(line))
+		}
+	}
+	return ids, scanner.Err()
+}
+
+func seedFromFiles(paths []string) (map[string]schema.Vulnerability, error) {
+	byID := make(map[string]schema.Vulnerability)
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		var resp schema.NvdAPIResponse
+		if err := json.Unmarshal(data, &resp); err != nil {
+			return nil, fmt.Errorf("failed to decode %s: %w", path, err)
+		}
+		for _, v := range resp.Vulnerabilities {
+			byID[strings.ToUpper(v.Cve.ID)] = v
+		}
+	}
+	return byID, nil
+}
+
+// seedFromAPI fetches the known exploited CVEs with the hasKev query, then
+// the CVEs of ids one by one until limit records are held.
+func seedFromAPI(ctx context.Context, apiURL, apiKey string, interval time.Duration, ids []string, limit int) (map[string]schema.Vulnerability, error) {
+	client := &http.Client{Timeout: 60 * time.Second}
+	byID := make(map[string]schema.Vulnerability)
+	requests := 0
+	get := func(query url.Values) (*schema.NvdAPIResponse, error) {
+		if requests > 0 {
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(interval):
+			}
+		}
+		requests++
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, apiURL+"?"+query.Encode(), nil)
+		if err != nil {
+			return nil, err
+		}
+		if apiKey != "" {
+			req.Header.Set("apiKey", apiKey)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		var nvdResp schema.NvdAPIResponse
+		err = json.NewDecoder(resp.Body).Decode(&nvdResp)
+		if resp.StatusCode != http.StatusOK || err != nil {
+			return nil, fmt.Errorf("status %s: %v", resp.Status, err)
+		}
+		return &nvdResp, nil
+	}
+
+	for start := 0; ; {
+		query := url.Values{"hasKev": {""}, "startIndex": {strconv.Itoa(start)}, "resultsPerPage": {"2000"}}
+		page, err := get(query)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch the known exploited CVEs: %w", err)
+		}
+		for _, v := range page.Vulnerabilities {
+			byID[strings.ToUpper(v.Cve.ID)] = v
+		}
+		start += len(page.Vulnerabilities)
+		if len(page.Vulnerabilities) == 0 || start >= page.TotalResults {
+			break
+		}
+	}
+
+	for _, id := range ids {
+		if len(byID) >= limit {
+			break
+		}
+		if _, ok := byID[id]; ok {
+			continue
+		}
+		page, err := get(url.Values{"cveId": {id}})
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch %s: %w", id, err)
+		}
+		for _, v := range page.Vulnerabilities {
+			byID[strings.ToUpper(v.Cve.ID)] = v
+		}
+	}
+	return byID, nil
+}
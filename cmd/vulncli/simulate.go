@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/kptm-tools/vulnerability-analysis/pkg/events"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/handlers"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/nvdmock"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/output"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/services"
+)
+
+// runSimulate feeds a captured ScanStartedEvent through the local pipeline
+// and prints the events it would publish instead of publishing them. The
+// target is scanned with the local nmap, and CPEs are looked up on a mock
+// NVD server unless -backend is nvd. With -canonical, the events are printed
+// as canonical JSON, for golden files diffed between runs.
+func runSimulate(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("simulate", flag.ExitOnError)
+	file := fs.String("file", "", "captured ScanStartedEvent payload")
+	backend := fs.String("backend", "mock", "NVD backend: mock or nvd")
+	nvdURL := fs.String("api", "", "NVD API URL of the nvd backend, the public API when empty")
+	nvdKey := fs.String("api-key", os.Getenv("NVD_API_KEY"), "NVD API key of the nvd backend")
+	latency := fs.Duration("latency", 0, "mock NVD response latency")
+	maxVulns := fs.Int("max-vulns", 50, "maximum CVEs returned per CPE by the mock")
+	canonical := fs.Bool("canonical", false, "print the events as canonical JSON, with sorted keys and findings")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *file == "" {
+		return fmt.Errorf("-file is required")
+	}
+
+	data, err := os.ReadFile(*file)
+	if err != nil {
+		return fmt.Errorf("failed to read scan event: %w", err)
+	}
+	if !json.Valid(data) {
+		return fmt.Errorf("%s is not a JSON scan event", *file)
+	}
+
+	var nvd *services.NVDClient
+	switch *backend {
+	case "mock":
+		mock := nvdmock.NewServer(nvdmock.Options{Latency: *latency, MaxVulnsPerCPE: *maxVulns})
+		defer mock.Close()
+		nvd = services.NewNVDClient(services.WithBaseURL(mock.URL), services.WithRateLimiter(nil))
+	case "nvd":
+		nvd = services.NewNVDClient(services.WithBaseURL(*nvdURL), services.WithAPIKey(*nvdKey, ""))
+	default:
+		return fmt.Errorf("unknown backend %q, expected mock or nvd", *backend)
+	}
+	handler := handlers.NewNmapHandler(services.NewNmapService(nvd))
+	eventHandler := events.NewHandler(events.WithOutput(output.Options{Canonical: *canonical}))
+
+	// The handler isn't cancellable, the scan stops once nmap times out
+	done := make(chan struct{})
+	printer := &eventPrinter{w: os.Stdout, canonical: *canonical}
+	start := time.Now()
+	go func() {
+		defer close(done)
+		eventHandler.HandleScanStarted(printer, handler, data)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	fmt.Fprintf(os.Stderr, "simulated scan in %s, %d events would be published\n", time.Since(start).Round(time.Millisecond), printer.published)
+	return nil
+}
+
+// eventPrinter stands in for the event bus, printing every published event
+// with its subject. JSON payloads are indented, and canonicalized when
+// canonical is set.
+type eventPrinter struct {
+	w         io.Writer
+	canonical bool
+	mu        sync.Mutex
+	published int
+}
+
+func (p *eventPrinter) Publish(subject string, payload []byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.published++
+	if p.canonical {
+		if canonical, err := output.CanonicalizeJSON(payload); err == nil {
+			payload = canonical
+		}
+	}
+	var indented bytes.Buffer
+	if err := json.Indent(&indented, payload, "", "  "); err == nil {
+		payload = indented.Bytes()
+	}
+	_, err := fmt.Fprintf(p.w, "# %s\n%s\n", subject, payload)
+	return err
+}
@@ -0,0 +1,397 @@
+// Package client is a client of the NVD CVE API 2.0. It sends the API key,
+// follows the startIndex pagination and keeps requests within the published
+// rate limit when given a Limiter.
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kptm-tools/vulnerability-analysis/nvd/schema"
+)
+
+// DefaultBaseURL is the NVD CVE API endpoint.
+const DefaultBaseURL = "https://services.nvd.nist.gov/rest/json/cves/2.0"
+
+// DefaultAPIKeyHeader is the request header NVD reads the API key from.
+const DefaultAPIKeyHeader = "apiKey"
+
+// MaxResultsPerPage is the largest page the CVE API returns.
+const MaxResultsPerPage = 2000
+
+var (
+	ErrServiceUnavailable = errors.New("NVD API service unavailable (503)")
+	ErrStatus             = errors.New("NVD API status error")
+	ErrDecode             = errors.New("failed to decode NVD API response")
+	ErrRateLimited        = errors.New("NVD API rate limit exceeded")
+	ErrKeyRejected        = errors.New("NVD API key rejected")
+)
+
+// RateLimitError is returned when NVD throttles a request, with a 429 or a
+// 403 carrying rate limit headers or no explanation. RetryAfter is the delay
+// the server asked for, capped, zero when it didn't send one.
+type RateLimitError struct {
+	StatusCode int
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitError) Error() string {
+	if e.RetryAfter > 0 {
+		return fmt.Sprintf("%s (%d), retry after %s", ErrRateLimited, e.StatusCode, e.RetryAfter)
+	}
+	return fmt.Sprintf("%s (%d)", ErrRateLimited, e.StatusCode)
+}
+
+func (e *RateLimitError) Unwrap() error {
+	return ErrRateLimited
+}
+
+// Client queries the CVE API. The zero value is not usable, use New.
+type Client struct {
+	BaseURL          string
+	HistoryURL       string
+	ProductsURL      string
+	MatchCriteriaURL string
+	SourceURL        string
+	APIKey           string
+	APIKeyHeader     string
+	HTTPClient       *http.Client
+
+	// Limiter, when set, delays requests to stay within RateLimit. Share one
+	// Limiter between the clients of a process.
+	Limiter *Limiter
+
+	// Keys, when set, replaces APIKey with a rotation over several keys. A
+	// request NVD throttles or rejects is sent again with the next key.
+	Keys *KeyRing
+
+	// Cache, when set, sends conditional requests for the URLs of cached
+	// responses and decodes the cached body when NVD answers 304.
+	Cache *ResponseCache
+}
+
+// New returns a client of the CVE API at baseURL, or of NVD when empty, and
+// of the CVE Change History, Products, Match Criteria and Source APIs next to
+// it. An empty apiKey sends unauthenticated requests.
+func New(baseURL, apiKey string) *Client {
+	if baseURL == "" {
+		baseURL = DefaultBaseURL
+	}
+	return &Client{
+		BaseURL:          baseURL,
+		HistoryURL:       historyURL(baseURL),
+		ProductsURL:      productsURL(baseURL),
+		MatchCriteriaURL: matchCriteriaURL(baseURL),
+		SourceURL:        sourceURL(baseURL),
+		APIKey:           apiKey,
+		APIKeyHeader:     DefaultAPIKeyHeader,
+		HTTPClient:       &http.Client{Timeout: 60 * time.Second},
+	}
+}
+
+// RateLimit returns the limit NVD enforces for the client's API key, or the
+// sum of the limits of the keys of Keys NVD hasn't rejected.
+func (c *Client) RateLimit() RateLimit {
+	if c.Keys == nil {
+		return RateLimitFor(c.APIKey != "")
+	}
+	active := c.Keys.Active()
+	if active == 0 {
+		return UnkeyedRateLimit
+	}
+	limit := KeyedRateLimit
+	limit.Requests *= active
+	return limit
+}
+
+// Fetch issues a single CVE API request.
+func (c *Client) Fetch(ctx context.Context, query url.Values) (*schema.NvdAPIResponse, error) {
+	var resp schema.NvdAPIResponse
+	if err := c.do(ctx, c.BaseURL, query, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// do issues a single request to endpoint, within the rate limit and with the
+// API keys of the client, and decodes the response into v.
+func (c *Client) do(ctx context.Context, endpoint string, query url.Values, v any) error {
+	if c.Limiter != nil {
+		start := time.Now()
+		if err := c.Limiter.Wait(ctx, c.RateLimit()); err != nil {
+			return err
+		}
+		ctx = context.WithValue(ctx, queuedKey{}, time.Since(start))
+	}
+	if c.Keys == nil {
+		err := c.fetch(ctx, endpoint, query, c.APIKey, v)
+		c.observe(err)
+		return err
+	}
+
+	// Fail over to the next key when NVD throttles or rejects one, until a
+	// key comes round again
+	var lastErr error
+	tried := make(map[string]bool)
+	for {
+		key := c.Keys.pick()
+		if tried[key] {
+			return lastErr
+		}
+		tried[key] = true
+
+		err := c.fetch(ctx, endpoint, query, key, v)
+		c.observe(err)
+		var rateLimitErr *RateLimitError
+		throttled := errors.As(err, &rateLimitErr)
+		rejected := errors.Is(err, ErrKeyRejected)
+		if key != "" {
+			var retryAfter time.Duration
+			if throttled {
+				retryAfter = rateLimitErr.RetryAfter
+			}
+			c.Keys.record(key, throttled, retryAfter, rejected)
+		}
+		if !throttled && !rejected {
+			return err
+		}
+		lastErr = err
+	}
+}
+
+type queuedKey struct{}
+
+// Queued returns how long the request whose context is ctx waited for the
+// limiter before being sent, for transports timing requests.
+func Queued(ctx context.Context) time.Duration {
+	queued, _ := ctx.Value(queuedKey{}).(time.Duration)
+	return queued
+}
+
+// observe passes the outcome of a request to the limiter, to adapt its pace.
+func (c *Client) observe(err error) {
+	if c.Limiter != nil {
+		c.Limiter.Observe(c.RateLimit(), err)
+	}
+}
+
+// fetch issues a request to endpoint authenticated with key, unless empty,
+// and decodes the response into v.
+func (c *Client) fetch(ctx context.Context, endpoint string, query url.Values, key string, v any) error {
+	apiURL := endpoint
+	if len(query) > 0 {
+		apiURL += "?" + encodeQuery(query)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, apiURL, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create NVD API request: %w", err)
+	}
+	req.Header.Set("Accept-Encoding", acceptEncoding)
+	if key != "" {
+		header := c.APIKeyHeader
+		if header == "" {
+			header = DefaultAPIKeyHeader
+		}
+		req.Header.Set(header, key)
+	}
+	var cached *cachedResponse
+	if c.Cache != nil {
+		cached = c.Cache.condition(req)
+	}
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed NVD API request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusServiceUnavailable {
+		return ErrServiceUnavailable
+	}
+	message := deniedMessage(resp)
+	if isThrottled(resp, message) {
+		return &RateLimitError{StatusCode: resp.StatusCode, RetryAfter: retryAfter(resp.Header, time.Now())}
+	}
+	if key != "" && isKeyRejected(message) {
+		return fmt.Errorf("%w: %w: %d %s", ErrStatus, ErrKeyRejected, resp.StatusCode, resp.Status)
+	}
+	if resp.StatusCode == http.StatusNotModified && cached != nil {
+		c.Cache.revalidated()
+		if err := json.Unmarshal(cached.body, v); err != nil {
+			return fmt.Errorf("%w: %w", ErrDecode, err)
+		}
+		return nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%w: %d %s", ErrStatus, resp.StatusCode, resp.Status)
+	}
+
+	reader, err := decodedBody(resp)
+	if err != nil {
+		return fmt.Errorf("%w: failed to decompress: %w", ErrDecode, err)
+	}
+	defer reader.Close()
+
+	if c.Cache == nil {
+		if err := json.NewDecoder(reader).Decode(v); err != nil {
+			return fmt.Errorf("%w: %w", ErrDecode, err)
+		}
+		return nil
+	}
+	body, err := io.ReadAll(reader)
+	if err != nil {
+		return fmt.Errorf("failed to read NVD API response: %w", err)
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("%w: %w", ErrDecode, err)
+	}
+	c.Cache.store(resp, body)
+	return nil
+}
+
+// FetchAll follows startIndex until every result of query, or limit results
+// when limit is positive, have been fetched and merges the pages. TotalResults
+// is kept from NVD, so callers can tell when the response is truncated.
+func (c *Client) FetchAll(ctx context.Context, query url.Values, limit int) (*schema.NvdAPIResponse, error) {
+	query = cloneQuery(query)
+	if limit > 0 && limit < MaxResultsPerPage {
+		query.Set("resultsPerPage", strconv.Itoa(limit))
+	}
+
+	merged, err := c.Fetch(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	for next := merged.StartIndex + len(merged.Vulnerabilities); next < merged.TotalResults; {
+		if limit > 0 && len(merged.Vulnerabilities) >= limit {
+			break
+		}
+		query.Set("startIndex", strconv.Itoa(next))
+		page, err := c.Fetch(ctx, query)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch NVD page at index %d: %w", next, err)
+		}
+		if len(page.Vulnerabilities) == 0 {
+			break
+		}
+		merged.Vulnerabilities = append(merged.Vulnerabilities, page.Vulnerabilities...)
+		next += len(page.Vulnerabilities)
+	}
+
+	if limit > 0 && len(merged.Vulnerabilities) > limit {
+		merged.Vulnerabilities = merged.Vulnerabilities[:limit]
+	}
+	merged.StartIndex = 0
+	merged.ResultsPerPage = len(merged.Vulnerabilities)
+	return merged, nil
+}
+
+// ByCPE returns the CVEs matching a CPE 2.3 name, up to limit when positive.
+func (c *Client) ByCPE(ctx context.Context, cpeName string, limit int) (*schema.NvdAPIResponse, error) {
+	return c.FetchAll(ctx, url.Values{"cpeName": {cpeName}}, limit)
+}
+
+// ParamIsVulnerable restricts a cpeName query to the CVEs whose
+// configurations mark the CPE itself vulnerable, leaving out the ones merely
+// referencing it, e.g. as the platform another vulnerable product runs on.
+const ParamIsVulnerable = "isVulnerable"
+
+// ByVulnerableCPE is ByCPE restricted to the CVEs for which cpeName is in the
+// vulnerable configuration.
+func (c *Client) ByVulnerableCPE(ctx context.Context, cpeName string, limit int) (*schema.NvdAPIResponse, error) {
+	return c.FetchAll(ctx, url.Values{"cpeName": {cpeName}, ParamIsVulnerable: {""}}, limit)
+}
+
+// ByCVE returns the record of a CVE.
+func (c *Client) ByCVE(ctx context.Context, cveID string) (*schema.NvdAPIResponse, error) {
+	return c.Fetch(ctx, url.Values{"cveId": {cveID}})
+}
+
+func cloneQuery(query url.Values) url.Values {
+	clone := make(url.Values, len(query))
+	for k, v := range query {
+		clone[k] = append([]string(nil), v...)
+	}
+	return clone
+}
+
+// maxRetryAfter caps the delay a throttled response may ask for, so that a
+// misconfigured gateway can't stall the scans waiting on NVD for hours.
+const maxRetryAfter = 5 * time.Minute
+
+// deniedMessage returns the explanation of a 401, 403 or 404 response, from
+// its message header, which NVD sets on invalid API keys, or else the start
+// of its body. It is empty for other responses and bare denials.
+func deniedMessage(resp *http.Response) string {
+	switch resp.StatusCode {
+	case http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound:
+	default:
+		return ""
+	}
+	if message := resp.Header.Get("message"); message != "" {
+		return message
+	}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	return strings.TrimSpace(string(body))
+}
+
+// isThrottled reports whether resp rejects the request for exceeding the rate
+// limit. NVD answers with a bare 403 rather than a 429 when throttling, told
+// apart from other denials by the rate limit headers or the lack of any
+// explanation.
+func isThrottled(resp *http.Response, message string) bool {
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests:
+		return true
+	case http.StatusForbidden:
+		return resp.Header.Get("Retry-After") != "" || resp.Header.Get("X-RateLimit-Remaining") == "0" ||
+			message == "" || strings.Contains(strings.ToLower(message), "rate limit")
+	}
+	return false
+}
+
+// isKeyRejected reports whether the message of a denied response says the API
+// key is invalid, e.g. "Invalid apiKey.". Other denials may be transient and
+// must not take the key out of the rotation for good.
+func isKeyRejected(message string) bool {
+	message = strings.ToLower(message)
+	return strings.Contains(message, "invalid") &&
+		(strings.Contains(message, "apikey") || strings.Contains(message, "api key"))
+}
+
+// retryAfter returns the delay requested by the Retry-After header, in
+// seconds or as an HTTP date, falling back to the X-RateLimit-Reset epoch,
+// capped to maxRetryAfter.
+func retryAfter(header http.Header, now time.Time) time.Duration {
+	var delay time.Duration
+	if v := header.Get("Retry-After"); v != "" {
+		if seconds, err := strconv.Atoi(v); err == nil {
+			delay = time.Duration(seconds) * time.Second
+		} else if at, err := http.ParseTime(v); err == nil {
+			delay = at.Sub(now)
+		}
+	}
+	if v := header.Get("X-RateLimit-Reset"); delay == 0 && v != "" {
+		if epoch, err := strconv.ParseInt(v, 10, 64); err == nil {
+			delay = time.Unix(epoch, 0).Sub(now)
+		}
+	}
+	return min(max(delay, 0), maxRetryAfter)
+}
+
+// encodeQuery encodes query like url.Values.Encode, except for parameters
+// without value such as hasKev, sent without "=" as NVD expects.
+func encodeQuery(query url.Values) string {
+	return emptyValue.ReplaceAllString(query.Encode(), "${1}${2}")
+}
+
+var emptyValue = regexp.MustCompile(`([^&=]+)=(&|$)`)
@@ -0,0 +1,296 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/kptm-tools/vulnerability-analysis/nvd/schema"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newPagedServer serves total CVEs for any query, paged like the CVE API,
+// and records the API key of every request.
+func newPagedServer(t *testing.T, total int, keys *[]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*keys = append(*keys, r.Header.Get(DefaultAPIKeyHeader))
+		q := r.URL.Query()
+		pageSize := MaxResultsPerPage
+		if n, err := strconv.Atoi(q.Get("resultsPerPage")); err == nil {
+			pageSize = n
+		}
+		startIndex, _ := strconv.Atoi(q.Get("startIndex"))
+		stop := min(startIndex+pageSize, total)
+
+		resp := schema.NvdAPIResponse{ResultsPerPage: stop - startIndex, StartIndex: startIndex, TotalResults: total}
+		for i := startIndex; i < stop; i++ {
+			resp.Vulnerabilities = append(resp.Vulnerabilities, schema.Vulnerability{Cve: schema.CveDetail{ID: fmt.Sprintf("CVE-2024-%d", i)}})
+		}
+		require.NoError(t, json.NewEncoder(w).Encode(resp))
+	}))
+}
+
+func TestClient_ByCPE(t *testing.T) {
+	t.Parallel()
+	var keys []string
+	server := newPagedServer(t, 4500, &keys)
+	defer server.Close()
+
+	c := New(server.URL, "secret")
+	resp, err := c.ByCPE(context.Background(), "cpe:2.3:o:linux:linux_kernel:-:*:*:*:*:*:*:*", 0)
+	require.NoError(t, err)
+	assert.Len(t, resp.Vulnerabilities, 4500)
+	assert.Equal(t, []string{"secret", "secret", "secret"}, keys)
+
+	keys = nil
+	resp, err = c.ByCPE(context.Background(), "cpe:2.3:o:linux:linux_kernel:-:*:*:*:*:*:*:*", 2500)
+	require.NoError(t, err)
+	assert.Len(t, resp.Vulnerabilities, 2500)
+	assert.Equal(t, 4500, resp.TotalResults)
+	assert.Len(t, keys, 2)
+}
+
+func TestClient_ByVulnerableCPE(t *testing.T) {
+	t.Parallel()
+	var rawQuery string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rawQuery = r.URL.RawQuery
+		json.NewEncoder(w).Encode(schema.NvdAPIResponse{})
+	}))
+	defer server.Close()
+
+	_, err := New(server.URL, "").ByVulnerableCPE(context.Background(), "cpe:2.3:a:openbsd:openssh:8.2p1:*:*:*:*:*:*:*", 0)
+	require.NoError(t, err)
+	assert.Contains(t, rawQuery, "cpeName=cpe%3A2.3%3Aa%3Aopenbsd%3Aopenssh%3A8.2p1")
+	assert.Contains(t, rawQuery, "isVulnerable")
+	assert.NotContains(t, rawQuery, "isVulnerable=", "Expected isVulnerable without a value")
+}
+
+func TestClient_Fetch_Errors(t *testing.T) {
+	t.Parallel()
+	status := http.StatusServiceUnavailable
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		if status == http.StatusForbidden {
+			w.Write([]byte("Request blocked by the web application firewall"))
+		}
+	}))
+	defer server.Close()
+
+	c := New(server.URL, "")
+	_, err := c.ByCVE(context.Background(), "CVE-2024-0001")
+	assert.ErrorIs(t, err, ErrServiceUnavailable)
+
+	status = http.StatusForbidden
+	_, err = c.ByCVE(context.Background(), "CVE-2024-0001")
+	assert.ErrorIs(t, err, ErrStatus)
+	assert.NotErrorIs(t, err, ErrRateLimited)
+
+	status = http.StatusOK
+	_, err = c.ByCVE(context.Background(), "CVE-2024-0001")
+	assert.ErrorIs(t, err, ErrDecode)
+}
+
+func TestClient_Fetch_Throttled(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name       string
+		status     int
+		headers    map[string]string
+		retryAfter time.Duration
+	}{
+		{name: "429 with seconds", status: http.StatusTooManyRequests, headers: map[string]string{"Retry-After": "12"}, retryAfter: 12 * time.Second},
+		{name: "429 without delay", status: http.StatusTooManyRequests},
+		{name: "403 with remaining quota exhausted", status: http.StatusForbidden, headers: map[string]string{"X-RateLimit-Remaining": "0"}},
+		{name: "403 with Retry-After", status: http.StatusForbidden, headers: map[string]string{"Retry-After": "30"}, retryAfter: 30 * time.Second},
+		{name: "bare 403", status: http.StatusForbidden},
+		{name: "Retry-After capped", status: http.StatusTooManyRequests, headers: map[string]string{"Retry-After": "86400"}, retryAfter: maxRetryAfter},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				for k, v := range tt.headers {
+					w.Header().Set(k, v)
+				}
+				w.WriteHeader(tt.status)
+			}))
+			defer server.Close()
+
+			_, err := New(server.URL, "").ByCVE(context.Background(), "CVE-2024-0001")
+			assert.ErrorIs(t, err, ErrRateLimited)
+			var rateLimitErr *RateLimitError
+			require.ErrorAs(t, err, &rateLimitErr)
+			assert.Equal(t, tt.status, rateLimitErr.StatusCode)
+			assert.Equal(t, tt.retryAfter, rateLimitErr.RetryAfter)
+		})
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	t.Parallel()
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	header := http.Header{}
+	header.Set("Retry-After", now.Add(90*time.Second).Format(http.TimeFormat))
+	assert.Equal(t, 90*time.Second, retryAfter(header, now))
+
+	header = http.Header{}
+	header.Set("X-RateLimit-Reset", strconv.FormatInt(now.Add(20*time.Second).Unix(), 10))
+	assert.Equal(t, 20*time.Second, retryAfter(header, now))
+
+	header = http.Header{}
+	header.Set("Retry-After", "soon")
+	assert.Zero(t, retryAfter(header, now))
+}
+
+func TestClient_Fetch_Limiter(t *testing.T) {
+	t.Parallel()
+	var keys []string
+	server := newPagedServer(t, 1, &keys)
+	defer server.Close()
+
+	c := New(server.URL, "")
+	c.Limiter = NewLimiter()
+	for i := 0; i < UnkeyedRateLimit.Requests; i++ {
+		_, err := c.ByCVE(context.Background(), "CVE-2024-0001")
+		require.NoError(t, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := c.ByCVE(ctx, "CVE-2024-0001")
+	assert.ErrorIs(t, err, context.Canceled, "Expected the request over the quota to wait")
+	assert.Len(t, keys, UnkeyedRateLimit.Requests)
+}
+
+// roundTripFunc is an http.RoundTripper calling itself.
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestClient_Fetch_Queued(t *testing.T) {
+	t.Parallel()
+	var keys []string
+	server := newPagedServer(t, 1, &keys)
+	defer server.Close()
+
+	var queued []bool
+	c := New(server.URL, "")
+	c.HTTPClient.Transport = roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		_, ok := req.Context().Value(queuedKey{}).(time.Duration)
+		queued = append(queued, ok)
+		return http.DefaultTransport.RoundTrip(req)
+	})
+	_, err := c.ByCVE(context.Background(), "CVE-2024-0001")
+	require.NoError(t, err)
+	c.Limiter = NewLimiter()
+	_, err = c.ByCVE(context.Background(), "CVE-2024-0001")
+	require.NoError(t, err)
+	assert.Equal(t, []bool{false, true}, queued, "Expected the wait of limited requests to be passed to the transport")
+	assert.Zero(t, Queued(context.Background()))
+}
+
+func TestClient_Fetch_AdaptiveLimiter(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name    string
+		headers map[string]string
+	}{
+		{name: "403 with remaining quota exhausted", headers: map[string]string{"X-RateLimit-Remaining": "0"}},
+		{name: "bare 403"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				for k, v := range tt.headers {
+					w.Header().Set(k, v)
+				}
+				w.WriteHeader(http.StatusForbidden)
+			}))
+			defer server.Close()
+
+			c := New(server.URL, "key")
+			c.Limiter = NewAdaptiveLimiter()
+			_, err := c.ByCVE(context.Background(), "CVE-2024-0001")
+			assert.ErrorIs(t, err, ErrRateLimited)
+			assert.NotErrorIs(t, err, ErrKeyRejected)
+			assert.Equal(t, KeyedRateLimit.Interval(), c.Limiter.Spacing(), "Expected the throttled response to widen the spacing")
+		})
+	}
+}
+
+func TestVersionRange_Query(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name        string
+		matchString string
+		r           VersionRange
+		want        string
+		wantErr     bool
+	}{
+		{
+			name:        "default bound types",
+			matchString: "cpe:2.3:a:openbsd:openssh",
+			r:           VersionRange{Start: "8.0", End: "8.4"},
+			want:        "versionEnd=8.4&versionEndType=excluding&versionStart=8.0&versionStartType=including&virtualMatchString=cpe%3A2.3%3Aa%3Aopenbsd%3Aopenssh",
+		},
+		{
+			name:        "inclusive end only",
+			matchString: "cpe:2.3:a:openbsd:openssh:*:*:*:*:*:*:*:*",
+			r:           VersionRange{End: "8.4", EndType: VersionIncluding},
+			want:        "versionEnd=8.4&versionEndType=including&virtualMatchString=cpe%3A2.3%3Aa%3Aopenbsd%3Aopenssh%3A%2A%3A%2A%3A%2A%3A%2A%3A%2A%3A%2A%3A%2A%3A%2A",
+		},
+		{
+			name:        "match string only",
+			matchString: "cpe:2.3:a:openbsd",
+			want:        "virtualMatchString=cpe%3A2.3%3Aa%3Aopenbsd",
+		},
+		{name: "CPE 2.2 URI", matchString: "cpe:/a:openbsd:openssh", r: VersionRange{Start: "8.0"}, wantErr: true},
+		{name: "range without product", matchString: "cpe:2.3:a:openbsd:*", r: VersionRange{Start: "8.0"}, wantErr: true},
+		{name: "type without version", matchString: "cpe:2.3:a:openbsd:openssh", r: VersionRange{StartType: VersionIncluding}, wantErr: true},
+		{name: "unknown type", matchString: "cpe:2.3:a:openbsd:openssh", r: VersionRange{End: "8.4", EndType: "before"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			query, err := tt.r.Query(tt.matchString)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrInvalidVersionRange)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, query.Encode())
+		})
+	}
+}
+
+func TestClient_ByVersionRange(t *testing.T) {
+	t.Parallel()
+	var query url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.Query()
+		require.NoError(t, json.NewEncoder(w).Encode(schema.NvdAPIResponse{}))
+	}))
+	defer server.Close()
+
+	_, err := New(server.URL, "").ByVersionRange(context.Background(), "cpe:2.3:a:openbsd:openssh", VersionRange{Start: "8.0", End: "8.4"}, 0)
+	require.NoError(t, err)
+	assert.Equal(t, "cpe:2.3:a:openbsd:openssh", query.Get("virtualMatchString"))
+	assert.Equal(t, "8.0", query.Get("versionStart"))
+	assert.Equal(t, "8.4", query.Get("versionEnd"))
+	assert.Empty(t, query.Get("cpeName"))
+}
@@ -0,0 +1,110 @@
+package client
+
+import (
+	"container/list"
+	"net/http"
+	"sync"
+)
+
+// ResponseCache keeps the bodies of the responses NVD sent with an ETag or
+// a Last-Modified header, so that requests for the same URL are sent as
+// conditional requests and answered from the cache on a 304. The least
+// recently used responses are evicted past the maximum number of entries.
+// It is safe for concurrent use.
+type ResponseCache struct {
+	mu         sync.Mutex
+	maxEntries int
+	entries    map[string]*list.Element
+	lru        *list.List
+	stats      ResponseCacheStats
+}
+
+// ResponseCacheStats counts the responses stored in a ResponseCache and the
+// requests it answered.
+type ResponseCacheStats struct {
+	Entries     int `json:"entries"`
+	Stored      int `json:"stored"`
+	Revalidated int `json:"revalidated"`
+	Evicted     int `json:"evicted"`
+}
+
+type cachedResponse struct {
+	url          string
+	etag         string
+	lastModified string
+	body         []byte
+}
+
+// NewResponseCache returns a cache of at most maxEntries responses, or of
+// every response when maxEntries isn't positive.
+func NewResponseCache(maxEntries int) *ResponseCache {
+	return &ResponseCache{
+		maxEntries: maxEntries,
+		entries:    make(map[string]*list.Element),
+		lru:        list.New(),
+	}
+}
+
+// Stats returns the counters of the cache.
+func (c *ResponseCache) Stats() ResponseCacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := c.stats
+	stats.Entries = c.lru.Len()
+	return stats
+}
+
+// condition adds the validators of the cached response for the URL of req,
+// if any, and returns that response.
+func (c *ResponseCache) condition(req *http.Request) *cachedResponse {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[req.URL.String()]
+	if !ok {
+		return nil
+	}
+	c.lru.MoveToFront(elem)
+	cached := elem.Value.(*cachedResponse)
+	if cached.etag != "" {
+		req.Header.Set("If-None-Match", cached.etag)
+	}
+	if cached.lastModified != "" {
+		req.Header.Set("If-Modified-Since", cached.lastModified)
+	}
+	return cached
+}
+
+// revalidated records a 304 answered with cached.
+func (c *ResponseCache) revalidated() {
+	c.mu.Lock()
+	c.stats.Revalidated++
+	c.mu.Unlock()
+}
+
+// store caches the body of resp when it carries a validator.
+func (c *ResponseCache) store(resp *http.Response, body []byte) {
+	etag, lastModified := resp.Header.Get("ETag"), resp.Header.Get("Last-Modified")
+	if etag == "" && lastModified == "" {
+		return
+	}
+	cached := &cachedResponse{url: resp.Request.URL.String(), etag: etag, lastModified: lastModified, body: body}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.stats.Stored++
+	if elem, ok := c.entries[cached.url]; ok {
+		elem.Value = cached
+		c.lru.MoveToFront(elem)
+		return
+	}
+	c.entries[cached.url] = c.lru.PushFront(cached)
+	for c.maxEntries > 0 && c.lru.Len() > c.maxEntries {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cachedResponse).url)
+		c.stats.Evicted++
+	}
+}
@@ -0,0 +1,64 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/kptm-tools/vulnerability-analysis/nvd/schema"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClient_ConditionalRequests(t *testing.T) {
+	t.Parallel()
+	var conditional []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conditional = append(conditional, r.Header.Get("If-None-Match")+"|"+r.Header.Get("If-Modified-Since"))
+		// Only CVE-2021-44228 is served with validators
+		if r.URL.Query().Get("cveId") == "CVE-2021-44228" {
+			if r.Header.Get("If-None-Match") == `"v1"` {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			w.Header().Set("ETag", `"v1"`)
+			w.Header().Set("Last-Modified", "Mon, 01 Jan 2024 00:00:00 GMT")
+		}
+		resp := schema.NvdAPIResponse{TotalResults: 1, Vulnerabilities: []schema.Vulnerability{{Cve: schema.CveDetail{ID: r.URL.Query().Get("cveId")}}}}
+		require.NoError(t, json.NewEncoder(w).Encode(resp))
+	}))
+	defer server.Close()
+
+	c := New(server.URL, "")
+	c.Cache = NewResponseCache(1)
+	for range 2 {
+		resp, err := c.ByCVE(context.Background(), "CVE-2021-44228")
+		require.NoError(t, err)
+		require.Len(t, resp.Vulnerabilities, 1)
+		assert.Equal(t, "CVE-2021-44228", resp.Vulnerabilities[0].Cve.ID)
+	}
+	assert.Equal(t, []string{"|", `"v1"|Mon, 01 Jan 2024 00:00:00 GMT`}, conditional)
+	assert.Equal(t, ResponseCacheStats{Entries: 1, Stored: 1, Revalidated: 1}, c.Cache.Stats())
+
+	// Responses without validators aren't cached
+	_, err := c.ByCVE(context.Background(), "CVE-2021-45046")
+	require.NoError(t, err)
+	assert.Equal(t, 1, c.Cache.Stats().Entries)
+}
+
+func TestResponseCache_Evicts(t *testing.T) {
+	t.Parallel()
+	cache := NewResponseCache(2)
+	for _, u := range []string{"http://nvd/a", "http://nvd/b", "http://nvd/a", "http://nvd/c"} {
+		req := httptest.NewRequest(http.MethodGet, u, nil)
+		cache.store(&http.Response{Request: req, Header: http.Header{"Etag": {`"x"`}}}, []byte("{}"))
+	}
+	assert.Nil(t, cache.condition(httptest.NewRequest(http.MethodGet, "http://nvd/b", nil)), "Expected the least recently used response to be evicted")
+
+	req := httptest.NewRequest(http.MethodGet, "http://nvd/a", nil)
+	assert.NotNil(t, cache.condition(req))
+	assert.Equal(t, `"x"`, req.Header.Get("If-None-Match"))
+	assert.Equal(t, ResponseCacheStats{Entries: 2, Stored: 4, Evicted: 1}, cache.Stats())
+}
@@ -0,0 +1,142 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/kptm-tools/vulnerability-analysis/nvd/schema"
+)
+
+var ErrInvalidDateRange = errors.New("invalid NVD date range")
+
+// MaxDateRange is the longest date range the CVE API accepts in a query.
+const MaxDateRange = 120 * 24 * time.Hour
+
+// DateFormat is the ISO-8601 format of the date parameters.
+const DateFormat = "2006-01-02T15:04:05.000Z"
+
+// Dates of a CVE a DateRange applies to, the prefixes of the pubStartDate
+// and lastModStartDate parameters, and of the changeStartDate parameter of
+// the CVE Change History API.
+const (
+	DatePublished = "pub"
+	DateModified  = "lastMod"
+	DateChanged   = "change"
+)
+
+// DateRange restricts a query to the CVEs published, or last modified,
+// between Start and End inclusive, e.g. since the previous run of a delta
+// job. Date defaults to DatePublished.
+type DateRange struct {
+	Date  string
+	Start time.Time
+	End   time.Time
+}
+
+// Published returns the range of the CVEs published between start and end.
+func Published(start, end time.Time) DateRange {
+	return DateRange{Date: DatePublished, Start: start, End: end}
+}
+
+// Modified returns the range of the CVEs last modified between start and end.
+func Modified(start, end time.Time) DateRange {
+	return DateRange{Date: DateModified, Start: start, End: end}
+}
+
+// Changed returns the range of the CVE changes made between start and end,
+// for the CVE Change History API.
+func Changed(start, end time.Time) DateRange {
+	return DateRange{Date: DateChanged, Start: start, End: end}
+}
+
+func (r DateRange) validate() error {
+	if r.Date != "" && r.Date != DatePublished && r.Date != DateModified && r.Date != DateChanged {
+		return fmt.Errorf("%w: unknown date %q, expected %q, %q or %q", ErrInvalidDateRange, r.Date, DatePublished, DateModified, DateChanged)
+	}
+	if !r.End.After(r.Start) {
+		return fmt.Errorf("%w: %s is not after %s", ErrInvalidDateRange, r.End, r.Start)
+	}
+	return nil
+}
+
+// Apply returns a copy of query restricted to the range, which must not be
+// longer than MaxDateRange. Use Windows to split longer ranges.
+func (r DateRange) Apply(query url.Values) (url.Values, error) {
+	if err := r.validate(); err != nil {
+		return nil, err
+	}
+	if r.End.Sub(r.Start) > MaxDateRange {
+		return nil, fmt.Errorf("%w: %s is longer than the %s NVD accepts", ErrInvalidDateRange, r.End.Sub(r.Start), MaxDateRange)
+	}
+	date := r.Date
+	if date == "" {
+		date = DatePublished
+	}
+
+	query = cloneQuery(query)
+	query.Set(date+"StartDate", r.Start.UTC().Format(DateFormat))
+	query.Set(date+"EndDate", r.End.UTC().Format(DateFormat))
+	return query, nil
+}
+
+// Windows splits the range in consecutive ranges no longer than size, or
+// MaxDateRange when size is zero or longer.
+func (r DateRange) Windows(size time.Duration) []DateRange {
+	if size <= 0 || size > MaxDateRange {
+		size = MaxDateRange
+	}
+	var windows []DateRange
+	for from := r.Start; from.Before(r.End); from = from.Add(size) {
+		window := r
+		window.Start, window.End = from, from.Add(size)
+		if window.End.After(r.End) {
+			window.End = r.End
+		}
+		windows = append(windows, window)
+	}
+	return windows
+}
+
+// FetchAllInRange fetches every result of query within r, up to limit when
+// positive, querying a window of MaxDateRange at a time. CVEs on the bound of
+// two windows are only kept once.
+func (c *Client) FetchAllInRange(ctx context.Context, query url.Values, r DateRange, limit int) (*schema.NvdAPIResponse, error) {
+	if err := r.validate(); err != nil {
+		return nil, err
+	}
+
+	merged := &schema.NvdAPIResponse{}
+	for _, window := range r.Windows(MaxDateRange) {
+		remaining := 0
+		if limit > 0 {
+			if remaining = limit - len(merged.Vulnerabilities); remaining <= 0 {
+				break
+			}
+		}
+		windowQuery, err := window.Apply(query)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := c.FetchAll(ctx, windowQuery, remaining)
+		if err != nil {
+			return nil, err
+		}
+		MergeResponse(merged, resp)
+	}
+	return merged, nil
+}
+
+// ByPublished returns the CVEs published between start and end, up to limit
+// when positive.
+func (c *Client) ByPublished(ctx context.Context, start, end time.Time, limit int) (*schema.NvdAPIResponse, error) {
+	return c.FetchAllInRange(ctx, nil, Published(start, end), limit)
+}
+
+// ByModified returns the CVEs last modified between start and end, up to
+// limit when positive.
+func (c *Client) ByModified(ctx context.Context, start, end time.Time, limit int) (*schema.NvdAPIResponse, error) {
+	return c.FetchAllInRange(ctx, nil, Modified(start, end), limit)
+}
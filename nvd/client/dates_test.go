@@ -0,0 +1,92 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kptm-tools/vulnerability-analysis/nvd/schema"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDateRange_Apply(t *testing.T) {
+	t.Parallel()
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.FixedZone("CEST", 2*60*60))
+	query, err := Modified(start, start.Add(24*time.Hour)).Apply(url.Values{"cpeName": {"cpe:2.3:a:openbsd:openssh:8.2:p1:*:*:*:*:*:*"}})
+	require.NoError(t, err)
+	assert.Equal(t, "2024-05-01T10:00:00.000Z", query.Get("lastModStartDate"))
+	assert.Equal(t, "2024-05-02T10:00:00.000Z", query.Get("lastModEndDate"))
+	assert.NotEmpty(t, query.Get("cpeName"), "Expected the range to narrow the query")
+
+	query, err = DateRange{Start: start, End: start.Add(time.Hour)}.Apply(nil)
+	require.NoError(t, err)
+	assert.NotEmpty(t, query.Get("pubStartDate"), "Expected the publication date by default")
+
+	for _, invalid := range []DateRange{
+		Published(start, start),
+		Published(start, start.Add(MaxDateRange+time.Hour)),
+		{Date: "created", Start: start, End: start.Add(time.Hour)},
+	} {
+		_, err := invalid.Apply(nil)
+		assert.ErrorIs(t, err, ErrInvalidDateRange, "%+v", invalid)
+	}
+}
+
+func TestDateRange_Windows(t *testing.T) {
+	t.Parallel()
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	windows := Published(start, start.Add(250*24*time.Hour)).Windows(0)
+	require.Len(t, windows, 3)
+	assert.Equal(t, start, windows[0].Start)
+	assert.Equal(t, windows[0].End, windows[1].Start)
+	assert.Equal(t, start.Add(250*24*time.Hour), windows[2].End)
+	assert.Equal(t, DatePublished, windows[2].Date)
+}
+
+func TestClient_FetchAllInRange(t *testing.T) {
+	t.Parallel()
+	var mu sync.Mutex
+	var windows int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		start, err := time.Parse(DateFormat, q.Get("pubStartDate"))
+		require.NoError(t, err)
+		end, err := time.Parse(DateFormat, q.Get("pubEndDate"))
+		require.NoError(t, err)
+		assert.LessOrEqual(t, end.Sub(start), MaxDateRange)
+		mu.Lock()
+		windows++
+		mu.Unlock()
+
+		// CVE-2024-0001 is published on the bound of the windows
+		resp := schema.NvdAPIResponse{TotalResults: 2, ResultsPerPage: 2, Vulnerabilities: []schema.Vulnerability{
+			{Cve: schema.CveDetail{ID: "CVE-2024-0001"}},
+			{Cve: schema.CveDetail{ID: "CVE-" + start.Format("2006-0102")}},
+		}}
+		require.NoError(t, json.NewEncoder(w).Encode(resp))
+	}))
+	defer server.Close()
+
+	c := New(server.URL, "")
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	resp, err := c.ByPublished(context.Background(), start, start.Add(200*24*time.Hour), 0)
+	require.NoError(t, err)
+	assert.Equal(t, 2, windows)
+	assert.Len(t, resp.Vulnerabilities, 3)
+	assert.Equal(t, 3, resp.TotalResults)
+
+	windows = 0
+	resp, err = c.ByPublished(context.Background(), start, start.Add(200*24*time.Hour), 2)
+	require.NoError(t, err)
+	assert.Equal(t, 1, windows, "Expected the limit to skip the remaining windows")
+	assert.Len(t, resp.Vulnerabilities, 2)
+
+	_, err = c.ByModified(context.Background(), start, start, 0)
+	assert.ErrorIs(t, err, ErrInvalidDateRange)
+}
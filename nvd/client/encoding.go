@@ -0,0 +1,62 @@
+package client
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// acceptEncoding is sent with every request. Setting it ourselves disables
+// the transparent decompression of net/http, which only handles gzip and
+// trusts Content-Encoding.
+const acceptEncoding = "gzip, deflate"
+
+// decodedBody returns the body of resp decompressed. Gateways in front of
+// NVD don't always set Content-Encoding right, so gzip bodies are detected
+// by their magic number and bodies announced as compressed but sent plain
+// are read as is. Deflate bodies are zlib streams, or raw deflate from
+// servers getting the specification wrong.
+func decodedBody(resp *http.Response) (io.ReadCloser, error) {
+	br := bufio.NewReader(resp.Body)
+	magic, _ := br.Peek(2)
+	encoding := strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding")))
+
+	switch {
+	case isGzip(magic):
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		return zr, nil
+	case encoding == "deflate" && isZlib(magic):
+		return zlib.NewReader(br)
+	case encoding == "deflate" && !isJSONStart(magic):
+		return flate.NewReader(br), nil
+	default:
+		return io.NopCloser(br), nil
+	}
+}
+
+func isGzip(magic []byte) bool {
+	return len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b
+}
+
+// isZlib checks the compression method and header checksum of a zlib stream.
+func isZlib(magic []byte) bool {
+	return len(magic) == 2 && magic[0]&0x0f == 8 && (uint16(magic[0])<<8|uint16(magic[1]))%31 == 0
+}
+
+func isJSONStart(magic []byte) bool {
+	if len(magic) == 0 {
+		return true
+	}
+	switch magic[0] {
+	case '{', '[', ' ', '\t', '\r', '\n':
+		return true
+	}
+	return false
+}
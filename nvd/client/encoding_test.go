@@ -0,0 +1,71 @@
+package client
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/kptm-tools/vulnerability-analysis/nvd/schema"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func compress(t *testing.T, data []byte, newWriter func(io.Writer) io.WriteCloser) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := newWriter(&buf)
+	_, err := w.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	return buf.Bytes()
+}
+
+func TestClient_Compression(t *testing.T) {
+	t.Parallel()
+	data, err := json.Marshal(schema.NvdAPIResponse{TotalResults: 1, Vulnerabilities: []schema.Vulnerability{{Cve: schema.CveDetail{ID: "CVE-2021-44228"}}}})
+	require.NoError(t, err)
+	gzipped := compress(t, data, func(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) })
+	zlibbed := compress(t, data, func(w io.Writer) io.WriteCloser { return zlib.NewWriter(w) })
+	deflated := compress(t, data, func(w io.Writer) io.WriteCloser {
+		fw, _ := flate.NewWriter(w, flate.DefaultCompression)
+		return fw
+	})
+
+	tests := []struct {
+		name     string
+		encoding string
+		body     []byte
+	}{
+		{name: "gzip", encoding: "gzip", body: gzipped},
+		{name: "gzip without Content-Encoding", body: gzipped},
+		{name: "plain announced as gzip", encoding: "gzip", body: data},
+		{name: "zlib deflate", encoding: "deflate", body: zlibbed},
+		{name: "raw deflate", encoding: "deflate", body: deflated},
+		{name: "plain", body: data},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, acceptEncoding, r.Header.Get("Accept-Encoding"))
+				if tt.encoding != "" {
+					w.Header().Set("Content-Encoding", tt.encoding)
+				}
+				_, _ = w.Write(tt.body)
+			}))
+			defer server.Close()
+
+			resp, err := New(server.URL, "").ByCVE(context.Background(), "CVE-2021-44228")
+			require.NoError(t, err)
+			require.Len(t, resp.Vulnerabilities, 1)
+			assert.Equal(t, "CVE-2021-44228", resp.Vulnerabilities[0].Cve.ID)
+		})
+	}
+}
@@ -0,0 +1,353 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/kptm-tools/vulnerability-analysis/nvd/schema"
+)
+
+var ErrInvalidFilter = errors.New("invalid NVD CVSS filter")
+
+// Boolean parameters of the CVE API, restricting queries to the CVEs of the
+// CISA Known Exploited Vulnerabilities catalog, with US-CERT technical alerts
+// or vulnerability notes, or with OVAL definitions, or leaving out the CVEs
+// rejected by their CNA.
+const (
+	FlagKEV        = "hasKev"
+	FlagCertAlerts = "hasCertAlerts"
+	FlagCertNotes  = "hasCertNotes"
+	FlagOVAL       = "hasOval"
+	FlagNoRejected = "noRejected"
+)
+
+var flags = []string{FlagKEV, FlagCertAlerts, FlagCertNotes, FlagOVAL, FlagNoRejected}
+
+// StatusRejected is the vulnStatus of the CVEs rejected by their CNA, e.g. as
+// duplicates, which NVD keeps with a "** REJECT **" description.
+const StatusRejected = "Rejected"
+
+// Filter restricts queries to the CVEs of some CVSS v3 or v4 severities, or
+// matching a partial CVSS v3 vector such as AV:N/AC:L, so that callers only
+// interested in the most severe CVEs of large products don't page through
+// thousands of low ones. NVD accepts a single severity per request, a filter
+// on several severities is sent as one query per severity. Flags adds the
+// boolean parameters, e.g. FlagKEV for known exploited CVEs only, and CWEID
+// restricts queries to the CVEs of a weakness, e.g. CWE-89.
+type Filter struct {
+	CVSSV3Severities []string
+	CVSSV4Severities []string
+	CVSSV3Metrics    string
+	Flags            []string
+	CWEID            string
+}
+
+// IsZero reports whether the filter keeps every CVE.
+func (f Filter) IsZero() bool {
+	return len(f.CVSSV3Severities) == 0 && len(f.CVSSV4Severities) == 0 && f.CVSSV3Metrics == "" && len(f.Flags) == 0 && f.CWEID == ""
+}
+
+// Normalize validates the filter and returns it with uppercase, distinct
+// severities. NVD rejects queries mixing the CVSS v3 and v4 parameters.
+func (f Filter) Normalize() (Filter, error) {
+	var err error
+	if f.CVSSV3Severities, err = normalizeSeverities(f.CVSSV3Severities); err != nil {
+		return Filter{}, err
+	}
+	if f.CVSSV4Severities, err = normalizeSeverities(f.CVSSV4Severities); err != nil {
+		return Filter{}, err
+	}
+	if len(f.CVSSV4Severities) > 0 && (len(f.CVSSV3Severities) > 0 || f.CVSSV3Metrics != "") {
+		return Filter{}, fmt.Errorf("%w: CVSS v4 severities can't be combined with CVSS v3 parameters", ErrInvalidFilter)
+	}
+
+	f.CVSSV3Metrics = strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(f.CVSSV3Metrics)), "CVSS:3.1/")
+	if f.CVSSV3Metrics != "" {
+		for _, metric := range strings.Split(f.CVSSV3Metrics, "/") {
+			if name, value, ok := strings.Cut(metric, ":"); !ok || name == "" || value == "" {
+				return Filter{}, fmt.Errorf("%w: %q is not a CVSS v3 metric", ErrInvalidFilter, metric)
+			}
+		}
+	}
+
+	if f.Flags, err = normalizeFlags(f.Flags); err != nil {
+		return Filter{}, err
+	}
+	if f.CWEID, err = NormalizeCWEID(f.CWEID); err != nil {
+		return Filter{}, err
+	}
+	return f, nil
+}
+
+var cweIDPattern = regexp.MustCompile(`^CWE-\d+$`)
+
+// NormalizeCWEID returns the CWE ID the cweId parameter expects, e.g. CWE-89
+// for "89" or "cwe-89", or NVD-CWE-Other and NVD-CWE-noinfo, the IDs NVD
+// assigns to CVEs of no or unknown CWE. An empty ID stays empty.
+func NormalizeCWEID(id string) (string, error) {
+	id = strings.TrimSpace(id)
+	switch {
+	case id == "":
+		return "", nil
+	case strings.EqualFold(id, "NVD-CWE-Other"):
+		return "NVD-CWE-Other", nil
+	case strings.EqualFold(id, "NVD-CWE-noinfo"):
+		return "NVD-CWE-noinfo", nil
+	}
+	id = strings.ToUpper(id)
+	if !strings.HasPrefix(id, "CWE-") {
+		id = "CWE-" + id
+	}
+	if !cweIDPattern.MatchString(id) {
+		return "", fmt.Errorf("%w: %q is not a CWE ID", ErrInvalidFilter, id)
+	}
+	return id, nil
+}
+
+// normalizeFlags matches flags case insensitively, so that "haskev" sends
+// hasKev.
+func normalizeFlags(names []string) ([]string, error) {
+	var normalized []string
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		i := slices.IndexFunc(flags, func(flag string) bool { return strings.EqualFold(flag, name) })
+		if i < 0 {
+			return nil, fmt.Errorf("%w: unknown flag %q, expected %s", ErrInvalidFilter, name, strings.Join(flags, ", "))
+		}
+		if !slices.Contains(normalized, flags[i]) {
+			normalized = append(normalized, flags[i])
+		}
+	}
+	return normalized, nil
+}
+
+func normalizeSeverities(severities []string) ([]string, error) {
+	var normalized []string
+	for _, severity := range severities {
+		severity = strings.ToUpper(strings.TrimSpace(severity))
+		switch schema.SeverityType(severity) {
+		case "":
+			continue
+		case schema.SeverityTypeLow, schema.SeverityTypeMedium, schema.SeverityTypeHigh, schema.SeverityTypeCritical:
+		default:
+			return nil, fmt.Errorf("%w: unknown severity %q, expected LOW, MEDIUM, HIGH or CRITICAL", ErrInvalidFilter, severity)
+		}
+		if !slices.Contains(normalized, severity) {
+			normalized = append(normalized, severity)
+		}
+	}
+	return normalized, nil
+}
+
+// Split returns one filter per severity, each matching a single CVE API
+// query. The filter must have been normalized.
+func (f Filter) Split() []Filter {
+	switch {
+	case len(f.CVSSV3Severities) > 1:
+		filters := make([]Filter, 0, len(f.CVSSV3Severities))
+		for _, severity := range f.CVSSV3Severities {
+			sub := f
+			sub.CVSSV3Severities = []string{severity}
+			filters = append(filters, sub)
+		}
+		return filters
+	case len(f.CVSSV4Severities) > 1:
+		filters := make([]Filter, 0, len(f.CVSSV4Severities))
+		for _, severity := range f.CVSSV4Severities {
+			sub := f
+			sub.CVSSV4Severities = []string{severity}
+			filters = append(filters, sub)
+		}
+		return filters
+	default:
+		return []Filter{f}
+	}
+}
+
+// Apply returns a copy of query with the parameters of a filter returned by
+// Split.
+func (f Filter) Apply(query url.Values) url.Values {
+	query = cloneQuery(query)
+	if len(f.CVSSV3Severities) > 0 {
+		query.Set("cvssV3Severity", f.CVSSV3Severities[0])
+	}
+	if len(f.CVSSV4Severities) > 0 {
+		query.Set("cvssV4Severity", f.CVSSV4Severities[0])
+	}
+	if f.CVSSV3Metrics != "" {
+		query.Set("cvssV3Metrics", f.CVSSV3Metrics)
+	}
+	for _, flag := range f.Flags {
+		query.Set(flag, "")
+	}
+	if f.CWEID != "" {
+		query.Set("cweId", f.CWEID)
+	}
+	return query
+}
+
+// Remote returns the part of the filter Matches can't check, the flags of
+// CERT alerts, notes and OVAL definitions, for queries whose responses are
+// filtered with Matches afterwards, e.g. merged into stored CVEs which a
+// rescoring or rejection moves out of the filter.
+func (f Filter) Remote() Filter {
+	var remote Filter
+	for _, flag := range f.Flags {
+		if flag == FlagCertAlerts || flag == FlagCertNotes || flag == FlagOVAL {
+			remote.Flags = append(remote.Flags, flag)
+		}
+	}
+	return remote
+}
+
+// Matches reports whether the filter keeps vuln, for responses that didn't
+// come from a filtered query, e.g. of an offline source. Records don't tell
+// whether CERT alerts, notes or OVAL definitions exist, only FlagKEV, from
+// the CISA fields, and FlagNoRejected are checked.
+func (f Filter) Matches(vuln schema.Vulnerability) bool {
+	if f.IsZero() {
+		return true
+	}
+	if slices.Contains(f.Flags, FlagKEV) && vuln.Cve.CisaExploitAdd == nil {
+		return false
+	}
+	if slices.Contains(f.Flags, FlagNoRejected) && vuln.Cve.VulnStatus == StatusRejected {
+		return false
+	}
+	if f.CWEID != "" && !hasWeakness(vuln, f.CWEID) {
+		return false
+	}
+	if len(f.CVSSV3Severities) == 0 && len(f.CVSSV4Severities) == 0 && f.CVSSV3Metrics == "" {
+		return true
+	}
+	metrics := vuln.Cve.Metrics
+	if metrics == nil {
+		return false
+	}
+
+	var v3Severities, v3Vectors, v4Severities []string
+	for _, m := range metrics.CvssMetricV31 {
+		v3Severities = append(v3Severities, string(m.CvssData.BaseSeverity))
+		v3Vectors = append(v3Vectors, m.CvssData.VectorString)
+	}
+	for _, m := range metrics.CvssMetricV30 {
+		v3Severities = append(v3Severities, string(m.CvssData.BaseSeverity))
+		v3Vectors = append(v3Vectors, m.CvssData.VectorString)
+	}
+	for _, m := range metrics.CvssMetricV40 {
+		v4Severities = append(v4Severities, string(m.CvssData.BaseSeverity))
+	}
+
+	if len(f.CVSSV3Severities) > 0 && !containsAnyOf(v3Severities, f.CVSSV3Severities) {
+		return false
+	}
+	if len(f.CVSSV4Severities) > 0 && !containsAnyOf(v4Severities, f.CVSSV4Severities) {
+		return false
+	}
+	if f.CVSSV3Metrics != "" && !slices.ContainsFunc(v3Vectors, func(vector string) bool {
+		return vectorHasMetrics(vector, f.CVSSV3Metrics)
+	}) {
+		return false
+	}
+	return true
+}
+
+// hasWeakness reports whether any source assigned the CWE to vuln.
+func hasWeakness(vuln schema.Vulnerability, cweID string) bool {
+	for _, w := range vuln.Cve.Weaknesses {
+		for _, d := range w.Description {
+			if d.Value == cweID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func containsAnyOf(values, wanted []string) bool {
+	return slices.ContainsFunc(values, func(v string) bool { return slices.Contains(wanted, v) })
+}
+
+// vectorHasMetrics reports whether every metric of the partial vector is set
+// to the same value in vector.
+func vectorHasMetrics(vector, partial string) bool {
+	components := strings.Split(vector, "/")
+	for _, metric := range strings.Split(partial, "/") {
+		if !slices.Contains(components, metric) {
+			return false
+		}
+	}
+	return true
+}
+
+// FetchAllFiltered fetches every result of query kept by f, up to limit when
+// positive, merging the queries of each severity.
+func (c *Client) FetchAllFiltered(ctx context.Context, query url.Values, f Filter, limit int) (*schema.NvdAPIResponse, error) {
+	f, err := f.Normalize()
+	if err != nil {
+		return nil, err
+	}
+
+	merged := &schema.NvdAPIResponse{}
+	for _, sub := range f.Split() {
+		remaining := 0
+		if limit > 0 {
+			if remaining = limit - len(merged.Vulnerabilities); remaining <= 0 {
+				break
+			}
+		}
+		resp, err := c.FetchAll(ctx, sub.Apply(query), remaining)
+		if err != nil {
+			return nil, err
+		}
+		MergeResponse(merged, resp)
+	}
+	return merged, nil
+}
+
+// SuppressRejected removes the CVEs rejected by their CNA from resp, which
+// queries without FlagNoRejected and offline sources return, and reports how
+// many it removed.
+func SuppressRejected(resp *schema.NvdAPIResponse) int {
+	kept := make([]schema.Vulnerability, 0, len(resp.Vulnerabilities))
+	for _, vuln := range resp.Vulnerabilities {
+		if vuln.Cve.VulnStatus != StatusRejected {
+			kept = append(kept, vuln)
+		}
+	}
+	suppressed := len(resp.Vulnerabilities) - len(kept)
+	resp.Vulnerabilities = kept
+	resp.TotalResults = max(resp.TotalResults-suppressed, len(kept))
+	resp.ResultsPerPage = len(kept)
+	return suppressed
+}
+
+// MergeResponse appends the CVEs of resp to merged, adding up the totals, for
+// the responses of the queries of a split filter. CVEs scored with several
+// severities, e.g. by NVD and by the CNA, are only kept once.
+func MergeResponse(merged, resp *schema.NvdAPIResponse) {
+	seen := make(map[string]bool, len(merged.Vulnerabilities))
+	for _, vuln := range merged.Vulnerabilities {
+		seen[vuln.Cve.ID] = true
+	}
+	merged.TotalResults += resp.TotalResults
+	for _, vuln := range resp.Vulnerabilities {
+		if seen[vuln.Cve.ID] {
+			merged.TotalResults--
+			continue
+		}
+		merged.Vulnerabilities = append(merged.Vulnerabilities, vuln)
+	}
+	merged.ResultsPerPage = len(merged.Vulnerabilities)
+	if merged.Format == "" {
+		merged.Format, merged.Version, merged.Timestamp = resp.Format, resp.Version, resp.Timestamp
+	}
+}
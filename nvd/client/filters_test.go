@@ -0,0 +1,181 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+
+	"github.com/kptm-tools/vulnerability-analysis/nvd/schema"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFilter_Normalize(t *testing.T) {
+	t.Parallel()
+	f, err := Filter{CVSSV3Severities: []string{" high", "CRITICAL", "", "High"}, CVSSV3Metrics: "cvss:3.1/av:n/ac:l"}.Normalize()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"HIGH", "CRITICAL"}, f.CVSSV3Severities)
+	assert.Equal(t, "AV:N/AC:L", f.CVSSV3Metrics)
+
+	for _, invalid := range []Filter{
+		{CVSSV3Severities: []string{"SEVERE"}},
+		{CVSSV3Severities: []string{"HIGH"}, CVSSV4Severities: []string{"HIGH"}},
+		{CVSSV4Severities: []string{"HIGH"}, CVSSV3Metrics: "AV:N"},
+		{CVSSV3Metrics: "AV:N/AC"},
+	} {
+		_, err := invalid.Normalize()
+		assert.ErrorIs(t, err, ErrInvalidFilter, "%+v", invalid)
+	}
+}
+
+func TestFilter_Matches(t *testing.T) {
+	t.Parallel()
+	vuln := schema.Vulnerability{Cve: schema.CveDetail{Metrics: &schema.Metrics{
+		CvssMetricV31: []schema.CvssMetricV31{{CvssData: schema.CvssDataV31{
+			BaseSeverity: schema.SeverityTypeHigh,
+			VectorString: "CVSS:3.1/AV:N/AC:L/PR:N/UI:N/S:U/C:H/I:H/A:N",
+		}}},
+		CvssMetricV40: []schema.CvssMetricV40{{CvssData: schema.CvssDataV40{BaseSeverity: schema.SeverityTypeCritical}}},
+	}}}
+
+	assert.True(t, Filter{}.Matches(vuln))
+	assert.True(t, Filter{CVSSV3Severities: []string{"HIGH", "CRITICAL"}}.Matches(vuln))
+	assert.False(t, Filter{CVSSV3Severities: []string{"CRITICAL"}}.Matches(vuln))
+	assert.True(t, Filter{CVSSV4Severities: []string{"CRITICAL"}}.Matches(vuln))
+	assert.True(t, Filter{CVSSV3Metrics: "AV:N/PR:N"}.Matches(vuln))
+	assert.False(t, Filter{CVSSV3Metrics: "AV:L"}.Matches(vuln))
+	assert.False(t, Filter{CVSSV3Severities: []string{"HIGH"}}.Matches(schema.Vulnerability{}), "Expected CVEs without metrics to be filtered out")
+}
+
+func TestClient_FetchAllFiltered(t *testing.T) {
+	t.Parallel()
+	var mu sync.Mutex
+	var severities []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		severity := r.URL.Query().Get("cvssV3Severity")
+		mu.Lock()
+		severities = append(severities, severity)
+		mu.Unlock()
+		assert.Equal(t, "AV:N", r.URL.Query().Get("cvssV3Metrics"))
+
+		resp := schema.NvdAPIResponse{TotalResults: 2, ResultsPerPage: 2}
+		for i := range 2 {
+			resp.Vulnerabilities = append(resp.Vulnerabilities, schema.Vulnerability{Cve: schema.CveDetail{ID: fmt.Sprintf("CVE-%s-%d", severity, i)}})
+		}
+		require.NoError(t, json.NewEncoder(w).Encode(resp))
+	}))
+	defer server.Close()
+
+	c := New(server.URL, "")
+	filter := Filter{CVSSV3Severities: []string{"high", "critical"}, CVSSV3Metrics: "AV:N"}
+	resp, err := c.FetchAllFiltered(context.Background(), nil, filter, 0)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"HIGH", "CRITICAL"}, severities)
+	assert.Len(t, resp.Vulnerabilities, 4)
+	assert.Equal(t, 4, resp.TotalResults)
+
+	severities = nil
+	resp, err = c.FetchAllFiltered(context.Background(), nil, filter, 2)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"HIGH"}, severities, "Expected the limit to skip the remaining severities")
+	assert.Len(t, resp.Vulnerabilities, 2)
+
+	_, err = c.FetchAllFiltered(context.Background(), nil, Filter{CVSSV3Severities: []string{"SEVERE"}}, 0)
+	assert.ErrorIs(t, err, ErrInvalidFilter)
+}
+
+func TestFilter_Flags(t *testing.T) {
+	t.Parallel()
+	f, err := Filter{Flags: []string{"haskev", " hasOval", "", "HASKEV"}}.Normalize()
+	require.NoError(t, err)
+	assert.Equal(t, []string{FlagKEV, FlagOVAL}, f.Flags)
+	assert.False(t, f.IsZero())
+
+	_, err = Filter{Flags: []string{"hasExploit"}}.Normalize()
+	assert.ErrorIs(t, err, ErrInvalidFilter)
+
+	added := "2021-12-10"
+	kev := schema.Vulnerability{Cve: schema.CveDetail{CisaExploitAdd: &added}}
+	assert.True(t, Filter{Flags: []string{FlagKEV}}.Matches(kev))
+	assert.False(t, Filter{Flags: []string{FlagKEV}}.Matches(schema.Vulnerability{}))
+	assert.True(t, Filter{Flags: []string{FlagCertAlerts}}.Matches(schema.Vulnerability{}), "Expected flags records don't tell to be ignored offline")
+	assert.False(t, Filter{Flags: []string{FlagKEV}, CVSSV3Severities: []string{"HIGH"}}.Matches(kev), "Expected severities to still apply")
+}
+
+func TestFilter_Remote(t *testing.T) {
+	t.Parallel()
+	f := Filter{CVSSV3Severities: []string{"HIGH"}, CWEID: "CWE-89", Flags: []string{FlagKEV, FlagOVAL, FlagNoRejected, FlagCertNotes}}
+	assert.Equal(t, Filter{Flags: []string{FlagOVAL, FlagCertNotes}}, f.Remote())
+	assert.True(t, Filter{CVSSV3Severities: []string{"HIGH"}, Flags: []string{FlagNoRejected}}.Remote().IsZero())
+}
+
+func TestFilter_CWEID(t *testing.T) {
+	t.Parallel()
+	for input, want := range map[string]string{"89": "CWE-89", " cwe-79": "CWE-79", "nvd-cwe-noinfo": "NVD-CWE-noinfo", "": ""} {
+		got, err := NormalizeCWEID(input)
+		require.NoError(t, err, input)
+		assert.Equal(t, want, got)
+	}
+	for _, invalid := range []string{"CWE-", "SQLi", "CWE-89a"} {
+		_, err := NormalizeCWEID(invalid)
+		assert.ErrorIs(t, err, ErrInvalidFilter, invalid)
+	}
+
+	f, err := Filter{CVSSV3Severities: []string{"HIGH", "CRITICAL"}, CWEID: "89"}.Normalize()
+	require.NoError(t, err)
+	assert.False(t, f.IsZero())
+	for _, sub := range f.Split() {
+		assert.Equal(t, "CWE-89", sub.Apply(nil).Get("cweId"), "Expected every severity query to keep the CWE")
+	}
+
+	sqli := schema.Vulnerability{Cve: schema.CveDetail{Weaknesses: []schema.Weakness{{Description: []schema.Description{{Lang: "en", Value: "CWE-89"}}}}}}
+	assert.True(t, Filter{CWEID: "CWE-89"}.Matches(sqli))
+	assert.False(t, Filter{CWEID: "CWE-79"}.Matches(sqli))
+	assert.False(t, Filter{CWEID: "CWE-89"}.Matches(schema.Vulnerability{}))
+}
+
+func TestClient_FetchAllFiltered_Flags(t *testing.T) {
+	t.Parallel()
+	var mu sync.Mutex
+	var queries []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		queries = append(queries, r.URL.RawQuery)
+		mu.Unlock()
+		require.NoError(t, json.NewEncoder(w).Encode(schema.NvdAPIResponse{}))
+	}))
+	defer server.Close()
+
+	filter := Filter{CVSSV3Severities: []string{"HIGH", "CRITICAL"}, Flags: []string{"hasKev", "hasCertNotes"}}
+	_, err := New(server.URL, "").FetchAllFiltered(context.Background(), url.Values{"cpeName": {"cpe:2.3:a:apache:log4j:2.14.1:*:*:*:*:*:*:*"}}, filter, 0)
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"cpeName=cpe%3A2.3%3Aa%3Aapache%3Alog4j%3A2.14.1%3A%2A%3A%2A%3A%2A%3A%2A%3A%2A%3A%2A%3A%2A&cvssV3Severity=HIGH&hasCertNotes&hasKev",
+		"cpeName=cpe%3A2.3%3Aa%3Aapache%3Alog4j%3A2.14.1%3A%2A%3A%2A%3A%2A%3A%2A%3A%2A%3A%2A%3A%2A&cvssV3Severity=CRITICAL&hasCertNotes&hasKev",
+	}, queries, "Expected flags to be sent without value with every severity")
+}
+
+func TestSuppressRejected(t *testing.T) {
+	t.Parallel()
+	resp := &schema.NvdAPIResponse{TotalResults: 3, ResultsPerPage: 3, Vulnerabilities: []schema.Vulnerability{
+		{Cve: schema.CveDetail{ID: "CVE-2024-0001", VulnStatus: "Analyzed"}},
+		{Cve: schema.CveDetail{ID: "CVE-2024-0002", VulnStatus: StatusRejected}},
+		{Cve: schema.CveDetail{ID: "CVE-2024-0003", VulnStatus: "Awaiting Analysis"}},
+	}}
+	rejected := resp.Vulnerabilities[1]
+
+	assert.Equal(t, 1, SuppressRejected(resp))
+	require.Len(t, resp.Vulnerabilities, 2)
+	assert.Equal(t, "CVE-2024-0003", resp.Vulnerabilities[1].Cve.ID)
+	assert.Equal(t, 2, resp.TotalResults)
+	assert.Equal(t, 2, resp.ResultsPerPage)
+	assert.Zero(t, SuppressRejected(resp))
+
+	assert.False(t, Filter{Flags: []string{FlagNoRejected}}.Matches(rejected))
+	assert.True(t, Filter{Flags: []string{FlagNoRejected}}.Matches(resp.Vulnerabilities[0]))
+}
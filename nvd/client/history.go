@@ -0,0 +1,134 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/kptm-tools/vulnerability-analysis/nvd/schema"
+)
+
+// DefaultHistoryURL is the NVD CVE Change History API endpoint.
+const DefaultHistoryURL = "https://services.nvd.nist.gov/rest/json/cvehistory/2.0"
+
+// MaxHistoryPerPage is the largest page the CVE Change History API returns.
+const MaxHistoryPerPage = 5000
+
+// Events of the history of a CVE, for the eventName parameter.
+const (
+	EventNewCVE           = "New CVE Received"
+	EventInitialAnalysis  = "Initial Analysis"
+	EventReanalysis       = "Reanalysis"
+	EventCVEModified      = "CVE Modified"
+	EventModifiedAnalysis = "Modified Analysis"
+	EventCVERejected      = "CVE Rejected"
+	EventCVEUnrejected    = "CVE Unrejected"
+	EventCISAKEVUpdate    = "CVE CISA KEV Update"
+)
+
+// historyURL returns the history endpoint next to the CVE API at baseURL,
+// e.g. of a mirror serving both.
+func historyURL(baseURL string) string {
+	if base, ok := strings.CutSuffix(baseURL, "/cves/2.0"); ok {
+		return base + "/cvehistory/2.0"
+	}
+	return strings.TrimSuffix(baseURL, "/") + "/cvehistory/2.0"
+}
+
+// FetchHistory issues a single CVE Change History API request, e.g. with
+// cveId or eventName, and a changeStartDate/changeEndDate set by Changed.
+func (c *Client) FetchHistory(ctx context.Context, query url.Values) (*schema.CveHistoryResponse, error) {
+	endpoint := c.HistoryURL
+	if endpoint == "" {
+		endpoint = historyURL(c.BaseURL)
+	}
+	var resp schema.CveHistoryResponse
+	if err := c.do(ctx, endpoint, query, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// FetchAllHistory follows startIndex until every change of query, or limit
+// changes when limit is positive, have been fetched and merges the pages.
+func (c *Client) FetchAllHistory(ctx context.Context, query url.Values, limit int) (*schema.CveHistoryResponse, error) {
+	query = cloneQuery(query)
+	if limit > 0 && limit < MaxHistoryPerPage {
+		query.Set("resultsPerPage", strconv.Itoa(limit))
+	}
+
+	merged, err := c.FetchHistory(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	for next := merged.StartIndex + len(merged.CveChanges); next < merged.TotalResults; {
+		if limit > 0 && len(merged.CveChanges) >= limit {
+			break
+		}
+		query.Set("startIndex", strconv.Itoa(next))
+		page, err := c.FetchHistory(ctx, query)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch NVD history page at index %d: %w", next, err)
+		}
+		if len(page.CveChanges) == 0 {
+			break
+		}
+		merged.CveChanges = append(merged.CveChanges, page.CveChanges...)
+		next += len(page.CveChanges)
+	}
+
+	if limit > 0 && len(merged.CveChanges) > limit {
+		merged.CveChanges = merged.CveChanges[:limit]
+	}
+	merged.StartIndex = 0
+	merged.ResultsPerPage = len(merged.CveChanges)
+	return merged, nil
+}
+
+// HistoryOf returns the changes of a CVE, oldest first.
+func (c *Client) HistoryOf(ctx context.Context, cveID string) (*schema.CveHistoryResponse, error) {
+	return c.FetchAllHistory(ctx, url.Values{"cveId": {cveID}}, 0)
+}
+
+// ChangedBetween returns the changes of every CVE made within r, a range of
+// DateChanged, up to limit when positive, querying a window of MaxDateRange
+// at a time. Changes on the bound of two windows are only kept once.
+func (c *Client) ChangedBetween(ctx context.Context, r DateRange, limit int) (*schema.CveHistoryResponse, error) {
+	if r.Date != DateChanged {
+		return nil, fmt.Errorf("%w: history ranges are of %q, got %q", ErrInvalidDateRange, DateChanged, r.Date)
+	}
+	if err := r.validate(); err != nil {
+		return nil, err
+	}
+
+	merged := &schema.CveHistoryResponse{}
+	seen := make(map[string]bool)
+	for _, window := range r.Windows(MaxDateRange) {
+		remaining := 0
+		if limit > 0 {
+			if remaining = limit - len(merged.CveChanges); remaining <= 0 {
+				break
+			}
+		}
+		query, err := window.Apply(nil)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := c.FetchAllHistory(ctx, query, remaining)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range resp.CveChanges {
+			if id := item.Change.CveChangeID; id == "" || !seen[id] {
+				seen[id] = true
+				merged.CveChanges = append(merged.CveChanges, item)
+			}
+		}
+		merged.TotalResults += resp.TotalResults
+		merged.Format, merged.Version, merged.Timestamp = resp.Format, resp.Version, resp.Timestamp
+	}
+	merged.ResultsPerPage = len(merged.CveChanges)
+	return merged, nil
+}
@@ -0,0 +1,82 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kptm-tools/vulnerability-analysis/nvd/schema"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClient_HistoryOf(t *testing.T) {
+	t.Parallel()
+	changes := []schema.CveChangeItem{
+		{Change: schema.CveChange{CveID: "CVE-2024-0001", EventName: EventNewCVE, CveChangeID: "a"}},
+		{Change: schema.CveChange{CveID: "CVE-2024-0001", EventName: EventReanalysis, CveChangeID: "b",
+			Details: []schema.ChangeDetail{{Action: "Changed", Type: "CVSS V3.1", OldValue: "7.5", NewValue: "9.8"}}}},
+		{Change: schema.CveChange{CveID: "CVE-2024-0001", EventName: EventCVEModified, CveChangeID: "c",
+			Details: []schema.ChangeDetail{{Action: "Added", Type: "Reference", NewValue: "https://example.com"}}}},
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/rest/json/cvehistory/2.0" {
+			http.NotFound(w, r)
+			return
+		}
+		assert.Equal(t, "CVE-2024-0001", r.URL.Query().Get("cveId"))
+		start, _ := strconv.Atoi(r.URL.Query().Get("startIndex"))
+		end := min(start+2, len(changes))
+		json.NewEncoder(w).Encode(schema.CveHistoryResponse{
+			StartIndex:     start,
+			ResultsPerPage: end - start,
+			TotalResults:   len(changes),
+			CveChanges:     changes[start:end],
+		})
+	}))
+	defer server.Close()
+
+	c := New(server.URL+"/rest/json/cves/2.0", "")
+	assert.Equal(t, server.URL+"/rest/json/cvehistory/2.0", c.HistoryURL)
+	resp, err := c.HistoryOf(context.Background(), "CVE-2024-0001")
+	require.NoError(t, err)
+	require.Len(t, resp.CveChanges, 3, "Expected the pages to be merged")
+
+	assert.False(t, resp.CveChanges[0].Change.StatusChanged())
+	assert.True(t, resp.CveChanges[1].Change.ScoreChanged())
+	assert.True(t, resp.CveChanges[1].Change.StatusChanged())
+	assert.False(t, resp.CveChanges[2].Change.ScoreChanged())
+}
+
+func TestClient_ChangedBetween(t *testing.T) {
+	t.Parallel()
+	var mu sync.Mutex
+	windows := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		windows++
+		mu.Unlock()
+		assert.NotEmpty(t, r.URL.Query().Get("changeStartDate"))
+		assert.NotEmpty(t, r.URL.Query().Get("changeEndDate"))
+		// Every window returns the same change, as if made on their bound
+		json.NewEncoder(w).Encode(schema.CveHistoryResponse{TotalResults: 1, CveChanges: []schema.CveChangeItem{
+			{Change: schema.CveChange{CveID: "CVE-2024-0001", CveChangeID: "a"}},
+		}})
+	}))
+	defer server.Close()
+
+	c := New(server.URL, "")
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	resp, err := c.ChangedBetween(context.Background(), Changed(start, start.Add(MaxDateRange+time.Hour)), 0)
+	require.NoError(t, err)
+	assert.Equal(t, 2, windows)
+	assert.Len(t, resp.CveChanges, 1, "Expected the change of both windows once")
+
+	_, err = c.ChangedBetween(context.Background(), Modified(start, start.Add(time.Hour)), 0)
+	assert.ErrorIs(t, err, ErrInvalidDateRange)
+}
@@ -0,0 +1,165 @@
+package client
+
+import (
+	"sync"
+	"time"
+)
+
+// KeyRing spreads requests over several API keys, so that their quotas add
+// up. Keys NVD throttles are rested until the delay it asked for, and keys it
+// rejects are dropped from the rotation. It is safe for concurrent use.
+type KeyRing struct {
+	mu   sync.Mutex
+	keys []*apiKey
+	next int
+	now  func() time.Time
+}
+
+type apiKey struct {
+	value        string
+	usage        KeyUsage
+	restingUntil time.Time
+}
+
+// KeyUsage counts the requests sent with a key. Key holds the last characters
+// of the key only, so that usage can be logged.
+type KeyUsage struct {
+	Key          string    `json:"key"`
+	Requests     int       `json:"requests"`
+	RateLimited  int       `json:"rate_limited"`
+	Rejected     bool      `json:"rejected"`
+	RestingUntil time.Time `json:"resting_until"`
+}
+
+// keyRestDelay rests a throttled key for a rate limit window when NVD doesn't
+// say for how long.
+var keyRestDelay = KeyedRateLimit.Window
+
+// NewKeyRing returns a ring rotating over keys, skipping empty and repeated
+// keys.
+func NewKeyRing(keys ...string) *KeyRing {
+	r := &KeyRing{now: time.Now}
+	seen := make(map[string]bool)
+	for _, k := range keys {
+		if k == "" || seen[k] {
+			continue
+		}
+		seen[k] = true
+		r.keys = append(r.keys, &apiKey{value: k, usage: KeyUsage{Key: maskKey(k)}})
+	}
+	return r
+}
+
+// Replace rotates over keys instead, e.g. once rotated in a secret manager,
+// skipping empty and repeated keys. The keys kept keep their usage, rejected
+// ones staying out of the rotation.
+func (r *KeyRing) Replace(keys ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	previous := make(map[string]*apiKey, len(r.keys))
+	for _, k := range r.keys {
+		previous[k.value] = k
+	}
+	r.keys = r.keys[:0:0]
+	seen := make(map[string]bool)
+	for _, k := range keys {
+		if k == "" || seen[k] {
+			continue
+		}
+		seen[k] = true
+		key, ok := previous[k]
+		if !ok {
+			key = &apiKey{value: k, usage: KeyUsage{Key: maskKey(k)}}
+		}
+		r.keys = append(r.keys, key)
+	}
+	r.next = 0
+}
+
+// Active returns the number of keys NVD hasn't rejected.
+func (r *KeyRing) Active() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	active := 0
+	for _, k := range r.keys {
+		if !k.usage.Rejected {
+			active++
+		}
+	}
+	return active
+}
+
+// Usage returns the usage of every key, in configuration order.
+func (r *KeyRing) Usage() []KeyUsage {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	usage := make([]KeyUsage, len(r.keys))
+	for i, k := range r.keys {
+		usage[i] = k.usage
+		usage[i].RestingUntil = k.restingUntil
+	}
+	return usage
+}
+
+// pick returns the next key of the rotation that isn't resting or, when all
+// are resting, the first to be available again. It returns "" when every key
+// was rejected.
+func (r *KeyRing) pick() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := r.now()
+	var soonest *apiKey
+	for i := range r.keys {
+		k := r.keys[(r.next+i)%len(r.keys)]
+		if k.usage.Rejected {
+			continue
+		}
+		if !k.restingUntil.After(now) {
+			r.next = (r.next + i + 1) % len(r.keys)
+			return k.value
+		}
+		if soonest == nil || k.restingUntil.Before(soonest.restingUntil) {
+			soonest = k
+		}
+	}
+	if soonest == nil {
+		return ""
+	}
+	return soonest.value
+}
+
+// record accounts a request sent with key. Throttled keys rest for retryAfter,
+// or a rate limit window when zero, and rejected keys leave the rotation.
+func (r *KeyRing) record(key string, throttled bool, retryAfter time.Duration, rejected bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, k := range r.keys {
+		if k.value != key {
+			continue
+		}
+		k.usage.Requests++
+		if throttled {
+			k.usage.RateLimited++
+			if retryAfter <= 0 {
+				retryAfter = keyRestDelay
+			}
+			k.restingUntil = r.now().Add(retryAfter)
+		}
+		if rejected {
+			k.usage.Rejected = true
+		}
+		return
+	}
+}
+
+func maskKey(key string) string {
+	if len(key) <= 4 {
+		return "****"
+	}
+	return "****" + key[len(key)-4:]
+}
@@ -0,0 +1,138 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeyRing_pick(t *testing.T) {
+	t.Parallel()
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	r := NewKeyRing("key-a", "", "key-b", "key-a", "key-c")
+	r.now = func() time.Time { return now }
+	require.Equal(t, 3, r.Active())
+
+	assert.Equal(t, []string{"key-a", "key-b", "key-c", "key-a"}, []string{r.pick(), r.pick(), r.pick(), r.pick()})
+
+	// Throttled keys rest, rejected keys leave the rotation
+	r.record("key-b", true, 10*time.Second, false)
+	r.record("key-c", false, 0, true)
+	assert.Equal(t, 2, r.Active())
+	assert.Equal(t, []string{"key-a", "key-a"}, []string{r.pick(), r.pick()})
+
+	// With every key resting, the first available again is used
+	r.record("key-a", true, 0, false)
+	assert.Equal(t, "key-b", r.pick())
+
+	now = now.Add(10 * time.Second)
+	assert.Equal(t, "key-b", r.pick())
+
+	r.record("key-a", false, 0, true)
+	r.record("key-b", false, 0, true)
+	assert.Empty(t, r.pick(), "Expected unauthenticated requests once every key is rejected")
+
+	usage := r.Usage()
+	require.Len(t, usage, 3)
+	assert.Equal(t, KeyUsage{Key: "****ey-a", Requests: 2, RateLimited: 1, Rejected: true, RestingUntil: now.Add(-10 * time.Second).Add(keyRestDelay)}, usage[0])
+	assert.Equal(t, 1, usage[1].RateLimited)
+}
+
+func TestKeyRing_Replace(t *testing.T) {
+	t.Parallel()
+	r := NewKeyRing("key-a", "key-b")
+	r.record("key-a", false, 0, false)
+	r.record("key-b", false, 0, true)
+
+	r.Replace("key-b", "key-c", "", "key-c")
+	assert.Equal(t, 1, r.Active(), "Expected rejected keys to stay out of the rotation")
+	assert.Equal(t, []string{"key-c", "key-c"}, []string{r.pick(), r.pick()})
+
+	usage := r.Usage()
+	require.Len(t, usage, 2)
+	assert.Equal(t, KeyUsage{Key: "****ey-b", Requests: 1, Rejected: true}, usage[0])
+	assert.Equal(t, KeyUsage{Key: "****ey-c"}, usage[1])
+}
+
+func TestClient_Fetch_KeyFailover(t *testing.T) {
+	t.Parallel()
+	var mu sync.Mutex
+	var keys []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(DefaultAPIKeyHeader)
+		mu.Lock()
+		keys = append(keys, key)
+		mu.Unlock()
+
+		switch key {
+		case "revoked":
+			w.Header().Set("message", "Invalid apiKey.")
+			w.WriteHeader(http.StatusNotFound)
+		case "throttled":
+			w.Header().Set("Retry-After", "60")
+			w.WriteHeader(http.StatusTooManyRequests)
+		default:
+			w.Write([]byte(`{"totalResults":0}`))
+		}
+	}))
+	defer server.Close()
+
+	c := New(server.URL, "")
+	c.Keys = NewKeyRing("revoked", "throttled", "valid")
+	assert.Equal(t, 150, c.RateLimit().Requests)
+
+	_, err := c.ByCVE(context.Background(), "CVE-2024-0001")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"revoked", "throttled", "valid"}, keys)
+	assert.Equal(t, 100, c.RateLimit().Requests, "Expected the rejected key to leave the quota")
+
+	// The throttled key rests while the valid one serves the requests
+	keys = nil
+	for i := 0; i < 2; i++ {
+		_, err = c.ByCVE(context.Background(), "CVE-2024-0001")
+		require.NoError(t, err)
+	}
+	assert.Equal(t, []string{"valid", "valid"}, keys)
+
+	usage := c.Keys.Usage()
+	assert.True(t, usage[0].Rejected)
+	assert.Equal(t, 1, usage[1].RateLimited)
+	assert.Equal(t, 3, usage[2].Requests)
+}
+
+func TestClient_Fetch_KeysExhausted(t *testing.T) {
+	t.Parallel()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	c := New(server.URL, "")
+	c.Keys = NewKeyRing("key-a", "key-b")
+	_, err := c.ByCVE(context.Background(), "CVE-2024-0001")
+	assert.ErrorIs(t, err, ErrRateLimited, "Expected the error of the last key once every key was tried")
+}
+
+func TestClient_Fetch_BareForbiddenKeepsKey(t *testing.T) {
+	t.Parallel()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	c := New(server.URL, "")
+	c.Keys = NewKeyRing("key-a")
+	_, err := c.ByCVE(context.Background(), "CVE-2024-0001")
+	assert.ErrorIs(t, err, ErrRateLimited)
+	assert.NotErrorIs(t, err, ErrKeyRejected)
+
+	usage := c.Keys.Usage()
+	assert.False(t, usage[0].Rejected, "Expected a bare 403 to throttle the key rather than reject it")
+	assert.Equal(t, 1, usage[0].RateLimited)
+}
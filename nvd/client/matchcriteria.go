@@ -0,0 +1,105 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/kptm-tools/vulnerability-analysis/nvd/schema"
+)
+
+// DefaultMatchCriteriaURL is the NVD Match Criteria API endpoint.
+const DefaultMatchCriteriaURL = "https://services.nvd.nist.gov/rest/json/cpematch/2.0"
+
+// MaxMatchStringsPerPage is the largest page the Match Criteria API returns.
+const MaxMatchStringsPerPage = 500
+
+var ErrMatchCriteriaNotFound = errors.New("NVD match criteria not found")
+
+// Statuses of a match string.
+const (
+	MatchStringActive   = "Active"
+	MatchStringInactive = "Inactive"
+)
+
+// matchCriteriaURL returns the match criteria endpoint next to the CVE API at
+// baseURL, e.g. of a mirror serving both.
+func matchCriteriaURL(baseURL string) string {
+	if base, ok := strings.CutSuffix(baseURL, "/cves/2.0"); ok {
+		return base + "/cpematch/2.0"
+	}
+	return strings.TrimSuffix(baseURL, "/") + "/cpematch/2.0"
+}
+
+// FetchMatchCriteria issues a single Match Criteria API request, e.g. with
+// matchCriteriaId or cveId.
+func (c *Client) FetchMatchCriteria(ctx context.Context, query url.Values) (*schema.MatchCriteriaResponse, error) {
+	endpoint := c.MatchCriteriaURL
+	if endpoint == "" {
+		endpoint = matchCriteriaURL(c.BaseURL)
+	}
+	var resp schema.MatchCriteriaResponse
+	if err := c.do(ctx, endpoint, query, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// FetchAllMatchCriteria follows startIndex until every match string of query
+// has been fetched and merges the pages.
+func (c *Client) FetchAllMatchCriteria(ctx context.Context, query url.Values) (*schema.MatchCriteriaResponse, error) {
+	query = cloneQuery(query)
+
+	merged, err := c.FetchMatchCriteria(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	for next := merged.StartIndex + len(merged.MatchStrings); next < merged.TotalResults; {
+		query.Set("startIndex", strconv.Itoa(next))
+		page, err := c.FetchMatchCriteria(ctx, query)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch NVD match criteria page at index %d: %w", next, err)
+		}
+		if len(page.MatchStrings) == 0 {
+			break
+		}
+		merged.MatchStrings = append(merged.MatchStrings, page.MatchStrings...)
+		next += len(page.MatchStrings)
+	}
+
+	merged.StartIndex = 0
+	merged.ResultsPerPage = len(merged.MatchStrings)
+	return merged, nil
+}
+
+// MatchCriteria returns the expansion of the match criteria identified by
+// id, the matchCriteriaId of a CpeMatch, into CPE names.
+func (c *Client) MatchCriteria(ctx context.Context, id string) (*schema.MatchString, error) {
+	resp, err := c.FetchMatchCriteria(ctx, url.Values{"matchCriteriaId": {id}})
+	if err != nil {
+		return nil, err
+	}
+	for _, item := range resp.MatchStrings {
+		if strings.EqualFold(item.MatchString.MatchCriteriaID, id) {
+			return &item.MatchString, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", ErrMatchCriteriaNotFound, id)
+}
+
+// MatchCriteriaOfCVE returns the expansions of every match criteria of the
+// configurations of the CVE cveID.
+func (c *Client) MatchCriteriaOfCVE(ctx context.Context, cveID string) ([]schema.MatchString, error) {
+	resp, err := c.FetchAllMatchCriteria(ctx, url.Values{"cveId": {cveID}})
+	if err != nil {
+		return nil, err
+	}
+	matches := make([]schema.MatchString, 0, len(resp.MatchStrings))
+	for _, item := range resp.MatchStrings {
+		matches = append(matches, item.MatchString)
+	}
+	return matches, nil
+}
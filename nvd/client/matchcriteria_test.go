@@ -0,0 +1,77 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/kptm-tools/vulnerability-analysis/nvd/schema"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClient_MatchCriteria(t *testing.T) {
+	t.Parallel()
+	end := "8.3"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/rest/json/cpematch/2.0" {
+			http.NotFound(w, r)
+			return
+		}
+		resp := schema.MatchCriteriaResponse{}
+		if r.URL.Query().Get("matchCriteriaId") == "A1B2" {
+			resp.TotalResults, resp.ResultsPerPage = 1, 1
+			resp.MatchStrings = []schema.MatchStringItem{{MatchString: schema.MatchString{
+				MatchCriteriaID:     "A1B2",
+				Criteria:            "cpe:2.3:a:openbsd:openssh:*:*:*:*:*:*:*:*",
+				VersionEndExcluding: &end,
+				Status:              MatchStringActive,
+				Matches: []schema.CpeNameRef{
+					{CpeName: "cpe:2.3:a:openbsd:openssh:8.1:*:*:*:*:*:*:*"},
+					{CpeName: "cpe:2.3:a:openbsd:openssh:8.2:p1:*:*:*:*:*:*"},
+				},
+			}}}
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer server.Close()
+
+	c := New(server.URL+"/rest/json/cves/2.0", "")
+	assert.Equal(t, server.URL+"/rest/json/cpematch/2.0", c.MatchCriteriaURL)
+
+	match, err := c.MatchCriteria(context.Background(), "A1B2")
+	require.NoError(t, err)
+	assert.True(t, match.Covers("cpe:2.3:a:openbsd:openssh:8.2:P1:*:*:*:*:*:*"))
+	assert.False(t, match.Covers("cpe:2.3:a:openbsd:openssh:8.3:*:*:*:*:*:*:*"))
+
+	_, err = c.MatchCriteria(context.Background(), "C3D4")
+	assert.ErrorIs(t, err, ErrMatchCriteriaNotFound)
+}
+
+func TestClient_MatchCriteriaOfCVE(t *testing.T) {
+	t.Parallel()
+	var items []schema.MatchStringItem
+	for i := range 5 {
+		items = append(items, schema.MatchStringItem{MatchString: schema.MatchString{MatchCriteriaID: strconv.Itoa(i)}})
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "CVE-2024-6387", r.URL.Query().Get("cveId"))
+		start, _ := strconv.Atoi(r.URL.Query().Get("startIndex"))
+		end := min(start+2, len(items))
+		json.NewEncoder(w).Encode(schema.MatchCriteriaResponse{
+			StartIndex:     start,
+			ResultsPerPage: end - start,
+			TotalResults:   len(items),
+			MatchStrings:   items[start:end],
+		})
+	}))
+	defer server.Close()
+
+	matches, err := New(server.URL, "").MatchCriteriaOfCVE(context.Background(), "CVE-2024-6387")
+	require.NoError(t, err)
+	require.Len(t, matches, 5, "Expected the pages to be merged")
+	assert.Equal(t, "4", matches[4].MatchCriteriaID)
+}
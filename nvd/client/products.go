@@ -0,0 +1,88 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/kptm-tools/vulnerability-analysis/nvd/schema"
+)
+
+// DefaultProductsURL is the NVD Products (CPE) API endpoint.
+const DefaultProductsURL = "https://services.nvd.nist.gov/rest/json/cpes/2.0"
+
+// MaxProductsPerPage is the largest page the Products API returns.
+const MaxProductsPerPage = 10000
+
+// productsURL returns the products endpoint next to the CVE API at baseURL,
+// e.g. of a mirror serving both.
+func productsURL(baseURL string) string {
+	if base, ok := strings.CutSuffix(baseURL, "/cves/2.0"); ok {
+		return base + "/cpes/2.0"
+	}
+	return strings.TrimSuffix(baseURL, "/") + "/cpes/2.0"
+}
+
+// FetchProducts issues a single Products API request, e.g. with
+// cpeMatchString or keywordSearch.
+func (c *Client) FetchProducts(ctx context.Context, query url.Values) (*schema.CpeProductsResponse, error) {
+	endpoint := c.ProductsURL
+	if endpoint == "" {
+		endpoint = productsURL(c.BaseURL)
+	}
+	var resp schema.CpeProductsResponse
+	if err := c.do(ctx, endpoint, query, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// FetchAllProducts follows startIndex until every product of query, or limit
+// products when limit is positive, have been fetched and merges the pages.
+func (c *Client) FetchAllProducts(ctx context.Context, query url.Values, limit int) (*schema.CpeProductsResponse, error) {
+	query = cloneQuery(query)
+	if limit > 0 && limit < MaxProductsPerPage {
+		query.Set("resultsPerPage", strconv.Itoa(limit))
+	}
+
+	merged, err := c.FetchProducts(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	for next := merged.StartIndex + len(merged.Products); next < merged.TotalResults; {
+		if limit > 0 && len(merged.Products) >= limit {
+			break
+		}
+		query.Set("startIndex", strconv.Itoa(next))
+		page, err := c.FetchProducts(ctx, query)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch NVD products page at index %d: %w", next, err)
+		}
+		if len(page.Products) == 0 {
+			break
+		}
+		merged.Products = append(merged.Products, page.Products...)
+		next += len(page.Products)
+	}
+
+	if limit > 0 && len(merged.Products) > limit {
+		merged.Products = merged.Products[:limit]
+	}
+	merged.StartIndex = 0
+	merged.ResultsPerPage = len(merged.Products)
+	return merged, nil
+}
+
+// ProductsMatching returns the dictionary entries matching a CPE 2.3 match
+// string, e.g. cpe:2.3:a:dovecot:dovecot:2.3.16, up to limit when positive.
+func (c *Client) ProductsMatching(ctx context.Context, matchString string, limit int) (*schema.CpeProductsResponse, error) {
+	return c.FetchAllProducts(ctx, url.Values{"cpeMatchString": {matchString}}, limit)
+}
+
+// ProductsByKeyword returns the dictionary entries whose titles contain
+// every word of keyword, e.g. "OpenSSH 8.2p1", up to limit when positive.
+func (c *Client) ProductsByKeyword(ctx context.Context, keyword string, limit int) (*schema.CpeProductsResponse, error) {
+	return c.FetchAllProducts(ctx, url.Values{"keywordSearch": {keyword}}, limit)
+}
@@ -0,0 +1,64 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/kptm-tools/vulnerability-analysis/nvd/schema"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClient_ProductsMatching(t *testing.T) {
+	t.Parallel()
+	products := []schema.CpeProduct{
+		{Cpe: schema.CpeItem{CpeName: "cpe:2.3:a:dovecot:dovecot:2.3.16:*:*:*:*:*:*:*",
+			Titles: []schema.CpeTitle{{Title: "Dovecot 2.3.16", Lang: "en"}}}},
+		{Cpe: schema.CpeItem{CpeName: "cpe:2.3:a:dovecot:dovecot:2.3.16:rc1:*:*:*:*:*:*"}},
+		{Cpe: schema.CpeItem{CpeName: "cpe:2.3:a:dovecot:dovecot:2.3.16:rc2:*:*:*:*:*:*"}},
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/rest/json/cpes/2.0" {
+			http.NotFound(w, r)
+			return
+		}
+		assert.Equal(t, "cpe:2.3:a:dovecot:dovecot:2.3.16", r.URL.Query().Get("cpeMatchString"))
+		start, _ := strconv.Atoi(r.URL.Query().Get("startIndex"))
+		end := min(start+2, len(products))
+		json.NewEncoder(w).Encode(schema.CpeProductsResponse{
+			StartIndex:     start,
+			ResultsPerPage: end - start,
+			TotalResults:   len(products),
+			Products:       products[start:end],
+		})
+	}))
+	defer server.Close()
+
+	c := New(server.URL+"/rest/json/cves/2.0", "")
+	assert.Equal(t, server.URL+"/rest/json/cpes/2.0", c.ProductsURL)
+	resp, err := c.ProductsMatching(context.Background(), "cpe:2.3:a:dovecot:dovecot:2.3.16", 0)
+	require.NoError(t, err)
+	require.Len(t, resp.Products, 3, "Expected the pages to be merged")
+	assert.Equal(t, "Dovecot 2.3.16", resp.Products[0].Cpe.Title())
+	assert.Empty(t, resp.Products[1].Cpe.Title())
+}
+
+func TestClient_ProductsByKeyword(t *testing.T) {
+	t.Parallel()
+	var query map[string][]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.Query()
+		json.NewEncoder(w).Encode(schema.CpeProductsResponse{})
+	}))
+	defer server.Close()
+
+	c := New(server.URL, "")
+	_, err := c.ProductsByKeyword(context.Background(), "OpenSSH 8.2p1", 5)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"OpenSSH 8.2p1"}, query["keywordSearch"])
+	assert.Equal(t, []string{"5"}, query["resultsPerPage"])
+}
@@ -0,0 +1,80 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/kptm-tools/vulnerability-analysis/nvd/schema"
+)
+
+var ErrInvalidVersionRange = errors.New("invalid NVD version range")
+
+// Whether a bound of a VersionRange includes the version itself.
+const (
+	VersionIncluding = "including"
+	VersionExcluding = "excluding"
+)
+
+// VersionRange restricts a virtualMatchString query to the CVEs whose
+// configurations affect versions between Start and End, either of which may
+// be empty. Bounds default to including Start and excluding End.
+type VersionRange struct {
+	Start     string
+	StartType string
+	End       string
+	EndType   string
+}
+
+// Query returns the CVE API parameters matching the CPE match string
+// matchString, e.g. cpe:2.3:a:openbsd:openssh, within the range.
+func (r VersionRange) Query(matchString string) (url.Values, error) {
+	parts := strings.Split(matchString, ":")
+	if len(parts) < 4 || len(parts) > 13 || parts[0] != "cpe" || parts[1] != "2.3" {
+		return nil, fmt.Errorf("%w: %q is not a CPE 2.3 match string", ErrInvalidVersionRange, matchString)
+	}
+	if (r.Start != "" || r.End != "") && (len(parts) < 5 || parts[3] == "*" || parts[4] == "*") {
+		return nil, fmt.Errorf("%w: a version range needs the vendor and product of %q", ErrInvalidVersionRange, matchString)
+	}
+
+	query := url.Values{"virtualMatchString": {matchString}}
+	if err := setBound(query, "versionStart", r.Start, r.StartType, VersionIncluding); err != nil {
+		return nil, err
+	}
+	if err := setBound(query, "versionEnd", r.End, r.EndType, VersionExcluding); err != nil {
+		return nil, err
+	}
+	return query, nil
+}
+
+// setBound sets a version bound and its type, which NVD requires together.
+func setBound(query url.Values, param, version, boundType, fallback string) error {
+	if version == "" {
+		if boundType != "" {
+			return fmt.Errorf("%w: %sType set without %s", ErrInvalidVersionRange, param, param)
+		}
+		return nil
+	}
+	if boundType == "" {
+		boundType = fallback
+	}
+	if boundType != VersionIncluding && boundType != VersionExcluding {
+		return fmt.Errorf("%w: %sType must be %q or %q, got %q", ErrInvalidVersionRange, param, VersionIncluding, VersionExcluding, boundType)
+	}
+	query.Set(param, version)
+	query.Set(param+"Type", boundType)
+	return nil
+}
+
+// ByVersionRange returns the CVEs affecting the products matching
+// matchString within r, up to limit when positive. Unlike ByCPE, it finds the
+// CVEs whose configurations are expressed as version ranges.
+func (c *Client) ByVersionRange(ctx context.Context, matchString string, r VersionRange, limit int) (*schema.NvdAPIResponse, error) {
+	query, err := r.Query(matchString)
+	if err != nil {
+		return nil, err
+	}
+	return c.FetchAll(ctx, query, limit)
+}
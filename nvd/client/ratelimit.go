@@ -0,0 +1,180 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// RateLimit is the rolling window rate limit the NVD API enforces.
+type RateLimit struct {
+	Keyed    bool
+	Requests int
+	Window   time.Duration
+}
+
+var (
+	KeyedRateLimit   = RateLimit{Keyed: true, Requests: 50, Window: 30 * time.Second}
+	UnkeyedRateLimit = RateLimit{Keyed: false, Requests: 5, Window: 30 * time.Second}
+)
+
+// RateLimitFor returns the limit of keyed or unauthenticated clients.
+func RateLimitFor(keyed bool) RateLimit {
+	if keyed {
+		return KeyedRateLimit
+	}
+	return UnkeyedRateLimit
+}
+
+// Interval is the average delay between requests that stays within the limit.
+func (l RateLimit) Interval() time.Duration {
+	return l.Window / time.Duration(l.Requests)
+}
+
+// Limiter is a token bucket holding limit.Requests tokens, where each token
+// is returned one window after it was taken. Unlike a bucket refilled at a
+// constant rate, it never lets a burst and the refill that follows exceed
+// the rolling window NVD enforces. It is safe for concurrent use.
+type Limiter struct {
+	mu   sync.Mutex
+	sent []time.Time
+	now  func() time.Time
+
+	// adaptive limiters also space requests by spacing, learned from the
+	// responses passed to Observe, and hold every request until resume
+	// after NVD asked to retry later.
+	adaptive  bool
+	spacing   time.Duration
+	last      time.Time
+	resume    time.Time
+	succeeded int
+}
+
+func NewLimiter() *Limiter {
+	return &Limiter{now: time.Now}
+}
+
+// NewAdaptiveLimiter returns a Limiter that also learns how fast NVD actually
+// serves requests, which is often below the published limit. Each throttled
+// response doubles the spacing between requests, starting from the average
+// interval of the limit, and each window of requests served without being
+// throttled narrows it by a tenth, so that the spacing converges on the
+// fastest pace NVD sustains.
+func NewAdaptiveLimiter() *Limiter {
+	return &Limiter{now: time.Now, adaptive: true}
+}
+
+// Wait blocks until another request fits in limit or ctx is done.
+func (l *Limiter) Wait(ctx context.Context, limit RateLimit) error {
+	for {
+		delay := l.take(limit)
+		if delay <= 0 {
+			return nil
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// take takes a token if one is available, otherwise it returns the delay
+// until the oldest token is returned.
+func (l *Limiter) take(limit RateLimit) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	if l.adaptive {
+		if now.Before(l.resume) {
+			return l.resume.Sub(now)
+		}
+		if next := l.last.Add(l.spacing); now.Before(next) {
+			return next.Sub(now)
+		}
+	}
+
+	expired := 0
+	for expired < len(l.sent) && !l.sent[expired].Add(limit.Window).After(now) {
+		expired++
+	}
+	l.sent = l.sent[expired:]
+
+	if len(l.sent) < limit.Requests {
+		l.sent = append(l.sent, now)
+		l.last = now
+		return 0
+	}
+	return l.sent[0].Add(limit.Window).Sub(now)
+}
+
+// Usage returns the requests taken within the rolling window of limit, and
+// when the oldest of them leaves it, freeing a token. The time is zero when
+// no request was taken within the window.
+func (l *Limiter) Usage(limit RateLimit) (int, time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	sent := 0
+	var oldest time.Time
+	for _, t := range l.sent {
+		if t.Add(limit.Window).After(now) {
+			if sent == 0 {
+				oldest = t
+			}
+			sent++
+		}
+	}
+	if sent == 0 {
+		return 0, time.Time{}
+	}
+	return sent, oldest.Add(limit.Window)
+}
+
+// Observe adapts the spacing of an adaptive limiter to the outcome of a
+// request sent within limit, err being nil when NVD served it. Errors other
+// than a RateLimitError tell nothing about the pace and are ignored.
+func (l *Limiter) Observe(limit RateLimit, err error) {
+	if !l.adaptive {
+		return
+	}
+	var rateLimitErr *RateLimitError
+	throttled := errors.As(err, &rateLimitErr)
+	if err != nil && !throttled {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if throttled {
+		l.succeeded = 0
+		l.spacing = min(max(2*l.spacing, limit.Interval()), limit.Window)
+		if resume := l.now().Add(rateLimitErr.RetryAfter); resume.After(l.resume) {
+			l.resume = resume
+		}
+		return
+	}
+
+	if l.succeeded++; l.succeeded < limit.Requests {
+		return
+	}
+	l.succeeded = 0
+	l.spacing -= l.spacing / 10
+	if l.spacing < limit.Interval()/10 {
+		l.spacing = 0
+	}
+}
+
+// Spacing returns the delay an adaptive limiter currently keeps between two
+// requests, zero while NVD hasn't throttled any.
+func (l *Limiter) Spacing() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.spacing
+}
@@ -0,0 +1,127 @@
+package client
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLimiter_take(t *testing.T) {
+	t.Parallel()
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	w := &Limiter{now: func() time.Time { return now }}
+	limit := RateLimit{Requests: 5, Window: 30 * time.Second}
+
+	for i := 0; i < 5; i++ {
+		assert.Zero(t, w.take(limit), "Expected request %d to fit in the window", i)
+		now = now.Add(time.Second)
+	}
+	assert.Equal(t, 25*time.Second, w.take(limit), "Expected to wait for the first request to leave the window")
+
+	now = now.Add(25 * time.Second)
+	assert.Zero(t, w.take(limit))
+	assert.Equal(t, time.Second, w.take(limit))
+
+	// Keyed clients get ten times the quota
+	keyed := &Limiter{now: func() time.Time { return now }}
+	for i := 0; i < 50; i++ {
+		require.Zero(t, keyed.take(KeyedRateLimit))
+	}
+	assert.Equal(t, 30*time.Second, keyed.take(KeyedRateLimit))
+}
+
+func TestLimiter_wait(t *testing.T) {
+	t.Parallel()
+	w := &Limiter{now: time.Now}
+	limit := RateLimit{Requests: 3, Window: 100 * time.Millisecond}
+
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, w.Wait(context.Background(), limit))
+		}()
+	}
+	wg.Wait()
+	assert.GreaterOrEqual(t, time.Since(start), limit.Window, "Expected the second half of the requests to wait for the window")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	for i := 0; i < 3; i++ {
+		w.take(limit)
+	}
+	assert.ErrorIs(t, w.Wait(ctx, limit), context.Canceled)
+}
+
+func TestLimiter_Adaptive(t *testing.T) {
+	t.Parallel()
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	l := NewAdaptiveLimiter()
+	l.now = func() time.Time { return now }
+	limit := RateLimit{Requests: 10, Window: 10 * time.Second}
+
+	// Until NVD throttles, only the rolling window applies
+	assert.Zero(t, l.take(limit))
+	assert.Zero(t, l.take(limit))
+
+	l.Observe(limit, &RateLimitError{StatusCode: 403, RetryAfter: 5 * time.Second})
+	assert.Equal(t, time.Second, l.Spacing(), "Expected the spacing to start from the interval of the limit")
+	assert.Equal(t, 5*time.Second, l.take(limit), "Expected to hold requests until the requested retry")
+
+	now = now.Add(5 * time.Second)
+	assert.Zero(t, l.take(limit))
+	assert.Equal(t, time.Second, l.take(limit))
+
+	l.Observe(limit, &RateLimitError{StatusCode: 429})
+	l.Observe(limit, &RateLimitError{StatusCode: 429})
+	assert.Equal(t, 4*time.Second, l.Spacing())
+	for range 5 {
+		l.Observe(limit, &RateLimitError{StatusCode: 429})
+	}
+	assert.Equal(t, limit.Window, l.Spacing(), "Expected the spacing to be capped by the window")
+
+	// Errors unrelated to the rate limit don't move the spacing
+	l.Observe(limit, ErrServiceUnavailable)
+	assert.Equal(t, limit.Window, l.Spacing())
+
+	// Each window of served requests narrows the spacing by a tenth
+	for range limit.Requests {
+		l.Observe(limit, nil)
+	}
+	assert.Equal(t, 9*time.Second, l.Spacing())
+	for range 43 * limit.Requests {
+		l.Observe(limit, nil)
+	}
+	assert.Zero(t, l.Spacing(), "Expected a spacing below a tenth of the interval to be dropped")
+
+	// Limiters that aren't adaptive ignore the responses
+	fixed := &Limiter{now: func() time.Time { return now }}
+	fixed.Observe(limit, &RateLimitError{StatusCode: 429, RetryAfter: time.Minute})
+	assert.Zero(t, fixed.Spacing())
+	assert.Zero(t, fixed.take(limit))
+}
+
+func TestLimiter_Usage(t *testing.T) {
+	t.Parallel()
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	w := &Limiter{now: func() time.Time { return now }}
+	limit := RateLimit{Requests: 5, Window: 30 * time.Second}
+
+	sent, reset := w.Usage(limit)
+	assert.Zero(t, sent)
+	assert.True(t, reset.IsZero())
+
+	for i := 0; i < 3; i++ {
+		require.Zero(t, w.take(limit))
+		now = now.Add(10 * time.Second)
+	}
+	sent, reset = w.Usage(limit)
+	assert.Equal(t, 2, sent, "Expected the first request to have left the window")
+	assert.Equal(t, now.Add(10*time.Second), reset)
+}
@@ -0,0 +1,81 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/kptm-tools/vulnerability-analysis/nvd/schema"
+)
+
+// DefaultSourceURL is the NVD Source API endpoint.
+const DefaultSourceURL = "https://services.nvd.nist.gov/rest/json/source/2.0"
+
+// MaxSourcesPerPage is the largest page the Source API returns.
+const MaxSourcesPerPage = 1000
+
+// sourceURL returns the source endpoint next to the CVE API at baseURL, e.g.
+// of a mirror serving both.
+func sourceURL(baseURL string) string {
+	if base, ok := strings.CutSuffix(baseURL, "/cves/2.0"); ok {
+		return base + "/source/2.0"
+	}
+	return strings.TrimSuffix(baseURL, "/") + "/source/2.0"
+}
+
+// FetchSources issues a single Source API request, e.g. with
+// sourceIdentifier.
+func (c *Client) FetchSources(ctx context.Context, query url.Values) (*schema.SourceResponse, error) {
+	endpoint := c.SourceURL
+	if endpoint == "" {
+		endpoint = sourceURL(c.BaseURL)
+	}
+	var resp schema.SourceResponse
+	if err := c.do(ctx, endpoint, query, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// FetchAllSources follows startIndex until every source of query has been
+// fetched and merges the pages. An empty query fetches every source, a few
+// pages at most.
+func (c *Client) FetchAllSources(ctx context.Context, query url.Values) (*schema.SourceResponse, error) {
+	query = cloneQuery(query)
+
+	merged, err := c.FetchSources(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	for next := merged.StartIndex + len(merged.Sources); next < merged.TotalResults; {
+		query.Set("startIndex", strconv.Itoa(next))
+		page, err := c.FetchSources(ctx, query)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch NVD sources page at index %d: %w", next, err)
+		}
+		if len(page.Sources) == 0 {
+			break
+		}
+		merged.Sources = append(merged.Sources, page.Sources...)
+		next += len(page.Sources)
+	}
+
+	merged.StartIndex = 0
+	merged.ResultsPerPage = len(merged.Sources)
+	return merged, nil
+}
+
+// SourceOf returns the source known by identifier, e.g. the
+// sourceIdentifier of a CVE, or nil when NVD knows none.
+func (c *Client) SourceOf(ctx context.Context, identifier string) (*schema.Source, error) {
+	resp, err := c.FetchSources(ctx, url.Values{"sourceIdentifier": {identifier}})
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Sources) == 0 {
+		return nil, nil
+	}
+	return &resp.Sources[0], nil
+}
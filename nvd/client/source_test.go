@@ -0,0 +1,65 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/kptm-tools/vulnerability-analysis/nvd/schema"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClient_FetchAllSources(t *testing.T) {
+	t.Parallel()
+	sources := []schema.Source{
+		{Name: "MITRE", ContactEmail: "cve@mitre.org", SourceIdentifiers: []string{"cve@mitre.org", "8254265b-2729-46b6-b9e3-3dfca2d5bfca"}},
+		{Name: "GitHub, Inc.", ContactEmail: "security-advisories@github.com", SourceIdentifiers: []string{"security-advisories@github.com"}},
+		{Name: "Red Hat, Inc.", ContactEmail: "secalert@redhat.com", SourceIdentifiers: []string{"secalert@redhat.com"}},
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/rest/json/source/2.0" {
+			http.NotFound(w, r)
+			return
+		}
+		page := sources
+		if id := r.URL.Query().Get("sourceIdentifier"); id != "" {
+			page = nil
+			for _, s := range sources {
+				for _, sid := range s.SourceIdentifiers {
+					if sid == id {
+						page = append(page, s)
+					}
+				}
+			}
+		}
+		start, _ := strconv.Atoi(r.URL.Query().Get("startIndex"))
+		end := min(start+2, len(page))
+		json.NewEncoder(w).Encode(schema.SourceResponse{
+			StartIndex:     start,
+			ResultsPerPage: end - start,
+			TotalResults:   len(page),
+			Sources:        page[start:end],
+		})
+	}))
+	defer server.Close()
+
+	c := New(server.URL+"/rest/json/cves/2.0", "")
+	assert.Equal(t, server.URL+"/rest/json/source/2.0", c.SourceURL)
+
+	resp, err := c.FetchAllSources(context.Background(), nil)
+	require.NoError(t, err)
+	require.Len(t, resp.Sources, 3, "Expected the pages to be merged")
+
+	source, err := c.SourceOf(context.Background(), "8254265b-2729-46b6-b9e3-3dfca2d5bfca")
+	require.NoError(t, err)
+	require.NotNil(t, source)
+	assert.Equal(t, "MITRE", source.Name)
+
+	source, err = c.SourceOf(context.Background(), "unknown@example.com")
+	require.NoError(t, err)
+	assert.Nil(t, source)
+}
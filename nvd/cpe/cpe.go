@@ -0,0 +1,189 @@
+// Package cpe validates and normalizes CPE names for the NVD API.
+package cpe
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var ErrInvalid = errors.New("invalid CPE name")
+
+// Reasons a CPE name is rejected, each an ErrInvalid.
+var (
+	ErrBadPrefix      = fmt.Errorf("%w: bad prefix", ErrInvalid)
+	ErrTooShort       = fmt.Errorf("%w: too short", ErrInvalid)
+	ErrMissingVersion = fmt.Errorf("%w: missing version", ErrInvalid)
+)
+
+// Rejection reasons returned by Reason.
+const (
+	ReasonBadPrefix      = "bad_prefix"
+	ReasonTooShort       = "too_short"
+	ReasonMissingVersion = "missing_version"
+	ReasonMalformed      = "malformed"
+)
+
+// Reason returns the reason err of Standardize or Validate rejects a CPE,
+// e.g. missing_version, or malformed for other errors.
+func Reason(err error) string {
+	switch {
+	case errors.Is(err, ErrBadPrefix):
+		return ReasonBadPrefix
+	case errors.Is(err, ErrTooShort):
+		return ReasonTooShort
+	case errors.Is(err, ErrMissingVersion):
+		return ReasonMissingVersion
+	}
+	return ReasonMalformed
+}
+
+// Validate checks that name is a CPE 2.3 formatted string binding with a
+// part, vendor, product and version, as the NVD cpeName parameter expects.
+func Validate(name string) error {
+	parts := strings.Split(name, ":")
+
+	if parts[0] != "cpe" {
+		return fmt.Errorf("%w: must start with 'cpe', got '%s'", ErrBadPrefix, parts[0])
+	}
+
+	if len(parts) < 2 || parts[1] != "2.3" {
+		return fmt.Errorf("%w: must have '2.3' as the second part (CPE Version)", ErrBadPrefix)
+	}
+
+	if len(parts) < 13 {
+		return fmt.Errorf("%w: must have 13 colon-separated parts, got %d", ErrTooShort, len(parts))
+	}
+
+	if len(parts) != 13 {
+		return fmt.Errorf("%w: must have 13 colon-separated parts, got %d", ErrInvalid, len(parts))
+	}
+
+	componentsToCheck := []struct {
+		index int
+		name  string
+	}{
+		{index: 2, name: "part"},
+		{index: 3, name: "vendor"},
+		{index: 4, name: "product"},
+		{index: 5, name: "version"},
+	}
+
+	for _, comp := range componentsToCheck {
+		if parts[comp.index] != "*" {
+			continue
+		}
+		if comp.name == "version" {
+			return fmt.Errorf("%w: version component must not be '*'", ErrMissingVersion)
+		}
+		return fmt.Errorf("%w: %s component must not be '*'", ErrInvalid, comp.name)
+	}
+
+	return nil
+}
+
+// HasVersion reports whether the CPE 2.3 name has a version, neither ANY nor
+// NA, e.g. 8.2p1 but not -.
+func HasVersion(name string) bool {
+	parts := strings.Split(name, ":")
+	return len(parts) > 5 && parts[5] != "" && parts[5] != "*" && parts[5] != "-"
+}
+
+// Standardize transforms a CPE 2.2 URI, as reported by nmap, into a CPE 2.3
+// formatted string to be consumed by the NVD API.
+func Standardize(name string) (string, error) {
+	standardized, _, err := StandardizeWithTrace(name)
+	return standardized, err
+}
+
+// StandardizeWithTrace behaves like Standardize and also returns a
+// human-readable description of every transformation applied to the input.
+func StandardizeWithTrace(cpe string) (string, []string, error) {
+	var trace []string
+
+	if !strings.HasPrefix(cpe, "cpe:/") {
+		return "", nil, fmt.Errorf("%w: CPE does not start with 'cpe:/': %s", ErrBadPrefix, cpe)
+	}
+
+	cpeWithoutPrefix := strings.TrimPrefix(cpe, "cpe:/")
+	trace = append(trace, `stripped CPE 2.2 prefix "cpe:/"`)
+	parts := strings.Split(cpeWithoutPrefix, ":")
+
+	// We need part, vendor, product and version as minimum
+	if len(parts) == 3 {
+		return "", trace, fmt.Errorf("%w: CPE needs a version after the product: %s", ErrMissingVersion, cpe)
+	}
+	if len(parts) < 3 {
+		return "", trace, fmt.Errorf("%w: CPE needs at least part, vendor, product and version: %s", ErrTooShort, cpe)
+	}
+
+	// Remove leading slash from 'part' component if present
+	if strings.HasPrefix(parts[0], "/") {
+		parts[0] = strings.TrimPrefix(parts[0], "/")
+		trace = append(trace, "removed leading slash from part")
+	}
+
+	// NVD dictionary vendors are always lowercase
+	if vendor := strings.ToLower(parts[1]); vendor != parts[1] {
+		trace = append(trace, fmt.Sprintf("lowercased vendor %q to %q", parts[1], vendor))
+		parts[1] = vendor
+	}
+
+	// Pad with "*" to reach 11 components after "cpe" and "2.3"
+	paddingNeeded := 11 - len(parts)
+	if paddingNeeded > 0 {
+		for i := 0; i < paddingNeeded; i++ {
+			parts = append(parts, "*")
+		}
+		trace = append(trace, fmt.Sprintf(`padded %d fields with "*"`, paddingNeeded))
+	} else if paddingNeeded < 0 {
+		parts = parts[:11]
+		trace = append(trace, fmt.Sprintf("truncated %d extra fields", -paddingNeeded))
+	}
+
+	standardizedCPE := "cpe:2.3:" + strings.Join(parts, ":")
+	trace = append(trace, `added CPE 2.3 prefix "cpe:2.3:"`)
+	return standardizedCPE, trace, nil
+}
+
+// CompareVersions compares dotted versions segment by segment, numerically
+// when both segments are numbers, and returns -1, 0 or 1 like strings.Compare.
+// Dashes and underscores separate segments too, e.g. 1.0-rc1 < 1.0-rc2.
+func CompareVersions(a, b string) int {
+	split := func(v string) []string {
+		return strings.FieldsFunc(strings.ToLower(v), func(r rune) bool { return r == '.' || r == '-' || r == '_' })
+	}
+	as, bs := split(a), split(b)
+
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		var x, y string
+		if i < len(as) {
+			x = as[i]
+		}
+		if i < len(bs) {
+			y = bs[i]
+		}
+
+		xn, xErr := strconv.Atoi(x)
+		yn, yErr := strconv.Atoi(y)
+		switch {
+		case xErr == nil && yErr == nil:
+			if xn != yn {
+				if xn < yn {
+					return -1
+				}
+				return 1
+			}
+		case x == "":
+			return -1
+		case y == "":
+			return 1
+		default:
+			if c := strings.Compare(x, y); c != 0 {
+				return c
+			}
+		}
+	}
+	return 0
+}
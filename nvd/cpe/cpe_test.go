@@ -0,0 +1,88 @@
+package cpe
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStandardize(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		name    string
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{"Application with version", "cpe:/a:OpenBSD:openssh:8.2p1", "cpe:2.3:a:openbsd:openssh:8.2p1:*:*:*:*:*:*:*", false},
+		{"Operating system with update", "cpe:/o:microsoft:windows_10:1607:sp1", "cpe:2.3:o:microsoft:windows_10:1607:sp1:*:*:*:*:*:*", false},
+		{"Missing version", "cpe:/a:apache:http_server", "", true},
+		{"Not a CPE 2.2 URI", "cpe:2.3:a:apache:http_server:2.4.1:*:*:*:*:*:*:*", "", true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := Standardize(tc.input)
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, got)
+			assert.NoError(t, Validate(got))
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	t.Parallel()
+	assert.NoError(t, Validate("cpe:2.3:a:apache:http_server:2.4.1:*:*:*:*:*:*:*"))
+	assert.ErrorIs(t, Validate("cpe:2.3:a:apache:http_server:*:*:*:*:*:*:*:*"), ErrInvalid)
+	assert.ErrorIs(t, Validate("cpe:2.2:a:apache:http_server:2.4.1:*:*:*:*:*:*:*"), ErrInvalid)
+	assert.ErrorIs(t, Validate("cpe:/a:apache:http_server:2.4.1"), ErrInvalid)
+}
+
+func TestHasVersion(t *testing.T) {
+	t.Parallel()
+	assert.True(t, HasVersion("cpe:2.3:a:openbsd:openssh:8.2p1:*:*:*:*:*:*:*"))
+	assert.False(t, HasVersion("cpe:2.3:o:linux:linux_kernel:-:*:*:*:*:*:*:*"))
+	assert.False(t, HasVersion("cpe:2.3:a:apache:http_server:*:*:*:*:*:*:*:*"))
+	assert.False(t, HasVersion("cpe:2.3:a:apache"))
+}
+
+func TestReason(t *testing.T) {
+	t.Parallel()
+	standardize := func(name string) error {
+		_, err := Standardize(name)
+		return err
+	}
+
+	assert.Equal(t, ReasonBadPrefix, Reason(standardize("a:apache:http_server:2.4.1")))
+	assert.Equal(t, ReasonMissingVersion, Reason(standardize("cpe:/a:apache:http_server")))
+	assert.Equal(t, ReasonTooShort, Reason(standardize("cpe:/a:apache")))
+	assert.Equal(t, ReasonBadPrefix, Reason(Validate("cpe:2.2:a:apache:http_server:2.4.1:*:*:*:*:*:*:*")))
+	assert.Equal(t, ReasonTooShort, Reason(Validate("cpe:2.3:a:apache:http_server:2.4.1")))
+	assert.Equal(t, ReasonMissingVersion, Reason(Validate("cpe:2.3:a:apache:http_server:*:*:*:*:*:*:*:*")))
+	assert.Equal(t, ReasonMalformed, Reason(Validate("cpe:2.3:a:*:http_server:2.4.1:*:*:*:*:*:*:*")))
+	assert.ErrorIs(t, standardize("cpe:/a:apache"), ErrInvalid)
+}
+
+func TestCompareVersions(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		a, b string
+		want int
+	}{
+		{"2.4.49", "2.4.49", 0},
+		{"2.4.9", "2.4.49", -1},
+		{"2.10", "2.9", 1},
+		{"1.0", "1.0.1", -1},
+		{"1.0-rc1", "1.0-rc2", -1},
+	}
+
+	for _, tc := range testCases {
+		assert.Equal(t, tc.want, CompareVersions(tc.a, tc.b), "%s vs %s", tc.a, tc.b)
+	}
+}
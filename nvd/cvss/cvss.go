@@ -0,0 +1,167 @@
+// Package cvss selects and completes the CVSS metrics of NVD CVE records.
+package cvss
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/kptm-tools/vulnerability-analysis/nvd/schema"
+)
+
+// Version is a version of the CVSS metrics published by NVD.
+type Version string
+
+const (
+	Version40 Version = "4.0"
+	Version31 Version = "3.1"
+	Version30 Version = "3.0"
+	Version2  Version = "2.0"
+)
+
+// DefaultOrder is the order in which the CVSS versions of a CVE are
+// preferred unless configured otherwise. CVSS v4.0 is left out of it.
+var DefaultOrder = []Version{Version31, Version30, Version2}
+
+// Preference is the order in which the metrics of each CVSS version are
+// used to score a CVE, the first version a CVE has metrics of wins. The zero
+// value prefers the versions of DefaultOrder.
+type Preference struct {
+	Default []Version
+	Tenants map[string][]Version
+}
+
+// Order returns the CVSS version order of a tenant.
+func (p Preference) Order(tenantID string) []Version {
+	if order, ok := p.Tenants[tenantID]; ok {
+		return order
+	}
+	if len(p.Default) == 0 {
+		return DefaultOrder
+	}
+	return p.Default
+}
+
+// ParsePreference parses semicolon separated orders of comma separated CVSS
+// versions, the ones prefixed with `tenant=` applying to that tenant only,
+// e.g. "3.1,3.0,2.0;acme=4.0,3.1,3.0,2.0".
+func ParsePreference(spec string) (Preference, error) {
+	var pref Preference
+	for _, entry := range strings.Split(spec, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		tenantID, versions, scoped := strings.Cut(entry, "=")
+		if !scoped {
+			versions = entry
+		}
+		order, err := parseOrder(versions)
+		if err != nil {
+			return Preference{}, fmt.Errorf("invalid CVSS version order '%s': %w", entry, err)
+		}
+
+		if !scoped {
+			pref.Default = order
+			continue
+		}
+		if pref.Tenants == nil {
+			pref.Tenants = make(map[string][]Version)
+		}
+		pref.Tenants[strings.TrimSpace(tenantID)] = order
+	}
+	return pref, nil
+}
+
+func parseOrder(s string) ([]Version, error) {
+	var order []Version
+	for _, field := range strings.Split(s, ",") {
+		version := Version(strings.TrimPrefix(strings.ToLower(strings.TrimSpace(field)), "v"))
+		// Accept the major version alone for v2
+		if version == "2" {
+			version = Version2
+		}
+		switch version {
+		case Version40, Version31, Version30, Version2:
+		default:
+			return nil, fmt.Errorf("unknown CVSS version '%s'", field)
+		}
+		if slices.Contains(order, version) {
+			return nil, fmt.Errorf("CVSS version %s listed twice", version)
+		}
+		order = append(order, version)
+	}
+	return order, nil
+}
+
+// VectorIssue is a vector string Complete failed to parse, or whose metrics
+// disagree with the structured fields.
+type VectorIssue struct {
+	Vector    string
+	Conflicts []schema.Conflict
+	Err       error
+}
+
+// Complete returns a copy of metrics where the structured v3.x and v2 fields
+// NVD left blank are parsed from the vector strings, with the issues met.
+// Explicit fields win over the vector.
+func Complete(metrics *schema.Metrics) (*schema.Metrics, []VectorIssue) {
+	if metrics == nil {
+		return nil, nil
+	}
+
+	completed := &schema.Metrics{
+		CvssMetricV2:  append([]schema.CvssMetricV2(nil), metrics.CvssMetricV2...),
+		CvssMetricV30: append([]schema.CvssMetricV30(nil), metrics.CvssMetricV30...),
+		CvssMetricV31: append([]schema.CvssMetricV31(nil), metrics.CvssMetricV31...),
+		CvssMetricV40: append([]schema.CvssMetricV40(nil), metrics.CvssMetricV40...),
+	}
+	var issues []VectorIssue
+	record := func(vector string, conflicts []schema.Conflict, err error) {
+		if err != nil || len(conflicts) > 0 {
+			issues = append(issues, VectorIssue{Vector: vector, Conflicts: conflicts, Err: err})
+		}
+	}
+	for i := range completed.CvssMetricV31 {
+		conflicts, err := completed.CvssMetricV31[i].CvssData.CompleteFromVector()
+		record(completed.CvssMetricV31[i].CvssData.VectorString, conflicts, err)
+	}
+	for i := range completed.CvssMetricV30 {
+		conflicts, err := completed.CvssMetricV30[i].CvssData.CompleteFromVector()
+		record(completed.CvssMetricV30[i].CvssData.VectorString, conflicts, err)
+	}
+	for i := range completed.CvssMetricV2 {
+		conflicts, err := completed.CvssMetricV2[i].CvssData.CompleteFromVector()
+		record(completed.CvssMetricV2[i].CvssData.VectorString, conflicts, err)
+	}
+	return completed, issues
+}
+
+// Prefer returns the metrics of the first version of order that metrics
+// has, alone, so that a single version scores the CVE. CVSS v4.0 metrics are
+// returned in the v3.1 structure; when their vector fails to parse, they are
+// returned with the score only, along with the error. When metrics has none
+// of the versions of order, those of DefaultOrder are tried, so a CVE isn't
+// left unscored by an order listing few versions. It returns nil when
+// metrics has none of either.
+func Prefer(metrics *schema.Metrics, order []Version) (*schema.Metrics, error) {
+	if metrics == nil {
+		return nil, nil
+	}
+	for _, version := range slices.Concat(order, DefaultOrder) {
+		switch {
+		case version == Version40 && len(metrics.CvssMetricV40) > 0:
+			v40 := metrics.CvssMetricV40[0]
+			data, err := v40.CvssData.AsV31()
+			return &schema.Metrics{CvssMetricV31: []schema.CvssMetricV31{{Source: v40.Source, Type: v40.Type, CvssData: data}}}, err
+		case version == Version31 && len(metrics.CvssMetricV31) > 0:
+			return &schema.Metrics{CvssMetricV31: metrics.CvssMetricV31}, nil
+		case version == Version30 && len(metrics.CvssMetricV30) > 0:
+			return &schema.Metrics{CvssMetricV30: metrics.CvssMetricV30}, nil
+		case version == Version2 && len(metrics.CvssMetricV2) > 0:
+			return &schema.Metrics{CvssMetricV2: metrics.CvssMetricV2}, nil
+		}
+	}
+	return nil, nil
+}
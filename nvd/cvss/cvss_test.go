@@ -0,0 +1,89 @@
+package cvss
+
+import (
+	"testing"
+
+	"github.com/kptm-tools/vulnerability-analysis/nvd/schema"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePreference(t *testing.T) {
+	t.Parallel()
+	pref, err := ParsePreference("3.0,v3.1,2; acme=4.0,3.1")
+	require.NoError(t, err)
+
+	assert.Equal(t, []Version{Version30, Version31, Version2}, pref.Order("other"))
+	assert.Equal(t, []Version{Version40, Version31}, pref.Order("acme"))
+	assert.Equal(t, DefaultOrder, Preference{}.Order("acme"))
+
+	for _, spec := range []string{"3.1,5.0", "3.1,3.1", "acme=", "3.1;acme=2.0,x"} {
+		_, err := ParsePreference(spec)
+		assert.Error(t, err, spec)
+	}
+}
+
+func TestComplete(t *testing.T) {
+	t.Parallel()
+	metrics := &schema.Metrics{
+		CvssMetricV31: []schema.CvssMetricV31{{CvssData: schema.CvssDataV31{
+			VectorString: "CVSS:3.1/AV:N/AC:L/PR:N/UI:N/S:U/C:H/I:H/A:N",
+			AttackVector: schema.AttackVectorTypeLocal,
+		}}},
+		CvssMetricV2: []schema.CvssMetricV2{{CvssData: schema.CvssDataV2{VectorString: "AV:X"}}},
+	}
+
+	completed, issues := Complete(metrics)
+	require.Len(t, completed.CvssMetricV31, 1)
+	assert.Equal(t, schema.AttackComplexityTypeLow, completed.CvssMetricV31[0].CvssData.AttackComplexity)
+	assert.Equal(t, schema.AttackVectorTypeLocal, completed.CvssMetricV31[0].CvssData.AttackVector, "Expected the structured value to win")
+	assert.Empty(t, metrics.CvssMetricV31[0].CvssData.AttackComplexity, "Expected the metrics to be copied")
+
+	require.Len(t, issues, 2)
+	assert.Equal(t, []schema.Conflict{{Metric: "AV", Structured: "LOCAL", Vector: "NETWORK"}}, issues[0].Conflicts)
+	assert.ErrorIs(t, issues[1].Err, schema.ErrInvalidVector)
+
+	completed, issues = Complete(nil)
+	assert.Nil(t, completed)
+	assert.Empty(t, issues)
+}
+
+func TestPrefer(t *testing.T) {
+	t.Parallel()
+	metrics := &schema.Metrics{
+		CvssMetricV31: []schema.CvssMetricV31{{CvssData: schema.CvssDataV31{BaseScore: 7.5}}},
+		CvssMetricV2:  []schema.CvssMetricV2{{CvssData: schema.CvssDataV2{BaseScore: 5.0}}},
+		CvssMetricV40: []schema.CvssMetricV40{{CvssData: schema.CvssDataV40{
+			VectorString: "CVSS:4.0/AV:L/AC:L/AT:N/PR:L/UI:N/VC:H/VI:H/VA:H/SC:N/SI:N/SA:N",
+			BaseScore:    9.3,
+		}}},
+	}
+
+	preferred, err := Prefer(metrics, DefaultOrder)
+	require.NoError(t, err)
+	assert.Equal(t, metrics.CvssMetricV31, preferred.CvssMetricV31)
+	assert.Empty(t, preferred.CvssMetricV2)
+
+	preferred, err = Prefer(metrics, []Version{Version2, Version31})
+	require.NoError(t, err)
+	assert.Equal(t, metrics.CvssMetricV2, preferred.CvssMetricV2)
+
+	preferred, err = Prefer(metrics, []Version{Version40})
+	require.NoError(t, err)
+	require.Len(t, preferred.CvssMetricV31, 1)
+	assert.Equal(t, 9.3, preferred.CvssMetricV31[0].CvssData.BaseScore)
+	assert.Equal(t, schema.AttackVectorTypeLocal, preferred.CvssMetricV31[0].CvssData.AttackVector)
+
+	metrics.CvssMetricV40[0].CvssData.VectorString = "CVSS:4.0/AV:X"
+	preferred, err = Prefer(metrics, []Version{Version40})
+	assert.ErrorIs(t, err, schema.ErrInvalidVector)
+	assert.Equal(t, 9.3, preferred.CvssMetricV31[0].CvssData.BaseScore, "Expected the score to be kept")
+
+	preferred, err = Prefer(metrics, []Version{Version30})
+	require.NoError(t, err)
+	assert.Equal(t, metrics.CvssMetricV31, preferred.CvssMetricV31, "Expected a fallback to the default order")
+
+	preferred, err = Prefer(&schema.Metrics{CvssMetricV40: metrics.CvssMetricV40}, []Version{Version30})
+	require.NoError(t, err)
+	assert.Nil(t, preferred)
+}
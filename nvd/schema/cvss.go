@@ -1,4 +1,4 @@
-package dto
+package schema
 
 // CVSS V2.0 enums for schemas
 
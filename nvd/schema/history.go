@@ -0,0 +1,59 @@
+package schema
+
+import "strings"
+
+// CveHistoryResponse is a page of the CVE Change History API 2.0.
+type CveHistoryResponse struct {
+	ResultsPerPage int             `json:"resultsPerPage"`
+	StartIndex     int             `json:"startIndex"`
+	TotalResults   int             `json:"totalResults"`
+	Format         string          `json:"format"`
+	Version        string          `json:"version"`
+	Timestamp      string          `json:"timestamp"`
+	CveChanges     []CveChangeItem `json:"cveChanges"`
+}
+
+type CveChangeItem struct {
+	Change CveChange `json:"change"`
+}
+
+// CveChange is an event of the history of a CVE, e.g. a reanalysis by NVD,
+// with the details of what it changed.
+type CveChange struct {
+	CveID            string         `json:"cveId"`
+	EventName        string         `json:"eventName"`
+	CveChangeID      string         `json:"cveChangeId"`
+	SourceIdentifier string         `json:"sourceIdentifier"`
+	Created          string         `json:"created"`
+	Details          []ChangeDetail `json:"details,omitempty"`
+}
+
+// ChangeDetail is an addition, removal or change of a field of the CVE, e.g.
+// of type "CVSS V3.1".
+type ChangeDetail struct {
+	Action   string `json:"action"`
+	Type     string `json:"type"`
+	OldValue string `json:"oldValue,omitempty"`
+	NewValue string `json:"newValue,omitempty"`
+}
+
+// ScoreChanged reports whether the change adds, removes or changes a CVSS
+// metric of the CVE.
+func (c CveChange) ScoreChanged() bool {
+	for _, d := range c.Details {
+		if strings.HasPrefix(strings.ToUpper(d.Type), "CVSS") {
+			return true
+		}
+	}
+	return false
+}
+
+// StatusChanged reports whether the change moves the CVE to another status,
+// e.g. when NVD analyzes it or its CNA rejects it.
+func (c CveChange) StatusChanged() bool {
+	switch c.EventName {
+	case "Initial Analysis", "Reanalysis", "Modified Analysis", "CVE Rejected", "CVE Unrejected":
+		return true
+	}
+	return false
+}
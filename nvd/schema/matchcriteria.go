@@ -0,0 +1,46 @@
+package schema
+
+import "strings"
+
+// MatchCriteriaResponse is a page of the Match Criteria API 2.0.
+type MatchCriteriaResponse struct {
+	ResultsPerPage int               `json:"resultsPerPage"`
+	StartIndex     int               `json:"startIndex"`
+	TotalResults   int               `json:"totalResults"`
+	Format         string            `json:"format"`
+	Version        string            `json:"version"`
+	Timestamp      string            `json:"timestamp"`
+	MatchStrings   []MatchStringItem `json:"matchStrings"`
+}
+
+type MatchStringItem struct {
+	MatchString MatchString `json:"matchString"`
+}
+
+// MatchString is the expansion of the match criteria of a CVE configuration,
+// identified by the matchCriteriaId of its CpeMatch, into the CPE names of
+// the dictionary within its version range.
+type MatchString struct {
+	MatchCriteriaID       string       `json:"matchCriteriaId"`
+	Criteria              string       `json:"criteria"`
+	VersionStartExcluding *string      `json:"versionStartExcluding,omitempty"`
+	VersionStartIncluding *string      `json:"versionStartIncluding,omitempty"`
+	VersionEndExcluding   *string      `json:"versionEndExcluding,omitempty"`
+	VersionEndIncluding   *string      `json:"versionEndIncluding,omitempty"`
+	LastModified          string       `json:"lastModified"`
+	CpeLastModified       string       `json:"cpeLastModified,omitempty"`
+	Created               string       `json:"created"`
+	Status                string       `json:"status"`
+	Matches               []CpeNameRef `json:"matches,omitempty"`
+}
+
+// Covers reports whether cpeName is among the CPE names the criteria expand
+// to, ignoring case.
+func (m MatchString) Covers(cpeName string) bool {
+	for _, match := range m.Matches {
+		if strings.EqualFold(match.CpeName, cpeName) {
+			return true
+		}
+	}
+	return false
+}
@@ -1,4 +1,6 @@
-package dto
+// Package schema holds the types of the NVD CVE API 2.0 responses and the
+// CVSS enumerations they use.
+package schema
 
 type NvdAPIResponse struct {
 	ResultsPerPage  int             `json:"resultsPerPage"`
@@ -49,6 +51,7 @@ type Metrics struct {
 	CvssMetricV2  []CvssMetricV2  `json:"cvssMetricV2,omitempty"`
 	CvssMetricV30 []CvssMetricV30 `json:"cvssMetricV30,omitempty"`
 	CvssMetricV31 []CvssMetricV31 `json:"cvssMetricV31,omitempty"`
+	CvssMetricV40 []CvssMetricV40 `json:"cvssMetricV40,omitempty"`
 }
 
 type CvssMetricV2 struct {
@@ -132,6 +135,21 @@ type CvssDataV30 struct {
 	EnvironmentalSeverity         *SeverityType                   `json:"environmentalSeverity,omitempty"`
 }
 
+// CvssMetricV40 keeps the base score and vector of CVSS v4.0 scores, which
+// the enrichment only uses when preferred over the older versions.
+type CvssMetricV40 struct {
+	Source   string      `json:"source"`
+	Type     string      `json:"type"`
+	CvssData CvssDataV40 `json:"cvssData"`
+}
+
+type CvssDataV40 struct {
+	Version      string       `json:"version"`
+	VectorString string       `json:"vectorString"`
+	BaseScore    float64      `json:"baseScore"`
+	BaseSeverity SeverityType `json:"baseSeverity"`
+}
+
 type CvssMetricV31 struct {
 	Source              string      `json:"source"`
 	Type                string      `json:"type"`
@@ -205,6 +223,12 @@ type CpeMatch struct {
 	VersionEndIncluding   *string `json:"versionEndIncluding,omitempty"`
 }
 
+// Ranged reports whether the criteria bound the versions they match.
+func (m CpeMatch) Ranged() bool {
+	return m.VersionStartExcluding != nil || m.VersionStartIncluding != nil ||
+		m.VersionEndExcluding != nil || m.VersionEndIncluding != nil
+}
+
 type Reference struct {
 	URL    string   `json:"url"`
 	Source string   `json:"source"`
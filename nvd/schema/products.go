@@ -0,0 +1,57 @@
+package schema
+
+// CpeProductsResponse is a page of the Products (CPE) API 2.0.
+type CpeProductsResponse struct {
+	ResultsPerPage int          `json:"resultsPerPage"`
+	StartIndex     int          `json:"startIndex"`
+	TotalResults   int          `json:"totalResults"`
+	Format         string       `json:"format"`
+	Version        string       `json:"version"`
+	Timestamp      string       `json:"timestamp"`
+	Products       []CpeProduct `json:"products"`
+}
+
+type CpeProduct struct {
+	Cpe CpeItem `json:"cpe"`
+}
+
+// CpeItem is an entry of the CPE dictionary. Deprecated entries name the
+// ones replacing them in DeprecatedBy.
+type CpeItem struct {
+	CpeName      string       `json:"cpeName"`
+	CpeNameID    string       `json:"cpeNameId"`
+	Deprecated   bool         `json:"deprecated"`
+	Created      string       `json:"created"`
+	LastModified string       `json:"lastModified"`
+	Titles       []CpeTitle   `json:"titles,omitempty"`
+	Refs         []CpeRef     `json:"refs,omitempty"`
+	DeprecatedBy []CpeNameRef `json:"deprecatedBy,omitempty"`
+}
+
+type CpeTitle struct {
+	Title string `json:"title"`
+	Lang  string `json:"lang"`
+}
+
+type CpeRef struct {
+	Ref  string `json:"ref"`
+	Type string `json:"type,omitempty"`
+}
+
+type CpeNameRef struct {
+	CpeName   string `json:"cpeName"`
+	CpeNameID string `json:"cpeNameId"`
+}
+
+// Title returns the English title of the entry, or its first one.
+func (c CpeItem) Title() string {
+	for _, t := range c.Titles {
+		if t.Lang == "en" {
+			return t.Title
+		}
+	}
+	if len(c.Titles) > 0 {
+		return c.Titles[0].Title
+	}
+	return ""
+}
@@ -0,0 +1,34 @@
+package schema
+
+// SourceResponse is a page of the Source API 2.0.
+type SourceResponse struct {
+	ResultsPerPage int      `json:"resultsPerPage"`
+	StartIndex     int      `json:"startIndex"`
+	TotalResults   int      `json:"totalResults"`
+	Format         string   `json:"format"`
+	Version        string   `json:"version"`
+	Timestamp      string   `json:"timestamp"`
+	Sources        []Source `json:"sources"`
+}
+
+// Source is an organization publishing CVE records or metrics to NVD, such
+// as a CNA, known by the identifiers of its SourceIdentifiers, e.g. an email
+// address or a UUID.
+type Source struct {
+	Name               string           `json:"name"`
+	ContactEmail       string           `json:"contactEmail,omitempty"`
+	LastModified       string           `json:"lastModified"`
+	Created            string           `json:"created"`
+	V2AcceptanceLevel  *AcceptanceLevel `json:"v2AcceptanceLevel,omitempty"`
+	V3AcceptanceLevel  *AcceptanceLevel `json:"v3AcceptanceLevel,omitempty"`
+	V4AcceptanceLevel  *AcceptanceLevel `json:"v4AcceptanceLevel,omitempty"`
+	CweAcceptanceLevel *AcceptanceLevel `json:"cweAcceptanceLevel,omitempty"`
+	SourceIdentifiers  []string         `json:"sourceIdentifiers"`
+}
+
+// AcceptanceLevel is how far NVD accepts the data of a source without
+// reviewing it, e.g. Contributor or Reference.
+type AcceptanceLevel struct {
+	Description  string `json:"description"`
+	LastModified string `json:"lastModified"`
+}
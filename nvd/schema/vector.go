@@ -0,0 +1,219 @@
+package schema
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var ErrInvalidVector = errors.New("invalid CVSS vector string")
+
+// Conflict is a structured metric whose value disagrees with the vector
+// string of the same CVSS data. Structured values are kept on conflicts.
+type Conflict struct {
+	Metric     string // Vector abbreviation, e.g. AV
+	Structured string
+	Vector     string
+}
+
+// v3Metrics maps the base and exploit maturity metrics of CVSS v3.x vectors
+// to the values of the structured fields.
+var v3Metrics = map[string]map[string]string{
+	"AV": {"N": "NETWORK", "A": "ADJACENT_NETWORK", "L": "LOCAL", "P": "PHYSICAL"},
+	"AC": {"L": "LOW", "H": "HIGH"},
+	"PR": {"N": "NONE", "L": "LOW", "H": "HIGH"},
+	"UI": {"N": "NONE", "R": "REQUIRED"},
+	"S":  {"U": "UNCHANGED", "C": "CHANGED"},
+	"C":  {"N": "NONE", "L": "LOW", "H": "HIGH"},
+	"I":  {"N": "NONE", "L": "LOW", "H": "HIGH"},
+	"A":  {"N": "NONE", "L": "LOW", "H": "HIGH"},
+	"E":  {"X": "NOT_DEFINED", "U": "UNPROVEN", "P": "PROOF_OF_CONCEPT", "F": "FUNCTIONAL", "H": "HIGH"},
+}
+
+// v2Metrics is the CVSS v2 counterpart of v3Metrics.
+var v2Metrics = map[string]map[string]string{
+	"AV": {"N": "NETWORK", "A": "ADJACENT_NETWORK", "L": "LOCAL"},
+	"AC": {"L": "LOW", "M": "MEDIUM", "H": "HIGH"},
+	"Au": {"N": "NONE", "S": "SINGLE", "M": "MULTIPLE"},
+	"C":  {"N": "NONE", "P": "PARTIAL", "C": "COMPLETE"},
+	"I":  {"N": "NONE", "P": "PARTIAL", "C": "COMPLETE"},
+	"A":  {"N": "NONE", "P": "PARTIAL", "C": "COMPLETE"},
+	"E":  {"ND": "NOT_DEFINED", "U": "UNPROVEN", "POC": "PROOF_OF_CONCEPT", "F": "FUNCTIONAL", "H": "HIGH"},
+}
+
+// v4Metrics maps the CVSS v4.0 base metrics which have a v3 counterpart, the
+// impacts on the vulnerable system and the exploit maturity to the values
+// of the v3 structured fields.
+var v4Metrics = map[string]map[string]string{
+	"AV": {"N": "NETWORK", "A": "ADJACENT_NETWORK", "L": "LOCAL", "P": "PHYSICAL"},
+	"AC": {"L": "LOW", "H": "HIGH"},
+	"PR": {"N": "NONE", "L": "LOW", "H": "HIGH"},
+	"UI": {"N": "NONE", "P": "REQUIRED", "A": "REQUIRED"},
+	"VC": {"N": "NONE", "L": "LOW", "H": "HIGH"},
+	"VI": {"N": "NONE", "L": "LOW", "H": "HIGH"},
+	"VA": {"N": "NONE", "L": "LOW", "H": "HIGH"},
+	"E":  {"X": "NOT_DEFINED", "U": "UNPROVEN", "P": "PROOF_OF_CONCEPT", "A": "HIGH"},
+}
+
+// CompleteFromVector fills the blank base metrics and exploit code maturity
+// from VectorString, and a blank BaseSeverity from BaseScore. It returns the
+// metrics the structured fields and the vector disagree on.
+func (d *CvssDataV31) CompleteFromVector() ([]Conflict, error) {
+	if d.VectorString == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(d.VectorString, "CVSS:3.") {
+		return nil, fmt.Errorf("%w: %q is not a CVSS v3 vector", ErrInvalidVector, d.VectorString)
+	}
+	values, err := parseVector(d.VectorString[strings.Index(d.VectorString, "/")+1:], v3Metrics)
+	if err != nil {
+		return nil, err
+	}
+
+	var conflicts []Conflict
+	complete(&d.AttackVector, "AV", values, &conflicts)
+	complete(&d.AttackComplexity, "AC", values, &conflicts)
+	complete(&d.PrivilegesRequired, "PR", values, &conflicts)
+	complete(&d.UserInteraction, "UI", values, &conflicts)
+	complete(&d.Scope, "S", values, &conflicts)
+	complete(&d.ConfidentialityImpact, "C", values, &conflicts)
+	complete(&d.IntegrityImpact, "I", values, &conflicts)
+	complete(&d.AvailabilityImpact, "A", values, &conflicts)
+	completeOptional(&d.ExploitCodeMaturity, "E", values, &conflicts)
+
+	if d.BaseSeverity == "" && d.BaseScore > 0 {
+		d.BaseSeverity = v3Severity(d.BaseScore)
+	}
+	return conflicts, nil
+}
+
+// CompleteFromVector behaves like CvssDataV31.CompleteFromVector, the v3.0
+// and v3.1 vectors share their metrics.
+func (d *CvssDataV30) CompleteFromVector() ([]Conflict, error) {
+	v31 := CvssDataV31(*d)
+	conflicts, err := v31.CompleteFromVector()
+	*d = CvssDataV30(v31)
+	return conflicts, err
+}
+
+// AsV31 returns the CVSS v4.0 score in the v3.1 structure, with the base
+// metrics of VectorString having a v3 counterpart. Scope has none and is
+// left blank, as are the subscores NVD doesn't publish for v4.0.
+func (d CvssDataV40) AsV31() (CvssDataV31, error) {
+	v31 := CvssDataV31{
+		Version:      d.Version,
+		VectorString: d.VectorString,
+		BaseScore:    d.BaseScore,
+		BaseSeverity: d.BaseSeverity,
+	}
+	if d.BaseSeverity == "" && d.BaseScore > 0 {
+		v31.BaseSeverity = v3Severity(d.BaseScore)
+	}
+	if d.VectorString == "" {
+		return v31, nil
+	}
+	if !strings.HasPrefix(d.VectorString, "CVSS:4.0/") {
+		return v31, fmt.Errorf("%w: %q is not a CVSS v4.0 vector", ErrInvalidVector, d.VectorString)
+	}
+	values, err := parseVector(strings.TrimPrefix(d.VectorString, "CVSS:4.0/"), v4Metrics)
+	if err != nil {
+		return v31, err
+	}
+
+	v31.AttackVector = AttackVectorType(values["AV"])
+	v31.AttackComplexity = AttackComplexityType(values["AC"])
+	v31.PrivilegesRequired = PrivilegesRequiredType(values["PR"])
+	v31.UserInteraction = UserInteractionType(values["UI"])
+	v31.ConfidentialityImpact = CiaType(values["VC"])
+	v31.IntegrityImpact = CiaType(values["VI"])
+	v31.AvailabilityImpact = CiaType(values["VA"])
+	if maturity, ok := values["E"]; ok {
+		e := ExploitCodeMaturityType(maturity)
+		v31.ExploitCodeMaturity = &e
+	}
+	return v31, nil
+}
+
+// CompleteFromVector fills the blank base metrics and exploitability from
+// VectorString. It returns the metrics the structured fields and the vector
+// disagree on.
+func (d *CvssDataV2) CompleteFromVector() ([]Conflict, error) {
+	if d.VectorString == "" {
+		return nil, nil
+	}
+	// Some sources wrap v2 vectors in parentheses
+	values, err := parseVector(strings.Trim(d.VectorString, "()"), v2Metrics)
+	if err != nil {
+		return nil, err
+	}
+
+	var conflicts []Conflict
+	complete(&d.AccessVector, "AV", values, &conflicts)
+	complete(&d.AccessComplexity, "AC", values, &conflicts)
+	complete(&d.Authentication, "Au", values, &conflicts)
+	complete(&d.ConfidentialityImpact, "C", values, &conflicts)
+	complete(&d.IntegrityImpact, "I", values, &conflicts)
+	complete(&d.AvailabilityImpact, "A", values, &conflicts)
+	completeOptional(&d.Exploitability, "E", values, &conflicts)
+	return conflicts, nil
+}
+
+// parseVector returns the structured values of the known metrics of a
+// vector. Metrics missing from known, e.g. environmental ones, are skipped.
+func parseVector(vector string, known map[string]map[string]string) (map[string]string, error) {
+	values := make(map[string]string)
+	for _, component := range strings.Split(vector, "/") {
+		metric, value, ok := strings.Cut(component, ":")
+		if !ok {
+			return nil, fmt.Errorf("%w: malformed component %q", ErrInvalidVector, component)
+		}
+		allowed, ok := known[metric]
+		if !ok {
+			continue
+		}
+		structured, ok := allowed[value]
+		if !ok {
+			return nil, fmt.Errorf("%w: unknown value %q for %s", ErrInvalidVector, value, metric)
+		}
+		values[metric] = structured
+	}
+	return values, nil
+}
+
+func complete[T ~string](field *T, metric string, values map[string]string, conflicts *[]Conflict) {
+	value, ok := values[metric]
+	switch {
+	case !ok:
+	case *field == "":
+		*field = T(value)
+	case string(*field) != value:
+		*conflicts = append(*conflicts, Conflict{Metric: metric, Structured: string(*field), Vector: value})
+	}
+}
+
+func completeOptional[T ~string](field **T, metric string, values map[string]string, conflicts *[]Conflict) {
+	if *field != nil {
+		complete(*field, metric, values, conflicts)
+		return
+	}
+	if value, ok := values[metric]; ok {
+		v := T(value)
+		*field = &v
+	}
+}
+
+// v3Severity is the CVSS v3 qualitative severity rating of a base score.
+func v3Severity(score float64) SeverityType {
+	switch {
+	case score >= 9.0:
+		return SeverityTypeCritical
+	case score >= 7.0:
+		return SeverityTypeHigh
+	case score >= 4.0:
+		return SeverityTypeMedium
+	case score > 0:
+		return SeverityTypeLow
+	default:
+		return SeverityTypeNone
+	}
+}
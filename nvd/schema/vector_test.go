@@ -0,0 +1,98 @@
+package schema
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCvssDataV31_CompleteFromVector(t *testing.T) {
+	t.Parallel()
+	d := CvssDataV31{
+		VectorString:     "CVSS:3.1/AV:N/AC:L/PR:N/UI:R/S:C/C:H/I:L/A:N/E:P",
+		AttackComplexity: AttackComplexityTypeHigh,
+		BaseScore:        8.2,
+	}
+	conflicts, err := d.CompleteFromVector()
+	require.NoError(t, err)
+
+	assert.Equal(t, AttackVectorTypeNetwork, d.AttackVector)
+	assert.Equal(t, AttackComplexityTypeHigh, d.AttackComplexity)
+	assert.Equal(t, UserInteractionTypeRequired, d.UserInteraction)
+	assert.Equal(t, ScopeTypeChanged, d.Scope)
+	assert.Equal(t, CiaTypeLow, d.IntegrityImpact)
+	require.NotNil(t, d.ExploitCodeMaturity)
+	assert.Equal(t, ExploitCodeMaturityTypeProofOfConcept, *d.ExploitCodeMaturity)
+	assert.Equal(t, SeverityTypeHigh, d.BaseSeverity)
+	assert.Equal(t, []Conflict{{Metric: "AC", Structured: "HIGH", Vector: "LOW"}}, conflicts)
+}
+
+func TestCvssDataV30_CompleteFromVector(t *testing.T) {
+	t.Parallel()
+	d := CvssDataV30{VectorString: "CVSS:3.0/AV:L/AC:L/PR:L/UI:N/S:U/C:H/I:H/A:H"}
+	conflicts, err := d.CompleteFromVector()
+	require.NoError(t, err)
+	assert.Empty(t, conflicts)
+	assert.Equal(t, AttackVectorTypeLocal, d.AttackVector)
+	assert.Equal(t, PrivilegesRequiredTypeLow, d.PrivilegesRequired)
+	assert.Empty(t, d.BaseSeverity, "Expected no severity without a score")
+}
+
+func TestCvssDataV2_CompleteFromVector(t *testing.T) {
+	t.Parallel()
+	d := CvssDataV2{VectorString: "(AV:N/AC:M/Au:N/C:P/I:P/A:C/E:POC/RL:OF/RC:C)"}
+	conflicts, err := d.CompleteFromVector()
+	require.NoError(t, err)
+	assert.Empty(t, conflicts)
+	assert.Equal(t, AccessVectorTypeV2Network, d.AccessVector)
+	assert.Equal(t, AccessComplexityTypeV2Medium, d.AccessComplexity)
+	assert.Equal(t, AuthenticationTypeV2None, d.Authentication)
+	assert.Equal(t, CiaTypeV2Complete, d.AvailabilityImpact)
+	require.NotNil(t, d.Exploitability)
+	assert.Equal(t, ExploitabilityTypeV2ProofOfConcept, *d.Exploitability)
+}
+
+func TestCompleteFromVector_Invalid(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		name   string
+		vector string
+	}{
+		{"Not a v3 vector", "AV:N/AC:L/Au:N/C:P/I:P/A:P"},
+		{"Unknown value", "CVSS:3.1/AV:X/AC:L/PR:N/UI:N/S:U/C:H/I:H/A:H"},
+		{"Malformed component", "CVSS:3.1/AV:N/AC"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			d := CvssDataV31{VectorString: tc.vector}
+			_, err := d.CompleteFromVector()
+			assert.ErrorIs(t, err, ErrInvalidVector)
+		})
+	}
+}
+
+func TestCvssDataV40_AsV31(t *testing.T) {
+	t.Parallel()
+	d := CvssDataV40{
+		Version:      "4.0",
+		VectorString: "CVSS:4.0/AV:N/AC:L/AT:N/PR:N/UI:P/VC:H/VI:L/VA:N/SC:N/SI:N/SA:N/E:P",
+		BaseScore:    8.6,
+	}
+	v31, err := d.AsV31()
+	require.NoError(t, err)
+
+	assert.Equal(t, AttackVectorTypeNetwork, v31.AttackVector)
+	assert.Equal(t, UserInteractionTypeRequired, v31.UserInteraction)
+	assert.Equal(t, CiaTypeHigh, v31.ConfidentialityImpact)
+	assert.Equal(t, CiaTypeLow, v31.IntegrityImpact)
+	assert.Empty(t, v31.Scope)
+	require.NotNil(t, v31.ExploitCodeMaturity)
+	assert.Equal(t, ExploitCodeMaturityTypeProofOfConcept, *v31.ExploitCodeMaturity)
+	assert.Equal(t, SeverityTypeHigh, v31.BaseSeverity)
+	assert.Equal(t, 8.6, v31.BaseScore)
+
+	_, err = CvssDataV40{VectorString: "CVSS:3.1/AV:N/AC:L/PR:N/UI:N/S:U/C:H/I:H/A:H"}.AsV31()
+	assert.ErrorIs(t, err, ErrInvalidVector)
+}
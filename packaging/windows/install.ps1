@@ -0,0 +1,32 @@
+# Installs the analyzer as a Windows service, run from an elevated prompt
+# next to vulnerability-analysis.exe:
+#   .\install.ps1 -ConfigFile C:\ProgramData\vulnerability-analysis\vulnerability-analysis.env
+# nmap must be installed and on the PATH of the service account. Changing
+# the service parameters, e.g. with "sc.exe control vulnerability-analysis
+# paramchange", reloads the log level and feature flags.
+param(
+    [string]$InstallDir = "$env:ProgramFiles\vulnerability-analysis",
+    [string]$DataDir = "$env:ProgramData\vulnerability-analysis",
+    [string]$ConfigFile = "$env:ProgramData\vulnerability-analysis\vulnerability-analysis.env"
+)
+$ErrorActionPreference = "Stop"
+$name = "vulnerability-analysis"
+
+New-Item -ItemType Directory -Force -Path $InstallDir, $DataDir | Out-Null
+Copy-Item -Force "$PSScriptRoot\vulnerability-analysis.exe" $InstallDir
+
+New-Service -Name $name `
+    -BinaryPathName "`"$InstallDir\vulnerability-analysis.exe`"" `
+    -DisplayName "Vulnerability Analysis Service" `
+    -StartupType Automatic | Out-Null
+
+# The environment of the service, read from the registry at start
+Set-ItemProperty -Path "HKLM:\SYSTEM\CurrentControlSet\Services\$name" -Name Environment -Type MultiString -Value @(
+    "CONFIG_FILE=$ConfigFile",
+    "PID_FILE=$DataDir\vulnerability-analysis.pid",
+    "HEALTH_FILE=$DataDir\health.json"
+)
+# Restart after crashes, as systemd does with Restart=on-failure
+sc.exe failure $name reset= 86400 actions= restart/5000/restart/5000/restart/60000 | Out-Null
+
+Start-Service $name
@@ -0,0 +1,244 @@
+// Package admission smooths bursts of scans, e.g. the scheduled nightly runs
+// landing at once. Scans are analyzed up to an adaptive concurrency limit,
+// halved whenever NVD throttled requests while a scan ran and raised back by
+// one for every scan completed without throttling. Scans beyond the limit
+// wait in line with an estimate of when they start, instead of oversubscribing
+// the workers into a throttling storm.
+package admission
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// ErrQueueFull is returned by Acquire when the queue holds its maximum of
+// scans.
+var ErrQueueFull = errors.New("scan admission queue is full")
+
+// defaultScanDuration estimates the duration of scans until one completes.
+const defaultScanDuration = time.Minute
+
+// Gauge counts the NVD requests throttled so far, e.g. a services.NVDClient.
+type Gauge interface {
+	Throttled() uint64
+}
+
+// Wait is the place of a queued scan.
+type Wait struct {
+	Position int           // 1 for the next scan admitted
+	Queued   int           // Scans in the queue
+	Active   int           // Scans being analyzed
+	Limit    int           // Scans analyzed at once
+	ETA      time.Duration // Estimated wait until the scan starts
+}
+
+// Stats is the state of a Controller.
+type Stats struct {
+	Limit       int
+	Max         int
+	Active      int
+	Queued      int
+	AvgDuration time.Duration
+}
+
+// Controller admits scans up to an adaptive concurrency limit. The zero value
+// is not usable, use NewController.
+type Controller struct {
+	max, maxQueued int
+	gauge          Gauge
+	interval       time.Duration
+	now            func() time.Time
+
+	mu        sync.Mutex
+	limit     int
+	active    int
+	queue     []*waiter
+	throttled uint64 // Reading of the gauge at the latest completion
+	avg       time.Duration
+	measured  bool
+}
+
+type waiter struct {
+	admitted chan struct{}
+}
+
+// Option configures a Controller.
+type Option func(*Controller)
+
+// WithUpdateInterval notifies queued scans of their position and ETA every
+// interval, on top of when they are queued. Zero only notifies them once.
+func WithUpdateInterval(interval time.Duration) Option {
+	return func(c *Controller) {
+		c.interval = interval
+	}
+}
+
+// NewController returns a controller analyzing at most maxActive scans at once
+// and queuing at most maxQueued more, or any number when zero. The limit is
+// lowered while gauge counts throttled requests, and stays at maxActive when
+// gauge is nil.
+func NewController(maxActive, maxQueued int, gauge Gauge, opts ...Option) *Controller {
+	c := &Controller{
+		max:       max(maxActive, 1),
+		maxQueued: maxQueued,
+		gauge:     gauge,
+		now:       time.Now,
+		avg:       defaultScanDuration,
+	}
+	c.limit = c.max
+	if gauge != nil {
+		c.throttled = gauge.Throttled()
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Acquire admits a scan, waiting in line while the limit of scans are
+// analyzed. notify, when not nil, is called with the place of the scan when
+// it is queued and every update interval until it is admitted. It returns
+// the func to call once the scan is analyzed, or ErrQueueFull, or the error of
+// ctx when it is done first, leaving the queue.
+func (c *Controller) Acquire(ctx context.Context, notify func(Wait)) (release func(), err error) {
+	c.mu.Lock()
+	if len(c.queue) == 0 && c.active < c.limit {
+		c.active++
+		c.mu.Unlock()
+		return c.releaser(), nil
+	}
+	if c.maxQueued > 0 && len(c.queue) >= c.maxQueued {
+		c.mu.Unlock()
+		return nil, ErrQueueFull
+	}
+	w := &waiter{admitted: make(chan struct{})}
+	c.queue = append(c.queue, w)
+	wait := c.waitLocked(w)
+	c.mu.Unlock()
+
+	if notify != nil {
+		notify(wait)
+	}
+	var tick <-chan time.Time
+	if c.interval > 0 && notify != nil {
+		ticker := time.NewTicker(c.interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case <-w.admitted:
+			return c.releaser(), nil
+		case <-ctx.Done():
+			c.mu.Lock()
+			select {
+			case <-w.admitted:
+				// Admitted meanwhile: hand the slot on to the next scan
+				c.active--
+				c.admitLocked()
+			default:
+				c.removeLocked(w)
+			}
+			c.mu.Unlock()
+			return nil, ctx.Err()
+		case <-tick:
+			c.mu.Lock()
+			wait := c.waitLocked(w)
+			c.mu.Unlock()
+			notify(wait)
+		}
+	}
+}
+
+// Stats returns the current limit and load of the controller.
+func (c *Controller) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return Stats{
+		Limit:       c.limit,
+		Max:         c.max,
+		Active:      c.active,
+		Queued:      len(c.queue),
+		AvgDuration: c.avg,
+	}
+}
+
+func (c *Controller) releaser() func() {
+	start := c.now()
+	var once sync.Once
+	return func() {
+		once.Do(func() { c.complete(c.now().Sub(start)) })
+	}
+}
+
+// complete frees the slot of a scan analyzed in d and adapts the limit.
+func (c *Controller) complete(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.active--
+	if c.measured {
+		c.avg += (d - c.avg) / 5
+	} else {
+		c.avg, c.measured = d, true
+	}
+
+	if c.gauge != nil {
+		throttled := c.gauge.Throttled()
+		switch {
+		case throttled > c.throttled && c.limit > 1:
+			c.limit = max(c.limit/2, 1)
+			slog.Warn("Lowered scan concurrency, NVD is throttling requests",
+				slog.Int("limit", c.limit),
+				slog.Int("n_queued", len(c.queue)))
+		case throttled == c.throttled && c.limit < c.max:
+			c.limit++
+		}
+		c.throttled = throttled
+	}
+	c.admitLocked()
+}
+
+// admitLocked admits the scans at the head of the queue while slots are free.
+func (c *Controller) admitLocked() {
+	for len(c.queue) > 0 && c.active < c.limit {
+		w := c.queue[0]
+		c.queue[0] = nil
+		c.queue = c.queue[1:]
+		c.active++
+		close(w.admitted)
+	}
+}
+
+func (c *Controller) removeLocked(w *waiter) {
+	for i, queued := range c.queue {
+		if queued == w {
+			c.queue = append(c.queue[:i], c.queue[i+1:]...)
+			return
+		}
+	}
+}
+
+// waitLocked estimates the wait of a queued scan: the scans ahead of it are
+// admitted by rounds of limit, each lasting the average scan duration.
+func (c *Controller) waitLocked(w *waiter) Wait {
+	position := 0
+	for i, queued := range c.queue {
+		if queued == w {
+			position = i + 1
+			break
+		}
+	}
+	rounds := (position + c.limit - 1) / c.limit
+	return Wait{
+		Position: position,
+		Queued:   len(c.queue),
+		Active:   c.active,
+		Limit:    c.limit,
+		ETA:      time.Duration(rounds) * c.avg,
+	}
+}
@@ -0,0 +1,152 @@
+package admission
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type stubGauge struct{ n atomic.Uint64 }
+
+func (g *stubGauge) Throttled() uint64 { return g.n.Load() }
+
+// acquireAsync queues a scan, returning the channel of its release func and
+// the channel of its notifications.
+func acquireAsync(ctx context.Context, c *Controller) (<-chan func(), <-chan Wait) {
+	released := make(chan func(), 1)
+	waits := make(chan Wait, 16)
+	go func() {
+		release, err := c.Acquire(ctx, func(w Wait) { waits <- w })
+		if err == nil {
+			released <- release
+		}
+		close(released)
+	}()
+	return released, waits
+}
+
+func TestController_QueuesBeyondLimit(t *testing.T) {
+	t.Parallel()
+	c := NewController(2, 0, nil)
+
+	first, err := c.Acquire(context.Background(), nil)
+	require.NoError(t, err)
+	_, err = c.Acquire(context.Background(), nil)
+	require.NoError(t, err)
+
+	admitted, waits := acquireAsync(context.Background(), c)
+	wait := <-waits
+	assert.Equal(t, 1, wait.Position)
+	assert.Equal(t, 1, wait.Queued)
+	assert.Equal(t, 2, wait.Active)
+	assert.Equal(t, defaultScanDuration, wait.ETA)
+
+	second, waits := acquireAsync(context.Background(), c)
+	assert.Equal(t, 2, (<-waits).Position)
+
+	first()
+	first() // Releasing twice frees a single slot
+	release := <-admitted
+	require.NotNil(t, release)
+	assert.Equal(t, Stats{Limit: 2, Max: 2, Active: 2, Queued: 1, AvgDuration: c.Stats().AvgDuration}, c.Stats())
+
+	release()
+	assert.NotNil(t, <-second)
+}
+
+func TestController_QueueFull(t *testing.T) {
+	t.Parallel()
+	c := NewController(1, 1, nil)
+	_, err := c.Acquire(context.Background(), nil)
+	require.NoError(t, err)
+
+	_, waits := acquireAsync(context.Background(), c)
+	<-waits
+	_, err = c.Acquire(context.Background(), nil)
+	assert.ErrorIs(t, err, ErrQueueFull)
+}
+
+func TestController_CancelLeavesQueue(t *testing.T) {
+	t.Parallel()
+	c := NewController(1, 0, nil)
+	release, err := c.Acquire(context.Background(), nil)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancelled, waits := acquireAsync(ctx, c)
+	<-waits
+	next, waits := acquireAsync(context.Background(), c)
+	assert.Equal(t, 2, (<-waits).Position)
+
+	cancel()
+	assert.Nil(t, <-cancelled)
+	assert.Equal(t, 1, c.Stats().Queued)
+
+	release()
+	assert.NotNil(t, <-next)
+}
+
+func TestController_AdaptsToThrottling(t *testing.T) {
+	t.Parallel()
+	gauge := &stubGauge{}
+	c := NewController(4, 0, gauge)
+
+	releases := make([]func(), 4)
+	for i := range releases {
+		var err error
+		releases[i], err = c.Acquire(context.Background(), nil)
+		require.NoError(t, err)
+	}
+
+	// NVD throttled while the scans ran: the limit is halved
+	gauge.n.Add(3)
+	releases[0]()
+	assert.Equal(t, 2, c.Stats().Limit)
+
+	// More throttling halves it again, down to a single scan
+	gauge.n.Add(1)
+	releases[1]()
+	assert.Equal(t, 1, c.Stats().Limit)
+
+	// Scans completed without throttling raise it back by one
+	releases[2]()
+	assert.Equal(t, 2, c.Stats().Limit)
+	releases[3]()
+	assert.Equal(t, 3, c.Stats().Limit)
+}
+
+func TestController_ETA(t *testing.T) {
+	t.Parallel()
+	c := NewController(2, 0, nil, WithUpdateInterval(10*time.Millisecond))
+	now := time.Now()
+	c.now = func() time.Time { return now }
+
+	// The average scan duration is learned from completed scans
+	release, err := c.Acquire(context.Background(), nil)
+	require.NoError(t, err)
+	now = now.Add(10 * time.Minute)
+	release()
+	assert.Equal(t, 10*time.Minute, c.Stats().AvgDuration)
+
+	for range 2 {
+		_, err := c.Acquire(context.Background(), nil)
+		require.NoError(t, err)
+	}
+	var waits []<-chan Wait
+	for range 3 {
+		_, w := acquireAsync(context.Background(), c)
+		<-w
+		waits = append(waits, w)
+	}
+
+	// Queued scans are notified again every update interval, the third
+	// waits for two rounds of scans
+	assert.Equal(t, 10*time.Minute, (<-waits[1]).ETA)
+	wait := <-waits[2]
+	assert.Equal(t, 3, wait.Position)
+	assert.Equal(t, 20*time.Minute, wait.ETA)
+}
@@ -0,0 +1,112 @@
+package advisory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var (
+	ErrUnsupportedIdentifier = errors.New("unsupported advisory identifier")
+	ErrNoCVEFound            = errors.New("advisory does not reference any CVE")
+	ErrAdvisoryNotFound      = errors.New("advisory not found")
+)
+
+// IdentifierType is the family an advisory identifier belongs to.
+type IdentifierType string
+
+const (
+	IdentifierCVE     IdentifierType = "CVE"
+	IdentifierGHSA    IdentifierType = "GHSA" // GitHub Security Advisory
+	IdentifierDSA     IdentifierType = "DSA"  // Debian Security Advisory
+	IdentifierDLA     IdentifierType = "DLA"  // Debian LTS Advisory
+	IdentifierRHSA    IdentifierType = "RHSA" // Red Hat Security Advisory
+	IdentifierUnknown IdentifierType = "UNKNOWN"
+)
+
+var (
+	cvePattern      = regexp.MustCompile(`CVE-\d{4}-\d{4,}`)
+	cveExactPattern = regexp.MustCompile(`^CVE-\d{4}-\d{4,}$`)
+	ghsaPattern     = regexp.MustCompile(`^GHSA(-[23456789CFGHJMPQRVWX]{4}){3}$`)
+	dsaPattern      = regexp.MustCompile(`^DSA-\d+(-\d+)?$`)
+	dlaPattern      = regexp.MustCompile(`^DLA-\d+(-\d+)?$`)
+	rhsaPattern     = regexp.MustCompile(`^RHSA-\d{4}:\d+$`)
+)
+
+// Classify returns the type of an advisory identifier.
+func Classify(id string) IdentifierType {
+	upper := strings.ToUpper(strings.TrimSpace(id))
+
+	switch {
+	case cveExactPattern.MatchString(upper):
+		return IdentifierCVE
+	case ghsaPattern.MatchString(upper):
+		return IdentifierGHSA
+	case dsaPattern.MatchString(upper):
+		return IdentifierDSA
+	case dlaPattern.MatchString(upper):
+		return IdentifierDLA
+	case rhsaPattern.MatchString(upper):
+		return IdentifierRHSA
+	default:
+		return IdentifierUnknown
+	}
+}
+
+// Resolver maps an advisory identifier to the CVE IDs it covers.
+type Resolver interface {
+	Supports(idType IdentifierType) bool
+	Resolve(ctx context.Context, id string) ([]string, error)
+}
+
+// extractCVEIDs returns the unique CVE IDs mentioned in text, in order.
+func extractCVEIDs(text string) []string {
+	seen := make(map[string]bool)
+	var ids []string
+	for _, id := range cvePattern.FindAllString(text, -1) {
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+func newHTTPClient() *http.Client {
+	return &http.Client{Timeout: 30 * time.Second}
+}
+
+// fetchBody GETs url and returns its body, failing on non-200 responses.
+func fetchBody(ctx context.Context, client *http.Client, url string, headers map[string]string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create advisory request: %w", err)
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed advisory request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("%w: %s", ErrAdvisoryNotFound, url)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected advisory response status for %s: %s", url, resp.Status)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 10<<20))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read advisory response: %w", err)
+	}
+	return body, nil
+}
@@ -0,0 +1,97 @@
+package advisory
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClassify(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		name string
+		id   string
+		want IdentifierType
+	}{
+		{name: "CVE", id: "CVE-2021-44228", want: IdentifierCVE},
+		{name: "Lowercase CVE", id: "cve-2021-44228", want: IdentifierCVE},
+		{name: "GHSA", id: "GHSA-jfh8-c2jp-5v3q", want: IdentifierGHSA},
+		{name: "DSA", id: "DSA-5022-1", want: IdentifierDSA},
+		{name: "DLA", id: "DLA-2842-1", want: IdentifierDLA},
+		{name: "RHSA", id: "RHSA-2021:5138", want: IdentifierRHSA},
+		{name: "Invalid GHSA alphabet", id: "GHSA-aaaa-bbbb-cccc", want: IdentifierUnknown},
+		{name: "Unknown", id: "USN-5192-1", want: IdentifierUnknown},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, Classify(tc.id))
+		})
+	}
+}
+
+func TestExtractCVEIDs(t *testing.T) {
+	t.Parallel()
+	text := "Fixes CVE-2021-44228 and CVE-2021-45046. See also CVE-2021-44228."
+	assert.Equal(t, []string{"CVE-2021-44228", "CVE-2021-45046"}, extractCVEIDs(text))
+	assert.Empty(t, extractCVEIDs("no identifiers here"))
+}
+
+func TestChain_ResolveToCVEs(t *testing.T) {
+	t.Parallel()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/ghsa/GHSA-jfh8-c2jp-5v3q":
+			w.Write([]byte(`{"cve_id":"CVE-2021-44228","identifiers":[{"type":"GHSA","value":"GHSA-jfh8-c2jp-5v3q"},{"type":"CVE","value":"CVE-2021-44228"}]}`))
+		case "/ghsa/GHSA-7rjr-3q55-vv33":
+			w.Write([]byte(`{"cve_id":"CVE-2021-45046","identifiers":[{"type":"CVE","value":"CVE-2021-44228"},{"type":"CVE","value":"CVE-2021-45046"},{"type":"CVE","value":"CVE-2021-44228"}]}`))
+		case "/debian/DSA-5022-1":
+			w.Write([]byte(`<html><a href="/tracker/CVE-2021-44228">CVE-2021-44228</a><a>CVE-2021-45046</a></html>`))
+		case "/redhat/RHSA-2021:5138.json":
+			w.Write([]byte(`{"cvrfdoc":{"vulnerability":[{"cve":"CVE-2021-44228"}]}}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	ghsa := NewGHSAResolver("")
+	ghsa.BaseURL = server.URL + "/ghsa"
+	debian := NewDebianResolver()
+	debian.BaseURL = server.URL + "/debian"
+	redhat := NewRedHatResolver()
+	redhat.BaseURL = server.URL + "/redhat"
+	chain := NewChain(ghsa, debian, redhat)
+
+	testCases := []struct {
+		name    string
+		id      string
+		want    []string
+		wantErr error
+	}{
+		{name: "CVE passthrough", id: "cve-2021-44228", want: []string{"CVE-2021-44228"}},
+		{name: "GHSA", id: "GHSA-jfh8-c2jp-5v3q", want: []string{"CVE-2021-44228"}},
+		{name: "GHSA with repeated aliases", id: "GHSA-7rjr-3q55-vv33", want: []string{"CVE-2021-45046", "CVE-2021-44228"}},
+		{name: "DSA", id: "DSA-5022-1", want: []string{"CVE-2021-44228", "CVE-2021-45046"}},
+		{name: "RHSA", id: "RHSA-2021:5138", want: []string{"CVE-2021-44228"}},
+		{name: "Unsupported", id: "USN-5192-1", wantErr: ErrUnsupportedIdentifier},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := chain.ResolveToCVEs(context.Background(), tc.id)
+			if tc.wantErr != nil {
+				assert.ErrorIs(t, err, tc.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+
+	_, err := chain.ResolveToCVEs(context.Background(), "DLA-0000-1")
+	assert.ErrorIs(t, err, ErrAdvisoryNotFound)
+}
@@ -0,0 +1,184 @@
+package advisory
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// GHSAResolver resolves GitHub Security Advisories through the GitHub
+// global advisories API.
+type GHSAResolver struct {
+	BaseURL string // Defaults to https://api.github.com/advisories
+	Token   string // Optional, raises the GitHub API rate limit
+	client  *http.Client
+}
+
+var _ Resolver = (*GHSAResolver)(nil)
+
+func NewGHSAResolver(token string) *GHSAResolver {
+	return &GHSAResolver{
+		BaseURL: "https://api.github.com/advisories",
+		Token:   token,
+		client:  newHTTPClient(),
+	}
+}
+
+func (r *GHSAResolver) Supports(idType IdentifierType) bool {
+	return idType == IdentifierGHSA
+}
+
+func (r *GHSAResolver) Resolve(ctx context.Context, id string) ([]string, error) {
+	headers := map[string]string{"Accept": "application/vnd.github+json"}
+	if r.Token != "" {
+		headers["Authorization"] = "Bearer " + r.Token
+	}
+
+	body, err := fetchBody(ctx, r.client, r.BaseURL+"/"+id, headers)
+	if err != nil {
+		return nil, err
+	}
+
+	var advisory struct {
+		CveID       *string `json:"cve_id"`
+		Identifiers []struct {
+			Type  string `json:"type"`
+			Value string `json:"value"`
+		} `json:"identifiers"`
+	}
+	if err := json.Unmarshal(body, &advisory); err != nil {
+		return nil, fmt.Errorf("failed to decode GitHub advisory %s: %w", id, err)
+	}
+
+	var ids []string
+	seen := make(map[string]bool)
+	add := func(cveID string) {
+		cveID = strings.ToUpper(strings.TrimSpace(cveID))
+		if cveID != "" && !seen[cveID] {
+			seen[cveID] = true
+			ids = append(ids, cveID)
+		}
+	}
+	if advisory.CveID != nil {
+		add(*advisory.CveID)
+	}
+	for _, identifier := range advisory.Identifiers {
+		if identifier.Type == "CVE" {
+			add(identifier.Value)
+		}
+	}
+
+	if len(ids) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrNoCVEFound, id)
+	}
+	return ids, nil
+}
+
+// DebianResolver resolves DSA and DLA advisories using the Debian security
+// tracker pages, which list every CVE fixed by an advisory.
+type DebianResolver struct {
+	BaseURL string // Defaults to https://security-tracker.debian.org/tracker
+	client  *http.Client
+}
+
+var _ Resolver = (*DebianResolver)(nil)
+
+func NewDebianResolver() *DebianResolver {
+	return &DebianResolver{
+		BaseURL: "https://security-tracker.debian.org/tracker",
+		client:  newHTTPClient(),
+	}
+}
+
+func (r *DebianResolver) Supports(idType IdentifierType) bool {
+	return idType == IdentifierDSA || idType == IdentifierDLA
+}
+
+func (r *DebianResolver) Resolve(ctx context.Context, id string) ([]string, error) {
+	body, err := fetchBody(ctx, r.client, r.BaseURL+"/"+strings.ToUpper(id), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := extractCVEIDs(string(body))
+	if len(ids) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrNoCVEFound, id)
+	}
+	return ids, nil
+}
+
+// RedHatResolver resolves RHSA errata using the Red Hat Security Data API.
+type RedHatResolver struct {
+	BaseURL string // Defaults to https://access.redhat.com/hydra/rest/securitydata/cvrf
+	client  *http.Client
+}
+
+var _ Resolver = (*RedHatResolver)(nil)
+
+func NewRedHatResolver() *RedHatResolver {
+	return &RedHatResolver{
+		BaseURL: "https://access.redhat.com/hydra/rest/securitydata/cvrf",
+		client:  newHTTPClient(),
+	}
+}
+
+func (r *RedHatResolver) Supports(idType IdentifierType) bool {
+	return idType == IdentifierRHSA
+}
+
+func (r *RedHatResolver) Resolve(ctx context.Context, id string) ([]string, error) {
+	body, err := fetchBody(ctx, r.client, r.BaseURL+"/"+strings.ToUpper(id)+".json", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// The CVRF document lists one or many vulnerabilities depending on the
+	// erratum, so the CVE IDs are extracted from the raw document
+	ids := extractCVEIDs(string(body))
+	if len(ids) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrNoCVEFound, id)
+	}
+	return ids, nil
+}
+
+// Chain dispatches identifiers to the first resolver supporting their type.
+// CVE identifiers are returned as-is.
+type Chain struct {
+	resolvers []Resolver
+}
+
+func NewChain(resolvers ...Resolver) *Chain {
+	return &Chain{resolvers: resolvers}
+}
+
+// NewDefaultChain creates a chain with the GHSA, Debian and Red Hat resolvers.
+func NewDefaultChain(githubToken string) *Chain {
+	return NewChain(
+		NewGHSAResolver(githubToken),
+		NewDebianResolver(),
+		NewRedHatResolver(),
+	)
+}
+
+// ResolveToCVEs returns the CVE IDs an identifier refers to.
+func (c *Chain) ResolveToCVEs(ctx context.Context, id string) ([]string, error) {
+	id = strings.TrimSpace(id)
+	idType := Classify(id)
+
+	if idType == IdentifierCVE {
+		return []string{strings.ToUpper(id)}, nil
+	}
+
+	for _, r := range c.resolvers {
+		if r.Supports(idType) {
+			ids, err := r.Resolve(ctx, id)
+			if err != nil {
+				return nil, fmt.Errorf("failed to resolve %s advisory %s: %w", idType, id, err)
+			}
+			return ids, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", ErrUnsupportedIdentifier, id)
+}
@@ -0,0 +1,203 @@
+// Package anomaly flags the scans whose finding count deviates wildly from
+// the history of the host, which usually points at a scanner
+// misconfiguration or a CPE standardization regression rather than at a real
+// change of its posture.
+package anomaly
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/results"
+)
+
+const (
+	// DefaultHistory is the number of scans of a host the baseline is
+	// computed on.
+	DefaultHistory = 10
+
+	// DefaultSpikeFactor flags the scans finding 10 times the baseline or
+	// more.
+	DefaultSpikeFactor = 10
+
+	// DefaultDropPercent flags the scans finding 90% fewer CVEs than the
+	// baseline or more.
+	DefaultDropPercent = 90
+
+	// DefaultRetention is how long the history of a host is kept after its
+	// last scan.
+	DefaultRetention = 90 * 24 * time.Hour
+
+	// minHistory is the number of earlier scans a baseline needs, so that a
+	// host's first scans aren't compared to a single outlier.
+	minHistory = 3
+
+	// minDropBaseline is the baseline under which drops aren't flagged, a
+	// host going from 5 findings to none is a plausible patch.
+	minDropBaseline = 10
+)
+
+// Detector keeps, per tenant and host, the finding counts of the latest
+// scans. Hosts not scanned for the retention are forgotten. It is safe for
+// concurrent use.
+type Detector struct {
+	mu          sync.Mutex
+	history     int
+	spikeFactor int
+	dropPercent int
+	retention   time.Duration
+	hosts       map[string]map[string][]scan // tenant -> host address -> oldest first
+	lastSweep   time.Time
+}
+
+type scan struct {
+	id       uuid.UUID
+	findings int
+	at       time.Time
+}
+
+// Source replays the counts of distinct CVEs found by the stored scans since a time,
+// oldest scan first, e.g. a vulnstore.Store.
+type Source interface {
+	FindingCounts(ctx context.Context, since time.Time, fn func(tenantID, hostAddress string, scanID uuid.UUID, findings int, at time.Time)) error
+}
+
+// Option configures a Detector.
+type Option func(*Detector)
+
+// WithSpikeFactor flags the scans finding factor times the baseline or more,
+// at least 2.
+func WithSpikeFactor(factor int) Option {
+	return func(d *Detector) {
+		d.spikeFactor = max(factor, 2)
+	}
+}
+
+// WithDropPercent flags the scans finding percent fewer CVEs than the
+// baseline or more, between 1 and 100.
+func WithDropPercent(percent int) Option {
+	return func(d *Detector) {
+		d.dropPercent = min(max(percent, 1), 100)
+	}
+}
+
+// WithRetention sets how long the history of a host is kept after its last
+// scan, DefaultRetention when not positive.
+func WithRetention(retention time.Duration) Option {
+	return func(d *Detector) {
+		if retention > 0 {
+			d.retention = retention
+		}
+	}
+}
+
+// NewDetector returns a detector comparing each scan to the median finding
+// count of the previous history scans of the host, at least 3.
+func NewDetector(history int, opts ...Option) *Detector {
+	d := &Detector{
+		history:     max(history, minHistory),
+		spikeFactor: DefaultSpikeFactor,
+		dropPercent: DefaultDropPercent,
+		retention:   DefaultRetention,
+		hosts:       make(map[string]map[string][]scan),
+	}
+	for _, opt := range opts {
+		opt(d)
+	}
+	return d
+}
+
+// Load replays the scans of src within the retention, so that the baselines
+// of the hosts survive restarts. It returns the number of scans replayed.
+func (d *Detector) Load(ctx context.Context, src Source, now time.Time) (int, error) {
+	n := 0
+	err := src.FindingCounts(ctx, now.Add(-d.retention), func(tenantID, hostAddress string, scanID uuid.UUID, findings int, at time.Time) {
+		d.Observe(tenantID, hostAddress, scanID, findings, at)
+		n++
+	})
+	return n, err
+}
+
+// Observe records the finding count of a scan of a host and returns the
+// anomaly it makes against the host's history, nil when it's in line.
+// Observing the latest scan of a host again replaces it rather than counting
+// another scan.
+func (d *Detector) Observe(tenantID, hostAddress string, scanID uuid.UUID, findings int, at time.Time) *results.VolumeAnomaly {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.sweep(at)
+	if d.hosts[tenantID] == nil {
+		d.hosts[tenantID] = make(map[string][]scan)
+	}
+	scans := d.hosts[tenantID][hostAddress]
+	if n := len(scans); n > 0 && scanID != uuid.Nil && scans[n-1].id == scanID {
+		scans = scans[:n-1]
+	}
+
+	anomaly := d.compare(scans, findings, at)
+
+	scans = append(scans, scan{id: scanID, findings: findings, at: at})
+	if len(scans) > d.history {
+		scans = slices.Delete(scans, 0, len(scans)-d.history)
+	}
+	d.hosts[tenantID][hostAddress] = scans
+	return anomaly
+}
+
+// sweep forgets the hosts last scanned before the retention, at most once
+// per tenth of it. The caller holds the lock.
+func (d *Detector) sweep(now time.Time) {
+	if now.Sub(d.lastSweep) < d.retention/10 {
+		return
+	}
+	d.lastSweep = now
+	for tenantID, hosts := range d.hosts {
+		for address, scans := range hosts {
+			if now.Sub(scans[len(scans)-1].at) > d.retention {
+				delete(hosts, address)
+			}
+		}
+		if len(hosts) == 0 {
+			delete(d.hosts, tenantID)
+		}
+	}
+}
+
+func (d *Detector) compare(scans []scan, findings int, at time.Time) *results.VolumeAnomaly {
+	if len(scans) < minHistory {
+		return nil
+	}
+	baseline := median(scans)
+
+	var kind results.VolumeAnomalyKind
+	switch {
+	case findings >= d.spikeFactor*max(baseline, 1):
+		kind = results.VolumeAnomalySpike
+	case baseline >= minDropBaseline && findings*100 <= baseline*(100-d.dropPercent):
+		kind = results.VolumeAnomalyDrop
+	default:
+		return nil
+	}
+	return &results.VolumeAnomaly{
+		Kind:     kind,
+		Findings: findings,
+		Baseline: baseline,
+		Scans:    len(scans),
+		At:       at,
+	}
+}
+
+// median returns the median finding count of scans, the lower one of the
+// two middle counts of an even number of scans.
+func median(scans []scan) int {
+	counts := make([]int, len(scans))
+	for i, s := range scans {
+		counts[i] = s.findings
+	}
+	slices.Sort(counts)
+	return counts[(len(counts)-1)/2]
+}
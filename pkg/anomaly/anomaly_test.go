@@ -0,0 +1,127 @@
+package anomaly
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/results"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDetector_Observe(t *testing.T) {
+	t.Parallel()
+	at := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	detector := NewDetector(5)
+	for _, count := range []int{20, 22, 18} {
+		assert.Nil(t, detector.Observe("acme", "10.0.0.1", uuid.New(), count, at))
+	}
+
+	// In line with the history
+	assert.Nil(t, detector.Observe("acme", "10.0.0.1", uuid.New(), 25, at))
+
+	id := uuid.New()
+	section := detector.Observe("acme", "10.0.0.1", id, 250, at)
+	require.NotNil(t, section, "Expected 10 times the usual findings to be a spike")
+	assert.Equal(t, results.VolumeAnomalySpike, section.Kind)
+	assert.Equal(t, 250, section.Findings)
+	assert.Equal(t, 20, section.Baseline)
+	assert.Equal(t, 4, section.Scans)
+
+	// Reanalyzing the latest scan replaces it
+	section = detector.Observe("acme", "10.0.0.1", id, 2, at)
+	require.NotNil(t, section, "Expected 90% fewer findings to be a drop")
+	assert.Equal(t, results.VolumeAnomalyDrop, section.Kind)
+	assert.Equal(t, 4, section.Scans)
+
+	// Other tenants have their own history
+	assert.Nil(t, detector.Observe("globex", "10.0.0.1", uuid.New(), 250, at))
+}
+
+func TestDetector_Observe_Thresholds(t *testing.T) {
+	t.Parallel()
+	at := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		history  []int
+		findings int
+		opts     []Option
+		want     results.VolumeAnomalyKind
+	}{
+		{name: "too little history", history: []int{1, 1}, findings: 100},
+		{name: "spike on a clean host", history: []int{0, 0, 0}, findings: 10, want: results.VolumeAnomalySpike},
+		{name: "under the spike factor", history: []int{0, 0, 0}, findings: 9},
+		{name: "drop to nothing", history: []int{40, 50, 60}, findings: 0, want: results.VolumeAnomalyDrop},
+		{name: "drop on a small baseline", history: []int{5, 5, 5}, findings: 0},
+		{name: "median ignores an outlier", history: []int{10, 10, 1000}, findings: 100, want: results.VolumeAnomalySpike},
+		{name: "custom spike factor", history: []int{10, 10, 10}, findings: 30, opts: []Option{WithSpikeFactor(3)}, want: results.VolumeAnomalySpike},
+		{name: "custom drop percent", history: []int{10, 10, 10}, findings: 5, opts: []Option{WithDropPercent(50)}, want: results.VolumeAnomalyDrop},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			detector := NewDetector(DefaultHistory, tt.opts...)
+			for _, count := range tt.history {
+				detector.Observe("acme", "10.0.0.1", uuid.New(), count, at)
+			}
+			section := detector.Observe("acme", "10.0.0.1", uuid.New(), tt.findings, at)
+			if tt.want == "" {
+				assert.Nil(t, section)
+				return
+			}
+			require.NotNil(t, section)
+			assert.Equal(t, tt.want, section.Kind)
+		})
+	}
+}
+
+func TestDetector_Retention(t *testing.T) {
+	t.Parallel()
+	at := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	detector := NewDetector(5, WithRetention(7*24*time.Hour))
+	for _, count := range []int{20, 22, 18} {
+		detector.Observe("acme", "10.0.0.1", uuid.New(), count, at)
+	}
+
+	// Scans after the retention evict the idle host, which has no baseline left
+	later := at.Add(20 * 24 * time.Hour)
+	detector.Observe("acme", "10.0.0.2", uuid.New(), 1, later)
+	assert.NotContains(t, detector.hosts["acme"], "10.0.0.1")
+	assert.Nil(t, detector.Observe("acme", "10.0.0.1", uuid.New(), 250, later))
+}
+
+// stubSource replays stored scans of a host.
+type stubSource []struct {
+	findings int
+	at       time.Time
+}
+
+func (s stubSource) FindingCounts(ctx context.Context, since time.Time, fn func(tenantID, hostAddress string, scanID uuid.UUID, findings int, at time.Time)) error {
+	for _, scan := range s {
+		if !scan.at.Before(since) {
+			fn("acme", "10.0.0.1", uuid.New(), scan.findings, scan.at)
+		}
+	}
+	return nil
+}
+
+func TestDetector_Load(t *testing.T) {
+	t.Parallel()
+	now := time.Now()
+	day := 24 * time.Hour
+	src := stubSource{
+		{findings: 500, at: now.Add(-200 * day)},
+		{findings: 20, at: now.Add(-3 * day)},
+		{findings: 22, at: now.Add(-2 * day)},
+		{findings: 18, at: now.Add(-day)},
+	}
+	detector := NewDetector(5)
+	n, err := detector.Load(context.Background(), src, now)
+	require.NoError(t, err)
+	assert.Equal(t, 3, n, "Expected scans older than the retention to be left out")
+
+	section := detector.Observe("acme", "10.0.0.1", uuid.New(), 250, now)
+	require.NotNil(t, section, "Expected the replayed scans to make the baseline")
+	assert.Equal(t, 20, section.Baseline)
+}
@@ -0,0 +1,63 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/kptm-tools/vulnerability-analysis/pkg/advisory"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/results"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/services"
+)
+
+// AdvisorySource resolves advisory identifiers, such as GHSA, DSA, DLA and
+// RHSA ones, to the CVEs they cover and returns them NVD enriched.
+type AdvisorySource interface {
+	EnrichByIdentifiers(ctx context.Context, ids []string) ([]results.Vulnerability, error)
+}
+
+// advisoryResult is an advisory with the enriched CVEs it covers. Errors
+// lists the CVEs of the advisory that failed to enrich.
+type advisoryResult struct {
+	AdvisoryID      string                  `json:"advisory_id"`
+	Type            advisory.IdentifierType `json:"type"`
+	Vulnerabilities []results.Vulnerability `json:"vulnerabilities"`
+	Errors          []string                `json:"errors,omitempty"`
+}
+
+// advisoryHandler returns the CVEs covered by a GHSA, DSA, DLA or RHSA
+// advisory, or by a CVE ID, enriched from the NVD.
+func advisoryHandler(source AdvisorySource) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := strings.TrimSpace(r.PathValue("advisory_id"))
+		idType := advisory.Classify(id)
+		if idType == advisory.IdentifierUnknown {
+			http.Error(w, "unsupported advisory identifier, expected a CVE, GHSA, DSA, DLA or RHSA ID", http.StatusBadRequest)
+			return
+		}
+
+		vulns, err := source.EnrichByIdentifiers(r.Context(), []string{id})
+		if err != nil && len(vulns) == 0 {
+			status := http.StatusBadGateway
+			if errors.Is(err, advisory.ErrAdvisoryNotFound) || errors.Is(err, advisory.ErrNoCVEFound) || errors.Is(err, services.ErrCVENotFound) {
+				status = http.StatusNotFound
+			}
+			http.Error(w, err.Error(), status)
+			return
+		}
+
+		result := advisoryResult{AdvisoryID: id, Type: idType, Vulnerabilities: vulns}
+		if result.Vulnerabilities == nil {
+			result.Vulnerabilities = []results.Vulnerability{}
+		}
+		if joined, ok := err.(interface{ Unwrap() []error }); ok {
+			for _, e := range joined.Unwrap() {
+				result.Errors = append(result.Errors, e.Error())
+			}
+		} else if err != nil {
+			result.Errors = []string{err.Error()}
+		}
+		writeJSON(w, result)
+	}
+}
@@ -0,0 +1,74 @@
+package api
+
+import (
+	"bytes"
+	"mime"
+	"net/http"
+
+	"github.com/kptm-tools/vulnerability-analysis/pkg/output"
+)
+
+// handlerOptions are the settings of the routes of NewHandler.
+type handlerOptions struct {
+	canonical bool
+}
+
+// Option configures the routes of NewHandler.
+type Option func(*handlerOptions)
+
+// WithCanonicalJSON serves the JSON responses as canonical JSON, with sorted
+// keys and timestamps in UTC, like the results published in the canonical
+// mode.
+func WithCanonicalJSON(enabled bool) Option {
+	return func(o *handlerOptions) {
+		o.canonical = enabled
+	}
+}
+
+// withCanonicalJSON re-encodes the JSON responses of next as canonical JSON,
+// so that exports such as VEX documents diff cleanly between calls.
+func withCanonicalJSON(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cw := &canonicalWriter{ResponseWriter: w}
+		next.ServeHTTP(cw, r)
+		cw.flush()
+	})
+}
+
+// canonicalWriter buffers a response until the handler returns, as the
+// whole document is needed to sort its keys.
+type canonicalWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (c *canonicalWriter) WriteHeader(code int) {
+	if c.status == 0 {
+		c.status = code
+	}
+}
+
+func (c *canonicalWriter) Write(p []byte) (int, error) {
+	if c.status == 0 {
+		c.status = http.StatusOK
+	}
+	return c.body.Write(p)
+}
+
+func (c *canonicalWriter) flush() {
+	body := c.body.Bytes()
+	if mediaType, _, _ := mime.ParseMediaType(c.Header().Get("Content-Type")); mediaType == "application/json" {
+		// A body failing to parse, e.g. cut short by an encoding error, is
+		// passed through
+		if canonical, err := output.CanonicalizeJSON(body); err == nil {
+			body = append(canonical, '\n')
+		}
+	}
+	if c.status == 0 {
+		c.status = http.StatusOK
+	}
+	c.Header().Del("Content-Length")
+	c.ResponseWriter.WriteHeader(c.status)
+	_, _ = c.ResponseWriter.Write(body)
+}
@@ -0,0 +1,116 @@
+package api
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/output"
+)
+
+// withCompression compresses the responses of next with the encoding the
+// client prefers among zstd and gzip, as negotiated by Accept-Encoding.
+func withCompression(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		enc := negotiateEncoding(r.Header.Get("Accept-Encoding"))
+		if enc == output.EncodingIdentity || r.Method == http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		cw := &compressWriter{ResponseWriter: w, enc: enc}
+		defer cw.Close()
+		next.ServeHTTP(cw, r)
+	})
+}
+
+// negotiateEncoding returns the encoding of an Accept-Encoding header with
+// the highest weight, zstd winning ties, or identity when the client accepts
+// neither zstd nor gzip.
+func negotiateEncoding(header string) output.Encoding {
+	best, bestQ := output.EncodingIdentity, 0.0
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+
+		var enc output.Encoding
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "zstd":
+			enc = output.EncodingZstd
+		case "gzip", "x-gzip":
+			enc = output.EncodingGzip
+		default:
+			continue
+		}
+		if q > bestQ || (q == bestQ && q > 0 && enc == output.EncodingZstd) {
+			best, bestQ = enc, q
+		}
+	}
+	return best
+}
+
+// compressWriter compresses the body written to a response. The encoder is
+// only started once the handler writes a status with a body, so responses
+// without one, or already encoded, pass through.
+type compressWriter struct {
+	http.ResponseWriter
+	enc output.Encoding
+
+	w           io.WriteCloser
+	wroteHeader bool
+}
+
+func (c *compressWriter) WriteHeader(code int) {
+	if c.wroteHeader {
+		return
+	}
+	c.wroteHeader = true
+
+	h := c.Header()
+	if code != http.StatusNoContent && code != http.StatusNotModified && code >= http.StatusOK && h.Get("Content-Encoding") == "" {
+		h.Set("Content-Encoding", string(c.enc))
+		h.Del("Content-Length")
+		switch c.enc {
+		case output.EncodingZstd:
+			// Only fails on invalid options
+			c.w, _ = zstd.NewWriter(c.ResponseWriter)
+		default:
+			c.w = gzip.NewWriter(c.ResponseWriter)
+		}
+	}
+	c.ResponseWriter.WriteHeader(code)
+}
+
+func (c *compressWriter) Write(p []byte) (int, error) {
+	if !c.wroteHeader {
+		c.WriteHeader(http.StatusOK)
+	}
+	if c.w == nil {
+		return c.ResponseWriter.Write(p)
+	}
+	return c.w.Write(p)
+}
+
+// Close flushes the compressed body.
+func (c *compressWriter) Close() error {
+	if c.w == nil {
+		return nil
+	}
+	return c.w.Close()
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (c *compressWriter) Unwrap() http.ResponseWriter {
+	return c.ResponseWriter
+}
@@ -0,0 +1,62 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/kptm-tools/vulnerability-analysis/nvd/schema"
+)
+
+var cveIDPattern = regexp.MustCompile(`^CVE-\d{4}-\d{4,}$`)
+
+// CVEHistorySource returns the changes NVD made to a CVE, oldest first.
+type CVEHistorySource interface {
+	FetchCVEHistory(ctx context.Context, cveID string) (*schema.CveHistoryResponse, error)
+}
+
+// cveChange is a change of a CVE, flagged when it changes its score or
+// status.
+type cveChange struct {
+	schema.CveChange
+	ScoreChanged  bool `json:"scoreChanged"`
+	StatusChanged bool `json:"statusChanged"`
+}
+
+// cveHistoryHandler returns the changes of a CVE, only the ones changing its
+// score or status with changes=score or changes=status.
+func cveHistoryHandler(source CVEHistorySource) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		cveID := strings.ToUpper(r.PathValue("cve_id"))
+		if !cveIDPattern.MatchString(cveID) {
+			http.Error(w, "invalid CVE ID", http.StatusBadRequest)
+			return
+		}
+		only := r.URL.Query().Get("changes")
+		if only != "" && only != "score" && only != "status" {
+			http.Error(w, "changes parameter must be score or status", http.StatusBadRequest)
+			return
+		}
+
+		history, err := source.FetchCVEHistory(r.Context(), cveID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+
+		changes := []cveChange{}
+		for _, item := range history.CveChanges {
+			change := cveChange{
+				CveChange:     item.Change,
+				ScoreChanged:  item.Change.ScoreChanged(),
+				StatusChanged: item.Change.StatusChanged(),
+			}
+			if (only == "score" && !change.ScoreChanged) || (only == "status" && !change.StatusChanged) {
+				continue
+			}
+			changes = append(changes, change)
+		}
+		writeJSON(w, changes)
+	}
+}
@@ -0,0 +1,44 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/kptm-tools/vulnerability-analysis/pkg/intel"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/tenant"
+)
+
+// CVEIntelSource assembles the NVD record, KEV entry, EPSS score, exploit
+// references and risk of a CVE into one document.
+type CVEIntelSource interface {
+	Intel(ctx context.Context, cveID string) (*intel.Document, error)
+}
+
+// cveIntelHandler returns the intel document of a CVE, its risk scored with
+// the CVSS version preferred by the tenant parameter when set.
+func cveIntelHandler(source CVEIntelSource) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		cveID := strings.ToUpper(r.PathValue("cve_id"))
+		if !cveIDPattern.MatchString(cveID) {
+			http.Error(w, "invalid CVE ID", http.StatusBadRequest)
+			return
+		}
+
+		ctx := r.Context()
+		if tenantID := r.URL.Query().Get("tenant"); tenantID != "" {
+			ctx = tenant.WithID(ctx, tenantID)
+		}
+		doc, err := source.Intel(ctx, cveID)
+		if errors.Is(err, intel.ErrNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		writeJSON(w, doc)
+	}
+}
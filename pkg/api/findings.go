@@ -0,0 +1,128 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kptm-tools/vulnerability-analysis/pkg/asset"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/triage"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/vex"
+)
+
+// Page sizes of the findings listing.
+const (
+	defaultFindingsLimit = 100
+	maxFindingsLimit     = 1000
+)
+
+// findingsHandler lists the findings of a tenant, optionally of a host or in
+// a state, a page at a time. Clients pass the next_cursor of a page as the
+// cursor parameter to get the following one.
+func findingsHandler(workflow *triage.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		filter := triage.Filter{Tenant: q.Get("tenant"), Host: asset.Canonical(q.Get("host"))}
+		if filter.Tenant == "" {
+			http.Error(w, "tenant parameter is required", http.StatusBadRequest)
+			return
+		}
+		if raw := q.Get("state"); raw != "" {
+			state, err := triage.ParseState(raw)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			filter.State = state
+		}
+
+		limit := defaultFindingsLimit
+		if raw := q.Get("limit"); raw != "" {
+			n, err := strconv.Atoi(raw)
+			if err != nil || n <= 0 || n > maxFindingsLimit {
+				http.Error(w, "limit parameter must be between 1 and "+strconv.Itoa(maxFindingsLimit), http.StatusBadRequest)
+				return
+			}
+			limit = n
+		}
+
+		page, err := workflow.ListPage(filter, q.Get("cursor"), limit)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		writeJSON(w, page)
+	}
+}
+
+// IdentityHeader carries the user authenticated by the platform gateway in
+// front of the API, which drops it from the requests of clients. Transitions
+// are recorded on behalf of this user.
+const IdentityHeader = "X-Authenticated-User"
+
+// transitionRequest moves the finding of a CVE on a host to State. Closing
+// findings with a Justification records them as not affecting the host.
+type transitionRequest struct {
+	triage.Key
+	State         string `json:"state"`
+	Note          string `json:"note"`
+	Justification string `json:"justification"`
+}
+
+// transitionHandler applies a transition on behalf of the authenticated user
+// and returns the updated finding.
+func transitionHandler(workflow *triage.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		actor := strings.TrimSpace(r.Header.Get(IdentityHeader))
+		if actor == "" {
+			http.Error(w, "transitions require an authenticated user", http.StatusUnauthorized)
+			return
+		}
+		if actor == triage.ScannerActor {
+			http.Error(w, "transitions of the scanner are made by the pipeline", http.StatusForbidden)
+			return
+		}
+
+		var req transitionRequest
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&req); err != nil {
+			http.Error(w, "invalid transition request", http.StatusBadRequest)
+			return
+		}
+		to, err := triage.ParseState(req.State)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		finding, err := workflow.TransitionJustified(req.Key, to, triage.Justification(req.Justification), actor, req.Note, time.Now())
+		switch {
+		case errors.Is(err, triage.ErrMissingActor), errors.Is(err, triage.ErrInvalidJustification):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, triage.ErrUnknownFinding):
+			http.Error(w, err.Error(), http.StatusNotFound)
+		case errors.Is(err, triage.ErrInvalidTransition):
+			http.Error(w, err.Error(), http.StatusConflict)
+		case err != nil:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		default:
+			writeJSON(w, finding)
+		}
+	}
+}
+
+// vexHandler exports the verdicts on the findings of a tenant, optionally of
+// a host, as an OpenVEX document signed by the author parameter.
+func vexHandler(workflow *triage.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		filter := triage.Filter{Tenant: q.Get("tenant"), Host: asset.Canonical(q.Get("host"))}
+		if filter.Tenant == "" {
+			http.Error(w, "tenant parameter is required", http.StatusBadRequest)
+			return
+		}
+		writeJSON(w, vex.Generate(workflow.List(filter), q.Get("author"), time.Now()))
+	}
+}
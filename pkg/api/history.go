@@ -0,0 +1,124 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kptm-tools/common/common/pkg/results/tools"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/asset"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/output"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/results"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/scans"
+)
+
+// hostRevision is the summary of the revision of a host result current at
+// the requested time.
+type hostRevision struct {
+	ScanID     uuid.UUID `json:"scan_id"`
+	ScannedAt  time.Time `json:"scanned_at"`
+	AnalyzedAt time.Time `json:"analyzed_at"`
+	Revision   int       `json:"revision"`
+	output.ResultSummary
+}
+
+// hostResult is a host revision with its findings.
+type hostResult struct {
+	hostRevision
+	Result *results.NmapResult `json:"result"`
+}
+
+func newHostRevision(r scans.Record) hostRevision {
+	return hostRevision{
+		ScanID:        r.ScanID,
+		ScannedAt:     r.ScannedAt,
+		AnalyzedAt:    r.AnalyzedAt,
+		Revision:      r.Revision,
+		ResultSummary: output.Summarize(tools.ToolResult{Result: finalResult(r)}),
+	}
+}
+
+// finalResult is the classified result of a revision, or its enrichment for
+// revisions recorded without one.
+func finalResult(r scans.Record) *results.NmapResult {
+	if r.Final != nil {
+		return r.Final
+	}
+	return r.Result
+}
+
+// parseAsOf returns the as_of parameter of r, accepting the formats of
+// parseTime and defaulting to now.
+func parseAsOf(r *http.Request) (time.Time, error) {
+	return parseTime(r.URL.Query().Get("as_of"), time.Now().UTC())
+}
+
+// hostsAsOfHandler summarizes the latest result of every host of a tenant as
+// it stood at as_of, ignoring the scans and reanalyses made since, e.g. to
+// reconstruct the security posture at the time of an incident.
+// Times before the retained history are answered with 410 Gone.
+func hostsAsOfHandler(store *scans.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tenantID := r.URL.Query().Get("tenant")
+		if tenantID == "" {
+			http.Error(w, "tenant parameter is required", http.StatusBadRequest)
+			return
+		}
+		at, err := parseAsOf(r)
+		if err != nil {
+			http.Error(w, "invalid as_of parameter", http.StatusBadRequest)
+			return
+		}
+
+		records, err := store.AsOf(tenantID, at)
+		if errors.Is(err, scans.ErrHistoryEvicted) {
+			http.Error(w, err.Error(), http.StatusGone)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		hosts := []hostRevision{}
+		for _, record := range records {
+			hosts = append(hosts, newHostRevision(record))
+		}
+		writeJSON(w, hosts)
+	}
+}
+
+// hostResultHandler returns the findings of a host of a scan of the tenant
+// as they stood at as_of.
+func hostResultHandler(store *scans.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tenantID := r.URL.Query().Get("tenant")
+		if tenantID == "" {
+			http.Error(w, "tenant parameter is required", http.StatusBadRequest)
+			return
+		}
+		scanID, err := uuid.Parse(r.PathValue("scan_id"))
+		if err != nil {
+			http.Error(w, "invalid scan ID", http.StatusBadRequest)
+			return
+		}
+		at, err := parseAsOf(r)
+		if err != nil {
+			http.Error(w, "invalid as_of parameter", http.StatusBadRequest)
+			return
+		}
+
+		record, err := store.GetAsOf(scanID, asset.Canonical(r.PathValue("host")), at)
+		if err == nil && record.TenantID != tenantID {
+			err = scans.ErrNotFound
+		}
+		switch {
+		case errors.Is(err, scans.ErrNotFound):
+			http.Error(w, err.Error(), http.StatusNotFound)
+		case err != nil:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		default:
+			writeJSON(w, hostResult{hostRevision: newHostRevision(record), Result: finalResult(record)})
+		}
+	}
+}
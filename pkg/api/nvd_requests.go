@@ -0,0 +1,36 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/kptm-tools/vulnerability-analysis/pkg/services"
+)
+
+// defaultNVDRequests is the number of requests returned when the limit
+// parameter is absent.
+const defaultNVDRequests = 50
+
+// NVDAccessSource reports the latest NVD requests and the quota left.
+type NVDAccessSource interface {
+	AccessReport(n int) services.NVDAccessReport
+}
+
+// nvdRequestsHandler returns the latest NVD requests, newest first, with the
+// tenant and scan they were sent for and the estimated quota left in the
+// rolling window, to tell why enrichments are slow. The limit parameter
+// caps the requests returned, zero returning every one kept.
+func nvdRequestsHandler(source NVDAccessSource) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		limit := defaultNVDRequests
+		if raw := r.URL.Query().Get("limit"); raw != "" {
+			n, err := strconv.Atoi(raw)
+			if err != nil || n < 0 {
+				http.Error(w, "invalid limit parameter", http.StatusBadRequest)
+				return
+			}
+			limit = n
+		}
+		writeJSON(w, source.AccessReport(limit))
+	}
+}
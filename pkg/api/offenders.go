@@ -0,0 +1,20 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/kptm-tools/vulnerability-analysis/pkg/offenders"
+)
+
+// offendersHandler lists the hosts of a tenant on which consecutive scans
+// keep finding new critical CVEs, the longest runs first.
+func offendersHandler(tracker *offenders.Tracker) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tenantID := r.URL.Query().Get("tenant")
+		if tenantID == "" {
+			http.Error(w, "tenant parameter is required", http.StatusBadRequest)
+			return
+		}
+		writeJSON(w, tracker.Offenders(tenantID))
+	}
+}
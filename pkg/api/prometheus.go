@@ -0,0 +1,78 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/kptm-tools/vulnerability-analysis/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	openVulnerabilitiesDesc = prometheus.NewDesc(
+		"vulnerability_analysis_open_vulnerabilities",
+		"Vulnerabilities of the latest result of every host.",
+		[]string{"tenant", "severity"}, nil)
+	hostsDesc = prometheus.NewDesc(
+		"vulnerability_analysis_hosts",
+		"Hosts with a published result.",
+		[]string{"tenant"}, nil)
+	resultsDesc = prometheus.NewDesc(
+		"vulnerability_analysis_results_total",
+		"Published host results.",
+		[]string{"tenant"}, nil)
+	unmappedDesc = prometheus.NewDesc(
+		"vulnerability_analysis_unmapped_metric_values_total",
+		"Findings enriched from NVD metric values the enums don't cover.",
+		[]string{"field", "value"}, nil)
+	rejectedCPEsDesc = prometheus.NewDesc(
+		"vulnerability_analysis_rejected_cpes_total",
+		"CPEs reported by nmap and dropped from the analysis.",
+		[]string{"reason"}, nil)
+)
+
+// recorderCollector collects the current counts of a recorder, and those of
+// the unmapped metric values and rejected CPEs, on every scrape.
+type recorderCollector struct {
+	recorder *metrics.Recorder
+}
+
+var _ prometheus.Collector = recorderCollector{}
+
+func (c recorderCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- openVulnerabilitiesDesc
+	ch <- hostsDesc
+	ch <- resultsDesc
+	ch <- unmappedDesc
+	ch <- rejectedCPEsDesc
+}
+
+func (c recorderCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, s := range c.recorder.Snapshots() {
+		for _, col := range severityColumns(metrics.Point{SeverityCounts: s.SeverityCounts}) {
+			ch <- prometheus.MustNewConstMetric(openVulnerabilitiesDesc, prometheus.GaugeValue, float64(col.count), s.Tenant, col.name)
+		}
+		ch <- prometheus.MustNewConstMetric(hostsDesc, prometheus.GaugeValue, float64(s.Hosts), s.Tenant)
+		ch <- prometheus.MustNewConstMetric(resultsDesc, prometheus.CounterValue, float64(s.Results), s.Tenant)
+	}
+	for _, u := range metrics.Unmapped() {
+		ch <- prometheus.MustNewConstMetric(unmappedDesc, prometheus.CounterValue, float64(u.Count), u.Field, u.Value)
+	}
+	for _, r := range metrics.RejectedCPEs() {
+		ch <- prometheus.MustNewConstMetric(rejectedCPEsDesc, prometheus.CounterValue, float64(r.Count), r.Reason)
+	}
+}
+
+// prometheusHandler exposes the current counts, along with the Go runtime
+// and process metrics, from a Prometheus registry. Compression is left to
+// withCompression.
+func prometheusHandler(recorder *metrics.Recorder) http.Handler {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(
+		recorderCollector{recorder: recorder},
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{DisableCompression: true})
+}
@@ -0,0 +1,59 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/asset"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/output"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/scans"
+)
+
+// Reanalyzer analyzes a host of a previous scan again and publishes its
+// updated result.
+type Reanalyzer interface {
+	Reanalyze(ctx context.Context, scanID uuid.UUID, tenantID, hostAddress, cpe string) (output.ResultSummary, error)
+}
+
+// reanalysisRequest optionally limits the reanalysis to a single CPE.
+type reanalysisRequest struct {
+	CPE string `json:"cpe"`
+}
+
+// reanalysisHandler analyzes a host of a scan of the tenant again, e.g. after
+// a patch window, and returns the summary of the published result.
+func reanalysisHandler(reanalyzer Reanalyzer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tenantID := r.URL.Query().Get("tenant")
+		if tenantID == "" {
+			http.Error(w, "tenant parameter is required", http.StatusBadRequest)
+			return
+		}
+		scanID, err := uuid.Parse(r.PathValue("scan_id"))
+		if err != nil {
+			http.Error(w, "invalid scan ID", http.StatusBadRequest)
+			return
+		}
+
+		// The body is optional, the whole host is analyzed without it
+		var req reanalysisRequest
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+			http.Error(w, "invalid reanalysis request", http.StatusBadRequest)
+			return
+		}
+
+		summary, err := reanalyzer.Reanalyze(r.Context(), scanID, tenantID, asset.Canonical(r.PathValue("host")), req.CPE)
+		switch {
+		case errors.Is(err, scans.ErrNotFound), errors.Is(err, scans.ErrCPENotFound):
+			http.Error(w, err.Error(), http.StatusNotFound)
+		case err != nil:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		default:
+			writeJSON(w, summary)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+// Package api serves the HTTP endpoints of the service.
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/kptm-tools/vulnerability-analysis/pkg/metrics"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/offenders"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/scans"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/triage"
+)
+
+// NewHandler returns the routes of the service API. The finding workflow
+// routes are only served when workflow is set, the reanalysis route when
+// reanalyzer is, the repeat offenders route when tracker is, the routes of
+// past results when history is, the CVE history route when cves is, the
+// CVE intel route when cveIntel is, the NVD requests route when nvdAccess
+// is, the stored findings routes when findings is and the advisories route
+// when advisories is. Responses are compressed with zstd or gzip when the
+// client accepts either.
+func NewHandler(recorder *metrics.Recorder, workflow *triage.Store, reanalyzer Reanalyzer, tracker *offenders.Tracker, history *scans.Store, cves CVEHistorySource, cveIntel CVEIntelSource, nvdAccess NVDAccessSource, findings FindingStore, advisories AdvisorySource, opts ...Option) http.Handler {
+	var options handlerOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v1/dashboard/tenants", tenantsHandler(recorder))
+	mux.HandleFunc("GET /api/v1/dashboard/vulnerabilities", seriesHandler(recorder))
+	mux.Handle("GET /metrics", prometheusHandler(recorder))
+	if workflow != nil {
+		mux.HandleFunc("GET /api/v1/findings", findingsHandler(workflow))
+		mux.HandleFunc("POST /api/v1/findings/transitions", transitionHandler(workflow))
+		mux.HandleFunc("GET /api/v1/findings/vex", vexHandler(workflow))
+	}
+	if reanalyzer != nil {
+		mux.HandleFunc("POST /api/v1/scans/{scan_id}/hosts/{host}/reanalysis", reanalysisHandler(reanalyzer))
+	}
+	if tracker != nil {
+		mux.HandleFunc("GET /api/v1/hosts/repeat-offenders", offendersHandler(tracker))
+	}
+	if history != nil {
+		mux.HandleFunc("GET /api/v1/hosts", hostsAsOfHandler(history))
+		mux.HandleFunc("GET /api/v1/scans/{scan_id}/hosts/{host}", hostResultHandler(history))
+	}
+	if cves != nil {
+		mux.HandleFunc("GET /api/v1/cves/{cve_id}/history", cveHistoryHandler(cves))
+	}
+	if cveIntel != nil {
+		mux.HandleFunc("GET /api/v1/cves/{cve_id}/intel", cveIntelHandler(cveIntel))
+	}
+	if nvdAccess != nil {
+		mux.HandleFunc("GET /api/v1/nvd/requests", nvdRequestsHandler(nvdAccess))
+	}
+	if findings != nil {
+		mux.HandleFunc("GET /api/v1/history/findings", storedFindingsHandler(findings))
+		mux.HandleFunc("GET /api/v1/history/hosts/{host}/scans", storedScansHandler(findings))
+		mux.HandleFunc("GET /api/v1/history/timeline", timelineHandler(findings))
+	}
+	if advisories != nil {
+		mux.HandleFunc("GET /api/v1/advisories/{advisory_id}", advisoryHandler(advisories))
+	}
+	var handler http.Handler = mux
+	if options.canonical {
+		handler = withCanonicalJSON(handler)
+	}
+	return withCompression(handler)
+}
+
+func tenantsHandler(recorder *metrics.Recorder) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, recorder.Tenants())
+	}
+}
+
+// seriesRow is one sample of one severity, the long format Grafana
+// data sources turn into a series per severity.
+type seriesRow struct {
+	Time     int64  `json:"time"` // Unix milliseconds
+	Tenant   string `json:"tenant"`
+	Severity string `json:"severity"`
+	Count    int    `json:"count"`
+}
+
+// seriesHandler returns the vulnerability counts of a tenant over time. from
+// and to accept Unix milliseconds, as sent by Grafana, or RFC 3339 times and
+// default to the last 24 hours.
+func seriesHandler(recorder *metrics.Recorder) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		tenantID := q.Get("tenant")
+		if tenantID == "" {
+			http.Error(w, "tenant parameter is required", http.StatusBadRequest)
+			return
+		}
+
+		now := time.Now().UTC()
+		from, err := parseTime(q.Get("from"), now.Add(-24*time.Hour))
+		if err != nil {
+			http.Error(w, "invalid from parameter", http.StatusBadRequest)
+			return
+		}
+		to, err := parseTime(q.Get("to"), now)
+		if err != nil {
+			http.Error(w, "invalid to parameter", http.StatusBadRequest)
+			return
+		}
+
+		rows := []seriesRow{}
+		for _, p := range recorder.Series(tenantID, from, to) {
+			ms := p.Time.UnixMilli()
+			for _, c := range severityColumns(p) {
+				rows = append(rows, seriesRow{Time: ms, Tenant: tenantID, Severity: c.name, Count: c.count})
+			}
+		}
+		writeJSON(w, rows)
+	}
+}
+
+type severityColumn struct {
+	name  string
+	count int
+}
+
+func severityColumns(p metrics.Point) []severityColumn {
+	return []severityColumn{
+		{"critical", p.Critical},
+		{"high", p.High},
+		{"medium", p.Medium},
+		{"low", p.Low},
+		{"none", p.None},
+		{"unknown", p.Unknown},
+	}
+}
+
+func parseTime(raw string, fallback time.Time) (time.Time, error) {
+	if raw == "" {
+		return fallback, nil
+	}
+	if ms, err := strconv.ParseInt(raw, 10, 64); err == nil {
+		return time.UnixMilli(ms).UTC(), nil
+	}
+	return time.Parse(time.RFC3339, raw)
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
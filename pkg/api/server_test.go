@@ -0,0 +1,634 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kptm-tools/common/common/pkg/results/tools"
+	"github.com/kptm-tools/vulnerability-analysis/nvd/schema"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/advisory"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/intel"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/metrics"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/offenders"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/output"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/results"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/scans"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/services"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/tenant"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/triage"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/vex"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/vulnstore"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDashboardAPI(t *testing.T) {
+	t.Parallel()
+	at := time.Now().UTC().Add(-time.Hour).Truncate(time.Minute)
+	recorder := metrics.NewRecorder(time.Minute, 0)
+	recorder.Record("acme", "10.0.0.1", tools.SeverityCounts{Critical: 2, Low: 1}, at)
+	handler := NewHandler(recorder, nil, nil, nil, nil, nil, nil, nil, nil, nil)
+
+	t.Run("Series", func(t *testing.T) {
+		from := strconv.FormatInt(at.Add(-time.Minute).UnixMilli(), 10)
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/dashboard/vulnerabilities?tenant=acme&from="+from, nil)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		var rows []seriesRow
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &rows))
+		require.Len(t, rows, 6)
+		assert.Equal(t, seriesRow{Time: at.UnixMilli(), Tenant: "acme", Severity: "critical", Count: 2}, rows[0])
+	})
+
+	t.Run("Missing tenant", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/dashboard/vulnerabilities", nil))
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+
+	t.Run("Prometheus", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.Contains(t, rec.Body.String(), `vulnerability_analysis_open_vulnerabilities{severity="critical",tenant="acme"} 2`)
+		assert.Contains(t, rec.Body.String(), `vulnerability_analysis_hosts{tenant="acme"} 1`)
+		assert.Contains(t, rec.Body.String(), "# TYPE vulnerability_analysis_results_total counter")
+		assert.Contains(t, rec.Body.String(), "# TYPE go_goroutines gauge")
+	})
+
+	t.Run("Prometheus label escaping", func(t *testing.T) {
+		// Unlike Go quoting, the text format leaves tabs as they are
+		metrics.CountUnmapped("severity", "back\\slash \"quoted\"\nnew\tline")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.Contains(t, rec.Body.String(), "vulnerability_analysis_unmapped_metric_values_total{field=\"severity\",value=\"back\\\\slash \\\"quoted\\\"\\nnew\tline\"} 1")
+	})
+}
+
+func TestCompression(t *testing.T) {
+	t.Parallel()
+	recorder := metrics.NewRecorder(time.Minute, 0)
+	recorder.Record("acme", "10.0.0.1", tools.SeverityCounts{Critical: 2}, time.Now().UTC())
+	handler := NewHandler(recorder, nil, nil, nil, nil, nil, nil, nil, nil, nil)
+
+	testCases := []struct {
+		name           string
+		acceptEncoding string
+		want           string
+	}{
+		{"None", "", ""},
+		{"Gzip", "gzip", "gzip"},
+		{"Zstd", "zstd", "zstd"},
+		{"Zstd preferred on ties", "gzip, zstd", "zstd"},
+		{"Weights", "zstd;q=0.5, gzip;q=0.8", "gzip"},
+		{"Refused", "gzip;q=0, br", ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/dashboard/tenants", nil)
+			if tc.acceptEncoding != "" {
+				req.Header.Set("Accept-Encoding", tc.acceptEncoding)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			require.Equal(t, http.StatusOK, rec.Code)
+			assert.Equal(t, tc.want, rec.Header().Get("Content-Encoding"))
+			assert.Equal(t, "Accept-Encoding", rec.Header().Get("Vary"))
+			assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+
+			body := rec.Body.Bytes()
+			if tc.want != "" {
+				var err error
+				body, err = output.Decompress(body, output.Encoding(tc.want))
+				require.NoError(t, err)
+			}
+			var tenants []string
+			require.NoError(t, json.Unmarshal(body, &tenants))
+			assert.Len(t, tenants, 1)
+		})
+	}
+
+	t.Run("Errors", func(t *testing.T) {
+		t.Parallel()
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/dashboard/vulnerabilities", nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		require.Equal(t, http.StatusBadRequest, rec.Code)
+		body, err := output.Decompress(rec.Body.Bytes(), output.EncodingGzip)
+		require.NoError(t, err)
+		assert.Contains(t, string(body), "tenant parameter is required")
+	})
+}
+
+func TestCanonicalJSON(t *testing.T) {
+	t.Parallel()
+	workflow := triage.NewStore()
+	paris := time.FixedZone("CET", 3600)
+	require.NoError(t, workflow.Observe("acme", "10.0.0.1", []triage.Detection{{CVE: "CVE-2024-0001"}}, time.Date(2024, 3, 1, 13, 30, 15, 500000000, paris)))
+
+	for _, canonical := range []bool{false, true} {
+		handler := NewHandler(metrics.NewRecorder(time.Minute, 0), workflow, nil, nil, nil, nil, nil, nil, nil, nil, WithCanonicalJSON(canonical))
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/findings/vex?tenant=acme", nil))
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+
+		body := rec.Body.String()
+		assert.Contains(t, body, `"timestamp":"2024-03-01T12:30:15.5Z"`)
+		// The document declares its timestamp before its statements
+		assert.Equal(t, canonical, strings.Index(body, `"statements"`) < strings.Index(body, `"timestamp"`), body)
+	}
+}
+
+func TestFindingWorkflowAPI(t *testing.T) {
+	t.Parallel()
+	workflow := triage.NewStore()
+	require.NoError(t, workflow.Observe("acme", "10.0.0.1", []triage.Detection{{CVE: "CVE-2024-0001"}}, time.Now()))
+	handler := NewHandler(metrics.NewRecorder(time.Minute, 0), workflow, nil, nil, nil, nil, nil, nil, nil, nil)
+
+	transitionAs := func(user, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/findings/transitions", strings.NewReader(body))
+		if user != "" {
+			req.Header.Set(IdentityHeader, user)
+		}
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+	transition := func(body string) *httptest.ResponseRecorder {
+		return transitionAs("alice", body)
+	}
+
+	t.Run("Transition", func(t *testing.T) {
+		rec := transition(`{"tenant":"acme","host":"10.0.0.1","cve":"CVE-2024-0001","state":"triaged","actor":"mallory"}`)
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		var finding triage.Finding
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &finding))
+		assert.Equal(t, triage.StateTriaged, finding.State)
+		assert.Equal(t, "alice", finding.History[1].Actor, "Expected the actor of the body to be ignored")
+	})
+
+	t.Run("Rejected transitions", func(t *testing.T) {
+		assert.Equal(t, http.StatusConflict, transition(`{"tenant":"acme","host":"10.0.0.1","cve":"CVE-2024-0001","state":"verified_fixed"}`).Code)
+		assert.Equal(t, http.StatusNotFound, transition(`{"tenant":"acme","host":"10.0.0.2","cve":"CVE-2024-0001","state":"triaged"}`).Code)
+		assert.Equal(t, http.StatusBadRequest, transition(`{"tenant":"acme","host":"10.0.0.1","cve":"CVE-2024-0001","state":"done"}`).Code)
+		assert.Equal(t, http.StatusUnauthorized, transitionAs("", `{"tenant":"acme","host":"10.0.0.1","cve":"CVE-2024-0001","state":"in_remediation"}`).Code)
+		assert.Equal(t, http.StatusForbidden, transitionAs(triage.ScannerActor, `{"tenant":"acme","host":"10.0.0.1","cve":"CVE-2024-0001","state":"in_remediation"}`).Code)
+	})
+
+	t.Run("List", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/findings?tenant=acme&state=triaged", nil))
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		var page triage.Page
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &page))
+		require.Len(t, page.Findings, 1)
+		assert.Equal(t, "CVE-2024-0001", page.Findings[0].CVE)
+		assert.Equal(t, 1, page.Total)
+		assert.Empty(t, page.NextCursor)
+	})
+
+	t.Run("Paging", func(t *testing.T) {
+		require.NoError(t, workflow.Observe("acme", "10.0.0.3", []triage.Detection{{CVE: "CVE-2024-0002"}, {CVE: "CVE-2024-0003"}, {CVE: "CVE-2024-0004"}}, time.Now()))
+
+		var cves []string
+		cursor := ""
+		for pages := 0; ; pages++ {
+			require.Less(t, pages, 4, "Expected the listing to end")
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/findings?tenant=acme&limit=3&cursor="+cursor, nil))
+			require.Equal(t, http.StatusOK, rec.Code)
+
+			var page triage.Page
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &page))
+			assert.Equal(t, 4, page.Total)
+			for _, f := range page.Findings {
+				cves = append(cves, f.CVE)
+			}
+			if cursor = page.NextCursor; cursor == "" {
+				break
+			}
+		}
+		assert.Equal(t, []string{"CVE-2024-0001", "CVE-2024-0002", "CVE-2024-0003", "CVE-2024-0004"}, cves)
+	})
+
+	t.Run("Invalid paging", func(t *testing.T) {
+		for _, query := range []string{"limit=0", "limit=5000", "limit=ten", "cursor=%21%21"} {
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/findings?tenant=acme&"+query, nil))
+			assert.Equal(t, http.StatusBadRequest, rec.Code, query)
+		}
+	})
+
+	t.Run("VEX", func(t *testing.T) {
+		assert.Equal(t, http.StatusBadRequest, transition(`{"tenant":"acme","host":"10.0.0.3","cve":"CVE-2024-0002","state":"triaged","justification":"component_not_present"}`).Code)
+		assert.Equal(t, http.StatusBadRequest, transition(`{"tenant":"acme","host":"10.0.0.3","cve":"CVE-2024-0002","state":"closed","justification":"not_exploitable"}`).Code)
+		require.Equal(t, http.StatusOK, transition(`{"tenant":"acme","host":"10.0.0.3","cve":"CVE-2024-0002","state":"closed","justification":"component_not_present"}`).Code)
+
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/findings/vex?tenant=acme&host=10.0.0.3&author=acme-psirt", nil))
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		var doc vex.Document
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &doc))
+		assert.Equal(t, vex.Context, doc.Context)
+		assert.Equal(t, "acme-psirt", doc.Author)
+		require.Len(t, doc.Statements, 3)
+		assert.Equal(t, vex.StatusNotAffected, doc.Statements[0].Status)
+		assert.Equal(t, triage.JustificationComponentNotPresent, doc.Statements[0].Justification)
+		assert.Equal(t, vex.StatusUnderInvestigation, doc.Statements[1].Status)
+	})
+}
+
+// stubReanalyzer summarizes the reanalysis of the hosts it knows.
+type stubReanalyzer struct {
+	scanID uuid.UUID
+	cpes   []string
+}
+
+func (s *stubReanalyzer) Reanalyze(ctx context.Context, scanID uuid.UUID, tenantID, hostAddress, cpe string) (output.ResultSummary, error) {
+	if scanID != s.scanID || tenantID != "acme" || hostAddress != "10.0.0.1" {
+		return output.ResultSummary{}, scans.ErrNotFound
+	}
+	if cpe != "" && cpe != "cpe:/a:openbsd:openssh:8.2p1" {
+		return output.ResultSummary{}, scans.ErrCPENotFound
+	}
+	s.cpes = append(s.cpes, cpe)
+	return output.ResultSummary{HostAddress: hostAddress, Vulnerabilities: 3}, nil
+}
+
+func TestReanalysisAPI(t *testing.T) {
+	t.Parallel()
+	reanalyzer := &stubReanalyzer{scanID: uuid.New()}
+	handler := NewHandler(metrics.NewRecorder(time.Minute, 0), nil, reanalyzer, nil, nil, nil, nil, nil, nil, nil)
+
+	reanalyze := func(path, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, path, strings.NewReader(body)))
+		return rec
+	}
+	path := "/api/v1/scans/" + reanalyzer.scanID.String() + "/hosts/10.0.0.1/reanalysis"
+
+	t.Run("Host", func(t *testing.T) {
+		rec := reanalyze(path+"?tenant=acme", "")
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		var summary output.ResultSummary
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &summary))
+		assert.Equal(t, "10.0.0.1", summary.HostAddress)
+		assert.Equal(t, 3, summary.Vulnerabilities)
+	})
+
+	t.Run("CPE", func(t *testing.T) {
+		require.Equal(t, http.StatusOK, reanalyze(path+"?tenant=acme", `{"cpe":"cpe:/a:openbsd:openssh:8.2p1"}`).Code)
+		assert.Equal(t, []string{"", "cpe:/a:openbsd:openssh:8.2p1"}, reanalyzer.cpes)
+	})
+
+	t.Run("Rejected", func(t *testing.T) {
+		assert.Equal(t, http.StatusBadRequest, reanalyze(path, "").Code)
+		assert.Equal(t, http.StatusBadRequest, reanalyze("/api/v1/scans/42/hosts/10.0.0.1/reanalysis?tenant=acme", "").Code)
+		assert.Equal(t, http.StatusBadRequest, reanalyze(path+"?tenant=acme", "{").Code)
+		assert.Equal(t, http.StatusNotFound, reanalyze(path+"?tenant=globex", "").Code)
+		assert.Equal(t, http.StatusNotFound, reanalyze(path+"?tenant=acme", `{"cpe":"cpe:/a:isc:bind:9.16.1"}`).Code)
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		NewHandler(metrics.NewRecorder(time.Minute, 0), nil, nil, nil, nil, nil, nil, nil, nil, nil).ServeHTTP(rec, httptest.NewRequest(http.MethodPost, path+"?tenant=acme", nil))
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+}
+
+func TestRepeatOffendersAPI(t *testing.T) {
+	t.Parallel()
+	tracker := offenders.NewTracker(2)
+	at := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	tracker.Observe("acme", "10.0.0.1", uuid.New(), []string{"CVE-2024-0001"}, at)
+	scanID := uuid.New()
+	tracker.Observe("acme", "10.0.0.1", scanID, []string{"CVE-2024-0002"}, at.Add(24*time.Hour))
+	handler := NewHandler(metrics.NewRecorder(time.Minute, 0), nil, nil, tracker, nil, nil, nil, nil, nil, nil)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/hosts/repeat-offenders?tenant=acme", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	var hosts []offenders.Offender
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &hosts))
+	require.Len(t, hosts, 1)
+	assert.Equal(t, "10.0.0.1", hosts[0].Host)
+	assert.Equal(t, scanID, hosts[0].LastScanID)
+	assert.Equal(t, 2, hosts[0].ConsecutiveScans)
+	assert.Equal(t, []string{"CVE-2024-0001", "CVE-2024-0002"}, hosts[0].NewCriticalCVEs)
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/hosts/repeat-offenders?tenant=globex", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, "[]", rec.Body.String())
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/hosts/repeat-offenders", nil))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestHostsAsOfAPI(t *testing.T) {
+	t.Parallel()
+	store := scans.NewStore(10)
+	scanID := uuid.New()
+	scanned := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	for i, cves := range [][]string{{"CVE-2024-0001", "CVE-2024-0002"}, {"CVE-2024-0001"}} {
+		result := &results.NmapResult{HostAddress: "10.0.0.1", ScannedPorts: []results.PortData{{ID: 22}}}
+		for _, cve := range cves {
+			result.ScannedPorts[0].Vulnerabilities = append(result.ScannedPorts[0].Vulnerabilities, results.Vulnerability{Vulnerability: tools.Vulnerability{ID: cve}})
+		}
+		at := scanned.Add(time.Duration(i) * time.Hour)
+		store.Save(scans.Record{ScanID: scanID, TenantID: "acme", Result: result, Final: result, ScannedAt: at, AnalyzedAt: at})
+	}
+	handler := NewHandler(metrics.NewRecorder(time.Minute, 0), nil, nil, nil, store, nil, nil, nil, nil, nil)
+	get := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec
+	}
+
+	t.Run("Hosts", func(t *testing.T) {
+		rec := get("/api/v1/hosts?tenant=acme&as_of=2024-05-01T12:30:00Z")
+		require.Equal(t, http.StatusOK, rec.Code)
+		var hosts []hostRevision
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &hosts))
+		require.Len(t, hosts, 1)
+		assert.Equal(t, 1, hosts[0].Revision)
+		assert.Equal(t, 2, hosts[0].Vulnerabilities, "Expected the reanalysis made later to be ignored")
+
+		rec = get("/api/v1/hosts?tenant=acme")
+		require.Equal(t, http.StatusOK, rec.Code)
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &hosts))
+		assert.Equal(t, 1, hosts[0].Vulnerabilities)
+	})
+
+	t.Run("Host result", func(t *testing.T) {
+		as := strconv.FormatInt(scanned.Add(30*time.Minute).UnixMilli(), 10)
+		rec := get("/api/v1/scans/" + scanID.String() + "/hosts/10.0.0.1?tenant=acme&as_of=" + as)
+		require.Equal(t, http.StatusOK, rec.Code)
+		var host hostResult
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &host))
+		assert.Equal(t, scanID, host.ScanID)
+		assert.Len(t, host.Result.ScannedPorts[0].Vulnerabilities, 2)
+	})
+
+	t.Run("Rejected", func(t *testing.T) {
+		assert.Equal(t, http.StatusBadRequest, get("/api/v1/hosts").Code)
+		assert.Equal(t, http.StatusBadRequest, get("/api/v1/hosts?tenant=acme&as_of=yesterday").Code)
+		assert.Equal(t, http.StatusNotFound, get("/api/v1/scans/"+scanID.String()+"/hosts/10.0.0.1?tenant=globex").Code)
+		assert.Equal(t, http.StatusNotFound, get("/api/v1/scans/"+scanID.String()+"/hosts/10.0.0.1?tenant=acme&as_of=2024-05-01T00:00:00Z").Code)
+	})
+
+	t.Run("Evicted", func(t *testing.T) {
+		store := scans.NewStore(1)
+		for i, address := range []string{"10.0.0.1", "10.0.0.2"} {
+			at := scanned.Add(time.Duration(i) * time.Hour)
+			store.Save(scans.Record{ScanID: uuid.New(), TenantID: "acme", Result: &results.NmapResult{HostAddress: address}, ScannedAt: at, AnalyzedAt: at})
+		}
+		rec := httptest.NewRecorder()
+		NewHandler(metrics.NewRecorder(time.Minute, 0), nil, nil, nil, store, nil, nil, nil, nil, nil).
+			ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/hosts?tenant=acme&as_of=2024-05-01T12:30:00Z", nil))
+		assert.Equal(t, http.StatusGone, rec.Code)
+	})
+}
+
+type stubCVEHistory struct{}
+
+func (stubCVEHistory) FetchCVEHistory(ctx context.Context, cveID string) (*schema.CveHistoryResponse, error) {
+	return &schema.CveHistoryResponse{CveChanges: []schema.CveChangeItem{
+		{Change: schema.CveChange{CveID: cveID, EventName: "New CVE Received"}},
+		{Change: schema.CveChange{CveID: cveID, EventName: "CVE Modified", Details: []schema.ChangeDetail{{Action: "Changed", Type: "CVSS V3.1"}}}},
+		{Change: schema.CveChange{CveID: cveID, EventName: "CVE Rejected"}},
+	}}, nil
+}
+
+func TestCVEHistoryAPI(t *testing.T) {
+	t.Parallel()
+	handler := NewHandler(metrics.NewRecorder(time.Minute, 0), nil, nil, nil, nil, stubCVEHistory{}, nil, nil, nil, nil)
+	get := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec
+	}
+	events := func(rec *httptest.ResponseRecorder) []string {
+		var changes []cveChange
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &changes))
+		names := []string{}
+		for _, c := range changes {
+			names = append(names, c.EventName)
+		}
+		return names
+	}
+
+	rec := get("/api/v1/cves/cve-2024-0001/history")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, []string{"New CVE Received", "CVE Modified", "CVE Rejected"}, events(rec))
+	assert.Equal(t, []string{"CVE Modified"}, events(get("/api/v1/cves/CVE-2024-0001/history?changes=score")))
+	assert.Equal(t, []string{"CVE Rejected"}, events(get("/api/v1/cves/CVE-2024-0001/history?changes=status")))
+
+	assert.Equal(t, http.StatusBadRequest, get("/api/v1/cves/openssh/history").Code)
+	assert.Equal(t, http.StatusBadRequest, get("/api/v1/cves/CVE-2024-0001/history?changes=cwe").Code)
+}
+
+// stubCVEIntel knows CVE-2024-0001 only, and reports the tenant it was
+// asked for in the model of the risk.
+type stubCVEIntel struct{}
+
+func (stubCVEIntel) Intel(ctx context.Context, cveID string) (*intel.Document, error) {
+	if cveID != "CVE-2024-0001" {
+		return nil, intel.ErrNotFound
+	}
+	return &intel.Document{ID: cveID, Risk: intel.Risk{Model: tenant.FromContext(ctx)}}, nil
+}
+
+func TestCVEIntelAPI(t *testing.T) {
+	t.Parallel()
+	handler := NewHandler(metrics.NewRecorder(time.Minute, 0), nil, nil, nil, nil, nil, stubCVEIntel{}, nil, nil, nil)
+	get := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec
+	}
+
+	rec := get("/api/v1/cves/cve-2024-0001/intel?tenant=acme")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var doc intel.Document
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &doc))
+	assert.Equal(t, "CVE-2024-0001", doc.ID)
+	assert.Equal(t, "acme", doc.Risk.Model)
+
+	assert.Equal(t, http.StatusNotFound, get("/api/v1/cves/CVE-2024-0002/intel").Code)
+	assert.Equal(t, http.StatusBadRequest, get("/api/v1/cves/openssh/intel").Code)
+}
+
+// stubAdvisories resolves GHSA-jfh8-c2jp-5v3q to two CVEs, the second one
+// failing to enrich.
+type stubAdvisories struct{}
+
+func (stubAdvisories) EnrichByIdentifiers(ctx context.Context, ids []string) ([]results.Vulnerability, error) {
+	switch ids[0] {
+	case "GHSA-jfh8-c2jp-5v3q":
+		return []results.Vulnerability{{Vulnerability: tools.Vulnerability{ID: "CVE-2021-44228"}}}, errors.Join(fmt.Errorf("failed to enrich CVE-2021-45046 (from %s): %w", ids[0], services.ErrCVENotFound))
+	case "RHSA-2021:5138":
+		return nil, fmt.Errorf("failed to resolve RHSA advisory %s: %w", ids[0], advisory.ErrAdvisoryNotFound)
+	default:
+		return nil, errors.New("advisory tracker unavailable")
+	}
+}
+
+func TestAdvisoryAPI(t *testing.T) {
+	t.Parallel()
+	handler := NewHandler(metrics.NewRecorder(time.Minute, 0), nil, nil, nil, nil, nil, nil, nil, nil, stubAdvisories{})
+	get := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec
+	}
+
+	rec := get("/api/v1/advisories/GHSA-jfh8-c2jp-5v3q")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var result advisoryResult
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &result))
+	assert.Equal(t, advisory.IdentifierGHSA, result.Type)
+	require.Len(t, result.Vulnerabilities, 1)
+	assert.Equal(t, "CVE-2021-44228", result.Vulnerabilities[0].ID)
+	require.Len(t, result.Errors, 1)
+	assert.Contains(t, result.Errors[0], "CVE-2021-45046")
+
+	assert.Equal(t, http.StatusNotFound, get("/api/v1/advisories/RHSA-2021:5138").Code)
+	assert.Equal(t, http.StatusBadGateway, get("/api/v1/advisories/DSA-5022-1").Code)
+	assert.Equal(t, http.StatusBadRequest, get("/api/v1/advisories/USN-5192-1").Code)
+}
+
+// stubNVDAccess reports n requests.
+type stubNVDAccess struct{}
+
+func (stubNVDAccess) AccessReport(n int) services.NVDAccessReport {
+	return services.NVDAccessReport{
+		Quota:    &services.NVDQuota{Requests: 5, Remaining: 5},
+		Requests: make([]services.NVDRequest, n),
+	}
+}
+
+func TestNVDRequestsAPI(t *testing.T) {
+	t.Parallel()
+	handler := NewHandler(metrics.NewRecorder(time.Minute, 0), nil, nil, nil, nil, nil, nil, stubNVDAccess{}, nil, nil)
+	get := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec
+	}
+
+	rec := get("/api/v1/nvd/requests")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var report services.NVDAccessReport
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &report))
+	assert.Len(t, report.Requests, defaultNVDRequests)
+	assert.Equal(t, 5, report.Quota.Remaining)
+
+	require.NoError(t, json.Unmarshal(get("/api/v1/nvd/requests?limit=3").Body.Bytes(), &report))
+	assert.Len(t, report.Requests, 3)
+	assert.Equal(t, http.StatusBadRequest, get("/api/v1/nvd/requests?limit=-1").Code)
+}
+
+// stubFindingStore stores the findings of a scan of 10.0.0.5 for acme.
+type stubFindingStore struct {
+	filter *vulnstore.Filter
+}
+
+func (s stubFindingStore) Findings(_ context.Context, filter vulnstore.Filter) ([]vulnstore.Finding, error) {
+	*s.filter = filter
+	if filter.TenantID != "acme" {
+		return nil, nil
+	}
+	return []vulnstore.Finding{{TenantID: "acme", HostAddress: "10.0.0.5", Port: 22}}, nil
+}
+
+func (s stubFindingStore) Scans(_ context.Context, tenantID, host string, n int) ([]vulnstore.HostScan, error) {
+	if tenantID != "acme" || host != "10.0.0.5" {
+		return nil, nil
+	}
+	return []vulnstore.HostScan{{TenantID: "acme", HostAddress: host, Findings: n}}, nil
+}
+
+func (s stubFindingStore) Timeline(_ context.Context, filter vulnstore.TimelineFilter) ([]vulnstore.CVETimeline, error) {
+	if filter.TenantID != "acme" || (filter.Host != "10.0.0.5" && filter.CPE != "cpe:2.3:a:openbsd:openssh:8.2:*:*:*:*:*:*:*") {
+		return nil, nil
+	}
+	return []vulnstore.CVETimeline{{HostAddress: "10.0.0.5", CVE: "CVE-2024-6387", Scans: 2, Open: true}}, nil
+}
+
+func TestStoredFindingsAPI(t *testing.T) {
+	t.Parallel()
+	var filter vulnstore.Filter
+	handler := NewHandler(metrics.NewRecorder(time.Minute, 0), nil, nil, nil, nil, nil, nil, nil, stubFindingStore{filter: &filter}, nil)
+	get := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec
+	}
+
+	scanID := uuid.New()
+	rec := get("/api/v1/history/findings?tenant=acme&host=10.0.0.5&cve=CVE-2024-6387&scan_id=" + scanID.String() + "&since=2024-06-01T00:00:00Z&limit=10")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var findings []vulnstore.Finding
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &findings))
+	require.Len(t, findings, 1)
+	assert.Equal(t, uint16(22), findings[0].Port)
+	assert.Equal(t, vulnstore.Filter{
+		TenantID: "acme",
+		Host:     "10.0.0.5",
+		CVE:      "CVE-2024-6387",
+		ScanID:   scanID,
+		Since:    time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC),
+		Limit:    10,
+	}, filter)
+
+	rec = get("/api/v1/history/findings?tenant=globex")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, "[]", rec.Body.String())
+	assert.Equal(t, http.StatusBadRequest, get("/api/v1/history/findings").Code)
+	assert.Equal(t, http.StatusBadRequest, get("/api/v1/history/findings?tenant=acme&scan_id=1").Code)
+	assert.Equal(t, http.StatusBadRequest, get("/api/v1/history/findings?tenant=acme&since=yesterday").Code)
+
+	rec = get("/api/v1/history/hosts/10.0.0.5/scans?tenant=acme&limit=3")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var scans []vulnstore.HostScan
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &scans))
+	require.Len(t, scans, 1)
+	assert.Equal(t, 3, scans[0].Findings)
+	assert.Equal(t, http.StatusBadRequest, get("/api/v1/history/hosts/10.0.0.5/scans").Code)
+
+	for _, query := range []string{"host=10.0.0.5", "cpe=cpe:2.3:a:openbsd:openssh:8.2:*:*:*:*:*:*:*"} {
+		rec = get("/api/v1/history/timeline?tenant=acme&" + query)
+		require.Equal(t, http.StatusOK, rec.Code)
+		var timeline []vulnstore.CVETimeline
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &timeline))
+		require.Len(t, timeline, 1)
+		assert.Equal(t, "CVE-2024-6387", timeline[0].CVE)
+	}
+	rec = get("/api/v1/history/timeline?tenant=globex&host=10.0.0.5")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, "[]", rec.Body.String())
+	assert.Equal(t, http.StatusBadRequest, get("/api/v1/history/timeline?host=10.0.0.5").Code)
+	assert.Equal(t, http.StatusBadRequest, get("/api/v1/history/timeline?tenant=acme").Code)
+}
@@ -0,0 +1,131 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/vulnstore"
+)
+
+// FindingStore queries the findings persisted across scans.
+type FindingStore interface {
+	Findings(ctx context.Context, filter vulnstore.Filter) ([]vulnstore.Finding, error)
+	Scans(ctx context.Context, tenantID, host string, n int) ([]vulnstore.HostScan, error)
+	Timeline(ctx context.Context, filter vulnstore.TimelineFilter) ([]vulnstore.CVETimeline, error)
+}
+
+// storedFindingsHandler returns the findings stored for a tenant, the latest
+// scans first, optionally of a host, CVE or scan, and scanned between since
+// and until, which accept the formats of parseTime.
+func storedFindingsHandler(store FindingStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		filter := vulnstore.Filter{TenantID: q.Get("tenant"), Host: q.Get("host"), CVE: q.Get("cve")}
+		if filter.TenantID == "" {
+			http.Error(w, "tenant parameter is required", http.StatusBadRequest)
+			return
+		}
+		if raw := q.Get("scan_id"); raw != "" {
+			scanID, err := uuid.Parse(raw)
+			if err != nil {
+				http.Error(w, "invalid scan_id parameter", http.StatusBadRequest)
+				return
+			}
+			filter.ScanID = scanID
+		}
+		var err error
+		if filter.Since, err = parseTime(q.Get("since"), time.Time{}); err != nil {
+			http.Error(w, "invalid since parameter", http.StatusBadRequest)
+			return
+		}
+		if filter.Until, err = parseTime(q.Get("until"), time.Time{}); err != nil {
+			http.Error(w, "invalid until parameter", http.StatusBadRequest)
+			return
+		}
+		if filter.Limit, err = parseLimit(q.Get("limit")); err != nil {
+			http.Error(w, "invalid limit parameter", http.StatusBadRequest)
+			return
+		}
+
+		findings, err := store.Findings(r.Context(), filter)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if findings == nil {
+			findings = []vulnstore.Finding{}
+		}
+		writeJSON(w, findings)
+	}
+}
+
+// storedScansHandler returns the stored scans of a host of a tenant, the
+// latest first, with the number of findings of each.
+func storedScansHandler(store FindingStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tenantID := r.URL.Query().Get("tenant")
+		if tenantID == "" {
+			http.Error(w, "tenant parameter is required", http.StatusBadRequest)
+			return
+		}
+		limit, err := parseLimit(r.URL.Query().Get("limit"))
+		if err != nil {
+			http.Error(w, "invalid limit parameter", http.StatusBadRequest)
+			return
+		}
+
+		scans, err := store.Scans(r.Context(), tenantID, r.PathValue("host"), limit)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if scans == nil {
+			scans = []vulnstore.HostScan{}
+		}
+		writeJSON(w, scans)
+	}
+}
+
+// timelineHandler returns the history of the CVEs of a host or CPE of a
+// tenant across the stored scans: when each was first and last seen, its
+// severity changes and when it was fixed.
+func timelineHandler(store FindingStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		filter := vulnstore.TimelineFilter{TenantID: q.Get("tenant"), Host: q.Get("host"), CPE: q.Get("cpe")}
+		if filter.TenantID == "" {
+			http.Error(w, "tenant parameter is required", http.StatusBadRequest)
+			return
+		}
+		if filter.Host == "" && filter.CPE == "" {
+			http.Error(w, "host or cpe parameter is required", http.StatusBadRequest)
+			return
+		}
+
+		timeline, err := store.Timeline(r.Context(), filter)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if timeline == nil {
+			timeline = []vulnstore.CVETimeline{}
+		}
+		writeJSON(w, timeline)
+	}
+}
+
+// parseLimit parses a limit parameter, zero when absent.
+func parseLimit(raw string) (int, error) {
+	if raw == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil || n < 0 {
+		return 0, errors.New("invalid limit")
+	}
+	return n, nil
+}
@@ -0,0 +1,133 @@
+// Package asset resolves the identity of scanned hosts. Hosts are known by
+// IPv4 and IPv6 addresses, possibly several, and by DNS names, written in
+// more than one way: 2001:DB8::1 and 2001:db8:0:0:0:0:0:1 are the same
+// address, Host.Example.com. and host.example.com the same name. Results,
+// storage keys and finding hashes use the canonical forms returned here so
+// that a host keeps a single identity across scans.
+package asset
+
+import (
+	"net/netip"
+	"slices"
+	"strings"
+)
+
+// Kind is the type of a host identifier.
+type Kind string
+
+const (
+	KindIPv4     Kind = "ipv4"
+	KindIPv6     Kind = "ipv6"
+	KindHostname Kind = "hostname"
+)
+
+// Identity is the resolved identity of a host.
+type Identity struct {
+	// Key identifies the host in results and storage: its primary address,
+	// or its first hostname when no address is known.
+	Key string
+	// Addresses are the canonical IP addresses of the host, the primary
+	// address first.
+	Addresses []string
+	// Hostnames are the canonical DNS names of the host, in the order they
+	// were reported.
+	Hostnames []string
+}
+
+// Canonical returns the canonical form of a host identifier: IP addresses in
+// their RFC 5952 text, with IPv4-mapped IPv6 addresses as IPv4 and brackets
+// removed, and hostnames in lower case without the trailing dot.
+func Canonical(id string) string {
+	id = strings.TrimSpace(id)
+	if addr, ok := parseAddr(id); ok {
+		return addr.String()
+	}
+	return strings.TrimSuffix(strings.ToLower(id), ".")
+}
+
+// KindOf returns the type of a host identifier.
+func KindOf(id string) Kind {
+	addr, ok := parseAddr(strings.TrimSpace(id))
+	switch {
+	case !ok:
+		return KindHostname
+	case addr.Is4():
+		return KindIPv4
+	default:
+		return KindIPv6
+	}
+}
+
+// Resolve returns the identity of a host known by addresses and hostnames,
+// which may hold duplicates and identifiers written in any form. Addresses
+// that don't parse as IPs are ignored. The primary address is the first
+// IPv4 address, or else the first globally routable IPv6 address, or else
+// the first IPv6 address, so that the key of a host doesn't depend on the
+// order its addresses were reported in.
+func Resolve(addresses, hostnames []string) Identity {
+	var id Identity
+	var parsed []netip.Addr
+	for _, a := range addresses {
+		addr, ok := parseAddr(strings.TrimSpace(a))
+		if !ok || slices.Contains(parsed, addr) {
+			continue
+		}
+		parsed = append(parsed, addr)
+	}
+	if i := primary(parsed); i > 0 {
+		addr := parsed[i]
+		parsed = slices.Insert(slices.Delete(parsed, i, i+1), 0, addr)
+	}
+	for _, addr := range parsed {
+		id.Addresses = append(id.Addresses, addr.String())
+	}
+
+	for _, h := range hostnames {
+		name := Canonical(h)
+		if name != "" && KindOf(name) == KindHostname && !slices.Contains(id.Hostnames, name) {
+			id.Hostnames = append(id.Hostnames, name)
+		}
+	}
+
+	switch {
+	case len(id.Addresses) > 0:
+		id.Key = id.Addresses[0]
+	case len(id.Hostnames) > 0:
+		id.Key = id.Hostnames[0]
+	}
+	return id
+}
+
+// Matches reports whether target, an address or hostname written in any
+// form, identifies the host.
+func (id Identity) Matches(target string) bool {
+	target = Canonical(target)
+	return target != "" && (slices.Contains(id.Addresses, target) || slices.Contains(id.Hostnames, target))
+}
+
+// primary returns the index of the primary address of addrs, -1 when empty.
+func primary(addrs []netip.Addr) int {
+	if i := slices.IndexFunc(addrs, netip.Addr.Is4); i >= 0 {
+		return i
+	}
+	if i := slices.IndexFunc(addrs, func(a netip.Addr) bool {
+		return a.IsGlobalUnicast() && !a.IsPrivate()
+	}); i >= 0 {
+		return i
+	}
+	if len(addrs) > 0 {
+		return 0
+	}
+	return -1
+}
+
+// parseAddr parses an IP address, bracketed or not, unmapping IPv4-mapped
+// IPv6 addresses.
+func parseAddr(s string) (netip.Addr, bool) {
+	s = strings.TrimSuffix(strings.TrimPrefix(s, "["), "]")
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return addr.Unmap(), true
+}
@@ -0,0 +1,82 @@
+package asset
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCanonical(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		id   string
+		want string
+		kind Kind
+	}{
+		{id: "10.0.0.1", want: "10.0.0.1", kind: KindIPv4},
+		{id: "::ffff:10.0.0.1", want: "10.0.0.1", kind: KindIPv4},
+		{id: "2001:DB8:0:0:0:0:0:1", want: "2001:db8::1", kind: KindIPv6},
+		{id: "[2001:db8::1]", want: "2001:db8::1", kind: KindIPv6},
+		{id: "fe80::1%eth0", want: "fe80::1%eth0", kind: KindIPv6},
+		{id: " Host.Example.COM. ", want: "host.example.com", kind: KindHostname},
+		{id: "", want: "", kind: KindHostname},
+	}
+	for _, tt := range tests {
+		t.Run(tt.id, func(t *testing.T) {
+			assert.Equal(t, tt.want, Canonical(tt.id))
+			assert.Equal(t, tt.kind, KindOf(tt.id))
+		})
+	}
+}
+
+func TestResolve(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name      string
+		addresses []string
+		hostnames []string
+		want      Identity
+	}{
+		{
+			name:      "IPv4 is primary",
+			addresses: []string{"2001:DB8::1", "10.0.0.1", "2001:db8:0::1"},
+			hostnames: []string{"DB.example.com.", "db.example.com", "db"},
+			want: Identity{
+				Key:       "10.0.0.1",
+				Addresses: []string{"10.0.0.1", "2001:db8::1"},
+				Hostnames: []string{"db.example.com", "db"},
+			},
+		},
+		{
+			name:      "global IPv6 before link-local",
+			addresses: []string{"fe80::1", "2001:db8::1"},
+			want:      Identity{Key: "2001:db8::1", Addresses: []string{"2001:db8::1", "fe80::1"}},
+		},
+		{
+			name:      "hostname only",
+			addresses: []string{"not-an-ip"},
+			hostnames: []string{"Web.example.com"},
+			want:      Identity{Key: "web.example.com", Hostnames: []string{"web.example.com"}},
+		},
+		{
+			name:      "addresses aren't hostnames",
+			hostnames: []string{"10.0.0.1"},
+			want:      Identity{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, Resolve(tt.addresses, tt.hostnames))
+		})
+	}
+}
+
+func TestIdentity_Matches(t *testing.T) {
+	t.Parallel()
+	id := Resolve([]string{"10.0.0.1", "2001:db8::1"}, []string{"db.example.com"})
+	assert.True(t, id.Matches("10.0.0.1"))
+	assert.True(t, id.Matches("2001:DB8:0:0::1"))
+	assert.True(t, id.Matches("DB.example.com."))
+	assert.False(t, id.Matches("10.0.0.2"))
+	assert.False(t, id.Matches(""))
+}
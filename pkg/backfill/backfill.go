@@ -0,0 +1,174 @@
+// Package backfill fills the fields introduced after findings were stored in
+// the search indices, e.g. the CWEs, a batch at a time and resuming from a
+// checkpoint after an interruption.
+package backfill
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/kptm-tools/vulnerability-analysis/pkg/search"
+)
+
+// Store holds the findings to backfill, implemented by search.Indexer.
+type Store interface {
+	Missing(ctx context.Context, field string, after []any, size int) ([]search.Hit, error)
+	Update(ctx context.Context, updates []search.Update) (int, error)
+}
+
+// Field fills a field of stored findings.
+type Field interface {
+	// Name is the field of search.Document filled, e.g. "cwes".
+	Name() string
+	// Value returns the value of the field for doc, nil when it is unknown,
+	// in which case the finding is only marked as backfilled.
+	Value(ctx context.Context, doc search.Document) (any, error)
+}
+
+// Job backfills Fields of the findings of Store, BatchSize findings at a
+// time, waiting Interval between batches. The position of every field is
+// saved after each batch to CheckpointPath, when set, so that an interrupted
+// job resumes where it stopped.
+type Job struct {
+	Store          Store
+	Fields         []Field
+	BatchSize      int
+	Interval       time.Duration
+	CheckpointPath string
+}
+
+// FieldReport counts the findings a field was backfilled for.
+type FieldReport struct {
+	Field   string `json:"field"`
+	Scanned int    `json:"scanned"`
+	Filled  int    `json:"filled"`
+	Unknown int    `json:"unknown"`
+	Failed  int    `json:"failed"`
+}
+
+// checkpoint holds the sort values of the last finding backfilled per field.
+type checkpoint map[string][]any
+
+// Run backfills every field in turn, until no stored finding lacks it.
+func (j *Job) Run(ctx context.Context) ([]FieldReport, error) {
+	cp, err := j.loadCheckpoint()
+	if err != nil {
+		return nil, err
+	}
+
+	var reports []FieldReport
+	for _, field := range j.Fields {
+		report, err := j.runField(ctx, field, cp)
+		reports = append(reports, report)
+		if err != nil {
+			return reports, fmt.Errorf("failed to backfill %s: %w", field.Name(), err)
+		}
+	}
+	return reports, nil
+}
+
+func (j *Job) runField(ctx context.Context, field Field, cp checkpoint) (FieldReport, error) {
+	name := field.Name()
+	report := FieldReport{Field: name}
+	for {
+		hits, err := j.Store.Missing(ctx, name, cp[name], max(j.BatchSize, 1))
+		if err != nil {
+			return report, err
+		}
+		if len(hits) == 0 {
+			// Findings that failed are retried by the next run
+			delete(cp, name)
+			return report, j.saveCheckpoint(cp)
+		}
+
+		updates := make([]search.Update, 0, len(hits))
+		for _, hit := range hits {
+			report.Scanned++
+			value, err := field.Value(ctx, hit.Document)
+			if err != nil {
+				if ctx.Err() != nil {
+					return report, ctx.Err()
+				}
+				report.Failed++
+				slog.Warn("Failed to backfill finding",
+					slog.String("field", name),
+					slog.String("cve", hit.Document.CVE),
+					slog.Any("error", err))
+				continue
+			}
+
+			fields := map[string]any{"backfilled": append(slices.Clone(hit.Document.Backfilled), name)}
+			if value != nil {
+				fields[name] = value
+				report.Filled++
+			} else {
+				report.Unknown++
+			}
+			updates = append(updates, search.Update{Index: hit.Index, ID: hit.ID, Fields: fields})
+		}
+
+		if _, err := j.Store.Update(ctx, updates); err != nil {
+			return report, err
+		}
+		cp[name] = hits[len(hits)-1].Sort
+		if err := j.saveCheckpoint(cp); err != nil {
+			return report, err
+		}
+		slog.Info("Backfilled findings",
+			slog.String("field", name),
+			slog.Int("scanned", report.Scanned),
+			slog.Int("filled", report.Filled))
+
+		if j.Interval > 0 {
+			select {
+			case <-time.After(j.Interval):
+			case <-ctx.Done():
+				return report, ctx.Err()
+			}
+		}
+	}
+}
+
+func (j *Job) loadCheckpoint() (checkpoint, error) {
+	cp := checkpoint{}
+	if j.CheckpointPath == "" {
+		return cp, nil
+	}
+	data, err := os.ReadFile(j.CheckpointPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return cp, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read backfill checkpoint: %w", err)
+	}
+	if err := json.Unmarshal(data, &cp); err != nil {
+		return nil, fmt.Errorf("failed to decode backfill checkpoint: %w", err)
+	}
+	return cp, nil
+}
+
+// saveCheckpoint replaces the checkpoint file atomically, so an interruption
+// while writing keeps the previous position.
+func (j *Job) saveCheckpoint(cp checkpoint) error {
+	if j.CheckpointPath == "" {
+		return nil
+	}
+	data, err := json.Marshal(cp)
+	if err != nil {
+		return fmt.Errorf("failed to encode backfill checkpoint: %w", err)
+	}
+	tmp := j.CheckpointPath + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write backfill checkpoint: %w", err)
+	}
+	if err := os.Rename(tmp, j.CheckpointPath); err != nil {
+		return fmt.Errorf("failed to write backfill checkpoint: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,180 @@
+package backfill
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/kptm-tools/vulnerability-analysis/pkg/intel"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/results"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/search"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/services"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryStore keeps findings in order, their sort value being their index.
+type memoryStore struct {
+	docs     []search.Document
+	searches int
+	failAt   int // fails the search with this count, when positive
+}
+
+func (s *memoryStore) Missing(ctx context.Context, field string, after []any, size int) ([]search.Hit, error) {
+	s.searches++
+	if s.searches == s.failAt {
+		return nil, errors.New("cluster unavailable")
+	}
+	start := 0
+	if after != nil {
+		start = int(after[0].(float64)) + 1
+	}
+	var hits []search.Hit
+	for i := start; i < len(s.docs) && len(hits) < size; i++ {
+		doc := s.docs[i]
+		if slices.Contains(doc.Backfilled, field) || (field == "cwes" && doc.CWEs != nil) || (field == "title" && doc.Title != "") ||
+			(field == "epss" && doc.EPSS != nil) || (field == "known_exploited" && doc.KnownExploited) {
+			continue
+		}
+		hits = append(hits, search.Hit{ID: fmt.Sprint(i), Document: doc, Sort: []any{float64(i)}})
+	}
+	return hits, nil
+}
+
+func (s *memoryStore) Update(ctx context.Context, updates []search.Update) (int, error) {
+	for _, u := range updates {
+		var i int
+		fmt.Sscan(u.ID, &i)
+		if cwes, ok := u.Fields["cwes"]; ok {
+			s.docs[i].CWEs = cwes.([]string)
+		}
+		if title, ok := u.Fields["title"]; ok {
+			s.docs[i].Title = title.(string)
+		}
+		if epss, ok := u.Fields["epss"]; ok {
+			probability := epss.(float64)
+			s.docs[i].EPSS = &probability
+		}
+		if kev, ok := u.Fields["known_exploited"]; ok {
+			s.docs[i].KnownExploited = kev.(bool)
+		}
+		s.docs[i].Backfilled = u.Fields["backfilled"].([]string)
+	}
+	return len(updates), nil
+}
+
+// stubEnricher knows the CWEs of some CVEs and counts the lookups.
+type stubEnricher struct {
+	cwes    map[string][]string
+	kev     map[string]bool
+	lookups int
+}
+
+func (e *stubEnricher) EnrichByIdentifiers(ctx context.Context, ids []string) ([]results.Vulnerability, error) {
+	e.lookups++
+	cwes, ok := e.cwes[ids[0]]
+	if !ok {
+		return nil, fmt.Errorf("failed to enrich %s: %w", ids[0], services.ErrCVENotFound)
+	}
+	vuln := results.Vulnerability{CWEs: cwes}
+	vuln.ID = ids[0]
+	vuln.Description = "Allows remote attackers to execute arbitrary code."
+	vuln.KnownExploited = e.kev[ids[0]]
+	return []results.Vulnerability{vuln}, nil
+}
+
+func TestJob_Run(t *testing.T) {
+	t.Parallel()
+	store := &memoryStore{docs: []search.Document{
+		{CVE: "CVE-2024-0001", Port: 22, Product: "OpenSSH"},
+		{CVE: "CVE-2024-0002", OS: "Linux 5.4"},
+		{CVE: "CVE-2024-0001", Port: 2222, Product: "OpenSSH"},
+		{CVE: "CVE-2024-0003", CWEs: []string{"CWE-79"}, Title: "Cross-Site Scripting — CVE-2024-0003"},
+		{CVE: "CVE-2024-0004", Port: 443, Product: "nginx"},
+	}}
+	enricher := &stubEnricher{cwes: map[string][]string{"CVE-2024-0001": {"CWE-787"}, "CVE-2024-0002": {"CWE-416"}}}
+	fields, err := Fields(NewCVELookup(enricher), nil, "cwes", " title")
+	require.NoError(t, err)
+
+	checkpoint := filepath.Join(t.TempDir(), "checkpoint.json")
+	store.failAt = 2
+	job := &Job{Store: store, Fields: fields, BatchSize: 2, CheckpointPath: checkpoint}
+
+	// The search of the second batch fails, the next run resumes after the first
+	_, err = job.Run(context.Background())
+	require.Error(t, err)
+	assert.Equal(t, []string{"CWE-787"}, store.docs[0].CWEs)
+	assert.Equal(t, []string{"CWE-416"}, store.docs[1].CWEs)
+	assert.Nil(t, store.docs[2].CWEs)
+
+	reports, err := job.Run(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []FieldReport{
+		{Field: "cwes", Scanned: 2, Filled: 1, Unknown: 1},
+		{Field: "title", Scanned: 4, Filled: 4},
+	}, reports)
+
+	assert.Equal(t, []string{"cwes", "title"}, store.docs[4].Backfilled, "Expected unknown CVEs to be marked as backfilled")
+	assert.Equal(t, "OpenSSH Remote Code Execution — CVE-2024-0001", store.docs[2].Title)
+	assert.Equal(t, "Linux 5.4 Remote Code Execution — CVE-2024-0002", store.docs[1].Title)
+	assert.Equal(t, "nginx Vulnerability — CVE-2024-0004", store.docs[4].Title)
+	assert.Equal(t, "Cross-Site Scripting — CVE-2024-0003", store.docs[3].Title)
+	assert.Equal(t, 3, enricher.lookups, "Expected a single lookup per CVE")
+
+	// Nothing is left to backfill
+	reports, err = job.Run(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []FieldReport{{Field: "cwes"}, {Field: "title"}}, reports)
+}
+
+// stubEPSS scores some CVEs and counts the lookups.
+type stubEPSS struct {
+	scores  map[string]float64
+	lookups int
+}
+
+func (s *stubEPSS) EPSS(ctx context.Context, cveID string) (*intel.EPSSScore, error) {
+	s.lookups++
+	probability, ok := s.scores[cveID]
+	if !ok {
+		return nil, nil
+	}
+	return &intel.EPSSScore{Probability: probability}, nil
+}
+
+func TestJob_Run_ExploitFields(t *testing.T) {
+	t.Parallel()
+	store := &memoryStore{docs: []search.Document{
+		{CVE: "CVE-2021-44228", Port: 8080},
+		{CVE: "CVE-2024-0001", Port: 22},
+		{CVE: "CVE-2021-44228", Port: 8443},
+	}}
+	enricher := &stubEnricher{cwes: map[string][]string{"CVE-2021-44228": {"CWE-502"}, "CVE-2024-0001": {"CWE-787"}}, kev: map[string]bool{"CVE-2021-44228": true}}
+	epss := &stubEPSS{scores: map[string]float64{"CVE-2021-44228": 0.97}}
+	fields, err := Fields(NewCVELookup(enricher), epss, "kev", "epss")
+	require.NoError(t, err)
+
+	reports, err := (&Job{Store: store, Fields: fields, BatchSize: 10}).Run(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []FieldReport{
+		{Field: "known_exploited", Scanned: 3, Filled: 2, Unknown: 1},
+		{Field: "epss", Scanned: 3, Filled: 2, Unknown: 1},
+	}, reports)
+	assert.True(t, store.docs[2].KnownExploited)
+	assert.False(t, store.docs[1].KnownExploited)
+	require.NotNil(t, store.docs[0].EPSS)
+	assert.Equal(t, 0.97, *store.docs[0].EPSS)
+	assert.Nil(t, store.docs[1].EPSS)
+	assert.Equal(t, 2, epss.lookups, "Expected a single EPSS lookup per CVE")
+}
+
+func TestFields_Unknown(t *testing.T) {
+	t.Parallel()
+	_, err := Fields(NewCVELookup(&stubEnricher{}), nil, "exploits")
+	assert.ErrorContains(t, err, "unknown backfill field")
+	_, err = Fields(NewCVELookup(&stubEnricher{}), nil, "epss")
+	assert.ErrorContains(t, err, "requires an EPSS source")
+}
@@ -0,0 +1,160 @@
+package backfill
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/kptm-tools/vulnerability-analysis/pkg/intel"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/interfaces"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/results"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/search"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/services"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/titles"
+)
+
+// CVELookup enriches CVEs through NVD, once per CVE however many stored
+// findings share it.
+type CVELookup struct {
+	enricher interfaces.IEnrichmentService
+
+	mu    sync.Mutex
+	cache map[string]*results.Vulnerability
+}
+
+// NewCVELookup returns a lookup enriching CVEs with enricher.
+func NewCVELookup(enricher interfaces.IEnrichmentService) *CVELookup {
+	return &CVELookup{enricher: enricher, cache: make(map[string]*results.Vulnerability)}
+}
+
+// Lookup returns the enriched CVE, nil when NVD doesn't know it.
+func (l *CVELookup) Lookup(ctx context.Context, cveID string) (*results.Vulnerability, error) {
+	l.mu.Lock()
+	vuln, ok := l.cache[cveID]
+	l.mu.Unlock()
+	if ok {
+		return vuln, nil
+	}
+
+	vulns, err := l.enricher.EnrichByIdentifiers(ctx, []string{cveID})
+	if err != nil && len(vulns) == 0 && !errors.Is(err, services.ErrCVENotFound) {
+		return nil, err
+	}
+	if len(vulns) > 0 {
+		vuln = &vulns[0]
+	}
+
+	l.mu.Lock()
+	l.cache[cveID] = vuln
+	l.mu.Unlock()
+	return vuln, nil
+}
+
+// Fields returns the fields filled by name: "cwes", "title" and "kev" from
+// NVD, and "epss" from epss, which may be nil when it isn't backfilled.
+func Fields(lookup *CVELookup, epss intel.EPSSSource, names ...string) ([]Field, error) {
+	fields := make([]Field, 0, len(names))
+	for _, name := range names {
+		switch strings.TrimSpace(name) {
+		case "cwes":
+			fields = append(fields, cweField{lookup})
+		case "title":
+			fields = append(fields, titleField{lookup})
+		case "kev", "known_exploited":
+			fields = append(fields, kevField{lookup})
+		case "epss":
+			if epss == nil {
+				return nil, errors.New("backfill field epss requires an EPSS source")
+			}
+			fields = append(fields, &epssField{source: epss, cache: make(map[string]*float64)})
+		default:
+			return nil, fmt.Errorf("unknown backfill field %q, expected cwes, title, kev or epss", name)
+		}
+	}
+	return fields, nil
+}
+
+type cweField struct{ lookup *CVELookup }
+
+func (cweField) Name() string { return "cwes" }
+
+func (f cweField) Value(ctx context.Context, doc search.Document) (any, error) {
+	vuln, err := f.lookup.Lookup(ctx, doc.CVE)
+	if err != nil || vuln == nil || len(vuln.CWEs) == 0 {
+		return nil, err
+	}
+	return vuln.CWEs, nil
+}
+
+// titleField generates the title from the CVE and the product or OS of the
+// finding. The NVD description is preferred to the stored one, which may
+// have been truncated before publication.
+type titleField struct{ lookup *CVELookup }
+
+func (titleField) Name() string { return "title" }
+
+func (f titleField) Value(ctx context.Context, doc search.Document) (any, error) {
+	vuln, err := f.lookup.Lookup(ctx, doc.CVE)
+	if err != nil {
+		return nil, err
+	}
+	description, cwes := doc.Description, doc.CWEs
+	if vuln != nil {
+		description, cwes = vuln.Description, vuln.CWEs
+	}
+	product := doc.Product
+	if doc.Port == 0 {
+		product = doc.OS
+	}
+	return titles.Generate(product, "", cwes, description, doc.CVE), nil
+}
+
+// kevField sets the CVEs of the CISA Known Exploited Vulnerabilities catalog
+// as known exploited. The others are only marked as backfilled, the field
+// being omitted when unset.
+type kevField struct{ lookup *CVELookup }
+
+func (kevField) Name() string { return "known_exploited" }
+
+func (f kevField) Value(ctx context.Context, doc search.Document) (any, error) {
+	vuln, err := f.lookup.Lookup(ctx, doc.CVE)
+	if err != nil || vuln == nil || !vuln.KnownExploited {
+		return nil, err
+	}
+	return true, nil
+}
+
+// epssField fills the FIRST EPSS probability, once per CVE however many
+// stored findings share it.
+type epssField struct {
+	source intel.EPSSSource
+
+	mu    sync.Mutex
+	cache map[string]*float64
+}
+
+func (*epssField) Name() string { return "epss" }
+
+func (f *epssField) Value(ctx context.Context, doc search.Document) (any, error) {
+	f.mu.Lock()
+	probability, ok := f.cache[doc.CVE]
+	f.mu.Unlock()
+	if !ok {
+		score, err := f.source.EPSS(ctx, doc.CVE)
+		if err != nil {
+			return nil, err
+		}
+		if score != nil {
+			probability = &score.Probability
+		}
+		f.mu.Lock()
+		f.cache[doc.CVE] = probability
+		f.mu.Unlock()
+	}
+	if probability == nil {
+		return nil, nil
+	}
+	return *probability, nil
+}
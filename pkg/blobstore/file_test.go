@@ -0,0 +1,33 @@
+package blobstore
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileStore_PutGet(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	store, err := NewFileStore(t.TempDir())
+	require.NoError(t, err)
+
+	location, err := store.Put(ctx, "scan/nmap/result.json", []byte(`{"ok":true}`), "application/json")
+	require.NoError(t, err)
+	assert.Contains(t, location, "file://")
+
+	data, err := store.Get(ctx, "scan/nmap/result.json")
+	require.NoError(t, err)
+	assert.Equal(t, `{"ok":true}`, string(data))
+
+	_, err = store.Get(ctx, "missing.json")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestOpen_UnsupportedScheme(t *testing.T) {
+	t.Parallel()
+	_, err := Open(context.Background(), "ftp://example.com/results")
+	assert.ErrorIs(t, err, ErrUnsupportedScheme)
+}
@@ -0,0 +1,63 @@
+package blobstore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	_ "github.com/lib/pq" // Postgres driver
+)
+
+// PostgresStore keeps payloads in a bytea column.
+type PostgresStore struct {
+	db *sql.DB
+}
+
+var _ Store = (*PostgresStore)(nil)
+
+const createBlobsTable = `CREATE TABLE IF NOT EXISTS result_blobs (
+	key          TEXT PRIMARY KEY,
+	content_type TEXT NOT NULL,
+	payload      BYTEA NOT NULL,
+	created_at   TIMESTAMPTZ NOT NULL DEFAULT now()
+)`
+
+func NewPostgresStore(ctx context.Context, dsn string) (*PostgresStore, error) {
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open postgres: %w", err)
+	}
+	if _, err := db.ExecContext(ctx, createBlobsTable); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create result_blobs table: %w", err)
+	}
+	return &PostgresStore{db: db}, nil
+}
+
+func (s *PostgresStore) Put(ctx context.Context, key string, data []byte, contentType string) (string, error) {
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO result_blobs (key, content_type, payload) VALUES ($1, $2, $3)
+		 ON CONFLICT (key) DO UPDATE SET content_type = EXCLUDED.content_type, payload = EXCLUDED.payload`,
+		key, contentType, data)
+	if err != nil {
+		return "", fmt.Errorf("failed to insert blob: %w", err)
+	}
+	return "postgres:result_blobs/" + key, nil
+}
+
+func (s *PostgresStore) Get(ctx context.Context, key string) ([]byte, error) {
+	var data []byte
+	err := s.db.QueryRowContext(ctx, `SELECT payload FROM result_blobs WHERE key = $1`, key).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, key)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to select blob: %w", err)
+	}
+	return data, nil
+}
+
+func (s *PostgresStore) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,244 @@
+package cache
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// diskPruneInterval is how often Set sweeps the expired entries.
+const diskPruneInterval = time.Hour
+
+// Disk is a Cache kept in a directory, surviving restarts without a Redis
+// server, for the CLI and single node installs. Every entry is a file named
+// after the hash of its key, holding a JSON header line followed by the gzip
+// compressed payload. Expired entries are dropped when read and swept hourly.
+type Disk struct {
+	dir string
+	now func() time.Time
+
+	mu        sync.Mutex
+	lastPrune time.Time
+	pruning   atomic.Bool
+}
+
+var _ Cache = (*Disk)(nil)
+
+// diskHeader is the first line of a Disk entry.
+type diskHeader struct {
+	Key       string    `json:"key"`
+	FetchedAt time.Time `json:"fetched_at"`
+	ExpiresAt time.Time `json:"expires_at"` // Zero when it doesn't expire
+}
+
+// NewDisk creates a Disk cache in dir, creating it when missing.
+func NewDisk(dir string) (*Disk, error) {
+	if dir == "" {
+		return nil, errors.New("empty cache directory")
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create cache directory: %w", err)
+	}
+	return &Disk{dir: dir, now: time.Now, lastPrune: time.Now()}, nil
+}
+
+// Dir returns the directory of the cache.
+func (d *Disk) Dir() string {
+	return d.dir
+}
+
+func (d *Disk) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	name := hex.EncodeToString(sum[:])
+	return filepath.Join(d.dir, name[:2], name+".gz")
+}
+
+func (d *Disk) Get(ctx context.Context, key string) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	path := d.path(key)
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrMiss
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	header, err := readDiskHeader(r)
+	if err != nil {
+		return nil, fmt.Errorf("corrupt cache entry %s: %w", path, err)
+	}
+	if header.Key != key {
+		return nil, ErrMiss
+	}
+	if d.expired(header) {
+		_ = os.Remove(path)
+		return nil, ErrMiss
+	}
+
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("corrupt cache entry %s: %w", path, err)
+	}
+	value, err := io.ReadAll(zr)
+	if err != nil {
+		return nil, fmt.Errorf("corrupt cache entry %s: %w", path, err)
+	}
+	return value, nil
+}
+
+func (d *Disk) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	now := d.now().UTC()
+	header := diskHeader{Key: key, FetchedAt: now}
+	if ttl > 0 {
+		header.ExpiresAt = now.Add(ttl)
+	}
+
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(header); err != nil {
+		return fmt.Errorf("failed to encode cache entry: %w", err)
+	}
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(value); err != nil {
+		return fmt.Errorf("failed to compress cache entry: %w", err)
+	}
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("failed to compress cache entry: %w", err)
+	}
+
+	path := d.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	if err := writeFileAtomic(path, buf.Bytes()); err != nil {
+		return err
+	}
+	d.maybePrune()
+	return nil
+}
+
+func (d *Disk) Invalidate(ctx context.Context, key string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	err := os.Remove(d.path(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// Prune removes the expired and unreadable entries, and returns how many it
+// removed.
+func (d *Disk) Prune() (int, error) {
+	removed := 0
+	err := filepath.WalkDir(d.dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		if strings.Contains(entry.Name(), ".tmp-") {
+			// Left behind by a crash while writing
+			info, err := entry.Info()
+			if err != nil || d.now().Sub(info.ModTime()) <= diskPruneInterval {
+				return nil
+			}
+		} else if filepath.Ext(path) != ".gz" {
+			return nil
+		} else if header, err := readDiskHeaderFile(path); err == nil && !d.expired(header) {
+			return nil
+		}
+		if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		removed++
+		return nil
+	})
+	return removed, err
+}
+
+// maybePrune sweeps the expired entries in the background when the last
+// sweep is older than diskPruneInterval.
+func (d *Disk) maybePrune() {
+	d.mu.Lock()
+	due := d.now().Sub(d.lastPrune) >= diskPruneInterval
+	if due {
+		d.lastPrune = d.now()
+	}
+	d.mu.Unlock()
+	if !due || !d.pruning.CompareAndSwap(false, true) {
+		return
+	}
+
+	go func() {
+		defer d.pruning.Store(false)
+		removed, err := d.Prune()
+		if err != nil {
+			slog.Warn("Failed to prune disk cache", slog.String("dir", d.dir), slog.Any("error", err))
+			return
+		}
+		slog.Debug("Pruned disk cache", slog.String("dir", d.dir), slog.Int("n_removed", removed))
+	}()
+}
+
+func (d *Disk) expired(header diskHeader) bool {
+	return !header.ExpiresAt.IsZero() && !d.now().Before(header.ExpiresAt)
+}
+
+func readDiskHeaderFile(path string) (diskHeader, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return diskHeader{}, err
+	}
+	defer f.Close()
+	return readDiskHeader(bufio.NewReader(f))
+}
+
+func readDiskHeader(r *bufio.Reader) (diskHeader, error) {
+	line, err := r.ReadBytes('\n')
+	if err != nil {
+		return diskHeader{}, err
+	}
+	var header diskHeader
+	if err := json.Unmarshal(line, &header); err != nil {
+		return diskHeader{}, err
+	}
+	return header, nil
+}
+
+// writeFileAtomic replaces path, so that readers never see a partial entry.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,78 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDisk(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	dir := t.TempDir()
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	d, err := NewDisk(dir)
+	require.NoError(t, err)
+	d.now = func() time.Time { return now }
+
+	response := bytes.Repeat([]byte(`{"cve":{"id":"CVE-2024-0001"}}`), 100)
+	require.NoError(t, d.Set(ctx, "nvd:cpe:apache", response, time.Hour))
+	require.NoError(t, d.Set(ctx, "nvd:cpe:openssh", []byte("2"), 0))
+
+	// A restart reads the entries of the previous process
+	reopened, err := NewDisk(dir)
+	require.NoError(t, err)
+	reopened.now = d.now
+	value, err := reopened.Get(ctx, "nvd:cpe:apache")
+	require.NoError(t, err)
+	assert.Equal(t, response, value)
+
+	info, err := os.Stat(d.path("nvd:cpe:apache"))
+	require.NoError(t, err)
+	assert.Less(t, info.Size(), int64(len(response)/4), "Expected the entry to be compressed")
+	header, err := readDiskHeaderFile(d.path("nvd:cpe:apache"))
+	require.NoError(t, err)
+	assert.Equal(t, now, header.FetchedAt)
+
+	now = now.Add(time.Hour)
+	_, err = d.Get(ctx, "nvd:cpe:apache")
+	assert.ErrorIs(t, err, ErrMiss)
+	assert.NoFileExists(t, d.path("nvd:cpe:apache"), "Expected expired entries to be removed")
+	_, err = d.Get(ctx, "nvd:cpe:openssh")
+	assert.NoError(t, err, "Expected entries without TTL not to expire")
+
+	require.NoError(t, d.Invalidate(ctx, "nvd:cpe:openssh"))
+	require.NoError(t, d.Invalidate(ctx, "nvd:cpe:openssh"))
+	_, err = d.Get(ctx, "nvd:cpe:openssh")
+	assert.ErrorIs(t, err, ErrMiss)
+}
+
+func TestDisk_Prune(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	d, err := NewDisk(t.TempDir())
+	require.NoError(t, err)
+	d.now = func() time.Time { return now }
+
+	require.NoError(t, d.Set(ctx, "expired", []byte("1"), time.Minute))
+	require.NoError(t, d.Set(ctx, "fresh", []byte("2"), 2*time.Hour))
+	corrupt := filepath.Join(d.Dir(), "00", "corrupt.gz")
+	require.NoError(t, os.MkdirAll(filepath.Dir(corrupt), 0o755))
+	require.NoError(t, os.WriteFile(corrupt, []byte("not an entry"), 0o644))
+
+	now = now.Add(time.Hour)
+	removed, err := d.Prune()
+	require.NoError(t, err)
+	assert.Equal(t, 2, removed)
+	assert.NoFileExists(t, d.path("expired"))
+	assert.NoFileExists(t, corrupt)
+	_, err = d.Get(ctx, "fresh")
+	assert.NoError(t, err)
+}
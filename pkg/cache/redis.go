@@ -0,0 +1,289 @@
+package cache
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Redis is a Cache kept in a Redis server, shared by every worker connected
+// to it. It speaks the RESP protocol over a small pool of connections and is
+// safe for concurrent use.
+type Redis struct {
+	Addr     string
+	Username string
+	Password string
+	DB       int
+	TLS      *tls.Config // Nil for plain TCP
+
+	// Timeout bounds the commands whose context has no deadline.
+	Timeout time.Duration
+	// MaxIdle is the number of connections kept open between commands.
+	MaxIdle int
+
+	mu   sync.Mutex
+	idle []*redisConn
+}
+
+var _ Cache = (*Redis)(nil)
+
+// RedisError is an error reply of the Redis server.
+type RedisError struct {
+	Message string
+}
+
+func (e *RedisError) Error() string {
+	return "redis: " + e.Message
+}
+
+type redisConn struct {
+	net.Conn
+	r *bufio.Reader
+	w *bufio.Writer
+}
+
+// NewRedis creates a Redis cache from a redis:// or rediss:// URL, e.g.
+// redis://:password@redis:6379/0.
+func NewRedis(rawURL string) (*Redis, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid redis URL: %w", err)
+	}
+	if u.Scheme != "redis" && u.Scheme != "rediss" {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedScheme, u.Scheme)
+	}
+
+	r := &Redis{Addr: u.Host, Timeout: 5 * time.Second, MaxIdle: 8}
+	if u.Port() == "" {
+		r.Addr = net.JoinHostPort(u.Hostname(), "6379")
+	}
+	if u.Hostname() == "" {
+		return nil, errors.New("redis URL requires a host")
+	}
+	if u.User != nil {
+		r.Username = u.User.Username()
+		r.Password, _ = u.User.Password()
+	}
+	if db := strings.Trim(u.Path, "/"); db != "" {
+		if r.DB, err = strconv.Atoi(db); err != nil || r.DB < 0 {
+			return nil, fmt.Errorf("invalid redis database %q", db)
+		}
+	}
+	if u.Scheme == "rediss" {
+		r.TLS = &tls.Config{ServerName: u.Hostname(), MinVersion: tls.VersionTLS12}
+	}
+	return r, nil
+}
+
+func (r *Redis) Get(ctx context.Context, key string) ([]byte, error) {
+	reply, err := r.do(ctx, "GET", key)
+	if err != nil {
+		return nil, err
+	}
+	if reply == nil {
+		return nil, ErrMiss
+	}
+	value, ok := reply.([]byte)
+	if !ok {
+		return nil, fmt.Errorf("unexpected redis reply to GET: %v", reply)
+	}
+	return value, nil
+}
+
+func (r *Redis) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	args := []string{"SET", key, string(value)}
+	if ttl > 0 {
+		args = append(args, "PX", strconv.FormatInt(max(ttl.Milliseconds(), 1), 10))
+	}
+	_, err := r.do(ctx, args...)
+	return err
+}
+
+func (r *Redis) Invalidate(ctx context.Context, key string) error {
+	_, err := r.do(ctx, "DEL", key)
+	return err
+}
+
+// Ping checks that the server is reachable with the configured credentials.
+func (r *Redis) Ping(ctx context.Context) error {
+	_, err := r.do(ctx, "PING")
+	return err
+}
+
+// Close closes the idle connections.
+func (r *Redis) Close() error {
+	r.mu.Lock()
+	idle := r.idle
+	r.idle = nil
+	r.mu.Unlock()
+
+	var errs []error
+	for _, conn := range idle {
+		errs = append(errs, conn.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// do sends a command and returns its reply: nil, a string, an int64, a
+// []byte or an []any, whose items may be *RedisError. Connections are
+// dropped on network and protocol errors, as the rest of the reply may be
+// left unread, but kept on error replies, which are read in full.
+func (r *Redis) do(ctx context.Context, args ...string) (any, error) {
+	conn, err := r.conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	reply, err := conn.roundTrip(ctx, r.Timeout, args)
+	var redisErr *RedisError
+	if err != nil && !errors.As(err, &redisErr) {
+		conn.Close()
+		return nil, fmt.Errorf("redis %s failed: %w", args[0], err)
+	}
+	r.release(conn)
+	return reply, err
+}
+
+// conn returns an idle connection, or dials a new one, authenticated and on
+// the configured database.
+func (r *Redis) conn(ctx context.Context) (*redisConn, error) {
+	r.mu.Lock()
+	if n := len(r.idle); n > 0 {
+		conn := r.idle[n-1]
+		r.idle = r.idle[:n-1]
+		r.mu.Unlock()
+		return conn, nil
+	}
+	r.mu.Unlock()
+
+	dialer := &net.Dialer{Timeout: r.Timeout}
+	var raw net.Conn
+	var err error
+	if r.TLS != nil {
+		raw, err = (&tls.Dialer{NetDialer: dialer, Config: r.TLS}).DialContext(ctx, "tcp", r.Addr)
+	} else {
+		raw, err = dialer.DialContext(ctx, "tcp", r.Addr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to redis at %s: %w", r.Addr, err)
+	}
+	conn := &redisConn{Conn: raw, r: bufio.NewReader(raw), w: bufio.NewWriter(raw)}
+
+	var setup [][]string
+	switch {
+	case r.Username != "":
+		setup = append(setup, []string{"AUTH", r.Username, r.Password})
+	case r.Password != "":
+		setup = append(setup, []string{"AUTH", r.Password})
+	}
+	if r.DB != 0 {
+		setup = append(setup, []string{"SELECT", strconv.Itoa(r.DB)})
+	}
+	for _, args := range setup {
+		if _, err := conn.roundTrip(ctx, r.Timeout, args); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("redis %s failed: %w", args[0], err)
+		}
+	}
+	return conn, nil
+}
+
+func (r *Redis) release(conn *redisConn) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(r.idle) >= r.MaxIdle {
+		conn.Close()
+		return
+	}
+	r.idle = append(r.idle, conn)
+}
+
+// roundTrip writes a command as an array of bulk strings and reads its
+// reply, within the deadline of ctx or timeout.
+func (c *redisConn) roundTrip(ctx context.Context, timeout time.Duration, args []string) (any, error) {
+	deadline, ok := ctx.Deadline()
+	if !ok && timeout > 0 {
+		deadline = time.Now().Add(timeout)
+	}
+	if err := c.SetDeadline(deadline); err != nil {
+		return nil, err
+	}
+
+	fmt.Fprintf(c.w, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(c.w, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if err := c.w.Flush(); err != nil {
+		return nil, err
+	}
+	return readReply(c.r)
+}
+
+// readReply reads a RESP reply.
+func readReply(r *bufio.Reader) (any, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, errors.New("empty redis reply")
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, &RedisError{Message: line[1:]}
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, fmt.Errorf("invalid redis bulk length %q", line[1:])
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		return buf[:n], nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, fmt.Errorf("invalid redis array length %q", line[1:])
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		// Error replies of the items, e.g. of the commands of EXEC, are
+		// items, the rest of the array must still be read off the connection
+		items := make([]any, n)
+		for i := range items {
+			item, err := readReply(r)
+			var redisErr *RedisError
+			switch {
+			case errors.As(err, &redisErr):
+				items[i] = redisErr
+			case err != nil:
+				return nil, err
+			default:
+				items[i] = item
+			}
+		}
+		return items, nil
+	default:
+		return nil, fmt.Errorf("unexpected redis reply %q", line)
+	}
+}
@@ -0,0 +1,182 @@
+package cache
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeRedis serves GET, SET, DEL, AUTH, SELECT and PING from memory.
+type fakeRedis struct {
+	mu       sync.Mutex
+	password string
+	values   map[string]string
+	commands []string
+}
+
+func startFakeRedis(t *testing.T, password string) (*fakeRedis, string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+
+	f := &fakeRedis{password: password, values: map[string]string{}}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go f.serve(conn)
+		}
+	}()
+	return f, ln.Addr().String()
+}
+
+func (f *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	authenticated := f.password == ""
+	for {
+		reply, err := readReply(r)
+		if err != nil {
+			return
+		}
+		var args []string
+		for _, arg := range reply.([]any) {
+			args = append(args, string(arg.([]byte)))
+		}
+
+		f.mu.Lock()
+		f.commands = append(f.commands, strings.Join(args, " "))
+		switch {
+		case args[0] == "AUTH":
+			authenticated = args[len(args)-1] == f.password
+			if authenticated {
+				fmt.Fprint(conn, "+OK\r\n")
+			} else {
+				fmt.Fprint(conn, "-WRONGPASS invalid password\r\n")
+			}
+		case !authenticated:
+			fmt.Fprint(conn, "-NOAUTH Authentication required.\r\n")
+		case args[0] == "GET":
+			if value, ok := f.values[args[1]]; ok {
+				fmt.Fprintf(conn, "$%d\r\n%s\r\n", len(value), value)
+			} else {
+				fmt.Fprint(conn, "$-1\r\n")
+			}
+		case args[0] == "SET":
+			f.values[args[1]] = args[2]
+			fmt.Fprint(conn, "+OK\r\n")
+		case args[0] == "DEL":
+			delete(f.values, args[1])
+			fmt.Fprint(conn, ":1\r\n")
+		case args[0] == "SELECT", args[0] == "PING":
+			fmt.Fprint(conn, "+OK\r\n")
+		default:
+			fmt.Fprintf(conn, "-ERR unknown command '%s'\r\n", args[0])
+		}
+		f.mu.Unlock()
+	}
+}
+
+func TestRedis(t *testing.T) {
+	t.Parallel()
+	server, addr := startFakeRedis(t, "s3cr3t")
+	r, err := NewRedis("redis://:s3cr3t@" + addr + "/1")
+	require.NoError(t, err)
+	defer r.Close()
+	ctx := context.Background()
+
+	_, err = r.Get(ctx, "nvd:cpe:a")
+	assert.ErrorIs(t, err, ErrMiss)
+	// Binary safe, CRLF included
+	require.NoError(t, r.Set(ctx, "nvd:cpe:a", []byte("{\"a\":\r\n1}"), 90*time.Second))
+	value, err := r.Get(ctx, "nvd:cpe:a")
+	require.NoError(t, err)
+	assert.Equal(t, "{\"a\":\r\n1}", string(value))
+
+	require.NoError(t, r.Invalidate(ctx, "nvd:cpe:a"))
+	_, err = r.Get(ctx, "nvd:cpe:a")
+	assert.ErrorIs(t, err, ErrMiss)
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	assert.Equal(t, []string{
+		"AUTH s3cr3t",
+		"SELECT 1",
+		"GET nvd:cpe:a",
+		"SET nvd:cpe:a {\"a\":\r\n1} PX 90000",
+		"GET nvd:cpe:a",
+		"DEL nvd:cpe:a",
+		"GET nvd:cpe:a",
+	}, server.commands, "Expected a single authenticated connection to be reused")
+}
+
+func TestRedis_Errors(t *testing.T) {
+	t.Parallel()
+	_, addr := startFakeRedis(t, "s3cr3t")
+	ctx := context.Background()
+
+	r, err := NewRedis("redis://:wrong@" + addr)
+	require.NoError(t, err)
+	err = r.Ping(ctx)
+	var redisErr *RedisError
+	require.ErrorAs(t, err, &redisErr)
+	assert.Contains(t, redisErr.Message, "WRONGPASS")
+
+	r, err = NewRedis("redis://:s3cr3t@" + addr)
+	require.NoError(t, err)
+	_, err = r.do(ctx, "FLUSHALL")
+	assert.ErrorAs(t, err, &redisErr)
+	assert.NoError(t, r.Ping(ctx), "Expected the connection to be kept after an error reply")
+
+	r, err = NewRedis("redis://127.0.0.1:1")
+	require.NoError(t, err)
+	assert.Error(t, r.Ping(ctx))
+}
+
+func Test_readReply(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name    string
+		raw     string
+		want    any
+		wantErr bool
+	}{
+		{"Simple string", "+OK\r\n", "OK", false},
+		{"Integer", ":42\r\n", int64(42), false},
+		{"Null bulk string", "$-1\r\n", nil, false},
+		{"Error", "-ERR boom\r\n", nil, true},
+		{"Array with an error item", "*3\r\n:1\r\n-ERR boom\r\n$2\r\nok\r\n", []any{int64(1), &RedisError{Message: "ERR boom"}, []byte("ok")}, false},
+		{"Invalid bulk length", "$x\r\n", nil, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			// The next reply must be read in sync
+			r := bufio.NewReader(strings.NewReader(tc.raw + "+NEXT\r\n"))
+			reply, err := readReply(r)
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, reply)
+
+			next, err := readReply(r)
+			require.NoError(t, err)
+			assert.Equal(t, "NEXT", next)
+		})
+	}
+}
@@ -0,0 +1,216 @@
+// Package classify tags hosts with asset classes (database server, mail
+// server, domain controller...) derived from their open services, and
+// weighs the risk of their findings accordingly.
+package classify
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/kptm-tools/vulnerability-analysis/pkg/results"
+)
+
+// Condition matches an open port. Every field that is set must match.
+type Condition struct {
+	Port    uint16 `json:"port,omitempty"`
+	Service string `json:"service,omitempty"` // Nmap service name
+	// CPEProduct is the vendor:product of the service CPE, e.g. mysql:mysql.
+	CPEProduct string `json:"cpe_product,omitempty"`
+}
+
+// Rule assigns a class to hosts on which every All condition and at least
+// one Any condition match an open port.
+type Rule struct {
+	Class string `json:"class"`
+	// Group is the report section of hosts with this class.
+	Group string `json:"group"`
+	// RiskWeight multiplies the risk score of the findings of the host.
+	RiskWeight float64     `json:"risk_weight"`
+	Any        []Condition `json:"any,omitempty"`
+	All        []Condition `json:"all,omitempty"`
+}
+
+// DefaultRules classifies the most common server roles.
+func DefaultRules() []Rule {
+	return []Rule{
+		{
+			Class:      "domain_controller",
+			Group:      "Identity",
+			RiskWeight: 1.5,
+			All: []Condition{
+				{Port: 88},
+				{Port: 389},
+			},
+		},
+		{
+			Class:      "database_server",
+			Group:      "Data stores",
+			RiskWeight: 1.3,
+			Any: []Condition{
+				{Service: "mysql"},
+				{Service: "postgresql"},
+				{Service: "ms-sql-s"},
+				{Service: "oracle-tns"},
+				{Service: "mongodb"},
+				{Service: "redis"},
+				{CPEProduct: "mysql:mysql"},
+				{CPEProduct: "oracle:mysql"},
+				{CPEProduct: "mariadb:mariadb"},
+				{CPEProduct: "postgresql:postgresql"},
+				{CPEProduct: "microsoft:sql_server"},
+				{CPEProduct: "oracle:database_server"},
+				{CPEProduct: "mongodb:mongodb"},
+				{CPEProduct: "redis:redis"},
+			},
+		},
+		{
+			Class:      "mail_server",
+			Group:      "Messaging",
+			RiskWeight: 1.2,
+			Any: []Condition{
+				{Service: "smtp"},
+				{Service: "submission"},
+				{Service: "pop3"},
+				{Service: "imap"},
+				{Service: "imaps"},
+				{Service: "pop3s"},
+				{CPEProduct: "postfix:postfix"},
+				{CPEProduct: "exim:exim"},
+				{CPEProduct: "dovecot:dovecot"},
+				{CPEProduct: "microsoft:exchange_server"},
+			},
+		},
+	}
+}
+
+// LoadRules reads rules from a JSON file holding a list of rules.
+func LoadRules(path string) ([]Rule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read classification rules: %w", err)
+	}
+
+	var rules []Rule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("failed to decode classification rules: %w", err)
+	}
+	for i, rule := range rules {
+		if rule.Class == "" {
+			return nil, fmt.Errorf("classification rule %d has no class", i)
+		}
+		if len(rule.Any) == 0 && len(rule.All) == 0 {
+			return nil, fmt.Errorf("classification rule %s has no conditions", rule.Class)
+		}
+		if rule.RiskWeight < 0 {
+			return nil, fmt.Errorf("classification rule %s has a negative risk weight", rule.Class)
+		}
+	}
+	return rules, nil
+}
+
+// Engine evaluates classification rules against scan results.
+type Engine struct {
+	rules []Rule
+}
+
+func NewEngine(rules []Rule) *Engine {
+	return &Engine{rules: rules}
+}
+
+// Classify returns the rules matching result, highest risk weight first.
+func (e *Engine) Classify(result *results.NmapResult) []Rule {
+	var matched []Rule
+	for _, rule := range e.rules {
+		if rule.matches(result.ScannedPorts) {
+			matched = append(matched, rule)
+		}
+	}
+	sort.SliceStable(matched, func(i, j int) bool { return matched[i].RiskWeight > matched[j].RiskWeight })
+	return matched
+}
+
+// Apply tags result with its classes and report group, and weighs the risk
+// score of its findings by the highest weight of its classes. Weighted scores
+// are capped at 1.
+func (e *Engine) Apply(result *results.NmapResult) {
+	matched := e.Classify(result)
+	if len(matched) == 0 {
+		return
+	}
+
+	result.Classifications = make([]string, 0, len(matched))
+	for _, rule := range matched {
+		result.Classifications = append(result.Classifications, rule.Class)
+	}
+	result.ReportGroup = matched[0].Group
+
+	weight := matched[0].RiskWeight
+	if weight == 0 || weight == 1 {
+		return
+	}
+	result.RiskWeight = weight
+
+	weigh := func(vulns []results.Vulnerability) {
+		for i := range vulns {
+			vulns[i].RiskScore = min(vulns[i].RiskScore*weight, 1.0)
+		}
+	}
+	weigh(result.MostLikelyOS.Vulnerabilities)
+	for i := range result.ScannedPorts {
+		weigh(result.ScannedPorts[i].Vulnerabilities)
+	}
+}
+
+func (r Rule) matches(ports []results.PortData) bool {
+	for _, c := range r.All {
+		if !c.matchesAny(ports) {
+			return false
+		}
+	}
+	if len(r.Any) == 0 {
+		return len(r.All) > 0
+	}
+	for _, c := range r.Any {
+		if c.matchesAny(ports) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c Condition) matchesAny(ports []results.PortData) bool {
+	for _, port := range ports {
+		if c.matches(port) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c Condition) matches(port results.PortData) bool {
+	if port.State != "" && port.State != "open" {
+		return false
+	}
+	if c.Port != 0 && c.Port != port.ID {
+		return false
+	}
+	if c.Service != "" && !strings.EqualFold(c.Service, port.Service.Name) {
+		return false
+	}
+	if c.CPEProduct != "" && !strings.EqualFold(c.CPEProduct, cpeProduct(port.Service.CPE)) {
+		return false
+	}
+	return c.Port != 0 || c.Service != "" || c.CPEProduct != ""
+}
+
+// cpeProduct returns the vendor:product of a CPE 2.3 name.
+func cpeProduct(cpe string) string {
+	parts := strings.Split(cpe, ":")
+	if len(parts) < 5 {
+		return ""
+	}
+	return parts[3] + ":" + parts[4]
+}
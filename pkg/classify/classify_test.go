@@ -0,0 +1,102 @@
+package classify
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/kptm-tools/common/common/pkg/results/tools"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/results"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func port(id uint16, service, cpe, state string) results.PortData {
+	return results.PortData{ID: id, Service: tools.Service{Name: service, CPE: cpe}, State: state}
+}
+
+func TestEngine_Classify(t *testing.T) {
+	t.Parallel()
+	engine := NewEngine(DefaultRules())
+
+	testCases := []struct {
+		name  string
+		ports []results.PortData
+		want  []string
+	}{
+		{
+			name:  "Database by service name",
+			ports: []results.PortData{port(3306, "mysql", "", "open")},
+			want:  []string{"database_server"},
+		},
+		{
+			name:  "Database by CPE on a custom port",
+			ports: []results.PortData{port(15432, "unknown", "cpe:2.3:a:postgresql:postgresql:13.2:*:*:*:*:*:*:*", "open")},
+			want:  []string{"database_server"},
+		},
+		{
+			name:  "Closed ports are ignored",
+			ports: []results.PortData{port(25, "smtp", "", "closed")},
+			want:  nil,
+		},
+		{
+			name: "Domain controller needs Kerberos and LDAP",
+			ports: []results.PortData{
+				port(88, "kerberos-sec", "", "open"),
+				port(389, "ldap", "", "open"),
+				port(25, "smtp", "", "open"),
+			},
+			want: []string{"domain_controller", "mail_server"},
+		},
+		{
+			name:  "Kerberos alone is not a domain controller",
+			ports: []results.PortData{port(88, "kerberos-sec", "", "open")},
+			want:  nil,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var got []string
+			for _, rule := range engine.Classify(&results.NmapResult{ScannedPorts: tc.ports}) {
+				got = append(got, rule.Class)
+			}
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestEngine_Apply(t *testing.T) {
+	t.Parallel()
+	mysql := port(3306, "mysql", "", "open")
+	mysql.Vulnerabilities = []results.Vulnerability{
+		{Vulnerability: tools.Vulnerability{RiskScore: 0.5}},
+		{Vulnerability: tools.Vulnerability{RiskScore: 0.9}},
+	}
+	result := &results.NmapResult{ScannedPorts: []results.PortData{mysql}}
+
+	NewEngine(DefaultRules()).Apply(result)
+
+	assert.Equal(t, []string{"database_server"}, result.Classifications)
+	assert.Equal(t, "Data stores", result.ReportGroup)
+	assert.Equal(t, 1.3, result.RiskWeight)
+	assert.InDelta(t, 0.65, result.ScannedPorts[0].Vulnerabilities[0].RiskScore, 1e-9)
+	assert.Equal(t, 1.0, result.ScannedPorts[0].Vulnerabilities[1].RiskScore)
+}
+
+func TestLoadRules(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+
+	valid := filepath.Join(dir, "valid.json")
+	require.NoError(t, os.WriteFile(valid, []byte(`[{"class":"web_server","group":"Web","risk_weight":1.1,"any":[{"port":443}]}]`), 0o644))
+	rules, err := LoadRules(valid)
+	require.NoError(t, err)
+	require.Len(t, rules, 1)
+	assert.Equal(t, uint16(443), rules[0].Any[0].Port)
+
+	invalid := filepath.Join(dir, "invalid.json")
+	require.NoError(t, os.WriteFile(invalid, []byte(`[{"class":"web_server"}]`), 0o644))
+	_, err = LoadRules(invalid)
+	assert.Error(t, err)
+}
@@ -1,13 +1,297 @@
 package config
 
 import (
+	"bufio"
 	"fmt"
+	"log/slog"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
+// EnvFileVariable names an optional file of KEY=VALUE lines loaded into the
+// environment by LoadEnvFile, e.g. by daemons reloaded on SIGHUP.
+const EnvFileVariable = "CONFIG_FILE"
+
 type Config struct {
 	NatsHost string
 	NatsPort string
+
+	// Daemon mode, outside Kubernetes: level of the logs, which is reloaded
+	// with the feature flags on SIGHUP, PID file and health file rewritten
+	// every HealthInterval
+	LogLevel       string
+	PIDFile        string
+	HealthFile     string
+	HealthInterval time.Duration
+
+	// HTTP API
+	APIAddr          string
+	MetricsStep      time.Duration
+	MetricsRetention time.Duration
+
+	// Finding triage workflow, served by the HTTP API
+	FindingWorkflow        bool
+	FindingWorkflowJournal string
+
+	// Hosts of recent scans kept for reanalysis through the HTTP API, 0 disables it
+	ScanStoreSize int
+
+	// Interval at which the stored hosts with CVEs changed by NVD since they
+	// were analyzed are reanalyzed, 0 disables it
+	CVEHistoryRefreshInterval time.Duration
+
+	// CVE intel documents served by the HTTP API, 0 disables their cache
+	CVEIntelCacheTTL time.Duration
+	EPSSURL          string
+
+	// Consecutive scans finding new critical CVEs that flag a repeat
+	// offender host, 0 disables the correlation. Hosts not scanned for the
+	// retention are forgotten.
+	RepeatOffenderScans     int
+	RepeatOffenderRetention time.Duration
+
+	// Scans a host's finding count is compared to for volume anomalies, 0
+	// disables the detection. Hosts not scanned for the retention are
+	// forgotten.
+	AnomalyHistoryScans int
+	AnomalySpikeFactor  int
+	AnomalyDropPercent  int
+	AnomalyRetention    time.Duration
+
+	// Result accumulation
+	SpillThreshold int
+	SpillDir       string
+
+	// Feature flags, and the remote document refreshing them every refresh
+	// interval, zero only fetches it at startup
+	FeatureFlags        string
+	FeatureFlagsURL     string
+	FeatureFlagsRefresh time.Duration
+
+	// Risk model
+	ShadowScoresPath string
+	LikelihoodMatrix string
+
+	// Secret manager the values prefixed with secret: are fetched from at
+	// startup: env, vault, aws or kubernetes. The NVD API keys, the search
+	// index credentials and the Cisco openVuln token are fetched again every
+	// refresh interval to pick up rotated secrets, zero disables it. The
+	// Postgres URLs, the replication token and the other URLs are only
+	// fetched at startup, rotating them requires a restart
+	SecretsProvider        string
+	SecretsRefreshInterval time.Duration
+	SecretsVaultMount      string
+	SecretsVaultTokenFile  string
+	SecretsDir             string
+
+	// NVD API key and rate limiting
+	NvdAPIKey       string
+	NvdAPIKeys      string // Comma separated, rotated with NvdAPIKey
+	NvdAPIKeyHeader string
+	NvdRateLimit    bool
+
+	// NVD outbound proxy and TLS options, for proxies and TLS-intercepting gateways
+	NvdProxyURL              string
+	NvdCABundle              string
+	NvdTLSMinVersion         string
+	NvdTLSClientCert         string
+	NvdTLSClientKey          string
+	NvdTLSInsecureSkipVerify bool
+
+	// NVD pacing learned from throttled responses instead of a fixed interval
+	NvdAdaptivePacing bool
+
+	// NVD pagination, zero fetches every CVE of a CPE or waits for it
+	NvdMaxCVEsPerCPE int
+	NvdCPETimeout    time.Duration
+
+	// NVD CVSS filters of CPE lookups, comma separated severities and a
+	// partial CVSS v3 vector, empty to fetch every CVE
+	NvdCVSSV3Severities string
+	NvdCVSSV4Severities string
+	NvdCVSSV3Metrics    string
+
+	// NVD boolean filters, e.g. hasKev for known exploited only scans
+	NvdFlags string
+
+	// Rejected CVEs left out of NVD lookups
+	NvdSuppressRejected bool
+
+	// NVD precision mode, only CVEs whose configurations mark the CPE vulnerable
+	NvdVulnerableOnly bool
+
+	// NVD keyword search for services without a versioned CPE
+	NvdKeywordFallback bool
+	NvdKeywordSeverity string
+	NvdKeywordMaxCVEs  int
+
+	// NVD Products API resolution of services without a valid CPE
+	NvdCPEResolution bool
+
+	// NVD Match Criteria API applicability checks of range-based configurations
+	NvdMatchCriteria bool
+
+	// NVD Source API names of the CNAs of findings
+	NvdAssignerNames   bool
+	NvdSourceCachePath string
+	NvdSourceCacheTTL  time.Duration
+
+	// NVD responses revalidated with conditional requests, zero disables it
+	NvdResponseCacheEntries int
+
+	// Latest NVD requests served by the API for debugging, zero disables it
+	NvdAccessLogSize int
+
+	// CPE lookups served from memory within the TTL, zero entries disables it.
+	// The lookups of CPEs without CVEs are cached for the shorter negative
+	// TTL, in the shared cache too, zero keeping them for the full TTL
+	NvdCPECacheEntries     int
+	NvdCPECacheTTL         time.Duration
+	NvdCPENegativeCacheTTL time.Duration
+
+	// CPE lookups shared between workers, e.g. redis://redis:6379/0, or kept
+	// across restarts, e.g. file:///var/cache/vulnerability-analysis, empty
+	// disables it
+	NvdSharedCacheURL string
+	NvdSharedCacheTTL time.Duration
+
+	// CPE lookups refreshed into the caches every day at a local time of day,
+	// e.g. 02:00, empty disables it. The CPEs are those of the inventory file,
+	// one per line, and of the hosts of the recent scans
+	CacheWarmupAt          string
+	CacheWarmupMaxDuration time.Duration
+	CacheWarmupInventory   string
+
+	// Scans analyzed at once, halved while NVD throttles requests and raised
+	// back as scans complete, zero leaving them unbounded. The scans beyond
+	// wait in a queue of bounded size, zero for any, and are told their place
+	// every update interval
+	ScanAdmissionMaxActive      int
+	ScanAdmissionMaxQueued      int
+	ScanAdmissionUpdateInterval time.Duration
+
+	// Lookups of the services likely to yield critical or KEV findings first
+	PriorityEnrichment bool
+	PriorityProducts   string
+
+	// NVD availability probing, zero disables it
+	NvdProbeInterval         time.Duration
+	NvdProbeFailureThreshold int
+
+	// Consecutive failed NVD requests opening the circuit breaker, 0
+	// disables it, and how long it fails lookups fast once open
+	NvdCircuitBreakerThreshold int
+	NvdCircuitBreakerCoolDown  time.Duration
+
+	// Local CVE mirror, synced every sync interval, zero only syncs it at
+	// startup
+	MirrorSeed             bool
+	MirrorMode             string
+	MirrorUpstream         string
+	MirrorFeedURL          string
+	MirrorLocalLookups     bool
+	MirrorDir              string
+	MirrorPostgresURL      string
+	MirrorSyncInterval     time.Duration
+	MirrorSyncFrom         string
+	MirrorPrimaryURL       string
+	MirrorReplicationAddr  string
+	MirrorReplicationToken string
+	// Serves the replication API of a primary without a token, e.g. behind
+	// an authenticating gateway. An empty replication address doesn't serve
+	// it at all
+	MirrorReplicationUnauthenticated bool
+
+	// Offline enrichment against the mirror in MirrorDir or MirrorPostgresURL only
+	OfflineMode bool
+
+	// Incremental CPE sync
+	CPESyncDir    string
+	CPESyncMaxAge time.Duration
+
+	// Parallel CVE sources
+	EnrichmentParallel      bool
+	EnrichmentSourceTimeout time.Duration
+
+	// Finding provenance
+	CPETrace bool
+
+	// Error codes of the policy and storage failures in tool results, rather
+	// than the generic tool error code older consumers expect
+	ExtendedErrorCodes bool
+
+	// CPE extraction from service evidence
+	CPEExtraction      bool
+	CPEExtractionRules string
+
+	// Host classification
+	HostClassification      bool
+	HostClassificationRules string
+
+	// Historical CVSS v2 metrics
+	CVSSv2Flags bool
+
+	// CVSS version preference order, per tenant
+	CVSSVersionOrder string
+
+	// Enriched findings cached by CVE and NVD lastModified, 0 disables it
+	EnrichmentCacheEntries int
+
+	// CycloneDX inventory of detected components
+	SBOMExport bool
+
+	// Elasticsearch/OpenSearch export of findings
+	SearchIndexURL      string
+	SearchIndexPrefix   string
+	SearchIndexUsername string
+	SearchIndexPassword string
+	SearchIndexAPIKey   string
+
+	// Enriched findings persisted in Postgres per host and scan, for
+	// historical queries through the HTTP API, empty disables it
+	FindingsPostgresURL string
+
+	// Vendor PSIRT feeds
+	PSIRTFeeds         string
+	PSIRTFeedTTL       time.Duration
+	CiscoOpenVulnToken string
+
+	// GitHub token of the GHSA lookups of the advisories route, raising the
+	// GitHub API rate limit
+	GitHubToken string
+
+	// CISA ICS advisories
+	ICSAdvisoriesDir          string
+	ICSAdvisoriesURL          string
+	ICSAdvisoriesSyncInterval time.Duration
+
+	// Microsoft security update guides
+	MSRCUpdatesDir string
+
+	// Reference reachability checks
+	ReferenceCheck        bool
+	ReferenceCheckTTL     time.Duration
+	ReferenceCheckWorkers int
+	ReferenceCheckEntries int // Checked URLs kept, least recently used first out
+
+	// Service liveness re-check before publishing
+	LivenessCheck        bool
+	LivenessCheckTimeout time.Duration
+
+	// Published output
+	DescriptionMaxLength      int
+	VendorCommentMaxLength    int
+	SanitizeMarkup            bool
+	ResultCompression         string
+	ResultCompressionMin      int
+	BusMaxMessageSize         int
+	ResultOversizeMode        string
+	ResultCanonicalJSON       bool // Also applies to the SBOM events and API responses
+	ClaimCheckStoreURL        string
+	SeverityRemapPath         string
+	PublicationThresholdsPath string
 }
 
 func fetchEnv(varString string, fallbackString string) string {
@@ -18,10 +302,304 @@ func fetchEnv(varString string, fallbackString string) string {
 	return env
 }
 
+func fetchEnvInt(varString string, fallback int) int {
+	env, found := os.LookupEnv(varString)
+	if !found {
+		return fallback
+	}
+	value, err := strconv.Atoi(env)
+	if err != nil {
+		slog.Warn("Invalid integer environment variable, using fallback",
+			slog.String("variable", varString),
+			slog.String("value", env),
+			slog.Int("fallback", fallback))
+		return fallback
+	}
+	return value
+}
+
+func fetchEnvDuration(varString string, fallback time.Duration) time.Duration {
+	env, found := os.LookupEnv(varString)
+	if !found {
+		return fallback
+	}
+	value, err := time.ParseDuration(env)
+	if err != nil {
+		slog.Warn("Invalid duration environment variable, using fallback",
+			slog.String("variable", varString),
+			slog.String("value", env),
+			slog.Duration("fallback", fallback))
+		return fallback
+	}
+	return value
+}
+
+func fetchEnvBool(varString string, fallback bool) bool {
+	env, found := os.LookupEnv(varString)
+	if !found {
+		return fallback
+	}
+	value, err := strconv.ParseBool(env)
+	if err != nil {
+		slog.Warn("Invalid boolean environment variable, using fallback",
+			slog.String("variable", varString),
+			slog.String("value", env),
+			slog.Bool("fallback", fallback))
+		return fallback
+	}
+	return value
+}
+
+// LoadEnvFile sets the environment variables of the KEY=VALUE lines of the
+// file at path, overriding the ones set already. Blank lines, comments and
+// quotes around values are ignored, as in systemd EnvironmentFile.
+func LoadEnvFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open config file: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		key, value, ok := strings.Cut(strings.TrimPrefix(line, "export "), "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return fmt.Errorf("invalid line %d of config file %s", n, path)
+		}
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		if err := os.Setenv(key, value); err != nil {
+			return fmt.Errorf("failed to set %s: %w", key, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+	return nil
+}
+
 func LoadConfig() *Config {
 	return &Config{
-		NatsHost: fetchEnv("NATS_HOST", "localhost"),
-		NatsPort: fetchEnv("NATS_PORT", "4222"),
+		NatsHost:       fetchEnv("NATS_HOST", "localhost"),
+		NatsPort:       fetchEnv("NATS_PORT", "4222"),
+		SpillThreshold: fetchEnvInt("RESULT_SPILL_THRESHOLD", 5000),
+		SpillDir:       fetchEnv("RESULT_SPILL_DIR", ""),
+
+		LogLevel:       fetchEnv("LOG_LEVEL", "debug"),
+		PIDFile:        fetchEnv("PID_FILE", ""),
+		HealthFile:     fetchEnv("HEALTH_FILE", ""),
+		HealthInterval: fetchEnvDuration("HEALTH_INTERVAL", 30*time.Second),
+
+		APIAddr:          fetchEnv("API_ADDR", ""),
+		MetricsStep:      fetchEnvDuration("METRICS_STEP", 5*time.Minute),
+		MetricsRetention: fetchEnvDuration("METRICS_RETENTION", 30*24*time.Hour),
+
+		FindingWorkflow:        fetchEnvBool("FINDING_WORKFLOW", false),
+		FindingWorkflowJournal: fetchEnv("FINDING_WORKFLOW_JOURNAL", ""),
+
+		ScanStoreSize: fetchEnvInt("SCAN_STORE_SIZE", 1000),
+
+		CVEHistoryRefreshInterval: fetchEnvDuration("CVE_HISTORY_REFRESH_INTERVAL", 0),
+
+		CVEIntelCacheTTL: fetchEnvDuration("CVE_INTEL_CACHE_TTL", time.Hour),
+		EPSSURL:          fetchEnv("EPSS_URL", ""),
+
+		RepeatOffenderScans:     fetchEnvInt("REPEAT_OFFENDER_SCANS", 3),
+		RepeatOffenderRetention: fetchEnvDuration("REPEAT_OFFENDER_RETENTION", 90*24*time.Hour),
+
+		AnomalyHistoryScans: fetchEnvInt("ANOMALY_HISTORY_SCANS", 10),
+		AnomalySpikeFactor:  fetchEnvInt("ANOMALY_SPIKE_FACTOR", 10),
+		AnomalyDropPercent:  fetchEnvInt("ANOMALY_DROP_PERCENT", 90),
+		AnomalyRetention:    fetchEnvDuration("ANOMALY_RETENTION", 90*24*time.Hour),
+
+		FeatureFlags:        fetchEnv("FEATURE_FLAGS", ""),
+		FeatureFlagsURL:     fetchEnv("FEATURE_FLAGS_URL", ""),
+		FeatureFlagsRefresh: fetchEnvDuration("FEATURE_FLAGS_REFRESH", time.Minute),
+
+		ShadowScoresPath: fetchEnv("SHADOW_SCORES_PATH", ""),
+		LikelihoodMatrix: fetchEnv("LIKELIHOOD_MATRIX", ""),
+
+		SecretsProvider:        fetchEnv("SECRETS_PROVIDER", "env"),
+		SecretsRefreshInterval: fetchEnvDuration("SECRETS_REFRESH_INTERVAL", 5*time.Minute),
+		SecretsVaultMount:      fetchEnv("SECRETS_VAULT_MOUNT", "secret"),
+		SecretsVaultTokenFile:  fetchEnv("SECRETS_VAULT_TOKEN_FILE", ""),
+		SecretsDir:             fetchEnv("SECRETS_DIR", ""),
+
+		NvdAPIKey:       fetchEnv("NVD_API_KEY", ""),
+		NvdAPIKeys:      fetchEnv("NVD_API_KEYS", ""),
+		NvdAPIKeyHeader: fetchEnv("NVD_API_KEY_HEADER", "apiKey"),
+		NvdRateLimit:    fetchEnvBool("NVD_RATE_LIMIT", true),
+
+		NvdProxyURL:              fetchEnv("NVD_PROXY_URL", ""),
+		NvdCABundle:              fetchEnv("NVD_CA_BUNDLE", ""),
+		NvdTLSMinVersion:         fetchEnv("NVD_TLS_MIN_VERSION", ""),
+		NvdTLSClientCert:         fetchEnv("NVD_TLS_CLIENT_CERT", ""),
+		NvdTLSClientKey:          fetchEnv("NVD_TLS_CLIENT_KEY", ""),
+		NvdTLSInsecureSkipVerify: fetchEnvBool("NVD_TLS_INSECURE_SKIP_VERIFY", false),
+
+		NvdAdaptivePacing: fetchEnvBool("NVD_ADAPTIVE_PACING", false),
+
+		NvdMaxCVEsPerCPE: fetchEnvInt("NVD_MAX_CVES_PER_CPE", 0),
+		NvdCPETimeout:    fetchEnvDuration("NVD_CPE_TIMEOUT", 0),
+
+		NvdCVSSV3Severities: fetchEnv("NVD_CVSS_V3_SEVERITIES", ""),
+		NvdCVSSV4Severities: fetchEnv("NVD_CVSS_V4_SEVERITIES", ""),
+		NvdCVSSV3Metrics:    fetchEnv("NVD_CVSS_V3_METRICS", ""),
+
+		NvdFlags: fetchEnv("NVD_FLAGS", ""),
+
+		NvdSuppressRejected: fetchEnvBool("NVD_SUPPRESS_REJECTED", true),
+
+		NvdVulnerableOnly: fetchEnvBool("NVD_VULNERABLE_ONLY", false),
+
+		NvdKeywordFallback: fetchEnvBool("NVD_KEYWORD_FALLBACK", false),
+		NvdKeywordSeverity: fetchEnv("NVD_KEYWORD_SEVERITY", ""),
+		NvdKeywordMaxCVEs:  fetchEnvInt("NVD_KEYWORD_MAX_CVES", 50),
+
+		NvdCPEResolution: fetchEnvBool("NVD_CPE_RESOLUTION", false),
+
+		NvdMatchCriteria: fetchEnvBool("NVD_MATCH_CRITERIA", false),
+
+		NvdAssignerNames:   fetchEnvBool("NVD_ASSIGNER_NAMES", false),
+		NvdSourceCachePath: fetchEnv("NVD_SOURCE_CACHE_PATH", ""),
+		NvdSourceCacheTTL:  fetchEnvDuration("NVD_SOURCE_CACHE_TTL", 24*time.Hour),
+
+		NvdResponseCacheEntries: fetchEnvInt("NVD_RESPONSE_CACHE_ENTRIES", 0),
+
+		NvdAccessLogSize: fetchEnvInt("NVD_ACCESS_LOG_SIZE", 200),
+
+		NvdCPECacheEntries:     fetchEnvInt("NVD_CPE_CACHE_ENTRIES", 10000),
+		NvdCPECacheTTL:         fetchEnvDuration("NVD_CPE_CACHE_TTL", 24*time.Hour),
+		NvdCPENegativeCacheTTL: fetchEnvDuration("NVD_CPE_NEGATIVE_CACHE_TTL", 6*time.Hour),
+
+		NvdSharedCacheURL: fetchEnv("NVD_SHARED_CACHE_URL", ""),
+		NvdSharedCacheTTL: fetchEnvDuration("NVD_SHARED_CACHE_TTL", 24*time.Hour),
+
+		CacheWarmupAt:          fetchEnv("CACHE_WARMUP_AT", ""),
+		CacheWarmupMaxDuration: fetchEnvDuration("CACHE_WARMUP_MAX_DURATION", 4*time.Hour),
+		CacheWarmupInventory:   fetchEnv("CACHE_WARMUP_INVENTORY", ""),
+
+		ScanAdmissionMaxActive:      fetchEnvInt("SCAN_ADMISSION_MAX_ACTIVE", 0),
+		ScanAdmissionMaxQueued:      fetchEnvInt("SCAN_ADMISSION_MAX_QUEUED", 1000),
+		ScanAdmissionUpdateInterval: fetchEnvDuration("SCAN_ADMISSION_UPDATE_INTERVAL", 30*time.Second),
+
+		PriorityEnrichment: fetchEnvBool("PRIORITY_ENRICHMENT", false),
+		PriorityProducts:   fetchEnv("PRIORITY_PRODUCTS", ""),
+
+		NvdProbeInterval:         fetchEnvDuration("NVD_PROBE_INTERVAL", time.Minute),
+		NvdProbeFailureThreshold: fetchEnvInt("NVD_PROBE_FAILURE_THRESHOLD", 3),
+
+		NvdCircuitBreakerThreshold: fetchEnvInt("NVD_CIRCUIT_BREAKER_THRESHOLD", 5),
+		NvdCircuitBreakerCoolDown:  fetchEnvDuration("NVD_CIRCUIT_BREAKER_COOLDOWN", 5*time.Minute),
+
+		MirrorSeed:             fetchEnvBool("MIRROR_SEED", false),
+		MirrorMode:             fetchEnv("MIRROR_MODE", ""),
+		MirrorUpstream:         fetchEnv("MIRROR_UPSTREAM", "api"),
+		MirrorFeedURL:          fetchEnv("MIRROR_FEED_URL", ""),
+		MirrorLocalLookups:     fetchEnvBool("MIRROR_LOCAL_LOOKUPS", false),
+		MirrorDir:              fetchEnv("MIRROR_DIR", ""),
+		MirrorPostgresURL:      fetchEnv("MIRROR_POSTGRES_URL", ""),
+		MirrorSyncInterval:     fetchEnvDuration("MIRROR_SYNC_INTERVAL", 2*time.Hour),
+		MirrorSyncFrom:         fetchEnv("MIRROR_SYNC_FROM", "1999-01-01T00:00:00Z"),
+		MirrorPrimaryURL:       fetchEnv("MIRROR_PRIMARY_URL", ""),
+		MirrorReplicationAddr:  fetchEnv("MIRROR_REPLICATION_ADDR", ":8003"),
+		MirrorReplicationToken: fetchEnv("MIRROR_REPLICATION_TOKEN", ""),
+
+		MirrorReplicationUnauthenticated: fetchEnvBool("MIRROR_REPLICATION_UNAUTHENTICATED", false),
+
+		OfflineMode: fetchEnvBool("OFFLINE_MODE", false),
+
+		CPESyncDir:    fetchEnv("CPE_SYNC_DIR", ""),
+		CPESyncMaxAge: fetchEnvDuration("CPE_SYNC_MAX_AGE", 7*24*time.Hour),
+
+		EnrichmentParallel:      fetchEnvBool("ENRICHMENT_PARALLEL", false),
+		EnrichmentSourceTimeout: fetchEnvDuration("ENRICHMENT_SOURCE_TIMEOUT", 10*time.Second),
+
+		CPETrace: fetchEnvBool("CPE_TRACE", false),
+
+		ExtendedErrorCodes: fetchEnvBool("EXTENDED_ERROR_CODES", false),
+
+		CPEExtraction:      fetchEnvBool("CPE_EXTRACTION", false),
+		CPEExtractionRules: fetchEnv("CPE_EXTRACTION_RULES", ""),
+
+		HostClassification:      fetchEnvBool("HOST_CLASSIFICATION", false),
+		HostClassificationRules: fetchEnv("HOST_CLASSIFICATION_RULES", ""),
+
+		CVSSv2Flags: fetchEnvBool("CVSS_V2_FLAGS", false),
+
+		CVSSVersionOrder: fetchEnv("CVSS_VERSION_ORDER", ""),
+
+		EnrichmentCacheEntries: fetchEnvInt("ENRICHMENT_CACHE_ENTRIES", 20000),
+
+		SBOMExport: fetchEnvBool("SBOM_EXPORT", false),
+
+		SearchIndexURL:      fetchEnv("SEARCH_INDEX_URL", ""),
+		SearchIndexPrefix:   fetchEnv("SEARCH_INDEX_PREFIX", "vulnerability-findings"),
+		SearchIndexUsername: fetchEnv("SEARCH_INDEX_USERNAME", ""),
+		SearchIndexPassword: fetchEnv("SEARCH_INDEX_PASSWORD", ""),
+		SearchIndexAPIKey:   fetchEnv("SEARCH_INDEX_API_KEY", ""),
+
+		FindingsPostgresURL: fetchEnv("FINDINGS_POSTGRES_URL", ""),
+
+		PSIRTFeeds:         fetchEnv("PSIRT_FEEDS", ""),
+		PSIRTFeedTTL:       fetchEnvDuration("PSIRT_FEED_TTL", 6*time.Hour),
+		CiscoOpenVulnToken: fetchEnv("CISCO_OPENVULN_TOKEN", ""),
+
+		GitHubToken: fetchEnv("GITHUB_TOKEN", ""),
+
+		ICSAdvisoriesDir:          fetchEnv("ICS_ADVISORIES_DIR", ""),
+		ICSAdvisoriesURL:          fetchEnv("ICS_ADVISORIES_URL", ""),
+		ICSAdvisoriesSyncInterval: fetchEnvDuration("ICS_ADVISORIES_SYNC_INTERVAL", 24*time.Hour),
+		MSRCUpdatesDir:            fetchEnv("MSRC_UPDATES_DIR", ""),
+
+		ReferenceCheck:        fetchEnvBool("REFERENCE_CHECK", false),
+		ReferenceCheckTTL:     fetchEnvDuration("REFERENCE_CHECK_TTL", 24*time.Hour),
+		ReferenceCheckWorkers: fetchEnvInt("REFERENCE_CHECK_WORKERS", 4),
+		ReferenceCheckEntries: fetchEnvInt("REFERENCE_CHECK_MAX_ENTRIES", 100000),
+
+		LivenessCheck:        fetchEnvBool("LIVENESS_CHECK", false),
+		LivenessCheckTimeout: fetchEnvDuration("LIVENESS_CHECK_TIMEOUT", 5*time.Second),
+
+		DescriptionMaxLength:      fetchEnvInt("DESCRIPTION_MAX_LENGTH", 0),
+		VendorCommentMaxLength:    fetchEnvInt("VENDOR_COMMENT_MAX_LENGTH", 0),
+		SanitizeMarkup:            fetchEnvBool("SANITIZE_MARKUP", false),
+		ResultCompression:         fetchEnv("RESULT_COMPRESSION", ""),
+		ResultCompressionMin:      fetchEnvInt("RESULT_COMPRESSION_MIN_SIZE", 256*1024),
+		BusMaxMessageSize:         fetchEnvInt("BUS_MAX_MESSAGE_SIZE", 1024*1024),
+		ResultOversizeMode:        fetchEnv("RESULT_OVERSIZE_MODE", "chunk"),
+		ResultCanonicalJSON:       fetchEnvBool("RESULT_CANONICAL_JSON", false),
+		ClaimCheckStoreURL:        fetchEnv("CLAIM_CHECK_STORE_URL", ""),
+		SeverityRemapPath:         fetchEnv("SEVERITY_REMAP_PATH", ""),
+		PublicationThresholdsPath: fetchEnv("PUBLICATION_THRESHOLDS_PATH", ""),
+	}
+}
+
+// SecretFields returns the values that may refer to a secret, by the name of
+// their variable: the API keys and tokens, and the URLs that may embed
+// credentials. The service receives no webhooks, so it holds no webhook
+// secrets.
+func (c *Config) SecretFields() map[string]*string {
+	return map[string]*string{
+		"NVD_API_KEY":              &c.NvdAPIKey,
+		"NVD_API_KEYS":             &c.NvdAPIKeys,
+		"NVD_PROXY_URL":            &c.NvdProxyURL,
+		"NVD_SHARED_CACHE_URL":     &c.NvdSharedCacheURL,
+		"MIRROR_POSTGRES_URL":      &c.MirrorPostgresURL,
+		"MIRROR_REPLICATION_TOKEN": &c.MirrorReplicationToken,
+		"FINDINGS_POSTGRES_URL":    &c.FindingsPostgresURL,
+		"SEARCH_INDEX_URL":         &c.SearchIndexURL,
+		"SEARCH_INDEX_PASSWORD":    &c.SearchIndexPassword,
+		"SEARCH_INDEX_API_KEY":     &c.SearchIndexAPIKey,
+		"CISCO_OPENVULN_TOKEN":     &c.CiscoOpenVulnToken,
+		"GITHUB_TOKEN":             &c.GitHubToken,
+		"CLAIM_CHECK_STORE_URL":    &c.ClaimCheckStoreURL,
 	}
 }
 
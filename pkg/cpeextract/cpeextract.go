@@ -0,0 +1,116 @@
+// Package cpeextract turns the raw evidence scanners collect about a service,
+// such as HTTP headers, SNMP sysDescr or SSH banners, into CPE candidates for
+// the services nmap couldn't fingerprint. Deployments register extractors
+// for the tools and products they know; the candidates are standardized and
+// enriched like the CPEs reported by nmap.
+package cpeextract
+
+import (
+	"strings"
+
+	"github.com/Ullaakut/nmap/v2"
+)
+
+// NSE scripts whose output holds the evidence of the default rules.
+const (
+	ScriptBanner           = "banner"
+	ScriptHTTPServerHeader = "http-server-header"
+	ScriptHTTPHeaders      = "http-headers"
+	ScriptSNMPSysDescr     = "snmp-sysdescr"
+)
+
+// Scripts are the NSE scripts scans run to collect the evidence of the
+// default rules. Custom rules reading other scripts need scans running them.
+var Scripts = []string{ScriptBanner, ScriptHTTPServerHeader, ScriptSNMPSysDescr}
+
+// Evidence is what a scan found out about the service of a port.
+type Evidence struct {
+	Port      uint16
+	Protocol  string
+	Service   string // Nmap service name, e.g. http
+	Product   string
+	Version   string
+	ExtraInfo string
+
+	// Scripts maps the IDs of the NSE scripts run on the port to their
+	// output, e.g. http-server-header to "Apache/2.4.41 (Ubuntu)".
+	Scripts map[string]string
+}
+
+// PortEvidence collects the evidence of an nmap port.
+func PortEvidence(port nmap.Port) Evidence {
+	ev := Evidence{
+		Port:      port.ID,
+		Protocol:  port.Protocol,
+		Service:   port.Service.Name,
+		Product:   port.Service.Product,
+		Version:   port.Service.Version,
+		ExtraInfo: port.Service.ExtraInfo,
+	}
+	if len(port.Scripts) > 0 {
+		ev.Scripts = make(map[string]string, len(port.Scripts))
+		for _, script := range port.Scripts {
+			ev.Scripts[script.ID] = strings.TrimSpace(script.Output)
+		}
+	}
+	return ev
+}
+
+// Extractor derives CPE candidates from the evidence of a service.
+type Extractor interface {
+	// Name identifies the extractor in the provenance of the findings of its
+	// candidates.
+	Name() string
+
+	// Extract returns the CPE 2.2 URIs, e.g. cpe:/a:openbsd:openssh:8.2p1,
+	// the evidence points at, the most likely first, or none.
+	Extract(ev Evidence) []string
+}
+
+// Candidate is a CPE extracted from the evidence of a service.
+type Candidate struct {
+	CPE       string
+	Extractor string
+}
+
+// Registry runs the registered extractors in order. The zero value has no
+// extractors.
+type Registry struct {
+	extractors []Extractor
+}
+
+func NewRegistry(extractors ...Extractor) *Registry {
+	r := &Registry{}
+	for _, e := range extractors {
+		r.Register(e)
+	}
+	return r
+}
+
+// Register adds e after the extractors already registered. It is not safe
+// to register extractors while the registry is in use.
+func (r *Registry) Register(e Extractor) {
+	r.extractors = append(r.extractors, e)
+}
+
+// Len returns the number of registered extractors.
+func (r *Registry) Len() int {
+	return len(r.extractors)
+}
+
+// Candidates returns the CPE candidates of every extractor, in the order
+// the extractors were registered, each CPE once.
+func (r *Registry) Candidates(ev Evidence) []Candidate {
+	var candidates []Candidate
+	seen := make(map[string]bool)
+	for _, e := range r.extractors {
+		for _, cpe := range e.Extract(ev) {
+			if cpe == "" || seen[cpe] {
+				continue
+			}
+			seen[cpe] = true
+			candidates = append(candidates, Candidate{CPE: cpe, Extractor: e.Name()})
+		}
+	}
+	return candidates
+}
@@ -0,0 +1,95 @@
+package cpeextract
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Ullaakut/nmap/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// staticExtractor is a custom extractor returning the same CPEs for any
+// evidence.
+type staticExtractor struct {
+	cpes []string
+}
+
+func (s staticExtractor) Name() string { return "static" }
+
+func (s staticExtractor) Extract(ev Evidence) []string { return s.cpes }
+
+func TestRuleExtractor_DefaultRules(t *testing.T) {
+	t.Parallel()
+	extractor, err := NewRuleExtractor(DefaultRules())
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name string
+		port nmap.Port
+		want []string
+	}{
+		{
+			name: "SSH banner",
+			port: nmap.Port{ID: 22, Service: nmap.Service{Name: "ssh"}, Scripts: []nmap.Script{{ID: ScriptBanner, Output: "SSH-2.0-OpenSSH_8.2p1 Ubuntu-4ubuntu0.5"}}},
+			want: []string{"cpe:/a:openbsd:openssh:8.2p1"},
+		},
+		{
+			name: "HTTP Server header",
+			port: nmap.Port{ID: 80, Service: nmap.Service{Name: "http"}, Scripts: []nmap.Script{{ID: ScriptHTTPServerHeader, Output: "Apache/2.4.41 (Ubuntu)"}}},
+			want: []string{"cpe:/a:apache:http_server:2.4.41"},
+		},
+		{
+			name: "SNMP sysDescr",
+			port: nmap.Port{ID: 161, Protocol: "udp", Service: nmap.Service{Name: "snmp"}, Scripts: []nmap.Script{{ID: ScriptSNMPSysDescr, Output: "Linux gateway 5.4.0-150-generic #167-Ubuntu SMP x86_64"}}},
+			want: []string{"cpe:/o:linux:linux_kernel:5.4.0"},
+		},
+		{
+			name: "No evidence",
+			port: nmap.Port{ID: 8080, Service: nmap.Service{Name: "http-proxy"}},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, extractor.Extract(PortEvidence(tc.port)))
+		})
+	}
+}
+
+func TestRegistry_Candidates(t *testing.T) {
+	t.Parallel()
+	rules, err := NewRuleExtractor(DefaultRules())
+	require.NoError(t, err)
+	registry := NewRegistry(rules)
+	registry.Register(staticExtractor{cpes: []string{"cpe:/a:apache:http_server:2.4.41", "cpe:/a:acme:appliance:1.0"}})
+
+	ev := Evidence{Scripts: map[string]string{ScriptHTTPServerHeader: "Apache/2.4.41"}}
+	assert.Equal(t, []Candidate{
+		{CPE: "cpe:/a:apache:http_server:2.4.41", Extractor: "rules"},
+		{CPE: "cpe:/a:acme:appliance:1.0", Extractor: "static"},
+	}, registry.Candidates(ev))
+	assert.Empty(t, (&Registry{}).Candidates(ev))
+}
+
+func TestLoadRules(t *testing.T) {
+	t.Parallel()
+	path := filepath.Join(t.TempDir(), "rules.json")
+	require.NoError(t, os.WriteFile(path, []byte(`[{"name":"acme","services":["http"],"sources":["product"],"pattern":"Acme Appliance (\\S+)","cpe":"cpe:/h:acme:appliance:$1"}]`), 0o644))
+	rules, err := LoadRules(path)
+	require.NoError(t, err)
+	extractor, err := NewRuleExtractor(rules)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"cpe:/h:acme:appliance:4.2"}, extractor.Extract(Evidence{Service: "http", Product: "Acme Appliance", Version: "4.2"}))
+	assert.Empty(t, extractor.Extract(Evidence{Service: "ssh", Product: "Acme Appliance", Version: "4.2"}))
+
+	for _, invalid := range []string{
+		`[{"name":"acme","sources":["product"],"pattern":"(","cpe":"cpe:/h:acme:appliance:$1"}]`,
+		`[{"name":"acme","sources":["product"],"pattern":"x","cpe":"cpe:2.3:h:acme:appliance:$1"}]`,
+		`[{"sources":["product"],"pattern":"x","cpe":"cpe:/h:acme:appliance"}]`,
+	} {
+		require.NoError(t, os.WriteFile(path, []byte(invalid), 0o644))
+		_, err := LoadRules(path)
+		assert.Error(t, err, invalid)
+	}
+}
@@ -0,0 +1,145 @@
+package cpeextract
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// SourceProduct is the source of a Rule matching the product and version
+// nmap reported, as "product version".
+const SourceProduct = "product"
+
+// Rule extracts a CPE from evidence matching a regular expression.
+type Rule struct {
+	Name string `json:"name"`
+	// Services restricts the rule to the ports of these nmap services, any
+	// service when empty.
+	Services []string `json:"services,omitempty"`
+	// Sources are the NSE scripts whose output is matched, or SourceProduct.
+	Sources []string `json:"sources"`
+	// Pattern is matched against the sources, its submatches are expanded
+	// in CPE as $1 or ${name}, e.g. OpenSSH_([\w.]+) and
+	// cpe:/a:openbsd:openssh:$1.
+	Pattern string `json:"pattern"`
+	CPE     string `json:"cpe"`
+}
+
+// DefaultRules recognize common products in SSH banners, HTTP Server headers
+// and SNMP system descriptions.
+func DefaultRules() []Rule {
+	return []Rule{
+		{
+			Name:    "openssh-banner",
+			Sources: []string{ScriptBanner},
+			Pattern: `SSH-[\d.]+-OpenSSH_([\w.]+)`,
+			CPE:     "cpe:/a:openbsd:openssh:$1",
+		},
+		{
+			Name:    "apache-server-header",
+			Sources: []string{ScriptHTTPServerHeader, ScriptHTTPHeaders},
+			Pattern: `Apache/(\d+(?:\.\d+)+)`,
+			CPE:     "cpe:/a:apache:http_server:$1",
+		},
+		{
+			Name:    "nginx-server-header",
+			Sources: []string{ScriptHTTPServerHeader, ScriptHTTPHeaders},
+			Pattern: `nginx/(\d+(?:\.\d+)+)`,
+			CPE:     "cpe:/a:f5:nginx:$1",
+		},
+		{
+			Name:    "iis-server-header",
+			Sources: []string{ScriptHTTPServerHeader, ScriptHTTPHeaders},
+			Pattern: `Microsoft-IIS/(\d+(?:\.\d+)+)`,
+			CPE:     "cpe:/a:microsoft:internet_information_services:$1",
+		},
+		{
+			Name:    "linux-sysdescr",
+			Sources: []string{ScriptSNMPSysDescr},
+			Pattern: `Linux \S+ (\d+\.\d+(?:\.\d+)?)`,
+			CPE:     "cpe:/o:linux:linux_kernel:$1",
+		},
+	}
+}
+
+// LoadRules reads rules from a JSON file, in the format of DefaultRules.
+func LoadRules(path string) ([]Rule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CPE extraction rules: %w", err)
+	}
+
+	var rules []Rule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("failed to decode CPE extraction rules: %w", err)
+	}
+	if _, err := NewRuleExtractor(rules); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// RuleExtractor is the Extractor of a set of rules.
+type RuleExtractor struct {
+	rules []compiledRule
+}
+
+type compiledRule struct {
+	Rule
+	pattern *regexp.Regexp
+}
+
+var _ Extractor = (*RuleExtractor)(nil)
+
+// NewRuleExtractor compiles rules, returning an error naming the first
+// invalid one.
+func NewRuleExtractor(rules []Rule) (*RuleExtractor, error) {
+	e := &RuleExtractor{}
+	for i, rule := range rules {
+		if rule.Name == "" {
+			return nil, fmt.Errorf("CPE extraction rule %d has no name", i)
+		}
+		if len(rule.Sources) == 0 {
+			return nil, fmt.Errorf("CPE extraction rule %s has no sources", rule.Name)
+		}
+		if !strings.HasPrefix(rule.CPE, "cpe:/") {
+			return nil, fmt.Errorf("CPE extraction rule %s doesn't produce a CPE 2.2 URI: %s", rule.Name, rule.CPE)
+		}
+		pattern, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("CPE extraction rule %s has an invalid pattern: %w", rule.Name, err)
+		}
+		e.rules = append(e.rules, compiledRule{Rule: rule, pattern: pattern})
+	}
+	return e, nil
+}
+
+func (e *RuleExtractor) Name() string {
+	return "rules"
+}
+
+func (e *RuleExtractor) Extract(ev Evidence) []string {
+	var cpes []string
+	for _, rule := range e.rules {
+		if len(rule.Services) > 0 && !slices.Contains(rule.Services, ev.Service) {
+			continue
+		}
+		for _, source := range rule.Sources {
+			text := ev.Scripts[source]
+			if source == SourceProduct {
+				text = strings.TrimSpace(ev.Product + " " + ev.Version)
+			}
+			match := rule.pattern.FindStringSubmatchIndex(text)
+			if match == nil {
+				continue
+			}
+			cpe := rule.pattern.ExpandString(nil, rule.CPE, text, match)
+			cpes = append(cpes, strings.ToLower(string(cpe)))
+			break
+		}
+	}
+	return cpes
+}
@@ -0,0 +1,170 @@
+// Package cpesync keeps, per CPE, the CVEs last fetched from NVD and the time
+// they were fetched, so that recurring scans of the same assets only request
+// the CVEs modified since and merge them into the stored ones.
+package cpesync
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/kptm-tools/vulnerability-analysis/nvd/schema"
+)
+
+// Checkpoint is the state of a CPE after its last successful sync.
+type Checkpoint struct {
+	CPE             string                 `json:"cpe"`
+	SyncedUntil     time.Time              `json:"synced_until"`
+	Vulnerabilities []schema.Vulnerability `json:"vulnerabilities"`
+}
+
+// Store holds the checkpoints of the synced CPEs. Stores opened from a
+// directory persist each checkpoint in a file of its own. It is safe for
+// concurrent use.
+type Store struct {
+	mu          sync.RWMutex
+	dir         string
+	checkpoints map[string]*Checkpoint
+}
+
+// NewStore returns an in-memory store.
+func NewStore() *Store {
+	return &Store{checkpoints: make(map[string]*Checkpoint)}
+}
+
+// Open loads the checkpoints persisted in dir, creating the directory when it
+// doesn't exist.
+func Open(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create CPE sync directory: %w", err)
+	}
+
+	s := NewStore()
+	s.dir = dir
+
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CPE checkpoint: %w", err)
+		}
+		var checkpoint Checkpoint
+		if err := json.Unmarshal(data, &checkpoint); err != nil {
+			return nil, fmt.Errorf("failed to decode CPE checkpoint %s: %w", filepath.Base(path), err)
+		}
+		s.checkpoints[checkpoint.CPE] = &checkpoint
+	}
+	return s, nil
+}
+
+// Len returns the number of synced CPEs.
+func (s *Store) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.checkpoints)
+}
+
+// SyncedUntil returns the time up to which the CVEs of cpe are synced, and
+// false when cpe was never synced.
+func (s *Store) SyncedUntil(cpe string) (time.Time, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	checkpoint, ok := s.checkpoints[cpe]
+	if !ok {
+		return time.Time{}, false
+	}
+	return checkpoint.SyncedUntil, true
+}
+
+// Replace stores resp as the CVEs of cpe synced until the given time, after
+// a full fetch, and returns it.
+func (s *Store) Replace(cpe string, resp *schema.NvdAPIResponse, until time.Time) (*schema.NvdAPIResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	checkpoint := &Checkpoint{CPE: cpe, SyncedUntil: until, Vulnerabilities: slices.Clone(resp.Vulnerabilities)}
+	if err := s.commit(checkpoint); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// Merge merges delta, the CVEs of cpe modified since its checkpoint, into the
+// stored ones, replacing the records of the CVEs it holds, and moves the
+// checkpoint to until. CVEs keep doesn't keep are dropped from the stored
+// ones, e.g. those NVD rejected or rescored out of a filter since they were
+// stored, a nil keep keeps every CVE. It returns every CVE of cpe, as a full
+// fetch would.
+func (s *Store) Merge(cpe string, delta *schema.NvdAPIResponse, until time.Time, keep func(schema.Vulnerability) bool) (*schema.NvdAPIResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	checkpoint := &Checkpoint{CPE: cpe, SyncedUntil: until}
+	if stored, ok := s.checkpoints[cpe]; ok {
+		checkpoint.Vulnerabilities = slices.Clone(stored.Vulnerabilities)
+	}
+	index := make(map[string]int, len(checkpoint.Vulnerabilities))
+	for i, vuln := range checkpoint.Vulnerabilities {
+		index[vuln.Cve.ID] = i
+	}
+	for _, vuln := range delta.Vulnerabilities {
+		if i, ok := index[vuln.Cve.ID]; ok {
+			checkpoint.Vulnerabilities[i] = vuln
+			continue
+		}
+		index[vuln.Cve.ID] = len(checkpoint.Vulnerabilities)
+		checkpoint.Vulnerabilities = append(checkpoint.Vulnerabilities, vuln)
+	}
+	if keep != nil {
+		checkpoint.Vulnerabilities = slices.DeleteFunc(checkpoint.Vulnerabilities, func(vuln schema.Vulnerability) bool {
+			return !keep(vuln)
+		})
+	}
+	if err := s.commit(checkpoint); err != nil {
+		return nil, err
+	}
+
+	merged := *delta
+	merged.Vulnerabilities = slices.Clone(checkpoint.Vulnerabilities)
+	merged.TotalResults = len(merged.Vulnerabilities)
+	merged.ResultsPerPage = len(merged.Vulnerabilities)
+	merged.StartIndex = 0
+	return &merged, nil
+}
+
+// commit persists checkpoint, when the store has a directory, and keeps it.
+// Checkpoints are written to a temporary file first so that a crash never
+// leaves a torn one behind.
+func (s *Store) commit(checkpoint *Checkpoint) error {
+	if s.dir != "" {
+		data, err := json.Marshal(checkpoint)
+		if err != nil {
+			return err
+		}
+		path := filepath.Join(s.dir, fileName(checkpoint.CPE))
+		if err := os.WriteFile(path+".tmp", data, 0o644); err != nil {
+			return fmt.Errorf("failed to write CPE checkpoint: %w", err)
+		}
+		if err := os.Rename(path+".tmp", path); err != nil {
+			return fmt.Errorf("failed to write CPE checkpoint: %w", err)
+		}
+	}
+	s.checkpoints[checkpoint.CPE] = checkpoint
+	return nil
+}
+
+// fileName names the file of a CPE after its hash, CPE names holding
+// characters file systems reject.
+func fileName(cpe string) string {
+	sum := sha256.Sum256([]byte(cpe))
+	return hex.EncodeToString(sum[:]) + ".json"
+}
@@ -0,0 +1,74 @@
+package cpesync
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kptm-tools/vulnerability-analysis/nvd/schema"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func response(records ...schema.Vulnerability) *schema.NvdAPIResponse {
+	return &schema.NvdAPIResponse{TotalResults: len(records), ResultsPerPage: len(records), Vulnerabilities: records}
+}
+
+func record(id, lastModified string) schema.Vulnerability {
+	return schema.Vulnerability{Cve: schema.CveDetail{ID: id, LastModified: lastModified}}
+}
+
+func TestStore_MergeAndReopen(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	cpe := "cpe:2.3:a:openbsd:openssh:8.2:p1:*:*:*:*:*:*"
+	synced := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+
+	store, err := Open(dir)
+	require.NoError(t, err)
+	_, ok := store.SyncedUntil(cpe)
+	assert.False(t, ok)
+
+	_, err = store.Replace(cpe, response(record("CVE-2024-0001", "2024-01-01T00:00:00.000"), record("CVE-2024-0002", "2024-01-01T00:00:00.000")), synced)
+	require.NoError(t, err)
+
+	merged, err := store.Merge(cpe, response(record("CVE-2024-0002", "2024-05-02T00:00:00.000"), record("CVE-2024-0003", "2024-05-02T00:00:00.000")), synced.Add(24*time.Hour), nil)
+	require.NoError(t, err)
+	require.Len(t, merged.Vulnerabilities, 3)
+	assert.Equal(t, 3, merged.TotalResults)
+	assert.Equal(t, "2024-05-02T00:00:00.000", merged.Vulnerabilities[1].Cve.LastModified, "Expected the modified record to replace the stored one")
+	assert.Equal(t, "CVE-2024-0003", merged.Vulnerabilities[2].Cve.ID)
+
+	// Reopening loads the checkpoints
+	reopened, err := Open(dir)
+	require.NoError(t, err)
+	assert.Equal(t, 1, reopened.Len())
+	until, ok := reopened.SyncedUntil(cpe)
+	require.True(t, ok)
+	assert.Equal(t, synced.Add(24*time.Hour), until)
+
+	merged, err = reopened.Merge(cpe, response(), synced.Add(48*time.Hour), nil)
+	require.NoError(t, err)
+	assert.Len(t, merged.Vulnerabilities, 3)
+}
+
+func TestStore_Merge_Keep(t *testing.T) {
+	t.Parallel()
+	cpe := "cpe:2.3:a:openbsd:openssh:8.2:p1:*:*:*:*:*:*"
+	synced := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	store := NewStore()
+	_, err := store.Replace(cpe, response(record("CVE-2024-0001", "2024-01-01T00:00:00.000"), record("CVE-2024-0002", "2024-01-01T00:00:00.000")), synced)
+	require.NoError(t, err)
+
+	rejected := record("CVE-2024-0001", "2024-05-02T00:00:00.000")
+	rejected.Cve.VulnStatus = "Rejected"
+	notRejected := func(vuln schema.Vulnerability) bool { return vuln.Cve.VulnStatus != "Rejected" }
+	merged, err := store.Merge(cpe, response(rejected, record("CVE-2024-0003", "2024-05-02T00:00:00.000")), synced.Add(24*time.Hour), notRejected)
+	require.NoError(t, err)
+	require.Len(t, merged.Vulnerabilities, 2)
+	assert.Equal(t, "CVE-2024-0002", merged.Vulnerabilities[0].Cve.ID)
+	assert.Equal(t, "CVE-2024-0003", merged.Vulnerabilities[1].Cve.ID)
+
+	merged, err = store.Merge(cpe, response(), synced.Add(48*time.Hour), nil)
+	require.NoError(t, err)
+	assert.Len(t, merged.Vulnerabilities, 2, "Expected the rejected CVE to be dropped from the stored ones")
+}
@@ -0,0 +1,126 @@
+// Package cvehistory analyzes recorded hosts again when NVD changes one of
+// their CVEs, e.g. rescores or rejects it, as told by the CVE Change History
+// API, so that published results don't go stale until the next scan.
+package cvehistory
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/output"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/scans"
+)
+
+// ChangeSource returns the time of the last change of every CVE changed
+// between since and until.
+type ChangeSource interface {
+	ChangedCVEs(ctx context.Context, since, until time.Time) (map[string]time.Time, error)
+}
+
+// Reanalyzer analyzes a recorded host again and publishes its result.
+type Reanalyzer interface {
+	Reanalyze(ctx context.Context, scanID uuid.UUID, tenantID, hostAddress, cpe string) (output.ResultSummary, error)
+}
+
+// Refresher checks the history of the CVEs found on the hosts of a scan
+// store every interval, and reanalyzes the hosts with a CVE changed since
+// they were last analyzed.
+type Refresher struct {
+	changes    ChangeSource
+	store      *scans.Store
+	reanalyzer Reanalyzer
+	interval   time.Duration
+
+	mu           sync.Mutex
+	checkedUntil time.Time
+}
+
+func NewRefresher(changes ChangeSource, store *scans.Store, reanalyzer Reanalyzer, interval time.Duration) *Refresher {
+	return &Refresher{changes: changes, store: store, reanalyzer: reanalyzer, interval: interval}
+}
+
+// Start refreshes the store every interval until ctx is done.
+func (r *Refresher) Start(ctx context.Context) {
+	if r.interval <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(r.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if _, err := r.Refresh(ctx); err != nil {
+					slog.Warn("Failed to refresh hosts with changed CVEs", slog.Any("error", err))
+				}
+			}
+		}
+	}()
+}
+
+// Refresh reanalyzes the recorded hosts with a CVE changed since their last
+// analysis and returns how many were reanalyzed. Changes are fetched since
+// the previous refresh, or since the oldest analysis on the first one.
+func (r *Refresher) Refresh(ctx context.Context) (int, error) {
+	records := r.store.Latest()
+	if len(records) == 0 {
+		return 0, nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	since := r.checkedUntil
+	if since.IsZero() {
+		since = records[0].AnalyzedAt
+	}
+	until := time.Now().UTC()
+	if !until.After(since) {
+		return 0, nil
+	}
+	changed, err := r.changes.ChangedCVEs(ctx, since, until)
+	if err != nil {
+		return 0, err
+	}
+
+	reanalyzed := 0
+	for _, record := range records {
+		cveID, ok := changedSince(record, changed)
+		if !ok {
+			continue
+		}
+		hostAddress := record.Result.HostAddress
+		if _, err := r.reanalyzer.Reanalyze(ctx, record.ScanID, record.TenantID, hostAddress, ""); err != nil {
+			slog.Warn("Failed to reanalyze host with a changed CVE",
+				slog.String("scan_id", record.ScanID.String()),
+				slog.String("host_address", hostAddress),
+				slog.String("cve_id", cveID),
+				slog.Any("error", err))
+			continue
+		}
+		slog.Info("Reanalyzed host with a changed CVE",
+			slog.String("scan_id", record.ScanID.String()),
+			slog.String("host_address", hostAddress),
+			slog.String("cve_id", cveID))
+		reanalyzed++
+	}
+	r.checkedUntil = until
+	return reanalyzed, nil
+}
+
+// changedSince returns a CVE of the enrichment of record changed after it
+// was analyzed.
+func changedSince(record scans.Record, changed map[string]time.Time) (string, bool) {
+	vulns := append(record.Result.GetAllVulnerabilities(), record.Result.MostLikelyOS.Vulnerabilities...)
+	for _, vuln := range vulns {
+		if at, ok := changed[vuln.ID]; ok && at.After(record.AnalyzedAt) {
+			return vuln.ID, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,77 @@
+package cvehistory
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kptm-tools/common/common/pkg/results/tools"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/output"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/results"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/scans"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type stubChanges struct {
+	changed map[string]time.Time
+	since   []time.Time
+}
+
+func (s *stubChanges) ChangedCVEs(ctx context.Context, since, until time.Time) (map[string]time.Time, error) {
+	s.since = append(s.since, since)
+	return s.changed, nil
+}
+
+type stubReanalyzer struct {
+	store *scans.Store
+	hosts []string
+}
+
+func (s *stubReanalyzer) Reanalyze(ctx context.Context, scanID uuid.UUID, tenantID, hostAddress, cpe string) (output.ResultSummary, error) {
+	s.hosts = append(s.hosts, hostAddress)
+	record, err := s.store.Get(scanID, hostAddress)
+	if err != nil {
+		return output.ResultSummary{}, err
+	}
+	record.AnalyzedAt = time.Now().UTC()
+	s.store.Save(record)
+	return output.ResultSummary{HostAddress: hostAddress}, nil
+}
+
+func hostWith(address, cveID string) *results.NmapResult {
+	return &results.NmapResult{HostAddress: address, ScannedPorts: []results.PortData{{
+		Vulnerabilities: []results.Vulnerability{{Vulnerability: tools.Vulnerability{ID: cveID}}},
+	}}}
+}
+
+func TestRefresher_Refresh(t *testing.T) {
+	t.Parallel()
+	store := scans.NewStore(10)
+	analyzed := time.Now().UTC().Add(-48 * time.Hour)
+	scanID := uuid.New()
+	store.Save(scans.Record{ScanID: scanID, TenantID: "acme", Result: hostWith("10.0.0.1", "CVE-2024-0001"), AnalyzedAt: analyzed})
+	store.Save(scans.Record{ScanID: scanID, TenantID: "acme", Result: hostWith("10.0.0.2", "CVE-2024-0002"), AnalyzedAt: analyzed})
+	store.Save(scans.Record{ScanID: scanID, TenantID: "acme", Result: hostWith("10.0.0.3", "CVE-2024-0003"), AnalyzedAt: analyzed})
+
+	changes := &stubChanges{changed: map[string]time.Time{
+		"CVE-2024-0001": analyzed.Add(time.Hour),
+		"CVE-2024-0002": analyzed.Add(-time.Hour), // Already known at the analysis
+	}}
+	reanalyzer := &stubReanalyzer{store: store}
+	refresher := NewRefresher(changes, store, reanalyzer, 0)
+
+	n, err := refresher.Refresh(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.Equal(t, []string{"10.0.0.1"}, reanalyzer.hosts)
+	assert.Equal(t, []time.Time{analyzed}, changes.since, "Expected the changes since the oldest analysis")
+
+	// The reanalysis is newer than the change, which is not acted on again
+	n, err = refresher.Refresh(context.Background())
+	require.NoError(t, err)
+	assert.Zero(t, n)
+	require.Len(t, changes.since, 2)
+	assert.True(t, changes.since[1].After(analyzed), "Expected the changes since the previous refresh")
+}
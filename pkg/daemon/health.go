@@ -0,0 +1,134 @@
+package daemon
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Health statuses.
+const (
+	HealthOK       = "ok"
+	HealthDegraded = "degraded"
+	HealthStopping = "stopping"
+)
+
+// Health is the state of the service written to the health file. Agents
+// consider the service hung when UpdatedAt is older than a few intervals.
+type Health struct {
+	Status    string            `json:"status"`
+	PID       int               `json:"pid"`
+	StartedAt time.Time         `json:"started_at"`
+	UpdatedAt time.Time         `json:"updated_at"`
+	Details   map[string]string `json:"details,omitempty"`
+}
+
+// WriteHealth replaces the health file at path, atomically so that agents
+// never read a partial file.
+func WriteHealth(path string, h Health) error {
+	data, err := json.MarshalIndent(h, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode health: %w", err)
+	}
+	return writeFileAtomic(path, append(data, '\n'))
+}
+
+// Heartbeat writes the health returned by check to path, when set, and
+// pings the systemd watchdog, every interval until ctx is done. The interval
+// is shortened to half the watchdog timeout when one is configured.
+func Heartbeat(ctx context.Context, path string, interval time.Duration, check func() Health) {
+	watchdog := WatchdogInterval()
+	if watchdog > 0 && (interval <= 0 || interval > watchdog/2) {
+		interval = watchdog / 2
+	}
+	if interval <= 0 || (path == "" && watchdog == 0) {
+		return
+	}
+
+	beat := func() {
+		if path != "" {
+			h := check()
+			h.UpdatedAt = time.Now().UTC()
+			if err := WriteHealth(path, h); err != nil {
+				slog.Warn("Failed to write health file", slog.String("path", path), slog.Any("error", err))
+			}
+		}
+		if watchdog > 0 {
+			if _, err := Notify(StateWatchdog); err != nil {
+				slog.Warn("Failed to ping systemd watchdog", slog.Any("error", err))
+			}
+		}
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for beat(); ; {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			beat()
+		}
+	}
+}
+
+// WritePIDFile writes the PID of the process to path, for init scripts and
+// agents locating the service.
+func WritePIDFile(path string) error {
+	return writeFileAtomic(path, []byte(strconv.Itoa(os.Getpid())+"\n"))
+}
+
+// ReadPIDFile returns the PID written to path.
+func ReadPIDFile(path string) (int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return 0, fmt.Errorf("invalid PID file %s: %w", path, err)
+	}
+	return pid, nil
+}
+
+// RemovePIDFile removes the PID file at path if it still holds the PID of
+// the process, leaving the one of another instance alone.
+func RemovePIDFile(path string) error {
+	pid, err := ReadPIDFile(path)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return nil
+	case err != nil:
+		return err
+	case pid != os.Getpid():
+		return nil
+	}
+	return os.Remove(path)
+}
+
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,59 @@
+package daemon
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHeartbeat(t *testing.T) {
+	read := listenNotify(t)
+	t.Setenv("WATCHDOG_USEC", "20000")
+	path := filepath.Join(t.TempDir(), "health.json")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		// Shortened to half the watchdog timeout
+		Heartbeat(ctx, path, time.Hour, func() Health {
+			return Health{Status: HealthDegraded, PID: os.Getpid(), Details: map[string]string{"nvd_status": "maintenance"}}
+		})
+	}()
+	assert.Equal(t, StateWatchdog, read())
+	assert.Equal(t, StateWatchdog, read())
+	cancel()
+	<-done
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	var h Health
+	require.NoError(t, json.Unmarshal(data, &h))
+	assert.Equal(t, HealthDegraded, h.Status)
+	assert.Equal(t, "maintenance", h.Details["nvd_status"])
+	assert.WithinDuration(t, time.Now(), h.UpdatedAt, time.Minute)
+}
+
+func TestPIDFile(t *testing.T) {
+	t.Parallel()
+	path := filepath.Join(t.TempDir(), "vulnerability-analysis.pid")
+	require.NoError(t, WritePIDFile(path))
+	pid, err := ReadPIDFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.Getpid(), pid)
+	require.NoError(t, RemovePIDFile(path))
+	assert.NoFileExists(t, path)
+	assert.NoError(t, RemovePIDFile(path))
+
+	// Written by another instance since
+	require.NoError(t, os.WriteFile(path, []byte(strconv.Itoa(os.Getpid()+1)), 0o644))
+	require.NoError(t, RemovePIDFile(path))
+	assert.FileExists(t, path)
+}
@@ -0,0 +1,59 @@
+package daemon
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// listenNotify listens on a notify socket as systemd does, returning the
+// function reading the next message.
+func listenNotify(t *testing.T) func() string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "notify.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	t.Setenv("NOTIFY_SOCKET", path)
+
+	return func() string {
+		buf := make([]byte, 1024)
+		require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+		n, err := conn.Read(buf)
+		require.NoError(t, err)
+		return string(buf[:n])
+	}
+}
+
+func TestNotify(t *testing.T) {
+	read := listenNotify(t)
+
+	notified, err := Notify(StateReady, Status("Analyzing %d scans", 2))
+	require.NoError(t, err)
+	assert.True(t, notified)
+	assert.Equal(t, "READY=1\nSTATUS=Analyzing 2 scans", read())
+
+	t.Setenv("NOTIFY_SOCKET", "")
+	notified, err = Notify(StateReady)
+	assert.NoError(t, err)
+	assert.False(t, notified, "Expected no notification outside systemd")
+}
+
+func TestWatchdogInterval(t *testing.T) {
+	t.Setenv("WATCHDOG_USEC", "30000000")
+	t.Setenv("WATCHDOG_PID", strconv.Itoa(os.Getpid()))
+	assert.Equal(t, 30*time.Second, WatchdogInterval())
+
+	t.Setenv("WATCHDOG_PID", strconv.Itoa(os.Getpid()+1))
+	assert.Zero(t, WatchdogInterval(), "Expected the watchdog of another process to be ignored")
+
+	t.Setenv("WATCHDOG_PID", "")
+	t.Setenv("WATCHDOG_USEC", "")
+	assert.Zero(t, WatchdogInterval())
+}
@@ -0,0 +1,87 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kptm-tools/common/common/pkg/enums"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/admission"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/failure"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/output"
+)
+
+// ScanQueuedEventSubject is where the place and estimated start of the scans
+// waiting for admission are published.
+const ScanQueuedEventSubject enums.EventSubjectName = "event.vulnanalysis.scan.queued"
+
+// ScanQueuedEvent tells the platform a scan waits for the scans ahead of it,
+// when it is queued and every update interval until it starts.
+type ScanQueuedEvent struct {
+	ScanID         uuid.UUID `json:"scan_id"`
+	TenantID       string    `json:"tenant_id,omitempty"`
+	Timestamp      time.Time `json:"timestamp"`
+	Position       int       `json:"position"`
+	Queued         int       `json:"queued"`
+	Active         int       `json:"active"`
+	Limit          int       `json:"limit"`
+	ETASeconds     float64   `json:"eta_seconds"`
+	EstimatedStart time.Time `json:"estimated_start"`
+}
+
+// WithScanAdmission smooths bursts of scans, analyzing them up to the
+// adaptive limit of c and publishing the place of the others while they
+// wait.
+func WithScanAdmission(c *admission.Controller) Option {
+	return func(h *Handler) {
+		h.scanAdmission = c
+	}
+}
+
+// admitScan waits until the scan may be analyzed, publishing its place while
+// queued. It returns the func to call once the scan is analyzed.
+func (h *Handler) admitScan(ctx context.Context, bus output.Publisher, scanID uuid.UUID, tenantID string) (func(), error) {
+	if h.scanAdmission == nil {
+		return func() {}, nil
+	}
+	release, err := h.scanAdmission.Acquire(ctx, func(wait admission.Wait) {
+		if err := publishScanQueued(bus, scanID, tenantID, wait); err != nil {
+			slog.Warn("Failed to publish scan queued event", slog.Any("error", err))
+		}
+	})
+	if errors.Is(err, admission.ErrQueueFull) {
+		return nil, &failure.UpstreamError{Err: fmt.Errorf("too many scans waiting for the NVD quota: %w", err)}
+	}
+	return release, err
+}
+
+func publishScanQueued(bus output.Publisher, scanID uuid.UUID, tenantID string, wait admission.Wait) error {
+	slog.Info("Scan queued",
+		slog.String("scanID", scanID.String()),
+		slog.Int("position", wait.Position),
+		slog.Duration("eta", wait.ETA))
+
+	now := time.Now().UTC()
+	payload, err := json.Marshal(ScanQueuedEvent{
+		ScanID:         scanID,
+		TenantID:       tenantID,
+		Timestamp:      now,
+		Position:       wait.Position,
+		Queued:         wait.Queued,
+		Active:         wait.Active,
+		Limit:          wait.Limit,
+		ETASeconds:     wait.ETA.Seconds(),
+		EstimatedStart: now.Add(wait.ETA),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal scan queued event: %w", err)
+	}
+	if err := bus.Publish(string(ScanQueuedEventSubject), payload); err != nil {
+		return fmt.Errorf("failed to publish to subject %s: %w", string(ScanQueuedEventSubject), err)
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/kptm-tools/common/common/pkg/enums"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/output"
+)
+
+// OperatorAlertEventSubject is where alerts meant for operators are published.
+const OperatorAlertEventSubject enums.EventSubjectName = "event.vulnanalysis.alert"
+
+// AlertSeverity ranks operator alerts.
+type AlertSeverity string
+
+const (
+	AlertSeverityInfo     AlertSeverity = "info"
+	AlertSeverityWarning  AlertSeverity = "warning"
+	AlertSeverityCritical AlertSeverity = "critical"
+)
+
+// OperatorAlertEvent notifies operators about degraded service conditions.
+type OperatorAlertEvent struct {
+	Timestamp time.Time         `json:"timestamp"`
+	Component string            `json:"component"`
+	Severity  AlertSeverity     `json:"severity"`
+	Message   string            `json:"message"`
+	Details   map[string]string `json:"details,omitempty"`
+}
+
+func NewOperatorAlertEvent(component string, severity AlertSeverity, message string, details map[string]string) OperatorAlertEvent {
+	return OperatorAlertEvent{
+		Timestamp: time.Now().UTC(),
+		Component: component,
+		Severity:  severity,
+		Message:   message,
+		Details:   details,
+	}
+}
+
+// PublishOperatorAlert publishes an alert and mirrors it to the log.
+func PublishOperatorAlert(bus output.Publisher, alert OperatorAlertEvent) error {
+	slog.Warn("Operator alert",
+		slog.String("component", alert.Component),
+		slog.String("severity", string(alert.Severity)),
+		slog.String("message", alert.Message),
+		slog.Any("details", alert.Details))
+
+	payload, err := json.Marshal(alert)
+	if err != nil {
+		return fmt.Errorf("failed to marshal operator alert: %w", err)
+	}
+	if err := bus.Publish(string(OperatorAlertEventSubject), payload); err != nil {
+		return fmt.Errorf("failed to publish to subject %s: %w", string(OperatorAlertEventSubject), err)
+	}
+	return nil
+}
@@ -5,81 +5,251 @@ import (
 	"encoding/json"
 	"fmt"
 	"log/slog"
+	"slices"
+	"strconv"
 	"sync"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/kptm-tools/common/common/pkg/enums"
 	cmmn "github.com/kptm-tools/common/common/pkg/events"
 	"github.com/kptm-tools/common/common/pkg/results/tools"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/admission"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/anomaly"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/failure"
 	"github.com/kptm-tools/vulnerability-analysis/pkg/interfaces"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/metrics"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/offenders"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/output"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/results"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/sbom"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/scans"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/search"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/services"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/tenant"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/triage"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/vulnstore"
 	"github.com/nats-io/nats.go"
 )
 
-// contextMap is a map used for accessing cancel functions for scans
-// keys are scanID's, values are cancel functions
-var contextMap sync.Map
+// scanStartedPayload extends the common ScanStartedEvent with the optional
+// tenant the scan belongs to.
+type scanStartedPayload struct {
+	cmmn.ScanStartedEvent
+	TenantID string `json:"tenant_id,omitempty"`
+}
+
+// scanFailedPayload extends the common ScanFailedEvent with the category of
+// the error, telling the platform whether the scan is worth retrying.
+type scanFailedPayload struct {
+	cmmn.ScanFailedEvent
+	Category  failure.Category `json:"category"`
+	Retryable bool             `json:"retryable"`
+}
+
+func newScanFailedPayload(scanID uuid.UUID, err error) scanFailedPayload {
+	category := failure.CategoryOf(err)
+	return scanFailedPayload{
+		ScanFailedEvent: cmmn.NewScanFailedEvent(scanID, err.Error()),
+		Category:        category,
+		Retryable:       failure.Retryable(category),
+	}
+}
+
+func publishScanFailed(bus output.Publisher, scanID uuid.UUID, err error) {
+	msg, err := json.Marshal(newScanFailedPayload(scanID, err))
+	if err != nil {
+		slog.Error("Failed to marshal scan failed payload", slog.Any("error", err))
+		return
+	}
+	if err := bus.Publish(string(enums.ScanFailedEventSubject), msg); err != nil {
+		slog.Error("Failed to publish scan failed event", slog.Any("error", err))
+	}
+}
+
+// Handler analyzes the scans of ScanStartedEvents and publishes their
+// results, with the exports and correlations of its options. It is safe for
+// concurrent use.
+type Handler struct {
+	output          output.Options
+	resultRecorder  *metrics.Recorder
+	findingWorkflow *triage.Store
+	sbomExport      bool
+	searchIndexer   *search.Indexer
+	vulnStore       *vulnstore.Store
+	offenderTracker *offenders.Tracker
+	anomalyDetector *anomaly.Detector
+	priorityPublish bool
+	scanAdmission   *admission.Controller
+
+	// cancels holds the cancel functions of the scans being analyzed, by
+	// scan ID
+	cancels sync.Map
+}
+
+// Option configures a Handler.
+type Option func(*Handler)
+
+// NewHandler returns a Handler publishing results as prepared by opts, the
+// zero value publishes them unchanged.
+func NewHandler(opts ...Option) *Handler {
+	h := &Handler{}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
+}
+
+// WithOutput prepares, compresses and splits the published results with
+// opts.
+func WithOutput(opts output.Options) Option {
+	return func(h *Handler) {
+		h.output = opts
+	}
+}
+
+// WithResultRecorder enables the dashboard metrics of published results.
+func WithResultRecorder(r *metrics.Recorder) Option {
+	return func(h *Handler) {
+		h.resultRecorder = r
+	}
+}
+
+// WithFindingWorkflow registers the findings of every published result in
+// the triage workflow.
+func WithFindingWorkflow(s *triage.Store) Option {
+	return func(h *Handler) {
+		h.findingWorkflow = s
+	}
+}
 
-func SubscribeToScanStarted(
+// WithSBOMExport enables publishing a CycloneDX SBOM next to every result.
+func WithSBOMExport(enabled bool) Option {
+	return func(h *Handler) {
+		h.sbomExport = enabled
+	}
+}
+
+// WithSearchIndexer exports the findings of published results to an
+// Elasticsearch or OpenSearch cluster.
+func WithSearchIndexer(i *search.Indexer) Option {
+	return func(h *Handler) {
+		h.searchIndexer = i
+	}
+}
+
+// WithVulnerabilityStore persists the enriched findings of successful
+// results, before tenant thresholds and severity remapping, in Postgres per
+// host and scan for historical queries, and adds their diff against the
+// previous scan of the host to the results.
+func WithVulnerabilityStore(s *vulnstore.Store) Option {
+	return func(h *Handler) {
+		h.vulnStore = s
+	}
+}
+
+// WithOffenderTracker adds a repeat offender section to the results of hosts
+// on which consecutive scans keep finding new critical CVEs.
+func WithOffenderTracker(t *offenders.Tracker) Option {
+	return func(h *Handler) {
+		h.offenderTracker = t
+	}
+}
+
+// WithAnomalyDetector adds a volume anomaly section to the results of hosts
+// whose finding count deviates wildly from their earlier scans, and alerts
+// operators about them.
+func WithAnomalyDetector(d *anomaly.Detector) Option {
+	return func(h *Handler) {
+		h.anomalyDetector = d
+	}
+}
+
+// PrioritySubjectSuffix is appended to the subject of a tool result to
+// publish the preliminary results holding the priority findings of a host.
+const PrioritySubjectSuffix = ".priority"
+
+// WithPriorityPublish enables publishing the critical and known exploited
+// findings of a host as soon as the services prioritized by the analysis
+// are looked up, ahead of its full result.
+func WithPriorityPublish(enabled bool) Option {
+	return func(h *Handler) {
+		h.priorityPublish = enabled
+	}
+}
+
+func (h *Handler) SubscribeToScanStarted(
 	bus cmmn.EventBus,
 	nmapHandler interfaces.INmapHandler,
 ) error {
 	bus.Subscribe(string(enums.ScanStartedEventSubject), func(msg *nats.Msg) {
+		go h.HandleScanStarted(bus, nmapHandler, msg.Data)
+	})
 
-		go func(msg *nats.Msg) {
+	return nil
+}
 
-			slog.Info("Received ScanStartedEvent")
-			// 1. Parse the message payload
-			var payload cmmn.ScanStartedEvent
+// HandleScanStarted analyzes the scan of a ScanStartedEvent payload and
+// publishes its results on bus, returning once the scan is analyzed. It is
+// what SubscribeToScanStarted runs for every event, and replays captured
+// events locally.
+func (h *Handler) HandleScanStarted(bus output.Publisher, nmapHandler interfaces.INmapHandler, data []byte) {
+	slog.Info("Received ScanStartedEvent")
+	// 1. Parse the message payload
+	var payload scanStartedPayload
 
-			if err := json.Unmarshal(msg.Data, &payload); err != nil {
-				slog.Error("Received invalid JSON payload", slog.Any("payload", msg.Data))
-				failedPayload := cmmn.NewScanFailedEvent(payload.ScanID, fmt.Errorf("invalid JSON payload: %w", err).Error())
-				msg, err := json.Marshal(failedPayload)
-				if err != nil {
-					slog.Error("failed to marshal scan failed payload", slog.Any("error", err))
-				}
-				bus.Publish(string(enums.ScanFailedEventSubject), msg)
+	if err := json.Unmarshal(data, &payload); err != nil {
+		slog.Error("Received invalid JSON payload", slog.Any("payload", data))
+		publishScanFailed(bus, payload.ScanID, &failure.InputError{Err: fmt.Errorf("invalid JSON payload: %w", err)})
 
-				return
-			}
+		return
+	}
 
-			// Cancellation context
-			ctx, cancel := context.WithCancel(context.Background())
-			contextMap.Store(payload.ScanID, cancel)
-			defer func() {
-				contextMap.Delete(payload.ScanID)
-				cancel()
-			}()
+	// Cancellation context
+	ctx, cancel := context.WithCancel(scans.WithScanID(tenant.WithID(context.Background(), payload.TenantID), payload.ScanID))
+	h.cancels.Store(payload.ScanID, cancel)
+	defer func() {
+		h.cancels.Delete(payload.ScanID)
+		cancel()
+	}()
 
-			slog.Debug("Received payload", slog.Any("payload", payload))
-			// 2. Call our handlers for each tool
-			c := nmapHandler.RunScan(ctx, payload)
-
-			for result := range c {
-				if result.Err != nil {
-					slog.Warn("Encountered error running Nmap Scan", slog.Any("error", result.Err))
-				}
-				// 3. Publish the result
-				if err := processNmapResult(payload.ScanID, result, bus); err != nil {
-					slog.Error("Failed to process NmapResult", slog.Any("error", err))
-					failedPayload := cmmn.NewScanFailedEvent(payload.ScanID, fmt.Errorf("failed to process NmapResult: %w", err).Error())
-					msg, err := json.Marshal(failedPayload)
-					if err != nil {
-						slog.Error("failed to marshal scan failed payload", slog.Any("error", err))
-					}
-					bus.Publish(string(enums.ScanFailedEventSubject), msg)
-				}
+	release, err := h.admitScan(ctx, bus, payload.ScanID, payload.TenantID)
+	if err != nil {
+		if ctx.Err() != nil {
+			slog.Info("Scan cancelled while queued", slog.String("scanID", payload.ScanID.String()))
+			return
+		}
+		slog.Error("Failed to admit scan", slog.Any("error", err))
+		publishScanFailed(bus, payload.ScanID, err)
+		return
+	}
+	defer release()
 
-			}
-			slog.Info("Finished analyzing vulnerabilities", slog.String("scanID", payload.ScanID.String()))
+	if h.priorityPublish {
+		ctx = services.NotifyPriorityFindings(ctx, func(result *results.NmapResult) {
+			h.publishPriorityFindings(ctx, payload.ScanID, result, bus)
+		})
+	}
 
-		}(msg)
-	})
+	slog.Debug("Received payload", slog.Any("payload", payload))
+	// 2. Call our handlers for each tool
+	c := nmapHandler.RunScan(ctx, payload.ScanStartedEvent)
 
-	return nil
+	for result := range c {
+		if result.Err != nil {
+			slog.Warn("Encountered error running Nmap Scan", slog.Any("error", result.Err))
+		}
+		// 3. Publish the result
+		if err := h.processNmapResult(ctx, payload.ScanID, result, bus); err != nil {
+			slog.Error("Failed to process NmapResult", slog.Any("error", err))
+			publishScanFailed(bus, payload.ScanID, fmt.Errorf("failed to process NmapResult: %w", err))
+		}
+
+	}
+	slog.Info("Finished analyzing vulnerabilities", slog.String("scanID", payload.ScanID.String()))
 }
 
-func SubscribeToScanCancelled(bus cmmn.EventBus) error {
+func (h *Handler) SubscribeToScanCancelled(bus cmmn.EventBus) error {
 	bus.Subscribe(string(enums.ScanCancelledEventSubject), func(msg *nats.Msg) {
 		go func(msg *nats.Msg) {
 
@@ -89,20 +259,15 @@ func SubscribeToScanCancelled(bus cmmn.EventBus) error {
 			if err := json.Unmarshal(msg.Data, &payload); err != nil {
 				slog.Error("Received invalid JSON payload", slog.Any("payload", msg.Data))
 				// 1.1 Publish scan cancelled failed?
-				failedPayload := cmmn.NewScanFailedEvent(payload.ScanID, fmt.Errorf("invalid JSON payload: %w", err).Error())
-				msg, err := json.Marshal(failedPayload)
-				if err != nil {
-					slog.Error("Failed to marshal scan failed payload", slog.Any("error", err))
-				}
-				bus.Publish(string(enums.ScanFailedEventSubject), msg)
+				publishScanFailed(bus, payload.ScanID, &failure.InputError{Err: fmt.Errorf("invalid JSON payload: %w", err)})
 				return
 			}
 
 			slog.Debug("Received payload", slog.Any("payload", payload))
 			slog.Info("Cancelling scan", slog.String("scanID", payload.ScanID.String()))
-			if cancelFunc, ok := contextMap.Load(payload.ScanID); ok {
+			if cancelFunc, ok := h.cancels.Load(payload.ScanID); ok {
 				cancelFunc.(context.CancelFunc)() // Cancel the context
-				contextMap.Delete(payload.ScanID)
+				h.cancels.Delete(payload.ScanID)
 				slog.Info("Scan successfully cancelled", slog.String("scanID", payload.ScanID.String()))
 			} else {
 				slog.Warn("No active scan found for ScanID", slog.String("scanID", payload.ScanID.String()))
@@ -112,22 +277,186 @@ func SubscribeToScanCancelled(bus cmmn.EventBus) error {
 	return nil
 }
 
-func processNmapResult(scanID uuid.UUID, result tools.ToolResult, bus cmmn.EventBus) error {
+func (h *Handler) processNmapResult(ctx context.Context, scanID uuid.UUID, result tools.ToolResult, bus output.Publisher) error {
 	subject := enums.NmapEventSubject
 
+	nmapResult, _ := result.Result.(*results.NmapResult)
+
+	// Correlated before publication, on the severities scored by the analysis
+	// rather than the ones remapped for the tenant
+	if h.offenderTracker != nil && nmapResult != nil && result.Err == nil {
+		nmapResult.RepeatOffender = h.offenderTracker.Observe(tenant.FromContext(ctx), nmapResult.HostAddress, scanID, criticalCVEs(nmapResult), time.Now())
+	}
+	if h.anomalyDetector != nil && nmapResult != nil && result.Err == nil {
+		nmapResult.VolumeAnomaly = h.anomalyDetector.Observe(tenant.FromContext(ctx), nmapResult.HostAddress, scanID, len(findingDetections(nmapResult)), time.Now())
+		if nmapResult.VolumeAnomaly != nil {
+			alertVolumeAnomaly(ctx, scanID, nmapResult, bus)
+		}
+	}
+	// Diffed and stored before publication prepares the result in place, so
+	// that the store keeps the enriched findings rather than those left by
+	// the thresholds and severity remapping of the tenant. Like indexing,
+	// storage failures don't fail the scan
+	if h.vulnStore != nil && nmapResult != nil && result.Err == nil {
+		now := time.Now()
+		diff, err := h.vulnStore.DiffPrevious(ctx, scanID, tenant.FromContext(ctx), nmapResult, now)
+		if err != nil {
+			slog.Error("Failed to diff findings against the previous scan",
+				slog.String("host", nmapResult.HostAddress),
+				slog.Any("error", err))
+		}
+		nmapResult.Diff = diff
+		if _, err := h.vulnStore.Save(ctx, scanID, tenant.FromContext(ctx), nmapResult, now); err != nil {
+			slog.Error("Failed to store findings",
+				slog.String("host", nmapResult.HostAddress),
+				slog.Any("error", err))
+		}
+	}
+
 	slog.Info("Publishing service result", slog.String("subject", string(subject)))
 
-	factory := cmmn.ToolEventFactory{}
+	if err := h.output.PublishResult(ctx, bus, string(subject), scanID, result); err != nil {
+		return fmt.Errorf("failed to publish to subject %s: %w", string(subject), err)
+	}
 
-	payload, err := factory.BuildEvent(scanID, result)
-	if err != nil {
-		return fmt.Errorf("failed to build event: %w", err)
+	if nmapResult == nil {
+		return nil
 	}
 
-	if err := bus.Publish(string(subject), payload); err != nil {
-		return fmt.Errorf("failed to publish to subject %s: %w", string(subject), err)
+	// Results are prepared in place, so the counts include severity remapping
+	if h.resultRecorder != nil {
+		h.resultRecorder.Record(tenant.FromContext(ctx), nmapResult.HostAddress, nmapResult.SeverityCounts(), time.Now())
+	}
+
+	// Indexing failures don't fail the scan, the bus remains the system of record
+	if h.searchIndexer != nil {
+		indexed, err := h.searchIndexer.Index(ctx, scanID, tenant.FromContext(ctx), nmapResult, time.Now())
+		if err != nil {
+			slog.Error("Failed to index findings",
+				slog.String("host", nmapResult.HostAddress),
+				slog.Int("indexed", indexed),
+				slog.Any("error", err))
+		}
+	}
+
+	if h.findingWorkflow != nil {
+		if err := h.findingWorkflow.Observe(tenant.FromContext(ctx), nmapResult.HostAddress, findingDetections(nmapResult), time.Now()); err != nil {
+			slog.Error("Failed to record findings in the triage workflow",
+				slog.String("host", nmapResult.HostAddress),
+				slog.Any("error", err))
+		}
+	}
+
+	if h.sbomExport {
+		if err := h.publishSBOM(ctx, scanID, nmapResult, bus, string(subject)+sbom.SubjectSuffix); err != nil {
+			return err
+		}
 	}
 
 	return nil
 
 }
+
+// publishPriorityFindings publishes the preliminary result of a host on the
+// priority subject. Failures are only logged, the full result follows.
+func (h *Handler) publishPriorityFindings(ctx context.Context, scanID uuid.UUID, result *results.NmapResult, bus output.Publisher) {
+	subject := string(enums.NmapEventSubject) + PrioritySubjectSuffix
+	slog.Info("Publishing priority findings", slog.String("subject", subject), slog.String("host", result.HostAddress))
+	toolResult := tools.ToolResult{Tool: enums.ToolNmap, Result: result, Timestamp: time.Now().UTC()}
+	if err := h.output.PublishResult(ctx, bus, subject, scanID, toolResult); err != nil {
+		slog.Error("Failed to publish priority findings",
+			slog.String("host", result.HostAddress),
+			slog.Any("error", err))
+	}
+}
+
+// alertVolumeAnomaly alerts operators about the anomaly of a host. Failures
+// are only logged, the anomaly is also part of the result.
+func alertVolumeAnomaly(ctx context.Context, scanID uuid.UUID, result *results.NmapResult, bus output.Publisher) {
+	a := result.VolumeAnomaly
+	message := "Scan found far more CVEs than usual on a host, check the scanner configuration and CPE standardization"
+	if a.Kind == results.VolumeAnomalyDrop {
+		message = "Scan found far fewer CVEs than usual on a host, check the scanner configuration and CPE standardization"
+	}
+	details := map[string]string{
+		"tenant_id": tenant.FromContext(ctx),
+		"scan_id":   scanID.String(),
+		"host":      result.HostAddress,
+		"kind":      string(a.Kind),
+		"findings":  strconv.Itoa(a.Findings),
+		"baseline":  strconv.Itoa(a.Baseline),
+	}
+	if err := PublishOperatorAlert(bus, NewOperatorAlertEvent("anomaly", AlertSeverityWarning, message, details)); err != nil {
+		slog.Error("Failed to publish operator alert", slog.Any("error", err))
+	}
+}
+
+// findingDetections returns the distinct CVEs found on the OS and ports of a
+// host, with the CPEs they were matched on.
+func findingDetections(result *results.NmapResult) []triage.Detection {
+	index := make(map[string]int)
+	var detections []triage.Detection
+	vulns := append(append([]results.Vulnerability(nil), result.MostLikelyOS.Vulnerabilities...), result.GetAllVulnerabilities()...)
+	for _, v := range vulns {
+		if v.ID == "" {
+			continue
+		}
+		i, ok := index[v.ID]
+		if !ok {
+			i = len(detections)
+			index[v.ID] = i
+			detections = append(detections, triage.Detection{CVE: v.ID})
+		}
+		if cpe := matchedCPE(v); cpe != "" && !slices.Contains(detections[i].CPEs, cpe) {
+			detections[i].CPEs = append(detections[i].CPEs, cpe)
+		}
+	}
+	return detections
+}
+
+// matchedCPE returns the CPE a finding was matched on, if recorded.
+func matchedCPE(v results.Vulnerability) string {
+	if v.Provenance == nil {
+		return ""
+	}
+	if v.Provenance.MatchedCPE != "" {
+		return v.Provenance.MatchedCPE
+	}
+	return v.Provenance.InputCPE
+}
+
+// criticalCVEs returns the distinct CVEs of critical severity of a host.
+func criticalCVEs(result *results.NmapResult) []string {
+	seen := make(map[string]bool)
+	var cves []string
+	vulns := append(append([]results.Vulnerability(nil), result.MostLikelyOS.Vulnerabilities...), result.GetAllVulnerabilities()...)
+	for _, v := range vulns {
+		if v.ID != "" && v.BaseSeverity == enums.SeverityTypeCritical && !seen[v.ID] {
+			seen[v.ID] = true
+			cves = append(cves, v.ID)
+		}
+	}
+	return cves
+}
+
+// publishSBOM publishes the SBOM of a host on subject, compressed like the
+// results and split in chunks when beyond the size limit of the bus. Claim
+// checks only hold results, so SBOMs are chunked in either oversize mode. In
+// the canonical mode, they are encoded as canonical JSON, their components
+// and vulnerabilities in the order of the canonical result.
+func (h *Handler) publishSBOM(ctx context.Context, scanID uuid.UUID, result *results.NmapResult, bus output.Publisher, subject string) error {
+	if h.output.Canonical {
+		output.Canonicalize(result)
+	}
+	event := sbom.NewEvent(scanID, tenant.FromContext(ctx), result.HostAddress, sbom.Generate(result))
+	payload, err := h.output.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal SBOM event: %w", err)
+	}
+
+	slog.Info("Publishing SBOM", slog.String("subject", subject), slog.String("host", result.HostAddress))
+	if err := h.output.PublishPayload(bus, subject, payload); err != nil {
+		return fmt.Errorf("failed to publish to subject %s: %w", subject, err)
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package events
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/google/uuid"
+	cmmn "github.com/kptm-tools/common/common/pkg/events"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/interfaces"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/output"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/tenant"
+)
+
+// Reanalyzer publishes the updated result of a host of a previous scan
+// analyzed again, like the results of the scan itself.
+type Reanalyzer struct {
+	bus     cmmn.EventBus
+	handler *Handler
+	service interfaces.IReanalysisService
+}
+
+// NewReanalyzer returns a Reanalyzer publishing the results of service to
+// bus as handler publishes those of scans.
+func NewReanalyzer(bus cmmn.EventBus, handler *Handler, service interfaces.IReanalysisService) *Reanalyzer {
+	return &Reanalyzer{bus: bus, handler: handler, service: service}
+}
+
+// Reanalyze analyzes a host of a scan again, or only its cpe when set,
+// publishes the updated result and returns its summary.
+func (r *Reanalyzer) Reanalyze(ctx context.Context, scanID uuid.UUID, tenantID, hostAddress, cpe string) (output.ResultSummary, error) {
+	ctx = tenant.WithID(ctx, tenantID)
+	result, err := r.service.Reanalyze(ctx, scanID, tenantID, hostAddress, cpe)
+	if err != nil {
+		return output.ResultSummary{}, err
+	}
+
+	slog.Info("Publishing reanalyzed host", slog.String("scanID", scanID.String()), slog.String("host", hostAddress))
+	if err := r.handler.processNmapResult(ctx, scanID, result, r.bus); err != nil {
+		return output.ResultSummary{}, fmt.Errorf("failed to process NmapResult: %w", err)
+	}
+	// The result was prepared in place, so the summary matches the published one
+	return output.Summarize(result), nil
+}
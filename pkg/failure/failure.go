@@ -0,0 +1,122 @@
+// Package failure defines the error categories of the pipeline. Each category
+// wraps the low-level cause so consumers of failure events can tell whether
+// retrying the scan may help or support has to be alerted.
+package failure
+
+import (
+	"errors"
+
+	"github.com/kptm-tools/common/common/pkg/enums"
+)
+
+// Category classifies a pipeline error.
+type Category string
+
+const (
+	// CategoryInput covers invalid targets and malformed requests. Retrying
+	// the same request fails again.
+	CategoryInput Category = "input"
+	// CategoryUpstream covers failures of NVD, the event bus and the scanned
+	// host. They are usually transient.
+	CategoryUpstream Category = "upstream"
+	// CategoryPolicy covers results rejected by a configured limit or rule.
+	CategoryPolicy Category = "policy"
+	// CategoryStorage covers failures of the blob store, the mirror and spill
+	// files.
+	CategoryStorage Category = "storage"
+	// CategoryInternal is used for errors that carry no category.
+	CategoryInternal Category = "internal"
+)
+
+// Error codes of the tool results for the categories without a common code.
+// They extend the codes consumers of the tool results know about, so Code
+// only returns them when asked to; the category is published in the
+// error_category field of the result events either way.
+const (
+	PolicyErrorCode  enums.ErrorCode = "POLICY_ERROR"
+	StorageErrorCode enums.ErrorCode = "STORAGE_ERROR"
+)
+
+// InputError wraps an error caused by the request itself.
+type InputError struct{ Err error }
+
+func (e *InputError) Error() string      { return e.Err.Error() }
+func (e *InputError) Unwrap() error      { return e.Err }
+func (e *InputError) Category() Category { return CategoryInput }
+
+// UpstreamError wraps an error of a remote dependency.
+type UpstreamError struct{ Err error }
+
+func (e *UpstreamError) Error() string      { return e.Err.Error() }
+func (e *UpstreamError) Unwrap() error      { return e.Err }
+func (e *UpstreamError) Category() Category { return CategoryUpstream }
+
+// PolicyError wraps an error raised by a configured limit or rule.
+type PolicyError struct{ Err error }
+
+func (e *PolicyError) Error() string      { return e.Err.Error() }
+func (e *PolicyError) Unwrap() error      { return e.Err }
+func (e *PolicyError) Category() Category { return CategoryPolicy }
+
+// StorageError wraps an error reading or writing persisted data.
+type StorageError struct{ Err error }
+
+func (e *StorageError) Error() string      { return e.Err.Error() }
+func (e *StorageError) Unwrap() error      { return e.Err }
+func (e *StorageError) Category() Category { return CategoryStorage }
+
+type categorized interface {
+	Category() Category
+}
+
+// CategoryOf returns the category of the outermost categorized error in the
+// chain of err, CategoryInternal when there is none and "" for nil.
+func CategoryOf(err error) Category {
+	if err == nil {
+		return ""
+	}
+	var c categorized
+	if errors.As(err, &c) {
+		return c.Category()
+	}
+	return CategoryInternal
+}
+
+// Retryable reports whether retrying the scan may succeed.
+func Retryable(category Category) bool {
+	return category == CategoryUpstream || category == CategoryStorage
+}
+
+// Code returns the tool result error code of a category. The policy and
+// storage categories get PolicyErrorCode and StorageErrorCode when extended
+// is set, and the generic enums.ToolError otherwise.
+func Code(category Category, extended bool) enums.ErrorCode {
+	switch {
+	case category == CategoryInput:
+		return enums.ValidationError
+	case category == CategoryUpstream:
+		return enums.CommunicationError
+	case category == CategoryPolicy && extended:
+		return PolicyErrorCode
+	case category == CategoryStorage && extended:
+		return StorageErrorCode
+	default:
+		return enums.ToolError
+	}
+}
+
+// CategoryOfCode returns the category of a tool result error code.
+func CategoryOfCode(code enums.ErrorCode) Category {
+	switch code {
+	case enums.ValidationError, enums.ParsingError:
+		return CategoryInput
+	case enums.CommunicationError, enums.TimeoutError:
+		return CategoryUpstream
+	case PolicyErrorCode:
+		return CategoryPolicy
+	case StorageErrorCode:
+		return CategoryStorage
+	default:
+		return CategoryInternal
+	}
+}
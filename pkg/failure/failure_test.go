@@ -0,0 +1,59 @@
+package failure
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/kptm-tools/common/common/pkg/enums"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCategoryOf(t *testing.T) {
+	t.Parallel()
+	cause := errors.New("connection refused")
+
+	testCases := []struct {
+		name string
+		err  error
+		want Category
+	}{
+		{name: "Nil", err: nil, want: ""},
+		{name: "Uncategorized", err: cause, want: CategoryInternal},
+		{name: "Input", err: &InputError{Err: cause}, want: CategoryInput},
+		{name: "Upstream wrapped", err: fmt.Errorf("failed to publish: %w", &UpstreamError{Err: cause}), want: CategoryUpstream},
+		{name: "Policy", err: &PolicyError{Err: cause}, want: CategoryPolicy},
+		{name: "Outermost category wins", err: &StorageError{Err: &UpstreamError{Err: cause}}, want: CategoryStorage},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, CategoryOf(tc.err))
+			if tc.err != nil {
+				assert.ErrorIs(t, tc.err, cause)
+			}
+		})
+	}
+}
+
+func TestRetryable(t *testing.T) {
+	t.Parallel()
+	assert.True(t, Retryable(CategoryUpstream))
+	assert.True(t, Retryable(CategoryStorage))
+	assert.False(t, Retryable(CategoryInput))
+	assert.False(t, Retryable(CategoryPolicy))
+	assert.False(t, Retryable(CategoryInternal))
+}
+
+func TestCode_RoundTrip(t *testing.T) {
+	t.Parallel()
+	for _, c := range []Category{CategoryInput, CategoryUpstream, CategoryPolicy, CategoryStorage, CategoryInternal} {
+		assert.Equal(t, c, CategoryOfCode(Code(c, true)), string(c))
+	}
+	// Consumers predating the extended codes keep receiving the generic one
+	assert.Equal(t, enums.ToolError, Code(CategoryPolicy, false))
+	assert.Equal(t, enums.ToolError, Code(CategoryStorage, false))
+	assert.Equal(t, enums.ValidationError, Code(CategoryInput, false))
+	assert.Equal(t, CategoryUpstream, CategoryOfCode(enums.TimeoutError))
+	assert.Equal(t, CategoryInput, CategoryOfCode(enums.ParsingError))
+}
@@ -0,0 +1,150 @@
+package features
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/kptm-tools/vulnerability-analysis/pkg/tenant"
+)
+
+// Flag identifies a feature that can be rolled out gradually.
+type Flag string
+
+const (
+	FlagEPSS        Flag = "epss"          // EPSS exploit prediction scores
+	FlagRiskModelV2 Flag = "risk_model_v2" // Next generation risk scoring
+)
+
+// Mode is the rollout state of a flag.
+type Mode string
+
+const (
+	ModeOff Mode = "off"
+	ModeOn  Mode = "on"
+	// ModeShadow computes the feature without exposing its output, so it can
+	// be compared against the current behaviour.
+	ModeShadow Mode = "shadow"
+)
+
+func parseMode(s string) (Mode, error) {
+	switch Mode(strings.ToLower(strings.TrimSpace(s))) {
+	case ModeOff:
+		return ModeOff, nil
+	case ModeOn:
+		return ModeOn, nil
+	case ModeShadow:
+		return ModeShadow, nil
+	default:
+		return ModeOff, fmt.Errorf("unknown feature mode '%s'", s)
+	}
+}
+
+// Provider resolves the mode of a flag for a tenant.
+type Provider interface {
+	Mode(flag Flag, tenantID string) Mode
+}
+
+// Rule holds the default mode of a flag and its per-tenant overrides.
+type Rule struct {
+	Default Mode            `json:"default"`
+	Tenants map[string]Mode `json:"tenants,omitempty"`
+}
+
+func (r Rule) modeFor(tenantID string) Mode {
+	if m, ok := r.Tenants[tenantID]; ok {
+		return m
+	}
+	if r.Default == "" {
+		return ModeOff
+	}
+	return r.Default
+}
+
+// StaticProvider serves flags from a fixed set of rules.
+type StaticProvider struct {
+	rules map[Flag]Rule
+}
+
+var _ Provider = (*StaticProvider)(nil)
+
+// NewStaticProvider creates a provider from the given rules.
+func NewStaticProvider(rules map[Flag]Rule) *StaticProvider {
+	if rules == nil {
+		rules = map[Flag]Rule{}
+	}
+	return &StaticProvider{rules: rules}
+}
+
+// ParseStaticProvider builds a provider from a comma separated list of
+// `flag=mode` and `flag@tenant=mode` entries, e.g.
+// "epss=on,kev@acme=on,risk_model_v2=shadow".
+func ParseStaticProvider(spec string) (*StaticProvider, error) {
+	rules := make(map[Flag]Rule)
+
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		key, value, found := strings.Cut(entry, "=")
+		if !found {
+			return nil, fmt.Errorf("invalid feature flag entry '%s': expected flag=mode", entry)
+		}
+		mode, err := parseMode(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid feature flag entry '%s': %w", entry, err)
+		}
+
+		name, tenantID, scoped := strings.Cut(strings.TrimSpace(key), "@")
+		flag := Flag(strings.ToLower(name))
+		rule := rules[flag]
+		if scoped {
+			if rule.Tenants == nil {
+				rule.Tenants = make(map[string]Mode)
+			}
+			rule.Tenants[tenantID] = mode
+		} else {
+			rule.Default = mode
+		}
+		rules[flag] = rule
+	}
+
+	return NewStaticProvider(rules), nil
+}
+
+func (p *StaticProvider) Mode(flag Flag, tenantID string) Mode {
+	rule, ok := p.rules[flag]
+	if !ok {
+		return ModeOff
+	}
+	return rule.modeFor(tenantID)
+}
+
+var (
+	defaultMu       sync.RWMutex
+	defaultProvider Provider = NewStaticProvider(nil)
+)
+
+// SetDefault sets the provider consulted by ModeFor and Enabled.
+func SetDefault(p Provider) {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	defaultProvider = p
+}
+
+// ModeFor returns the mode of a flag for the tenant carried by ctx.
+func ModeFor(ctx context.Context, flag Flag) Mode {
+	defaultMu.RLock()
+	p := defaultProvider
+	defaultMu.RUnlock()
+
+	return p.Mode(flag, tenant.FromContext(ctx))
+}
+
+// Enabled reports whether a flag is fully on for the tenant carried by ctx.
+func Enabled(ctx context.Context, flag Flag) bool {
+	return ModeFor(ctx, flag) == ModeOn
+}
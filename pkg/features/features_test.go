@@ -0,0 +1,83 @@
+package features
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/kptm-tools/vulnerability-analysis/pkg/tenant"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// flagRollout is a flag only rolled out to some tenants by the tests.
+const flagRollout Flag = "rollout"
+
+func Test_ParseStaticProvider(t *testing.T) {
+	t.Parallel()
+	p, err := ParseStaticProvider("epss=on, rollout@acme=on, risk_model_v2=shadow, risk_model_v2@globex=off")
+	assert.NoError(t, err)
+
+	testCases := []struct {
+		name     string
+		flag     Flag
+		tenantID string
+		want     Mode
+	}{
+		{name: "Default on", flag: FlagEPSS, tenantID: "acme", want: ModeOn},
+		{name: "Tenant override on", flag: flagRollout, tenantID: "acme", want: ModeOn},
+		{name: "No default for tenant scoped flag", flag: flagRollout, tenantID: "globex", want: ModeOff},
+		{name: "Default shadow", flag: FlagRiskModelV2, tenantID: "acme", want: ModeShadow},
+		{name: "Tenant override off", flag: FlagRiskModelV2, tenantID: "globex", want: ModeOff},
+		{name: "Unknown flag", flag: Flag("unknown"), tenantID: "acme", want: ModeOff},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, p.Mode(tc.flag, tc.tenantID))
+		})
+	}
+}
+
+func Test_ParseStaticProvider_Invalid(t *testing.T) {
+	t.Parallel()
+	for _, spec := range []string{"epss", "epss=maybe"} {
+		_, err := ParseStaticProvider(spec)
+		assert.Error(t, err, "Expected error for spec %q", spec)
+	}
+}
+
+func Test_ModeFor_UsesTenantFromContext(t *testing.T) {
+	t.Parallel()
+	p, err := ParseStaticProvider("rollout@acme=on")
+	assert.NoError(t, err)
+	SetDefault(p)
+	defer SetDefault(NewStaticProvider(nil))
+
+	assert.True(t, Enabled(tenant.WithID(context.Background(), "acme"), flagRollout))
+	assert.False(t, Enabled(context.Background(), flagRollout))
+}
+
+func TestRemoteProvider_Start(t *testing.T) {
+	t.Parallel()
+	var fetched atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetched.Add(1)
+		w.Write([]byte(`{"rollout": {"default": "off", "tenants": {"acme": "on"}}}`))
+	}))
+	defer server.Close()
+
+	for _, interval := range []time.Duration{0, -time.Second} {
+		before := fetched.Load()
+		p := NewRemoteProvider(server.URL, interval, nil)
+		ctx, cancel := context.WithCancel(context.Background())
+		require.NotPanics(t, func() { p.Start(ctx) }, "Expected interval %s not to start polling", interval)
+		cancel()
+
+		assert.Equal(t, before+1, fetched.Load(), "Expected the rules to be fetched once")
+		assert.Equal(t, ModeOn, p.Mode(flagRollout, "acme"))
+	}
+}
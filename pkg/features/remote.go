@@ -0,0 +1,109 @@
+package features
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// RemoteProvider periodically fetches flag rules as JSON from an HTTP
+// endpoint. Flags missing from the remote document, or any flag while the
+// endpoint has never been reached, are resolved by the fallback provider.
+//
+// The expected document maps flag names to rules:
+//
+//	{"epss": {"default": "off", "tenants": {"acme": "on"}}}
+type RemoteProvider struct {
+	url      string
+	interval time.Duration
+	client   *http.Client
+	fallback Provider
+
+	mu    sync.RWMutex
+	rules map[Flag]Rule
+}
+
+var _ Provider = (*RemoteProvider)(nil)
+
+// NewRemoteProvider creates a provider backed by the document at url.
+// Call Start to begin polling.
+func NewRemoteProvider(url string, interval time.Duration, fallback Provider) *RemoteProvider {
+	if fallback == nil {
+		fallback = NewStaticProvider(nil)
+	}
+	return &RemoteProvider{
+		url:      url,
+		interval: interval,
+		client:   &http.Client{Timeout: 10 * time.Second},
+		fallback: fallback,
+	}
+}
+
+// Start performs an initial fetch and keeps refreshing the rules until ctx
+// is cancelled. Without a positive interval the rules are only fetched once.
+func (p *RemoteProvider) Start(ctx context.Context) {
+	if err := p.Refresh(ctx); err != nil {
+		slog.Warn("Failed to fetch remote feature flags, using fallback", slog.Any("error", err))
+	}
+	if p.interval <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(p.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := p.Refresh(ctx); err != nil {
+					slog.Warn("Failed to refresh remote feature flags, keeping previous rules", slog.Any("error", err))
+				}
+			}
+		}
+	}()
+}
+
+// Refresh fetches the latest rules from the remote endpoint.
+func (p *RemoteProvider) Refresh(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.url, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create feature flag request: %w", err)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed feature flag request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected feature flag status: %s", resp.Status)
+	}
+
+	var rules map[Flag]Rule
+	if err := json.NewDecoder(resp.Body).Decode(&rules); err != nil {
+		return fmt.Errorf("failed to decode feature flags: %w", err)
+	}
+
+	p.mu.Lock()
+	p.rules = rules
+	p.mu.Unlock()
+	return nil
+}
+
+func (p *RemoteProvider) Mode(flag Flag, tenantID string) Mode {
+	p.mu.RLock()
+	rule, ok := p.rules[flag]
+	p.mu.RUnlock()
+
+	if !ok {
+		return p.fallback.Mode(flag, tenantID)
+	}
+	return rule.modeFor(tenantID)
+}
@@ -11,6 +11,7 @@ import (
 	"github.com/kptm-tools/common/common/pkg/results/tools"
 	"github.com/kptm-tools/common/common/pkg/utils"
 	"github.com/kptm-tools/vulnerability-analysis/pkg/interfaces"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/results"
 )
 
 type NmapHandler struct {
@@ -36,7 +37,7 @@ func (h *NmapHandler) RunScan(ctx context.Context, event events.ScanStartedEvent
 			slog.Error("Error validating host for tool: %w", slog.Any("error", err))
 			c <- tools.ToolResult{
 				Tool:   enums.ToolNmap,
-				Result: &tools.NmapResult{},
+				Result: &results.NmapResult{},
 				Err: &tools.ToolError{
 					Code:    enums.ValidationError,
 					Message: fmt.Sprintf("invalid target: %s", event.Target.Value),
@@ -0,0 +1,169 @@
+// Package ics ingests the CISA ICS advisories, published as CSAF 2.0
+// documents, and maps them to the CPEs of scanned OT products. Besides the
+// CVEs, the advisories carry the mitigations and affected firmware ranges
+// NVD doesn't record for industrial products.
+package ics
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Advisory is a parsed ICS advisory.
+type Advisory struct {
+	ID       string
+	Title    string
+	URL      string
+	Released time.Time // Release of the current revision, zero when undated
+	Products []Product
+	Vulns    []Vuln
+}
+
+// Product is an affected product leaf of the CSAF product tree.
+type Product struct {
+	ID      string
+	Vendor  string
+	Name    string
+	Version string // Version or range, e.g. vers:intdot/<5.2.6
+	CPE     string
+}
+
+// Vuln is a CVE of an advisory with the products it affects.
+type Vuln struct {
+	CVE          string
+	Affected     []string // Product IDs
+	CVSSScore    float64
+	Severity     string
+	Remediations []Remediation
+}
+
+// Remediation is a mitigation, workaround or fix for some products.
+type Remediation struct {
+	Category   string
+	Details    string
+	ProductIDs []string
+}
+
+type csafDocument struct {
+	Document struct {
+		Title    string `json:"title"`
+		Tracking struct {
+			ID                 string `json:"id"`
+			InitialReleaseDate string `json:"initial_release_date"`
+			CurrentReleaseDate string `json:"current_release_date"`
+		} `json:"tracking"`
+		References []struct {
+			Category string `json:"category"`
+			URL      string `json:"url"`
+		} `json:"references"`
+	} `json:"document"`
+	ProductTree struct {
+		Branches []csafBranch `json:"branches"`
+	} `json:"product_tree"`
+	Vulnerabilities []struct {
+		CVE           string `json:"cve"`
+		ProductStatus struct {
+			KnownAffected []string `json:"known_affected"`
+		} `json:"product_status"`
+		Remediations []struct {
+			Category   string   `json:"category"`
+			Details    string   `json:"details"`
+			ProductIDs []string `json:"product_ids"`
+		} `json:"remediations"`
+		Scores []struct {
+			CVSSv3 *struct {
+				BaseScore    float64 `json:"baseScore"`
+				BaseSeverity string  `json:"baseSeverity"`
+			} `json:"cvss_v3"`
+		} `json:"scores"`
+	} `json:"vulnerabilities"`
+}
+
+type csafBranch struct {
+	Category string       `json:"category"`
+	Name     string       `json:"name"`
+	Branches []csafBranch `json:"branches"`
+	Product  *struct {
+		ProductID string `json:"product_id"`
+		Helper    *struct {
+			CPE string `json:"cpe"`
+		} `json:"product_identification_helper"`
+	} `json:"product"`
+}
+
+// ParseCSAF parses a CSAF 2.0 advisory document.
+func ParseCSAF(data []byte) (Advisory, error) {
+	var doc csafDocument
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return Advisory{}, fmt.Errorf("failed to decode CSAF document: %w", err)
+	}
+	if doc.Document.Tracking.ID == "" {
+		return Advisory{}, fmt.Errorf("CSAF document has no tracking ID")
+	}
+
+	advisory := Advisory{
+		ID:    doc.Document.Tracking.ID,
+		Title: doc.Document.Title,
+	}
+	for _, date := range []string{doc.Document.Tracking.CurrentReleaseDate, doc.Document.Tracking.InitialReleaseDate} {
+		if released, err := time.Parse(time.RFC3339, date); err == nil {
+			advisory.Released = released.UTC()
+			break
+		}
+	}
+	for _, ref := range doc.Document.References {
+		if ref.Category == "self" && strings.Contains(ref.URL, "cisa.gov") {
+			advisory.URL = ref.URL
+			break
+		}
+	}
+
+	for _, b := range doc.ProductTree.Branches {
+		walkBranch(b, Product{}, &advisory.Products)
+	}
+
+	for _, v := range doc.Vulnerabilities {
+		vuln := Vuln{CVE: v.CVE, Affected: v.ProductStatus.KnownAffected}
+		for _, s := range v.Scores {
+			if s.CVSSv3 != nil && s.CVSSv3.BaseScore > vuln.CVSSScore {
+				vuln.CVSSScore = s.CVSSv3.BaseScore
+				vuln.Severity = s.CVSSv3.BaseSeverity
+			}
+		}
+		for _, r := range v.Remediations {
+			vuln.Remediations = append(vuln.Remediations, Remediation{
+				Category:   r.Category,
+				Details:    strings.TrimSpace(r.Details),
+				ProductIDs: r.ProductIDs,
+			})
+		}
+		advisory.Vulns = append(advisory.Vulns, vuln)
+	}
+	return advisory, nil
+}
+
+// walkBranch collects the product leaves below b, carrying the vendor,
+// product name and version of the enclosing branches.
+func walkBranch(b csafBranch, p Product, products *[]Product) {
+	switch b.Category {
+	case "vendor":
+		p.Vendor = b.Name
+	case "product_name", "product_family":
+		p.Name = b.Name
+	case "product_version", "product_version_range":
+		p.Version = b.Name
+	}
+
+	if b.Product != nil {
+		p.ID = b.Product.ProductID
+		if b.Product.Helper != nil {
+			p.CPE = b.Product.Helper.CPE
+		}
+		*products = append(*products, p)
+	}
+	for _, child := range b.Branches {
+		walkBranch(child, p, products)
+	}
+}
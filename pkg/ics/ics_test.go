@@ -0,0 +1,153 @@
+package ics
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCSAF(t *testing.T) {
+	t.Parallel()
+	data, err := os.ReadFile("testdata/icsa-23-045-01.json")
+	require.NoError(t, err)
+
+	advisory, err := ParseCSAF(data)
+	require.NoError(t, err)
+	assert.Equal(t, "ICSA-23-045-01", advisory.ID)
+	assert.Equal(t, "https://www.cisa.gov/news-events/ics-advisories/icsa-23-045-01", advisory.URL)
+	assert.Equal(t, time.Date(2023, 2, 14, 0, 0, 0, 0, time.UTC), advisory.Released)
+	require.Len(t, advisory.Products, 2)
+	assert.Equal(t, Product{ID: "CSAFPID-0001", Vendor: "Siemens", Name: "SCALANCE X204-2", Version: "vers:intdot/<5.2.6"}, advisory.Products[0])
+	assert.Equal(t, "cpe:2.3:h:siemens:scalance_x206-1:-:*:*:*:*:*:*:*", advisory.Products[1].CPE)
+	require.Len(t, advisory.Vulns, 2)
+	assert.Equal(t, 7.5, advisory.Vulns[0].CVSSScore)
+
+	_, err = ParseCSAF([]byte(`{"document":{}}`))
+	assert.Error(t, err)
+}
+
+func TestIndex_Lookup(t *testing.T) {
+	t.Parallel()
+	idx := NewIndex()
+	assert.True(t, idx.Latest().IsZero())
+	loaded, err := idx.LoadDir("testdata")
+	require.NoError(t, err)
+	assert.Equal(t, 1, loaded)
+	assert.Equal(t, time.Date(2023, 2, 14, 0, 0, 0, 0, time.UTC), idx.Latest())
+
+	findings := idx.Lookup("cpe:2.3:h:siemens:scalance_x204-2:-:*:*:*:*:*:*:*")
+	require.Len(t, findings, 1)
+	assert.Equal(t, Finding{
+		CVE:              "CVE-2022-46140",
+		AdvisoryID:       "ICSA-23-045-01",
+		AdvisoryTitle:    "Siemens SCALANCE X-200 Switch Family",
+		URL:              "https://www.cisa.gov/news-events/ics-advisories/icsa-23-045-01",
+		CVSSScore:        7.5,
+		Severity:         "HIGH",
+		Mitigations:      []string{"Update to V5.2.6 or later version"},
+		AffectedVersions: []string{"vers:intdot/<5.2.6"},
+	}, findings[0])
+
+	findings = idx.Lookup("cpe:2.3:h:siemens:scalance_x206-1:-:*:*:*:*:*:*:*")
+	require.Len(t, findings, 2)
+	assert.Len(t, findings[0].Mitigations, 2)
+	assert.Equal(t, "CVE-2022-46141", findings[1].CVE)
+
+	assert.Empty(t, idx.Lookup("cpe:2.3:h:siemens:scalance_x308-2:-:*:*:*:*:*:*:*"))
+
+	// Only the versions below the fixed one are affected
+	assert.Len(t, idx.Lookup("cpe:2.3:h:siemens:scalance_x204-2:5.2.5:*:*:*:*:*:*:*"), 1)
+	assert.Empty(t, idx.Lookup("cpe:2.3:h:siemens:scalance_x204-2:5.2.6:*:*:*:*:*:*:*"))
+	assert.Empty(t, idx.Lookup("cpe:2.3:h:siemens:scalance_x206-1:v5.10:*:*:*:*:*:*:*"))
+}
+
+func Test_coversVersion(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		name    string
+		product Product
+		version string
+		want    bool
+	}{
+		{"Below the bound", Product{Version: "vers:intdot/<5.2.6"}, "5.2.5", true},
+		{"At the bound", Product{Version: "vers:intdot/<5.2.6"}, "5.2.6", false},
+		{"Within the interval", Product{Version: "vers:intdot/>=2.0|<3.1"}, "3.0.9", true},
+		{"Below the interval", Product{Version: "vers:intdot/>=2.0|<3.1"}, "1.9", false},
+		{"Between intervals", Product{Version: "vers:intdot/>=1.0|<1.5|>=2.0|<2.5"}, "1.7", false},
+		{"Second interval", Product{Version: "vers:intdot/>=1.0|<1.5|>=2.0|<2.5"}, "2.4", true},
+		{"Unbounded above", Product{Version: "vers:intdot/>=4.0"}, "10.1", true},
+		{"Listed version", Product{Version: "vers:intdot/1.0|1.2"}, "1.2", true},
+		{"Unlisted version", Product{Version: "vers:intdot/1.0|1.2"}, "1.1", false},
+		{"Excluded version", Product{Version: "vers:intdot/!=2.1|<3.0"}, "2.1", false},
+		{"Every version", Product{Version: "vers:all/*"}, "9.9", true},
+		{"Exact version", Product{Version: "V2.9"}, "2.9", true},
+		{"Other version", Product{Version: "V2.9"}, "3.0", false},
+		{"Free text", Product{Version: "All versions < V3.0"}, "3.1", true},
+		{"Helper CPE version", Product{CPE: "cpe:2.3:o:siemens:simatic_s7-1500_firmware:2.9.4:*:*:*:*:*:*:*"}, "2.9.3", false},
+		{"No version", Product{}, "1.0", true},
+		{"Unknown version", Product{Version: "vers:intdot/<5.2.6"}, "", true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, coversVersion(tc.product, tc.version))
+		})
+	}
+}
+
+func TestIndex_AddReplacesRevision(t *testing.T) {
+	t.Parallel()
+	idx := NewIndex()
+	advisory := Advisory{
+		ID:       "ICSA-24-001-01",
+		Products: []Product{{ID: "P1", Vendor: "Rockwell Automation", Name: "ControlLogix 5580"}},
+		Vulns:    []Vuln{{CVE: "CVE-2024-0001", Affected: []string{"P1"}}},
+	}
+	idx.Add(advisory)
+	idx.Add(advisory)
+
+	assert.Equal(t, 1, idx.Len())
+	assert.Len(t, idx.Lookup("cpe:2.3:o:rockwellautomation:controllogix_5580:-:*:*:*:*:*:*:*"), 1)
+}
+
+func TestSyncer_SyncOnce(t *testing.T) {
+	t.Parallel()
+	data, err := os.ReadFile("testdata/icsa-23-045-01.json")
+	require.NoError(t, err)
+
+	changed := time.Date(2023, 2, 14, 0, 0, 0, 0, time.UTC)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/changes.csv":
+			fmt.Fprintf(w, "\"2023/icsa-23-045-01.json\",\"%s\"\n\"../escape.json\",\"%s\"\n",
+				changed.Format(time.RFC3339), changed.Format(time.RFC3339))
+		case "/2023/icsa-23-045-01.json":
+			w.Write(data)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	idx := NewIndex()
+	syncer := NewSyncer(server.URL, dir, idx, time.Hour)
+
+	updated, err := syncer.SyncOnce(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, updated)
+	assert.Equal(t, 1, idx.Len())
+	assert.FileExists(t, filepath.Join(dir, "2023", "icsa-23-045-01.json"))
+
+	updated, err = syncer.SyncOnce(context.Background())
+	require.NoError(t, err)
+	assert.Zero(t, updated, "Expected unchanged advisories to be skipped")
+}
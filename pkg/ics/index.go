@@ -0,0 +1,348 @@
+package ics
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	nvdcpe "github.com/kptm-tools/vulnerability-analysis/nvd/cpe"
+)
+
+// Finding is a CVE of an ICS advisory affecting a looked up CPE.
+type Finding struct {
+	CVE              string
+	AdvisoryID       string
+	AdvisoryTitle    string
+	URL              string
+	CVSSScore        float64
+	Severity         string
+	Mitigations      []string
+	AffectedVersions []string
+}
+
+// Index maps products to the advisories affecting them.
+type Index struct {
+	mu         sync.RWMutex
+	advisories map[string]Advisory
+	byProduct  map[string][]productRef
+}
+
+type productRef struct {
+	advisoryID string
+	product    Product
+}
+
+func NewIndex() *Index {
+	return &Index{
+		advisories: make(map[string]Advisory),
+		byProduct:  make(map[string][]productRef),
+	}
+}
+
+// Add indexes an advisory, replacing a previous revision with the same ID.
+func (idx *Index) Add(a Advisory) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	if _, ok := idx.advisories[a.ID]; ok {
+		for key, refs := range idx.byProduct {
+			idx.byProduct[key] = slices.DeleteFunc(refs, func(r productRef) bool { return r.advisoryID == a.ID })
+		}
+	}
+	idx.advisories[a.ID] = a
+
+	for _, p := range a.Products {
+		for _, key := range productKeys(p) {
+			idx.byProduct[key] = append(idx.byProduct[key], productRef{advisoryID: a.ID, product: p})
+		}
+	}
+}
+
+// Len returns the number of indexed advisories.
+func (idx *Index) Len() int {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	return len(idx.advisories)
+}
+
+// Latest returns the release time of the most recent indexed advisory, zero
+// when none is dated. Since CISA publishes advisories every week, an old one
+// means the index is no longer synced.
+func (idx *Index) Latest() time.Time {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	var latest time.Time
+	for _, a := range idx.advisories {
+		if a.Released.After(latest) {
+			latest = a.Released
+		}
+	}
+	return latest
+}
+
+// LoadDir indexes every CSAF JSON document below dir. Documents that fail to
+// parse are reported but don't stop the load.
+func (idx *Index) LoadDir(dir string) (int, error) {
+	loaded := 0
+	var errs []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || filepath.Ext(path) != ".json" {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		advisory, err := ParseCSAF(data)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %s", path, err))
+			return nil
+		}
+		idx.Add(advisory)
+		loaded++
+		return nil
+	})
+	if err != nil {
+		return loaded, fmt.Errorf("failed to load ICS advisories from %s: %w", dir, err)
+	}
+	if len(errs) > 0 {
+		return loaded, fmt.Errorf("failed to parse %d ICS advisories: %s", len(errs), strings.Join(errs, "; "))
+	}
+	return loaded, nil
+}
+
+// Lookup returns the advisory CVEs affecting the product of a CPE 2.3 name,
+// with the mitigations and version ranges published for that product. When
+// the CPE has a version, only the advisory products whose version or range
+// covers it match.
+func (idx *Index) Lookup(cpe string) []Finding {
+	parts := strings.Split(cpe, ":")
+	if len(parts) < 5 {
+		return nil
+	}
+	key := normalize(parts[3]) + ":" + normalize(parts[4])
+	var version string
+	if len(parts) > 5 && parts[5] != "*" && parts[5] != "-" {
+		version = parts[5]
+	}
+
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	// Group the matching product IDs per advisory
+	matched := make(map[string][]Product)
+	var order []string
+	for _, ref := range idx.byProduct[key] {
+		if !coversVersion(ref.product, version) {
+			continue
+		}
+		if _, ok := matched[ref.advisoryID]; !ok {
+			order = append(order, ref.advisoryID)
+		}
+		matched[ref.advisoryID] = append(matched[ref.advisoryID], ref.product)
+	}
+
+	var findings []Finding
+	for _, id := range order {
+		advisory := idx.advisories[id]
+		products := matched[id]
+		for _, v := range advisory.Vulns {
+			affected := affectedProducts(products, v.Affected)
+			if len(affected) == 0 {
+				continue
+			}
+			f := Finding{
+				CVE:           v.CVE,
+				AdvisoryID:    advisory.ID,
+				AdvisoryTitle: advisory.Title,
+				URL:           advisory.URL,
+				CVSSScore:     v.CVSSScore,
+				Severity:      v.Severity,
+			}
+			for _, p := range affected {
+				if p.Version != "" && !slices.Contains(f.AffectedVersions, p.Version) {
+					f.AffectedVersions = append(f.AffectedVersions, p.Version)
+				}
+			}
+			for _, r := range v.Remediations {
+				if r.Details != "" && appliesTo(r.ProductIDs, affected) && !slices.Contains(f.Mitigations, r.Details) {
+					f.Mitigations = append(f.Mitigations, r.Details)
+				}
+			}
+			findings = append(findings, f)
+		}
+	}
+	return findings
+}
+
+func affectedProducts(products []Product, affectedIDs []string) []Product {
+	var affected []Product
+	for _, p := range products {
+		if slices.Contains(affectedIDs, p.ID) {
+			affected = append(affected, p)
+		}
+	}
+	return affected
+}
+
+// appliesTo reports whether a remediation covers one of the products.
+// Remediations without product IDs cover the whole advisory.
+func appliesTo(productIDs []string, products []Product) bool {
+	if len(productIDs) == 0 {
+		return true
+	}
+	for _, p := range products {
+		if slices.Contains(productIDs, p.ID) {
+			return true
+		}
+	}
+	return false
+}
+
+// coversVersion reports whether the version or range of an advisory
+// product covers version. Products without a version, and unknown versions,
+// match any.
+func coversVersion(p Product, version string) bool {
+	version = trimVersion(version)
+	if version == "" {
+		return true
+	}
+	switch {
+	case strings.HasPrefix(p.Version, "vers:"):
+		return inVersRange(p.Version, version)
+	case p.Version != "":
+		// Free text versions, e.g. "All versions < V3.0", can't be compared
+		if strings.ContainsAny(p.Version, " <>=|") {
+			return true
+		}
+		return nvdcpe.CompareVersions(trimVersion(p.Version), version) == 0
+	}
+	if parts := strings.Split(p.CPE, ":"); len(parts) > 5 && parts[5] != "*" && parts[5] != "-" {
+		return nvdcpe.CompareVersions(trimVersion(parts[5]), version) == 0
+	}
+	return true
+}
+
+// versConstraint is a constraint of a vers range, e.g. <5.2.6.
+type versConstraint struct {
+	comparator string
+	version    string
+}
+
+// inVersRange reports whether a vers range, e.g. vers:intdot/>=2.0|<5.2.6,
+// covers version, following the vers specification: equal constraints
+// match their version, the others bound the intervals between them in
+// version order. Ranges that fail to parse match any version.
+func inVersRange(vers, version string) bool {
+	_, spec, ok := strings.Cut(strings.TrimPrefix(vers, "vers:"), "/")
+	if !ok || spec == "" {
+		return true
+	}
+	if strings.TrimSpace(spec) == "*" {
+		return true
+	}
+
+	var bounds []versConstraint
+	for _, raw := range strings.Split(spec, "|") {
+		raw = strings.TrimSpace(raw)
+		c := versConstraint{version: raw}
+		for _, comparator := range []string{">=", "<=", "!=", "<", ">", "="} {
+			if strings.HasPrefix(raw, comparator) {
+				c = versConstraint{comparator: comparator, version: strings.TrimSpace(raw[len(comparator):])}
+				break
+			}
+		}
+		c.version = trimVersion(c.version)
+		if c.version == "" {
+			return true
+		}
+		cmp := nvdcpe.CompareVersions(version, c.version)
+		switch c.comparator {
+		case "", "=":
+			if cmp == 0 {
+				return true
+			}
+		case "!=":
+			if cmp == 0 {
+				return false
+			}
+		default:
+			bounds = append(bounds, c)
+		}
+	}
+	if len(bounds) == 0 {
+		return false
+	}
+	slices.SortFunc(bounds, func(a, b versConstraint) int { return nvdcpe.CompareVersions(a.version, b.version) })
+
+	satisfies := func(c versConstraint) bool {
+		cmp := nvdcpe.CompareVersions(version, c.version)
+		switch c.comparator {
+		case "<":
+			return cmp < 0
+		case "<=":
+			return cmp <= 0
+		case ">":
+			return cmp > 0
+		default:
+			return cmp >= 0
+		}
+	}
+	lower := func(c versConstraint) bool { return c.comparator == ">" || c.comparator == ">=" }
+
+	if first := bounds[0]; !lower(first) && satisfies(first) {
+		return true
+	}
+	if last := bounds[len(bounds)-1]; lower(last) && satisfies(last) {
+		return true
+	}
+	for i := 0; i+1 < len(bounds); i++ {
+		if lower(bounds[i]) && !lower(bounds[i+1]) && satisfies(bounds[i]) && satisfies(bounds[i+1]) {
+			return true
+		}
+	}
+	return false
+}
+
+// trimVersion drops the V prefix of vendor versions, e.g. V5.2.6.
+func trimVersion(version string) string {
+	return strings.TrimPrefix(strings.TrimPrefix(version, "v"), "V")
+}
+
+var nonAlphaNum = regexp.MustCompile(`[^a-z0-9]+`)
+
+// normalize drops case and punctuation, so that the CSAF names "Schneider
+// Electric" / "SCALANCE X204-2" match the CPE fields schneider-electric /
+// scalance_x204-2.
+func normalize(s string) string {
+	return nonAlphaNum.ReplaceAllString(strings.ToLower(s), "")
+}
+
+// productKeys returns the vendor:product keys a product is indexed under:
+// its names and, when the advisory provides it, its CPE.
+func productKeys(p Product) []string {
+	var keys []string
+	if p.Vendor != "" && p.Name != "" {
+		keys = append(keys, normalize(p.Vendor)+":"+normalize(p.Name))
+		// Product names often repeat the vendor, e.g. "Siemens SCALANCE X204-2"
+		if trimmed := strings.TrimPrefix(normalize(p.Name), normalize(p.Vendor)); trimmed != normalize(p.Name) && trimmed != "" {
+			keys = append(keys, normalize(p.Vendor)+":"+trimmed)
+		}
+	}
+	if parts := strings.Split(p.CPE, ":"); len(parts) >= 5 {
+		key := normalize(parts[3]) + ":" + normalize(parts[4])
+		if !slices.Contains(keys, key) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
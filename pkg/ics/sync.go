@@ -0,0 +1,145 @@
+package ics
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Syncer downloads the advisories of a CSAF provider directory, e.g. the
+// CISA CSAF repository, using its changes.csv listing. Documents are stored
+// below dir so restarts only fetch the advisories changed since.
+type Syncer struct {
+	BaseURL  string
+	dir      string
+	index    *Index
+	interval time.Duration
+	client   *http.Client
+
+	lastSync time.Time
+}
+
+func NewSyncer(baseURL, dir string, index *Index, interval time.Duration) *Syncer {
+	return &Syncer{
+		BaseURL:  strings.TrimSuffix(baseURL, "/"),
+		dir:      dir,
+		index:    index,
+		interval: interval,
+		client:   &http.Client{Timeout: 60 * time.Second},
+	}
+}
+
+// SyncOnce fetches the documents changed since the last sync and indexes
+// them. It returns the number of advisories updated.
+func (s *Syncer) SyncOnce(ctx context.Context) (int, error) {
+	changes, err := s.get(ctx, s.BaseURL+"/changes.csv")
+	if err != nil {
+		return 0, err
+	}
+
+	records, err := csv.NewReader(bytes.NewReader(changes)).ReadAll()
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse CSAF changes.csv: %w", err)
+	}
+
+	var latest time.Time
+	updated := 0
+	for _, record := range records {
+		if len(record) < 2 {
+			continue
+		}
+		changed, err := time.Parse(time.RFC3339, record[1])
+		if err != nil || !changed.After(s.lastSync) {
+			continue
+		}
+		if err := s.fetchDocument(ctx, record[0]); err != nil {
+			slog.Warn("Failed to fetch ICS advisory", slog.String("path", record[0]), slog.Any("error", err))
+			continue
+		}
+		updated++
+		if changed.After(latest) {
+			latest = changed
+		}
+	}
+	if latest.After(s.lastSync) {
+		s.lastSync = latest
+	}
+	return updated, nil
+}
+
+func (s *Syncer) fetchDocument(ctx context.Context, path string) error {
+	// changes.csv paths are relative, reject anything escaping dir
+	clean := filepath.Clean(filepath.FromSlash(path))
+	if filepath.IsAbs(clean) || strings.HasPrefix(clean, "..") {
+		return fmt.Errorf("invalid CSAF document path: %s", path)
+	}
+
+	data, err := s.get(ctx, s.BaseURL+"/"+path)
+	if err != nil {
+		return err
+	}
+	advisory, err := ParseCSAF(data)
+	if err != nil {
+		return err
+	}
+
+	if s.dir != "" {
+		target := filepath.Join(s.dir, clean)
+		if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+			return fmt.Errorf("failed to create ICS advisory directory: %w", err)
+		}
+		if err := os.WriteFile(target, data, 0o644); err != nil {
+			return fmt.Errorf("failed to store ICS advisory: %w", err)
+		}
+	}
+	s.index.Add(advisory)
+	return nil
+}
+
+func (s *Syncer) get(ctx context.Context, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create CSAF request: %w", err)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed CSAF request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected CSAF response status for %s: %s", url, resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, 50<<20))
+}
+
+// Run syncs every interval until ctx is cancelled. The first sync fetches
+// every document listed by the provider, the local copies are only a cache
+// for restarts without network access.
+func (s *Syncer) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		updated, err := s.SyncOnce(ctx)
+		if err != nil {
+			slog.Error("Failed to sync ICS advisories", slog.Any("error", err))
+		} else {
+			slog.Info("Synced ICS advisories", slog.Int("updated", updated), slog.Int("total", s.index.Len()))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
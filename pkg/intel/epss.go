@@ -0,0 +1,117 @@
+package intel
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultEPSSURL is the FIRST EPSS API endpoint.
+const DefaultEPSSURL = "https://api.first.org/data/v1/epss"
+
+// EPSSScore is the FIRST probability of exploitation of a CVE within 30
+// days, and its percentile among all scored CVEs, as of Date.
+type EPSSScore struct {
+	Probability float64 `json:"probability"`
+	Percentile  float64 `json:"percentile"`
+	Date        string  `json:"date"`
+}
+
+// EPSSClient looks CVEs up in the FIRST EPSS API.
+type EPSSClient struct {
+	baseURL string
+	client  *http.Client
+}
+
+var _ EPSSSource = (*EPSSClient)(nil)
+
+// NewEPSSClient returns a client of the EPSS API at baseURL, or of FIRST when
+// empty.
+func NewEPSSClient(baseURL string) *EPSSClient {
+	if baseURL == "" {
+		baseURL = DefaultEPSSURL
+	}
+	return &EPSSClient{baseURL: baseURL, client: &http.Client{Timeout: 30 * time.Second}}
+}
+
+// epssResponse is the envelope of the EPSS API, which sends numbers as
+// strings.
+type epssResponse struct {
+	Data []struct {
+		CVE        string `json:"cve"`
+		EPSS       string `json:"epss"`
+		Percentile string `json:"percentile"`
+		Date       string `json:"date"`
+	} `json:"data"`
+}
+
+// epssBatchSize is the number of CVEs looked up per request, keeping the
+// query within the length the API accepts.
+const epssBatchSize = 100
+
+// EPSS returns the score of a CVE, or nil when FIRST hasn't scored it.
+func (c *EPSSClient) EPSS(ctx context.Context, cveID string) (*EPSSScore, error) {
+	scores, err := c.Scores(ctx, []string{cveID})
+	if err != nil {
+		return nil, err
+	}
+	score, ok := scores[cveID]
+	if !ok {
+		return nil, nil
+	}
+	return &score, nil
+}
+
+// Scores returns the scores of cveIDs by CVE, leaving out the ones FIRST
+// hasn't scored. CVEs are looked up a hundred per request.
+func (c *EPSSClient) Scores(ctx context.Context, cveIDs []string) (map[string]EPSSScore, error) {
+	scores := make(map[string]EPSSScore, len(cveIDs))
+	for batch := range slices.Chunk(cveIDs, epssBatchSize) {
+		if err := c.fetch(ctx, batch, scores); err != nil {
+			return nil, err
+		}
+	}
+	return scores, nil
+}
+
+func (c *EPSSClient) fetch(ctx context.Context, cveIDs []string, scores map[string]EPSSScore) error {
+	query := url.Values{"cve": {strings.Join(cveIDs, ",")}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+"?"+query.Encode(), nil)
+	if err != nil {
+		return fmt.Errorf("failed to create EPSS request: %w", err)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed EPSS request: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("EPSS API returned %s", resp.Status)
+	}
+
+	var data epssResponse
+	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		return fmt.Errorf("failed to decode EPSS response: %w", err)
+	}
+	for _, d := range data.Data {
+		if !slices.Contains(cveIDs, d.CVE) {
+			continue
+		}
+		probability, err := strconv.ParseFloat(d.EPSS, 64)
+		if err != nil {
+			return fmt.Errorf("invalid EPSS probability of %s: %w", d.CVE, err)
+		}
+		percentile, err := strconv.ParseFloat(d.Percentile, 64)
+		if err != nil {
+			return fmt.Errorf("invalid EPSS percentile of %s: %w", d.CVE, err)
+		}
+		scores[d.CVE] = EPSSScore{Probability: probability, Percentile: percentile, Date: d.Date}
+	}
+	return nil
+}
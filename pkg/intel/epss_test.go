@@ -0,0 +1,53 @@
+package intel
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEPSSClient_EPSS(t *testing.T) {
+	t.Parallel()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("cve") != "CVE-2021-44228" {
+			_, _ = w.Write([]byte(`{"status":"OK","total":0,"data":[]}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"status":"OK","total":1,"data":[{"cve":"CVE-2021-44228","epss":"0.944560000","percentile":"0.999890000","date":"2024-01-01"}]}`))
+	}))
+	defer server.Close()
+
+	c := NewEPSSClient(server.URL)
+	score, err := c.EPSS(context.Background(), "CVE-2021-44228")
+	require.NoError(t, err)
+	assert.Equal(t, &EPSSScore{Probability: 0.94456, Percentile: 0.99989, Date: "2024-01-01"}, score)
+
+	score, err = c.EPSS(context.Background(), "CVE-2024-0001")
+	require.NoError(t, err)
+	assert.Nil(t, score)
+}
+
+func TestEPSSClient_Scores(t *testing.T) {
+	t.Parallel()
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.URL.Query().Get("cve"))
+		_, _ = w.Write([]byte(`{"status":"OK","total":1,"data":[{"cve":"CVE-2021-44228","epss":"0.944560000","percentile":"0.999890000","date":"2024-01-01"}]}`))
+	}))
+	defer server.Close()
+
+	ids := []string{"CVE-2021-44228"}
+	for i := range epssBatchSize {
+		ids = append(ids, fmt.Sprintf("CVE-2024-%04d", i))
+	}
+	scores, err := NewEPSSClient(server.URL).Scores(context.Background(), ids)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]EPSSScore{"CVE-2021-44228": {Probability: 0.94456, Percentile: 0.99989, Date: "2024-01-01"}}, scores)
+	require.Len(t, requests, 2, "Expected the CVEs to be looked up in batches")
+	assert.Equal(t, "CVE-2024-0099", requests[1])
+}
@@ -0,0 +1,244 @@
+// Package intel assembles what is known about a single CVE, its NVD record,
+// CISA KEV entry, EPSS score, exploit references and computed risk, into
+// one document for the CVE detail page of the platform.
+package intel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kptm-tools/common/common/pkg/enums"
+	"github.com/kptm-tools/vulnerability-analysis/nvd/schema"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/results"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/risk"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/tenant"
+)
+
+// ErrNotFound is returned for CVEs NVD has no record of.
+var ErrNotFound = errors.New("CVE not found")
+
+// CVESource fetches the NVD record of a CVE, e.g. an NVDClient.
+type CVESource interface {
+	FetchByCVEID(ctx context.Context, cveID string) (*schema.NvdAPIResponse, error)
+}
+
+// EPSSSource scores CVEs, returning nil for the ones it hasn't scored.
+type EPSSSource interface {
+	EPSS(ctx context.Context, cveID string) (*EPSSScore, error)
+}
+
+// Enricher turns an NVD record into a finding, e.g. a services.Enrichment.
+type Enricher interface {
+	Enrich(ctx context.Context, nvdVuln schema.Vulnerability) (results.Vulnerability, error)
+}
+
+// Document is the merged intelligence on a CVE. Sources which failed while
+// it was assembled are listed in Unavailable, their fields are left empty.
+type Document struct {
+	ID                string               `json:"id"`
+	NVD               schema.Vulnerability `json:"nvd"`
+	KEV               *KEVEntry            `json:"kev,omitempty"`
+	EPSS              *EPSSScore           `json:"epss,omitempty"`
+	ExploitReferences []string             `json:"exploit_references,omitempty"`
+	Risk              Risk                 `json:"risk"`
+	Unavailable       []string             `json:"unavailable,omitempty"`
+	AssembledAt       time.Time            `json:"assembled_at"`
+}
+
+// KEVEntry is the CISA Known Exploited Vulnerabilities entry of a CVE, as
+// published by NVD.
+type KEVEntry struct {
+	Name           string `json:"name,omitempty"`
+	DateAdded      string `json:"date_added"`
+	DueDate        string `json:"due_date,omitempty"`
+	RequiredAction string `json:"required_action,omitempty"`
+}
+
+// Risk is the score findings of the CVE get, before any host context.
+type Risk struct {
+	Model         string               `json:"model"`
+	Score         float64              `json:"score"`
+	Likelihood    enums.LikelyhoodType `json:"likelihood"`
+	BaseCVSSScore float64              `json:"base_cvss_score"`
+	BaseSeverity  enums.SeverityType   `json:"base_severity"`
+}
+
+// Aggregator assembles documents, caching them for a TTL per tenant since
+// the risk depends on the CVSS version the tenant prefers.
+type Aggregator struct {
+	cves     CVESource
+	epss     EPSSSource
+	enricher Enricher
+	ttl      time.Duration
+	now      func() time.Time
+
+	mu    sync.Mutex
+	cache map[string]cachedDocument
+}
+
+type cachedDocument struct {
+	doc     *Document
+	expires time.Time
+}
+
+// Option configures an Aggregator.
+type Option func(*Aggregator)
+
+// WithEPSS adds the EPSS scores of CVEs to their documents.
+func WithEPSS(source EPSSSource) Option {
+	return func(a *Aggregator) {
+		a.epss = source
+	}
+}
+
+// WithCacheTTL sets how long documents are served from the cache, zero
+// disables caching.
+func WithCacheTTL(ttl time.Duration) Option {
+	return func(a *Aggregator) {
+		a.ttl = ttl
+	}
+}
+
+// NewAggregator returns an aggregator of the records of cves, scored by
+// enricher. Documents are cached for an hour unless configured otherwise.
+func NewAggregator(cves CVESource, enricher Enricher, opts ...Option) *Aggregator {
+	a := &Aggregator{
+		cves:     cves,
+		enricher: enricher,
+		ttl:      time.Hour,
+		now:      time.Now,
+		cache:    make(map[string]cachedDocument),
+	}
+	for _, opt := range opts {
+		opt(a)
+	}
+	return a
+}
+
+// Intel returns the document of a CVE for the tenant of ctx. Documents
+// missing a source are not cached, so the next request retries it.
+func (a *Aggregator) Intel(ctx context.Context, cveID string) (*Document, error) {
+	key := tenant.FromContext(ctx) + "|" + cveID
+	if doc := a.cached(key); doc != nil {
+		return doc, nil
+	}
+
+	doc, err := a.assemble(ctx, cveID)
+	if err != nil {
+		return nil, err
+	}
+	if len(doc.Unavailable) == 0 {
+		a.store(key, doc)
+	}
+	return doc, nil
+}
+
+func (a *Aggregator) assemble(ctx context.Context, cveID string) (*Document, error) {
+	resp, err := a.cves.FetchByCVEID(ctx, cveID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch %s: %w", cveID, err)
+	}
+	i := slices.IndexFunc(resp.Vulnerabilities, func(v schema.Vulnerability) bool {
+		return strings.EqualFold(v.Cve.ID, cveID)
+	})
+	if i < 0 {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, cveID)
+	}
+	record := resp.Vulnerabilities[i]
+
+	doc := &Document{
+		ID:                record.Cve.ID,
+		NVD:               record,
+		KEV:               kevEntry(record.Cve),
+		ExploitReferences: exploitReferences(record.Cve.References),
+		AssembledAt:       a.now().UTC(),
+	}
+
+	// The risk is computed as for a finding, so the page matches the reports
+	vuln, err := a.enricher.Enrich(ctx, record)
+	if err != nil {
+		return nil, fmt.Errorf("failed to score %s: %w", cveID, err)
+	}
+	doc.Risk = Risk{
+		Model:         risk.Current.Name(),
+		Score:         vuln.RiskScore,
+		Likelihood:    vuln.Likelihood,
+		BaseCVSSScore: vuln.BaseCVSSScore,
+		BaseSeverity:  vuln.BaseSeverity,
+	}
+
+	if a.epss != nil {
+		doc.EPSS, err = a.epss.EPSS(ctx, record.Cve.ID)
+		if err != nil {
+			slog.Warn("EPSS unavailable, assembling CVE intel without it",
+				slog.String("cve_id", record.Cve.ID),
+				slog.Any("error", err))
+			doc.Unavailable = append(doc.Unavailable, "epss")
+		}
+	}
+	return doc, nil
+}
+
+func (a *Aggregator) cached(key string) *Document {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	entry, ok := a.cache[key]
+	if !ok || !a.now().Before(entry.expires) {
+		return nil
+	}
+	return entry.doc
+}
+
+// store caches doc, pruning the expired documents so the cache only holds
+// the CVEs viewed within the TTL.
+func (a *Aggregator) store(key string, doc *Document) {
+	if a.ttl <= 0 {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	now := a.now()
+	for k, entry := range a.cache {
+		if !now.Before(entry.expires) {
+			delete(a.cache, k)
+		}
+	}
+	a.cache[key] = cachedDocument{doc: doc, expires: now.Add(a.ttl)}
+}
+
+func kevEntry(cve schema.CveDetail) *KEVEntry {
+	if cve.CisaExploitAdd == nil {
+		return nil
+	}
+	deref := func(s *string) string {
+		if s == nil {
+			return ""
+		}
+		return *s
+	}
+	return &KEVEntry{
+		Name:           deref(cve.CisaVulnerabilityName),
+		DateAdded:      *cve.CisaExploitAdd,
+		DueDate:        deref(cve.CisaActionDue),
+		RequiredAction: deref(cve.CisaRequiredAction),
+	}
+}
+
+// exploitReferences returns the URLs of the references NVD tags as exploits.
+func exploitReferences(refs []schema.Reference) []string {
+	var urls []string
+	for _, ref := range refs {
+		if slices.Contains(ref.Tags, "Exploit") && !slices.Contains(urls, ref.URL) {
+			urls = append(urls, ref.URL)
+		}
+	}
+	return urls
+}
@@ -0,0 +1,108 @@
+package intel
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/kptm-tools/common/common/pkg/results/tools"
+	"github.com/kptm-tools/vulnerability-analysis/nvd/schema"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/results"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/tenant"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type stubCVEs struct {
+	fetches int
+}
+
+func (s *stubCVEs) FetchByCVEID(ctx context.Context, cveID string) (*schema.NvdAPIResponse, error) {
+	s.fetches++
+	if cveID != "CVE-2021-44228" {
+		return &schema.NvdAPIResponse{}, nil
+	}
+	added, action := "2021-12-10", "Apply updates per vendor instructions."
+	return &schema.NvdAPIResponse{Vulnerabilities: []schema.Vulnerability{{Cve: schema.CveDetail{
+		ID:                 cveID,
+		CisaExploitAdd:     &added,
+		CisaRequiredAction: &action,
+		References: []schema.Reference{
+			{URL: "https://logging.apache.org/log4j/2.x/security.html", Tags: []string{"Vendor Advisory"}},
+			{URL: "http://packetstormsecurity.com/files/165225", Tags: []string{"Exploit", "Third Party Advisory"}},
+		},
+	}}}}, nil
+}
+
+// stubEnricher scores CVEs 0.9 for the acme tenant and 0.5 for the others.
+type stubEnricher struct{}
+
+func (stubEnricher) Enrich(ctx context.Context, nvdVuln schema.Vulnerability) (results.Vulnerability, error) {
+	score := 0.5
+	if tenant.FromContext(ctx) == "acme" {
+		score = 0.9
+	}
+	return results.Vulnerability{Vulnerability: tools.Vulnerability{ID: nvdVuln.Cve.ID, RiskScore: score, BaseCVSSScore: 10}}, nil
+}
+
+type stubEPSS struct {
+	err error
+}
+
+func (s *stubEPSS) EPSS(ctx context.Context, cveID string) (*EPSSScore, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	return &EPSSScore{Probability: 0.97, Percentile: 0.99, Date: "2024-01-01"}, nil
+}
+
+func TestAggregator_Intel(t *testing.T) {
+	t.Parallel()
+	cves := &stubCVEs{}
+	epss := &stubEPSS{err: errors.New("timeout")}
+	a := NewAggregator(cves, stubEnricher{}, WithEPSS(epss))
+
+	doc, err := a.Intel(context.Background(), "CVE-2021-44228")
+	require.NoError(t, err)
+	assert.Equal(t, &KEVEntry{DateAdded: "2021-12-10", RequiredAction: "Apply updates per vendor instructions."}, doc.KEV)
+	assert.Equal(t, []string{"http://packetstormsecurity.com/files/165225"}, doc.ExploitReferences)
+	assert.Equal(t, 0.5, doc.Risk.Score)
+	assert.Equal(t, 10.0, doc.Risk.BaseCVSSScore)
+	assert.Nil(t, doc.EPSS)
+	assert.Equal(t, []string{"epss"}, doc.Unavailable)
+
+	// Incomplete documents aren't cached
+	epss.err = nil
+	doc, err = a.Intel(context.Background(), "CVE-2021-44228")
+	require.NoError(t, err)
+	assert.Equal(t, 0.97, doc.EPSS.Probability)
+	assert.Empty(t, doc.Unavailable)
+	assert.Equal(t, 2, cves.fetches)
+
+	_, err = a.Intel(context.Background(), "CVE-2021-44228")
+	require.NoError(t, err)
+	assert.Equal(t, 2, cves.fetches, "Expected the document to be served from the cache")
+
+	doc, err = a.Intel(tenant.WithID(context.Background(), "acme"), "CVE-2021-44228")
+	require.NoError(t, err)
+	assert.Equal(t, 0.9, doc.Risk.Score, "Expected documents to be cached per tenant")
+
+	_, err = a.Intel(context.Background(), "CVE-2024-0001")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestAggregator_CacheExpires(t *testing.T) {
+	t.Parallel()
+	cves := &stubCVEs{}
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	a := NewAggregator(cves, stubEnricher{}, WithCacheTTL(time.Minute))
+	a.now = func() time.Time { return now }
+
+	_, err := a.Intel(context.Background(), "CVE-2021-44228")
+	require.NoError(t, err)
+	now = now.Add(time.Minute)
+	_, err = a.Intel(context.Background(), "CVE-2021-44228")
+	require.NoError(t, err)
+	assert.Equal(t, 2, cves.fetches)
+}
@@ -3,8 +3,11 @@ package interfaces
 import (
 	"context"
 
+	"github.com/google/uuid"
+
 	"github.com/kptm-tools/common/common/pkg/events"
 	"github.com/kptm-tools/common/common/pkg/results/tools"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/results"
 )
 
 type INmapService interface {
@@ -14,3 +17,11 @@ type INmapService interface {
 type INmapHandler interface {
 	RunScan(context.Context, events.ScanStartedEvent) <-chan tools.ToolResult
 }
+
+type IEnrichmentService interface {
+	EnrichByIdentifiers(ctx context.Context, ids []string) ([]results.Vulnerability, error)
+}
+
+type IReanalysisService interface {
+	Reanalyze(ctx context.Context, scanID uuid.UUID, tenantID, hostAddress, cpe string) (tools.ToolResult, error)
+}
@@ -0,0 +1,125 @@
+package loadtest
+
+import (
+	"fmt"
+	"math/rand"
+
+	"github.com/Ullaakut/nmap/v2"
+)
+
+// weightedCPE is a service fingerprint as nmap reports it, together with how
+// often it shows up in real scans relative to the other entries.
+type weightedCPE struct {
+	name    string
+	port    uint16
+	product string
+	version string
+	cpe     string
+	weight  int
+}
+
+// serviceDistribution approximates the services most commonly detected on
+// internet-facing hosts. Some entries lack a version on purpose, since nmap
+// frequently reports incomplete CPEs that the pipeline must discard.
+var serviceDistribution = []weightedCPE{
+	{name: "ssh", port: 22, product: "OpenSSH", version: "8.0", cpe: "cpe:/a:openbsd:openssh:8.0", weight: 30},
+	{name: "ssh", port: 22, product: "OpenSSH", version: "7.4", cpe: "cpe:/a:openbsd:openssh:7.4", weight: 15},
+	{name: "http", port: 80, product: "Apache httpd", version: "2.4.6", cpe: "cpe:/a:apache:http_server:2.4.6", weight: 25},
+	{name: "http", port: 80, product: "nginx", version: "1.18.0", cpe: "cpe:/a:igor_sysoev:nginx:1.18.0", weight: 20},
+	{name: "https", port: 443, product: "nginx", version: "1.20.1", cpe: "cpe:/a:igor_sysoev:nginx:1.20.1", weight: 15},
+	{name: "http", port: 8080, product: "Apache Tomcat", version: "9.0.41", cpe: "cpe:/a:apache:tomcat:9.0.41", weight: 6},
+	{name: "mysql", port: 3306, product: "MySQL", version: "5.7.33", cpe: "cpe:/a:mysql:mysql:5.7.33", weight: 8},
+	{name: "smtp", port: 25, product: "Exim smtpd", version: "4.98", cpe: "cpe:/a:exim:exim:4.98", weight: 6},
+	{name: "smtp", port: 25, product: "Postfix smtpd", version: "", cpe: "cpe:/a:postfix:postfix", weight: 8},
+	{name: "domain", port: 53, product: "ISC BIND", version: "9.11.36", cpe: "cpe:/a:isc:bind:9.11.36", weight: 5},
+	{name: "ftp", port: 21, product: "Pure-FTPd", version: "", cpe: "cpe:/a:pureftpd:pure-ftpd", weight: 4},
+	{name: "ftp", port: 21, product: "vsftpd", version: "3.0.3", cpe: "cpe:/a:vsftpd_project:vsftpd:3.0.3", weight: 4},
+	{name: "imap", port: 143, product: "Dovecot imapd", version: "", cpe: "cpe:/a:dovecot:dovecot", weight: 5},
+	{name: "http", port: 80, product: "Microsoft IIS httpd", version: "10.0", cpe: "cpe:/a:microsoft:internet_information_services:10.0", weight: 6},
+}
+
+var osDistribution = []weightedCPE{
+	{name: "Linux 4.15 - 5.6", product: "Linux", cpe: "cpe:/o:linux:linux_kernel:5", weight: 50},
+	{name: "Red Hat Enterprise Linux 8", product: "Linux", cpe: "cpe:/o:redhat:enterprise_linux:8", weight: 20},
+	{name: "Microsoft Windows 10 1607", product: "Windows", cpe: "cpe:/o:microsoft:windows_10:1607", weight: 20},
+	{name: "FreeBSD 12.0-RELEASE", product: "FreeBSD", cpe: "cpe:/o:freebsd:freebsd:12.0", weight: 10},
+}
+
+// Generator produces synthetic nmap hosts for load testing.
+type Generator struct {
+	rng *rand.Rand
+}
+
+// NewGenerator creates a Generator. The same seed always yields the same scans.
+func NewGenerator(seed int64) *Generator {
+	return &Generator{rng: rand.New(rand.NewSource(seed))}
+}
+
+// Hosts generates n hosts with cpesPerHost services each, sampled from the
+// service distribution.
+func (g *Generator) Hosts(n, cpesPerHost int) []nmap.Host {
+	hosts := make([]nmap.Host, 0, n)
+	for i := 0; i < n; i++ {
+		hosts = append(hosts, g.host(i, cpesPerHost))
+	}
+	return hosts
+}
+
+func (g *Generator) host(i, cpesPerHost int) nmap.Host {
+	osEntry := sample(g.rng, osDistribution)
+
+	ports := make([]nmap.Port, 0, cpesPerHost)
+	for j := 0; j < cpesPerHost; j++ {
+		svc := sample(g.rng, serviceDistribution)
+		ports = append(ports, nmap.Port{
+			// Offset repeated ports so every port ID stays unique on the host
+			ID:       svc.port + uint16(j*1000),
+			Protocol: "tcp",
+			State:    nmap.State{State: string(nmap.Open)},
+			Service: nmap.Service{
+				Name:       svc.name,
+				Product:    svc.product,
+				Version:    svc.version,
+				Confidence: 10,
+				CPEs:       []nmap.CPE{nmap.CPE(svc.cpe)},
+			},
+		})
+	}
+
+	return nmap.Host{
+		Addresses: []nmap.Address{
+			{Addr: fmt.Sprintf("10.%d.%d.%d", (i>>16)&0xff, (i>>8)&0xff, i&0xff), AddrType: "ipv4"},
+		},
+		Hostnames: []nmap.Hostname{
+			{Name: fmt.Sprintf("host-%d.loadtest.local", i), Type: "user"},
+		},
+		Ports: ports,
+		OS: nmap.OS{
+			Matches: []nmap.OSMatch{
+				{
+					Name:     osEntry.name,
+					Accuracy: 90 + g.rng.Intn(10),
+					Classes: []nmap.OSClass{
+						{Family: osEntry.product, Type: "general purpose", CPEs: []nmap.CPE{nmap.CPE(osEntry.cpe)}},
+					},
+				},
+			},
+		},
+	}
+}
+
+func sample(rng *rand.Rand, entries []weightedCPE) weightedCPE {
+	total := 0
+	for _, e := range entries {
+		total += e.weight
+	}
+
+	n := rng.Intn(total)
+	for _, e := range entries {
+		if n < e.weight {
+			return e
+		}
+		n -= e.weight
+	}
+	return entries[len(entries)-1]
+}
@@ -0,0 +1,34 @@
+package loadtest
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Generator_Hosts(t *testing.T) {
+	t.Parallel()
+	hosts := NewGenerator(42).Hosts(20, 4)
+
+	assert.Len(t, hosts, 20)
+	for _, host := range hosts {
+		assert.Len(t, host.Ports, 4)
+		assert.NotEmpty(t, host.Addresses)
+		assert.NotEmpty(t, host.OS.Matches)
+
+		seen := make(map[uint16]bool)
+		for _, port := range host.Ports {
+			assert.False(t, seen[port.ID], "Expected unique port IDs per host")
+			seen[port.ID] = true
+			assert.NotEmpty(t, port.Service.CPEs)
+		}
+	}
+}
+
+func Test_Generator_Deterministic(t *testing.T) {
+	t.Parallel()
+	first := NewGenerator(7).Hosts(10, 3)
+	second := NewGenerator(7).Hosts(10, 3)
+
+	assert.Equal(t, first, second, "Expected the same seed to produce the same scans")
+}
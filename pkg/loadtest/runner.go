@@ -0,0 +1,177 @@
+package loadtest
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/Ullaakut/nmap/v2"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/nvdmock"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/services"
+)
+
+// Config describes a load test run.
+type Config struct {
+	Hosts           int
+	CPEsPerHost     int
+	Concurrency     int
+	Seed            int64
+	RequestInterval time.Duration // Pacing between NVD requests per host
+	MockLatency     time.Duration // Artificial latency of the mock NVD server
+	MaxVulnsPerCPE  int
+}
+
+// Report summarizes a load test run.
+type Report struct {
+	Hosts           int
+	CPELookups      int64
+	Vulnerabilities int
+	Duration        time.Duration
+	PeakHeapBytes   uint64
+	TotalAllocBytes uint64
+	NumGC           uint32
+}
+
+// HostsPerSecond returns the pipeline throughput in hosts.
+func (r Report) HostsPerSecond() float64 {
+	if r.Duration == 0 {
+		return 0
+	}
+	return float64(r.Hosts) / r.Duration.Seconds()
+}
+
+// LookupsPerSecond returns the pipeline throughput in NVD lookups.
+func (r Report) LookupsPerSecond() float64 {
+	if r.Duration == 0 {
+		return 0
+	}
+	return float64(r.CPELookups) / r.Duration.Seconds()
+}
+
+func (r Report) String() string {
+	return fmt.Sprintf(
+		"hosts=%d lookups=%d vulnerabilities=%d duration=%s hosts/s=%.2f lookups/s=%.2f peak_heap=%.1fMiB total_alloc=%.1fMiB gc=%d",
+		r.Hosts,
+		r.CPELookups,
+		r.Vulnerabilities,
+		r.Duration.Round(time.Millisecond),
+		r.HostsPerSecond(),
+		r.LookupsPerSecond(),
+		float64(r.PeakHeapBytes)/(1<<20),
+		float64(r.TotalAllocBytes)/(1<<20),
+		r.NumGC,
+	)
+}
+
+// Run generates synthetic scans and drives them through the analysis
+// pipeline against a mock NVD server.
+func Run(ctx context.Context, cfg Config) (Report, error) {
+	if cfg.Hosts <= 0 || cfg.CPEsPerHost <= 0 {
+		return Report{}, fmt.Errorf("hosts and cpes per host must be positive, got %d and %d", cfg.Hosts, cfg.CPEsPerHost)
+	}
+	if cfg.Concurrency <= 0 {
+		cfg.Concurrency = 1
+	}
+
+	mock := nvdmock.NewServer(nvdmock.Options{
+		Latency:        cfg.MockLatency,
+		MaxVulnsPerCPE: cfg.MaxVulnsPerCPE,
+	})
+	defer mock.Close()
+
+	svc := services.NewNmapService(services.NewNVDClient(
+		services.WithBaseURL(mock.URL),
+		services.WithRequestInterval(cfg.RequestInterval),
+		services.WithRateLimiter(nil),
+	))
+
+	hosts := NewGenerator(cfg.Seed).Hosts(cfg.Hosts, cfg.CPEsPerHost)
+
+	var before runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+
+	stopSampling := make(chan struct{})
+	peakHeap := make(chan uint64, 1)
+	go sampleHeap(stopSampling, peakHeap)
+
+	start := time.Now()
+	vulnCount := analyzeAll(ctx, svc, hosts, cfg.Concurrency)
+	duration := time.Since(start)
+
+	close(stopSampling)
+
+	var after runtime.MemStats
+	runtime.ReadMemStats(&after)
+
+	return Report{
+		Hosts:           len(hosts),
+		CPELookups:      mock.Requests(),
+		Vulnerabilities: vulnCount,
+		Duration:        duration,
+		PeakHeapBytes:   <-peakHeap,
+		TotalAllocBytes: after.TotalAlloc - before.TotalAlloc,
+		NumGC:           after.NumGC - before.NumGC,
+	}, ctx.Err()
+}
+
+func analyzeAll(ctx context.Context, svc *services.NmapService, hosts []nmap.Host, concurrency int) int {
+	jobs := make(chan nmap.Host)
+	counts := make(chan int)
+
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for host := range jobs {
+				res := svc.AnalyzeHost(ctx, host)
+				counts <- res.TotalVulnerabilities() + len(res.MostLikelyOS.Vulnerabilities)
+			}
+		}()
+	}
+
+	go func() {
+		defer close(jobs)
+		for _, host := range hosts {
+			select {
+			case jobs <- host:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	go func() {
+		wg.Wait()
+		close(counts)
+	}()
+
+	total := 0
+	for n := range counts {
+		total += n
+	}
+	return total
+}
+
+func sampleHeap(stop <-chan struct{}, peak chan<- uint64) {
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+
+	var max uint64
+	var stats runtime.MemStats
+	for {
+		runtime.ReadMemStats(&stats)
+		if stats.HeapAlloc > max {
+			max = stats.HeapAlloc
+		}
+		select {
+		case <-stop:
+			peak <- max
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package metrics
+
+import (
+	"sort"
+	"sync"
+)
+
+// RejectedCPE counts the CPEs reported by nmap that standardization or
+// validation rejected, by reason, e.g. missing_version.
+type RejectedCPE struct {
+	Reason string `json:"reason"`
+	Count  int    `json:"count"`
+}
+
+var rejectedCPEs = struct {
+	sync.Mutex
+	counts map[string]int
+}{counts: make(map[string]int)}
+
+// CountRejectedCPE counts a CPE rejected for reason. The counts are kept for
+// the lifetime of the process.
+func CountRejectedCPE(reason string) {
+	rejectedCPEs.Lock()
+	defer rejectedCPEs.Unlock()
+	rejectedCPEs.counts[reason]++
+}
+
+// RejectedCPEs returns the counts of the CPEs rejected so far, sorted by
+// reason.
+func RejectedCPEs() []RejectedCPE {
+	rejectedCPEs.Lock()
+	defer rejectedCPEs.Unlock()
+
+	counts := make([]RejectedCPE, 0, len(rejectedCPEs.counts))
+	for reason, n := range rejectedCPEs.counts {
+		counts = append(counts, RejectedCPE{Reason: reason, Count: n})
+	}
+	sort.Slice(counts, func(i, j int) bool { return counts[i].Reason < counts[j].Reason })
+	return counts
+}
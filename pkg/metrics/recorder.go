@@ -0,0 +1,140 @@
+// Package metrics keeps per-tenant vulnerability counts over time for the
+// operations dashboards.
+package metrics
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/kptm-tools/common/common/pkg/results/tools"
+)
+
+// Point is the number of open vulnerabilities of a tenant by severity at a
+// point in time, summed over the latest result of every host.
+type Point struct {
+	Time time.Time `json:"time"`
+	tools.SeverityCounts
+}
+
+// Recorder samples the vulnerability counts of each tenant every time a
+// result is recorded. Samples are aligned on step, the last sample of a step
+// wins, and samples older than retention are dropped.
+type Recorder struct {
+	mu        sync.RWMutex
+	step      time.Duration
+	retention time.Duration
+
+	hosts  map[string]map[string]tools.SeverityCounts // tenant -> host -> counts
+	series map[string][]Point                         // tenant -> samples, oldest first
+	total  map[string]int                             // tenant -> results recorded
+}
+
+func NewRecorder(step, retention time.Duration) *Recorder {
+	if step <= 0 {
+		step = time.Minute
+	}
+	return &Recorder{
+		step:      step,
+		retention: retention,
+		hosts:     make(map[string]map[string]tools.SeverityCounts),
+		series:    make(map[string][]Point),
+		total:     make(map[string]int),
+	}
+}
+
+// Record replaces the counts of a host and samples the tenant totals.
+func (r *Recorder) Record(tenantID, host string, counts tools.SeverityCounts, at time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.hosts[tenantID] == nil {
+		r.hosts[tenantID] = make(map[string]tools.SeverityCounts)
+	}
+	r.hosts[tenantID][host] = counts
+	r.total[tenantID]++
+
+	var sum tools.SeverityCounts
+	for _, c := range r.hosts[tenantID] {
+		sum = addCounts(sum, c)
+	}
+
+	point := Point{Time: at.UTC().Truncate(r.step), SeverityCounts: sum}
+	series := r.series[tenantID]
+	if n := len(series); n > 0 && !series[n-1].Time.Before(point.Time) {
+		series[n-1].SeverityCounts = sum
+	} else {
+		series = append(series, point)
+	}
+
+	if r.retention > 0 {
+		cutoff := point.Time.Add(-r.retention)
+		drop := sort.Search(len(series), func(i int) bool { return !series[i].Time.Before(cutoff) })
+		series = series[drop:]
+	}
+	r.series[tenantID] = series
+}
+
+// Series returns the samples of a tenant between from and to, inclusive.
+func (r *Recorder) Series(tenantID string, from, to time.Time) []Point {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var points []Point
+	for _, p := range r.series[tenantID] {
+		if !p.Time.Before(from) && !p.Time.After(to) {
+			points = append(points, p)
+		}
+	}
+	return points
+}
+
+// Tenants returns the tenants with recorded results, sorted.
+func (r *Recorder) Tenants() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	tenants := make([]string, 0, len(r.series))
+	for t := range r.series {
+		tenants = append(tenants, t)
+	}
+	sort.Strings(tenants)
+	return tenants
+}
+
+// Snapshot is the current state of a tenant.
+type Snapshot struct {
+	Tenant  string
+	Hosts   int
+	Results int
+	tools.SeverityCounts
+}
+
+// Snapshots returns the current counts of every tenant.
+func (r *Recorder) Snapshots() []Snapshot {
+	tenants := r.Tenants()
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	snapshots := make([]Snapshot, 0, len(tenants))
+	for _, t := range tenants {
+		s := Snapshot{Tenant: t, Hosts: len(r.hosts[t]), Results: r.total[t]}
+		if series := r.series[t]; len(series) > 0 {
+			s.SeverityCounts = series[len(series)-1].SeverityCounts
+		}
+		snapshots = append(snapshots, s)
+	}
+	return snapshots
+}
+
+func addCounts(a, b tools.SeverityCounts) tools.SeverityCounts {
+	return tools.SeverityCounts{
+		Critical: a.Critical + b.Critical,
+		High:     a.High + b.High,
+		Medium:   a.Medium + b.Medium,
+		Low:      a.Low + b.Low,
+		None:     a.None + b.None,
+		Unknown:  a.Unknown + b.Unknown,
+	}
+}
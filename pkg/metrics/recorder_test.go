@@ -0,0 +1,50 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kptm-tools/common/common/pkg/results/tools"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecorder_Series(t *testing.T) {
+	t.Parallel()
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	r := NewRecorder(5*time.Minute, time.Hour)
+
+	r.Record("acme", "10.0.0.1", tools.SeverityCounts{Critical: 1, High: 2}, start)
+	r.Record("acme", "10.0.0.2", tools.SeverityCounts{High: 1}, start.Add(time.Minute))
+	// A rescan of the first host replaces its counts
+	r.Record("acme", "10.0.0.1", tools.SeverityCounts{High: 1}, start.Add(6*time.Minute))
+	r.Record("globex", "10.0.0.1", tools.SeverityCounts{Low: 4}, start)
+
+	points := r.Series("acme", start, start.Add(time.Hour))
+	require.Len(t, points, 2)
+	assert.Equal(t, start, points[0].Time)
+	assert.Equal(t, tools.SeverityCounts{Critical: 1, High: 3}, points[0].SeverityCounts)
+	assert.Equal(t, start.Add(5*time.Minute), points[1].Time)
+	assert.Equal(t, tools.SeverityCounts{High: 2}, points[1].SeverityCounts)
+
+	assert.Equal(t, []string{"acme", "globex"}, r.Tenants())
+
+	snapshots := r.Snapshots()
+	require.Len(t, snapshots, 2)
+	assert.Equal(t, 2, snapshots[0].Hosts)
+	assert.Equal(t, 3, snapshots[0].Results)
+}
+
+func TestRecorder_Retention(t *testing.T) {
+	t.Parallel()
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	r := NewRecorder(time.Minute, 10*time.Minute)
+
+	for i := range 30 {
+		r.Record("acme", "10.0.0.1", tools.SeverityCounts{High: i}, start.Add(time.Duration(i)*time.Minute))
+	}
+
+	points := r.Series("acme", start, start.Add(time.Hour))
+	require.Len(t, points, 11)
+	assert.Equal(t, start.Add(19*time.Minute), points[0].Time)
+}
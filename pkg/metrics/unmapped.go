@@ -0,0 +1,50 @@
+package metrics
+
+import (
+	"sort"
+	"sync"
+)
+
+// UnmappedValue counts the findings enriched from an NVD metric value the
+// common enums have no value for, e.g. a severity NVD introduced since.
+type UnmappedValue struct {
+	Field string `json:"field"`
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+type unmappedKey struct {
+	field, value string
+}
+
+var unmapped = struct {
+	sync.Mutex
+	counts map[unmappedKey]int
+}{counts: make(map[unmappedKey]int)}
+
+// CountUnmapped counts a finding whose field held value, which the common
+// enums don't cover. The counts are kept for the lifetime of the process.
+func CountUnmapped(field, value string) {
+	unmapped.Lock()
+	defer unmapped.Unlock()
+	unmapped.counts[unmappedKey{field, value}]++
+}
+
+// Unmapped returns the counts of the unmapped values seen so far, sorted by
+// field and value.
+func Unmapped() []UnmappedValue {
+	unmapped.Lock()
+	defer unmapped.Unlock()
+
+	values := make([]UnmappedValue, 0, len(unmapped.counts))
+	for k, n := range unmapped.counts {
+		values = append(values, UnmappedValue{Field: k.field, Value: k.value, Count: n})
+	}
+	sort.Slice(values, func(i, j int) bool {
+		if values[i].Field != values[j].Field {
+			return values[i].Field < values[j].Field
+		}
+		return values[i].Value < values[j].Value
+	})
+	return values
+}
@@ -0,0 +1,219 @@
+package mirror
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kptm-tools/vulnerability-analysis/nvd/schema"
+)
+
+// DefaultFeedURL is where the NVD publishes its CVE JSON 2.0 data feeds.
+const DefaultFeedURL = "https://nvd.nist.gov/feeds/json/cve/2.0"
+
+const (
+	// FirstFeedYear is the first yearly feed, which also holds the CVEs
+	// published before it.
+	FirstFeedYear = 2002
+	// ModifiedFeedWindow is how far back the modified feed is complete. NVD
+	// keeps 8 days of changes in it, the last one is left as margin.
+	ModifiedFeedWindow = 7 * 24 * time.Hour
+
+	modifiedFeed = "modified"
+)
+
+// feedMeta is the .meta file published next to each feed.
+type feedMeta struct {
+	LastModified time.Time
+	Size         int64
+	SHA256       string
+}
+
+// FeedUpstream syncs a mirror from the NVD data feeds rather than the API,
+// so a full mirror takes a couple dozen downloads instead of thousands of
+// paginated requests. The first sync, or one older than the modified feed
+// window, downloads the yearly feeds; later syncs only the modified feed.
+type FeedUpstream struct {
+	baseURL string
+	client  *http.Client
+	now     func() time.Time
+}
+
+var _ Upstream = (*FeedUpstream)(nil)
+
+// NewFeedUpstream creates an upstream downloading the feeds under baseURL,
+// or DefaultFeedURL when empty, through transport, e.g. one going through the
+// proxy of the NVD API client. A nil transport uses the default one.
+func NewFeedUpstream(baseURL string, transport http.RoundTripper) *FeedUpstream {
+	if baseURL == "" {
+		baseURL = DefaultFeedURL
+	}
+	return &FeedUpstream{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		client:  &http.Client{Timeout: 10 * time.Minute, Transport: transport},
+		now:     time.Now,
+	}
+}
+
+// FetchModified returns the records of the feeds modified since the given
+// time. Feeds not regenerated since then are skipped without downloading
+// them. The records are complete up to the oldest generation time of the
+// downloaded feeds.
+func (u *FeedUpstream) FetchModified(ctx context.Context, since time.Time) ([]schema.Vulnerability, time.Time, error) {
+	feeds := []string{modifiedFeed}
+	if since.IsZero() || u.now().Sub(since) > ModifiedFeedWindow {
+		feeds = feeds[:0]
+		for year := FirstFeedYear; year <= u.now().UTC().Year(); year++ {
+			feeds = append(feeds, strconv.Itoa(year))
+		}
+	}
+
+	var records []schema.Vulnerability
+	until := time.Time{}
+	for _, feed := range feeds {
+		meta, err := u.fetchMeta(ctx, feed)
+		if err != nil {
+			return nil, time.Time{}, err
+		}
+		if !since.IsZero() && meta.LastModified.Before(since) {
+			continue
+		}
+
+		vulns, err := u.fetchFeed(ctx, feed, meta)
+		if err != nil {
+			return nil, time.Time{}, err
+		}
+		for _, vuln := range vulns {
+			if !lastModified(vuln).Before(since) {
+				records = append(records, vuln)
+			}
+		}
+		if until.IsZero() || meta.LastModified.Before(until) {
+			until = meta.LastModified
+		}
+	}
+
+	// Nothing was regenerated, the mirror is as recent as it was
+	if until.IsZero() {
+		until = since
+	}
+	return records, until.UTC(), nil
+}
+
+func (u *FeedUpstream) feedURL(feed, ext string) string {
+	return fmt.Sprintf("%s/nvdcve-2.0-%s.%s", u.baseURL, feed, ext)
+}
+
+func (u *FeedUpstream) get(ctx context.Context, url string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create feed request: %w", err)
+	}
+	resp, err := u.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed feed request %s: %w", url, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("unexpected feed response status for %s: %s", url, resp.Status)
+	}
+	return resp, nil
+}
+
+func (u *FeedUpstream) fetchMeta(ctx context.Context, feed string) (feedMeta, error) {
+	resp, err := u.get(ctx, u.feedURL(feed, "meta"))
+	if err != nil {
+		return feedMeta{}, err
+	}
+	defer resp.Body.Close()
+
+	meta, err := parseFeedMeta(resp.Body)
+	if err != nil {
+		return feedMeta{}, fmt.Errorf("invalid meta of feed %s: %w", feed, err)
+	}
+	return meta, nil
+}
+
+// fetchFeed downloads a feed and checks it against the size and checksum of
+// its meta, which are those of the uncompressed JSON.
+func (u *FeedUpstream) fetchFeed(ctx context.Context, feed string, meta feedMeta) ([]schema.Vulnerability, error) {
+	resp, err := u.get(ctx, u.feedURL(feed, "json.gz"))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	zr, err := gzip.NewReader(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress feed %s: %w", feed, err)
+	}
+	defer zr.Close()
+
+	hash := sha256.New()
+	counter := &countingWriter{}
+	var data schema.NvdAPIResponse
+	if err := json.NewDecoder(io.TeeReader(zr, io.MultiWriter(hash, counter))).Decode(&data); err != nil {
+		return nil, fmt.Errorf("failed to decode feed %s: %w", feed, err)
+	}
+	// Hash the trailing bytes too, the decoder stops after the object
+	if _, err := io.Copy(io.MultiWriter(hash, counter), zr); err != nil {
+		return nil, fmt.Errorf("failed to read feed %s: %w", feed, err)
+	}
+
+	if meta.Size > 0 && counter.n != meta.Size {
+		return nil, fmt.Errorf("feed %s is %d bytes, its meta announces %d", feed, counter.n, meta.Size)
+	}
+	if sum := hex.EncodeToString(hash.Sum(nil)); meta.SHA256 != "" && !strings.EqualFold(sum, meta.SHA256) {
+		return nil, fmt.Errorf("feed %s checksum mismatch: got %s, its meta announces %s", feed, sum, meta.SHA256)
+	}
+	return data.Vulnerabilities, nil
+}
+
+// parseFeedMeta parses the key:value lines of a feed meta file.
+func parseFeedMeta(r io.Reader) (feedMeta, error) {
+	var meta feedMeta
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if !ok {
+			continue
+		}
+		var err error
+		switch key {
+		case "lastModifiedDate":
+			meta.LastModified, err = time.Parse(time.RFC3339, value)
+		case "size":
+			meta.Size, err = strconv.ParseInt(value, 10, 64)
+		case "sha256":
+			meta.SHA256 = value
+		}
+		if err != nil {
+			return feedMeta{}, fmt.Errorf("invalid %s: %w", key, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return feedMeta{}, err
+	}
+	if meta.LastModified.IsZero() {
+		return feedMeta{}, fmt.Errorf("missing lastModifiedDate")
+	}
+	return meta, nil
+}
+
+type countingWriter struct {
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	return len(p), nil
+}
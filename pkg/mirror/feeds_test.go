@@ -0,0 +1,180 @@
+package mirror
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kptm-tools/vulnerability-analysis/nvd/schema"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testFeed struct {
+	lastModified time.Time
+	records      []schema.Vulnerability
+	corrupt      bool
+}
+
+// newFeedServer serves feeds by name with their meta files, counting the
+// feed downloads.
+func newFeedServer(t *testing.T, feeds map[string]testFeed) (*httptest.Server, map[string]int) {
+	t.Helper()
+	downloads := make(map[string]int)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(r.URL.Path, "/nvdcve-2.0-")
+		name, ext, _ := strings.Cut(name, ".")
+		feed, ok := feeds[name]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+
+		data, err := json.Marshal(schema.NvdAPIResponse{Vulnerabilities: feed.records})
+		require.NoError(t, err)
+		sum := sha256.Sum256(data)
+
+		switch ext {
+		case "meta":
+			if feed.corrupt {
+				sum[0] ^= 0xff
+			}
+			fmt.Fprintf(w, "lastModifiedDate:%s\r\nsize:%d\r\nsha256:%s\r\n",
+				feed.lastModified.Format(time.RFC3339), len(data), strings.ToUpper(hex.EncodeToString(sum[:])))
+		case "json.gz":
+			downloads[name]++
+			zw := gzip.NewWriter(w)
+			_, _ = zw.Write(data)
+			_ = zw.Close()
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server, downloads
+}
+
+func TestFeedUpstream_FullThenIncremental(t *testing.T) {
+	t.Parallel()
+	now := time.Date(2003, 6, 1, 12, 0, 0, 0, time.UTC)
+	feeds := map[string]testFeed{
+		"2002": {
+			lastModified: now.Add(-3 * time.Hour),
+			records:      []schema.Vulnerability{record("CVE-2002-0001", "2003-05-01T00:00:00.000")},
+		},
+		"2003": {
+			lastModified: now.Add(-2 * time.Hour),
+			records:      []schema.Vulnerability{record("CVE-2003-0001", "2003-05-30T00:00:00.000")},
+		},
+	}
+	server, downloads := newFeedServer(t, feeds)
+
+	upstream := NewFeedUpstream(server.URL, nil)
+	upstream.now = func() time.Time { return now }
+	store := NewStore()
+	syncer := NewSyncer(store, upstream, time.Hour, time.Time{})
+
+	synced, err := syncer.SyncOnce(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 2, synced)
+	assert.Equal(t, now.Add(-3*time.Hour), store.SyncedUntil(), "complete up to the oldest feed")
+	_, err = store.LookupCVE("CVE-2002-0001")
+	assert.NoError(t, err)
+
+	// The next sync only downloads the modified feed
+	feeds["modified"] = testFeed{
+		lastModified: now.Add(time.Hour),
+		records: []schema.Vulnerability{
+			record("CVE-2003-0001", "2003-05-30T00:00:00.000"),
+			record("CVE-2003-0002", "2003-06-01T12:30:00.000"),
+		},
+	}
+	upstream.now = func() time.Time { return now.Add(2 * time.Hour) }
+	synced, err = syncer.SyncOnce(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, synced, "records modified before the last sync are left out")
+	assert.Equal(t, 3, store.Len())
+	assert.Equal(t, now.Add(time.Hour), store.SyncedUntil())
+	assert.Equal(t, map[string]int{"2002": 1, "2003": 1, "modified": 1}, downloads)
+}
+
+func TestFeedUpstream_SkipsFeedsNotRegenerated(t *testing.T) {
+	t.Parallel()
+	now := time.Date(2003, 6, 1, 12, 0, 0, 0, time.UTC)
+	server, downloads := newFeedServer(t, map[string]testFeed{
+		"2002": {lastModified: now.Add(-30 * 24 * time.Hour)},
+		"2003": {
+			lastModified: now.Add(-time.Hour),
+			records:      []schema.Vulnerability{record("CVE-2003-0001", "2003-05-31T00:00:00.000")},
+		},
+	})
+
+	upstream := NewFeedUpstream(server.URL, nil)
+	upstream.now = func() time.Time { return now }
+	records, until, err := upstream.FetchModified(context.Background(), now.Add(-10*24*time.Hour))
+	require.NoError(t, err)
+	assert.Len(t, records, 1)
+	assert.Equal(t, now.Add(-time.Hour), until)
+	assert.Equal(t, map[string]int{"2003": 1}, downloads)
+}
+
+func TestFeedUpstream_ChecksumMismatch(t *testing.T) {
+	t.Parallel()
+	now := time.Date(2002, 6, 1, 12, 0, 0, 0, time.UTC)
+	server, _ := newFeedServer(t, map[string]testFeed{
+		"2002": {lastModified: now, records: []schema.Vulnerability{record("CVE-2002-0001", "2002-05-01T00:00:00.000")}, corrupt: true},
+	})
+
+	upstream := NewFeedUpstream(server.URL, nil)
+	upstream.now = func() time.Time { return now }
+	_, _, err := upstream.FetchModified(context.Background(), time.Time{})
+	assert.ErrorContains(t, err, "checksum mismatch")
+}
+
+func TestFeedUpstream_Transport(t *testing.T) {
+	t.Parallel()
+	now := time.Date(2002, 6, 1, 12, 0, 0, 0, time.UTC)
+	server, _ := newFeedServer(t, map[string]testFeed{
+		"2002": {lastModified: now, records: []schema.Vulnerability{record("CVE-2002-0001", "2002-05-01T00:00:00.000")}},
+	})
+
+	transport := &countingTransport{next: http.DefaultTransport}
+	upstream := NewFeedUpstream(server.URL, transport)
+	upstream.now = func() time.Time { return now }
+	records, _, err := upstream.FetchModified(context.Background(), time.Time{})
+	require.NoError(t, err)
+	assert.Len(t, records, 1)
+	assert.Equal(t, 2, transport.requests, "Expected the meta and feed downloads to go through the transport")
+}
+
+// countingTransport counts the requests sent through it.
+type countingTransport struct {
+	next     http.RoundTripper
+	requests int
+}
+
+func (t *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.requests++
+	return t.next.RoundTrip(req)
+}
+
+func Test_parseFeedMeta(t *testing.T) {
+	t.Parallel()
+	meta, err := parseFeedMeta(bytes.NewBufferString("lastModifiedDate:2024-05-01T03:00:01-04:00\r\nsize:1024\r\nzipSize:100\r\ngzSize:90\r\nsha256:ABCD\r\n"))
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 5, 1, 7, 0, 1, 0, time.UTC), meta.LastModified.UTC())
+	assert.Equal(t, int64(1024), meta.Size)
+	assert.Equal(t, "ABCD", meta.SHA256)
+
+	_, err = parseFeedMeta(bytes.NewBufferString("size:1024\n"))
+	assert.Error(t, err)
+}
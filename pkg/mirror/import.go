@@ -0,0 +1,307 @@
+package mirror
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/kptm-tools/vulnerability-analysis/nvd/schema"
+)
+
+// DefaultImportBatchSize is the number of records an Importer loads per
+// transaction.
+const DefaultImportBatchSize = 5000
+
+// BatchLoader is where an Importer loads records, such as a PostgresBackend.
+type BatchLoader interface {
+	// Loaded returns how far previous imports of source got. Imports of
+	// the same name with another digest don't count.
+	Loaded(ctx context.Context, source ImportSource) (ImportState, error)
+	// LoadBatch loads the records of source from offset on and records the
+	// progress of the import, last marking it complete up to
+	// source.SyncedUntil.
+	LoadBatch(ctx context.Context, source ImportSource, offset int, records []schema.Vulnerability, last bool) error
+	// Commit raises the time the mirror is synced up to, records being
+	// empty once an import completes.
+	Commit(ctx context.Context, records []schema.Vulnerability, until time.Time) error
+}
+
+// ImportSource is a file an Importer loads, tracked by base name and the
+// sha256 of its content, so that a feed republished under the same name is
+// loaded again.
+type ImportSource struct {
+	Name   string
+	Digest string
+	// SyncedUntil is the time the file is complete up to, the timestamp of
+	// NVD feeds and API responses or the synced_until of snapshots. It is
+	// zero until the file is read, and for files without one.
+	SyncedUntil time.Time
+}
+
+// ImportState is how far previous imports of a source got.
+type ImportState struct {
+	Loaded      int
+	Done        bool
+	SyncedUntil time.Time
+}
+
+var _ BatchLoader = (*PostgresBackend)(nil)
+
+// ImportProgress is reported after every batch an Importer loads.
+type ImportProgress struct {
+	Source string
+	// Loaded is the number of records of Source loaded so far, including
+	// the Skipped ones loaded by previous imports.
+	Loaded  int
+	Skipped int
+	Done    bool
+	// Total is the number of records loaded by this import across sources.
+	Total   int
+	Elapsed time.Duration
+}
+
+// Rate returns the number of records per second this import loads.
+func (p ImportProgress) Rate() float64 {
+	if p.Elapsed <= 0 {
+		return 0
+	}
+	return float64(p.Total) / p.Elapsed.Seconds()
+}
+
+// Importer bulk loads files of CVE records, such as the NVD data feeds,
+// saved NVD API responses or mirror snapshots. Files are loaded in batches
+// and an interrupted import resumes after the last batch it loaded, unless
+// the file changed in between.
+type Importer struct {
+	loader    BatchLoader
+	BatchSize int
+	// Progress, when set, is called after every batch.
+	Progress func(ImportProgress)
+
+	start time.Time
+	total int
+}
+
+func NewImporter(loader BatchLoader) *Importer {
+	return &Importer{loader: loader, BatchSize: DefaultImportBatchSize}
+}
+
+// Import loads the records of paths, which are plain or gzip compressed
+// JSON, and returns the number of records it loaded. Files are tracked by
+// base name and content, those completely loaded by a previous import are
+// skipped.
+// Once every file is loaded, the mirror is synced up to the oldest of their
+// timestamps, so paths should be the complete set of feeds, as published
+// together by the NVD. The sync time is left as is when a file has none.
+func (im *Importer) Import(ctx context.Context, paths ...string) (int, error) {
+	im.start, im.total = time.Now(), 0
+	var until time.Time
+	timestamped := len(paths) > 0
+	for _, path := range paths {
+		synced, err := im.importFile(ctx, path)
+		if err != nil {
+			return im.total, err
+		}
+		if synced.IsZero() {
+			timestamped = false
+		} else if until.IsZero() || synced.Before(until) {
+			until = synced
+		}
+	}
+	if !timestamped {
+		return im.total, nil
+	}
+	if err := im.loader.Commit(ctx, nil, until); err != nil {
+		return im.total, fmt.Errorf("failed to mark the mirror synced until %s: %w", until.Format(time.RFC3339), err)
+	}
+	return im.total, nil
+}
+
+// importFile loads the records of path and returns the time it is complete
+// up to.
+func (im *Importer) importFile(ctx context.Context, path string) (time.Time, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer f.Close()
+	digest, err := fileDigest(f)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to hash %s: %w", path, err)
+	}
+
+	source := ImportSource{Name: filepath.Base(path), Digest: digest}
+	state, err := im.loader.Loaded(ctx, source)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if state.Done {
+		im.report(ImportProgress{Source: source.Name, Loaded: state.Loaded, Skipped: state.Loaded, Done: true})
+		return state.SyncedUntil, nil
+	}
+
+	batchSize := im.BatchSize
+	if batchSize <= 0 {
+		batchSize = DefaultImportBatchSize
+	}
+	skipped, offset := state.Loaded, state.Loaded
+	seen := 0
+	batch := make([]schema.Vulnerability, 0, batchSize)
+	flush := func(last bool) error {
+		if err := im.loader.LoadBatch(ctx, source, offset, batch, last); err != nil {
+			return fmt.Errorf("failed to load %s from record %d: %w", source.Name, offset, err)
+		}
+		offset += len(batch)
+		im.total += len(batch)
+		batch = batch[:0]
+		im.report(ImportProgress{Source: source.Name, Loaded: offset, Skipped: skipped, Done: last})
+		return nil
+	}
+
+	source.SyncedUntil, err = readRecords(f, func(record schema.Vulnerability) error {
+		seen++
+		if seen <= skipped {
+			return nil
+		}
+		batch = append(batch, record)
+		if len(batch) < batchSize {
+			return nil
+		}
+		return flush(false)
+	})
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to import %s: %w", path, err)
+	}
+	if seen < skipped {
+		return time.Time{}, fmt.Errorf("%s holds %d records, %d were already loaded from it", path, seen, skipped)
+	}
+	// The last batch also marks files with no records left as complete
+	if err := flush(true); err != nil {
+		return time.Time{}, err
+	}
+	return source.SyncedUntil, nil
+}
+
+// fileDigest returns the hex sha256 of the content of f and rewinds it.
+func fileDigest(f *os.File) (string, error) {
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return "", err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func (im *Importer) report(p ImportProgress) {
+	if im.Progress == nil {
+		return
+	}
+	p.Total = im.total
+	p.Elapsed = time.Since(im.start)
+	im.Progress(p)
+}
+
+// readRecords streams the elements of the vulnerabilities array of a JSON
+// document to fn, without holding the whole document in memory. It returns
+// the time the document is complete up to, zero when it has none.
+func readRecords(r io.Reader, fn func(schema.Vulnerability) error) (time.Time, error) {
+	br := bufio.NewReader(r)
+	if magic, err := br.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return time.Time{}, err
+		}
+		defer zr.Close()
+		r = zr
+	} else {
+		r = br
+	}
+
+	dec := json.NewDecoder(r)
+	if err := expectDelim(dec, '{'); err != nil {
+		return time.Time{}, err
+	}
+	var syncedUntil time.Time
+	found := false
+	for dec.More() {
+		token, err := dec.Token()
+		if err != nil {
+			return time.Time{}, err
+		}
+		switch token {
+		case "vulnerabilities":
+			if err := readArray(dec, fn); err != nil {
+				return time.Time{}, err
+			}
+			found = true
+		case "timestamp", "synced_until":
+			// The timestamp of NVD feeds and API responses, or the
+			// synced_until of snapshots
+			var value string
+			if err := dec.Decode(&value); err != nil {
+				return time.Time{}, fmt.Errorf("invalid %s: %w", token, err)
+			}
+			syncedUntil = parseSyncTime(value)
+		default:
+			var skip json.RawMessage
+			if err := dec.Decode(&skip); err != nil {
+				return time.Time{}, err
+			}
+		}
+	}
+	if !found {
+		return time.Time{}, errors.New("no vulnerabilities array")
+	}
+	return syncedUntil, nil
+}
+
+func readArray(dec *json.Decoder, fn func(schema.Vulnerability) error) error {
+	if err := expectDelim(dec, '['); err != nil {
+		return err
+	}
+	for dec.More() {
+		var record schema.Vulnerability
+		if err := dec.Decode(&record); err != nil {
+			return err
+		}
+		if err := fn(record); err != nil {
+			return err
+		}
+	}
+	return expectDelim(dec, ']')
+}
+
+// parseSyncTime parses the RFC 3339 times of snapshots and the NVD
+// timestamps, which are UTC without a zone and with up to 7 fractional
+// digits. It returns zero for the zero time of snapshots never synced and
+// for invalid times.
+func parseSyncTime(value string) time.Time {
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04:05.999999999"} {
+		if t, err := time.Parse(layout, value); err == nil && t.Year() > 1 {
+			return t.UTC()
+		}
+	}
+	return time.Time{}
+}
+
+func expectDelim(dec *json.Decoder, delim json.Delim) error {
+	token, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if token != delim {
+		return fmt.Errorf("expected %s, got %v", delim, token)
+	}
+	return nil
+}
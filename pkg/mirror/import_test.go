@@ -0,0 +1,194 @@
+package mirror
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kptm-tools/vulnerability-analysis/nvd/schema"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeImport struct {
+	digest      string
+	loaded      int
+	done        bool
+	syncedUntil time.Time
+}
+
+// fakeLoader loads records in memory, failing the batch at failAt once.
+type fakeLoader struct {
+	imports     map[string]*fakeImport
+	records     []string
+	batches     int
+	failAt      int
+	syncedUntil time.Time
+}
+
+func newFakeLoader() *fakeLoader {
+	return &fakeLoader{imports: make(map[string]*fakeImport), failAt: -1}
+}
+
+func (l *fakeLoader) Loaded(ctx context.Context, source ImportSource) (ImportState, error) {
+	imp, ok := l.imports[source.Name]
+	if !ok || imp.digest != source.Digest {
+		return ImportState{}, nil
+	}
+	return ImportState{Loaded: imp.loaded, Done: imp.done, SyncedUntil: imp.syncedUntil}, nil
+}
+
+func (l *fakeLoader) LoadBatch(ctx context.Context, source ImportSource, offset int, records []schema.Vulnerability, last bool) error {
+	if l.batches == l.failAt {
+		l.failAt = -1
+		return errors.New("connection reset")
+	}
+	l.batches++
+	for _, record := range records {
+		l.records = append(l.records, record.Cve.ID)
+	}
+	imp := &fakeImport{digest: source.Digest, loaded: offset + len(records), done: last}
+	if last {
+		imp.syncedUntil = source.SyncedUntil
+	}
+	l.imports[source.Name] = imp
+	return nil
+}
+
+func (l *fakeLoader) Commit(ctx context.Context, records []schema.Vulnerability, until time.Time) error {
+	if until.After(l.syncedUntil) {
+		l.syncedUntil = until
+	}
+	return nil
+}
+
+func importRecords(n int) []schema.Vulnerability {
+	records := make([]schema.Vulnerability, n)
+	for i := range records {
+		records[i] = record(fmt.Sprintf("CVE-2020-%04d", i), "2024-01-01T00:00:00.000")
+	}
+	return records
+}
+
+func TestImporter_Import(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	feed := filepath.Join(dir, "nvdcve-2.0-2020.json")
+	data, err := json.Marshal(schema.NvdAPIResponse{ResultsPerPage: 7, Vulnerabilities: importRecords(7)})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(feed, data, 0o644))
+
+	snapshot := filepath.Join(dir, "snapshot.json.gz")
+	var buf bytes.Buffer
+	require.NoError(t, WriteSnapshot(&buf, importRecords(2)))
+	require.NoError(t, os.WriteFile(snapshot, buf.Bytes(), 0o644))
+
+	loader := newFakeLoader()
+	loader.failAt = 2
+	var progress []ImportProgress
+	importer := NewImporter(loader)
+	importer.BatchSize = 3
+	importer.Progress = func(p ImportProgress) { progress = append(progress, p) }
+
+	loaded, err := importer.Import(context.Background(), feed, snapshot)
+	require.Error(t, err)
+	assert.Equal(t, 6, loaded)
+	assert.Equal(t, 6, loader.imports["nvdcve-2.0-2020.json"].loaded)
+	assert.False(t, loader.imports["nvdcve-2.0-2020.json"].done)
+
+	// The retry resumes after the last batch loaded
+	progress = nil
+	loaded, err = importer.Import(context.Background(), feed, snapshot)
+	require.NoError(t, err)
+	assert.Equal(t, 3, loaded)
+	assert.Len(t, loader.records, 9)
+	assert.Equal(t, "CVE-2020-0006", loader.records[6])
+	assert.Equal(t, 7, loader.imports["nvdcve-2.0-2020.json"].loaded)
+	assert.True(t, loader.imports["nvdcve-2.0-2020.json"].done)
+	assert.Equal(t, 2, loader.imports["snapshot.json.gz"].loaded)
+	assert.True(t, loader.imports["snapshot.json.gz"].done)
+	// The snapshot was never synced, so the sync time is unknown
+	assert.True(t, loader.syncedUntil.IsZero())
+	require.Len(t, progress, 2)
+	assert.Equal(t, ImportProgress{Source: "nvdcve-2.0-2020.json", Loaded: 7, Skipped: 6, Done: true, Total: 1}, withoutElapsed(progress[0]))
+
+	// Completed files are skipped
+	loaded, err = importer.Import(context.Background(), feed, snapshot)
+	require.NoError(t, err)
+	assert.Zero(t, loaded)
+	assert.Len(t, loader.records, 9)
+}
+
+func TestImporter_Import_SyncedUntil(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	writeFeed := func(name, timestamp string, records int) string {
+		path := filepath.Join(dir, name)
+		data, err := json.Marshal(schema.NvdAPIResponse{Timestamp: timestamp, Vulnerabilities: importRecords(records)})
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(path, data, 0o644))
+		return path
+	}
+	feed2020 := writeFeed("nvdcve-2.0-2020.json", "2024-06-01T03:00:05.000", 3)
+	feed2021 := writeFeed("nvdcve-2.0-2021.json", "2024-06-01T03:00:01.000", 2)
+
+	loader := newFakeLoader()
+	importer := NewImporter(loader)
+	loaded, err := importer.Import(context.Background(), feed2020, feed2021)
+	require.NoError(t, err)
+	assert.Equal(t, 5, loaded)
+	// The feeds are complete up to the oldest of their timestamps
+	assert.Equal(t, time.Date(2024, 6, 1, 3, 0, 1, 0, time.UTC), loader.syncedUntil)
+
+	// A feed republished under the same name is loaded again, the skipped
+	// ones keep the timestamp they were loaded with
+	feed2021 = writeFeed("nvdcve-2.0-2021.json", "2024-06-02T03:00:01.000", 4)
+	loaded, err = importer.Import(context.Background(), feed2020, feed2021)
+	require.NoError(t, err)
+	assert.Equal(t, 4, loaded)
+	assert.Len(t, loader.records, 9)
+	assert.Equal(t, 4, loader.imports["nvdcve-2.0-2021.json"].loaded)
+	assert.Equal(t, time.Date(2024, 6, 1, 3, 0, 5, 0, time.UTC), loader.syncedUntil)
+}
+
+func withoutElapsed(p ImportProgress) ImportProgress {
+	p.Elapsed = 0
+	return p
+}
+
+func Test_readRecords(t *testing.T) {
+	t.Parallel()
+	var ids []string
+	collect := func(record schema.Vulnerability) error {
+		ids = append(ids, record.Cve.ID)
+		return nil
+	}
+
+	data := `{"format":"NVD_CVE","vulnerabilities":[{"cve":{"id":"CVE-2020-0001"}},{"cve":{"id":"CVE-2020-0002"}}],"totalResults":2}`
+	synced, err := readRecords(bytes.NewReader([]byte(data)), collect)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"CVE-2020-0001", "CVE-2020-0002"}, ids)
+	assert.True(t, synced.IsZero())
+
+	// The timestamp of the NVD feeds has no zone and 7 fractional digits
+	data = `{"vulnerabilities":[],"timestamp":"2024-06-01T03:00:01.1234567"}`
+	synced, err = readRecords(bytes.NewReader([]byte(data)), collect)
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 6, 1, 3, 0, 1, 123456700, time.UTC), synced)
+
+	data = `{"synced_until":"2024-06-01T03:00:00+02:00","vulnerabilities":[]}`
+	synced, err = readRecords(bytes.NewReader([]byte(data)), collect)
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 6, 1, 1, 0, 0, 0, time.UTC), synced)
+
+	_, err = readRecords(bytes.NewReader([]byte(`{"totalResults":0}`)), collect)
+	assert.Error(t, err)
+	_, err = readRecords(bytes.NewReader([]byte(`[]`)), collect)
+	assert.Error(t, err)
+}
@@ -0,0 +1,232 @@
+package mirror
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/kptm-tools/vulnerability-analysis/nvd/schema"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/failure"
+)
+
+// A persistent mirror directory holds a compacted snapshot and a journal of
+// the deltas synced since, one JSON line per sync.
+const (
+	snapshotFile = "snapshot.json.gz"
+	journalFile  = "journal.jsonl"
+)
+
+// Stats describes the content of a mirror.
+type Stats struct {
+	Records        int       `json:"records"`
+	Products       int       `json:"products"`
+	SyncedUntil    time.Time `json:"synced_until"`
+	JournalEntries int       `json:"journal_entries"`
+	JournalBytes   int64     `json:"journal_bytes"`
+	SnapshotBytes  int64     `json:"snapshot_bytes"`
+}
+
+// Open loads the mirror persisted in dir, creating the directory when it
+// doesn't exist. Syncs committed to the returned store are journaled there.
+func Open(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create mirror directory: %w", err)
+	}
+
+	s := NewStore()
+	s.dir = dir
+
+	f, err := os.Open(filepath.Join(dir, snapshotFile))
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+	case err != nil:
+		return nil, fmt.Errorf("failed to open mirror snapshot: %w", err)
+	default:
+		snapshot, err := ReadSnapshot(f)
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+		s.Put(snapshot.Vulnerabilities...)
+		s.syncedUntil = snapshot.SyncedUntil
+	}
+
+	if err := s.replayJournal(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *Store) replayJournal() error {
+	path := filepath.Join(s.dir, journalFile)
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open mirror journal: %w", err)
+	}
+	defer f.Close()
+
+	reader := bufio.NewReader(f)
+	var offset int64
+	for line := 1; ; line++ {
+		data, err := reader.ReadBytes('\n')
+		if len(bytes.TrimSpace(data)) > 0 {
+			// A torn last line is left by a crash during a sync, whose delta
+			// is fetched again by the next one. It is cut off so that the
+			// next entry isn't appended to it
+			if err != nil {
+				if err := os.Truncate(path, offset); err != nil {
+					return &failure.StorageError{Err: fmt.Errorf("failed to truncate torn mirror journal line %d: %w", line, err)}
+				}
+				return nil
+			}
+			var delta Delta
+			if err := json.Unmarshal(data, &delta); err != nil {
+				return fmt.Errorf("corrupt mirror journal at line %d: %w", line, err)
+			}
+			s.Put(delta.Vulnerabilities...)
+			s.setSyncedUntil(delta.SyncedUntil)
+			s.journalEntries++
+		}
+		offset += int64(len(data))
+		if err != nil {
+			return nil
+		}
+	}
+}
+
+// Commit applies a synced delta. For persistent stores the delta is
+// journaled, or written to Postgres, before it is applied.
+func (s *Store) Commit(records []schema.Vulnerability, until time.Time) error {
+	if s.pg != nil {
+		if err := s.pg.Commit(context.Background(), records, until); err != nil {
+			return err
+		}
+	}
+	if s.dir != "" {
+		data, err := json.Marshal(Delta{SyncedUntil: until, Vulnerabilities: records})
+		if err != nil {
+			return fmt.Errorf("failed to encode mirror journal entry: %w", err)
+		}
+		if err := appendFile(filepath.Join(s.dir, journalFile), append(data, '\n')); err != nil {
+			return &failure.StorageError{Err: fmt.Errorf("failed to write mirror journal: %w", err)}
+		}
+		s.mu.Lock()
+		s.journalEntries++
+		s.mu.Unlock()
+	}
+
+	s.Put(records...)
+	s.setSyncedUntil(until)
+	return nil
+}
+
+func appendFile(path string, data []byte) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Compact folds the journal into a new snapshot, so the mirror loads from a
+// single file and superseded record versions are dropped.
+func (s *Store) Compact() error {
+	if s.dir == "" {
+		return errors.New("mirror is not persistent")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	records := make([]schema.Vulnerability, 0, len(s.records))
+	for _, record := range s.records {
+		records = append(records, record)
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].Cve.ID < records[j].Cve.ID })
+
+	// Write to a temporary file first so a crash keeps the previous snapshot
+	tmp := filepath.Join(s.dir, snapshotFile+".tmp")
+	f, err := os.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("failed to create mirror snapshot: %w", err)
+	}
+	snapshot := Snapshot{GeneratedAt: time.Now().UTC(), SyncedUntil: s.syncedUntil, Vulnerabilities: records}
+	if err := writeGzipJSON(f, snapshot); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write mirror snapshot: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to write mirror snapshot: %w", err)
+	}
+	if err := os.Rename(tmp, filepath.Join(s.dir, snapshotFile)); err != nil {
+		return fmt.Errorf("failed to replace mirror snapshot: %w", err)
+	}
+
+	if err := os.Remove(filepath.Join(s.dir, journalFile)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to truncate mirror journal: %w", err)
+	}
+	s.journalEntries = 0
+	return nil
+}
+
+// Stats returns the record counts and file sizes of the mirror.
+func (s *Store) Stats() Stats {
+	s.mu.RLock()
+	stats := Stats{
+		Records:        len(s.records),
+		Products:       len(s.byProduct),
+		SyncedUntil:    s.syncedUntil,
+		JournalEntries: s.journalEntries,
+	}
+	s.mu.RUnlock()
+
+	if s.dir != "" {
+		if info, err := os.Stat(filepath.Join(s.dir, journalFile)); err == nil {
+			stats.JournalBytes = info.Size()
+		}
+		if info, err := os.Stat(filepath.Join(s.dir, snapshotFile)); err == nil {
+			stats.SnapshotBytes = info.Size()
+		}
+	}
+	return stats
+}
+
+// Digest hashes the ID and last modification of every record, so two
+// mirrors holding the same record versions have the same digest.
+func (s *Store) Digest() string {
+	s.mu.RLock()
+	ids := make([]string, 0, len(s.records))
+	for id := range s.records {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	h := sha256.New()
+	for _, id := range ids {
+		fmt.Fprintf(h, "%s %s\n", id, s.records[id].Cve.LastModified)
+	}
+	s.mu.RUnlock()
+
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,80 @@
+package mirror
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kptm-tools/vulnerability-analysis/nvd/schema"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpen_JournalAndCompact(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	until := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	store, err := Open(dir)
+	require.NoError(t, err)
+	require.NoError(t, store.Commit([]schema.Vulnerability{record("CVE-2024-0001", "2024-01-01T00:00:00.000")}, until.Add(-time.Hour)))
+	require.NoError(t, store.Commit([]schema.Vulnerability{
+		record("CVE-2024-0001", "2024-02-01T00:00:00.000"),
+		record("CVE-2024-0002", "2024-02-01T00:00:00.000"),
+	}, until))
+	assert.Equal(t, 2, store.Stats().JournalEntries)
+
+	// Reopening replays the journal
+	reopened, err := Open(dir)
+	require.NoError(t, err)
+	assert.Equal(t, 2, reopened.Len())
+	assert.Equal(t, until, reopened.SyncedUntil())
+	assert.Equal(t, store.Digest(), reopened.Digest())
+
+	require.NoError(t, reopened.Compact())
+	stats := reopened.Stats()
+	assert.Zero(t, stats.JournalEntries)
+	assert.Zero(t, stats.JournalBytes)
+	assert.Positive(t, stats.SnapshotBytes)
+
+	// Reopening after compaction loads the snapshot
+	compacted, err := Open(dir)
+	require.NoError(t, err)
+	assert.Equal(t, until, compacted.SyncedUntil())
+	assert.Equal(t, store.Digest(), compacted.Digest())
+
+	resp, err := compacted.LookupCVE("CVE-2024-0001")
+	require.NoError(t, err)
+	assert.Equal(t, "2024-02-01T00:00:00.000", resp.Vulnerabilities[0].Cve.LastModified)
+}
+
+func TestOpen_TornJournalLine(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	store, err := Open(dir)
+	require.NoError(t, err)
+	require.NoError(t, store.Commit([]schema.Vulnerability{record("CVE-2024-0001", "2024-01-01T00:00:00.000")}, time.Now().UTC()))
+
+	f, err := os.OpenFile(filepath.Join(dir, journalFile), os.O_APPEND|os.O_WRONLY, 0o644)
+	require.NoError(t, err)
+	_, err = f.WriteString(`{"synced_until":"2024-`)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	reopened, err := Open(dir)
+	require.NoError(t, err)
+	assert.Equal(t, 1, reopened.Len())
+
+	// The next sync is journaled on a line of its own
+	require.NoError(t, reopened.Commit([]schema.Vulnerability{record("CVE-2024-0002", "2024-01-02T00:00:00.000")}, time.Now().UTC()))
+	reopened, err = Open(dir)
+	require.NoError(t, err)
+	assert.Equal(t, 2, reopened.Len())
+	assert.Equal(t, 2, reopened.Stats().JournalEntries)
+}
+
+func TestCompact_NotPersistent(t *testing.T) {
+	t.Parallel()
+	assert.Error(t, NewStore().Compact())
+}
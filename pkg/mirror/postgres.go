@@ -0,0 +1,244 @@
+package mirror
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/kptm-tools/vulnerability-analysis/nvd/schema"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/failure"
+	"github.com/lib/pq"
+)
+
+// The records of a Postgres mirror, the time up to which they are synced,
+// and how far each bulk import got. Mirrors created by earlier versions
+// store last_modified without a zone, as UTC, and have no import digests.
+const createMirrorTables = `
+CREATE TABLE IF NOT EXISTS mirror_cves (
+	id            TEXT PRIMARY KEY,
+	last_modified TIMESTAMPTZ NOT NULL,
+	record        JSONB NOT NULL
+);
+CREATE TABLE IF NOT EXISTS mirror_state (
+	singleton    BOOLEAN PRIMARY KEY DEFAULT TRUE CHECK (singleton),
+	synced_until TIMESTAMPTZ NOT NULL
+);
+CREATE TABLE IF NOT EXISTS mirror_imports (
+	source       TEXT PRIMARY KEY,
+	loaded       INTEGER NOT NULL,
+	completed_at TIMESTAMPTZ
+);
+ALTER TABLE mirror_imports ADD COLUMN IF NOT EXISTS digest TEXT NOT NULL DEFAULT '';
+ALTER TABLE mirror_imports ADD COLUMN IF NOT EXISTS synced_until TIMESTAMPTZ;
+DO $$
+BEGIN
+	IF EXISTS (SELECT 1 FROM information_schema.columns
+	           WHERE table_schema = current_schema() AND table_name = 'mirror_cves'
+	             AND column_name = 'last_modified' AND data_type = 'timestamp without time zone') THEN
+		ALTER TABLE mirror_cves ALTER COLUMN last_modified TYPE TIMESTAMPTZ USING last_modified AT TIME ZONE 'UTC';
+	END IF;
+END
+$$`
+
+// upsertMirrorCVEs moves the staged records into mirror_cves, keeping the
+// stored ones more recent, like Store.Put.
+const upsertMirrorCVEs = `
+INSERT INTO mirror_cves (id, last_modified, record)
+SELECT DISTINCT ON (id) id, last_modified, record::jsonb FROM mirror_staging
+ORDER BY id, last_modified DESC
+ON CONFLICT (id) DO UPDATE SET last_modified = EXCLUDED.last_modified, record = EXCLUDED.record
+WHERE mirror_cves.last_modified <= EXCLUDED.last_modified`
+
+// PostgresBackend persists a mirror in Postgres, for deployments sharing a
+// database rather than a mirror directory.
+type PostgresBackend struct {
+	db *sql.DB
+}
+
+// NewPostgresBackend connects to the database of dsn and creates the mirror
+// tables when missing.
+func NewPostgresBackend(ctx context.Context, dsn string) (*PostgresBackend, error) {
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open postgres: %w", err)
+	}
+	if _, err := db.ExecContext(ctx, createMirrorTables); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create mirror tables: %w", err)
+	}
+	return &PostgresBackend{db: db}, nil
+}
+
+// OpenPostgres loads the mirror persisted in the database of dsn. Syncs
+// committed to the returned store are written there.
+func OpenPostgres(ctx context.Context, dsn string) (*Store, error) {
+	backend, err := NewPostgresBackend(ctx, dsn)
+	if err != nil {
+		return nil, err
+	}
+	s, err := backend.load(ctx)
+	if err != nil {
+		backend.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (b *PostgresBackend) load(ctx context.Context) (*Store, error) {
+	s := NewStore()
+	s.pg = b
+	rows, err := b.db.QueryContext(ctx, `SELECT record FROM mirror_cves`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to select mirror records: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var data []byte
+		if err := rows.Scan(&data); err != nil {
+			return nil, fmt.Errorf("failed to scan mirror record: %w", err)
+		}
+		var record schema.Vulnerability
+		if err := json.Unmarshal(data, &record); err != nil {
+			return nil, fmt.Errorf("corrupt mirror record: %w", err)
+		}
+		s.Put(record)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read mirror records: %w", err)
+	}
+
+	var syncedUntil time.Time
+	err = b.db.QueryRowContext(ctx, `SELECT synced_until FROM mirror_state`).Scan(&syncedUntil)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+	case err != nil:
+		return nil, fmt.Errorf("failed to select mirror state: %w", err)
+	default:
+		s.syncedUntil = syncedUntil.UTC()
+	}
+	return s, nil
+}
+
+// Commit writes a synced delta and the time it is complete up to.
+func (b *PostgresBackend) Commit(ctx context.Context, records []schema.Vulnerability, until time.Time) error {
+	return b.inTx(ctx, func(tx *sql.Tx) error {
+		if err := upsertRecords(ctx, tx, records); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx,
+			`INSERT INTO mirror_state (singleton, synced_until) VALUES (TRUE, $1)
+			 ON CONFLICT (singleton) DO UPDATE SET synced_until = GREATEST(mirror_state.synced_until, EXCLUDED.synced_until)`,
+			until.UTC())
+		return err
+	})
+}
+
+// Loaded returns how far previous imports of source got. The progress of
+// an import of another content of the file is ignored, and overwritten by
+// the next batch loaded.
+func (b *PostgresBackend) Loaded(ctx context.Context, source ImportSource) (ImportState, error) {
+	var state ImportState
+	var completedAt, syncedUntil sql.NullTime
+	err := b.db.QueryRowContext(ctx,
+		`SELECT loaded, completed_at, synced_until FROM mirror_imports WHERE source = $1 AND digest = $2`,
+		source.Name, source.Digest).Scan(&state.Loaded, &completedAt, &syncedUntil)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ImportState{}, nil
+	}
+	if err != nil {
+		return ImportState{}, fmt.Errorf("failed to select import progress of %s: %w", source.Name, err)
+	}
+	state.Done = completedAt.Valid
+	if syncedUntil.Valid {
+		state.SyncedUntil = syncedUntil.Time.UTC()
+	}
+	return state, nil
+}
+
+// LoadBatch upserts the records of source from offset on, and records the
+// progress of the import in the same transaction, so that an interrupted
+// import resumes after the last batch it loaded.
+func (b *PostgresBackend) LoadBatch(ctx context.Context, source ImportSource, offset int, records []schema.Vulnerability, last bool) error {
+	return b.inTx(ctx, func(tx *sql.Tx) error {
+		if err := upsertRecords(ctx, tx, records); err != nil {
+			return err
+		}
+		var completedAt, syncedUntil any
+		if last {
+			completedAt = time.Now().UTC()
+			if !source.SyncedUntil.IsZero() {
+				syncedUntil = source.SyncedUntil.UTC()
+			}
+		}
+		_, err := tx.ExecContext(ctx,
+			`INSERT INTO mirror_imports (source, digest, loaded, completed_at, synced_until) VALUES ($1, $2, $3, $4, $5)
+			 ON CONFLICT (source) DO UPDATE SET digest = EXCLUDED.digest, loaded = EXCLUDED.loaded,
+				completed_at = EXCLUDED.completed_at, synced_until = EXCLUDED.synced_until`,
+			source.Name, source.Digest, offset+len(records), completedAt, syncedUntil)
+		return err
+	})
+}
+
+func (b *PostgresBackend) Close() error {
+	return b.db.Close()
+}
+
+func (b *PostgresBackend) inTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := b.db.BeginTx(ctx, nil)
+	if err != nil {
+		return &failure.StorageError{Err: fmt.Errorf("failed to begin mirror transaction: %w", err)}
+	}
+	if err := fn(tx); err != nil {
+		_ = tx.Rollback()
+		return &failure.StorageError{Err: fmt.Errorf("failed to write mirror records: %w", err)}
+	}
+	if err := tx.Commit(); err != nil {
+		return &failure.StorageError{Err: fmt.Errorf("failed to commit mirror transaction: %w", err)}
+	}
+	return nil
+}
+
+// upsertRecords copies records into a staging table dropped on commit, then
+// upserts them in a single statement, which is much faster than inserting
+// them one by one.
+func upsertRecords(ctx context.Context, tx *sql.Tx, records []schema.Vulnerability) error {
+	if len(records) == 0 {
+		return nil
+	}
+	if _, err := tx.ExecContext(ctx,
+		`CREATE TEMP TABLE mirror_staging (id TEXT, last_modified TIMESTAMPTZ, record TEXT) ON COMMIT DROP`); err != nil {
+		return fmt.Errorf("failed to create staging table: %w", err)
+	}
+
+	stmt, err := tx.PrepareContext(ctx, pq.CopyIn("mirror_staging", "id", "last_modified", "record"))
+	if err != nil {
+		return fmt.Errorf("failed to start copy: %w", err)
+	}
+	for _, record := range records {
+		data, err := json.Marshal(record)
+		if err != nil {
+			stmt.Close()
+			return fmt.Errorf("failed to encode %s: %w", record.Cve.ID, err)
+		}
+		if _, err := stmt.ExecContext(ctx, strings.ToUpper(record.Cve.ID), lastModified(record), string(data)); err != nil {
+			stmt.Close()
+			return fmt.Errorf("failed to copy %s: %w", record.Cve.ID, err)
+		}
+	}
+	if _, err := stmt.ExecContext(ctx); err != nil {
+		stmt.Close()
+		return fmt.Errorf("failed to flush copy: %w", err)
+	}
+	if err := stmt.Close(); err != nil {
+		return fmt.Errorf("failed to end copy: %w", err)
+	}
+
+	if _, err := tx.ExecContext(ctx, upsertMirrorCVEs); err != nil {
+		return fmt.Errorf("failed to upsert staged records: %w", err)
+	}
+	return nil
+}
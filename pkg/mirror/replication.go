@@ -0,0 +1,163 @@
+package mirror
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/kptm-tools/vulnerability-analysis/nvd/schema"
+)
+
+// Routes of the replication API.
+const (
+	DeltaPath = "/mirror/v1/delta"
+	MetaPath  = "/mirror/v1/meta"
+)
+
+const replicationTokenHeader = "X-Mirror-Token"
+
+// Delta is a replication response: the records modified since the requested
+// time, complete up to SyncedUntil.
+type Delta struct {
+	SyncedUntil     time.Time              `json:"synced_until"`
+	Vulnerabilities []schema.Vulnerability `json:"vulnerabilities"`
+}
+
+// Meta summarizes a mirror so replicas can verify they hold the same
+// records as their primary.
+type Meta struct {
+	Records     int       `json:"records"`
+	SyncedUntil time.Time `json:"synced_until"`
+	Digest      string    `json:"digest"`
+}
+
+// Meta returns the record count, sync time and digest of the store.
+func (s *Store) Meta() Meta {
+	return Meta{Records: s.Len(), SyncedUntil: s.SyncedUntil(), Digest: s.Digest()}
+}
+
+// NewReplicationHandler serves delta snapshots of store to regional
+// replicas. When token is set, replicas must send it in X-Mirror-Token.
+func NewReplicationHandler(store *Store, token string) http.Handler {
+	authorized := func(w http.ResponseWriter, r *http.Request) bool {
+		if token != "" && subtle.ConstantTimeCompare([]byte(r.Header.Get(replicationTokenHeader)), []byte(token)) != 1 {
+			http.Error(w, "invalid mirror token", http.StatusUnauthorized)
+			return false
+		}
+		return true
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET "+MetaPath, func(w http.ResponseWriter, r *http.Request) {
+		if !authorized(w, r) {
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(store.Meta())
+	})
+	mux.HandleFunc("GET "+DeltaPath, func(w http.ResponseWriter, r *http.Request) {
+		if !authorized(w, r) {
+			return
+		}
+
+		var since time.Time
+		if raw := r.URL.Query().Get("since"); raw != "" {
+			var err error
+			if since, err = time.Parse(time.RFC3339Nano, raw); err != nil {
+				http.Error(w, "invalid since parameter", http.StatusBadRequest)
+				return
+			}
+		}
+
+		// Read the sync time first, so the delta is never older than it claims
+		delta := Delta{SyncedUntil: store.SyncedUntil()}
+		delta.Vulnerabilities = store.ModifiedSince(since)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Encoding", "gzip")
+		// Once headers are sent, a failed write shows as a truncated body
+		_ = writeGzipJSON(w, delta)
+	})
+	return mux
+}
+
+// ReplicaUpstream syncs a regional replica from a primary mirror.
+type ReplicaUpstream struct {
+	primaryURL string
+	token      string
+	client     *http.Client
+}
+
+var _ Upstream = (*ReplicaUpstream)(nil)
+
+func NewReplicaUpstream(primaryURL, token string) *ReplicaUpstream {
+	return &ReplicaUpstream{
+		primaryURL: primaryURL,
+		token:      token,
+		client:     &http.Client{Timeout: 5 * time.Minute},
+	}
+}
+
+// FetchMeta returns the metadata of the primary mirror.
+func (u *ReplicaUpstream) FetchMeta(ctx context.Context) (Meta, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.primaryURL+MetaPath, nil)
+	if err != nil {
+		return Meta{}, fmt.Errorf("failed to create meta request: %w", err)
+	}
+	if u.token != "" {
+		req.Header.Set(replicationTokenHeader, u.token)
+	}
+
+	resp, err := u.client.Do(req)
+	if err != nil {
+		return Meta{}, fmt.Errorf("failed meta request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return Meta{}, fmt.Errorf("unexpected meta response status: %s", resp.Status)
+	}
+
+	var meta Meta
+	if err := json.NewDecoder(resp.Body).Decode(&meta); err != nil {
+		return Meta{}, fmt.Errorf("failed to decode meta: %w", err)
+	}
+	return meta, nil
+}
+
+func (u *ReplicaUpstream) FetchModified(ctx context.Context, since time.Time) ([]schema.Vulnerability, time.Time, error) {
+	query := url.Values{}
+	if !since.IsZero() {
+		query.Set("since", since.UTC().Format(time.RFC3339Nano))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.primaryURL+DeltaPath+"?"+query.Encode(), nil)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("failed to create delta request: %w", err)
+	}
+	if u.token != "" {
+		req.Header.Set(replicationTokenHeader, u.token)
+	}
+	// Set explicitly so the transport doesn't decompress the body itself
+	req.Header.Set("Accept-Encoding", "gzip")
+
+	resp, err := u.client.Do(req)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("failed delta request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, time.Time{}, fmt.Errorf("unexpected delta response status: %s", resp.Status)
+	}
+
+	var delta Delta
+	if err := readGzipJSON(resp.Body, &delta); err != nil {
+		return nil, time.Time{}, fmt.Errorf("failed to decode delta: %w", err)
+	}
+	return delta.Vulnerabilities, delta.SyncedUntil, nil
+}
@@ -0,0 +1,94 @@
+package mirror
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/kptm-tools/vulnerability-analysis/nvd/schema"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReplication_ReplicaSyncsDeltas(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	primary := NewStore()
+	primary.Put(
+		record("CVE-2024-0001", "2024-01-10T00:00:00.000"),
+		record("CVE-2024-0002", "2024-02-10T00:00:00.000"),
+	)
+	primary.setSyncedUntil(time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC))
+
+	server := httptest.NewServer(NewReplicationHandler(primary, "secret"))
+	defer server.Close()
+
+	replica := NewStore()
+	syncer := NewSyncer(replica, NewReplicaUpstream(server.URL, "secret"), time.Hour, time.Time{})
+
+	synced, err := syncer.SyncOnce(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, synced)
+	assert.Equal(t, 2, replica.Len())
+	assert.Equal(t, primary.SyncedUntil(), replica.SyncedUntil())
+
+	// Only records modified since the last sync are sent again
+	primary.Put(record("CVE-2024-0003", "2024-03-05T00:00:00.000"))
+	primary.setSyncedUntil(time.Date(2024, 3, 10, 0, 0, 0, 0, time.UTC))
+
+	synced, err = syncer.SyncOnce(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, synced)
+	assert.Equal(t, 3, replica.Len())
+}
+
+func TestReplication_InvalidToken(t *testing.T) {
+	t.Parallel()
+	server := httptest.NewServer(NewReplicationHandler(NewStore(), "secret"))
+	defer server.Close()
+
+	_, _, err := NewReplicaUpstream(server.URL, "wrong").FetchModified(context.Background(), time.Time{})
+	assert.ErrorContains(t, err, "401")
+}
+
+func TestSyncer_NVDUpstream(t *testing.T) {
+	t.Parallel()
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	var starts []time.Time
+	upstream := NewNVDUpstream(func(ctx context.Context, start, end time.Time) (*schema.NvdAPIResponse, error) {
+		starts = append(starts, start)
+		return &schema.NvdAPIResponse{Vulnerabilities: []schema.Vulnerability{record("CVE-2024-0001", "2024-01-10T00:00:00.000")}}, nil
+	})
+
+	store := NewStore()
+	syncer := NewSyncer(store, upstream, time.Hour, from)
+	_, err := syncer.SyncOnce(context.Background())
+	require.NoError(t, err)
+	firstSync := store.SyncedUntil()
+	_, err = syncer.SyncOnce(context.Background())
+	require.NoError(t, err)
+
+	require.Len(t, starts, 2)
+	assert.Equal(t, from, starts[0])
+	assert.Equal(t, firstSync, starts[1])
+	assert.Equal(t, 1, store.Len())
+}
+
+func TestSyncer_RunWithoutInterval(t *testing.T) {
+	t.Parallel()
+	var syncs int
+	upstream := NewNVDUpstream(func(ctx context.Context, start, end time.Time) (*schema.NvdAPIResponse, error) {
+		syncs++
+		return &schema.NvdAPIResponse{Vulnerabilities: []schema.Vulnerability{record("CVE-2024-0001", "2024-01-10T00:00:00.000")}}, nil
+	})
+
+	for _, interval := range []time.Duration{0, -time.Hour} {
+		syncs = 0
+		store := NewStore()
+		// Run returns once synced rather than waiting for ctx
+		NewSyncer(store, upstream, interval, time.Time{}).Run(context.Background())
+		assert.Equal(t, 1, syncs, "Expected interval %s to sync once", interval)
+		assert.Equal(t, 1, store.Len())
+	}
+}
@@ -0,0 +1,70 @@
+package mirror
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/kptm-tools/vulnerability-analysis/nvd/schema"
+)
+
+// Snapshot is the serialized form of a set of CVE records, used for the
+// embedded seed and for snapshot files.
+type Snapshot struct {
+	GeneratedAt     time.Time              `json:"generated_at"`
+	SyncedUntil     time.Time              `json:"synced_until"`
+	Vulnerabilities []schema.Vulnerability `json:"vulnerabilities"`
+}
+
+// WriteSnapshot writes records as a gzip compressed snapshot.
+func WriteSnapshot(w io.Writer, records []schema.Vulnerability) error {
+	snapshot := Snapshot{GeneratedAt: time.Now().UTC(), Vulnerabilities: records}
+	if err := writeGzipJSON(w, snapshot); err != nil {
+		return fmt.Errorf("failed to write snapshot: %w", err)
+	}
+	return nil
+}
+
+// ReadSnapshot reads a gzip compressed snapshot.
+func ReadSnapshot(r io.Reader) (*Snapshot, error) {
+	var snapshot Snapshot
+	if err := readGzipJSON(r, &snapshot); err != nil {
+		return nil, fmt.Errorf("failed to read snapshot: %w", err)
+	}
+	return &snapshot, nil
+}
+
+func writeGzipJSON(w io.Writer, v any) error {
+	zw := gzip.NewWriter(w)
+	if err := json.NewEncoder(zw).Encode(v); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+func readGzipJSON(r io.Reader, v any) error {
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+	return json.NewDecoder(zr).Decode(v)
+}
+
+// Seed loads the embedded snapshot into the store and returns the number of
+// records it holds. Binaries built with the noseed tag embed no snapshot.
+func (s *Store) Seed() (int, error) {
+	if len(seedSnapshot) == 0 {
+		return 0, nil
+	}
+
+	snapshot, err := ReadSnapshot(bytes.NewReader(seedSnapshot))
+	if err != nil {
+		return 0, fmt.Errorf("failed to load embedded seed: %w", err)
+	}
+	s.Put(snapshot.Vulnerabilities...)
+	return len(snapshot.Vulnerabilities), nil
+}
@@ -0,0 +1,15 @@
+//go:build !noseed
+
+package mirror
+
+import _ "embed"
+
+// seedSnapshot holds CVEs likely to be matched, so a fresh deployment can
+// enrich findings before the mirror is synced: the known exploited CVEs of
+// the CISA KEV catalog, most recently added first, then the most matched
+// CVEs, up to 5000. The bundled snapshot was built offline from the NVD
+// records at hand and only holds their 44 known exploited CVEs; regenerate
+// it against the NVD API with `vulncli seed -ids <most matched CVEs>`.
+//
+//go:embed seed/cves.json.gz
+var seedSnapshot []byte
@@ -0,0 +1,5 @@
+//go:build noseed
+
+package mirror
+
+var seedSnapshot []byte
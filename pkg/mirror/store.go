@@ -0,0 +1,242 @@
+// Package mirror keeps a local copy of NVD CVE records so findings can be
+// enriched without a round trip to the NVD API.
+package mirror
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kptm-tools/vulnerability-analysis/nvd/cpe"
+	"github.com/kptm-tools/vulnerability-analysis/nvd/schema"
+)
+
+var ErrNotFound = errors.New("CVE not found in mirror")
+
+// nvdTimestampFormat is the format of the timestamps in NVD records.
+const nvdTimestampFormat = "2006-01-02T15:04:05.000"
+
+// Store is an in-memory CVE store indexed by CVE ID and by the vendor and
+// product of the CPE match criteria of each record.
+type Store struct {
+	mu        sync.RWMutex
+	records   map[string]schema.Vulnerability
+	byProduct map[string]map[string]struct{}
+
+	// syncedUntil is the time up to which the store holds every upstream
+	// modification. It is zero until the first sync completes.
+	syncedUntil time.Time
+
+	// dir is the directory of persistent stores, see Open.
+	dir            string
+	journalEntries int
+
+	// pg is the database of the stores persisted in Postgres, see
+	// OpenPostgres.
+	pg *PostgresBackend
+}
+
+func NewStore() *Store {
+	return &Store{
+		records:   make(map[string]schema.Vulnerability),
+		byProduct: make(map[string]map[string]struct{}),
+	}
+}
+
+// Put adds or replaces records. A record replaces a stored one only when it
+// is at least as recent, so older snapshots never overwrite synced data.
+func (s *Store) Put(records ...schema.Vulnerability) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, record := range records {
+		id := strings.ToUpper(record.Cve.ID)
+		if existing, ok := s.records[id]; ok && existing.Cve.LastModified > record.Cve.LastModified {
+			continue
+		}
+		s.records[id] = record
+
+		for _, match := range cpeMatches(record) {
+			key := productKey(match.Criteria)
+			if key == "" {
+				continue
+			}
+			if s.byProduct[key] == nil {
+				s.byProduct[key] = make(map[string]struct{})
+			}
+			s.byProduct[key][id] = struct{}{}
+		}
+	}
+}
+
+// Len returns the number of stored records.
+func (s *Store) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.records)
+}
+
+// SyncedUntil returns the time up to which the store is in sync upstream.
+func (s *Store) SyncedUntil() time.Time {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.syncedUntil
+}
+
+func (s *Store) setSyncedUntil(t time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if t.After(s.syncedUntil) {
+		s.syncedUntil = t
+	}
+}
+
+// ModifiedSince returns the records last modified at or after since, oldest
+// first.
+func (s *Store) ModifiedSince(since time.Time) []schema.Vulnerability {
+	s.mu.RLock()
+	var vulns []schema.Vulnerability
+	for _, record := range s.records {
+		if !lastModified(record).Before(since) {
+			vulns = append(vulns, record)
+		}
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(vulns, func(i, j int) bool {
+		if vulns[i].Cve.LastModified != vulns[j].Cve.LastModified {
+			return vulns[i].Cve.LastModified < vulns[j].Cve.LastModified
+		}
+		return vulns[i].Cve.ID < vulns[j].Cve.ID
+	})
+	return vulns
+}
+
+// LookupCVE returns the record of a CVE in the NVD API response format.
+func (s *Store) LookupCVE(id string) (*schema.NvdAPIResponse, error) {
+	s.mu.RLock()
+	record, ok := s.records[strings.ToUpper(id)]
+	s.mu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	return newResponse([]schema.Vulnerability{record}), nil
+}
+
+// LookupCPE returns the records with a vulnerable CPE match for cpe, like
+// the cpeName query of the NVD API.
+func (s *Store) LookupCPE(cpe string) (*schema.NvdAPIResponse, error) {
+	key := productKey(cpe)
+	if key == "" {
+		return nil, fmt.Errorf("invalid CPE name: %s", cpe)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var vulns []schema.Vulnerability
+	for id := range s.byProduct[key] {
+		record := s.records[id]
+		for _, match := range cpeMatches(record) {
+			if match.Vulnerable && matchesCPE(match, cpe) {
+				vulns = append(vulns, record)
+				break
+			}
+		}
+	}
+	sort.Slice(vulns, func(i, j int) bool { return vulns[i].Cve.ID < vulns[j].Cve.ID })
+
+	return newResponse(vulns), nil
+}
+
+func newResponse(vulns []schema.Vulnerability) *schema.NvdAPIResponse {
+	return &schema.NvdAPIResponse{
+		ResultsPerPage:  len(vulns),
+		TotalResults:    len(vulns),
+		Format:          "NVD_CVE",
+		Version:         "2.0",
+		Timestamp:       time.Now().UTC().Format(nvdTimestampFormat),
+		Vulnerabilities: vulns,
+	}
+}
+
+// lastModified parses the NVD lastModified timestamp of a record, which is
+// in UTC without a zone. Unparseable timestamps are the zero time.
+func lastModified(record schema.Vulnerability) time.Time {
+	t, _ := time.Parse(nvdTimestampFormat, record.Cve.LastModified)
+	return t
+}
+
+func cpeMatches(record schema.Vulnerability) []schema.CpeMatch {
+	var matches []schema.CpeMatch
+	for _, config := range record.Cve.Configurations {
+		for _, node := range config.Nodes {
+			if node.Negate {
+				continue
+			}
+			matches = append(matches, node.CpeMatch...)
+		}
+	}
+	return matches
+}
+
+// productKey returns the part:vendor:product of a CPE 2.3 name.
+func productKey(cpe string) string {
+	parts := strings.Split(strings.ToLower(cpe), ":")
+	if len(parts) < 5 || parts[0] != "cpe" {
+		return ""
+	}
+	return strings.Join(parts[2:5], ":")
+}
+
+// matchesCPE reports whether the match criteria cover cpe. The criteria
+// version and update are compared as wildcards or exact values, and the
+// version ranges are checked when the criteria version is a wildcard.
+func matchesCPE(match schema.CpeMatch, cpe string) bool {
+	criteria := strings.Split(strings.ToLower(match.Criteria), ":")
+	name := strings.Split(strings.ToLower(cpe), ":")
+	if len(criteria) < 7 || len(name) < 7 {
+		return false
+	}
+
+	// part, vendor, product and update
+	for _, i := range []int{2, 3, 4, 6} {
+		if criteria[i] != "*" && criteria[i] != name[i] {
+			return false
+		}
+	}
+
+	if criteria[5] != "*" && criteria[5] != "-" {
+		return criteria[5] == name[5]
+	}
+	return inVersionRange(match, name[5])
+}
+
+func inVersionRange(match schema.CpeMatch, version string) bool {
+	bounded := match.VersionStartIncluding != nil || match.VersionStartExcluding != nil ||
+		match.VersionEndIncluding != nil || match.VersionEndExcluding != nil
+	if !bounded {
+		return true
+	}
+	if version == "*" || version == "-" || version == "" {
+		return false
+	}
+
+	if v := match.VersionStartIncluding; v != nil && cpe.CompareVersions(version, *v) < 0 {
+		return false
+	}
+	if v := match.VersionStartExcluding; v != nil && cpe.CompareVersions(version, *v) <= 0 {
+		return false
+	}
+	if v := match.VersionEndIncluding; v != nil && cpe.CompareVersions(version, *v) > 0 {
+		return false
+	}
+	if v := match.VersionEndExcluding; v != nil && cpe.CompareVersions(version, *v) >= 0 {
+		return false
+	}
+	return true
+}
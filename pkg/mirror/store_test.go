@@ -0,0 +1,99 @@
+package mirror
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/kptm-tools/vulnerability-analysis/nvd/schema"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func ptr(s string) *string { return &s }
+
+func record(id, lastModified string, matches ...schema.CpeMatch) schema.Vulnerability {
+	return schema.Vulnerability{Cve: schema.CveDetail{
+		ID:             id,
+		LastModified:   lastModified,
+		Configurations: []schema.Configuration{{Nodes: []schema.Node{{Operator: "OR", CpeMatch: matches}}}},
+	}}
+}
+
+func TestStore_LookupCPE(t *testing.T) {
+	t.Parallel()
+	store := NewStore()
+	store.Put(
+		record("CVE-2021-41773", "2024-01-01T00:00:00.000", schema.CpeMatch{
+			Vulnerable: true,
+			Criteria:   "cpe:2.3:a:apache:http_server:2.4.49:*:*:*:*:*:*:*",
+		}),
+		record("CVE-2022-22720", "2024-01-01T00:00:00.000", schema.CpeMatch{
+			Vulnerable:          true,
+			Criteria:            "cpe:2.3:a:apache:http_server:*:*:*:*:*:*:*:*",
+			VersionEndIncluding: ptr("2.4.52"),
+		}),
+		record("CVE-2017-0001", "2024-01-01T00:00:00.000", schema.CpeMatch{
+			Vulnerable: true,
+			Criteria:   "cpe:2.3:o:microsoft:windows_10:-:*:*:*:*:*:*:*",
+		}),
+	)
+
+	testCases := []struct {
+		name string
+		cpe  string
+		want []string
+	}{
+		{"Exact version and range", "cpe:2.3:a:apache:http_server:2.4.49:*:*:*:*:*:*:*", []string{"CVE-2021-41773", "CVE-2022-22720"}},
+		{"Range only", "cpe:2.3:a:apache:http_server:2.4.10:*:*:*:*:*:*:*", []string{"CVE-2022-22720"}},
+		{"Outside range", "cpe:2.3:a:apache:http_server:2.4.53:*:*:*:*:*:*:*", nil},
+		{"Vendor case", "cpe:2.3:o:Microsoft:windows_10:-:*:*:*:*:*:*:*", []string{"CVE-2017-0001"}},
+		{"Unknown product", "cpe:2.3:a:nginx:nginx:1.0:*:*:*:*:*:*:*", nil},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			resp, err := store.LookupCPE(tc.cpe)
+			require.NoError(t, err)
+
+			var got []string
+			for _, v := range resp.Vulnerabilities {
+				got = append(got, v.Cve.ID)
+			}
+			assert.Equal(t, tc.want, got)
+			assert.Equal(t, len(tc.want), resp.TotalResults)
+		})
+	}
+}
+
+func TestStore_PutKeepsNewest(t *testing.T) {
+	t.Parallel()
+	store := NewStore()
+	store.Put(record("CVE-2024-0001", "2024-06-01T00:00:00.000"))
+	store.Put(record("CVE-2024-0001", "2024-01-01T00:00:00.000"))
+
+	resp, err := store.LookupCVE("cve-2024-0001")
+	require.NoError(t, err)
+	assert.Equal(t, "2024-06-01T00:00:00.000", resp.Vulnerabilities[0].Cve.LastModified)
+
+	_, err = store.LookupCVE("CVE-2024-9999")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestSnapshot_RoundTrip(t *testing.T) {
+	t.Parallel()
+	var buf bytes.Buffer
+	require.NoError(t, WriteSnapshot(&buf, []schema.Vulnerability{record("CVE-2024-0001", "")}))
+
+	snapshot, err := ReadSnapshot(&buf)
+	require.NoError(t, err)
+	require.Len(t, snapshot.Vulnerabilities, 1)
+	assert.Equal(t, "CVE-2024-0001", snapshot.Vulnerabilities[0].Cve.ID)
+}
+
+func TestStore_Seed(t *testing.T) {
+	t.Parallel()
+	store := NewStore()
+	seeded, err := store.Seed()
+	require.NoError(t, err)
+	assert.Equal(t, seeded, store.Len())
+}
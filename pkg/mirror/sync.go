@@ -0,0 +1,113 @@
+package mirror
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/kptm-tools/vulnerability-analysis/nvd/schema"
+)
+
+// Upstream is where a mirror syncs from: the NVD API for a primary mirror,
+// or a primary mirror for a regional replica.
+type Upstream interface {
+	// FetchModified returns the records modified since the given time and
+	// the time up to which the returned set is complete.
+	FetchModified(ctx context.Context, since time.Time) ([]schema.Vulnerability, time.Time, error)
+}
+
+// NVDUpstream syncs from the NVD API through a date range query function,
+// such as (*services.NVDClient).FetchModifiedRange.
+type NVDUpstream struct {
+	fetch func(ctx context.Context, start, end time.Time) (*schema.NvdAPIResponse, error)
+}
+
+var _ Upstream = (*NVDUpstream)(nil)
+
+func NewNVDUpstream(fetch func(ctx context.Context, start, end time.Time) (*schema.NvdAPIResponse, error)) *NVDUpstream {
+	return &NVDUpstream{fetch: fetch}
+}
+
+func (u *NVDUpstream) FetchModified(ctx context.Context, since time.Time) ([]schema.Vulnerability, time.Time, error) {
+	until := time.Now().UTC()
+	resp, err := u.fetch(ctx, since, until)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	return resp.Vulnerabilities, until, nil
+}
+
+// Syncer periodically pulls modified records from an upstream into a store.
+type Syncer struct {
+	store    *Store
+	upstream Upstream
+	interval time.Duration
+	// from is where the first sync of an empty store starts.
+	from time.Time
+}
+
+// NewSyncer creates a syncer. The first sync fetches every record modified
+// since from; later syncs only fetch the delta since the previous one.
+func NewSyncer(store *Store, upstream Upstream, interval time.Duration, from time.Time) *Syncer {
+	return &Syncer{
+		store:    store,
+		upstream: upstream,
+		interval: interval,
+		from:     from,
+	}
+}
+
+// SyncOnce fetches the delta since the last sync and returns the number of
+// records received.
+func (s *Syncer) SyncOnce(ctx context.Context) (int, error) {
+	since := s.store.SyncedUntil()
+	if since.IsZero() {
+		since = s.from
+	}
+
+	records, until, err := s.upstream.FetchModified(ctx, since)
+	if err != nil {
+		return 0, fmt.Errorf("failed to sync mirror since %s: %w", since.Format(time.RFC3339), err)
+	}
+
+	if err := s.store.Commit(records, until); err != nil {
+		return 0, err
+	}
+	return len(records), nil
+}
+
+// Run syncs immediately and then every interval until ctx is done. Without
+// a positive interval it only syncs once.
+func (s *Syncer) Run(ctx context.Context) {
+	if s.interval <= 0 {
+		s.runOnce(ctx)
+		return
+	}
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		s.runOnce(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// runOnce syncs and logs the outcome.
+func (s *Syncer) runOnce(ctx context.Context) {
+	started := time.Now()
+	synced, err := s.SyncOnce(ctx)
+	if err != nil {
+		slog.Error("Mirror sync failed", slog.Any("error", err))
+		return
+	}
+	slog.Info("Mirror synced",
+		slog.Int("records", synced),
+		slog.Int("total", s.store.Len()),
+		slog.Duration("duration", time.Since(started)))
+}
@@ -0,0 +1,153 @@
+// Package msrc ingests the Microsoft Security Response Center security
+// update guides, published monthly as CVRF documents, and maps the CVEs of
+// Windows hosts to the KB updates fixing them. Windows admins remediate by
+// KB rather than by CVE.
+package msrc
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// remediationVendorFix is the CVRF remediation type of a security update.
+const remediationVendorFix = 2
+
+// Update is a parsed monthly security update document, e.g. 2024-Jan.
+type Update struct {
+	ID       string
+	Title    string
+	Released time.Time         // Release of the current revision, zero when undated
+	Products map[string]string // Product names by product ID
+	Vulns    []Vuln
+}
+
+// Vuln is a CVE of an update with the KBs fixing it.
+type Vuln struct {
+	CVE   string
+	Fixes []Fix
+}
+
+// Fix is a KB update fixing a CVE on some products.
+type Fix struct {
+	KB         string // e.g. KB5034119
+	URL        string
+	Supersedes []string // KBs replaced by this update
+	ProductIDs []string
+}
+
+type cvrfDocument struct {
+	DocumentTitle struct {
+		Value string `json:"Value"`
+	} `json:"DocumentTitle"`
+	DocumentTracking struct {
+		Identification struct {
+			ID struct {
+				Value string `json:"Value"`
+			} `json:"ID"`
+		} `json:"Identification"`
+		CurrentReleaseDate string `json:"CurrentReleaseDate"`
+	} `json:"DocumentTracking"`
+	ProductTree struct {
+		FullProductName []struct {
+			ProductID string `json:"ProductID"`
+			Value     string `json:"Value"`
+		} `json:"FullProductName"`
+	} `json:"ProductTree"`
+	Vulnerability []struct {
+		CVE          string `json:"CVE"`
+		Remediations []struct {
+			Description struct {
+				Value string `json:"Value"`
+			} `json:"Description"`
+			URL          string   `json:"URL"`
+			Supercedence string   `json:"Supercedence"`
+			ProductID    []string `json:"ProductID"`
+			Type         int      `json:"Type"`
+		} `json:"Remediations"`
+	} `json:"Vulnerability"`
+}
+
+// ParseCVRF parses an MSRC security update guide in the CVRF JSON format.
+func ParseCVRF(data []byte) (Update, error) {
+	var doc cvrfDocument
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return Update{}, fmt.Errorf("failed to decode CVRF document: %w", err)
+	}
+	if doc.DocumentTracking.Identification.ID.Value == "" {
+		return Update{}, fmt.Errorf("CVRF document has no tracking ID")
+	}
+
+	update := Update{
+		ID:       doc.DocumentTracking.Identification.ID.Value,
+		Title:    doc.DocumentTitle.Value,
+		Released: releaseDate(doc.DocumentTracking.CurrentReleaseDate, doc.DocumentTracking.Identification.ID.Value),
+		Products: make(map[string]string, len(doc.ProductTree.FullProductName)),
+	}
+	for _, p := range doc.ProductTree.FullProductName {
+		update.Products[p.ProductID] = p.Value
+	}
+
+	for _, v := range doc.Vulnerability {
+		vuln := Vuln{CVE: v.CVE}
+		for _, r := range v.Remediations {
+			// Other remediations are workarounds, mitigations or release notes,
+			// and vendor fixes of non-Windows products may be described by name
+			kb := kbNumber(r.Description.Value)
+			if r.Type != remediationVendorFix || kb == "" {
+				continue
+			}
+			vuln.Fixes = append(vuln.Fixes, Fix{
+				KB:         kb,
+				URL:        r.URL,
+				Supersedes: supersededKBs(r.Supercedence),
+				ProductIDs: r.ProductID,
+			})
+		}
+		update.Vulns = append(update.Vulns, vuln)
+	}
+	return update, nil
+}
+
+// releaseDate parses the release date of an update, given with or without a
+// time zone, falling back to the first day of the month its ID names, e.g.
+// 2024-Jan. It returns zero when neither parses.
+func releaseDate(date, id string) time.Time {
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04:05"} {
+		if released, err := time.Parse(layout, date); err == nil {
+			return released.UTC()
+		}
+	}
+	if month, err := time.Parse("2006-Jan", id); err == nil {
+		return month
+	}
+	return time.Time{}
+}
+
+// kbNumber returns the KB ID of a remediation description, given as the bare
+// article number, e.g. 5034119, or "" when it isn't one.
+func kbNumber(s string) string {
+	s = strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(s)), "KB")
+	if s == "" {
+		return ""
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return ""
+		}
+	}
+	return "KB" + s
+}
+
+// supersededKBs returns the KBs of a supercedence field, which lists one or
+// more article numbers separated by commas or semicolons.
+func supersededKBs(s string) []string {
+	var kbs []string
+	for _, field := range strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == ';' }) {
+		if kb := kbNumber(field); kb != "" {
+			kbs = append(kbs, kb)
+		}
+	}
+	return kbs
+}
@@ -0,0 +1,197 @@
+package msrc
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// KB is an update fixing a CVE on the product of a looked up CPE.
+type KB struct {
+	ID         string
+	URL        string
+	Supersedes []string
+	Update     string // Monthly update the KB was released in
+	Products   []string
+}
+
+// Index maps CVEs to the KBs fixing them.
+type Index struct {
+	mu      sync.RWMutex
+	updates map[string]Update
+	byCVE   map[string][]fixRef
+}
+
+type fixRef struct {
+	updateID string
+	fix      Fix
+}
+
+func NewIndex() *Index {
+	return &Index{
+		updates: make(map[string]Update),
+		byCVE:   make(map[string][]fixRef),
+	}
+}
+
+// Add indexes an update, replacing a previous revision with the same ID.
+func (idx *Index) Add(u Update) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	if _, ok := idx.updates[u.ID]; ok {
+		for cve, refs := range idx.byCVE {
+			idx.byCVE[cve] = slices.DeleteFunc(refs, func(r fixRef) bool { return r.updateID == u.ID })
+		}
+	}
+	idx.updates[u.ID] = u
+
+	for _, v := range u.Vulns {
+		for _, f := range v.Fixes {
+			idx.byCVE[v.CVE] = append(idx.byCVE[v.CVE], fixRef{updateID: u.ID, fix: f})
+		}
+	}
+}
+
+// Len returns the number of indexed updates.
+func (idx *Index) Len() int {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	return len(idx.updates)
+}
+
+// Latest returns the release time of the most recent indexed update, zero
+// when none is dated. Since Microsoft publishes an update every month, an old
+// one means the index is no longer refreshed.
+func (idx *Index) Latest() time.Time {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	var latest time.Time
+	for _, u := range idx.updates {
+		if u.Released.After(latest) {
+			latest = u.Released
+		}
+	}
+	return latest
+}
+
+// LoadDir indexes every CVRF JSON document below dir. Documents that fail to
+// parse are reported but don't stop the load.
+func (idx *Index) LoadDir(dir string) (int, error) {
+	loaded := 0
+	var errs []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || filepath.Ext(path) != ".json" {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		update, err := ParseCVRF(data)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %s", path, err))
+			return nil
+		}
+		idx.Add(update)
+		loaded++
+		return nil
+	})
+	if err != nil {
+		return loaded, fmt.Errorf("failed to load MSRC updates from %s: %w", dir, err)
+	}
+	if len(errs) > 0 {
+		return loaded, fmt.Errorf("failed to parse %d MSRC updates: %s", len(errs), strings.Join(errs, "; "))
+	}
+	return loaded, nil
+}
+
+// IsWindows reports whether cpe names a Microsoft Windows product.
+func IsWindows(cpe string) bool {
+	parts := strings.Split(cpe, ":")
+	return len(parts) >= 5 && parts[3] == "microsoft" && strings.HasPrefix(parts[4], "windows")
+}
+
+// Lookup returns the KBs fixing cve on the Windows product of a CPE 2.3 name.
+func (idx *Index) Lookup(cpe, cve string) []KB {
+	if !IsWindows(cpe) {
+		return nil
+	}
+	parts := strings.Split(cpe, ":")
+	product := normalize(parts[4])
+	version := ""
+	if len(parts) > 5 && parts[5] != "*" && parts[5] != "-" {
+		version = normalize(parts[5])
+	}
+
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	var kbs []KB
+	seen := make(map[string]int)
+	for _, ref := range idx.byCVE[cve] {
+		names := idx.updates[ref.updateID].Products
+		var products []string
+		for _, id := range ref.fix.ProductIDs {
+			if name, ok := names[id]; ok && matchesProduct(name, product, version) {
+				products = append(products, name)
+			}
+		}
+		if len(products) == 0 {
+			continue
+		}
+
+		if i, ok := seen[ref.fix.KB]; ok {
+			for _, p := range products {
+				if !slices.Contains(kbs[i].Products, p) {
+					kbs[i].Products = append(kbs[i].Products, p)
+				}
+			}
+			continue
+		}
+		seen[ref.fix.KB] = len(kbs)
+		kbs = append(kbs, KB{
+			ID:         ref.fix.KB,
+			URL:        ref.fix.URL,
+			Supersedes: ref.fix.Supersedes,
+			Update:     ref.updateID,
+			Products:   products,
+		})
+	}
+	sort.Slice(kbs, func(i, j int) bool { return kbs[i].ID < kbs[j].ID })
+	return kbs
+}
+
+var nonAlphaNum = regexp.MustCompile(`[^a-z0-9]+`)
+
+// normalize drops case and punctuation, so that the MSRC product name
+// "Windows Server 2016" matches the CPE product windows_server_2016.
+func normalize(s string) string {
+	return nonAlphaNum.ReplaceAllString(strings.ToLower(s), "")
+}
+
+// matchesProduct reports whether an MSRC product name, e.g. "Windows 10
+// Version 1607 for x64-based Systems", is the CPE product and version.
+func matchesProduct(name, product, version string) bool {
+	name = normalize(name)
+	rest, ok := strings.CutPrefix(name, product)
+	if !ok {
+		return false
+	}
+	if version != "" {
+		return strings.Contains(rest, version)
+	}
+	// Without a version, windows_server_2012 must not match Windows Server
+	// 2012 R2 nor windows_1 match Windows 10
+	return !strings.HasPrefix(rest, "r2") && (rest == "" || rest[0] < '0' || rest[0] > '9')
+}
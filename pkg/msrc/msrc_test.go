@@ -0,0 +1,82 @@
+package msrc
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCVRF(t *testing.T) {
+	t.Parallel()
+	data, err := os.ReadFile("testdata/2024-Jan.json")
+	require.NoError(t, err)
+
+	update, err := ParseCVRF(data)
+	require.NoError(t, err)
+	assert.Equal(t, "2024-Jan", update.ID)
+	assert.Equal(t, "January 2024 Security Updates", update.Title)
+	assert.Equal(t, time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), update.Released, "Expected undated updates to be released on the month of their ID")
+	assert.Equal(t, "Windows Server 2012 R2", update.Products["10483"])
+	require.Len(t, update.Vulns, 2)
+
+	// Release notes and restart notices aren't KBs
+	fixes := update.Vulns[0].Fixes
+	require.Len(t, fixes, 3)
+	assert.Equal(t, Fix{
+		KB:         "KB5034119",
+		URL:        "https://catalog.update.microsoft.com/v7/site/Search.aspx?q=KB5034119",
+		Supersedes: []string{"KB5033373"},
+		ProductIDs: []string{"10852"},
+	}, fixes[0])
+	assert.Equal(t, []string{"KB5033420", "KB5033372"}, fixes[2].Supersedes)
+
+	update, err = ParseCVRF([]byte(`{"DocumentTracking":{"Identification":{"ID":{"Value":"2024-Feb"}},"CurrentReleaseDate":"2024-02-13T08:00:00"}}`))
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 2, 13, 8, 0, 0, 0, time.UTC), update.Released)
+
+	_, err = ParseCVRF([]byte(`{"DocumentTitle":{}}`))
+	assert.Error(t, err)
+}
+
+func TestIndex_Lookup(t *testing.T) {
+	t.Parallel()
+	idx := NewIndex()
+	assert.True(t, idx.Latest().IsZero())
+	loaded, err := idx.LoadDir("testdata")
+	require.NoError(t, err)
+	assert.Equal(t, 1, loaded)
+	assert.Equal(t, time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), idx.Latest())
+
+	kbs := idx.Lookup("cpe:2.3:o:microsoft:windows_10:1607:*:*:*:*:*:*:*", "CVE-2024-20674")
+	require.Len(t, kbs, 1)
+	assert.Equal(t, KB{
+		ID:         "KB5034119",
+		URL:        "https://catalog.update.microsoft.com/v7/site/Search.aspx?q=KB5034119",
+		Supersedes: []string{"KB5033373"},
+		Update:     "2024-Jan",
+		Products:   []string{"Windows 10 Version 1607 for x64-based Systems"},
+	}, kbs[0])
+
+	tests := []struct {
+		cpe string
+		kbs []string
+	}{
+		{cpe: "cpe:2.3:o:microsoft:windows_server_2012:-:*:*:*:*:*:*:*", kbs: []string{"KB5034184"}},
+		{cpe: "cpe:2.3:o:microsoft:windows_server_2012:r2:*:*:*:*:*:*:*", kbs: []string{"KB5034171"}},
+		{cpe: "cpe:2.3:o:microsoft:windows_10:*:*:*:*:*:*:*:*", kbs: []string{"KB5034119"}},
+		{cpe: "cpe:2.3:o:microsoft:windows_1:*:*:*:*:*:*:*:*"},
+		{cpe: "cpe:2.3:o:linux:linux_kernel:5.10:*:*:*:*:*:*:*"},
+	}
+	for _, tt := range tests {
+		var ids []string
+		for _, kb := range idx.Lookup(tt.cpe, "CVE-2024-20674") {
+			ids = append(ids, kb.ID)
+		}
+		assert.Equal(t, tt.kbs, ids, tt.cpe)
+	}
+
+	assert.Empty(t, idx.Lookup("cpe:2.3:o:microsoft:windows_10:1607:*:*:*:*:*:*:*", "CVE-2024-0001"))
+}
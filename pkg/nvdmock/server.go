@@ -0,0 +1,160 @@
+package nvdmock
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"time"
+
+	"github.com/kptm-tools/vulnerability-analysis/nvd/schema"
+)
+
+// Options tunes the behaviour of the mock NVD server.
+type Options struct {
+	// Latency is added to every response to emulate the real API round-trip.
+	Latency time.Duration
+	// MaxVulnsPerCPE bounds the number of CVEs returned for a single CPE.
+	MaxVulnsPerCPE int
+}
+
+// Server is a mock of the NVD CVE API. Responses are derived
+// deterministically from the queried CPE, so repeated runs are comparable.
+type Server struct {
+	*httptest.Server
+	opts     Options
+	requests atomic.Int64
+}
+
+// NewServer starts a mock NVD API server. Callers must Close it when done.
+func NewServer(opts Options) *Server {
+	if opts.MaxVulnsPerCPE <= 0 {
+		opts.MaxVulnsPerCPE = 50
+	}
+	s := &Server{opts: opts}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+// Requests returns the number of requests served so far.
+func (s *Server) Requests() int64 {
+	return s.requests.Load()
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	s.requests.Add(1)
+	if s.opts.Latency > 0 {
+		time.Sleep(s.opts.Latency)
+	}
+
+	cpe := r.URL.Query().Get("cpeName")
+	if cpe == "" {
+		http.Error(w, "missing cpeName", http.StatusNotFound)
+		return
+	}
+
+	resp := BuildResponse(cpe, s.opts.MaxVulnsPerCPE)
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// BuildResponse generates a synthetic NVD API response for the given CPE
+// containing up to maxVulns vulnerabilities.
+func BuildResponse(cpe string, maxVulns int) schema.NvdAPIResponse {
+	seed := hashString(cpe)
+	count := int(seed % uint64(maxVulns+1))
+
+	vulns := make([]schema.Vulnerability, 0, count)
+	for i := 0; i < count; i++ {
+		vulns = append(vulns, buildVulnerability(seed, i))
+	}
+
+	return schema.NvdAPIResponse{
+		ResultsPerPage:  count,
+		StartIndex:      0,
+		TotalResults:    count,
+		Format:          "NVD_CVE",
+		Version:         "2.0",
+		Timestamp:       time.Now().UTC().Format("2006-01-02T15:04:05.000"),
+		Vulnerabilities: vulns,
+	}
+}
+
+var (
+	attackVectors = []schema.AttackVectorType{
+		schema.AttackVectorTypeNetwork,
+		schema.AttackVectorTypeAdjacentNetwork,
+		schema.AttackVectorTypeLocal,
+		schema.AttackVectorTypePhysical,
+	}
+	ciaValues  = []schema.CiaType{schema.CiaTypeHigh, schema.CiaTypeLow, schema.CiaTypeNone}
+	complexity = []schema.AttackComplexityType{schema.AttackComplexityTypeLow, schema.AttackComplexityTypeHigh}
+	privileges = []schema.PrivilegesRequiredType{schema.PrivilegesRequiredTypeNone, schema.PrivilegesRequiredTypeLow, schema.PrivilegesRequiredTypeHigh}
+)
+
+func severityFor(score float64) schema.SeverityType {
+	switch {
+	case score >= 9.0:
+		return schema.SeverityTypeCritical
+	case score >= 7.0:
+		return schema.SeverityTypeHigh
+	case score >= 4.0:
+		return schema.SeverityTypeMedium
+	default:
+		return schema.SeverityTypeLow
+	}
+}
+
+func buildVulnerability(seed uint64, i int) schema.Vulnerability {
+	h := hashString(fmt.Sprintf("%d-%d", seed, i))
+	score := float64(h%100) / 10.0
+
+	return schema.Vulnerability{
+		Cve: schema.CveDetail{
+			ID:               fmt.Sprintf("CVE-%d-%d", 2000+int(h%25), 1000+int(h%90000)),
+			SourceIdentifier: "mock@nvd.local",
+			Published:        "2024-01-02T03:04:05.000",
+			LastModified:     "2024-11-21T02:09:48.080",
+			VulnStatus:       "Analyzed",
+			Descriptions: []schema.Description{
+				{Lang: "en", Value: fmt.Sprintf("Synthetic vulnerability %d generated by the mock NVD server.", i)},
+			},
+			References: []schema.Reference{
+				{URL: fmt.Sprintf("https://example.com/advisories/%d", h%100000), Source: "mock@nvd.local"},
+			},
+			Metrics: &schema.Metrics{
+				CvssMetricV31: []schema.CvssMetricV31{
+					{
+						Source: "nvd@nist.gov",
+						Type:   "Primary",
+						CvssData: schema.CvssDataV31{
+							Version:               "3.1",
+							AttackVector:          attackVectors[h%uint64(len(attackVectors))],
+							AttackComplexity:      complexity[h%uint64(len(complexity))],
+							PrivilegesRequired:    privileges[h%uint64(len(privileges))],
+							UserInteraction:       schema.UserInteractionTypeNone,
+							Scope:                 schema.ScopeTypeUnchanged,
+							ConfidentialityImpact: ciaValues[(h>>2)%uint64(len(ciaValues))],
+							IntegrityImpact:       ciaValues[(h>>4)%uint64(len(ciaValues))],
+							AvailabilityImpact:    ciaValues[(h>>6)%uint64(len(ciaValues))],
+							BaseScore:             score,
+							BaseSeverity:          severityFor(score),
+						},
+						ExploitabilityScore: 3.9,
+						ImpactScore:         5.9,
+					},
+				},
+			},
+		},
+	}
+}
+
+func hashString(s string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(s))
+	return h.Sum64()
+}
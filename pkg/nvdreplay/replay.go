@@ -0,0 +1,203 @@
+// Package nvdreplay records the responses of the live NVD API to testdata
+// files and replays them, so that tests run offline in CI against real NVD
+// data and fixtures such as nvd_api_success.json are regenerated rather than
+// edited by hand. A Transport replays by default; setting NVD_REPLAY_MODE to
+// record sends the requests to NVD and writes the responses to a separate
+// directory, testdata/recorded unless NVD_REPLAY_DIR is set, so that the
+// fixtures other tests read are only replaced once the recordings are copied
+// over them:
+//
+//	NVD_REPLAY_MODE=record NVD_API_KEY=... go test ./pkg/services -run Replay
+//
+// API keys never reach the fixtures: only response bodies are recorded, with
+// the keys sent scrubbed from them.
+package nvdreplay
+
+import (
+	"bytes"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Mode tells a Transport whether to replay or record responses.
+type Mode string
+
+const (
+	ModeReplay Mode = "replay"
+	ModeRecord Mode = "record"
+)
+
+// ModeEnv is the environment variable selecting the mode of New.
+const ModeEnv = "NVD_REPLAY_MODE"
+
+// DirEnv is the environment variable overriding the directory New records
+// to.
+const DirEnv = "NVD_REPLAY_DIR"
+
+// Redacted replaces the secrets found in recorded responses.
+const Redacted = "REDACTED"
+
+// Transport is an http.RoundTripper replaying the fixtures of Dir, or
+// recording responses from Live to RecordDir.
+type Transport struct {
+	Dir  string
+	Mode Mode
+
+	// RecordDir is where responses are recorded, the recorded directory of
+	// Dir when empty. Recordings never overwrite the fixtures of Dir.
+	RecordDir string
+
+	// Live sends the requests while recording, http.DefaultTransport when
+	// nil.
+	Live http.RoundTripper
+
+	// Name returns the fixture file of a request, FixtureName when nil.
+	Name func(req *http.Request) string
+
+	// Secrets are scrubbed from the recorded responses, on top of the API
+	// keys sent in the apiKey header or query parameter.
+	Secrets []string
+}
+
+var _ http.RoundTripper = (*Transport)(nil)
+
+// New returns a transport of the fixtures in dir, recording to DirEnv, or
+// the recorded directory of dir, when ModeEnv is record and replaying
+// otherwise. The NVD_API_KEY environment variable is scrubbed from the
+// recordings.
+func New(dir string) *Transport {
+	t := &Transport{Dir: dir, Mode: ModeReplay, RecordDir: os.Getenv(DirEnv)}
+	if Mode(os.Getenv(ModeEnv)) == ModeRecord {
+		t.Mode = ModeRecord
+	}
+	if key := os.Getenv("NVD_API_KEY"); key != "" {
+		t.Secrets = append(t.Secrets, key)
+	}
+	return t
+}
+
+// Named returns a Name function storing every request in the fixture name,
+// for tests making a single request.
+func Named(name string) func(req *http.Request) string {
+	return func(*http.Request) string {
+		return name
+	}
+}
+
+// FixtureName names the fixture of a request after its path and query,
+// without the API key, with a hash telling apart the queries sanitized to
+// the same name.
+func FixtureName(req *http.Request) string {
+	query := req.URL.Query()
+	query.Del("apiKey")
+	key := strings.TrimPrefix(req.URL.Path, "/") + "?" + query.Encode()
+
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '.':
+			return r
+		default:
+			return '_'
+		}
+	}, key)
+	if len(name) > 100 {
+		name = name[:100]
+	}
+	return fmt.Sprintf("%s_%08x.json", name, h.Sum32())
+}
+
+// RoundTrip replays or records the response of req.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	name := FixtureName
+	if t.Name != nil {
+		name = t.Name
+	}
+	if t.Mode != ModeRecord {
+		body, err := os.ReadFile(filepath.Join(t.Dir, name(req)))
+		if err != nil {
+			return nil, fmt.Errorf("no recorded NVD response for %s, record it with %s=%s: %w", req.URL.Path, ModeEnv, ModeRecord, err)
+		}
+		return response(req, http.StatusOK, body), nil
+	}
+
+	dir := t.RecordDir
+	if dir == "" {
+		dir = filepath.Join(t.Dir, "recorded")
+	}
+	return t.record(req, dir, name(req))
+}
+
+func (t *Transport) record(req *http.Request, dir, name string) (*http.Response, error) {
+	live := t.Live
+	if live == nil {
+		live = http.DefaultTransport
+	}
+	// Left to the live transport, so that it decompresses the body
+	req = req.Clone(req.Context())
+	req.Header.Del("Accept-Encoding")
+
+	resp, err := live.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read NVD response: %w", err)
+	}
+
+	// Errors, throttling included, aren't fixtures
+	if resp.StatusCode != http.StatusOK {
+		resp.Body = io.NopCloser(bytes.NewReader(body))
+		return resp, nil
+	}
+
+	body = scrub(body, t.secrets(req))
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create recording directory: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, name), body, 0o644); err != nil {
+		return nil, fmt.Errorf("failed to record NVD response: %w", err)
+	}
+	return response(req, resp.StatusCode, body), nil
+}
+
+// secrets returns the values scrubbed from the response of req.
+func (t *Transport) secrets(req *http.Request) []string {
+	secrets := slices.Clone(t.Secrets)
+	for _, key := range []string{req.Header.Get("apiKey"), req.URL.Query().Get("apiKey")} {
+		if key != "" {
+			secrets = append(secrets, key)
+		}
+	}
+	return secrets
+}
+
+func scrub(body []byte, secrets []string) []byte {
+	for _, secret := range secrets {
+		body = bytes.ReplaceAll(body, []byte(secret), []byte(Redacted))
+	}
+	return body
+}
+
+func response(req *http.Request, status int, body []byte) *http.Response {
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": {"application/json"}},
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
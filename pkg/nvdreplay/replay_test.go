@@ -0,0 +1,85 @@
+package nvdreplay
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func get(t *testing.T, transport http.RoundTripper, url string, header http.Header) (int, string) {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	require.NoError(t, err)
+	for name, values := range header {
+		req.Header.Set(name, values[0])
+	}
+	resp, err := transport.RoundTrip(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return resp.StatusCode, string(body)
+}
+
+func TestTransport_RecordReplay(t *testing.T) {
+	t.Parallel()
+	live := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("cveId") == "CVE-0000-0000" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		// An API key echoed back, e.g. in an error message
+		_, _ = w.Write([]byte(`{"totalResults":1,"key":"` + r.Header.Get("apiKey") + `","token":"s3cr3t"}`))
+	}))
+	defer live.Close()
+
+	dir := t.TempDir()
+	url := live.URL + "/rest/json/cves/2.0?cveId=CVE-2021-44228"
+	recorder := &Transport{Dir: dir, Mode: ModeRecord, Secrets: []string{"s3cr3t"}}
+	recorded := filepath.Join(dir, "recorded")
+	status, body := get(t, recorder, url, http.Header{"apiKey": {"my-key"}})
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, `{"totalResults":1,"key":"REDACTED","token":"REDACTED"}`, body)
+
+	status, _ = get(t, recorder, live.URL+"/rest/json/cves/2.0?cveId=CVE-0000-0000", nil)
+	assert.Equal(t, http.StatusServiceUnavailable, status)
+	entries, err := os.ReadDir(recorded)
+	require.NoError(t, err)
+	require.Len(t, entries, 1, "Expected only successful responses to be recorded")
+	assert.NoFileExists(t, filepath.Join(dir, entries[0].Name()), "Expected the fixtures to be left alone")
+
+	// Replayed without the live API, whatever the key
+	live.Close()
+	status, replayed := get(t, &Transport{Dir: recorded}, url+"&apiKey=other-key", nil)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, body, replayed)
+
+	_, err = (&Transport{Dir: dir}).RoundTrip(httptest.NewRequest(http.MethodGet, "/rest/json/cves/2.0?cveId=CVE-2024-0001", nil))
+	assert.ErrorContains(t, err, ModeEnv)
+}
+
+func TestTransport_Named(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "nvd_api_success.json"), []byte(`{"totalResults":2}`), 0o644))
+
+	transport := &Transport{Dir: dir, Name: Named("nvd_api_success.json")}
+	_, body := get(t, transport, "https://services.nvd.nist.gov/rest/json/cves/2.0?cpeName=cpe:2.3:a:apache:log4j:2.14.1", nil)
+	assert.Equal(t, `{"totalResults":2}`, body)
+}
+
+func TestFixtureName(t *testing.T) {
+	t.Parallel()
+	name := func(url string) string {
+		return FixtureName(httptest.NewRequest(http.MethodGet, url, nil))
+	}
+	assert.Equal(t, name("/rest/json/cves/2.0?cveId=CVE-2021-44228"), name("/rest/json/cves/2.0?apiKey=key&cveId=CVE-2021-44228"))
+	assert.NotEqual(t, name("/rest/json/cves/2.0?cveId=CVE-2021-44228"), name("/rest/json/cves/2.0?cveId=CVE-2021-44229"))
+	assert.Regexp(t, `^rest_json_cves_2.0_cveId_CVE-2021-44228_[0-9a-f]{8}\.json$`, name("/rest/json/cves/2.0?cveId=CVE-2021-44228"))
+}
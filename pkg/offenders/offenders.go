@@ -0,0 +1,204 @@
+// Package offenders correlates the consecutive scans of each host to find the
+// chronically vulnerable ones: hosts on which scan after scan finds critical
+// CVEs they didn't have before, for risk owners to follow up on.
+package offenders
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/results"
+)
+
+// Offender is a host whose latest Threshold scans or more each found new
+// critical CVEs.
+type Offender struct {
+	Host       string    `json:"host"`
+	LastScanID uuid.UUID `json:"last_scan_id"`
+	LastScan   time.Time `json:"last_scan"`
+	results.RepeatOffender
+}
+
+// DefaultRetention is how long the history of a host is kept after its last
+// scan, by default.
+const DefaultRetention = 90 * 24 * time.Hour
+
+// Tracker keeps, per tenant and host, the critical CVEs found by earlier
+// scans and the current run of scans finding new ones. Hosts not scanned
+// for the retention are forgotten. It is safe for concurrent use.
+type Tracker struct {
+	mu        sync.RWMutex
+	threshold int
+	retention time.Duration
+	hosts     map[string]map[string]*host // tenant -> host address -> history
+	lastSweep time.Time
+}
+
+// Option configures a Tracker.
+type Option func(*Tracker)
+
+// WithRetention sets how long the history of a host is kept after its last
+// scan, DefaultRetention when not positive.
+func WithRetention(retention time.Duration) Option {
+	return func(t *Tracker) {
+		if retention > 0 {
+			t.retention = retention
+		}
+	}
+}
+
+// Source replays the critical CVEs found by the stored scans since a time,
+// oldest scan first, e.g. a vulnstore.Store.
+type Source interface {
+	CriticalCVEs(ctx context.Context, since time.Time, fn func(tenantID, hostAddress string, scanID uuid.UUID, cves []string, at time.Time)) error
+}
+
+type host struct {
+	known map[string]bool
+
+	lastScanID uuid.UUID
+	lastScan   time.Time
+	lastNew    []string
+
+	// streak is the current run, prevStreak the run before the last scan,
+	// restored when the last scan is observed again, e.g. on reanalysis.
+	streak     streak
+	prevStreak streak
+}
+
+type streak struct {
+	scans int
+	since time.Time
+	cves  []string
+}
+
+// NewTracker returns a tracker reporting hosts once threshold consecutive
+// scans found new critical CVEs on them, at least 2.
+func NewTracker(threshold int, opts ...Option) *Tracker {
+	t := &Tracker{
+		threshold: max(threshold, 2),
+		retention: DefaultRetention,
+		hosts:     make(map[string]map[string]*host),
+	}
+	for _, opt := range opts {
+		opt(t)
+	}
+	return t
+}
+
+// Load replays the scans of src within the retention, so that the runs of
+// the hosts survive restarts. It returns the number of scans replayed.
+func (t *Tracker) Load(ctx context.Context, src Source, now time.Time) (int, error) {
+	n := 0
+	err := src.CriticalCVEs(ctx, now.Add(-t.retention), func(tenantID, hostAddress string, scanID uuid.UUID, cves []string, at time.Time) {
+		t.Observe(tenantID, hostAddress, scanID, cves, at)
+		n++
+	})
+	return n, err
+}
+
+// Observe records the critical CVEs found on a host by a scan and returns
+// the host's repeat offender section, nil while it isn't one. Observing the
+// latest scan of a host again replaces it rather than counting another scan.
+func (t *Tracker) Observe(tenantID, hostAddress string, scanID uuid.UUID, criticalCVEs []string, at time.Time) *results.RepeatOffender {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.sweep(at)
+	if t.hosts[tenantID] == nil {
+		t.hosts[tenantID] = make(map[string]*host)
+	}
+	h := t.hosts[tenantID][hostAddress]
+	if h == nil {
+		h = &host{known: make(map[string]bool)}
+		t.hosts[tenantID][hostAddress] = h
+	}
+
+	if scanID != uuid.Nil && scanID == h.lastScanID {
+		for _, cve := range h.lastNew {
+			delete(h.known, cve)
+		}
+		h.streak = h.prevStreak
+	} else {
+		h.prevStreak = h.streak
+	}
+
+	var fresh []string
+	for _, cve := range criticalCVEs {
+		if !h.known[cve] {
+			h.known[cve] = true
+			fresh = append(fresh, cve)
+		}
+	}
+	h.lastScanID, h.lastScan, h.lastNew = scanID, at, fresh
+
+	if len(fresh) == 0 {
+		h.streak = streak{}
+		return nil
+	}
+	if h.streak.scans == 0 {
+		h.streak.since = at
+	}
+	h.streak.scans++
+	h.streak.cves = append(slices.Clone(h.streak.cves), fresh...)
+	return t.section(h)
+}
+
+// Offenders returns the repeat offenders of a tenant, the longest runs first.
+func (t *Tracker) Offenders(tenantID string) []Offender {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	offenders := []Offender{}
+	for address, h := range t.hosts[tenantID] {
+		if section := t.section(h); section != nil {
+			offenders = append(offenders, Offender{
+				Host:           address,
+				LastScanID:     h.lastScanID,
+				LastScan:       h.lastScan,
+				RepeatOffender: *section,
+			})
+		}
+	}
+	sort.Slice(offenders, func(i, j int) bool {
+		if offenders[i].ConsecutiveScans != offenders[j].ConsecutiveScans {
+			return offenders[i].ConsecutiveScans > offenders[j].ConsecutiveScans
+		}
+		return offenders[i].Host < offenders[j].Host
+	})
+	return offenders
+}
+
+// sweep forgets the hosts last scanned before the retention, at most once
+// per tenth of it. The caller holds the lock.
+func (t *Tracker) sweep(now time.Time) {
+	if now.Sub(t.lastSweep) < t.retention/10 {
+		return
+	}
+	t.lastSweep = now
+	for tenantID, hosts := range t.hosts {
+		for address, h := range hosts {
+			if now.Sub(h.lastScan) > t.retention {
+				delete(hosts, address)
+			}
+		}
+		if len(hosts) == 0 {
+			delete(t.hosts, tenantID)
+		}
+	}
+}
+
+func (t *Tracker) section(h *host) *results.RepeatOffender {
+	if h.streak.scans < t.threshold {
+		return nil
+	}
+	return &results.RepeatOffender{
+		ConsecutiveScans: h.streak.scans,
+		NewCriticalCVEs:  slices.Clone(h.streak.cves),
+		Since:            h.streak.since,
+	}
+}
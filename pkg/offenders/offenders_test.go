@@ -0,0 +1,130 @@
+package offenders
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTracker_Observe(t *testing.T) {
+	t.Parallel()
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	tracker := NewTracker(3)
+	scan := func(i int) (uuid.UUID, time.Time) {
+		return uuid.New(), start.Add(time.Duration(i) * 24 * time.Hour)
+	}
+
+	id, at := scan(0)
+	assert.Nil(t, tracker.Observe("acme", "10.0.0.1", id, []string{"CVE-2024-0001"}, at))
+	id, at = scan(1)
+	assert.Nil(t, tracker.Observe("acme", "10.0.0.1", id, []string{"CVE-2024-0001", "CVE-2024-0002"}, at))
+	id, at = scan(2)
+	section := tracker.Observe("acme", "10.0.0.1", id, []string{"CVE-2024-0002", "CVE-2024-0003"}, at)
+	require.NotNil(t, section, "Expected the third scan in a row with new criticals to flag the host")
+	assert.Equal(t, 3, section.ConsecutiveScans)
+	assert.Equal(t, []string{"CVE-2024-0001", "CVE-2024-0002", "CVE-2024-0003"}, section.NewCriticalCVEs)
+	assert.Equal(t, start, section.Since)
+
+	// Reanalyzing the latest scan replaces it
+	section = tracker.Observe("acme", "10.0.0.1", id, []string{"CVE-2024-0003", "CVE-2024-0004"}, at)
+	require.NotNil(t, section)
+	assert.Equal(t, 3, section.ConsecutiveScans)
+	assert.Equal(t, []string{"CVE-2024-0001", "CVE-2024-0002", "CVE-2024-0003", "CVE-2024-0004"}, section.NewCriticalCVEs)
+
+	// Hosts of other tenants and hosts with known criticals only aren't flagged
+	for i := range 4 {
+		id, at := scan(i)
+		tracker.Observe("globex", "10.0.0.1", id, []string{"CVE-2024-0001"}, at)
+		tracker.Observe("acme", "10.0.0.2", id, []string{"CVE-2024-0005"}, at)
+	}
+
+	offenders := tracker.Offenders("acme")
+	require.Len(t, offenders, 1)
+	assert.Equal(t, "10.0.0.1", offenders[0].Host)
+	assert.Equal(t, id, offenders[0].LastScanID)
+	assert.Empty(t, tracker.Offenders("globex"))
+
+	// A scan without new criticals ends the run
+	id, at = scan(3)
+	assert.Nil(t, tracker.Observe("acme", "10.0.0.1", id, []string{"CVE-2024-0004"}, at))
+	assert.Empty(t, tracker.Offenders("acme"))
+}
+
+func TestTracker_Offenders_Order(t *testing.T) {
+	t.Parallel()
+	tracker := NewTracker(2)
+	at := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	for i := range 3 {
+		cve := []string{"CVE-2024-000" + string(rune('1'+i))}
+		tracker.Observe("acme", "10.0.0.9", uuid.New(), cve, at)
+		if i > 0 {
+			tracker.Observe("acme", "10.0.0.1", uuid.New(), cve, at)
+			tracker.Observe("acme", "10.0.0.2", uuid.New(), cve, at)
+		}
+	}
+
+	var hosts []string
+	for _, o := range tracker.Offenders("acme") {
+		hosts = append(hosts, o.Host)
+	}
+	assert.Equal(t, []string{"10.0.0.9", "10.0.0.1", "10.0.0.2"}, hosts)
+}
+
+func TestTracker_Retention(t *testing.T) {
+	t.Parallel()
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	tracker := NewTracker(2, WithRetention(7*24*time.Hour))
+	tracker.Observe("acme", "10.0.0.1", uuid.New(), []string{"CVE-2024-0001"}, start)
+	tracker.Observe("acme", "10.0.0.1", uuid.New(), []string{"CVE-2024-0002"}, start.Add(24*time.Hour))
+	assert.Len(t, tracker.Offenders("acme"), 1)
+
+	// Scans after the retention evict the idle host, which starts over
+	tracker.Observe("acme", "10.0.0.2", uuid.New(), nil, start.Add(20*24*time.Hour))
+	assert.Empty(t, tracker.Offenders("acme"), "Expected the idle host to be evicted")
+	assert.Nil(t, tracker.Observe("acme", "10.0.0.1", uuid.New(), []string{"CVE-2024-0001"}, start.Add(21*24*time.Hour)))
+}
+
+// stubSource replays stored scans.
+type stubSource []struct {
+	host string
+	cves []string
+	at   time.Time
+}
+
+func (s stubSource) CriticalCVEs(ctx context.Context, since time.Time, fn func(tenantID, hostAddress string, scanID uuid.UUID, cves []string, at time.Time)) error {
+	for _, scan := range s {
+		if !scan.at.Before(since) {
+			fn("acme", scan.host, uuid.New(), scan.cves, scan.at)
+		}
+	}
+	return nil
+}
+
+func TestTracker_Load(t *testing.T) {
+	t.Parallel()
+	now := time.Now()
+	day := 24 * time.Hour
+	src := stubSource{
+		{host: "10.0.0.1", cves: []string{"CVE-2024-0001"}, at: now.Add(-200 * day)},
+		{host: "10.0.0.1", cves: []string{"CVE-2024-0002"}, at: now.Add(-3 * day)},
+		{host: "10.0.0.1", cves: []string{"CVE-2024-0003"}, at: now.Add(-2 * day)},
+		{host: "10.0.0.2", cves: []string{"CVE-2024-0004"}, at: now.Add(-2 * day)},
+	}
+	tracker := NewTracker(2)
+	n, err := tracker.Load(context.Background(), src, now)
+	require.NoError(t, err)
+	assert.Equal(t, 3, n, "Expected scans older than the retention to be left out")
+
+	offenders := tracker.Offenders("acme")
+	require.Len(t, offenders, 1)
+	assert.Equal(t, "10.0.0.1", offenders[0].Host)
+	assert.Equal(t, []string{"CVE-2024-0002", "CVE-2024-0003"}, offenders[0].NewCriticalCVEs)
+
+	section := tracker.Observe("acme", "10.0.0.2", uuid.New(), []string{"CVE-2024-0005"}, now)
+	require.NotNil(t, section, "Expected the replayed scans to count towards the run")
+	assert.Equal(t, 2, section.ConsecutiveScans)
+}
@@ -0,0 +1,146 @@
+package output
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/kptm-tools/common/common/pkg/results/tools"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/results"
+)
+
+// canonicalTimeFields are the keys of the timestamps of the results, VEX
+// and SBOM documents and API responses. Other strings are left as they are,
+// even when they read as a time, e.g. a version or a CPE field.
+var canonicalTimeFields = map[string]bool{
+	"analyzed_at":         true,
+	"assembled_at":        true,
+	"at":                  true,
+	"checked_at":          true,
+	"created_at":          true,
+	"estimated_start":     true,
+	"expires_at":          true,
+	"fetched_at":          true,
+	"first_seen":          true,
+	"fixed_at":            true,
+	"generated_at":        true,
+	"last_modified":       true,
+	"last_scan":           true,
+	"last_seen":           true,
+	"last_updated":        true,
+	"previous_scanned_at": true,
+	"published":           true,
+	"recorded_at":         true,
+	"resets_at":           true,
+	"scanned_at":          true,
+	"seen":                true,
+	"since":               true,
+	"started_at":          true,
+	"synced_until":        true,
+	"time":                true,
+	"timestamp":           true,
+	"updated":             true,
+	"updated_at":          true,
+}
+
+// Canonicalize sorts the lists of result whose order carries no meaning, so
+// that two analyses of the same host list them identically: ports by number
+// and protocol, findings by CVE ID, and the references, CWEs, advisories and
+// KBs of each finding. The primary addresses and names stay first.
+func Canonicalize(result *results.NmapResult) {
+	slices.SortStableFunc(result.ScannedPorts, func(a, b results.PortData) int {
+		return cmp.Or(cmp.Compare(a.ID, b.ID), cmp.Compare(a.Protocol, b.Protocol))
+	})
+	canonicalizeVulnerabilities(result.MostLikelyOS.Vulnerabilities)
+	for i := range result.ScannedPorts {
+		canonicalizeVulnerabilities(result.ScannedPorts[i].Vulnerabilities)
+	}
+
+	slices.Sort(result.MissingKBs)
+	slices.SortStableFunc(result.DroppedCPEs, func(a, b results.DroppedCPE) int {
+		return cmp.Or(cmp.Compare(a.Port, b.Port), strings.Compare(a.CPE, b.CPE))
+	})
+	if result.Degradation != nil {
+		slices.SortStableFunc(result.Degradation.Missing, func(a, b results.MissingSignal) int {
+			return strings.Compare(a.Signal, b.Signal)
+		})
+	}
+	if result.RepeatOffender != nil {
+		slices.Sort(result.RepeatOffender.NewCriticalCVEs)
+	}
+}
+
+func canonicalizeVulnerabilities(vulns []results.Vulnerability) {
+	slices.SortStableFunc(vulns, func(a, b results.Vulnerability) int {
+		return cmp.Or(strings.Compare(a.ID, b.ID), strings.Compare(a.Type, b.Type))
+	})
+	for i := range vulns {
+		vuln := &vulns[i]
+		slices.Sort(vuln.References)
+		slices.Sort(vuln.CWEs)
+		slices.SortStableFunc(vuln.VendorComments, func(a, b tools.VendorComment) int {
+			return cmp.Or(strings.Compare(a.Organization, b.Organization), a.LastModified.Compare(b.LastModified))
+		})
+		slices.SortStableFunc(vuln.ICSAdvisories, func(a, b results.ICSAdvisory) int {
+			return strings.Compare(a.ID, b.ID)
+		})
+		slices.SortStableFunc(vuln.KBs, func(a, b results.KBUpdate) int {
+			return strings.Compare(a.ID, b.ID)
+		})
+		slices.SortStableFunc(vuln.DeadReferences, func(a, b results.ReferenceStatus) int {
+			return strings.Compare(a.URL, b.URL)
+		})
+	}
+}
+
+// CanonicalJSON encodes v as compact JSON with the keys of every object
+// sorted and the timestamps of canonicalTimeFields in UTC, keeping their
+// sub-second precision without trailing zeros, so that encoding equal values
+// always yields the same bytes. Golden files and exports diffed between
+// scans then only change where the values do.
+func CanonicalJSON(v any) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return CanonicalizeJSON(data)
+}
+
+// CanonicalizeJSON re-encodes the JSON document data as CanonicalJSON does.
+func CanonicalizeJSON(data []byte) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var value any
+	if err := dec.Decode(&value); err != nil {
+		return nil, fmt.Errorf("invalid JSON: %w", err)
+	}
+	// Objects are decoded as maps, which encoding/json writes sorted by key
+	return json.Marshal(canonicalValue(value, ""))
+}
+
+// canonicalValue canonicalizes value, the field key of its object or, for
+// the items of an array, of the array.
+func canonicalValue(value any, key string) any {
+	switch v := value.(type) {
+	case map[string]any:
+		for field, item := range v {
+			v[field] = canonicalValue(item, field)
+		}
+	case []any:
+		for i, item := range v {
+			v[i] = canonicalValue(item, key)
+		}
+	case string:
+		if !canonicalTimeFields[key] {
+			return value
+		}
+		if t, err := time.Parse(time.RFC3339Nano, v); err == nil {
+			return t.UTC().Format(time.RFC3339Nano)
+		}
+	}
+	return value
+}
@@ -0,0 +1,93 @@
+package output
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kptm-tools/common/common/pkg/results/tools"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/results"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCanonicalize(t *testing.T) {
+	t.Parallel()
+	result := &results.NmapResult{
+		ScannedPorts: []results.PortData{
+			{ID: 443, Protocol: "tcp"},
+			{ID: 22, Protocol: "tcp", Vulnerabilities: []results.Vulnerability{
+				{Vulnerability: tools.Vulnerability{ID: "CVE-2024-0002", References: []string{"https://b", "https://a"}}, CWEs: []string{"CWE-79", "CWE-20"}},
+				{Vulnerability: tools.Vulnerability{ID: "CVE-2023-0001"}},
+			}},
+			{ID: 22, Protocol: "udp"},
+		},
+		Addresses:   []string{"10.0.0.2", "10.0.0.1"},
+		MissingKBs:  []string{"KB5002", "KB5001"},
+		Degradation: &results.Degradation{Missing: []results.MissingSignal{{Signal: "kev"}, {Signal: "epss"}}},
+	}
+
+	Canonicalize(result)
+	assert.Equal(t, uint16(22), result.ScannedPorts[0].ID)
+	assert.Equal(t, "udp", result.ScannedPorts[1].Protocol)
+	vulns := result.ScannedPorts[0].Vulnerabilities
+	assert.Equal(t, "CVE-2023-0001", vulns[0].ID)
+	assert.Equal(t, []string{"https://a", "https://b"}, vulns[1].References)
+	assert.Equal(t, []string{"CWE-20", "CWE-79"}, vulns[1].CWEs)
+	assert.Equal(t, []string{"10.0.0.2", "10.0.0.1"}, result.Addresses, "Expected the primary address to stay first")
+	assert.Equal(t, []string{"KB5001", "KB5002"}, result.MissingKBs)
+	assert.Equal(t, "epss", result.Degradation.Missing[0].Signal)
+}
+
+func TestCanonicalJSON(t *testing.T) {
+	t.Parallel()
+	paris := time.FixedZone("CET", 3600)
+	payload, err := CanonicalJSON(map[string]any{
+		"zeta": 1.5,
+		"alpha": struct {
+			Seen time.Time `json:"seen"`
+			Name string    `json:"name"`
+		}{time.Date(2024, 3, 1, 13, 30, 15, 123456789, paris), "ssh"},
+		"big": json.Number("12345678901234567890"),
+		// Time-like strings outside of the timestamp fields are kept
+		"version":   "2024-03-01T13:30:15+01:00",
+		"published": []string{"2024-03-01T13:30:15.500+01:00"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, `{"alpha":{"name":"ssh","seen":"2024-03-01T12:30:15.123456789Z"},"big":12345678901234567890,`+
+		`"published":["2024-03-01T12:30:15.5Z"],"version":"2024-03-01T13:30:15+01:00","zeta":1.5}`, string(payload))
+
+	again, err := CanonicalizeJSON(payload)
+	require.NoError(t, err)
+	assert.Equal(t, payload, again, "Expected canonical JSON to be stable")
+
+	_, err = CanonicalizeJSON([]byte("{"))
+	assert.Error(t, err)
+}
+
+func TestPublishResult_Canonical(t *testing.T) {
+	opts := Options{Canonical: true}
+
+	newResult := func(order ...string) tools.ToolResult {
+		var vulns []results.Vulnerability
+		for _, id := range order {
+			vulns = append(vulns, results.Vulnerability{Vulnerability: tools.Vulnerability{ID: id}})
+		}
+		return tools.ToolResult{Result: &results.NmapResult{ScannedPorts: []results.PortData{{ID: 80, Vulnerabilities: vulns}}}}
+	}
+	scanID := uuid.New()
+	toolResult := func(order ...string) json.RawMessage {
+		bus := &fakePublisher{}
+		require.NoError(t, opts.PublishResult(context.Background(), bus, "results", scanID, newResult(order...)))
+		require.Len(t, bus.messages, 1)
+		var event struct {
+			ToolResult json.RawMessage `json:"tool_result"`
+		}
+		require.NoError(t, json.Unmarshal(bus.messages[0].payload, &event))
+		return event.ToolResult
+	}
+	assert.Equal(t, toolResult("CVE-2024-0002", "CVE-2024-0001"), toolResult("CVE-2024-0001", "CVE-2024-0002"),
+		"Expected results differing in order only to be published identically")
+}
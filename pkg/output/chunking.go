@@ -0,0 +1,219 @@
+package output
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/failure"
+)
+
+// ChunkSubjectSuffix is appended to a subject to publish the chunks of its
+// oversized payloads.
+const ChunkSubjectSuffix = ".chunk"
+
+var (
+	ErrPayloadTooLarge   = errors.New("payload exceeds the maximum message size")
+	ErrIncompleteChunks  = errors.New("missing chunks for transfer")
+	ErrChecksumMismatch  = errors.New("reassembled payload checksum mismatch")
+	ErrUnknownTransferID = errors.New("unknown transfer")
+)
+
+// Publisher is the part of the event bus used to publish payloads.
+type Publisher interface {
+	Publish(subject string, payload []byte) error
+}
+
+// ChunkManifest is published on the original subject once every chunk of an
+// oversized payload was published on the chunk subject.
+type ChunkManifest struct {
+	Kind         string `json:"kind"`
+	TransferID   string `json:"transfer_id"`
+	ChunkSubject string `json:"chunk_subject"`
+	TotalChunks  int    `json:"total_chunks"`
+	TotalSize    int    `json:"total_size"`
+	SHA256       string `json:"sha256"`
+}
+
+const chunkManifestKind = "chunk_manifest"
+
+// Chunk is an ordered piece of an oversized payload.
+type Chunk struct {
+	TransferID string `json:"transfer_id"`
+	Index      int    `json:"index"`
+	Data       []byte `json:"data"`
+}
+
+// PublishPayload publishes an event payload, compressing it when configured.
+// Payloads that still exceed MaxMessageSize are split into chunks followed by
+// a manifest message on subject.
+func (o Options) PublishPayload(bus Publisher, subject string, payload []byte) error {
+	payload, err := o.EncodePayload(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode payload: %w", err)
+	}
+
+	if o.MaxMessageSize <= 0 || len(payload) <= o.MaxMessageSize {
+		if err := bus.Publish(subject, payload); err != nil {
+			return &failure.UpstreamError{Err: err}
+		}
+		return nil
+	}
+
+	return publishChunks(bus, subject, payload, o.MaxMessageSize)
+}
+
+func publishChunks(bus Publisher, subject string, payload []byte, maxMessageSize int) error {
+	// Chunk data is base64 encoded in JSON, leave room for it and the envelope
+	chunkSize := (maxMessageSize - 256) * 3 / 4
+	if chunkSize <= 0 {
+		return &failure.PolicyError{Err: fmt.Errorf("%w: maximum message size %d is too small to chunk", ErrPayloadTooLarge, maxMessageSize)}
+	}
+
+	sum := sha256.Sum256(payload)
+	manifest := ChunkManifest{
+		Kind:         chunkManifestKind,
+		TransferID:   uuid.NewString(),
+		ChunkSubject: subject + ChunkSubjectSuffix,
+		TotalChunks:  (len(payload) + chunkSize - 1) / chunkSize,
+		TotalSize:    len(payload),
+		SHA256:       hex.EncodeToString(sum[:]),
+	}
+
+	for i := 0; i < manifest.TotalChunks; i++ {
+		end := min((i+1)*chunkSize, len(payload))
+		msg, err := json.Marshal(Chunk{
+			TransferID: manifest.TransferID,
+			Index:      i,
+			Data:       payload[i*chunkSize : end],
+		})
+		if err != nil {
+			return fmt.Errorf("failed to marshal chunk %d: %w", i, err)
+		}
+		if err := bus.Publish(manifest.ChunkSubject, msg); err != nil {
+			return &failure.UpstreamError{Err: fmt.Errorf("failed to publish chunk %d of %d: %w", i+1, manifest.TotalChunks, err)}
+		}
+	}
+
+	msg, err := json.Marshal(manifest)
+	if err != nil {
+		return fmt.Errorf("failed to marshal chunk manifest: %w", err)
+	}
+	if err := bus.Publish(subject, msg); err != nil {
+		return &failure.UpstreamError{Err: fmt.Errorf("failed to publish chunk manifest: %w", err)}
+	}
+	return nil
+}
+
+// ParseChunkManifest reports whether a message received on a result subject
+// is a chunk manifest rather than the result itself.
+func ParseChunkManifest(data []byte) (ChunkManifest, bool) {
+	var manifest ChunkManifest
+	if err := json.Unmarshal(data, &manifest); err != nil || manifest.Kind != chunkManifestKind {
+		return ChunkManifest{}, false
+	}
+	return manifest, true
+}
+
+// Reassembler is the consumer side helper for chunked payloads. Messages of
+// the chunk subject are passed to AddChunk, and manifests received on the
+// result subject to Complete, which returns the original payload.
+type Reassembler struct {
+	ttl time.Duration
+
+	mu        sync.Mutex
+	transfers map[string]*transfer
+}
+
+type transfer struct {
+	chunks    map[int][]byte
+	updatedAt time.Time
+}
+
+// NewReassembler creates a Reassembler which drops incomplete transfers that
+// didn't receive any chunk for ttl.
+func NewReassembler(ttl time.Duration) *Reassembler {
+	return &Reassembler{
+		ttl:       ttl,
+		transfers: make(map[string]*transfer),
+	}
+}
+
+func (r *Reassembler) AddChunk(data []byte) error {
+	var chunk Chunk
+	if err := json.Unmarshal(data, &chunk); err != nil {
+		return fmt.Errorf("failed to unmarshal chunk: %w", err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.evictStale()
+	t, ok := r.transfers[chunk.TransferID]
+	if !ok {
+		t = &transfer{chunks: make(map[int][]byte)}
+		r.transfers[chunk.TransferID] = t
+	}
+	t.chunks[chunk.Index] = chunk.Data
+	t.updatedAt = time.Now()
+	return nil
+}
+
+// Complete reassembles, verifies and decodes the payload of a manifest.
+func (r *Reassembler) Complete(manifest ChunkManifest) ([]byte, error) {
+	chunks, err := r.takeChunks(manifest)
+	if err != nil {
+		return nil, err
+	}
+
+	payload := make([]byte, 0, manifest.TotalSize)
+	for _, chunk := range chunks {
+		payload = append(payload, chunk...)
+	}
+
+	sum := sha256.Sum256(payload)
+	if hex.EncodeToString(sum[:]) != manifest.SHA256 {
+		return nil, fmt.Errorf("%w: %s", ErrChecksumMismatch, manifest.TransferID)
+	}
+
+	return DecodePayload(payload)
+}
+
+// takeChunks returns the chunks of the transfer of manifest in order, and
+// forgets the transfer once complete. Chunks keep arriving concurrently, so
+// the transfer is only read under the lock.
+func (r *Reassembler) takeChunks(manifest ChunkManifest) ([][]byte, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	t, ok := r.transfers[manifest.TransferID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownTransferID, manifest.TransferID)
+	}
+	chunks := make([][]byte, manifest.TotalChunks)
+	for i := range chunks {
+		chunk, ok := t.chunks[i]
+		if !ok {
+			return nil, fmt.Errorf("%w %s: chunk %d of %d", ErrIncompleteChunks, manifest.TransferID, i+1, manifest.TotalChunks)
+		}
+		chunks[i] = chunk
+	}
+	delete(r.transfers, manifest.TransferID)
+	return chunks, nil
+}
+
+func (r *Reassembler) evictStale() {
+	if r.ttl <= 0 {
+		return
+	}
+	for id, t := range r.transfers {
+		if time.Since(t.updatedAt) > r.ttl {
+			delete(r.transfers, id)
+		}
+	}
+}
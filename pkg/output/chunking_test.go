@@ -0,0 +1,126 @@
+package output
+
+import (
+	"bytes"
+	"errors"
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type recordedMessage struct {
+	subject string
+	payload []byte
+}
+
+type fakePublisher struct {
+	messages []recordedMessage
+}
+
+func (p *fakePublisher) Publish(subject string, payload []byte) error {
+	p.messages = append(p.messages, recordedMessage{subject: subject, payload: payload})
+	return nil
+}
+
+func TestPublishPayload_Chunked(t *testing.T) {
+	t.Parallel()
+	opts := Options{MaxMessageSize: 4096}
+
+	// Random data doesn't compress, forcing several chunks
+	payload := make([]byte, 20000)
+	rand.New(rand.NewSource(1)).Read(payload)
+
+	bus := &fakePublisher{}
+	assert.NoError(t, opts.PublishPayload(bus, "event.nmap", payload))
+	if !assert.Greater(t, len(bus.messages), 2) {
+		return
+	}
+
+	last := bus.messages[len(bus.messages)-1]
+	assert.Equal(t, "event.nmap", last.subject, "Expected the manifest to be published last on the original subject")
+	manifest, ok := ParseChunkManifest(last.payload)
+	assert.True(t, ok)
+	assert.Equal(t, len(bus.messages)-1, manifest.TotalChunks)
+
+	r := NewReassembler(time.Minute)
+	// Deliver chunks out of order
+	chunks := bus.messages[:len(bus.messages)-1]
+	for i := len(chunks) - 1; i >= 0; i-- {
+		assert.Equal(t, "event.nmap"+ChunkSubjectSuffix, chunks[i].subject)
+		assert.LessOrEqual(t, len(chunks[i].payload), 4096)
+		assert.NoError(t, r.AddChunk(chunks[i].payload))
+	}
+
+	got, err := r.Complete(manifest)
+	assert.NoError(t, err)
+	assert.Equal(t, payload, got)
+}
+
+func TestPublishPayload_SmallPayload(t *testing.T) {
+	t.Parallel()
+	opts := Options{MaxMessageSize: 4096}
+
+	bus := &fakePublisher{}
+	payload := []byte(`{"scan_id":"1234"}`)
+	assert.NoError(t, opts.PublishPayload(bus, "event.nmap", payload))
+	if assert.Len(t, bus.messages, 1) {
+		assert.Equal(t, payload, bus.messages[0].payload)
+		_, ok := ParseChunkManifest(bus.messages[0].payload)
+		assert.False(t, ok)
+	}
+}
+
+func TestReassembler_MissingChunk(t *testing.T) {
+	t.Parallel()
+	opts := Options{MaxMessageSize: 1024}
+
+	bus := &fakePublisher{}
+	assert.NoError(t, opts.PublishPayload(bus, "event.nmap", bytes.Repeat([]byte{'a'}, 5000)))
+
+	manifest, ok := ParseChunkManifest(bus.messages[len(bus.messages)-1].payload)
+	assert.True(t, ok)
+
+	r := NewReassembler(time.Minute)
+	assert.NoError(t, r.AddChunk(bus.messages[0].payload))
+	_, err := r.Complete(manifest)
+	assert.ErrorIs(t, err, ErrIncompleteChunks)
+
+	_, err = r.Complete(ChunkManifest{TransferID: "unknown"})
+	assert.ErrorIs(t, err, ErrUnknownTransferID)
+}
+
+func TestReassembler_ConcurrentChunks(t *testing.T) {
+	t.Parallel()
+	opts := Options{MaxMessageSize: 1024}
+
+	payload := make([]byte, 20000)
+	rand.New(rand.NewSource(2)).Read(payload)
+	bus := &fakePublisher{}
+	require.NoError(t, opts.PublishPayload(bus, "event.nmap", payload))
+	manifest, ok := ParseChunkManifest(bus.messages[len(bus.messages)-1].payload)
+	require.True(t, ok)
+
+	// Manifests may arrive before the last chunks, consumers retry them
+	r := NewReassembler(time.Minute)
+	var wg sync.WaitGroup
+	for _, chunk := range bus.messages[:len(bus.messages)-1] {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, r.AddChunk(chunk.payload))
+		}()
+	}
+	var got []byte
+	for got == nil {
+		var err error
+		if got, err = r.Complete(manifest); err != nil && !errors.Is(err, ErrUnknownTransferID) {
+			require.ErrorIs(t, err, ErrIncompleteChunks)
+		}
+	}
+	wg.Wait()
+	assert.Equal(t, payload, got)
+}
@@ -0,0 +1,126 @@
+package output
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kptm-tools/common/common/pkg/enums"
+	"github.com/kptm-tools/common/common/pkg/results/tools"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/blobstore"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/failure"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/results"
+)
+
+const claimCheckKind = "claim_check"
+
+// ResultSummary is the part of a result carried inline by claim check events.
+type ResultSummary struct {
+	HostName        string                   `json:"host_name,omitempty"`
+	HostAddress     string                   `json:"host_address,omitempty"`
+	ScannedPorts    int                      `json:"scanned_ports"`
+	Vulnerabilities int                      `json:"vulnerabilities"`
+	SeverityCounts  tools.SeverityCounts     `json:"severity_counts"`
+	Dropped         *results.DroppedFindings `json:"dropped_findings,omitempty"`
+	RejectedCVEs    int                      `json:"rejected_cves,omitempty"`
+	RepeatOffender  *results.RepeatOffender  `json:"repeat_offender,omitempty"`
+	Error           *tools.ToolError         `json:"error,omitempty"`
+	ErrorCategory   failure.Category         `json:"error_category,omitempty"`
+}
+
+// ClaimCheckEvent is published instead of an oversized result. The full
+// event payload is stored in the blob store under Key.
+type ClaimCheckEvent struct {
+	Kind      string         `json:"kind"`
+	ScanID    uuid.UUID      `json:"scan_id"`
+	Tool      enums.ToolName `json:"tool_name"`
+	Summary   ResultSummary  `json:"summary"`
+	Key       string         `json:"key"`
+	Location  string         `json:"location"`
+	Size      int            `json:"size"`
+	SHA256    string         `json:"sha256"`
+	Timestamp time.Time      `json:"timestamp"`
+}
+
+// Summarize returns the summary of a host result published in claim checks.
+func Summarize(result tools.ToolResult) ResultSummary {
+	summary := ResultSummary{Error: result.Err}
+	if result.Err != nil {
+		summary.ErrorCategory = failure.CategoryOfCode(result.Err.Code)
+	}
+
+	nmapResult, ok := result.Result.(*results.NmapResult)
+	if !ok || nmapResult == nil {
+		return summary
+	}
+	summary.HostName = nmapResult.HostName
+	summary.HostAddress = nmapResult.HostAddress
+	summary.ScannedPorts = len(nmapResult.ScannedPorts)
+	summary.Vulnerabilities = nmapResult.TotalVulnerabilities() + len(nmapResult.MostLikelyOS.Vulnerabilities)
+	summary.SeverityCounts = nmapResult.SeverityCounts()
+	summary.Dropped = nmapResult.Dropped
+	summary.RejectedCVEs = nmapResult.RejectedCVEs
+	summary.RepeatOffender = nmapResult.RepeatOffender
+	return summary
+}
+
+func (o Options) publishClaimCheck(ctx context.Context, bus Publisher, subject string, scanID uuid.UUID, result tools.ToolResult, payload []byte) error {
+	if o.ClaimCheckStore == nil {
+		return &failure.PolicyError{Err: fmt.Errorf("%w: claim check store is not configured", ErrPayloadTooLarge)}
+	}
+
+	key := fmt.Sprintf("%s/%s/%s.json", scanID, result.Tool, uuid.NewString())
+	location, err := o.ClaimCheckStore.Put(ctx, key, payload, "application/json")
+	if err != nil {
+		return &failure.StorageError{Err: fmt.Errorf("failed to store claim checked payload: %w", err)}
+	}
+
+	sum := sha256.Sum256(payload)
+	msg, err := json.Marshal(ClaimCheckEvent{
+		Kind:      claimCheckKind,
+		ScanID:    scanID,
+		Tool:      result.Tool,
+		Summary:   Summarize(result),
+		Key:       key,
+		Location:  location,
+		Size:      len(payload),
+		SHA256:    hex.EncodeToString(sum[:]),
+		Timestamp: time.Now().UTC(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal claim check event: %w", err)
+	}
+	if err := bus.Publish(subject, msg); err != nil {
+		return &failure.UpstreamError{Err: err}
+	}
+	return nil
+}
+
+// ParseClaimCheck reports whether a message received on a result subject is
+// a claim check rather than the result itself.
+func ParseClaimCheck(data []byte) (ClaimCheckEvent, bool) {
+	var event ClaimCheckEvent
+	if err := json.Unmarshal(data, &event); err != nil || event.Kind != claimCheckKind {
+		return ClaimCheckEvent{}, false
+	}
+	return event, true
+}
+
+// FetchClaimed is the consumer side of the claim check: it retrieves,
+// verifies and decodes the payload referenced by event.
+func FetchClaimed(ctx context.Context, store blobstore.Store, event ClaimCheckEvent) ([]byte, error) {
+	payload, err := store.Get(ctx, event.Key)
+	if err != nil {
+		return nil, err
+	}
+
+	sum := sha256.Sum256(payload)
+	if hex.EncodeToString(sum[:]) != event.SHA256 {
+		return nil, fmt.Errorf("%w: %s", ErrChecksumMismatch, event.Key)
+	}
+	return DecodePayload(payload)
+}
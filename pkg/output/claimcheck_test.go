@@ -0,0 +1,102 @@
+package output
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/kptm-tools/common/common/pkg/enums"
+	"github.com/kptm-tools/common/common/pkg/results/tools"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/blobstore"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/failure"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/results"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func claimCheckResult() tools.ToolResult {
+	return tools.ToolResult{
+		Tool: enums.ToolNmap,
+		Result: &results.NmapResult{
+			HostName:    "example.com",
+			HostAddress: "93.184.216.34",
+			ScannedPorts: []results.PortData{{
+				ID: 80,
+				Vulnerabilities: []results.Vulnerability{{
+					Vulnerability: tools.Vulnerability{
+						ID:           "CVE-2024-0001",
+						Description:  strings.Repeat("overflow ", 1000),
+						BaseSeverity: enums.SeverityTypeHigh,
+					},
+				}},
+			}},
+		},
+	}
+}
+
+func TestPublishResult_ClaimCheck(t *testing.T) {
+	t.Parallel()
+	store, err := blobstore.NewFileStore(t.TempDir())
+	require.NoError(t, err)
+
+	opts := Options{MaxMessageSize: 1024, OversizeMode: OversizeClaimCheck, ClaimCheckStore: store}
+
+	scanID := uuid.New()
+	bus := &fakePublisher{}
+	require.NoError(t, opts.PublishResult(context.Background(), bus, "event.nmap", scanID, claimCheckResult()))
+	require.Len(t, bus.messages, 1)
+	assert.Less(t, len(bus.messages[0].payload), 1024)
+
+	event, ok := ParseClaimCheck(bus.messages[0].payload)
+	require.True(t, ok)
+	assert.Equal(t, scanID, event.ScanID)
+	assert.Equal(t, "example.com", event.Summary.HostName)
+	assert.Equal(t, 1, event.Summary.Vulnerabilities)
+	assert.Equal(t, 1, event.Summary.SeverityCounts.High)
+
+	payload, err := FetchClaimed(context.Background(), store, event)
+	require.NoError(t, err)
+	assert.Contains(t, string(payload), "CVE-2024-0001")
+}
+
+func TestPublishResult_ClaimCheckWithoutStore(t *testing.T) {
+	t.Parallel()
+	opts := Options{MaxMessageSize: 1024, OversizeMode: OversizeClaimCheck}
+
+	err := opts.PublishResult(context.Background(), &fakePublisher{}, "event.nmap", uuid.New(), claimCheckResult())
+	assert.ErrorIs(t, err, ErrPayloadTooLarge)
+	assert.Equal(t, failure.CategoryPolicy, failure.CategoryOf(err))
+}
+
+func TestPublishResult_ErrorCategory(t *testing.T) {
+	t.Parallel()
+	opts := Options{}
+
+	bus := &fakePublisher{}
+	result := tools.ToolResult{
+		Tool:   enums.ToolNmap,
+		Result: &results.NmapResult{},
+		Err:    &tools.ToolError{Code: enums.ValidationError, Message: "invalid target"},
+	}
+	require.NoError(t, opts.PublishResult(context.Background(), bus, "event.nmap", uuid.New(), result))
+	require.Len(t, bus.messages, 1)
+
+	var event struct {
+		ToolResult struct {
+			Err *tools.ToolError `json:"error"`
+		} `json:"tool_result"`
+		ErrorCategory failure.Category `json:"error_category"`
+	}
+	require.NoError(t, json.Unmarshal(bus.messages[0].payload, &event))
+	assert.Equal(t, failure.CategoryInput, event.ErrorCategory)
+	require.NotNil(t, event.ToolResult.Err)
+	assert.Equal(t, "invalid target", event.ToolResult.Err.Message)
+}
+
+func TestParseClaimCheck_RegularEvent(t *testing.T) {
+	t.Parallel()
+	_, ok := ParseClaimCheck([]byte(`{"scan_id":"x","tool_name":"nmap"}`))
+	assert.False(t, ok)
+}
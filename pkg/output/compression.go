@@ -0,0 +1,137 @@
+package output
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Encoding is the content encoding of a published payload.
+type Encoding string
+
+const (
+	EncodingIdentity Encoding = "identity"
+	EncodingGzip     Encoding = "gzip"
+	EncodingZstd     Encoding = "zstd"
+)
+
+var ErrUnsupportedEncoding = errors.New("unsupported content encoding")
+
+// ParseEncoding validates an encoding name. An empty name means identity.
+func ParseEncoding(name string) (Encoding, error) {
+	switch Encoding(name) {
+	case "", EncodingIdentity:
+		return EncodingIdentity, nil
+	case EncodingGzip, EncodingZstd:
+		return Encoding(name), nil
+	default:
+		return "", fmt.Errorf("%w: %s", ErrUnsupportedEncoding, name)
+	}
+}
+
+// Envelope wraps a compressed event payload. The event bus doesn't carry
+// message headers, so the content encoding travels with the payload.
+type Envelope struct {
+	ContentEncoding Encoding `json:"content_encoding"`
+	ContentType     string   `json:"content_type"`
+	OriginalSize    int      `json:"original_size"`
+	Payload         []byte   `json:"payload"`
+}
+
+// Compress encodes data with enc.
+func Compress(data []byte, enc Encoding) ([]byte, error) {
+	var buf bytes.Buffer
+
+	switch enc {
+	case EncodingIdentity:
+		return data, nil
+	case EncodingGzip:
+		w := gzip.NewWriter(&buf)
+		if _, err := w.Write(data); err != nil {
+			return nil, fmt.Errorf("failed to gzip payload: %w", err)
+		}
+		if err := w.Close(); err != nil {
+			return nil, fmt.Errorf("failed to gzip payload: %w", err)
+		}
+	case EncodingZstd:
+		w, err := zstd.NewWriter(&buf)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create zstd writer: %w", err)
+		}
+		if _, err := w.Write(data); err != nil {
+			w.Close()
+			return nil, fmt.Errorf("failed to zstd payload: %w", err)
+		}
+		if err := w.Close(); err != nil {
+			return nil, fmt.Errorf("failed to zstd payload: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedEncoding, enc)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// Decompress decodes data encoded with enc.
+func Decompress(data []byte, enc Encoding) ([]byte, error) {
+	switch enc {
+	case EncodingIdentity:
+		return data, nil
+	case EncodingGzip:
+		r, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read gzip payload: %w", err)
+		}
+		defer r.Close()
+		return io.ReadAll(r)
+	case EncodingZstd:
+		r, err := zstd.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read zstd payload: %w", err)
+		}
+		defer r.Close()
+		return io.ReadAll(r)
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedEncoding, enc)
+	}
+}
+
+// EncodePayload compresses an event payload into an Envelope when compression
+// is enabled and the payload is at least CompressionMinSize bytes. Smaller
+// payloads are published as-is.
+func (o Options) EncodePayload(payload []byte) ([]byte, error) {
+	if o.Compression == "" || o.Compression == EncodingIdentity || len(payload) < o.CompressionMinSize {
+		return payload, nil
+	}
+
+	compressed, err := Compress(payload, o.Compression)
+	if err != nil {
+		return nil, err
+	}
+
+	envelope, err := json.Marshal(Envelope{
+		ContentEncoding: o.Compression,
+		ContentType:     "application/json",
+		OriginalSize:    len(payload),
+		Payload:         compressed,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal payload envelope: %w", err)
+	}
+	return envelope, nil
+}
+
+// DecodePayload is the consumer side of EncodePayload: it unwraps and
+// decompresses enveloped payloads and returns any other payload unchanged.
+func DecodePayload(data []byte) ([]byte, error) {
+	var envelope Envelope
+	if err := json.Unmarshal(data, &envelope); err != nil || envelope.ContentEncoding == "" {
+		return data, nil
+	}
+	return Decompress(envelope.Payload, envelope.ContentEncoding)
+}
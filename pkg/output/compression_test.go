@@ -0,0 +1,57 @@
+package output
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncodePayload(t *testing.T) {
+	t.Parallel()
+	payload := bytes.Repeat([]byte(`{"id":"CVE-2021-44228","cvss":10},`), 1000)
+
+	for _, enc := range []Encoding{EncodingGzip, EncodingZstd} {
+		t.Run(string(enc), func(t *testing.T) {
+			opts := Options{Compression: enc, CompressionMinSize: 1024}
+
+			encoded, err := opts.EncodePayload(payload)
+			assert.NoError(t, err)
+			assert.Less(t, len(encoded), len(payload)/4, "Expected repetitive payload to compress well")
+
+			var envelope Envelope
+			assert.NoError(t, json.Unmarshal(encoded, &envelope))
+			assert.Equal(t, enc, envelope.ContentEncoding)
+			assert.Equal(t, len(payload), envelope.OriginalSize)
+
+			decoded, err := DecodePayload(encoded)
+			assert.NoError(t, err)
+			assert.Equal(t, payload, decoded)
+		})
+	}
+
+	t.Run("Below minimum size", func(t *testing.T) {
+		opts := Options{Compression: EncodingGzip, CompressionMinSize: 1 << 20}
+		encoded, err := opts.EncodePayload(payload)
+		assert.NoError(t, err)
+		assert.Equal(t, payload, encoded)
+	})
+
+	t.Run("Decode plain event", func(t *testing.T) {
+		event := []byte(`{"scan_id":"1234","tool_result":{}}`)
+		decoded, err := DecodePayload(event)
+		assert.NoError(t, err)
+		assert.Equal(t, event, decoded)
+	})
+}
+
+func TestParseEncoding(t *testing.T) {
+	t.Parallel()
+	enc, err := ParseEncoding("")
+	assert.NoError(t, err)
+	assert.Equal(t, EncodingIdentity, enc)
+
+	_, err = ParseEncoding("brotli")
+	assert.ErrorIs(t, err, ErrUnsupportedEncoding)
+}
@@ -0,0 +1,178 @@
+// Package output prepares results right before they are published, applying
+// the adjustments required by downstream consumers in a single place.
+package output
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/google/uuid"
+	cmmn "github.com/kptm-tools/common/common/pkg/events"
+	"github.com/kptm-tools/common/common/pkg/results/tools"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/blobstore"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/failure"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/results"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/tenant"
+)
+
+// Options controls how results are adjusted before publication. Its methods
+// prepare and publish results with them, the zero value publishes them
+// unchanged.
+type Options struct {
+	// MaxDescriptionLength truncates vulnerability descriptions to the given
+	// number of characters. Zero disables truncation.
+	MaxDescriptionLength int
+	// MaxVendorCommentLength truncates vendor comments. Zero disables truncation.
+	MaxVendorCommentLength int
+	// SanitizeMarkup strips HTML and markdown from free text fields.
+	SanitizeMarkup bool
+
+	// Compression is the encoding of published payloads. Empty or identity
+	// disables compression.
+	Compression Encoding
+	// CompressionMinSize is the payload size in bytes from which payloads
+	// are compressed.
+	CompressionMinSize int
+
+	// MaxMessageSize is the message size limit of the event bus. Larger
+	// payloads are handled according to OversizeMode. Zero disables the limit.
+	MaxMessageSize int
+	OversizeMode   OversizeMode
+	// ClaimCheckStore holds oversized results in the claim check mode.
+	ClaimCheckStore blobstore.Store
+
+	// SeverityRemap adjusts finding severities to the policy of each tenant.
+	SeverityRemap SeverityRemap
+	// PublicationThresholds withholds the low scored findings of each tenant.
+	PublicationThresholds PublicationThresholds
+
+	// Canonical publishes results and SBOMs as canonical JSON, with their
+	// lists in a stable order, for consumers diffing successive scans.
+	Canonical bool
+}
+
+// OversizeMode selects how results larger than the bus limit are published.
+type OversizeMode string
+
+const (
+	// OversizeChunk splits the payload in chunks followed by a manifest.
+	OversizeChunk OversizeMode = "chunk"
+	// OversizeClaimCheck stores the payload in a blob store and publishes a
+	// summary with a reference to it.
+	OversizeClaimCheck OversizeMode = "claim_check"
+)
+
+// ParseOversizeMode validates an oversize mode name. An empty name means chunk.
+func ParseOversizeMode(name string) (OversizeMode, error) {
+	switch OversizeMode(name) {
+	case "", OversizeChunk:
+		return OversizeChunk, nil
+	case OversizeClaimCheck:
+		return OversizeClaimCheck, nil
+	default:
+		return "", fmt.Errorf("unknown oversize mode: %s", name)
+	}
+}
+
+// Prepare adjusts a tool result for publication. Results of other tools are
+// returned unchanged.
+func (o Options) Prepare(ctx context.Context, result tools.ToolResult) tools.ToolResult {
+	nmapResult, ok := result.Result.(*results.NmapResult)
+	if !ok || nmapResult == nil {
+		return result
+	}
+
+	tenantID := tenant.FromContext(ctx)
+	if threshold, ok := o.PublicationThresholds[tenantID]; ok {
+		applyThreshold(threshold, nmapResult)
+	}
+
+	severityRules := o.SeverityRemap[tenantID]
+
+	forEachVulnerability(nmapResult, func(vuln *results.Vulnerability) {
+		o.prepareText(vuln)
+		remapSeverity(severityRules, vuln)
+	})
+	if o.Canonical {
+		Canonicalize(nmapResult)
+	}
+
+	return result
+}
+
+// PublishResult prepares a tool result, builds its event and publishes it,
+// compressing it and handling oversized payloads as configured.
+func (o Options) PublishResult(ctx context.Context, bus Publisher, subject string, scanID uuid.UUID, result tools.ToolResult) error {
+	result = o.Prepare(ctx, result)
+
+	payload, err := o.Marshal(newResultEvent(scanID, result))
+	if err != nil {
+		return fmt.Errorf("failed to build event: %w", err)
+	}
+	if o.OversizeMode != OversizeClaimCheck {
+		return o.PublishPayload(bus, subject, payload)
+	}
+
+	payload, err = o.EncodePayload(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode payload: %w", err)
+	}
+	if o.MaxMessageSize <= 0 || len(payload) <= o.MaxMessageSize {
+		if err := bus.Publish(subject, payload); err != nil {
+			return &failure.UpstreamError{Err: err}
+		}
+		return nil
+	}
+	return o.publishClaimCheck(ctx, bus, subject, scanID, result, payload)
+}
+
+// Marshal encodes v as JSON, canonical JSON in the canonical mode.
+func (o Options) Marshal(v any) ([]byte, error) {
+	if o.Canonical {
+		return CanonicalJSON(v)
+	}
+	return json.Marshal(v)
+}
+
+// resultEvent is the common tool result event with the category of the tool
+// error, if any.
+type resultEvent struct {
+	cmmn.ToolResultEvent
+	ErrorCategory failure.Category `json:"error_category,omitempty"`
+}
+
+func newResultEvent(scanID uuid.UUID, result tools.ToolResult) resultEvent {
+	event := resultEvent{ToolResultEvent: cmmn.NewToolResultEvent(scanID, result)}
+	if result.Err != nil {
+		event.ErrorCategory = failure.CategoryOfCode(result.Err.Code)
+	}
+	return event
+}
+
+func forEachVulnerability(result *results.NmapResult, fn func(*results.Vulnerability)) {
+	for i := range result.MostLikelyOS.Vulnerabilities {
+		fn(&result.MostLikelyOS.Vulnerabilities[i])
+	}
+	for i := range result.ScannedPorts {
+		for j := range result.ScannedPorts[i].Vulnerabilities {
+			fn(&result.ScannedPorts[i].Vulnerabilities[j])
+		}
+	}
+}
+
+// prepareText sanitizes and truncates the free text fields of vuln.
+func (o Options) prepareText(vuln *results.Vulnerability) {
+	if o.SanitizeMarkup {
+		vuln.Description = SanitizeText(vuln.Description)
+	}
+	vuln.Description = Truncate(vuln.Description, o.MaxDescriptionLength)
+
+	for i := range vuln.VendorComments {
+		comment := &vuln.VendorComments[i]
+		if o.SanitizeMarkup {
+			comment.Comment = SanitizeText(comment.Comment)
+		}
+		comment.Comment = Truncate(comment.Comment, o.MaxVendorCommentLength)
+	}
+}
@@ -0,0 +1,121 @@
+package output
+
+import (
+	"html"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+const ellipsis = "…"
+
+// htmlElements are the names of the HTML elements. SanitizeText strips every
+// tag, except those of other names written right after a word without
+// attributes, so that generics such as "List<String>" survive.
+var htmlElements = []string{
+	"a", "abbr", "address", "applet", "area", "article", "aside", "audio", "b", "base", "bdi", "bdo",
+	"blockquote", "body", "br", "button", "canvas", "caption", "center", "cite", "code", "col",
+	"colgroup", "data", "datalist", "dd", "del", "details", "dfn", "dialog", "div", "dl", "dt", "em",
+	"embed", "fieldset", "figcaption", "figure", "font", "footer", "form", "frame", "frameset", "h1",
+	"h2", "h3", "h4", "h5", "h6", "head", "header", "hr", "html", "i", "iframe", "img", "input", "ins",
+	"kbd", "label", "legend", "li", "link", "main", "map", "mark", "marquee", "math", "menu", "meta",
+	"meter", "nav", "noembed", "noframes", "noscript", "object", "ol", "optgroup", "option", "output",
+	"p", "param", "picture", "plaintext", "pre", "progress", "q", "rp", "rt", "ruby", "s", "samp",
+	"script", "section", "select", "slot", "small", "source", "span", "strike", "strong", "style",
+	"sub", "summary", "sup", "svg", "table", "tbody", "td", "template", "textarea", "tfoot", "th",
+	"thead", "time", "title", "tr", "track", "tt", "u", "ul", "var", "video", "wbr", "xmp",
+}
+
+var (
+	// htmlRawTextPattern matches the script and style elements along with
+	// their content, up to the end of text when they aren't closed.
+	htmlRawTextPattern   = regexp.MustCompile(`(?is)<(?:script|style)\b[^>]*>.*?(?:</(?:script|style)\s*>|$)`)
+	htmlCommentPattern   = regexp.MustCompile(`(?s)<!--.*?(?:-->|$)`)
+	htmlTagPattern       = regexp.MustCompile(`</?([a-zA-Z][a-zA-Z0-9:-]*)(\s[^<>]*)?/?>`)
+	markdownLinkPattern  = regexp.MustCompile(`!?\[([^\]]*)\]\(([^)\s]+)\)`)
+	markdownFencePattern = regexp.MustCompile("```[a-z]*\\n?([^`]*)```")
+	markdownCodePattern  = regexp.MustCompile("`([^`\\n]+)`")
+	markdownEmphPattern  = regexp.MustCompile(`(\*\*|\*|~~)([^\s*~](?:[^*~]*[^\s*~])?)(\*\*|\*|~~)`)
+	markdownBlockPattern = regexp.MustCompile(`(?m)^\s{0,3}(#{1,6}\s+|>\s?|[-*+]\s+)`)
+	whitespacePattern    = regexp.MustCompile(`\s+`)
+)
+
+// SanitizeText strips HTML tags and markdown syntax from text, keeping link
+// targets next to their text, and collapses whitespace. Entities are
+// unescaped first, so that escaped tags are stripped too, and script and
+// style elements are dropped with their content. Emphasis and code markers
+// are only stripped in pairs around text, literal asterisks, underscores and
+// backticks are kept.
+func SanitizeText(text string) string {
+	text = html.UnescapeString(text)
+	text = htmlRawTextPattern.ReplaceAllString(text, " ")
+	text = htmlCommentPattern.ReplaceAllString(text, " ")
+	text = stripTags(text)
+	text = markdownLinkPattern.ReplaceAllString(text, "$1 ($2)")
+	text = markdownBlockPattern.ReplaceAllString(text, "")
+	text = markdownFencePattern.ReplaceAllString(text, "$1")
+	text = markdownCodePattern.ReplaceAllString(text, "$1")
+	text = markdownEmphPattern.ReplaceAllStringFunc(text, stripEmphasis)
+	text = whitespacePattern.ReplaceAllString(text, " ")
+	return strings.TrimSpace(text)
+}
+
+// stripTags replaces the HTML tags of text with spaces, keeping the generics
+// htmlElements describes.
+func stripTags(text string) string {
+	var b strings.Builder
+	last := 0
+	for _, m := range htmlTagPattern.FindAllStringSubmatchIndex(text, -1) {
+		if isGeneric(text, m) {
+			continue
+		}
+		b.WriteString(text[last:m[0]])
+		b.WriteByte(' ')
+		last = m[1]
+	}
+	b.WriteString(text[last:])
+	return b.String()
+}
+
+// isGeneric reports whether the tag matched at m is rather a type parameter,
+// such as the one of "List<String>": an opening tag without attributes,
+// right after a word, whose name isn't an HTML element.
+func isGeneric(text string, m []int) bool {
+	if m[0] == 0 || text[m[0]+1] == '/' || m[4] >= 0 || text[m[1]-2] == '/' {
+		return false
+	}
+	prev := text[m[0]-1]
+	if !(prev == '_' || prev >= '0' && prev <= '9' || prev >= 'a' && prev <= 'z' || prev >= 'A' && prev <= 'Z') {
+		return false
+	}
+	return !slices.Contains(htmlElements, strings.ToLower(text[m[2]:m[3]]))
+}
+
+// stripEmphasis removes the markers around emphasized text, when the opening
+// and closing ones are the same.
+func stripEmphasis(match string) string {
+	m := markdownEmphPattern.FindStringSubmatch(match)
+	if m[1] != m[3] {
+		return match
+	}
+	return m[2]
+}
+
+// Truncate shortens text to at most max characters, ending it with an
+// ellipsis when it was cut. A max <= 0 leaves text untouched.
+func Truncate(text string, max int) string {
+	if max <= 0 || utf8.RuneCountInString(text) <= max {
+		return text
+	}
+	if max <= utf8.RuneCountInString(ellipsis) {
+		return string([]rune(text)[:max])
+	}
+
+	runes := []rune(text)[:max-utf8.RuneCountInString(ellipsis)]
+	// Avoid cutting in the middle of a word when a space is close enough
+	if i := strings.LastIndexByte(string(runes), ' '); i > 0 && len(string(runes))-i < 20 {
+		return strings.TrimRight(string(runes)[:i], " ") + ellipsis
+	}
+	return string(runes) + ellipsis
+}
@@ -0,0 +1,105 @@
+package output
+
+import (
+	"testing"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSanitizeText(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{
+			name:  "Plain text",
+			input: "Buffer overflow in the parser.",
+			want:  "Buffer overflow in the parser.",
+		},
+		{
+			name:  "HTML tags and entities",
+			input: "<p>Affects <b>versions</b> &lt; 2.0</p>\n<br/>Upgrade now",
+			want:  "Affects versions < 2.0 Upgrade now",
+		},
+		{
+			name:  "Markdown",
+			input: "## Impact\n\n* **Remote** code execution via `eval`\n> see [advisory](https://example.com/a)",
+			want:  "Impact Remote code execution via eval see advisory (https://example.com/a)",
+		},
+		{
+			name:  "Version comparisons",
+			input: "Affects versions < 2.0 and > 1.0, and <=1.4 or >1.6",
+			want:  "Affects versions < 2.0 and > 1.0, and <=1.4 or >1.6",
+		},
+		{
+			name:  "Angle brackets without a tag name",
+			input: "<p>Deserializing a List<String> of Map<K, V> in version <3.1</p>",
+			want:  "Deserializing a List<String> of Map<K, V> in version <3.1",
+		},
+		{
+			name:  "Script and iframe",
+			input: "Crafted <script>alert(1)</script>input, see <iframe src=x></iframe>the advisory",
+			want:  "Crafted input, see the advisory",
+		},
+		{
+			name:  "Escaped script and iframe",
+			input: "Crafted &lt;script&gt;alert(1)&lt;/script&gt;input, see &lt;iframe src=x&gt;&lt;/iframe&gt;the advisory",
+			want:  "Crafted input, see the advisory",
+		},
+		{
+			name:  "Unclosed script",
+			input: "Crafted input<SCRIPT type=\"text/javascript\">alert(1)",
+			want:  "Crafted input",
+		},
+		{
+			name:  "Style and unknown elements",
+			input: "<style>p { color: red }</style><custom-tag x=1>Stored XSS</custom-tag> in the <svg onload=alert(1)>editor",
+			want:  "Stored XSS in the editor",
+		},
+		{
+			name:  "Element right after a word",
+			input: "Injection via a<img src=x onerror=alert(1)> payload",
+			want:  "Injection via a payload",
+		},
+		{
+			name:  "Literal asterisks, underscores and backticks",
+			input: "Overflow in __init__ when a * b exceeds *.conf limits, see the ` character",
+			want:  "Overflow in __init__ when a * b exceeds *.conf limits, see the ` character",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, SanitizeText(tc.input))
+		})
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		name  string
+		input string
+		max   int
+		want  string
+	}{
+		{name: "Disabled", input: "some description", max: 0, want: "some description"},
+		{name: "Short enough", input: "short", max: 10, want: "short"},
+		{name: "Cut at word boundary", input: "remote code execution", max: 15, want: "remote code…"},
+		{name: "Multibyte", input: "ééééé", max: 3, want: "éé…"},
+		{name: "Tiny limit", input: "abcdef", max: 1, want: "a"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := Truncate(tc.input, tc.max)
+			assert.Equal(t, tc.want, got)
+			if tc.max > 0 {
+				assert.LessOrEqual(t, utf8.RuneCountInString(got), tc.max)
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package output
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+
+	"github.com/kptm-tools/common/common/pkg/enums"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/results"
+)
+
+// SeverityRule remaps the severity of the findings matching every condition
+// that is set. Rules of a policy are evaluated in order, the first match wins.
+type SeverityRule struct {
+	Name string `json:"name"`
+	// From restricts the rule to findings with one of these severities.
+	From []enums.SeverityType `json:"from,omitempty"`
+	// PublicExploit restricts the rule to findings with a known exploit: in
+	// the CISA KEV catalog, with references tagged as exploits, or with an
+	// exploit code maturity from proof of concept to high.
+	PublicExploit bool `json:"public_exploit,omitempty"`
+	// MinCVSS restricts the rule to findings with a base score at least as high.
+	MinCVSS float64 `json:"min_cvss,omitempty"`
+
+	Severity enums.SeverityType `json:"severity"`
+}
+
+// SeverityRemap holds the severity rules of each tenant.
+type SeverityRemap map[string][]SeverityRule
+
+// LoadSeverityRemap reads per-tenant severity rules from a JSON file mapping
+// tenant IDs to their list of rules.
+func LoadSeverityRemap(path string) (SeverityRemap, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read severity remap: %w", err)
+	}
+
+	var remap SeverityRemap
+	if err := json.Unmarshal(data, &remap); err != nil {
+		return nil, fmt.Errorf("failed to decode severity remap: %w", err)
+	}
+	for tenantID, rules := range remap {
+		for i, rule := range rules {
+			if err := validateSeverity(rule.Severity); err != nil {
+				return nil, fmt.Errorf("severity rule %d of tenant %s: %w", i, tenantID, err)
+			}
+			for _, from := range rule.From {
+				if err := validateSeverity(from); err != nil {
+					return nil, fmt.Errorf("severity rule %d of tenant %s: %w", i, tenantID, err)
+				}
+			}
+		}
+	}
+	return remap, nil
+}
+
+func validateSeverity(s enums.SeverityType) error {
+	switch s {
+	case enums.SeverityTypeCritical, enums.SeverityTypeHigh, enums.SeverityTypeMedium,
+		enums.SeverityTypeLow, enums.SeverityTypeNone:
+		return nil
+	default:
+		return fmt.Errorf("invalid severity '%s'", s)
+	}
+}
+
+func (r SeverityRule) matches(vuln *results.Vulnerability) bool {
+	if len(r.From) > 0 && !slices.Contains(r.From, vuln.BaseSeverity) {
+		return false
+	}
+	if r.PublicExploit && !hasPublicExploit(vuln) {
+		return false
+	}
+	if r.MinCVSS > 0 && vuln.BaseCVSSScore < r.MinCVSS {
+		return false
+	}
+	return true
+}
+
+func hasPublicExploit(vuln *results.Vulnerability) bool {
+	if vuln.KnownExploited || len(vuln.ExploitReferences) > 0 {
+		return true
+	}
+	switch vuln.Exploit.Exploitability {
+	case enums.ExploitabilityTypeProofOfConcept, enums.ExploitabilityTypeFunctional, enums.ExploitabilityTypeHigh:
+		return true
+	default:
+		return false
+	}
+}
+
+// remapSeverity applies the first matching rule to vuln. The NVD severity is
+// kept in the provenance of the finding.
+func remapSeverity(rules []SeverityRule, vuln *results.Vulnerability) {
+	for _, rule := range rules {
+		if !rule.matches(vuln) {
+			continue
+		}
+		if rule.Severity == vuln.BaseSeverity {
+			return
+		}
+
+		if vuln.Provenance == nil {
+			vuln.Provenance = &results.Provenance{}
+		}
+		vuln.Provenance.OriginalSeverity = vuln.BaseSeverity
+		vuln.Provenance.SeverityRule = rule.Name
+		vuln.BaseSeverity = rule.Severity
+		return
+	}
+}
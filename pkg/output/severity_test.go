@@ -0,0 +1,90 @@
+package output
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/kptm-tools/common/common/pkg/enums"
+	"github.com/kptm-tools/common/common/pkg/results/tools"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/results"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/tenant"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrepare_SeverityRemap(t *testing.T) {
+	t.Parallel()
+	opts := Options{SeverityRemap: SeverityRemap{
+		"acme": {
+			{Name: "exploited-is-critical", PublicExploit: true, Severity: enums.SeverityTypeCritical},
+			{Name: "no-low", From: []enums.SeverityType{enums.SeverityTypeLow}, Severity: enums.SeverityTypeMedium},
+		},
+	}}
+
+	newResult := func() *results.NmapResult {
+		return &results.NmapResult{ScannedPorts: []results.PortData{{Vulnerabilities: []results.Vulnerability{
+			{
+				Vulnerability: tools.Vulnerability{
+					BaseSeverity: enums.SeverityTypeMedium,
+					Exploit:      tools.Exploit{Exploitability: enums.ExploitabilityTypeFunctional},
+				},
+				Provenance: &results.Provenance{Source: "nvd"},
+			},
+			{Vulnerability: tools.Vulnerability{BaseSeverity: enums.SeverityTypeLow}},
+			{Vulnerability: tools.Vulnerability{
+				BaseSeverity: enums.SeverityTypeHigh,
+				Exploit:      tools.Exploit{Exploitability: enums.ExploitabilityTypeUnproven},
+			}},
+			{
+				Vulnerability:  tools.Vulnerability{BaseSeverity: enums.SeverityTypeHigh},
+				KnownExploited: true,
+			},
+			{
+				Vulnerability:     tools.Vulnerability{BaseSeverity: enums.SeverityTypeMedium},
+				ExploitReferences: []string{"https://www.exploit-db.com/exploits/50383"},
+			},
+		}}}}
+	}
+
+	// Other tenants keep the NVD severities
+	other := newResult()
+	opts.Prepare(tenant.WithID(context.Background(), "globex"), tools.ToolResult{Result: other})
+	assert.Equal(t, enums.SeverityTypeMedium, other.ScannedPorts[0].Vulnerabilities[0].BaseSeverity)
+
+	acme := newResult()
+	opts.Prepare(tenant.WithID(context.Background(), "acme"), tools.ToolResult{Result: acme})
+	vulns := acme.ScannedPorts[0].Vulnerabilities
+
+	assert.Equal(t, enums.SeverityTypeCritical, vulns[0].BaseSeverity)
+	assert.Equal(t, "nvd", vulns[0].Provenance.Source)
+	assert.Equal(t, enums.SeverityTypeMedium, vulns[0].Provenance.OriginalSeverity)
+	assert.Equal(t, "exploited-is-critical", vulns[0].Provenance.SeverityRule)
+
+	assert.Equal(t, enums.SeverityTypeMedium, vulns[1].BaseSeverity)
+	assert.Equal(t, enums.SeverityTypeLow, vulns[1].Provenance.OriginalSeverity)
+
+	assert.Equal(t, enums.SeverityTypeHigh, vulns[2].BaseSeverity)
+	assert.Nil(t, vulns[2].Provenance)
+
+	// KEV listed CVEs and exploit references count as public exploits
+	assert.Equal(t, enums.SeverityTypeCritical, vulns[3].BaseSeverity)
+	assert.Equal(t, enums.SeverityTypeCritical, vulns[4].BaseSeverity)
+}
+
+func TestLoadSeverityRemap(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+
+	valid := filepath.Join(dir, "valid.json")
+	require.NoError(t, os.WriteFile(valid, []byte(`{"acme":[{"name":"exploited","public_exploit":true,"severity":"Critical"}]}`), 0o644))
+	remap, err := LoadSeverityRemap(valid)
+	require.NoError(t, err)
+	assert.Equal(t, enums.SeverityTypeCritical, remap["acme"][0].Severity)
+
+	invalid := filepath.Join(dir, "invalid.json")
+	require.NoError(t, os.WriteFile(invalid, []byte(`{"acme":[{"severity":"Urgent"}]}`), 0o644))
+	_, err = LoadSeverityRemap(invalid)
+	assert.Error(t, err)
+}
@@ -0,0 +1,116 @@
+package output
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/kptm-tools/common/common/pkg/results/tools"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/results"
+)
+
+// PublicationThreshold withholds findings scored below every threshold that
+// is set: a finding is published when its CVSS base score reaches MinCVSS or
+// its EPSS probability reaches MinEPSS. The likelihood of findings without an
+// EPSS probability is unknown, they are held to MinCVSS alone and published
+// when it isn't set.
+type PublicationThreshold struct {
+	MinCVSS float64 `json:"min_cvss,omitempty"`
+	MinEPSS float64 `json:"min_epss,omitempty"`
+}
+
+// PublicationThresholds holds the publication threshold of each tenant.
+type PublicationThresholds map[string]PublicationThreshold
+
+// LoadPublicationThresholds reads per-tenant publication thresholds from a
+// JSON file mapping tenant IDs to their threshold.
+func LoadPublicationThresholds(path string) (PublicationThresholds, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read publication thresholds: %w", err)
+	}
+
+	var thresholds PublicationThresholds
+	if err := json.Unmarshal(data, &thresholds); err != nil {
+		return nil, fmt.Errorf("failed to decode publication thresholds: %w", err)
+	}
+	for tenantID, t := range thresholds {
+		if t.MinCVSS < 0 || t.MinCVSS > 10 {
+			return nil, fmt.Errorf("publication threshold of tenant %s: min_cvss %v is not between 0 and 10", tenantID, t.MinCVSS)
+		}
+		if t.MinEPSS < 0 || t.MinEPSS > 1 {
+			return nil, fmt.Errorf("publication threshold of tenant %s: min_epss %v is not between 0 and 1", tenantID, t.MinEPSS)
+		}
+	}
+	return thresholds, nil
+}
+
+func (t PublicationThreshold) allows(vuln *results.Vulnerability) bool {
+	if t.MinCVSS <= 0 && t.MinEPSS <= 0 {
+		return true
+	}
+	if t.MinCVSS > 0 && vuln.BaseCVSSScore >= t.MinCVSS {
+		return true
+	}
+	if t.MinEPSS <= 0 {
+		return false
+	}
+	if vuln.EPSS == nil {
+		return t.MinCVSS <= 0
+	}
+	return *vuln.EPSS >= t.MinEPSS
+}
+
+// applyThreshold removes the findings of result below threshold and records
+// how many were dropped, by severity.
+func applyThreshold(threshold PublicationThreshold, result *results.NmapResult) {
+	var dropped []results.Vulnerability
+	keep := func(vulns []results.Vulnerability) []results.Vulnerability {
+		kept := vulns[:0]
+		for _, vuln := range vulns {
+			if threshold.allows(&vuln) {
+				kept = append(kept, vuln)
+			} else {
+				dropped = append(dropped, vuln)
+			}
+		}
+		return kept
+	}
+
+	result.MostLikelyOS.Vulnerabilities = keep(result.MostLikelyOS.Vulnerabilities)
+	for i := range result.ScannedPorts {
+		result.ScannedPorts[i].Vulnerabilities = keep(result.ScannedPorts[i].Vulnerabilities)
+	}
+	if result.Diff != nil {
+		// The diff is built on every finding, it mustn't reveal the withheld ones
+		result.Diff.New = keepDiff(threshold, result.Diff.New)
+		result.Diff.Fixed = keepDiff(threshold, result.Diff.Fixed)
+		result.Diff.Persistent = keepDiff(threshold, result.Diff.Persistent)
+	}
+	if len(dropped) == 0 {
+		return
+	}
+
+	result.Dropped = &results.DroppedFindings{
+		Total:          len(dropped),
+		SeverityCounts: tools.GetSeverityCounts(results.Common(dropped)),
+	}
+	slog.Info("Withheld findings below the publication threshold",
+		slog.String("host_address", result.HostAddress),
+		slog.Int("dropped", len(dropped)),
+		slog.Float64("min_cvss", threshold.MinCVSS),
+		slog.Float64("min_epss", threshold.MinEPSS))
+}
+
+// keepDiff removes the findings of a diff below threshold.
+func keepDiff(threshold PublicationThreshold, findings []results.DiffFinding) []results.DiffFinding {
+	kept := findings[:0]
+	for _, f := range findings {
+		vuln := results.Vulnerability{Vulnerability: tools.Vulnerability{ID: f.CVE, BaseCVSSScore: f.CVSSScore}, EPSS: f.EPSS}
+		if threshold.allows(&vuln) {
+			kept = append(kept, f)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,129 @@
+package output
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/kptm-tools/common/common/pkg/enums"
+	"github.com/kptm-tools/common/common/pkg/results/tools"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/results"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/tenant"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrepare_PublicationThresholds(t *testing.T) {
+	t.Parallel()
+	opts := Options{PublicationThresholds: PublicationThresholds{
+		"acme": {MinCVSS: 4.0, MinEPSS: 0.01},
+	}}
+
+	epss := func(p float64) *float64 { return &p }
+	newResult := func() *results.NmapResult {
+		return &results.NmapResult{
+			MostLikelyOS: results.OSData{Vulnerabilities: []results.Vulnerability{
+				{Vulnerability: tools.Vulnerability{ID: "CVE-OS-LOW", BaseCVSSScore: 2.1, BaseSeverity: enums.SeverityTypeLow}},
+			}},
+			ScannedPorts: []results.PortData{{Vulnerabilities: []results.Vulnerability{
+				{Vulnerability: tools.Vulnerability{ID: "CVE-HIGH", BaseCVSSScore: 7.5, BaseSeverity: enums.SeverityTypeHigh}},
+				{Vulnerability: tools.Vulnerability{ID: "CVE-LOW", BaseCVSSScore: 3.1, BaseSeverity: enums.SeverityTypeLow}},
+				{Vulnerability: tools.Vulnerability{ID: "CVE-EXPLOITED", BaseCVSSScore: 3.1, BaseSeverity: enums.SeverityTypeLow}, EPSS: epss(0.2)},
+				{Vulnerability: tools.Vulnerability{ID: "CVE-UNLIKELY", BaseCVSSScore: 0, BaseSeverity: enums.SeverityTypeNone}, EPSS: epss(0.001)},
+			}}},
+		}
+	}
+
+	// Other tenants receive every finding
+	other := newResult()
+	opts.Prepare(tenant.WithID(context.Background(), "globex"), tools.ToolResult{Result: other})
+	assert.Len(t, other.ScannedPorts[0].Vulnerabilities, 4)
+	assert.Nil(t, other.Dropped)
+
+	acme := newResult()
+	opts.Prepare(tenant.WithID(context.Background(), "acme"), tools.ToolResult{Result: acme})
+
+	var ids []string
+	for _, vuln := range acme.ScannedPorts[0].Vulnerabilities {
+		ids = append(ids, vuln.ID)
+	}
+	assert.Equal(t, []string{"CVE-HIGH", "CVE-EXPLOITED"}, ids)
+	assert.Empty(t, acme.MostLikelyOS.Vulnerabilities)
+
+	require.NotNil(t, acme.Dropped)
+	assert.Equal(t, 3, acme.Dropped.Total)
+	assert.Equal(t, 2, acme.Dropped.SeverityCounts.Low)
+	assert.Equal(t, 1, acme.Dropped.SeverityCounts.None)
+
+	summary := Summarize(tools.ToolResult{Result: acme})
+	assert.Equal(t, acme.Dropped, summary.Dropped)
+}
+
+func TestPrepare_PublicationThresholdsEPSSOnly(t *testing.T) {
+	t.Parallel()
+	opts := Options{PublicationThresholds: PublicationThresholds{"acme": {MinEPSS: 0.1}}}
+
+	epss := func(p float64) *float64 { return &p }
+	result := &results.NmapResult{
+		ScannedPorts: []results.PortData{{Vulnerabilities: []results.Vulnerability{
+			{Vulnerability: tools.Vulnerability{ID: "CVE-UNSCORED", BaseCVSSScore: 9.8, BaseSeverity: enums.SeverityTypeCritical}},
+			{Vulnerability: tools.Vulnerability{ID: "CVE-EXPLOITED", BaseCVSSScore: 5.3, BaseSeverity: enums.SeverityTypeMedium}, EPSS: epss(0.4)},
+			{Vulnerability: tools.Vulnerability{ID: "CVE-UNLIKELY", BaseCVSSScore: 5.3, BaseSeverity: enums.SeverityTypeMedium}, EPSS: epss(0.001)},
+		}}},
+	}
+	opts.Prepare(tenant.WithID(context.Background(), "acme"), tools.ToolResult{Result: result})
+
+	var ids []string
+	for _, vuln := range result.ScannedPorts[0].Vulnerabilities {
+		ids = append(ids, vuln.ID)
+	}
+	assert.Equal(t, []string{"CVE-UNSCORED", "CVE-EXPLOITED"}, ids, "Expected findings without EPSS not to be withheld")
+	require.NotNil(t, result.Dropped)
+	assert.Equal(t, 1, result.Dropped.Total)
+}
+
+func TestPrepare_PublicationThresholdsDiff(t *testing.T) {
+	t.Parallel()
+	opts := Options{PublicationThresholds: PublicationThresholds{"acme": {MinCVSS: 7.0}}}
+
+	high := results.DiffFinding{CVE: "CVE-HIGH", Port: 22, Protocol: "tcp", Severity: enums.SeverityTypeHigh, CVSSScore: 7.5}
+	low := results.DiffFinding{CVE: "CVE-LOW", Port: 22, Protocol: "tcp", Severity: enums.SeverityTypeLow, CVSSScore: 3.1}
+	result := &results.NmapResult{
+		ScannedPorts: []results.PortData{{ID: 22, Protocol: "tcp", Vulnerabilities: []results.Vulnerability{
+			{Vulnerability: tools.Vulnerability{ID: "CVE-HIGH", BaseCVSSScore: 7.5, BaseSeverity: enums.SeverityTypeHigh}},
+			{Vulnerability: tools.Vulnerability{ID: "CVE-LOW", BaseCVSSScore: 3.1, BaseSeverity: enums.SeverityTypeLow}},
+		}}},
+		Diff: &results.ScanDiff{
+			New:        []results.DiffFinding{low},
+			Fixed:      []results.DiffFinding{{CVE: "CVE-FIXED-LOW", CVSSScore: 2.0}},
+			Persistent: []results.DiffFinding{high},
+		},
+	}
+
+	opts.Prepare(tenant.WithID(context.Background(), "acme"), tools.ToolResult{Result: result})
+	assert.Empty(t, result.Diff.New, "Expected the withheld finding not to be reported as new")
+	assert.Empty(t, result.Diff.Fixed)
+	assert.Equal(t, []results.DiffFinding{high}, result.Diff.Persistent)
+}
+
+func TestLoadPublicationThresholds(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+
+	valid := filepath.Join(dir, "valid.json")
+	require.NoError(t, os.WriteFile(valid, []byte(`{"acme":{"min_cvss":4,"min_epss":0.01}}`), 0o644))
+	thresholds, err := LoadPublicationThresholds(valid)
+	require.NoError(t, err)
+	assert.Equal(t, PublicationThreshold{MinCVSS: 4, MinEPSS: 0.01}, thresholds["acme"])
+
+	for name, body := range map[string]string{
+		"cvss": `{"acme":{"min_cvss":11}}`,
+		"epss": `{"acme":{"min_epss":2}}`,
+	} {
+		invalid := filepath.Join(dir, name+".json")
+		require.NoError(t, os.WriteFile(invalid, []byte(body), 0o644))
+		_, err = LoadPublicationThresholds(invalid)
+		assert.Error(t, err, name)
+	}
+}
@@ -0,0 +1,164 @@
+package psirt
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	nvdcpe "github.com/kptm-tools/vulnerability-analysis/nvd/cpe"
+)
+
+// CiscoConnector queries the Cisco PSIRT openVuln API. Operating systems with
+// a known version are looked up by OS type and version, which only returns
+// the advisories affecting that release; other products by product name.
+type CiscoConnector struct {
+	BaseURL string // Defaults to https://apix.cisco.com/security/advisories/v2
+	Token   string // OAuth2 access token of the openVuln API, see ReplaceToken
+	client  *http.Client
+
+	mu sync.RWMutex
+}
+
+var _ Connector = (*CiscoConnector)(nil)
+
+func NewCiscoConnector(token string) *CiscoConnector {
+	return &CiscoConnector{
+		BaseURL: "https://apix.cisco.com/security/advisories/v2",
+		Token:   token,
+		client:  newHTTPClient(),
+	}
+}
+
+// ReplaceToken swaps the access token of the connector, e.g. once a secret
+// was rotated.
+func (c *CiscoConnector) ReplaceToken(token string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.Token = token
+}
+
+func (c *CiscoConnector) token() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.Token
+}
+
+func (c *CiscoConnector) Vendor() string {
+	return "cisco"
+}
+
+// ciscoOSTypes maps CPE products to the OS types of the openVuln API.
+var ciscoOSTypes = map[string]string{
+	"ios":                                  "ios",
+	"ios_xe":                               "iosxe",
+	"nx-os":                                "nxos",
+	"adaptive_security_appliance_software": "asa",
+	"firepower_threat_defense":             "ftd",
+	"firepower_management_center":          "fmc",
+	"fxos":                                 "fxos",
+}
+
+// Lookup queries the advisories of the OS release of cpe, or those of its
+// product, keeping the ones whose product names or summary cover its version.
+func (c *CiscoConnector) Lookup(ctx context.Context, cpe CPE) ([]Advisory, error) {
+	endpoint := c.BaseURL + "/product?product=" + url.QueryEscape(strings.ReplaceAll(cpe.Product, "_", " "))
+	byRelease := false
+	if osType, ok := ciscoOSTypes[cpe.Product]; ok && cpe.Part == "o" && cpe.Version != "" {
+		endpoint = c.BaseURL + "/OSType/" + osType + "?version=" + url.QueryEscape(cpe.Version)
+		byRelease = true
+	}
+
+	headers := map[string]string{"Accept": "application/json"}
+	if token := c.token(); token != "" {
+		headers["Authorization"] = "Bearer " + token
+	}
+	body, err := fetchBody(ctx, c.client, endpoint, headers)
+	if errors.Is(err, errNoAdvisories) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var response struct {
+		Advisories []struct {
+			AdvisoryID     string   `json:"advisoryId"`
+			AdvisoryTitle  string   `json:"advisoryTitle"`
+			CVEs           []string `json:"cves"`
+			CVSSBaseScore  string   `json:"cvssBaseScore"`
+			SIR            string   `json:"sir"`
+			FirstPublished string   `json:"firstPublished"`
+			PublicationURL string   `json:"publicationUrl"`
+			ProductNames   []string `json:"productNames"`
+			Summary        string   `json:"summary"`
+		} `json:"advisories"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, fmt.Errorf("failed to decode Cisco advisories: %w", err)
+	}
+
+	advisories := make([]Advisory, 0, len(response.Advisories))
+	for _, a := range response.Advisories {
+		// The OS type query only returns the advisories of the release
+		if !byRelease && !ciscoAffectsVersion(a.ProductNames, a.Summary, cpe.Version) {
+			continue
+		}
+		advisory := Advisory{
+			ID:       a.AdvisoryID,
+			Vendor:   c.Vendor(),
+			Title:    a.AdvisoryTitle,
+			URL:      a.PublicationURL,
+			Severity: a.SIR,
+		}
+		for _, id := range a.CVEs {
+			// Advisories without CVE list "NA"
+			if cvePattern.MatchString(id) {
+				advisory.CVEs = append(advisory.CVEs, id)
+			}
+		}
+		advisory.CVSSScore, _ = strconv.ParseFloat(a.CVSSBaseScore, 64)
+		advisory.Published = parseCiscoTime(a.FirstPublished)
+		advisories = append(advisories, advisory)
+	}
+	return advisories, nil
+}
+
+// ciscoVersionRe matches the version ending a product name, e.g. 15.2(4)M of
+// "Cisco IOS 15.2(4)M".
+var ciscoVersionRe = regexp.MustCompile(`(?m)\s[vV]?(\d+(?:\.[0-9a-zA-Z()]+)+)\s*$`)
+
+// ciscoAffectsVersion reports whether an advisory covers version: one of its
+// product names ends with it, or they or the summary state a range covering
+// it. Advisories stating no version at all are kept.
+func ciscoAffectsVersion(productNames []string, summary, version string) bool {
+	version = trimVersion(version)
+	if version == "" {
+		return true
+	}
+	names := strings.Join(productNames, "\n")
+	listed := ciscoVersionRe.FindAllStringSubmatch(names, -1)
+	for _, m := range listed {
+		if nvdcpe.CompareVersions(m[1], version) == 0 {
+			return true
+		}
+	}
+	covered, stated := rangesCover(names+"\n"+summary, version)
+	return covered || (!stated && len(listed) == 0)
+}
+
+// parseCiscoTime parses openVuln timestamps, which may omit the time zone.
+func parseCiscoTime(s string) time.Time {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t
+	}
+	t, _ := time.Parse("2006-01-02T15:04:05", s)
+	return t
+}
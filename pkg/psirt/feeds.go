@@ -0,0 +1,146 @@
+package psirt
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// FortinetConnector matches products against the FortiGuard PSIRT RSS feed.
+// Each item covers one advisory and names the affected products, version
+// ranges and CVEs in its description.
+type FortinetConnector struct {
+	FeedURL string // Defaults to https://filestore.fortinet.com/fortiguard/rss/ir.xml
+	client  *http.Client
+	cache   feedCache
+}
+
+var _ Connector = (*FortinetConnector)(nil)
+
+func NewFortinetConnector(ttl time.Duration) *FortinetConnector {
+	return &FortinetConnector{
+		FeedURL: "https://filestore.fortinet.com/fortiguard/rss/ir.xml",
+		client:  newHTTPClient(),
+		cache:   feedCache{ttl: ttl},
+	}
+}
+
+func (c *FortinetConnector) Vendor() string {
+	return "fortinet"
+}
+
+func (c *FortinetConnector) Lookup(ctx context.Context, cpe CPE) ([]Advisory, error) {
+	entries, err := c.cache.get(ctx, c.fetch)
+	if err != nil {
+		return nil, err
+	}
+	return matchEntries(entries, cpe), nil
+}
+
+func (c *FortinetConnector) fetch(ctx context.Context) ([]feedEntry, error) {
+	body, err := fetchBody(ctx, c.client, c.FeedURL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var feed struct {
+		Items []struct {
+			Title       string `xml:"title"`
+			Link        string `xml:"link"`
+			Description string `xml:"description"`
+			PubDate     string `xml:"pubDate"`
+		} `xml:"channel>item"`
+	}
+	if err := xml.Unmarshal(body, &feed); err != nil {
+		return nil, fmt.Errorf("failed to decode FortiGuard PSIRT feed: %w", err)
+	}
+
+	entries := make([]feedEntry, 0, len(feed.Items))
+	for _, item := range feed.Items {
+		advisory := Advisory{
+			ID:     item.Link[strings.LastIndex(item.Link, "/")+1:],
+			Vendor: c.Vendor(),
+			Title:  item.Title,
+			URL:    item.Link,
+			CVEs:   extractCVEIDs(item.Title + " " + item.Description),
+		}
+		advisory.Published, _ = time.Parse(time.RFC1123Z, item.PubDate)
+		entries = append(entries, feedEntry{Advisory: advisory, text: item.Title + " " + item.Description})
+	}
+	return entries, nil
+}
+
+// SiemensConnector matches products against the Siemens ProductCERT Atom
+// feed, whose entries list the affected products, version ranges and CVEs of
+// each security advisory (SSA).
+type SiemensConnector struct {
+	FeedURL string // Defaults to https://cert-portal.siemens.com/productcert/rss/advisories.atom
+	client  *http.Client
+	cache   feedCache
+}
+
+var _ Connector = (*SiemensConnector)(nil)
+
+func NewSiemensConnector(ttl time.Duration) *SiemensConnector {
+	return &SiemensConnector{
+		FeedURL: "https://cert-portal.siemens.com/productcert/rss/advisories.atom",
+		client:  newHTTPClient(),
+		cache:   feedCache{ttl: ttl},
+	}
+}
+
+func (c *SiemensConnector) Vendor() string {
+	return "siemens"
+}
+
+func (c *SiemensConnector) Lookup(ctx context.Context, cpe CPE) ([]Advisory, error) {
+	entries, err := c.cache.get(ctx, c.fetch)
+	if err != nil {
+		return nil, err
+	}
+	return matchEntries(entries, cpe), nil
+}
+
+func (c *SiemensConnector) fetch(ctx context.Context) ([]feedEntry, error) {
+	body, err := fetchBody(ctx, c.client, c.FeedURL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var feed struct {
+		Entries []struct {
+			ID    string `xml:"id"`
+			Title string `xml:"title"`
+			Link  struct {
+				Href string `xml:"href,attr"`
+			} `xml:"link"`
+			Updated string `xml:"updated"`
+			Summary string `xml:"summary"`
+			Content string `xml:"content"`
+		} `xml:"entry"`
+	}
+	if err := xml.Unmarshal(body, &feed); err != nil {
+		return nil, fmt.Errorf("failed to decode Siemens ProductCERT feed: %w", err)
+	}
+
+	entries := make([]feedEntry, 0, len(feed.Entries))
+	for _, entry := range feed.Entries {
+		text := entry.Title + " " + entry.Summary + " " + entry.Content
+		advisory := Advisory{
+			ID:     ssaPattern.FindString(entry.Title + " " + entry.ID),
+			Vendor: c.Vendor(),
+			Title:  entry.Title,
+			URL:    entry.Link.Href,
+			CVEs:   extractCVEIDs(text),
+		}
+		if advisory.ID == "" {
+			advisory.ID = entry.ID
+		}
+		advisory.Published, _ = time.Parse(time.RFC3339, entry.Updated)
+		entries = append(entries, feedEntry{Advisory: advisory, text: text})
+	}
+	return entries, nil
+}
@@ -0,0 +1,239 @@
+// Package psirt looks up the security advisories published by device vendors
+// for hardware and firmware CPEs. NVD configurations for network gear are
+// often incomplete, so these feeds surface CVEs a CPE match would miss.
+package psirt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrUnknownConnector = errors.New("unknown PSIRT connector")
+
+// Advisory is a vendor security advisory affecting a product.
+type Advisory struct {
+	ID        string
+	Vendor    string
+	Title     string
+	URL       string
+	CVEs      []string
+	Severity  string // Vendor rating, e.g. High
+	CVSSScore float64
+	Published time.Time
+}
+
+// Connector looks up the advisories of one vendor.
+type Connector interface {
+	// Vendor is the CPE vendor the connector covers, e.g. cisco.
+	Vendor() string
+	Lookup(ctx context.Context, cpe CPE) ([]Advisory, error)
+}
+
+// CPE holds the fields of a CPE 2.3 name used to query vendor feeds.
+type CPE struct {
+	Part    string
+	Vendor  string
+	Product string
+	Version string
+}
+
+// ParseCPE splits a CPE 2.3 formatted string. Wildcard versions are left
+// empty.
+func ParseCPE(cpe string) (CPE, error) {
+	parts := strings.Split(cpe, ":")
+	if len(parts) < 6 || parts[0] != "cpe" || parts[1] != "2.3" {
+		return CPE{}, fmt.Errorf("invalid CPE 2.3 name: %s", cpe)
+	}
+	c := CPE{Part: parts[2], Vendor: parts[3], Product: parts[4], Version: parts[5]}
+	if c.Version == "*" || c.Version == "-" {
+		c.Version = ""
+	}
+	return c, nil
+}
+
+// Registry dispatches hardware and operating system CPEs to the connector of
+// their vendor.
+type Registry struct {
+	connectors map[string]Connector
+}
+
+func NewRegistry(connectors ...Connector) *Registry {
+	r := &Registry{connectors: make(map[string]Connector, len(connectors))}
+	for _, c := range connectors {
+		r.connectors[c.Vendor()] = c
+	}
+	return r
+}
+
+// NewRegistryFromNames creates a registry with the named connectors
+// (cisco, fortinet, siemens). The Cisco openVuln API requires a token.
+func NewRegistryFromNames(names []string, ciscoToken string, feedTTL time.Duration) (*Registry, error) {
+	var connectors []Connector
+	for _, name := range names {
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "":
+		case "cisco":
+			connectors = append(connectors, NewCiscoConnector(ciscoToken))
+		case "fortinet":
+			connectors = append(connectors, NewFortinetConnector(feedTTL))
+		case "siemens":
+			connectors = append(connectors, NewSiemensConnector(feedTTL))
+		default:
+			return nil, fmt.Errorf("%w: %s", ErrUnknownConnector, name)
+		}
+	}
+	return NewRegistry(connectors...), nil
+}
+
+// ReplaceCiscoToken swaps the access token of the Cisco connector of the
+// registry, if any, e.g. once a secret was rotated.
+func (r *Registry) ReplaceCiscoToken(token string) {
+	if c, ok := r.connectors["cisco"].(*CiscoConnector); ok {
+		c.ReplaceToken(token)
+	}
+}
+
+// Lookup returns the advisories for cpe. Application CPEs and vendors without
+// a connector return no advisories.
+func (r *Registry) Lookup(ctx context.Context, cpe string) ([]Advisory, error) {
+	c, err := ParseCPE(cpe)
+	if err != nil {
+		return nil, err
+	}
+	if c.Part != "h" && c.Part != "o" {
+		return nil, nil
+	}
+	connector, ok := r.connectors[c.Vendor]
+	if !ok {
+		return nil, nil
+	}
+
+	advisories, err := connector.Lookup(ctx, c)
+	if err != nil {
+		return nil, fmt.Errorf("%s PSIRT lookup failed for %s: %w", c.Vendor, cpe, err)
+	}
+	return advisories, nil
+}
+
+var (
+	cvePattern    = regexp.MustCompile(`CVE-\d{4}-\d{4,}`)
+	ssaPattern    = regexp.MustCompile(`SSA-\d+`)
+	nonAlphaNumRe = regexp.MustCompile(`[^a-z0-9]+`)
+)
+
+// extractCVEIDs returns the unique CVE IDs mentioned in text, in order.
+func extractCVEIDs(text string) []string {
+	seen := make(map[string]bool)
+	var ids []string
+	for _, id := range cvePattern.FindAllString(text, -1) {
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// normalize lowercases s and drops everything but letters and digits, so that
+// "SCALANCE X204-2" and the CPE product scalance_x204-2 compare equal.
+func normalize(s string) string {
+	return nonAlphaNumRe.ReplaceAllString(strings.ToLower(s), "")
+}
+
+// mentionsProduct reports whether the feed text names the CPE product.
+func mentionsProduct(text, product string) bool {
+	p := normalize(product)
+	return p != "" && strings.Contains(normalize(text), p)
+}
+
+func newHTTPClient() *http.Client {
+	return &http.Client{Timeout: 30 * time.Second}
+}
+
+// errNoAdvisories is returned by fetchBody for 404 responses, which vendor
+// APIs use when a product has no advisories.
+var errNoAdvisories = errors.New("no advisories")
+
+// fetchBody GETs url and returns its body, failing on non-200 responses.
+func fetchBody(ctx context.Context, client *http.Client, url string, headers map[string]string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create PSIRT request: %w", err)
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed PSIRT request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, errNoAdvisories
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected PSIRT response status for %s: %s", url, resp.Status)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 50<<20))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read PSIRT response: %w", err)
+	}
+	return body, nil
+}
+
+// feedCache holds the parsed advisories of a whole vendor feed, refreshed
+// at most once per ttl.
+type feedCache struct {
+	mu        sync.Mutex
+	ttl       time.Duration
+	fetchedAt time.Time
+	entries   []feedEntry
+}
+
+// feedEntry is an advisory with the feed text used to match products.
+type feedEntry struct {
+	Advisory
+	text string
+}
+
+func (c *feedCache) get(ctx context.Context, fetch func(context.Context) ([]feedEntry, error)) ([]feedEntry, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.entries != nil && time.Since(c.fetchedAt) < c.ttl {
+		return c.entries, nil
+	}
+	entries, err := fetch(ctx)
+	if err != nil {
+		// Serve stale entries rather than nothing when the feed is down
+		if c.entries != nil {
+			return c.entries, nil
+		}
+		return nil, err
+	}
+	c.entries = entries
+	c.fetchedAt = time.Now()
+	return entries, nil
+}
+
+// matchEntries returns the advisories of entries naming the product of cpe,
+// when the affected versions they state cover its version.
+func matchEntries(entries []feedEntry, cpe CPE) []Advisory {
+	var advisories []Advisory
+	for _, e := range entries {
+		if mentionsProduct(e.text, cpe.Product) && affectsVersion(e.text, cpe.Version) {
+			advisories = append(advisories, e.Advisory)
+		}
+	}
+	return advisories
+}
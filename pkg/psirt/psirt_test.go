@@ -0,0 +1,235 @@
+package psirt
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCPE(t *testing.T) {
+	t.Parallel()
+	c, err := ParseCPE("cpe:2.3:o:cisco:ios_xe:17.3.1:*:*:*:*:*:*:*")
+	require.NoError(t, err)
+	assert.Equal(t, CPE{Part: "o", Vendor: "cisco", Product: "ios_xe", Version: "17.3.1"}, c)
+
+	c, err = ParseCPE("cpe:2.3:h:siemens:scalance_x204-2:-:*:*:*:*:*:*:*")
+	require.NoError(t, err)
+	assert.Empty(t, c.Version)
+
+	_, err = ParseCPE("cpe:/o:cisco:ios:15.1")
+	assert.Error(t, err)
+}
+
+func TestCiscoConnector_Lookup(t *testing.T) {
+	t.Parallel()
+	var gotPath, gotAuth string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.RequestURI()
+		gotAuth = r.Header.Get("Authorization")
+		switch r.URL.Path {
+		case "/product":
+			if r.URL.Query().Get("product") != "webex meetings server" {
+				http.NotFound(w, r)
+				return
+			}
+			w.Write([]byte(`{"advisories":[
+				{"advisoryId":"cisco-sa-wms-xss-4","cves":["CVE-2024-0004"],"productNames":["Cisco Webex Meetings Server 4.0","Cisco Webex Meetings Server 4.0MR1"]},
+				{"advisoryId":"cisco-sa-wms-xss-3","cves":["CVE-2024-0003"],"productNames":["Cisco Webex Meetings Server 3.0","Cisco Webex Meetings Server 3.0MR2"]},
+				{"advisoryId":"cisco-sa-wms-old","cves":["CVE-2024-0002"],"productNames":["Cisco Webex Meetings Server"],"summary":"Releases earlier than 3.0MR3 are affected."},
+				{"advisoryId":"cisco-sa-wms-all","cves":["CVE-2024-0001"],"productNames":["Cisco Webex Meetings Server"]}
+			]}`))
+		case "/OSType/iosxe":
+			w.Write([]byte(`{"advisories":[{"advisoryId":"cisco-sa-webui-privesc-j22SaA4z","advisoryTitle":"Cisco IOS XE Software Web UI Privilege Escalation Vulnerability","cves":["CVE-2023-20198","NA"],"cvssBaseScore":"10.0","sir":"Critical","firstPublished":"2023-10-16T15:00:00","publicationUrl":"https://sec.cloudapps.cisco.com/security/center/content/CiscoSecurityAdvisory/cisco-sa-iosxe-webui-privesc-j22SaA4z"}]}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	c := NewCiscoConnector("token")
+	c.BaseURL = server.URL
+
+	advisories, err := c.Lookup(context.Background(), CPE{Part: "o", Vendor: "cisco", Product: "ios_xe", Version: "17.3.1"})
+	require.NoError(t, err)
+	assert.Equal(t, "/OSType/iosxe?version=17.3.1", gotPath)
+	assert.Equal(t, "Bearer token", gotAuth)
+	require.Len(t, advisories, 1)
+	assert.Equal(t, []string{"CVE-2023-20198"}, advisories[0].CVEs)
+	assert.Equal(t, 10.0, advisories[0].CVSSScore)
+	assert.Equal(t, "Critical", advisories[0].Severity)
+	assert.Equal(t, 2023, advisories[0].Published.Year())
+
+	advisories, err = c.Lookup(context.Background(), CPE{Part: "h", Vendor: "cisco", Product: "asa_5505"})
+	require.NoError(t, err, "Expected products without advisories not to fail")
+	assert.Equal(t, "/product?product=asa+5505", gotPath)
+	assert.Empty(t, advisories)
+
+	advisories, err = c.Lookup(context.Background(), CPE{Part: "a", Vendor: "cisco", Product: "webex_meetings_server", Version: "4.0"})
+	require.NoError(t, err)
+	assert.Equal(t, "/product?product=webex+meetings+server", gotPath)
+	var ids []string
+	for _, a := range advisories {
+		ids = append(ids, a.ID)
+	}
+	assert.Equal(t, []string{"cisco-sa-wms-xss-4", "cisco-sa-wms-all"}, ids, "Expected the advisories of other versions to be dropped")
+
+	NewRegistry(c).ReplaceCiscoToken("rotated")
+	_, err = c.Lookup(context.Background(), CPE{Part: "h", Vendor: "cisco", Product: "asa_5505"})
+	require.NoError(t, err)
+	assert.Equal(t, "Bearer rotated", gotAuth, "Expected the rotated token")
+}
+
+const fortinetFeed = `<?xml version="1.0"?>
+<rss version="2.0"><channel>
+<item>
+  <title>FortiOS - Heap-based buffer overflow in sslvpnd</title>
+  <link>https://fortiguard.fortinet.com/psirt/FG-IR-22-398</link>
+  <description>A heap-based buffer overflow vulnerability [CWE-122] in FortiOS SSL-VPN 7.2.0 through 7.2.2, 7.0.0 through 7.0.8 and 6.2 all versions may allow a remote unauthenticated attacker to execute arbitrary code. CVE-2022-42475</description>
+  <pubDate>Mon, 12 Dec 2022 00:00:00 +0000</pubDate>
+</item>
+<item>
+  <title>FortiWeb - OS command injection</title>
+  <link>https://fortiguard.fortinet.com/psirt/FG-IR-23-001</link>
+  <description>CVE-2023-0001</description>
+  <pubDate>Tue, 10 Jan 2023 00:00:00 +0000</pubDate>
+</item>
+</channel></rss>`
+
+func TestFortinetConnector_Lookup(t *testing.T) {
+	t.Parallel()
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Write([]byte(fortinetFeed))
+	}))
+	defer server.Close()
+
+	c := NewFortinetConnector(time.Hour)
+	c.FeedURL = server.URL
+
+	advisories, err := c.Lookup(context.Background(), CPE{Part: "o", Vendor: "fortinet", Product: "fortios"})
+	require.NoError(t, err)
+	require.Len(t, advisories, 1)
+	assert.Equal(t, "FG-IR-22-398", advisories[0].ID)
+	assert.Equal(t, []string{"CVE-2022-42475"}, advisories[0].CVEs)
+	assert.Equal(t, 2022, advisories[0].Published.Year())
+
+	_, err = c.Lookup(context.Background(), CPE{Part: "o", Vendor: "fortinet", Product: "fortiweb"})
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), requests.Load(), "Expected the feed to be cached")
+
+	for _, version := range []string{"7.2.1", "7.0.8", "6.2.15"} {
+		advisories, err = c.Lookup(context.Background(), CPE{Part: "o", Vendor: "fortinet", Product: "fortios", Version: version})
+		require.NoError(t, err)
+		assert.Len(t, advisories, 1, "Expected %s to be affected", version)
+	}
+	for _, version := range []string{"7.2.3", "7.4.0", "6.4.1"} {
+		advisories, err = c.Lookup(context.Background(), CPE{Part: "o", Vendor: "fortinet", Product: "fortios", Version: version})
+		require.NoError(t, err)
+		assert.Empty(t, advisories, "Expected %s not to be affected", version)
+	}
+}
+
+func TestSiemensConnector_Lookup(t *testing.T) {
+	t.Parallel()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<?xml version="1.0" encoding="utf-8"?>
+<feed xmlns="http://www.w3.org/2005/Atom">
+  <entry>
+    <id>https://cert-portal.siemens.com/productcert/html/ssa-480230.html</id>
+    <title>SSA-480230: Denial of Service Vulnerability in SCALANCE X-200 Switch Family</title>
+    <link href="https://cert-portal.siemens.com/productcert/html/ssa-480230.html"/>
+    <updated>2023-02-14T00:00:00Z</updated>
+    <summary>Affected products: SCALANCE X204-2 (All versions &lt; V5.5.2), SCALANCE X206-1 (All versions &lt; V5.5.2). CVE-2022-46140, CVE-2022-46141</summary>
+  </entry>
+</feed>`))
+	}))
+	defer server.Close()
+
+	c := NewSiemensConnector(time.Hour)
+	c.FeedURL = server.URL
+
+	advisories, err := c.Lookup(context.Background(), CPE{Part: "h", Vendor: "siemens", Product: "scalance_x204-2"})
+	require.NoError(t, err)
+	require.Len(t, advisories, 1)
+	assert.Equal(t, "SSA-480230", advisories[0].ID)
+	assert.Equal(t, []string{"CVE-2022-46140", "CVE-2022-46141"}, advisories[0].CVEs)
+
+	advisories, err = c.Lookup(context.Background(), CPE{Part: "h", Vendor: "siemens", Product: "scalance_x308-2"})
+	require.NoError(t, err)
+	assert.Empty(t, advisories)
+
+	advisories, err = c.Lookup(context.Background(), CPE{Part: "h", Vendor: "siemens", Product: "scalance_x204-2", Version: "V5.2.6"})
+	require.NoError(t, err)
+	assert.Len(t, advisories, 1)
+
+	advisories, err = c.Lookup(context.Background(), CPE{Part: "h", Vendor: "siemens", Product: "scalance_x204-2", Version: "5.5.2"})
+	require.NoError(t, err)
+	assert.Empty(t, advisories, "Expected the fixed version not to be affected")
+}
+
+func Test_affectsVersion(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		text    string
+		version string
+		want    bool
+	}{
+		{"FortiOS 7.2.0 through 7.2.2", "7.2.2", true},
+		{"FortiOS 7.2.0 through 7.2.2", "7.2.10", false},
+		{"FortiOS 7.2.4 and below, 7.0.13 and below", "7.0.2", true},
+		{"FortiOS 7.2.4 and below, 7.0.13 and below", "7.2.5", false},
+		{"FortiManager 6.4 all versions", "6.4.14", true},
+		{"FortiManager 6.4 all versions", "6.40", false},
+		{"FortiClient 6.0.x", "6.0.9", true},
+		{"SCALANCE X204-2 (All versions < V5.2.6)", "V5.2.5", true},
+		{"SCALANCE X204-2 (All versions < V5.2.6)", "5.2.6", false},
+		{"SIMATIC S7-1500 (All versions)", "2.9.4", true},
+		{"Versions prior to 3.1 are affected", "3.1", false},
+		{"No versions stated", "1.0", true},
+		{"FortiOS 7.2.0 through 7.2.2", "", true},
+	}
+
+	for _, tc := range testCases {
+		assert.Equal(t, tc.want, affectsVersion(tc.text, tc.version), "%q covers %s", tc.text, tc.version)
+	}
+}
+
+type stubConnector struct {
+	calls int
+}
+
+func (s *stubConnector) Vendor() string { return "cisco" }
+
+func (s *stubConnector) Lookup(ctx context.Context, cpe CPE) ([]Advisory, error) {
+	s.calls++
+	return []Advisory{{ID: "cisco-sa-1", CVEs: []string{"CVE-2024-0001"}}}, nil
+}
+
+func TestRegistry_Lookup(t *testing.T) {
+	t.Parallel()
+	stub := &stubConnector{}
+	r := NewRegistry(stub)
+
+	advisories, err := r.Lookup(context.Background(), "cpe:2.3:a:cisco:webex:1.0:*:*:*:*:*:*:*")
+	require.NoError(t, err)
+	assert.Empty(t, advisories, "Expected application CPEs to be skipped")
+
+	advisories, err = r.Lookup(context.Background(), "cpe:2.3:h:juniper:srx300:-:*:*:*:*:*:*:*")
+	require.NoError(t, err)
+	assert.Empty(t, advisories)
+
+	advisories, err = r.Lookup(context.Background(), "cpe:2.3:h:cisco:asa_5505:-:*:*:*:*:*:*:*")
+	require.NoError(t, err)
+	assert.Len(t, advisories, 1)
+	assert.Equal(t, 1, stub.calls)
+
+	_, err = NewRegistryFromNames([]string{"cisco", "juniper"}, "", time.Hour)
+	assert.ErrorIs(t, err, ErrUnknownConnector)
+}
@@ -0,0 +1,110 @@
+package psirt
+
+import (
+	"regexp"
+	"strings"
+
+	nvdcpe "github.com/kptm-tools/vulnerability-analysis/nvd/cpe"
+)
+
+// versionPattern matches the versions of advisory text, e.g. 7.2.0 or
+// V5.2.6, without the V prefix of Siemens advisories.
+const versionPattern = `[vV]?(\d+(?:\.[0-9a-zA-Z]+)*)`
+
+var (
+	// "7.0 all versions", "All versions", "All versions < V5.5.2"
+	allVersionsRe = regexp.MustCompile(`(?i)(?:` + versionPattern + `\s+)?all\s+versions(?:\s*(?:<|before|prior\s+to)\s*` + versionPattern + `)?`)
+	// "7.2.0 through 7.2.2", "6.4.0 to 6.4.10"
+	throughRe = regexp.MustCompile(`(?i)` + versionPattern + `\s+(?:through|to)\s+` + versionPattern)
+	// "7.2.4 and below", "6.0.16 and earlier", "<= 5.2"
+	upToRe = regexp.MustCompile(`(?i)` + versionPattern + `\s+and\s+(?:below|earlier|prior|lower)|<=\s*` + versionPattern)
+	// "before 7.2.3", "prior to 7.2.3", "< V5.2.6"
+	beforeRe = regexp.MustCompile(`(?i)(?:before|prior\s+to|earlier\s+than|<)\s*` + versionPattern)
+	// "6.2.x"
+	seriesRe = regexp.MustCompile(`(?i)\b(\d+(?:\.\d+)*)\.x\b`)
+)
+
+// versionRange is a range of affected versions parsed from advisory text.
+// Empty bounds are unbounded, a series covers every version starting with
+// it, e.g. 7.0 covers 7.0.12.
+type versionRange struct {
+	start, end  string
+	endIncluded bool
+	series      string
+}
+
+func (r versionRange) contains(version string) bool {
+	if r.series != "" {
+		return version == r.series || strings.HasPrefix(version, r.series+".")
+	}
+	if r.start != "" && nvdcpe.CompareVersions(version, r.start) < 0 {
+		return false
+	}
+	if r.end != "" {
+		c := nvdcpe.CompareVersions(version, r.end)
+		return c < 0 || (c == 0 && r.endIncluded)
+	}
+	return true
+}
+
+// affectedRanges returns the version ranges advisory text states as
+// affected, and whether it states all versions are.
+func affectedRanges(text string) ([]versionRange, bool) {
+	var ranges []versionRange
+	all := false
+	for _, m := range allVersionsRe.FindAllStringSubmatch(text, -1) {
+		switch {
+		case m[1] != "":
+			ranges = append(ranges, versionRange{series: m[1]})
+		case m[2] != "":
+			ranges = append(ranges, versionRange{end: m[2]})
+		default:
+			all = true
+		}
+	}
+	for _, m := range throughRe.FindAllStringSubmatch(text, -1) {
+		ranges = append(ranges, versionRange{start: m[1], end: m[2], endIncluded: true})
+	}
+	for _, m := range upToRe.FindAllStringSubmatch(text, -1) {
+		ranges = append(ranges, versionRange{end: m[1] + m[2], endIncluded: true})
+	}
+	for _, m := range beforeRe.FindAllStringSubmatch(text, -1) {
+		ranges = append(ranges, versionRange{end: m[1]})
+	}
+	for _, m := range seriesRe.FindAllStringSubmatch(text, -1) {
+		ranges = append(ranges, versionRange{series: m[1]})
+	}
+	return ranges, all
+}
+
+// affectsVersion reports whether advisory text covers version. Unknown
+// versions, and text stating no version range, are assumed affected rather
+// than dropping an advisory that may apply.
+func affectsVersion(text, version string) bool {
+	version = trimVersion(version)
+	if version == "" {
+		return true
+	}
+	covered, stated := rangesCover(text, version)
+	return covered || !stated
+}
+
+// rangesCover reports whether the ranges advisory text states cover
+// version, and whether it states any.
+func rangesCover(text, version string) (covered, stated bool) {
+	ranges, all := affectedRanges(text)
+	if all {
+		return true, true
+	}
+	for _, r := range ranges {
+		if r.contains(version) {
+			return true, true
+		}
+	}
+	return false, len(ranges) > 0
+}
+
+// trimVersion drops the V prefix of vendor versions, e.g. V5.2.6.
+func trimVersion(version string) string {
+	return strings.TrimPrefix(strings.TrimPrefix(version, "v"), "V")
+}
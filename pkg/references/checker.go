@@ -0,0 +1,240 @@
+// Package references checks whether the reference URLs of published findings
+// are still reachable. Many references of old CVEs point to pages that no
+// longer exist, so dead links are annotated and replaced by their archive.org
+// snapshot when one is available.
+package references
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/kptm-tools/vulnerability-analysis/pkg/results"
+)
+
+const defaultArchiveAPIURL = "https://archive.org/wayback/available"
+
+// Checker verifies reference URLs in the background. Lookups never block on
+// the network: unknown URLs are queued and annotated once they were checked.
+// The statuses of the least recently looked up URLs are evicted past the
+// maximum number of entries.
+type Checker struct {
+	client        *http.Client
+	archiveAPIURL string
+	ttl           time.Duration
+	workers       int
+	maxEntries    int
+
+	mu      sync.Mutex
+	checked map[string]*list.Element
+	lru     *list.List
+	pending map[string]bool
+	queue   chan string
+}
+
+// NewChecker creates a Checker that re-checks URLs after ttl, keeping the
+// statuses of at most maxEntries URLs, or of every URL when maxEntries isn't
+// positive.
+func NewChecker(ttl time.Duration, workers, maxEntries int) *Checker {
+	if workers <= 0 {
+		workers = 1
+	}
+	return &Checker{
+		client: &http.Client{
+			Timeout: 15 * time.Second,
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				if len(via) >= 5 {
+					return http.ErrUseLastResponse
+				}
+				return nil
+			},
+		},
+		archiveAPIURL: defaultArchiveAPIURL,
+		ttl:           ttl,
+		workers:       workers,
+		maxEntries:    maxEntries,
+		checked:       make(map[string]*list.Element),
+		lru:           list.New(),
+		pending:       make(map[string]bool),
+		queue:         make(chan string, 1024),
+	}
+}
+
+// Start launches the background workers until ctx is done.
+func (c *Checker) Start(ctx context.Context) {
+	for i := 0; i < c.workers; i++ {
+		go func() {
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case u := <-c.queue:
+					c.store(c.check(ctx, u))
+				}
+			}
+		}()
+	}
+}
+
+// store records the status of a checked URL, evicting the least recently
+// looked up one when full.
+func (c *Checker) store(status results.ReferenceStatus) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.pending, status.URL)
+	if elem, ok := c.checked[status.URL]; ok {
+		elem.Value = status
+		c.lru.MoveToFront(elem)
+		return
+	}
+	c.checked[status.URL] = c.lru.PushFront(status)
+	if c.maxEntries > 0 && c.lru.Len() > c.maxEntries {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.checked, oldest.Value.(results.ReferenceStatus).URL)
+	}
+}
+
+// Lookup returns the last known status of a URL, if it is still fresh.
+// Expired statuses are dropped.
+func (c *Checker) Lookup(u string) (results.ReferenceStatus, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.checked[u]
+	if !ok {
+		return results.ReferenceStatus{}, false
+	}
+	status := elem.Value.(results.ReferenceStatus)
+	if c.ttl > 0 && time.Since(status.CheckedAt) > c.ttl {
+		c.lru.Remove(elem)
+		delete(c.checked, u)
+		return results.ReferenceStatus{}, false
+	}
+	c.lru.MoveToFront(elem)
+	return status, true
+}
+
+// Enqueue schedules a URL for checking. URLs already queued are ignored, and
+// URLs are dropped when the queue is full; they will be queued again the next
+// time they show up in a finding.
+func (c *Checker) Enqueue(u string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.pending[u] {
+		return
+	}
+	select {
+	case c.queue <- u:
+		c.pending[u] = true
+	default:
+		slog.Debug("Reference check queue is full, dropping URL", slog.String("url", u))
+	}
+}
+
+// Annotate marks the dead references of vuln and substitutes them with their
+// archived copy where available. References that were not checked yet are
+// queued and left untouched.
+func (c *Checker) Annotate(vuln *results.Vulnerability) {
+	var dead []results.ReferenceStatus
+	for i, ref := range vuln.References {
+		status, ok := c.Lookup(ref)
+		if !ok {
+			c.Enqueue(ref)
+			continue
+		}
+		if status.Reachable {
+			continue
+		}
+		dead = append(dead, status)
+		if status.ArchiveURL != "" {
+			vuln.References[i] = status.ArchiveURL
+		}
+	}
+	vuln.DeadReferences = dead
+}
+
+// check requests u and looks for an archived copy if it is unreachable.
+func (c *Checker) check(ctx context.Context, u string) results.ReferenceStatus {
+	status := results.ReferenceStatus{URL: u, CheckedAt: time.Now().UTC()}
+
+	code, err := c.statusCode(ctx, http.MethodHead, u)
+	// Plenty of servers don't implement HEAD properly
+	if err == nil && (code == http.StatusMethodNotAllowed || code == http.StatusForbidden || code == http.StatusNotImplemented) {
+		code, err = c.statusCode(ctx, http.MethodGet, u)
+	}
+	status.StatusCode = code
+
+	switch {
+	case err != nil:
+		status.Error = err.Error()
+	case code == http.StatusNotFound || code == http.StatusGone:
+	default:
+		// Server errors and throttling don't mean the page is gone
+		status.Reachable = true
+		return status
+	}
+
+	archiveURL, err := c.archivedURL(ctx, u)
+	if err != nil {
+		slog.Debug("Failed to look up archived reference",
+			slog.String("url", u),
+			slog.Any("error", err))
+	}
+	status.ArchiveURL = archiveURL
+	return status
+}
+
+func (c *Checker) statusCode(ctx context.Context, method, u string) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, method, u, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create reference request: %w", err)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("failed reference request: %w", err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode, nil
+}
+
+// archivedURL queries the Wayback Machine availability API.
+func (c *Checker) archivedURL(ctx context.Context, u string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.archiveAPIURL+"?url="+url.QueryEscape(u), nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create archive request: %w", err)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed archive request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected archive response status: %s", resp.Status)
+	}
+
+	var availability struct {
+		ArchivedSnapshots struct {
+			Closest *struct {
+				Available bool   `json:"available"`
+				URL       string `json:"url"`
+			} `json:"closest"`
+		} `json:"archived_snapshots"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&availability); err != nil {
+		return "", fmt.Errorf("failed to decode archive response: %w", err)
+	}
+
+	closest := availability.ArchivedSnapshots.Closest
+	if closest == nil || !closest.Available {
+		return "", nil
+	}
+	return closest.URL, nil
+}
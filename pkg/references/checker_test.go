@@ -0,0 +1,112 @@
+package references
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/kptm-tools/common/common/pkg/results/tools"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/results"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChecker_Annotate(t *testing.T) {
+	t.Parallel()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/alive":
+			w.WriteHeader(http.StatusOK)
+		case "/head-not-allowed":
+			if r.Method == http.MethodHead {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+		case "/archive":
+			if r.URL.Query().Get("url") == "http://"+r.Host+"/archived" {
+				w.Write([]byte(`{"archived_snapshots":{"closest":{"available":true,"url":"http://web.archive.org/web/2010/archived"}}}`))
+				return
+			}
+			w.Write([]byte(`{"archived_snapshots":{}}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	c := NewChecker(time.Hour, 2, 0)
+	c.archiveAPIURL = server.URL + "/archive"
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c.Start(ctx)
+
+	refs := []string{
+		server.URL + "/alive",
+		server.URL + "/head-not-allowed",
+		server.URL + "/archived",
+		server.URL + "/gone",
+	}
+	newVuln := func() results.Vulnerability {
+		return results.Vulnerability{Vulnerability: tools.Vulnerability{References: append([]string(nil), refs...)}}
+	}
+
+	// First sighting only queues the references
+	vuln := newVuln()
+	c.Annotate(&vuln)
+	assert.Equal(t, refs, vuln.References)
+	assert.Empty(t, vuln.DeadReferences)
+
+	assert.Eventually(t, func() bool {
+		for _, ref := range refs {
+			if _, ok := c.Lookup(ref); !ok {
+				return false
+			}
+		}
+		return true
+	}, 5*time.Second, 10*time.Millisecond)
+
+	vuln = newVuln()
+	c.Annotate(&vuln)
+	assert.Equal(t, []string{
+		server.URL + "/alive",
+		server.URL + "/head-not-allowed",
+		"http://web.archive.org/web/2010/archived",
+		server.URL + "/gone",
+	}, vuln.References)
+	if assert.Len(t, vuln.DeadReferences, 2) {
+		assert.Equal(t, server.URL+"/archived", vuln.DeadReferences[0].URL)
+		assert.Equal(t, http.StatusNotFound, vuln.DeadReferences[0].StatusCode)
+		assert.Equal(t, server.URL+"/gone", vuln.DeadReferences[1].URL)
+		assert.Empty(t, vuln.DeadReferences[1].ArchiveURL)
+	}
+}
+
+func TestChecker_MaxEntries(t *testing.T) {
+	t.Parallel()
+	c := NewChecker(time.Hour, 1, 2)
+	now := time.Now().UTC()
+	c.store(results.ReferenceStatus{URL: "https://a", Reachable: true, CheckedAt: now})
+	c.store(results.ReferenceStatus{URL: "https://b", Reachable: true, CheckedAt: now})
+	// Looked up last, so b is evicted first
+	_, ok := c.Lookup("https://a")
+	assert.True(t, ok)
+	c.store(results.ReferenceStatus{URL: "https://c", Reachable: true, CheckedAt: now})
+
+	_, ok = c.Lookup("https://b")
+	assert.False(t, ok)
+	_, ok = c.Lookup("https://a")
+	assert.True(t, ok)
+	_, ok = c.Lookup("https://c")
+	assert.True(t, ok)
+
+	// Expired statuses are dropped on lookup
+	c.store(results.ReferenceStatus{URL: "https://a", CheckedAt: now.Add(-2 * time.Hour)})
+	_, ok = c.Lookup("https://a")
+	assert.False(t, ok)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	assert.Equal(t, 1, c.lru.Len())
+	assert.Len(t, c.checked, 1)
+}
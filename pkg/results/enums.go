@@ -0,0 +1,42 @@
+package results
+
+// ScopeType tells whether exploiting a vulnerability impacts resources beyond
+// the security scope of the vulnerable component (CVSS v3 Scope metric).
+type ScopeType string
+
+const (
+	ScopeTypeUnchanged ScopeType = "Unchanged"
+	ScopeTypeChanged   ScopeType = "Changed"
+	ScopeTypeUnknown   ScopeType = "Unknown"
+)
+
+func (s ScopeType) String() string {
+	return string(s)
+}
+
+// UserInteractionType tells whether exploitation requires a user, other than
+// the attacker, to take part (CVSS UserInteraction metric).
+type UserInteractionType string
+
+const (
+	UserInteractionNone     UserInteractionType = "None"
+	UserInteractionRequired UserInteractionType = "Required"
+	UserInteractionUnknown  UserInteractionType = "Unknown"
+)
+
+func (u UserInteractionType) String() string {
+	return string(u)
+}
+
+// ExposureType tells whether a finding is reachable from the internet.
+type ExposureType string
+
+const (
+	ExposureInternetFacing ExposureType = "internet_facing"
+	ExposureInternal       ExposureType = "internal"
+	ExposureUnknown        ExposureType = "unknown"
+)
+
+func (e ExposureType) String() string {
+	return string(e)
+}
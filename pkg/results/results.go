@@ -0,0 +1,369 @@
+// Package results holds the result types published by this service. They
+// mirror the common tools.NmapResult wire format and extend vulnerabilities
+// with fields specific to vulnerability analysis.
+package results
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/kptm-tools/common/common/pkg/enums"
+	"github.com/kptm-tools/common/common/pkg/results/tools"
+)
+
+// Vulnerability is an enriched vulnerability. The embedded common fields are
+// serialized inline so consumers of tools.Vulnerability keep working.
+type Vulnerability struct {
+	tools.Vulnerability
+
+	// Title is a readable heading for reports and tickets, generated since
+	// NVD records have none.
+	Title string `json:"title,omitempty"`
+	// CWEs are the weaknesses assigned to the CVE, e.g. CWE-787.
+	CWEs []string `json:"cwes,omitempty"`
+
+	// ConfidentialityImpact and Scope complete the CVSS impact metrics kept
+	// by the common vulnerability.
+	ConfidentialityImpact enums.ImpactType    `json:"confidentiality_impact"`
+	Scope                 ScopeType           `json:"scope,omitempty"`
+	UserInteraction       UserInteractionType `json:"user_interaction,omitempty"`
+
+	// RawMetrics keeps the NVD values of the CVSS metrics the enums have no
+	// value for, by metric, e.g. base_severity: EXTREME. The enum fields then
+	// hold the nearest value instead of Unknown.
+	RawMetrics map[string]string `json:"raw_metrics,omitempty"`
+
+	// Exposure tags the finding as internet-facing or internal, based on the
+	// scanned address and port state.
+	Exposure ExposureType `json:"exposure,omitempty"`
+
+	// CVSSv2Flags are the auxiliary booleans NVD publishes with CVSS v2
+	// metrics. ElevatedImpact is set when exploitation grants full
+	// privileges on the host.
+	CVSSv2Flags    *CVSSv2Flags `json:"cvss_v2_flags,omitempty"`
+	ElevatedImpact bool         `json:"elevated_impact,omitempty"`
+
+	// EPSS is the FIRST probability of exploitation within 30 days, when
+	// known for the CVE.
+	EPSS *float64 `json:"epss,omitempty"`
+
+	// KnownExploited is set for the CVEs of the CISA Known Exploited
+	// Vulnerabilities catalog.
+	KnownExploited bool `json:"known_exploited,omitempty"`
+	// ExploitReferences are the references NVD tags as exploits, e.g.
+	// proof of concept code.
+	ExploitReferences []string `json:"exploit_references,omitempty"`
+
+	// Assigner is the CNA which published the CVE, named after the NVD
+	// source of the identifier in Type.
+	Assigner *Assigner `json:"assigner,omitempty"`
+
+	// StaleDetection is set when the service the finding was detected on
+	// no longer answered once the host was analyzed, e.g. a transient
+	// service.
+	StaleDetection bool `json:"stale_detection,omitempty"`
+
+	// ICSAdvisories are the CISA ICS advisories covering the finding on OT
+	// products.
+	ICSAdvisories []ICSAdvisory `json:"ics_advisories,omitempty"`
+
+	// KBs are the Microsoft updates fixing the finding on Windows hosts.
+	KBs []KBUpdate `json:"kbs,omitempty"`
+
+	Provenance     *Provenance       `json:"provenance,omitempty"`
+	DeadReferences []ReferenceStatus `json:"dead_references,omitempty"`
+}
+
+// Assigner is an organization publishing CVE records, such as a CNA, known
+// to NVD by Identifier, e.g. an email address or a UUID.
+type Assigner struct {
+	Identifier   string `json:"identifier"`
+	Name         string `json:"name,omitempty"`
+	ContactEmail string `json:"contact_email,omitempty"`
+}
+
+// ICSAdvisory is a CISA ICS advisory with the mitigations and the affected
+// firmware ranges it publishes for the scanned product.
+type ICSAdvisory struct {
+	ID               string   `json:"id"`
+	URL              string   `json:"url,omitempty"`
+	Mitigations      []string `json:"mitigations,omitempty"`
+	AffectedVersions []string `json:"affected_versions,omitempty"`
+}
+
+// KBUpdate is a Microsoft KB update fixing a finding on the products of the
+// security update guide matching the host.
+type KBUpdate struct {
+	ID         string   `json:"id"`
+	URL        string   `json:"url,omitempty"`
+	Supersedes []string `json:"supersedes,omitempty"`
+	Products   []string `json:"products,omitempty"`
+}
+
+// Provenance records how a finding was matched, so analysts can debug why a
+// particular NVD entry was attached to a host.
+type Provenance struct {
+	Source     string   `json:"source"`
+	InputCPE   string   `json:"input_cpe,omitempty"`
+	MatchedCPE string   `json:"matched_cpe,omitempty"`
+	CPETrace   []string `json:"cpe_trace,omitempty"`
+
+	// Extractor names the CPE extractor that derived InputCPE from the raw
+	// evidence of a service nmap didn't report a CPE for.
+	Extractor string `json:"extractor,omitempty"`
+
+	// Resolution is the NVD Products API query which resolved the service,
+	// e.g. keywordSearch=OpenSSH+8.2p1, to MatchedCPE.
+	Resolution string `json:"resolution,omitempty"`
+
+	// Keyword is the NVD search matching a finding of a CPE without a
+	// version. Such findings have a low Confidence, as they may not affect
+	// the detected version.
+	Keyword    string `json:"keyword,omitempty"`
+	Confidence string `json:"confidence,omitempty"`
+
+	// OriginalSeverity is the NVD severity of a finding whose severity was
+	// remapped by the tenant policy rule SeverityRule.
+	OriginalSeverity enums.SeverityType `json:"original_severity,omitempty"`
+	SeverityRule     string             `json:"severity_rule,omitempty"`
+}
+
+// CVSSv2Flags are the CVSS v2 auxiliary fields of an NVD record. Each is nil
+// when NVD doesn't publish it for the CVE.
+type CVSSv2Flags struct {
+	ACInsufInfo             *bool `json:"ac_insuf_info,omitempty"`
+	ObtainAllPrivilege      *bool `json:"obtain_all_privilege,omitempty"`
+	ObtainUserPrivilege     *bool `json:"obtain_user_privilege,omitempty"`
+	ObtainOtherPrivilege    *bool `json:"obtain_other_privilege,omitempty"`
+	UserInteractionRequired *bool `json:"user_interaction_required,omitempty"`
+}
+
+// ReferenceStatus is the outcome of checking a reference URL. ArchiveURL is
+// set when the reference is dead and archive.org holds a copy of it.
+type ReferenceStatus struct {
+	URL        string    `json:"url"`
+	Reachable  bool      `json:"reachable"`
+	StatusCode int       `json:"status_code,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	ArchiveURL string    `json:"archive_url,omitempty"`
+	CheckedAt  time.Time `json:"checked_at"`
+}
+
+type OSData struct {
+	Name            string          `json:"name"`
+	Accuracy        int             `json:"accuracy"`
+	Family          string          `json:"family"`
+	Type            string          `json:"type"`
+	FingerPrint     string          `json:"fingerprint"`
+	CPE             string          `json:"cpe"`
+	Vulnerabilities []Vulnerability `json:"vulnerabilities"`
+}
+
+type PortData struct {
+	ID              uint16          `json:"id"`
+	Protocol        string          `json:"protocol"`
+	Service         tools.Service   `json:"service"`
+	Product         string          `json:"product"`
+	State           string          `json:"state"`
+	Vulnerabilities []Vulnerability `json:"vulnerabilities"`
+}
+
+type NmapResult struct {
+	// HostName is the first hostname of the host and HostAddress its
+	// primary IP address, or its hostname when no address is known, both
+	// in the canonical forms of the asset package. HostAddress keys the
+	// host in storage and correlations.
+	HostName    string `json:"host_name"`
+	HostAddress string `json:"host_address"`
+
+	// Addresses and HostNames are every IP address and hostname of the
+	// host, the primary ones first.
+	Addresses []string `json:"addresses,omitempty"`
+	HostNames []string `json:"host_names,omitempty"`
+
+	Exposure     ExposureType `json:"exposure,omitempty"`
+	ScannedPorts []PortData   `json:"scanned_ports"`
+	MostLikelyOS OSData       `json:"most_likely_os"`
+
+	// Classifications are the asset classes of the host, e.g. database_server.
+	// ReportGroup and RiskWeight come from the highest weighted class.
+	Classifications []string `json:"classifications,omitempty"`
+	ReportGroup     string   `json:"report_group,omitempty"`
+	RiskWeight      float64  `json:"risk_weight,omitempty"`
+
+	// MissingKBs are the KB updates fixing the findings of a Windows host,
+	// leaving out the KBs superseded by another one of the list.
+	MissingKBs []string `json:"missing_kbs,omitempty"`
+
+	// Dropped counts the findings withheld by the publication thresholds of
+	// the tenant, nil when none were.
+	Dropped *DroppedFindings `json:"dropped_findings,omitempty"`
+
+	// RejectedCVEs counts the CVEs rejected by their CNA that lookups
+	// returned and were left out of the findings.
+	RejectedCVEs int `json:"rejected_cves,omitempty"`
+
+	// RepeatOffender is set when the consecutive scans of the host keep
+	// finding new critical CVEs on it.
+	RepeatOffender *RepeatOffender `json:"repeat_offender,omitempty"`
+
+	// VolumeAnomaly is set when the number of CVEs found on the host
+	// deviates wildly from its earlier scans.
+	VolumeAnomaly *VolumeAnomaly `json:"volume_anomaly,omitempty"`
+
+	// Diff compares the findings of the host to those of its previous scan,
+	// nil when the host wasn't scanned before.
+	Diff *ScanDiff `json:"diff,omitempty"`
+
+	// Degradation lists the optional sources that were unavailable while the
+	// host was analyzed, nil when every source answered.
+	Degradation *Degradation `json:"degradation,omitempty"`
+
+	// DroppedCPEs are the CPEs reported by nmap that were rejected as
+	// invalid, so their services weren't looked up by CPE.
+	DroppedCPEs []DroppedCPE `json:"dropped_cpes,omitempty"`
+
+	// Preliminary is set on the early results holding the critical and known
+	// exploited findings of the host, published before its full result.
+	Preliminary bool `json:"preliminary,omitempty"`
+}
+
+// DroppedCPE is a CPE rejected by standardization or validation. Port is
+// zero for the CPEs of the OS.
+type DroppedCPE struct {
+	CPE     string `json:"cpe"`
+	Reason  string `json:"reason"`
+	Error   string `json:"error"`
+	Port    uint16 `json:"port,omitempty"`
+	Service string `json:"service,omitempty"`
+}
+
+// Degradation tells consumers that a result was completed without some of
+// its signals, e.g. EPSS scores, so its findings may be scored or filtered
+// differently once the missing data is backfilled.
+type Degradation struct {
+	Missing []MissingSignal `json:"missing"`
+}
+
+// MissingSignal is an optional source that failed during the analysis, with
+// the number of failed lookups and the first error.
+type MissingSignal struct {
+	Signal   string `json:"signal"`
+	Failures int    `json:"failures"`
+	Error    string `json:"error"`
+}
+
+// DroppedFindings counts the findings withheld from a published result.
+type DroppedFindings struct {
+	Total          int                  `json:"total"`
+	SeverityCounts tools.SeverityCounts `json:"severity_counts"`
+}
+
+// RepeatOffender describes the latest run of consecutive scans that each
+// found critical CVEs a host didn't have in earlier scans.
+type RepeatOffender struct {
+	ConsecutiveScans int       `json:"consecutive_scans"`
+	NewCriticalCVEs  []string  `json:"new_critical_cves"`
+	Since            time.Time `json:"since"`
+}
+
+// VolumeAnomalyKind tells whether a scan found far more or far fewer CVEs
+// than usual.
+type VolumeAnomalyKind string
+
+const (
+	VolumeAnomalySpike VolumeAnomalyKind = "spike"
+	VolumeAnomalyDrop  VolumeAnomalyKind = "drop"
+)
+
+// VolumeAnomaly compares the distinct CVEs found by a scan to the median of
+// the earlier scans of the host.
+type VolumeAnomaly struct {
+	Kind     VolumeAnomalyKind `json:"kind"`
+	Findings int               `json:"findings"`
+	Baseline int               `json:"baseline"`
+	Scans    int               `json:"scans"`
+	At       time.Time         `json:"at"`
+}
+
+// ScanDiff classifies the findings of a host against its previous scan: New
+// ones weren't found then, Fixed ones aren't found anymore and Persistent ones
+// are found by both. A finding is a CVE on the OS or a port of the host.
+type ScanDiff struct {
+	PreviousScanID string        `json:"previous_scan_id"`
+	PreviousScanAt time.Time     `json:"previous_scanned_at"`
+	New            []DiffFinding `json:"new"`
+	Fixed          []DiffFinding `json:"fixed"`
+	Persistent     []DiffFinding `json:"persistent"`
+}
+
+// DiffFinding is a finding of a ScanDiff. Port is zero for the findings of
+// the OS. Severity is the NVD severity, the diff isn't remapped for tenants,
+// and CVSSScore and EPSS let publication thresholds withhold it like the
+// finding itself.
+type DiffFinding struct {
+	CVE       string             `json:"cve_id"`
+	Port      uint16             `json:"port,omitempty"`
+	Protocol  string             `json:"protocol,omitempty"`
+	Severity  enums.SeverityType `json:"severity,omitempty"`
+	CVSSScore float64            `json:"cvss_score,omitempty"`
+	EPSS      *float64           `json:"epss,omitempty"`
+}
+
+var _ tools.IToolResult = (*NmapResult)(nil)
+
+func (r *NmapResult) GetToolName() enums.ToolName {
+	return enums.ToolNmap
+}
+
+// GetAllVulnerabilities returns the vulnerabilities of every scanned port.
+func (r *NmapResult) GetAllVulnerabilities() []Vulnerability {
+	var vulns []Vulnerability
+	for _, portData := range r.ScannedPorts {
+		vulns = append(vulns, portData.Vulnerabilities...)
+	}
+	return vulns
+}
+
+func (r *NmapResult) TotalVulnerabilities() int {
+	total := 0
+	for _, portData := range r.ScannedPorts {
+		total += len(portData.Vulnerabilities)
+	}
+	return total
+}
+
+// SeverityCounts counts the port vulnerabilities by base severity.
+func (r *NmapResult) SeverityCounts() tools.SeverityCounts {
+	return tools.GetSeverityCounts(Common(r.GetAllVulnerabilities()))
+}
+
+// LogValue creates a standard structured log representation for logging.
+func (r *NmapResult) LogValue() slog.Value {
+	severityCounts := r.SeverityCounts()
+	return slog.GroupValue(
+		slog.String("host_name", r.HostName),
+		slog.String("host_address", r.HostAddress),
+		slog.Int("ports_scanned", len(r.ScannedPorts)),
+		slog.Group("most_likely_os",
+			slog.String("name", r.MostLikelyOS.Name),
+			slog.Int("accuracy", r.MostLikelyOS.Accuracy),
+			slog.String("family", r.MostLikelyOS.Family),
+			slog.String("fingerprint", r.MostLikelyOS.FingerPrint),
+			slog.String("cpe", r.MostLikelyOS.CPE),
+			slog.Int("vulnerabilities", len(r.MostLikelyOS.Vulnerabilities))),
+		slog.Int("vulnerabilities_critical", severityCounts.Critical),
+		slog.Int("vulnerabilities_high", severityCounts.High),
+		slog.Int("vulnerabilities_medium", severityCounts.Medium),
+		slog.Int("vulnerabilities_low", severityCounts.Low),
+	)
+}
+
+// Common strips the service specific fields from vulns.
+func Common(vulns []Vulnerability) []tools.Vulnerability {
+	common := make([]tools.Vulnerability, 0, len(vulns))
+	for _, v := range vulns {
+		common = append(common, v.Vulnerability)
+	}
+	return common
+}
@@ -0,0 +1,150 @@
+package risk
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/kptm-tools/common/common/pkg/enums"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/results"
+)
+
+// LikelihoodMatrix derives the likelihood of exploitation from the CVSS
+// exploitability metrics of a vulnerability.
+type LikelihoodMatrix struct {
+	NetworkLowComplexity enums.LikelyhoodType // Network reachable, low attack complexity
+	Network              enums.LikelyhoodType // Network reachable, any other complexity
+	Adjacent             enums.LikelyhoodType
+	Local                enums.LikelyhoodType // Local and physical access
+
+	// UserInteractionPenalty is the number of likelihood levels removed when
+	// exploitation requires a user to take action, since such vulnerabilities
+	// can't be exploited in an automated way.
+	UserInteractionPenalty int
+	// InternalPenalty is the number of likelihood levels removed for findings
+	// on assets that aren't reachable from the internet.
+	InternalPenalty int
+}
+
+// DefaultLikelihoodMatrix is the matrix used unless configured otherwise.
+var DefaultLikelihoodMatrix = LikelihoodMatrix{
+	NetworkLowComplexity:   enums.LikelyhoodTypeVeryHigh,
+	Network:                enums.LikelyhoodTypeHigh,
+	Adjacent:               enums.LikelyhoodTypeMedium,
+	Local:                  enums.LikelyhoodTypeLow,
+	UserInteractionPenalty: 1,
+	InternalPenalty:        1,
+}
+
+// likelihoodLevels orders likelihoods from the lowest to the highest.
+var likelihoodLevels = []enums.LikelyhoodType{
+	enums.LikelyhoodTypeLow,
+	enums.LikelyhoodTypeMedium,
+	enums.LikelyhoodTypeHigh,
+	enums.LikelyhoodTypeVeryHigh,
+}
+
+// Likelihood returns the likelihood of exploitation of vuln.
+func (m LikelihoodMatrix) Likelihood(vuln results.Vulnerability) enums.LikelyhoodType {
+	var likelihood enums.LikelyhoodType
+	switch vuln.Access {
+	case enums.AccessTypeNetwork:
+		if vuln.Complexity == enums.ComplexityTypeLow {
+			likelihood = m.NetworkLowComplexity
+		} else {
+			likelihood = m.Network
+		}
+	case enums.AccessTypeAdjacentNetwork:
+		likelihood = m.Adjacent
+	case enums.AccessTypeUnknown, "":
+		return enums.LikelyhoodTypeUnknown
+	default:
+		likelihood = m.Local
+	}
+
+	if vuln.UserInteraction == results.UserInteractionRequired {
+		likelihood = lowerLikelihood(likelihood, m.UserInteractionPenalty)
+	}
+	if vuln.Exposure == results.ExposureInternal {
+		likelihood = lowerLikelihood(likelihood, m.InternalPenalty)
+	}
+	return likelihood
+}
+
+func lowerLikelihood(likelihood enums.LikelyhoodType, levels int) enums.LikelyhoodType {
+	for i, l := range likelihoodLevels {
+		if l == likelihood {
+			return likelihoodLevels[max(i-levels, 0)]
+		}
+	}
+	return likelihood
+}
+
+// ParseLikelihoodMatrix overrides entries of DefaultLikelihoodMatrix from a
+// comma separated list of key=value pairs, e.g.
+// "network=medium,user_interaction_penalty=2". Likelihoods are one of
+// low, medium, high and very_high.
+func ParseLikelihoodMatrix(spec string) (LikelihoodMatrix, error) {
+	m := DefaultLikelihoodMatrix
+
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		key, value, found := strings.Cut(entry, "=")
+		if !found {
+			return LikelihoodMatrix{}, fmt.Errorf("invalid likelihood matrix entry '%s': expected key=value", entry)
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+
+		if key == "user_interaction_penalty" || key == "internal_penalty" {
+			penalty, err := strconv.Atoi(value)
+			if err != nil || penalty < 0 {
+				return LikelihoodMatrix{}, fmt.Errorf("invalid likelihood matrix entry '%s': penalty must be a non-negative integer", entry)
+			}
+			if key == "internal_penalty" {
+				m.InternalPenalty = penalty
+			} else {
+				m.UserInteractionPenalty = penalty
+			}
+			continue
+		}
+
+		likelihood, err := parseLikelihood(value)
+		if err != nil {
+			return LikelihoodMatrix{}, fmt.Errorf("invalid likelihood matrix entry '%s': %w", entry, err)
+		}
+		switch key {
+		case "network_low_complexity":
+			m.NetworkLowComplexity = likelihood
+		case "network":
+			m.Network = likelihood
+		case "adjacent":
+			m.Adjacent = likelihood
+		case "local":
+			m.Local = likelihood
+		default:
+			return LikelihoodMatrix{}, fmt.Errorf("invalid likelihood matrix entry '%s': unknown key", entry)
+		}
+	}
+
+	return m, nil
+}
+
+func parseLikelihood(value string) (enums.LikelyhoodType, error) {
+	switch strings.ToLower(value) {
+	case "very_high":
+		return enums.LikelyhoodTypeVeryHigh, nil
+	case "high":
+		return enums.LikelyhoodTypeHigh, nil
+	case "medium":
+		return enums.LikelyhoodTypeMedium, nil
+	case "low":
+		return enums.LikelyhoodTypeLow, nil
+	default:
+		return "", fmt.Errorf("unknown likelihood '%s'", value)
+	}
+}
@@ -0,0 +1,59 @@
+package risk
+
+import (
+	"testing"
+
+	"github.com/kptm-tools/common/common/pkg/enums"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ParseLikelihoodMatrix(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		name    string
+		spec    string
+		want    LikelihoodMatrix
+		wantErr bool
+	}{
+		{
+			name: "Empty spec",
+			spec: "",
+			want: DefaultLikelihoodMatrix,
+		},
+		{
+			name: "Overrides",
+			spec: "network=medium, local=low,user_interaction_penalty=2",
+			want: LikelihoodMatrix{
+				NetworkLowComplexity:   enums.LikelyhoodTypeVeryHigh,
+				Network:                enums.LikelyhoodTypeMedium,
+				Adjacent:               enums.LikelyhoodTypeMedium,
+				Local:                  enums.LikelyhoodTypeLow,
+				UserInteractionPenalty: 2,
+				InternalPenalty:        1,
+			},
+		},
+		{name: "Unknown key", spec: "remote=high", wantErr: true},
+		{name: "Unknown likelihood", spec: "network=certain", wantErr: true},
+		{name: "Negative penalty", spec: "user_interaction_penalty=-1", wantErr: true},
+		{name: "Missing value", spec: "network", wantErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := ParseLikelihoodMatrix(tc.spec)
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func Test_lowerLikelihood(t *testing.T) {
+	t.Parallel()
+	assert.Equal(t, enums.LikelyhoodTypeHigh, lowerLikelihood(enums.LikelyhoodTypeVeryHigh, 1))
+	assert.Equal(t, enums.LikelyhoodTypeLow, lowerLikelihood(enums.LikelyhoodTypeMedium, 5))
+	assert.Equal(t, enums.LikelyhoodTypeUnknown, lowerLikelihood(enums.LikelyhoodTypeUnknown, 1))
+}
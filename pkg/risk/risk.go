@@ -0,0 +1,80 @@
+package risk
+
+import (
+	"github.com/kptm-tools/common/common/pkg/enums"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/results"
+)
+
+// Model computes a risk score for an enriched vulnerability.
+type Model interface {
+	Name() string
+	Score(vuln results.Vulnerability) float64
+}
+
+// LikelihoodImpactModel is the original NIST 800-30 inspired model: the
+// likelihood multiplied by the worst of confidentiality, integrity and
+// availability impact. Findings with an elevated impact (full privileges
+// obtained) count as high impact.
+type LikelihoodImpactModel struct{}
+
+var _ Model = LikelihoodImpactModel{}
+
+func (LikelihoodImpactModel) Name() string {
+	return "likelihood_impact_v1"
+}
+
+func (LikelihoodImpactModel) Score(vuln results.Vulnerability) float64 {
+	// enums.CalculateRiskScore only considers integrity and availability, and
+	// compares impacts by name, so the worst impact is picked by value here
+	impact := max(
+		vuln.ConfidentialityImpact.Float64(),
+		vuln.IntegrityImpact.Float64(),
+		vuln.AvailabilityImpact.Float64(),
+	)
+	if vuln.ElevatedImpact {
+		impact = enums.ImpactTypeHigh.Float64()
+	}
+	return vuln.Likelihood.Float64() * impact
+}
+
+// WeightedModel blends the likelihood/impact product with the normalized
+// CVSS base score and rewards evidence of exploit maturity. Scores stay
+// within [0, 1] so they can be compared against LikelihoodImpactModel.
+type WeightedModel struct{}
+
+var _ Model = WeightedModel{}
+
+func (WeightedModel) Name() string {
+	return "weighted_v2"
+}
+
+func (WeightedModel) Score(vuln results.Vulnerability) float64 {
+	base := LikelihoodImpactModel{}.Score(vuln)
+	cvss := vuln.BaseCVSSScore / 10.0
+
+	score := 0.6*base + 0.4*cvss
+	score *= exploitMultiplier(vuln.Exploit.Exploitability)
+
+	return min(score, 1.0)
+}
+
+func exploitMultiplier(e enums.ExploitabilityType) float64 {
+	switch e {
+	case enums.ExploitabilityTypeHigh:
+		return 1.25
+	case enums.ExploitabilityTypeFunctional:
+		return 1.15
+	case enums.ExploitabilityTypeProofOfConcept:
+		return 1.05
+	case enums.ExploitabilityTypeUnproven:
+		return 0.9
+	default:
+		return 1.0
+	}
+}
+
+// Current is the model whose scores are published.
+var Current Model = LikelihoodImpactModel{}
+
+// Candidate is the model being rolled out behind the risk model feature flag.
+var Candidate Model = WeightedModel{}
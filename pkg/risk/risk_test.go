@@ -0,0 +1,95 @@
+package risk
+
+import (
+	"testing"
+
+	"github.com/kptm-tools/common/common/pkg/enums"
+	"github.com/kptm-tools/common/common/pkg/results/tools"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/results"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Models(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		name          string
+		vuln          results.Vulnerability
+		wantCurrent   float64
+		wantCandidate float64
+	}{
+		{
+			name: "Very high likelihood, high impact, functional exploit",
+			vuln: results.Vulnerability{Vulnerability: tools.Vulnerability{
+				BaseCVSSScore:      9.8,
+				Likelihood:         enums.LikelyhoodTypeVeryHigh,
+				IntegrityImpact:    enums.ImpactTypeHigh,
+				AvailabilityImpact: enums.ImpactTypeHigh,
+				Exploit:            tools.Exploit{Exploitability: enums.ExploitabilityTypeFunctional},
+			}},
+			wantCurrent:   1.0,
+			wantCandidate: 1.0, // Capped
+		},
+		{
+			name: "Medium likelihood, low impact",
+			vuln: results.Vulnerability{Vulnerability: tools.Vulnerability{
+				BaseCVSSScore:      5.0,
+				Likelihood:         enums.LikelyhoodTypeMedium,
+				IntegrityImpact:    enums.ImpactTypeLow,
+				AvailabilityImpact: enums.ImpactTypeLow,
+				Exploit:            tools.Exploit{Exploitability: enums.ExploitabilityTypeUnknown},
+			}},
+			wantCurrent:   0.25,
+			wantCandidate: 0.35,
+		},
+		{
+			name: "Data exposure only",
+			vuln: results.Vulnerability{
+				Vulnerability: tools.Vulnerability{
+					BaseCVSSScore:      7.5,
+					Likelihood:         enums.LikelyhoodTypeVeryHigh,
+					IntegrityImpact:    enums.ImpactTypeNone,
+					AvailabilityImpact: enums.ImpactTypeNone,
+				},
+				ConfidentialityImpact: enums.ImpactTypeHigh,
+			},
+			wantCurrent:   1.0,
+			wantCandidate: 0.9,
+		},
+		{
+			name: "Low impact beats no impact",
+			vuln: results.Vulnerability{Vulnerability: tools.Vulnerability{
+				Likelihood:         enums.LikelyhoodTypeMedium,
+				IntegrityImpact:    enums.ImpactTypeLow,
+				AvailabilityImpact: enums.ImpactTypeNone,
+			}},
+			wantCurrent:   0.25,
+			wantCandidate: 0.15,
+		},
+		{
+			name: "Full privileges obtained count as high impact",
+			vuln: results.Vulnerability{
+				Vulnerability: tools.Vulnerability{
+					Likelihood:         enums.LikelyhoodTypeMedium,
+					IntegrityImpact:    enums.ImpactTypeLow,
+					AvailabilityImpact: enums.ImpactTypeLow,
+				},
+				ElevatedImpact: true,
+			},
+			wantCurrent:   0.5,
+			wantCandidate: 0.3,
+		},
+		{
+			name:          "Unknown metrics",
+			vuln:          results.Vulnerability{},
+			wantCurrent:   0.0,
+			wantCandidate: 0.0,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.InDelta(t, tc.wantCurrent, LikelihoodImpactModel{}.Score(tc.vuln), 1e-9)
+			assert.InDelta(t, tc.wantCandidate, WeightedModel{}.Score(tc.vuln), 1e-9)
+		})
+	}
+}
@@ -0,0 +1,101 @@
+package risk
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// ShadowScore is a side by side record of the published and candidate
+// scores of a vulnerability, used for offline model comparison.
+type ShadowScore struct {
+	TenantID       string    `json:"tenant_id"`
+	Host           string    `json:"host"`
+	CVEID          string    `json:"cve_id"`
+	CurrentModel   string    `json:"current_model"`
+	CurrentScore   float64   `json:"current_score"`
+	CandidateModel string    `json:"candidate_model"`
+	CandidateScore float64   `json:"candidate_score"`
+	RecordedAt     time.Time `json:"recorded_at"`
+}
+
+// Recorder persists shadow scores.
+type Recorder interface {
+	Record(score ShadowScore) error
+}
+
+// LogRecorder writes shadow scores to the structured log.
+type LogRecorder struct{}
+
+var _ Recorder = LogRecorder{}
+
+func (LogRecorder) Record(score ShadowScore) error {
+	slog.Debug("Shadow risk score",
+		slog.String("tenant_id", score.TenantID),
+		slog.String("host", score.Host),
+		slog.String("cve_id", score.CVEID),
+		slog.Float64("current_score", score.CurrentScore),
+		slog.Float64("candidate_score", score.CandidateScore))
+	return nil
+}
+
+// FileRecorder appends shadow scores as JSON lines to a file, ready to be
+// loaded by the comparison dashboards.
+type FileRecorder struct {
+	mu  sync.Mutex
+	f   *os.File
+	enc *json.Encoder
+}
+
+var _ Recorder = (*FileRecorder)(nil)
+
+// NewFileRecorder opens (or creates) the file at path for appending.
+func NewFileRecorder(path string) (*FileRecorder, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open shadow score file: %w", err)
+	}
+	return &FileRecorder{f: f, enc: json.NewEncoder(f)}, nil
+}
+
+func (r *FileRecorder) Record(score ShadowScore) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.enc.Encode(score); err != nil {
+		return fmt.Errorf("failed to record shadow score: %w", err)
+	}
+	return nil
+}
+
+// Close closes the underlying file.
+func (r *FileRecorder) Close() error {
+	return r.f.Close()
+}
+
+var (
+	recorderMu      sync.RWMutex
+	defaultRecorder Recorder = LogRecorder{}
+)
+
+// SetRecorder sets the recorder used for shadow scores.
+func SetRecorder(r Recorder) {
+	recorderMu.Lock()
+	defer recorderMu.Unlock()
+	defaultRecorder = r
+}
+
+// RecordShadow records a shadow score with the configured recorder.
+func RecordShadow(score ShadowScore) {
+	recorderMu.RLock()
+	r := defaultRecorder
+	recorderMu.RUnlock()
+
+	if err := r.Record(score); err != nil {
+		slog.Warn("Failed to record shadow risk score",
+			slog.String("cve_id", score.CVEID),
+			slog.Any("error", err))
+	}
+}
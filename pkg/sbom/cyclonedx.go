@@ -0,0 +1,230 @@
+// Package sbom builds CycloneDX inventories of the components detected on a
+// host, annotated with the vulnerabilities found on them.
+package sbom
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/results"
+)
+
+const specVersion = "1.5"
+
+// BOM is the subset of the CycloneDX 1.5 JSON format produced by Generate.
+type BOM struct {
+	BOMFormat       string          `json:"bomFormat"`
+	SpecVersion     string          `json:"specVersion"`
+	SerialNumber    string          `json:"serialNumber"`
+	Version         int             `json:"version"`
+	Metadata        Metadata        `json:"metadata"`
+	Components      []Component     `json:"components"`
+	Vulnerabilities []Vulnerability `json:"vulnerabilities,omitempty"`
+}
+
+type Metadata struct {
+	Timestamp time.Time `json:"timestamp"`
+	Tools     Tools     `json:"tools"`
+	Component Component `json:"component"`
+}
+
+type Tools struct {
+	Components []Component `json:"components"`
+}
+
+type Component struct {
+	BOMRef     string     `json:"bom-ref,omitempty"`
+	Type       string     `json:"type"`
+	Name       string     `json:"name"`
+	Version    string     `json:"version,omitempty"`
+	CPE        string     `json:"cpe,omitempty"`
+	Properties []Property `json:"properties,omitempty"`
+}
+
+type Property struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type Vulnerability struct {
+	BOMRef      string     `json:"bom-ref,omitempty"`
+	ID          string     `json:"id"`
+	Source      Source     `json:"source"`
+	Ratings     []Rating   `json:"ratings,omitempty"`
+	Description string     `json:"description,omitempty"`
+	Advisories  []Advisory `json:"advisories,omitempty"`
+	Published   *time.Time `json:"published,omitempty"`
+	Updated     *time.Time `json:"updated,omitempty"`
+	Affects     []Affect   `json:"affects"`
+}
+
+type Source struct {
+	Name string `json:"name"`
+	URL  string `json:"url,omitempty"`
+}
+
+type Rating struct {
+	Source   *Source `json:"source,omitempty"`
+	Score    float64 `json:"score,omitempty"`
+	Severity string  `json:"severity,omitempty"`
+}
+
+type Advisory struct {
+	URL string `json:"url"`
+}
+
+type Affect struct {
+	Ref string `json:"ref"`
+}
+
+var nvdSource = Source{Name: "NVD", URL: "https://nvd.nist.gov/"}
+
+// Generate builds the inventory of a host: its operating system and the
+// service of every scanned port. A CVE found on several components is listed
+// once, affecting each of them.
+func Generate(result *results.NmapResult) *BOM {
+	bom := &BOM{
+		BOMFormat:    "CycloneDX",
+		SpecVersion:  specVersion,
+		SerialNumber: "urn:uuid:" + uuid.NewString(),
+		Version:      1,
+		Metadata: Metadata{
+			Timestamp: time.Now().UTC(),
+			Tools: Tools{Components: []Component{
+				{Type: "application", Name: "vulnerability-analysis"},
+			}},
+			Component: Component{
+				BOMRef: "host",
+				Type:   "device",
+				Name:   hostName(result),
+				Properties: []Property{
+					{Name: "host:address", Value: result.HostAddress},
+				},
+			},
+		},
+		Components: []Component{},
+	}
+
+	vulns := make(map[string]*Vulnerability)
+	var order []string
+	addVulns := func(ref string, found []results.Vulnerability) {
+		for _, v := range found {
+			if existing, ok := vulns[v.ID]; ok {
+				existing.Affects = append(existing.Affects, Affect{Ref: ref})
+				continue
+			}
+			vulns[v.ID] = newVulnerability(v, ref)
+			order = append(order, v.ID)
+		}
+	}
+
+	if os := result.MostLikelyOS; os.Name != "" || os.CPE != "" {
+		bom.Components = append(bom.Components, Component{
+			BOMRef:  "os",
+			Type:    "operating-system",
+			Name:    firstNonEmpty(os.Name, cpeField(os.CPE, 4)),
+			Version: cpeField(os.CPE, 5),
+			CPE:     os.CPE,
+			Properties: []Property{
+				{Name: "nmap:accuracy", Value: fmt.Sprint(os.Accuracy)},
+			},
+		})
+		addVulns("os", os.Vulnerabilities)
+	}
+
+	for _, port := range result.ScannedPorts {
+		ref := fmt.Sprintf("port-%s-%d", firstNonEmpty(port.Protocol, "tcp"), port.ID)
+		bom.Components = append(bom.Components, Component{
+			BOMRef:  ref,
+			Type:    componentType(port.Service.CPE),
+			Name:    firstNonEmpty(port.Product, cpeField(port.Service.CPE, 4), port.Service.Name),
+			Version: firstNonEmpty(port.Service.Version, cpeField(port.Service.CPE, 5)),
+			CPE:     port.Service.CPE,
+			Properties: []Property{
+				{Name: "nmap:port", Value: fmt.Sprint(port.ID)},
+				{Name: "nmap:protocol", Value: port.Protocol},
+				{Name: "nmap:service", Value: port.Service.Name},
+				{Name: "nmap:state", Value: port.State},
+			},
+		})
+		addVulns(ref, port.Vulnerabilities)
+	}
+
+	for _, id := range order {
+		bom.Vulnerabilities = append(bom.Vulnerabilities, *vulns[id])
+	}
+	return bom
+}
+
+func newVulnerability(v results.Vulnerability, ref string) *Vulnerability {
+	vuln := &Vulnerability{
+		BOMRef:      v.ID,
+		ID:          v.ID,
+		Source:      nvdSource,
+		Description: v.Description,
+		Affects:     []Affect{{Ref: ref}},
+	}
+	if v.BaseCVSSScore > 0 || v.BaseSeverity != "" {
+		vuln.Ratings = []Rating{{
+			Source:   &nvdSource,
+			Score:    v.BaseCVSSScore,
+			Severity: severity(string(v.BaseSeverity)),
+		}}
+	}
+	for _, url := range v.References {
+		vuln.Advisories = append(vuln.Advisories, Advisory{URL: url})
+	}
+	if !v.Published.IsZero() {
+		vuln.Published = &v.Published
+	}
+	if !v.LastUpdated.IsZero() {
+		vuln.Updated = &v.LastUpdated
+	}
+	return vuln
+}
+
+// severity maps a severity to the CycloneDX severity enumeration.
+func severity(s string) string {
+	switch s := strings.ToLower(s); s {
+	case "critical", "high", "medium", "low", "none":
+		return s
+	default:
+		return "unknown"
+	}
+}
+
+// componentType maps the CPE part to a CycloneDX component type.
+func componentType(cpe string) string {
+	switch cpeField(cpe, 2) {
+	case "h":
+		return "device"
+	case "o":
+		return "operating-system"
+	default:
+		return "application"
+	}
+}
+
+// cpeField returns field i of a CPE 2.3 name, or "" for wildcards.
+func cpeField(cpe string, i int) string {
+	parts := strings.Split(cpe, ":")
+	if i >= len(parts) || parts[i] == "*" || parts[i] == "-" {
+		return ""
+	}
+	return parts[i]
+}
+
+func hostName(result *results.NmapResult) string {
+	return firstNonEmpty(result.HostName, result.HostAddress)
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
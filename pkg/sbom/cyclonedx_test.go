@@ -0,0 +1,118 @@
+package sbom
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/kptm-tools/common/common/pkg/enums"
+	"github.com/kptm-tools/common/common/pkg/results/tools"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/results"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func vuln(id string, score float64, severity enums.SeverityType) results.Vulnerability {
+	return results.Vulnerability{Vulnerability: tools.Vulnerability{
+		ID:            id,
+		BaseCVSSScore: score,
+		BaseSeverity:  severity,
+	}}
+}
+
+func TestGenerate(t *testing.T) {
+	t.Parallel()
+	result := &results.NmapResult{
+		HostName:    "db01",
+		HostAddress: "10.0.0.5",
+		MostLikelyOS: results.OSData{
+			Name:            "Linux 5.4",
+			Accuracy:        96,
+			CPE:             "cpe:2.3:o:linux:linux_kernel:5.4:*:*:*:*:*:*:*",
+			Vulnerabilities: []results.Vulnerability{vuln("CVE-2021-0001", 7.8, enums.SeverityTypeHigh)},
+		},
+		ScannedPorts: []results.PortData{
+			{
+				ID:              22,
+				Protocol:        "tcp",
+				Service:         tools.Service{Name: "ssh", Version: "8.2p1", CPE: "cpe:2.3:a:openbsd:openssh:8.2p1:*:*:*:*:*:*:*"},
+				State:           "open",
+				Vulnerabilities: []results.Vulnerability{vuln("CVE-2021-0002", 5.3, enums.SeverityTypeMedium)},
+			},
+			{
+				ID:              2222,
+				Protocol:        "tcp",
+				Service:         tools.Service{Name: "ssh", CPE: "cpe:2.3:a:openbsd:openssh:8.2p1:*:*:*:*:*:*:*"},
+				State:           "open",
+				Vulnerabilities: []results.Vulnerability{vuln("CVE-2021-0002", 5.3, enums.SeverityTypeMedium)},
+			},
+			{ID: 80, Protocol: "tcp", Service: tools.Service{Name: "http"}, State: "open"},
+		},
+	}
+
+	bom := Generate(result)
+
+	assert.Equal(t, "CycloneDX", bom.BOMFormat)
+	assert.Equal(t, "1.5", bom.SpecVersion)
+	assert.Regexp(t, `^urn:uuid:[0-9a-f-]{36}$`, bom.SerialNumber)
+	assert.Equal(t, "db01", bom.Metadata.Component.Name)
+
+	require.Len(t, bom.Components, 4)
+	assert.Equal(t, Component{
+		BOMRef:     "os",
+		Type:       "operating-system",
+		Name:       "Linux 5.4",
+		Version:    "5.4",
+		CPE:        "cpe:2.3:o:linux:linux_kernel:5.4:*:*:*:*:*:*:*",
+		Properties: []Property{{Name: "nmap:accuracy", Value: "96"}},
+	}, bom.Components[0])
+	assert.Equal(t, "port-tcp-22", bom.Components[1].BOMRef)
+	assert.Equal(t, "application", bom.Components[1].Type)
+	assert.Equal(t, "openssh", bom.Components[1].Name)
+	assert.Equal(t, "8.2p1", bom.Components[1].Version)
+	assert.Equal(t, "8.2p1", bom.Components[2].Version, "version falls back to the CPE")
+	assert.Equal(t, "http", bom.Components[3].Name)
+	assert.Empty(t, bom.Components[3].CPE)
+
+	require.Len(t, bom.Vulnerabilities, 2)
+	assert.Equal(t, "CVE-2021-0001", bom.Vulnerabilities[0].ID)
+	assert.Equal(t, []Affect{{Ref: "os"}}, bom.Vulnerabilities[0].Affects)
+	assert.Equal(t, "high", bom.Vulnerabilities[0].Ratings[0].Severity)
+	assert.Equal(t, []Affect{{Ref: "port-tcp-22"}, {Ref: "port-tcp-2222"}}, bom.Vulnerabilities[1].Affects)
+
+	data, err := json.Marshal(bom)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"bom-ref":"port-tcp-22"`)
+}
+
+func TestGenerate_NoComponents(t *testing.T) {
+	t.Parallel()
+	bom := Generate(&results.NmapResult{HostAddress: "10.0.0.9"})
+
+	assert.Equal(t, "10.0.0.9", bom.Metadata.Component.Name)
+	assert.Empty(t, bom.Components)
+	assert.Nil(t, bom.Vulnerabilities)
+
+	data, err := json.Marshal(bom)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"components":[]`)
+	assert.NotContains(t, string(data), "vulnerabilities")
+}
+
+func Test_componentType(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		cpe  string
+		want string
+	}{
+		{"cpe:2.3:h:cisco:asa_5505:-:*:*:*:*:*:*:*", "device"},
+		{"cpe:2.3:o:cisco:adaptive_security_appliance_software:9.8:*:*:*:*:*:*:*", "operating-system"},
+		{"cpe:2.3:a:apache:http_server:2.4.49:*:*:*:*:*:*:*", "application"},
+		{"", "application"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.want, func(t *testing.T) {
+			assert.Equal(t, tc.want, componentType(tc.cpe))
+		})
+	}
+}
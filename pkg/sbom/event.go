@@ -0,0 +1,32 @@
+package sbom
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// SubjectSuffix is appended to the subject of a tool result to publish the
+// inventory of its host.
+const SubjectSuffix = ".sbom"
+
+// Event carries the CycloneDX inventory of a scanned host alongside its
+// findings.
+type Event struct {
+	ScanID      uuid.UUID `json:"scan_id"`
+	TenantID    string    `json:"tenant_id,omitempty"`
+	HostAddress string    `json:"host_address"`
+	BOM         *BOM      `json:"bom"`
+	Timestamp   int64     `json:"timestamp"`
+}
+
+// NewEvent wraps bom in an event for the given scan.
+func NewEvent(scanID uuid.UUID, tenantID, host string, bom *BOM) Event {
+	return Event{
+		ScanID:      scanID,
+		TenantID:    tenantID,
+		HostAddress: host,
+		BOM:         bom,
+		Timestamp:   time.Now().Unix(),
+	}
+}
@@ -0,0 +1,234 @@
+// Package scans keeps the hosts of recent scans with their enrichment, so that
+// a host or a single CPE can be analyzed again, e.g. after a patch window,
+// without scanning again nor processing the rest of the scan. Every analysis
+// is kept as a revision, for auditors to reconstruct the results as of a
+// past time.
+package scans
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Ullaakut/nmap/v2"
+	"github.com/google/uuid"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/results"
+)
+
+var (
+	ErrNotFound       = errors.New("host not found in recent scans")
+	ErrCPENotFound    = errors.New("CPE not detected on the host")
+	ErrHistoryEvicted = errors.New("results as of the requested time are no longer retained")
+)
+
+// Record is a revision of a scanned host with its enrichment. Each analysis
+// of the host, the scan and every reanalysis, adds a revision.
+type Record struct {
+	ScanID    uuid.UUID
+	TenantID  string
+	Host      nmap.Host
+	ScannedAt time.Time
+
+	// Result is the enrichment before the findings were classified and
+	// prepared for publication, which a reanalysis starts from.
+	Result *results.NmapResult
+
+	// Final is the result once classified, as handed over for publication,
+	// and AnalyzedAt when this revision was made.
+	Final      *results.NmapResult
+	AnalyzedAt time.Time
+	Revision   int
+}
+
+type key struct {
+	scanID      uuid.UUID
+	hostAddress string
+}
+
+// Store holds the revisions of the last scanned hosts, evicting the oldest
+// hosts beyond its capacity, so that past results can be reconstructed as
+// far back as the hosts it holds. It is safe for concurrent use.
+type Store struct {
+	mu        sync.Mutex
+	revisions map[key][]Record
+	order     []key
+	capacity  int
+
+	// evicted marks the hosts of each tenant with evicted revisions, a
+	// host's results can't be reconstructed from the first of them until a
+	// later scan of the host supersedes them.
+	evicted map[hostKey]eviction
+}
+
+type hostKey struct {
+	tenantID    string
+	hostAddress string
+}
+
+// eviction is the time of the first evicted revision of a host and the time
+// of the latest evicted scan of it.
+type eviction struct {
+	since     time.Time
+	scannedAt time.Time
+}
+
+// NewStore returns a store holding up to capacity hosts.
+func NewStore(capacity int) *Store {
+	return &Store{revisions: make(map[key][]Record), evicted: make(map[hostKey]eviction), capacity: max(capacity, 1)}
+}
+
+// Save records a revision of a scanned host. Saving a host of the same scan
+// again, e.g. after a reanalysis, adds a revision keeping the time of the
+// scan; the previous revisions stay available to AsOf.
+func (s *Store) Save(r Record) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if r.AnalyzedAt.IsZero() {
+		r.AnalyzedAt = r.ScannedAt
+	}
+	k := key{scanID: r.ScanID, hostAddress: r.Result.HostAddress}
+	revisions, ok := s.revisions[k]
+	if !ok {
+		s.order = append(s.order, k)
+	} else {
+		r.ScannedAt = revisions[0].ScannedAt
+	}
+	r.Revision = len(revisions) + 1
+	s.revisions[k] = append(revisions, r)
+
+	for len(s.order) > s.capacity {
+		s.evict(s.revisions[s.order[0]])
+		delete(s.revisions, s.order[0])
+		s.order = s.order[1:]
+	}
+}
+
+// evict marks the host of revisions, those of a scan, as evicted.
+func (s *Store) evict(revisions []Record) {
+	if len(revisions) == 0 {
+		return
+	}
+	k := hostKey{tenantID: revisions[0].TenantID, hostAddress: revisions[0].Result.HostAddress}
+	e, ok := s.evicted[k]
+	if !ok || revisions[0].AnalyzedAt.Before(e.since) {
+		e.since = revisions[0].AnalyzedAt
+	}
+	if revisions[0].ScannedAt.After(e.scannedAt) {
+		e.scannedAt = revisions[0].ScannedAt
+	}
+	s.evicted[k] = e
+}
+
+// Get returns the latest revision of a host of a scan.
+func (s *Store) Get(scanID uuid.UUID, hostAddress string) (Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	revisions, ok := s.revisions[key{scanID: scanID, hostAddress: hostAddress}]
+	if !ok {
+		return Record{}, ErrNotFound
+	}
+	return revisions[len(revisions)-1], nil
+}
+
+// GetAsOf returns the revision of a host of a scan current at the given
+// time, ignoring the later reanalyses.
+func (s *Store) GetAsOf(scanID uuid.UUID, hostAddress string, at time.Time) (Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r, ok := asOf(s.revisions[key{scanID: scanID, hostAddress: hostAddress}], at)
+	if !ok {
+		return Record{}, ErrNotFound
+	}
+	return r, nil
+}
+
+// AsOf returns the results of the hosts of a tenant as they stood at the
+// given time: for each host, the revision current then of its latest scan
+// by then, sorted by host address. It returns ErrHistoryEvicted when the
+// revision current then of a host may have been evicted, rather than a
+// partial posture.
+func (s *Store) AsOf(tenantID string, at time.Time) ([]Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	latest := make(map[string]Record)
+	for k, revisions := range s.revisions {
+		r, ok := asOf(revisions, at)
+		if !ok || r.TenantID != tenantID {
+			continue
+		}
+		if prev, ok := latest[k.hostAddress]; !ok || r.ScannedAt.After(prev.ScannedAt) {
+			latest[k.hostAddress] = r
+		}
+	}
+
+	for k, e := range s.evicted {
+		if k.tenantID != tenantID || e.since.After(at) {
+			continue
+		}
+		if r, ok := latest[k.hostAddress]; !ok || !r.ScannedAt.After(e.scannedAt) {
+			return nil, fmt.Errorf("%w: %s was evicted", ErrHistoryEvicted, k.hostAddress)
+		}
+	}
+
+	records := make([]Record, 0, len(latest))
+	for _, r := range latest {
+		records = append(records, r)
+	}
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].Result.HostAddress < records[j].Result.HostAddress
+	})
+	return records, nil
+}
+
+// Latest returns the latest revision of every recorded host of every scan,
+// oldest analysis first.
+func (s *Store) Latest() []Record {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	records := make([]Record, 0, len(s.revisions))
+	for _, revisions := range s.revisions {
+		records = append(records, revisions[len(revisions)-1])
+	}
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].AnalyzedAt.Before(records[j].AnalyzedAt)
+	})
+	return records
+}
+
+// asOf returns the last of revisions made at or before at.
+func asOf(revisions []Record, at time.Time) (Record, bool) {
+	for i := len(revisions) - 1; i >= 0; i-- {
+		if !revisions[i].AnalyzedAt.After(at) {
+			return revisions[i], true
+		}
+	}
+	return Record{}, false
+}
+
+// Len returns the number of recorded hosts.
+func (s *Store) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.revisions)
+}
+
+type contextKey struct{}
+
+// WithScanID returns a copy of ctx carrying the ID of the scan being analyzed.
+func WithScanID(ctx context.Context, id uuid.UUID) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// ScanIDFromContext returns the scan ID stored in ctx, if any.
+func ScanIDFromContext(ctx context.Context) (uuid.UUID, bool) {
+	id, ok := ctx.Value(contextKey{}).(uuid.UUID)
+	return id, ok
+}
@@ -0,0 +1,137 @@
+package scans
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/results"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStore(t *testing.T) {
+	t.Parallel()
+	store := NewStore(2)
+	scanID := uuid.New()
+	for _, address := range []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"} {
+		store.Save(Record{ScanID: scanID, TenantID: "acme", Result: &results.NmapResult{HostAddress: address}})
+	}
+	assert.Equal(t, 2, store.Len())
+
+	_, err := store.Get(scanID, "10.0.0.1")
+	assert.ErrorIs(t, err, ErrNotFound, "Expected the oldest host to be evicted")
+	record, err := store.Get(scanID, "10.0.0.3")
+	require.NoError(t, err)
+	assert.Equal(t, "acme", record.TenantID)
+
+	// Saving a host again replaces it without evicting another one
+	store.Save(Record{ScanID: scanID, TenantID: "globex", Result: &results.NmapResult{HostAddress: "10.0.0.2"}})
+	assert.Equal(t, 2, store.Len())
+	record, err = store.Get(scanID, "10.0.0.2")
+	require.NoError(t, err)
+	assert.Equal(t, "globex", record.TenantID)
+
+	_, err = store.Get(uuid.New(), "10.0.0.3")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestStore_AsOf(t *testing.T) {
+	t.Parallel()
+	store := NewStore(10)
+	scanned := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	first, second := uuid.New(), uuid.New()
+	save := func(scanID uuid.UUID, tenantID, address string, ports int, at time.Time) {
+		store.Save(Record{
+			ScanID:     scanID,
+			TenantID:   tenantID,
+			Result:     &results.NmapResult{HostAddress: address, ScannedPorts: make([]results.PortData, ports)},
+			ScannedAt:  at,
+			AnalyzedAt: at,
+		})
+	}
+	save(first, "acme", "10.0.0.1", 1, scanned)
+	save(first, "acme", "10.0.0.2", 1, scanned)
+	save(first, "globex", "10.0.0.3", 1, scanned)
+	// Reanalysis of 10.0.0.1 and a later scan of 10.0.0.2
+	save(first, "acme", "10.0.0.1", 2, scanned.Add(time.Hour))
+	save(second, "acme", "10.0.0.2", 3, scanned.Add(24*time.Hour))
+
+	record, err := store.Get(first, "10.0.0.1")
+	require.NoError(t, err)
+	assert.Equal(t, 2, record.Revision)
+	assert.Equal(t, scanned, record.ScannedAt, "Expected revisions to keep the time of the scan")
+	assert.Equal(t, scanned.Add(time.Hour), record.AnalyzedAt)
+
+	record, err = store.GetAsOf(first, "10.0.0.1", scanned.Add(30*time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, 1, record.Revision)
+	assert.Len(t, record.Result.ScannedPorts, 1)
+	_, err = store.GetAsOf(first, "10.0.0.1", scanned.Add(-time.Minute))
+	assert.ErrorIs(t, err, ErrNotFound, "Expected hosts not analyzed yet to be unknown")
+
+	ports := func(records []Record) map[string]int {
+		m := make(map[string]int)
+		for _, r := range records {
+			m[r.Result.HostAddress] = len(r.Result.ScannedPorts)
+		}
+		return m
+	}
+	asOf := func(tenantID string, at time.Time) []Record {
+		records, err := store.AsOf(tenantID, at)
+		require.NoError(t, err)
+		return records
+	}
+	assert.Equal(t, map[string]int{"10.0.0.1": 1, "10.0.0.2": 1}, ports(asOf("acme", scanned.Add(30*time.Minute))))
+	assert.Equal(t, map[string]int{"10.0.0.1": 2, "10.0.0.2": 1}, ports(asOf("acme", scanned.Add(2*time.Hour))))
+	assert.Equal(t, map[string]int{"10.0.0.1": 2, "10.0.0.2": 3}, ports(asOf("acme", scanned.Add(48*time.Hour))))
+	assert.Empty(t, asOf("acme", scanned.Add(-time.Minute)))
+	assert.Len(t, asOf("globex", scanned), 1)
+
+	latest := store.Latest()
+	require.Len(t, latest, 4, "Expected the latest revision of each host of each scan")
+	assert.Equal(t, 2, latest[2].Revision)
+	assert.Equal(t, second, latest[3].ScanID)
+}
+
+func TestStore_AsOf_Evicted(t *testing.T) {
+	t.Parallel()
+	store := NewStore(2)
+	scanned := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	save := func(address string, at time.Time) {
+		store.Save(Record{ScanID: uuid.New(), TenantID: "acme", Result: &results.NmapResult{HostAddress: address}, ScannedAt: at, AnalyzedAt: at})
+	}
+	// The second scan of 10.0.0.1 supersedes the evicted first one
+	save("10.0.0.1", scanned)
+	save("10.0.0.1", scanned.Add(time.Hour))
+	save("10.0.0.2", scanned.Add(2*time.Hour))
+
+	records, err := store.AsOf("acme", scanned.Add(2*time.Hour))
+	require.NoError(t, err)
+	assert.Len(t, records, 2)
+	_, err = store.AsOf("acme", scanned.Add(30*time.Minute))
+	assert.ErrorIs(t, err, ErrHistoryEvicted, "Expected the evicted scan not to be left out silently")
+	records, err = store.AsOf("acme", scanned.Add(-time.Minute))
+	require.NoError(t, err)
+	assert.Empty(t, records)
+
+	// 10.0.0.1 is no longer retained at all
+	save("10.0.0.3", scanned.Add(3*time.Hour))
+	_, err = store.AsOf("acme", scanned.Add(3*time.Hour))
+	assert.ErrorIs(t, err, ErrHistoryEvicted)
+	records, err = store.AsOf("globex", scanned.Add(3*time.Hour))
+	require.NoError(t, err)
+	assert.Empty(t, records)
+}
+
+func TestScanIDFromContext(t *testing.T) {
+	t.Parallel()
+	_, ok := ScanIDFromContext(context.Background())
+	assert.False(t, ok)
+
+	id := uuid.New()
+	got, ok := ScanIDFromContext(WithScanID(context.Background(), id))
+	assert.True(t, ok)
+	assert.Equal(t, id, got)
+}
@@ -0,0 +1,121 @@
+// Package search indexes published findings into Elasticsearch or OpenSearch,
+// one document per finding, so that customers can explore them in Kibana or
+// OpenSearch Dashboards and build their own alerting on top.
+package search
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/results"
+)
+
+// Document is the indexed form of a finding, flattened with the host and
+// port it was found on.
+type Document struct {
+	Timestamp time.Time `json:"@timestamp"`
+	ScanID    string    `json:"scan_id"`
+	TenantID  string    `json:"tenant_id,omitempty"`
+
+	HostName        string   `json:"host_name,omitempty"`
+	HostAddress     string   `json:"host_address"`
+	Exposure        string   `json:"exposure,omitempty"`
+	Classifications []string `json:"classifications,omitempty"`
+	ReportGroup     string   `json:"report_group,omitempty"`
+	OS              string   `json:"os,omitempty"`
+
+	// Port is zero for findings of the operating system
+	Port     uint16 `json:"port,omitempty"`
+	Protocol string `json:"protocol,omitempty"`
+	Service  string `json:"service,omitempty"`
+	Product  string `json:"product,omitempty"`
+	CPE      string `json:"cpe,omitempty"`
+
+	CVE            string     `json:"cve"`
+	Severity       string     `json:"severity"`
+	CVSSScore      float64    `json:"cvss_score"`
+	RiskScore      float64    `json:"risk_score,omitempty"`
+	EPSS           *float64   `json:"epss,omitempty"`
+	KnownExploited bool       `json:"known_exploited,omitempty"`
+	Likelihood     string     `json:"likelihood,omitempty"`
+	Exploitability string     `json:"exploitability,omitempty"`
+	Title          string     `json:"title,omitempty"`
+	CWEs           []string   `json:"cwes,omitempty"`
+	Description    string     `json:"description,omitempty"`
+	Published      *time.Time `json:"published,omitempty"`
+	KBs            []string   `json:"kbs,omitempty"`
+	Source         string     `json:"source,omitempty"`
+
+	// Backfilled lists the fields filled after the finding was indexed, or
+	// looked up without result, so that a backfill doesn't look them up again.
+	Backfilled []string `json:"backfilled,omitempty"`
+}
+
+// Documents flattens the findings of result into documents.
+func Documents(scanID uuid.UUID, tenantID string, result *results.NmapResult, at time.Time) []Document {
+	host := Document{
+		Timestamp:       at.UTC(),
+		ScanID:          scanID.String(),
+		TenantID:        tenantID,
+		HostName:        result.HostName,
+		HostAddress:     result.HostAddress,
+		Exposure:        string(result.Exposure),
+		Classifications: result.Classifications,
+		ReportGroup:     result.ReportGroup,
+		OS:              result.MostLikelyOS.Name,
+	}
+
+	var docs []Document
+	osDoc := host
+	osDoc.CPE = result.MostLikelyOS.CPE
+	for _, vuln := range result.MostLikelyOS.Vulnerabilities {
+		docs = append(docs, finding(osDoc, vuln))
+	}
+	for _, port := range result.ScannedPorts {
+		portDoc := host
+		portDoc.Port = port.ID
+		portDoc.Protocol = port.Protocol
+		portDoc.Service = port.Service.Name
+		portDoc.Product = port.Product
+		portDoc.CPE = port.Service.CPE
+		for _, vuln := range port.Vulnerabilities {
+			docs = append(docs, finding(portDoc, vuln))
+		}
+	}
+	return docs
+}
+
+func finding(doc Document, vuln results.Vulnerability) Document {
+	doc.CVE = vuln.ID
+	doc.Severity = string(vuln.BaseSeverity)
+	doc.CVSSScore = vuln.BaseCVSSScore
+	doc.RiskScore = vuln.RiskScore
+	doc.EPSS = vuln.EPSS
+	doc.KnownExploited = vuln.KnownExploited
+	doc.Likelihood = string(vuln.Likelihood)
+	doc.Exploitability = string(vuln.Exploit.Exploitability)
+	doc.Title = vuln.Title
+	doc.CWEs = vuln.CWEs
+	doc.Description = vuln.Description
+	if !vuln.Published.IsZero() {
+		published := vuln.Published
+		doc.Published = &published
+	}
+	for _, kb := range vuln.KBs {
+		doc.KBs = append(doc.KBs, kb.ID)
+	}
+	if vuln.Provenance != nil {
+		doc.Source = vuln.Provenance.Source
+	}
+	return doc
+}
+
+// id identifies the document of a finding within a scan, so that indexing a
+// result twice overwrites its documents instead of duplicating them.
+func (d Document) id() string {
+	sum := sha1.Sum([]byte(d.ScanID + "|" + d.HostAddress + "|" + d.Protocol + "|" + strconv.Itoa(int(d.Port)) + "|" + d.CVE))
+	return hex.EncodeToString(sum[:])
+}
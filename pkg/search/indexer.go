@@ -0,0 +1,215 @@
+package search
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/results"
+)
+
+// DefaultBulkSize is the number of documents sent per bulk request.
+const DefaultBulkSize = 500
+
+// Indexer bulk-indexes findings into daily indices named after a prefix, e.g.
+// vulnerability-findings-2024.06.01, through the REST API Elasticsearch and
+// OpenSearch share.
+type Indexer struct {
+	baseURL  string
+	prefix   string
+	client   *http.Client
+	bulkSize int
+
+	mu                 sync.RWMutex
+	username, password string
+	apiKey             string
+}
+
+// Option configures an Indexer.
+type Option func(*Indexer)
+
+// NewIndexer returns an indexer of the cluster at baseURL writing to the
+// indices of prefix.
+func NewIndexer(baseURL, prefix string, opts ...Option) *Indexer {
+	i := &Indexer{
+		baseURL:  strings.TrimRight(baseURL, "/"),
+		prefix:   prefix,
+		client:   &http.Client{Timeout: 30 * time.Second},
+		bulkSize: DefaultBulkSize,
+	}
+	for _, opt := range opts {
+		opt(i)
+	}
+	return i
+}
+
+// WithBasicAuth authenticates with a username and password.
+func WithBasicAuth(username, password string) Option {
+	return func(i *Indexer) {
+		i.username, i.password = username, password
+	}
+}
+
+// WithAPIKey authenticates with an Elasticsearch API key, given encoded as
+// returned by the create API key API.
+func WithAPIKey(key string) Option {
+	return func(i *Indexer) {
+		i.apiKey = key
+	}
+}
+
+// ReplaceCredentials swaps the credentials of the indexer, e.g. once a secret
+// was rotated. An API key takes precedence over the username and password.
+func (i *Indexer) ReplaceCredentials(username, password, apiKey string) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.username, i.password, i.apiKey = username, password, apiKey
+}
+
+// WithHTTPClient replaces the HTTP client issuing the requests.
+func WithHTTPClient(client *http.Client) Option {
+	return func(i *Indexer) {
+		i.client = client
+	}
+}
+
+// WithBulkSize sets the number of documents sent per bulk request.
+func WithBulkSize(n int) Option {
+	return func(i *Indexer) {
+		if n > 0 {
+			i.bulkSize = n
+		}
+	}
+}
+
+// EnsureTemplate installs the index template mapping the fields of Document
+// on the indices of the prefix, replacing a previous version.
+func (i *Indexer) EnsureTemplate(ctx context.Context) error {
+	body, err := json.Marshal(indexTemplate(i.prefix))
+	if err != nil {
+		return fmt.Errorf("failed to encode index template: %w", err)
+	}
+	if _, err := i.do(ctx, http.MethodPut, "/_index_template/"+i.prefix, "application/json", body); err != nil {
+		return fmt.Errorf("failed to install index template %s: %w", i.prefix, err)
+	}
+	return nil
+}
+
+// Index indexes the findings of result, returning the number of documents
+// indexed. Documents the cluster rejects are reported in the error while the
+// rest of the batch is kept.
+func (i *Indexer) Index(ctx context.Context, scanID uuid.UUID, tenantID string, result *results.NmapResult, at time.Time) (int, error) {
+	docs := Documents(scanID, tenantID, result, at)
+	index := i.prefix + "-" + at.UTC().Format("2006.01.02")
+
+	indexed := 0
+	for start := 0; start < len(docs); start += i.bulkSize {
+		n, err := i.bulk(ctx, index, docs[start:min(start+i.bulkSize, len(docs))])
+		indexed += n
+		if err != nil {
+			return indexed, err
+		}
+	}
+	return indexed, nil
+}
+
+type bulkResponse struct {
+	Errors bool `json:"errors"`
+	Items  []map[string]struct {
+		Status int `json:"status"`
+		Error  *struct {
+			Type   string `json:"type"`
+			Reason string `json:"reason"`
+		} `json:"error"`
+	} `json:"items"`
+}
+
+func (i *Indexer) bulk(ctx context.Context, index string, docs []Document) (int, error) {
+	var body bytes.Buffer
+	enc := json.NewEncoder(&body)
+	for _, doc := range docs {
+		action := map[string]any{"index": map[string]string{"_index": index, "_id": doc.id()}}
+		if err := enc.Encode(action); err != nil {
+			return 0, fmt.Errorf("failed to encode bulk action: %w", err)
+		}
+		if err := enc.Encode(doc); err != nil {
+			return 0, fmt.Errorf("failed to encode finding %s: %w", doc.CVE, err)
+		}
+	}
+
+	respBody, err := i.do(ctx, http.MethodPost, "/_bulk", "application/x-ndjson", body.Bytes())
+	if err != nil {
+		return 0, fmt.Errorf("failed to index findings into %s: %w", index, err)
+	}
+	return bulkResult(respBody, index, len(docs))
+}
+
+// bulkResult returns the number of the n actions of a bulk request the
+// cluster applied, reporting the rejected ones in the error.
+func bulkResult(respBody []byte, index string, n int) (int, error) {
+	var resp bulkResponse
+	if err := json.Unmarshal(respBody, &resp); err != nil {
+		return 0, fmt.Errorf("failed to decode bulk response: %w", err)
+	}
+	if !resp.Errors {
+		return n, nil
+	}
+
+	failed := 0
+	var reason string
+	for _, item := range resp.Items {
+		for _, result := range item {
+			if result.Error == nil {
+				continue
+			}
+			failed++
+			if reason == "" {
+				reason = result.Error.Type + ": " + result.Error.Reason
+			}
+		}
+	}
+	slog.Warn("Search cluster rejected findings",
+		slog.String("index", index),
+		slog.Int("rejected", failed),
+		slog.String("reason", reason))
+	return n - failed, fmt.Errorf("%d of %d findings rejected by %s: %s", failed, n, index, reason)
+}
+
+func (i *Indexer) do(ctx context.Context, method, path, contentType string, body []byte) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, method, i.baseURL+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", contentType)
+	i.mu.RLock()
+	switch {
+	case i.apiKey != "":
+		req.Header.Set("Authorization", "ApiKey "+i.apiKey)
+	case i.username != "":
+		req.SetBasicAuth(i.username, i.password)
+	}
+	i.mu.RUnlock()
+
+	resp, err := i.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("unexpected status %s: %s", resp.Status, bytes.TrimSpace(respBody))
+	}
+	return respBody, nil
+}
@@ -0,0 +1,191 @@
+package search
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kptm-tools/common/common/pkg/enums"
+	"github.com/kptm-tools/common/common/pkg/results/tools"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/results"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testResult() *results.NmapResult {
+	return &results.NmapResult{
+		HostName:    "dc01",
+		HostAddress: "10.0.0.5",
+		MostLikelyOS: results.OSData{
+			Name: "Microsoft Windows Server 2016",
+			CPE:  "cpe:2.3:o:microsoft:windows_server_2016:-:*:*:*:*:*:*:*",
+			Vulnerabilities: []results.Vulnerability{{
+				Vulnerability: tools.Vulnerability{ID: "CVE-2024-20674", BaseCVSSScore: 9, BaseSeverity: enums.SeverityTypeCritical},
+				KBs:           []results.KBUpdate{{ID: "KB5034119"}},
+			}},
+		},
+		ScannedPorts: []results.PortData{{
+			ID:       22,
+			Protocol: "tcp",
+			Service:  tools.Service{Name: "ssh", CPE: "cpe:2.3:a:openbsd:openssh:8.2:*:*:*:*:*:*:*"},
+			Vulnerabilities: []results.Vulnerability{
+				{Vulnerability: tools.Vulnerability{ID: "CVE-2023-38408", BaseCVSSScore: 9.8, BaseSeverity: enums.SeverityTypeCritical}},
+				{Vulnerability: tools.Vulnerability{ID: "CVE-2023-48795", BaseCVSSScore: 5.9, BaseSeverity: enums.SeverityTypeMedium}},
+			},
+		}},
+	}
+}
+
+func TestDocuments(t *testing.T) {
+	t.Parallel()
+	scanID := uuid.New()
+	at := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	docs := Documents(scanID, "acme", testResult(), at)
+	require.Len(t, docs, 3)
+
+	assert.Equal(t, "CVE-2024-20674", docs[0].CVE)
+	assert.Zero(t, docs[0].Port)
+	assert.Equal(t, "Microsoft Windows Server 2016", docs[0].OS)
+	assert.Equal(t, []string{"KB5034119"}, docs[0].KBs)
+	assert.Nil(t, docs[0].Published)
+
+	assert.Equal(t, uint16(22), docs[1].Port)
+	assert.Equal(t, "ssh", docs[1].Service)
+	assert.Equal(t, "Critical", docs[1].Severity)
+	assert.Equal(t, "acme", docs[1].TenantID)
+	assert.Equal(t, scanID.String(), docs[1].ScanID)
+	assert.NotEqual(t, docs[1].id(), docs[2].id())
+	assert.Equal(t, docs[1].id(), Documents(scanID, "acme", testResult(), at.Add(time.Hour))[1].id(), "Expected reindexing a scan to overwrite its documents")
+}
+
+func TestIndexer(t *testing.T) {
+	t.Parallel()
+	var mu sync.Mutex
+	var paths, auths []string
+	var actions []map[string]map[string]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		defer mu.Unlock()
+		paths = append(paths, r.Method+" "+r.URL.Path)
+		auths = append(auths, r.Header.Get("Authorization"))
+
+		if r.URL.Path != "/_bulk" {
+			w.Write([]byte(`{"acknowledged":true}`))
+			return
+		}
+		assert.Equal(t, "application/x-ndjson", r.Header.Get("Content-Type"))
+		scanner := bufio.NewScanner(bytes.NewReader(body))
+		for line := 0; scanner.Scan(); line++ {
+			if line%2 == 0 {
+				var action map[string]map[string]string
+				require.NoError(t, json.Unmarshal(scanner.Bytes(), &action))
+				actions = append(actions, action)
+			}
+		}
+		w.Write([]byte(`{"errors":false,"items":[]}`))
+	}))
+	defer server.Close()
+
+	indexer := NewIndexer(server.URL+"/", "findings", WithAPIKey("encoded"), WithBulkSize(2))
+	require.NoError(t, indexer.EnsureTemplate(context.Background()))
+
+	at := time.Date(2024, 6, 1, 23, 0, 0, 0, time.FixedZone("UTC-3", -3*3600))
+	indexed, err := indexer.Index(context.Background(), uuid.New(), "acme", testResult(), at)
+	require.NoError(t, err)
+	assert.Equal(t, 3, indexed)
+
+	assert.Equal(t, []string{"PUT /_index_template/findings", "POST /_bulk", "POST /_bulk"}, paths)
+	assert.Equal(t, []string{"ApiKey encoded", "ApiKey encoded", "ApiKey encoded"}, auths)
+	require.Len(t, actions, 3)
+	assert.Equal(t, "findings-2024.06.02", actions[0]["index"]["_index"], "Expected daily indices in UTC")
+	assert.Len(t, actions[0]["index"]["_id"], 40)
+
+	indexer.ReplaceCredentials("", "", "rotated")
+	require.NoError(t, indexer.EnsureTemplate(context.Background()))
+	assert.Equal(t, "ApiKey rotated", auths[len(auths)-1], "Expected the rotated API key")
+}
+
+func TestIndexer_Rejected(t *testing.T) {
+	t.Parallel()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, ok := r.BasicAuth()
+		assert.True(t, ok)
+		assert.Equal(t, "elastic", user)
+		assert.Equal(t, "changeme", pass)
+		w.Write([]byte(`{"errors":true,"items":[
+			{"index":{"status":201}},
+			{"index":{"status":400,"error":{"type":"mapper_parsing_exception","reason":"failed to parse field [cvss_score]"}}},
+			{"index":{"status":201}}
+		]}`))
+	}))
+	defer server.Close()
+
+	indexer := NewIndexer(server.URL, "findings", WithBasicAuth("elastic", "changeme"))
+	indexed, err := indexer.Index(context.Background(), uuid.New(), "", testResult(), time.Now())
+	assert.Equal(t, 2, indexed)
+	assert.ErrorContains(t, err, "mapper_parsing_exception")
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"error":"security_exception"}`, http.StatusUnauthorized)
+	}))
+	defer failing.Close()
+	err = NewIndexer(failing.URL, "findings").EnsureTemplate(context.Background())
+	assert.ErrorContains(t, err, "security_exception")
+}
+
+func TestIndexer_MissingAndUpdate(t *testing.T) {
+	t.Parallel()
+	var searches []map[string]any
+	var updates []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		switch r.URL.Path {
+		case "/findings-*/_search":
+			var search map[string]any
+			require.NoError(t, json.Unmarshal(body, &search))
+			searches = append(searches, search)
+			w.Write([]byte(`{"hits":{"hits":[
+				{"_index":"findings-2024.06.01","_id":"a1","_source":{"cve":"CVE-2024-0001","host_address":"10.0.0.1"},"sort":[1717200000000,"s","10.0.0.1","tcp",22,"CVE-2024-0001"]}
+			]}}`))
+		case "/_bulk":
+			updates = append(updates, string(body))
+			w.Write([]byte(`{"errors":false,"items":[]}`))
+		default:
+			t.Errorf("Unexpected request to %s", r.URL.Path)
+		}
+	}))
+	defer server.Close()
+
+	indexer := NewIndexer(server.URL, "findings")
+	hits, err := indexer.Missing(context.Background(), "cwes", nil, 10)
+	require.NoError(t, err)
+	require.Len(t, hits, 1)
+	assert.Equal(t, Hit{
+		Index:    "findings-2024.06.01",
+		ID:       "a1",
+		Document: Document{CVE: "CVE-2024-0001", HostAddress: "10.0.0.1"},
+		Sort:     []any{float64(1717200000000), "s", "10.0.0.1", "tcp", float64(22), "CVE-2024-0001"},
+	}, hits[0])
+	assert.NotContains(t, searches[0], "search_after")
+
+	_, err = indexer.Missing(context.Background(), "cwes", hits[0].Sort, 10)
+	require.NoError(t, err)
+	assert.Equal(t, hits[0].Sort, searches[1]["search_after"])
+
+	updated, err := indexer.Update(context.Background(), []Update{{Index: hits[0].Index, ID: hits[0].ID, Fields: map[string]any{"cwes": []string{"CWE-787"}}}})
+	require.NoError(t, err)
+	assert.Equal(t, 1, updated)
+	assert.Equal(t, []string{
+		`{"update":{"_id":"a1","_index":"findings-2024.06.01"}}` + "\n" + `{"doc":{"cwes":["CWE-787"]}}` + "\n",
+	}, updates)
+}
@@ -0,0 +1,112 @@
+package search
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// storedSort orders the findings of the indices, so that Missing can resume
+// after the last finding of a page. The fields identify a finding like its
+// document ID, which can't be sorted on.
+var storedSort = []map[string]string{
+	{"@timestamp": "asc"},
+	{"scan_id": "asc"},
+	{"host_address": "asc"},
+	{"protocol": "asc"},
+	{"port": "asc"},
+	{"cve": "asc"},
+}
+
+// Hit is a stored finding, with the sort values to resume after it.
+type Hit struct {
+	Index    string
+	ID       string
+	Document Document
+	Sort     []any
+}
+
+// Update sets Fields of the stored finding ID of Index.
+type Update struct {
+	Index  string
+	ID     string
+	Fields map[string]any
+}
+
+// Missing returns up to size findings of the indices of the prefix lacking
+// field and not backfilled for it yet, following the finding whose sort
+// values are after, or from the oldest when nil.
+func (i *Indexer) Missing(ctx context.Context, field string, after []any, size int) ([]Hit, error) {
+	query := map[string]any{
+		"size": size,
+		"sort": storedSort,
+		"query": map[string]any{"bool": map[string]any{"must_not": []any{
+			map[string]any{"exists": map[string]any{"field": field}},
+			map[string]any{"term": map[string]any{"backfilled": field}},
+		}}},
+	}
+	if after != nil {
+		query["search_after"] = after
+	}
+	body, err := json.Marshal(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode search: %w", err)
+	}
+
+	respBody, err := i.do(ctx, http.MethodPost, "/"+i.prefix+"-*/_search", "application/json", body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search findings missing %s: %w", field, err)
+	}
+	var resp struct {
+		Hits struct {
+			Hits []struct {
+				Index  string   `json:"_index"`
+				ID     string   `json:"_id"`
+				Source Document `json:"_source"`
+				Sort   []any    `json:"sort"`
+			} `json:"hits"`
+		} `json:"hits"`
+	}
+	if err := json.Unmarshal(respBody, &resp); err != nil {
+		return nil, fmt.Errorf("failed to decode search response: %w", err)
+	}
+
+	hits := make([]Hit, 0, len(resp.Hits.Hits))
+	for _, h := range resp.Hits.Hits {
+		hits = append(hits, Hit{Index: h.Index, ID: h.ID, Document: h.Source, Sort: h.Sort})
+	}
+	return hits, nil
+}
+
+// Update applies partial updates to stored findings in bulk, returning the
+// number of findings updated.
+func (i *Indexer) Update(ctx context.Context, updates []Update) (int, error) {
+	updated := 0
+	for start := 0; start < len(updates); start += i.bulkSize {
+		batch := updates[start:min(start+i.bulkSize, len(updates))]
+
+		var body bytes.Buffer
+		enc := json.NewEncoder(&body)
+		for _, u := range batch {
+			if err := enc.Encode(map[string]any{"update": map[string]string{"_index": u.Index, "_id": u.ID}}); err != nil {
+				return updated, fmt.Errorf("failed to encode bulk action: %w", err)
+			}
+			if err := enc.Encode(map[string]any{"doc": u.Fields}); err != nil {
+				return updated, fmt.Errorf("failed to encode update of %s: %w", u.ID, err)
+			}
+		}
+
+		respBody, err := i.do(ctx, http.MethodPost, "/_bulk", "application/x-ndjson", body.Bytes())
+		if err != nil {
+			return updated, fmt.Errorf("failed to update findings: %w", err)
+		}
+		n, err := bulkResult(respBody, i.prefix+"-*", len(batch))
+		updated += n
+		if err != nil {
+			return updated, err
+		}
+	}
+	return updated, nil
+}
@@ -0,0 +1,50 @@
+package search
+
+// indexTemplate maps the fields of Document on the indices of prefix.
+// Identifiers and enumerations are keywords, so that they can be aggregated
+// in dashboards, and descriptions are analyzed for full text search.
+func indexTemplate(prefix string) map[string]any {
+	keyword := map[string]any{"type": "keyword"}
+	return map[string]any{
+		"index_patterns": []string{prefix + "-*"},
+		"priority":       100,
+		"template": map[string]any{
+			"settings": map[string]any{
+				"number_of_shards": 1,
+			},
+			"mappings": map[string]any{
+				"properties": map[string]any{
+					"@timestamp":      map[string]any{"type": "date"},
+					"scan_id":         keyword,
+					"tenant_id":       keyword,
+					"host_name":       keyword,
+					"host_address":    keyword,
+					"exposure":        keyword,
+					"classifications": keyword,
+					"report_group":    keyword,
+					"os":              keyword,
+					"port":            map[string]any{"type": "integer"},
+					"protocol":        keyword,
+					"service":         keyword,
+					"product":         keyword,
+					"cpe":             keyword,
+					"cve":             keyword,
+					"severity":        keyword,
+					"cvss_score":      map[string]any{"type": "float"},
+					"risk_score":      map[string]any{"type": "float"},
+					"epss":            map[string]any{"type": "float"},
+					"known_exploited": map[string]any{"type": "boolean"},
+					"likelihood":      keyword,
+					"exploitability":  keyword,
+					"title":           map[string]any{"type": "text"},
+					"cwes":            keyword,
+					"description":     map[string]any{"type": "text"},
+					"published":       map[string]any{"type": "date"},
+					"kbs":             keyword,
+					"source":          keyword,
+					"backfilled":      keyword,
+				},
+			},
+		},
+	}
+}
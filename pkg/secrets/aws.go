@@ -0,0 +1,240 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// AWSSecretsManager reads secrets from AWS Secrets Manager. The name
+// nvd/api#key is the key field of the JSON secret nvd/api, and a name without
+// a field is the whole secret string. Requests are signed with AWS Signature
+// Version 4, with the static AccessKey, SecretKey and SessionToken or, when
+// unset, the temporary credentials of the default chain, refreshed before
+// they expire.
+type AWSSecretsManager struct {
+	Region       string
+	Endpoint     string // Custom endpoint, e.g. a VPC endpoint or LocalStack
+	AccessKey    string
+	SecretKey    string
+	SessionToken string
+
+	client      *http.Client
+	now         func() time.Time
+	credentials *awsCredentialsCache
+}
+
+var _ SecretProvider = (*AWSSecretsManager)(nil)
+
+// NewAWSSecretsManagerFromEnv creates an AWSSecretsManager using the standard
+// AWS_REGION and AWS_ENDPOINT_URL_SECRETS_MANAGER variables, and the
+// credentials of the AWS SDK default chain: AWS_ACCESS_KEY_ID,
+// AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN, a web identity token such as
+// that of IRSA, container credentials, or the role of the EC2 instance.
+// Static session tokens expire, prefer the others in production.
+func NewAWSSecretsManagerFromEnv() (*AWSSecretsManager, error) {
+	m := &AWSSecretsManager{
+		Region:       os.Getenv("AWS_REGION"),
+		Endpoint:     os.Getenv("AWS_ENDPOINT_URL_SECRETS_MANAGER"),
+		AccessKey:    os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretKey:    os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+		client:       &http.Client{Timeout: 30 * time.Second},
+		now:          time.Now,
+	}
+	if m.Region == "" {
+		m.Region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	if m.Region == "" {
+		m.Region = "us-east-1"
+	}
+	source, err := awsCredentialsFromEnv(m.client, m.Region)
+	if err != nil {
+		return nil, err
+	}
+	if source != nil {
+		m.credentials = &awsCredentialsCache{source: source, now: m.now}
+	}
+	return m, nil
+}
+
+// signingCredentials returns the credentials signing the requests of m.
+func (m *AWSSecretsManager) signingCredentials(ctx context.Context) (awsCredentials, error) {
+	if m.credentials == nil {
+		return awsCredentials{AccessKey: m.AccessKey, SecretKey: m.SecretKey, SessionToken: m.SessionToken}, nil
+	}
+	creds, err := m.credentials.retrieve(ctx)
+	if err != nil {
+		return awsCredentials{}, fmt.Errorf("failed to get aws credentials: %w", err)
+	}
+	return creds, nil
+}
+
+func (m *AWSSecretsManager) endpoint() string {
+	if m.Endpoint != "" {
+		return strings.TrimRight(m.Endpoint, "/") + "/"
+	}
+	return fmt.Sprintf("https://secretsmanager.%s.amazonaws.com/", m.Region)
+}
+
+func (m *AWSSecretsManager) Secret(ctx context.Context, name string) (string, error) {
+	secretID, field := splitField(name, "")
+	payload, err := json.Marshal(map[string]string{"SecretId": secretID})
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, m.endpoint(), bytes.NewReader(payload))
+	if err != nil {
+		return "", fmt.Errorf("failed to create secrets manager request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "secretsmanager.GetSecretValue")
+	creds, err := m.signingCredentials(ctx)
+	if err != nil {
+		return "", err
+	}
+	m.sign(req, payload, "secretsmanager", creds)
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed secrets manager request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return "", fmt.Errorf("failed to read secrets manager response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		var awsErr struct {
+			Type    string `json:"__type"`
+			Message string `json:"message"`
+		}
+		_ = json.Unmarshal(body, &awsErr)
+		if strings.HasSuffix(awsErr.Type, "ResourceNotFoundException") {
+			return "", ErrNotFound
+		}
+		return "", fmt.Errorf("unexpected secrets manager response status: %s: %s %s", resp.Status, awsErr.Type, awsErr.Message)
+	}
+
+	var value struct {
+		SecretString string `json:"SecretString"`
+		SecretBinary string `json:"SecretBinary"`
+	}
+	if err := json.Unmarshal(body, &value); err != nil {
+		return "", fmt.Errorf("failed to decode secrets manager response: %w", err)
+	}
+	secret := value.SecretString
+	if secret == "" && value.SecretBinary != "" {
+		binary, err := base64.StdEncoding.DecodeString(value.SecretBinary)
+		if err != nil {
+			return "", fmt.Errorf("failed to decode binary secret: %w", err)
+		}
+		secret = string(binary)
+	}
+	if field == "" {
+		return secret, nil
+	}
+	return jsonField(secret, field)
+}
+
+// jsonField returns the string field of the JSON object secret.
+func jsonField(secret, field string) (string, error) {
+	var fields map[string]any
+	if err := json.Unmarshal([]byte(secret), &fields); err != nil {
+		return "", fmt.Errorf("secret isn't a JSON object: %w", err)
+	}
+	value, ok := fields[field]
+	if !ok {
+		return "", ErrNotFound
+	}
+	s, ok := value.(string)
+	if !ok {
+		return "", fmt.Errorf("secret field %s isn't a string", field)
+	}
+	return s, nil
+}
+
+// sign adds the AWS Signature Version 4 headers of service to req, signed
+// with creds.
+func (m *AWSSecretsManager) sign(req *http.Request, payload []byte, service string, creds awsCredentials) {
+	now := m.now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	payloadHash := sha256Hex(payload)
+
+	req.Header.Set("Host", req.URL.Host)
+	req.Header.Set("X-Amz-Date", amzDate)
+	if creds.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", creds.SessionToken)
+	}
+
+	var names []string
+	for name := range req.Header {
+		names = append(names, strings.ToLower(name))
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + strings.TrimSpace(req.Header.Get(name)) + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		canonicalPath(req.URL),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + m.Region + "/" + service + "/aws4_request"
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		sha256Hex([]byte(canonicalRequest)),
+	}, "\n")
+
+	signingKey := hmacSHA256([]byte("AWS4"+creds.SecretKey), date)
+	signingKey = hmacSHA256(signingKey, m.Region)
+	signingKey = hmacSHA256(signingKey, service)
+	signingKey = hmacSHA256(signingKey, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		creds.AccessKey, scope, signedHeaders, signature))
+}
+
+func canonicalPath(u *url.URL) string {
+	if path := u.EscapedPath(); path != "" {
+		return path
+	}
+	return "/"
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
@@ -0,0 +1,299 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// awsCredentialsRefreshWindow is how long before they expire temporary
+	// credentials are refreshed, so that a request isn't signed with
+	// credentials expiring in flight.
+	awsCredentialsRefreshWindow = 5 * time.Minute
+
+	// awsContainerCredentialsHost is the ECS agent serving the credentials of
+	// AWS_CONTAINER_CREDENTIALS_RELATIVE_URI.
+	awsContainerCredentialsHost = "http://169.254.170.2"
+	// awsInstanceMetadataEndpoint is the EC2 instance metadata service.
+	awsInstanceMetadataEndpoint = "http://169.254.169.254"
+)
+
+// awsCredentials are the credentials signing AWS requests. Expires is zero
+// for static credentials.
+type awsCredentials struct {
+	AccessKey    string
+	SecretKey    string
+	SessionToken string
+	Expires      time.Time
+}
+
+// awsCredentialsSource retrieves AWS credentials, e.g. by exchanging a web
+// identity token or from the instance metadata service.
+type awsCredentialsSource interface {
+	retrieve(ctx context.Context) (awsCredentials, error)
+}
+
+// awsCredentialsCache caches the credentials of a source until they are due
+// to expire.
+type awsCredentialsCache struct {
+	source awsCredentialsSource
+	now    func() time.Time
+
+	mu    sync.Mutex
+	cache awsCredentials
+}
+
+func (c *awsCredentialsCache) retrieve(ctx context.Context) (awsCredentials, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.cache.AccessKey != "" && (c.cache.Expires.IsZero() || c.now().Before(c.cache.Expires.Add(-awsCredentialsRefreshWindow))) {
+		return c.cache, nil
+	}
+	creds, err := c.source.retrieve(ctx)
+	if err != nil {
+		return awsCredentials{}, err
+	}
+	c.cache = creds
+	return creds, nil
+}
+
+// awsCredentialsFromEnv returns the source of the first credentials
+// configured in the order of the AWS SDK default chain: static
+// AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY, a web identity token, e.g. of
+// IRSA on EKS, the container credentials of ECS or EKS Pod Identity, and
+// last the role of the EC2 instance unless AWS_EC2_METADATA_DISABLED is set.
+// It returns nil when the static credentials are configured, the caller
+// signs with those.
+func awsCredentialsFromEnv(client *http.Client, region string) (awsCredentialsSource, error) {
+	switch {
+	case os.Getenv("AWS_ACCESS_KEY_ID") != "" && os.Getenv("AWS_SECRET_ACCESS_KEY") != "":
+		return nil, nil
+	case os.Getenv("AWS_WEB_IDENTITY_TOKEN_FILE") != "" && os.Getenv("AWS_ROLE_ARN") != "":
+		endpoint := os.Getenv("AWS_ENDPOINT_URL_STS")
+		if endpoint == "" {
+			endpoint = fmt.Sprintf("https://sts.%s.amazonaws.com", region)
+		}
+		sessionName := os.Getenv("AWS_ROLE_SESSION_NAME")
+		if sessionName == "" {
+			sessionName = "vulnerability-analysis"
+		}
+		return &webIdentityCredentials{
+			Endpoint:    strings.TrimRight(endpoint, "/") + "/",
+			RoleARN:     os.Getenv("AWS_ROLE_ARN"),
+			SessionName: sessionName,
+			TokenFile:   os.Getenv("AWS_WEB_IDENTITY_TOKEN_FILE"),
+			client:      client,
+		}, nil
+	case os.Getenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI") != "":
+		return &containerCredentials{
+			URL:       awsContainerCredentialsHost + os.Getenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI"),
+			Token:     os.Getenv("AWS_CONTAINER_AUTHORIZATION_TOKEN"),
+			TokenFile: os.Getenv("AWS_CONTAINER_AUTHORIZATION_TOKEN_FILE"),
+			client:    client,
+		}, nil
+	case os.Getenv("AWS_CONTAINER_CREDENTIALS_FULL_URI") != "":
+		return &containerCredentials{
+			URL:       os.Getenv("AWS_CONTAINER_CREDENTIALS_FULL_URI"),
+			Token:     os.Getenv("AWS_CONTAINER_AUTHORIZATION_TOKEN"),
+			TokenFile: os.Getenv("AWS_CONTAINER_AUTHORIZATION_TOKEN_FILE"),
+			client:    client,
+		}, nil
+	case strings.EqualFold(os.Getenv("AWS_EC2_METADATA_DISABLED"), "true"):
+		return nil, errors.New("aws secrets manager found no credentials: set AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY, a web identity token or container credentials")
+	default:
+		endpoint := os.Getenv("AWS_EC2_METADATA_SERVICE_ENDPOINT")
+		if endpoint == "" {
+			endpoint = awsInstanceMetadataEndpoint
+		}
+		return &instanceRoleCredentials{Endpoint: strings.TrimRight(endpoint, "/"), client: client}, nil
+	}
+}
+
+// webIdentityCredentials exchanges a web identity token, e.g. the projected
+// service account token of IRSA, for the credentials of a role with STS
+// AssumeRoleWithWebIdentity. The token file is read on every exchange, as
+// its issuer rotates it.
+type webIdentityCredentials struct {
+	Endpoint    string
+	RoleARN     string
+	SessionName string
+	TokenFile   string
+
+	client *http.Client
+}
+
+func (w *webIdentityCredentials) retrieve(ctx context.Context) (awsCredentials, error) {
+	token, err := os.ReadFile(w.TokenFile)
+	if err != nil {
+		return awsCredentials{}, fmt.Errorf("failed to read web identity token: %w", err)
+	}
+	form := url.Values{
+		"Action":           {"AssumeRoleWithWebIdentity"},
+		"Version":          {"2011-06-15"},
+		"RoleArn":          {w.RoleARN},
+		"RoleSessionName":  {w.SessionName},
+		"WebIdentityToken": {strings.TrimSpace(string(token))},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.Endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return awsCredentials{}, fmt.Errorf("failed to create sts request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return awsCredentials{}, fmt.Errorf("failed sts request: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return awsCredentials{}, fmt.Errorf("failed to read sts response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return awsCredentials{}, fmt.Errorf("unexpected sts response status: %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	var result struct {
+		Credentials struct {
+			AccessKeyID     string    `xml:"AccessKeyId"`
+			SecretAccessKey string    `xml:"SecretAccessKey"`
+			SessionToken    string    `xml:"SessionToken"`
+			Expiration      time.Time `xml:"Expiration"`
+		} `xml:"AssumeRoleWithWebIdentityResult>Credentials"`
+	}
+	if err := xml.Unmarshal(body, &result); err != nil {
+		return awsCredentials{}, fmt.Errorf("failed to decode sts response: %w", err)
+	}
+	if result.Credentials.AccessKeyID == "" {
+		return awsCredentials{}, errors.New("sts response holds no credentials")
+	}
+	return awsCredentials{
+		AccessKey:    result.Credentials.AccessKeyID,
+		SecretKey:    result.Credentials.SecretAccessKey,
+		SessionToken: result.Credentials.SessionToken,
+		Expires:      result.Credentials.Expiration,
+	}, nil
+}
+
+// containerCredentials reads the credentials of the task role of ECS, or of
+// EKS Pod Identity, from the agent serving them.
+type containerCredentials struct {
+	URL       string
+	Token     string
+	TokenFile string // Read for the authorization token before every request
+
+	client *http.Client
+}
+
+func (c *containerCredentials) retrieve(ctx context.Context) (awsCredentials, error) {
+	token := c.Token
+	if c.TokenFile != "" {
+		data, err := os.ReadFile(c.TokenFile)
+		if err != nil {
+			return awsCredentials{}, fmt.Errorf("failed to read container credentials token: %w", err)
+		}
+		token = strings.TrimSpace(string(data))
+	}
+	header := http.Header{}
+	if token != "" {
+		header.Set("Authorization", token)
+	}
+	return getCredentialsDocument(ctx, c.client, c.URL, header)
+}
+
+// instanceRoleCredentials reads the credentials of the role of the EC2
+// instance from the instance metadata service, with an IMDSv2 session token.
+type instanceRoleCredentials struct {
+	Endpoint string
+
+	client *http.Client
+}
+
+func (i *instanceRoleCredentials) retrieve(ctx context.Context) (awsCredentials, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, i.Endpoint+"/latest/api/token", nil)
+	if err != nil {
+		return awsCredentials{}, fmt.Errorf("failed to create instance metadata token request: %w", err)
+	}
+	req.Header.Set("X-aws-ec2-metadata-token-ttl-seconds", "21600")
+	token, err := metadataText(i.client, req)
+	if err != nil {
+		return awsCredentials{}, fmt.Errorf("failed to get instance metadata token: %w", err)
+	}
+
+	header := http.Header{}
+	header.Set("X-aws-ec2-metadata-token", token)
+	rolesURL := i.Endpoint + "/latest/meta-data/iam/security-credentials/"
+	req, err = http.NewRequestWithContext(ctx, http.MethodGet, rolesURL, nil)
+	if err != nil {
+		return awsCredentials{}, fmt.Errorf("failed to create instance role request: %w", err)
+	}
+	req.Header = header.Clone()
+	roles, err := metadataText(i.client, req)
+	if err != nil {
+		return awsCredentials{}, fmt.Errorf("failed to get instance role: %w", err)
+	}
+	role, _, _ := strings.Cut(roles, "\n")
+	if role == "" {
+		return awsCredentials{}, errors.New("the instance has no role")
+	}
+	return getCredentialsDocument(ctx, i.client, rolesURL+url.PathEscape(role), header)
+}
+
+// metadataText returns the trimmed body of a request to a metadata service.
+func metadataText(client *http.Client, req *http.Request) (string, error) {
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected response status: %s", resp.Status)
+	}
+	return strings.TrimSpace(string(body)), nil
+}
+
+// getCredentialsDocument reads the JSON credentials document served by the
+// container agents and the instance metadata service.
+func getCredentialsDocument(ctx context.Context, client *http.Client, u string, header http.Header) (awsCredentials, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return awsCredentials{}, fmt.Errorf("failed to create credentials request: %w", err)
+	}
+	req.Header = header
+	body, err := metadataText(client, req)
+	if err != nil {
+		return awsCredentials{}, fmt.Errorf("failed to get credentials: %w", err)
+	}
+	var doc struct {
+		AccessKeyID     string    `json:"AccessKeyId"`
+		SecretAccessKey string    `json:"SecretAccessKey"`
+		Token           string    `json:"Token"`
+		Expiration      time.Time `json:"Expiration"`
+	}
+	if err := json.Unmarshal([]byte(body), &doc); err != nil {
+		return awsCredentials{}, fmt.Errorf("failed to decode credentials: %w", err)
+	}
+	if doc.AccessKeyID == "" {
+		return awsCredentials{}, errors.New("credentials response holds no access key")
+	}
+	return awsCredentials{
+		AccessKey:    doc.AccessKeyID,
+		SecretKey:    doc.SecretAccessKey,
+		SessionToken: doc.Token,
+		Expires:      doc.Expiration,
+	}, nil
+}
@@ -0,0 +1,217 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAWSSecretsManager_sign(t *testing.T) {
+	t.Parallel()
+	// The get-vanilla case of the AWS Signature Version 4 test suite
+	m := &AWSSecretsManager{
+		Region: "us-east-1",
+		now:    func() time.Time { return time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC) },
+	}
+	req, err := http.NewRequest(http.MethodGet, "https://example.amazonaws.com/", nil)
+	require.NoError(t, err)
+
+	m.sign(req, nil, "service", awsCredentials{AccessKey: "AKIDEXAMPLE", SecretKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"})
+	assert.Equal(t, "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, "+
+		"SignedHeaders=host;x-amz-date, "+
+		"Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31", req.Header.Get("Authorization"))
+}
+
+func TestAWSSecretsManager_Secret(t *testing.T) {
+	t.Parallel()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "secretsmanager.GetSecretValue", r.Header.Get("X-Amz-Target"))
+		assert.True(t, strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKID/"))
+		assert.Equal(t, "session", r.Header.Get("X-Amz-Security-Token"))
+
+		var body struct{ SecretId string }
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		switch body.SecretId {
+		case "nvd/api":
+			json.NewEncoder(w).Encode(map[string]string{"SecretString": `{"key":"nvd-key"}`})
+		case "cisco":
+			json.NewEncoder(w).Encode(map[string]string{"SecretBinary": "Y2lzY28tdG9rZW4="})
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"__type":"ResourceNotFoundException","message":"Secrets Manager can't find the specified secret."}`))
+		}
+	}))
+	defer server.Close()
+
+	m := &AWSSecretsManager{
+		Region:       "eu-west-1",
+		Endpoint:     server.URL,
+		AccessKey:    "AKID",
+		SecretKey:    "secret",
+		SessionToken: "session",
+		client:       server.Client(),
+		now:          time.Now,
+	}
+	ctx := context.Background()
+
+	secret, err := m.Secret(ctx, "nvd/api#key")
+	require.NoError(t, err)
+	assert.Equal(t, "nvd-key", secret)
+
+	secret, err = m.Secret(ctx, "nvd/api")
+	require.NoError(t, err)
+	assert.Equal(t, `{"key":"nvd-key"}`, secret)
+
+	secret, err = m.Secret(ctx, "cisco")
+	require.NoError(t, err)
+	assert.Equal(t, "cisco-token", secret)
+
+	_, err = m.Secret(ctx, "nvd/api#missing")
+	assert.ErrorIs(t, err, ErrNotFound)
+	_, err = m.Secret(ctx, "missing")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestAWSSecretsManager_Secret_RefreshedCredentials(t *testing.T) {
+	t.Parallel()
+	var keys []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := strings.TrimPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=")
+		key, _, _ := strings.Cut(auth, "/")
+		keys = append(keys, key+":"+r.Header.Get("X-Amz-Security-Token"))
+		json.NewEncoder(w).Encode(map[string]string{"SecretString": "value"})
+	}))
+	defer server.Close()
+
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	source := &stubCredentialsSource{expires: now.Add(time.Hour)}
+	m := &AWSSecretsManager{
+		Region:      "eu-west-1",
+		Endpoint:    server.URL,
+		client:      server.Client(),
+		now:         func() time.Time { return now },
+		credentials: &awsCredentialsCache{source: source, now: func() time.Time { return now }},
+	}
+	ctx := context.Background()
+
+	_, err := m.Secret(ctx, "nvd/api")
+	require.NoError(t, err)
+	_, err = m.Secret(ctx, "nvd/api")
+	require.NoError(t, err)
+	// Within the refresh window of the expiry
+	now = now.Add(56 * time.Minute)
+	_, err = m.Secret(ctx, "nvd/api")
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"AKID1:token1", "AKID1:token1", "AKID2:token2"}, keys)
+}
+
+func TestWebIdentityCredentials_retrieve(t *testing.T) {
+	t.Parallel()
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	require.NoError(t, os.WriteFile(tokenFile, []byte("web-identity-token\n"), 0o600))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		assert.Equal(t, "AssumeRoleWithWebIdentity", r.PostForm.Get("Action"))
+		assert.Equal(t, "arn:aws:iam::123456789012:role/scanner", r.PostForm.Get("RoleArn"))
+		assert.Equal(t, "web-identity-token", r.PostForm.Get("WebIdentityToken"))
+		w.Write([]byte(`<AssumeRoleWithWebIdentityResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/">
+  <AssumeRoleWithWebIdentityResult>
+    <Credentials>
+      <AccessKeyId>ASIAEXAMPLE</AccessKeyId>
+      <SecretAccessKey>secret</SecretAccessKey>
+      <SessionToken>session</SessionToken>
+      <Expiration>2026-10-16T13:00:00Z</Expiration>
+    </Credentials>
+  </AssumeRoleWithWebIdentityResult>
+</AssumeRoleWithWebIdentityResponse>`))
+	}))
+	defer server.Close()
+
+	w := &webIdentityCredentials{
+		Endpoint:    server.URL + "/",
+		RoleARN:     "arn:aws:iam::123456789012:role/scanner",
+		SessionName: "test",
+		TokenFile:   tokenFile,
+		client:      server.Client(),
+	}
+	creds, err := w.retrieve(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, awsCredentials{
+		AccessKey:    "ASIAEXAMPLE",
+		SecretKey:    "secret",
+		SessionToken: "session",
+		Expires:      time.Date(2026, 10, 16, 13, 0, 0, 0, time.UTC),
+	}, creds)
+}
+
+func TestContainerCredentials_retrieve(t *testing.T) {
+	t.Parallel()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v2/credentials/task", r.URL.Path)
+		assert.Equal(t, "auth-token", r.Header.Get("Authorization"))
+		w.Write([]byte(`{"AccessKeyId":"ASIATASK","SecretAccessKey":"secret","Token":"session","Expiration":"2026-10-16T13:00:00Z"}`))
+	}))
+	defer server.Close()
+
+	c := &containerCredentials{URL: server.URL + "/v2/credentials/task", Token: "auth-token", client: server.Client()}
+	creds, err := c.retrieve(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "ASIATASK", creds.AccessKey)
+	assert.Equal(t, "session", creds.SessionToken)
+	assert.Equal(t, time.Date(2026, 10, 16, 13, 0, 0, 0, time.UTC), creds.Expires)
+}
+
+func TestInstanceRoleCredentials_retrieve(t *testing.T) {
+	t.Parallel()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/latest/api/token" {
+			assert.Equal(t, http.MethodPut, r.Method)
+			w.Write([]byte("imds-token"))
+			return
+		}
+		if r.Header.Get("X-aws-ec2-metadata-token") != "imds-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/latest/meta-data/iam/security-credentials/":
+			w.Write([]byte("scanner-role\n"))
+		case "/latest/meta-data/iam/security-credentials/scanner-role":
+			w.Write([]byte(`{"Code":"Success","AccessKeyId":"ASIAINSTANCE","SecretAccessKey":"secret","Token":"session","Expiration":"2026-10-16T13:00:00Z"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	i := &instanceRoleCredentials{Endpoint: server.URL, client: server.Client()}
+	creds, err := i.retrieve(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "ASIAINSTANCE", creds.AccessKey)
+	assert.Equal(t, "secret", creds.SecretKey)
+	assert.Equal(t, "session", creds.SessionToken)
+}
+
+// stubCredentialsSource returns new credentials, expiring at expires, on
+// every retrieval.
+type stubCredentialsSource struct {
+	expires   time.Time
+	retrieved int
+}
+
+func (s *stubCredentialsSource) retrieve(context.Context) (awsCredentials, error) {
+	s.retrieved++
+	n := strconv.Itoa(s.retrieved)
+	return awsCredentials{AccessKey: "AKID" + n, SecretKey: "secret", SessionToken: "token" + n, Expires: s.expires}, nil
+}
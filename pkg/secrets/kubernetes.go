@@ -0,0 +1,48 @@
+package secrets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultKubernetesDir is where the Kubernetes secrets of the service are
+// expected to be mounted, one directory per secret.
+const DefaultKubernetesDir = "/var/run/secrets/vulnerability-analysis"
+
+// Kubernetes reads the Kubernetes secrets mounted as volumes under a
+// directory: the name nvd/api-key is the api-key key of the secret mounted at
+// <dir>/nvd. The kubelet updates the files when a secret changes, so rotated
+// values are read on the next fetch. Docker secrets under /run/secrets are
+// read the same way.
+type Kubernetes struct {
+	dir string
+}
+
+var _ SecretProvider = (*Kubernetes)(nil)
+
+// NewKubernetes returns a provider reading the secrets mounted under dir, or
+// DefaultKubernetesDir when empty.
+func NewKubernetes(dir string) *Kubernetes {
+	if dir == "" {
+		dir = DefaultKubernetesDir
+	}
+	return &Kubernetes{dir: dir}
+}
+
+func (k *Kubernetes) Secret(_ context.Context, name string) (string, error) {
+	if !filepath.IsLocal(name) {
+		return "", fmt.Errorf("invalid secret name %q", name)
+	}
+	data, err := os.ReadFile(filepath.Join(k.dir, filepath.FromSlash(name)))
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", ErrNotFound
+	} else if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
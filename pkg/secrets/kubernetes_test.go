@@ -0,0 +1,31 @@
+package secrets
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKubernetes_Secret(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "nvd"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "nvd", "api-key"), []byte("nvd-key\n"), 0o600))
+	k := NewKubernetes(dir)
+	ctx := context.Background()
+
+	secret, err := k.Secret(ctx, "nvd/api-key")
+	require.NoError(t, err)
+	assert.Equal(t, "nvd-key", secret)
+
+	_, err = k.Secret(ctx, "nvd/missing")
+	assert.ErrorIs(t, err, ErrNotFound)
+	_, err = k.Secret(ctx, "../nvd/api-key")
+	assert.Error(t, err)
+	_, err = k.Secret(ctx, "/etc/passwd")
+	assert.Error(t, err)
+}
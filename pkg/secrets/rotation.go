@@ -0,0 +1,77 @@
+package secrets
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Rotation polls the secrets some configuration values refer to, and calls
+// back with the values once any was rotated, so that clients swap their
+// credentials without a restart.
+type Rotation struct {
+	provider SecretProvider
+	refs     []string
+	interval time.Duration
+	onChange func(values []string)
+
+	mu     sync.Mutex
+	values []string
+}
+
+// NewRotation returns a rotation of the secrets of refs, whose values are
+// current, calling onChange with the resolved values of every ref when one of
+// them changes. Refs without the secret: prefix keep their value. Call Start
+// to begin polling.
+func NewRotation(provider SecretProvider, refs, current []string, interval time.Duration, onChange func(values []string)) *Rotation {
+	return &Rotation{
+		provider: provider,
+		refs:     refs,
+		interval: interval,
+		onChange: onChange,
+		values:   slices.Clone(current),
+	}
+}
+
+// Start checks the secrets every interval until ctx is cancelled.
+func (r *Rotation) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(r.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if _, err := r.Check(ctx); err != nil {
+					slog.Warn("Failed to check rotated secrets, keeping the current values", slog.Any("error", err))
+				}
+			}
+		}
+	}()
+}
+
+// Check fetches the secrets and calls back when any changed, which it
+// reports.
+func (r *Rotation) Check(ctx context.Context) (bool, error) {
+	values := make([]string, len(r.refs))
+	for i, ref := range r.refs {
+		value, err := Resolve(ctx, r.provider, ref)
+		if err != nil {
+			return false, err
+		}
+		values[i] = value
+	}
+
+	r.mu.Lock()
+	changed := !slices.Equal(values, r.values)
+	r.values = values
+	r.mu.Unlock()
+	if changed {
+		slog.Info("Rotated secrets", slog.Int("n_refs", len(r.refs)))
+		r.onChange(values)
+	}
+	return changed, nil
+}
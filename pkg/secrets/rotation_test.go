@@ -0,0 +1,46 @@
+package secrets
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type stubProvider map[string]string
+
+func (p stubProvider) Secret(_ context.Context, name string) (string, error) {
+	value, ok := p[name]
+	if !ok {
+		return "", ErrNotFound
+	}
+	return value, nil
+}
+
+func TestRotation_Check(t *testing.T) {
+	t.Parallel()
+	provider := stubProvider{"nvd#key": "key-a"}
+	var rotated [][]string
+	r := NewRotation(provider, []string{"secret:nvd#key", "plain"}, []string{"key-a", "plain"}, time.Minute, func(values []string) {
+		rotated = append(rotated, values)
+	})
+	ctx := context.Background()
+
+	changed, err := r.Check(ctx)
+	require.NoError(t, err)
+	assert.False(t, changed)
+
+	provider["nvd#key"] = "key-b"
+	changed, err = r.Check(ctx)
+	require.NoError(t, err)
+	assert.True(t, changed)
+	assert.Equal(t, [][]string{{"key-b", "plain"}}, rotated)
+
+	// Values are kept while the provider fails
+	delete(provider, "nvd#key")
+	_, err = r.Check(ctx)
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.Len(t, rotated, 1)
+}
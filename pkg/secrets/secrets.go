@@ -0,0 +1,75 @@
+// Package secrets fetches the API keys and tokens of the service from a
+// secret manager, Vault, AWS Secrets Manager or the secrets Kubernetes mounts,
+// instead of keeping them in environment variables.
+//
+// Configuration values refer to a secret with the secret: prefix, e.g.
+// NVD_API_KEY=secret:nvd#api_key, and are replaced by its value at startup.
+// A Rotation polls the secrets so that rotated values are picked up without
+// a restart.
+package secrets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// RefPrefix starts the configuration values referring to a secret.
+const RefPrefix = "secret:"
+
+// ErrNotFound is returned by providers when a secret or its field doesn't
+// exist.
+var ErrNotFound = errors.New("secret not found")
+
+// SecretProvider fetches secrets by name. The names are specific to each
+// provider, e.g. a path and a field separated by # for Vault.
+type SecretProvider interface {
+	Secret(ctx context.Context, name string) (string, error)
+}
+
+// IsRef reports whether value refers to a secret.
+func IsRef(value string) bool {
+	return strings.HasPrefix(value, RefPrefix)
+}
+
+// Resolve returns the secret value refers to with the secret: prefix, and
+// any other value as is.
+func Resolve(ctx context.Context, provider SecretProvider, value string) (string, error) {
+	name, ok := strings.CutPrefix(value, RefPrefix)
+	if !ok {
+		return value, nil
+	}
+	if name == "" {
+		return "", errors.New("empty secret name")
+	}
+	secret, err := provider.Secret(ctx, name)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch secret %s: %w", name, err)
+	}
+	return secret, nil
+}
+
+// splitField splits a secret name into its path and the field after #, or
+// field when there is none.
+func splitField(name, field string) (string, string) {
+	if path, f, ok := strings.Cut(name, "#"); ok {
+		return path, f
+	}
+	return name, field
+}
+
+// Env reads secrets from the environment variables they name, e.g. those
+// injected by an orchestrator under another name than the service reads.
+type Env struct{}
+
+var _ SecretProvider = Env{}
+
+func (Env) Secret(_ context.Context, name string) (string, error) {
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		return "", ErrNotFound
+	}
+	return value, nil
+}
@@ -0,0 +1,30 @@
+package secrets
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolve(t *testing.T) {
+	t.Setenv("INJECTED_NVD_KEY", "nvd-key")
+	ctx := context.Background()
+
+	value, err := Resolve(ctx, Env{}, "plain-key")
+	require.NoError(t, err)
+	assert.Equal(t, "plain-key", value)
+
+	value, err = Resolve(ctx, Env{}, "secret:INJECTED_NVD_KEY")
+	require.NoError(t, err)
+	assert.Equal(t, "nvd-key", value)
+
+	_, err = Resolve(ctx, Env{}, "secret:MISSING_NVD_KEY")
+	assert.ErrorIs(t, err, ErrNotFound)
+	_, err = Resolve(ctx, Env{}, "secret:")
+	assert.Error(t, err)
+
+	assert.True(t, IsRef("secret:nvd#key"))
+	assert.False(t, IsRef("nvd-key"))
+}
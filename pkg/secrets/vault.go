@@ -0,0 +1,130 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// vaultDefaultField is the field read from a Vault secret named without one.
+const vaultDefaultField = "value"
+
+// Vault reads secrets from a KV version 2 secrets engine of HashiCorp Vault.
+// The name nvd/api#key is the key field of the secret at nvd/api, and a name
+// without a field reads its value field.
+type Vault struct {
+	Addr      string
+	Mount     string // Path the KV engine is mounted at, secret by default
+	Namespace string // Vault Enterprise namespace
+	Token     string
+
+	// TokenFile, when set, is read for the token before every request, e.g.
+	// the sink of a Vault agent renewing it.
+	TokenFile string
+
+	client *http.Client
+}
+
+var _ SecretProvider = (*Vault)(nil)
+
+// NewVaultFromEnv creates a Vault provider reading the secrets of the KV
+// engine at mount, using the standard VAULT_ADDR, VAULT_TOKEN and
+// VAULT_NAMESPACE variables, or the token of tokenFile.
+func NewVaultFromEnv(mount, tokenFile string) (*Vault, error) {
+	v := &Vault{
+		Addr:      strings.TrimRight(os.Getenv("VAULT_ADDR"), "/"),
+		Mount:     strings.Trim(mount, "/"),
+		Namespace: os.Getenv("VAULT_NAMESPACE"),
+		Token:     os.Getenv("VAULT_TOKEN"),
+		TokenFile: tokenFile,
+		client:    &http.Client{Timeout: 30 * time.Second},
+	}
+	if v.Addr == "" {
+		return nil, errors.New("vault secrets require VAULT_ADDR")
+	}
+	if v.Token == "" && v.TokenFile == "" {
+		return nil, errors.New("vault secrets require VAULT_TOKEN or a token file")
+	}
+	if v.Mount == "" {
+		v.Mount = "secret"
+	}
+	return v, nil
+}
+
+func (v *Vault) token() (string, error) {
+	if v.TokenFile == "" {
+		return v.Token, nil
+	}
+	data, err := os.ReadFile(v.TokenFile)
+	if err != nil {
+		return "", fmt.Errorf("failed to read vault token: %w", err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+func (v *Vault) Secret(ctx context.Context, name string) (string, error) {
+	path, field := splitField(name, vaultDefaultField)
+	token, err := v.token()
+	if err != nil {
+		return "", err
+	}
+
+	u := v.Addr + "/v1/" + url.PathEscape(v.Mount) + "/data/" + escapePath(strings.Trim(path, "/"))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create vault request: %w", err)
+	}
+	req.Header.Set("X-Vault-Token", token)
+	if v.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", v.Namespace)
+	}
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed vault request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return "", ErrNotFound
+	default:
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return "", fmt.Errorf("unexpected vault response status: %s: %s", resp.Status, body)
+	}
+
+	var secret struct {
+		Data struct {
+			Data map[string]any `json:"data"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&secret); err != nil {
+		return "", fmt.Errorf("failed to decode vault secret: %w", err)
+	}
+	value, ok := secret.Data.Data[field]
+	if !ok {
+		return "", ErrNotFound
+	}
+	s, ok := value.(string)
+	if !ok {
+		return "", fmt.Errorf("secret field %s isn't a string", field)
+	}
+	return s, nil
+}
+
+// escapePath escapes the segments of a slash separated path.
+func escapePath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return strings.Join(segments, "/")
+}
@@ -0,0 +1,64 @@
+package secrets
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVault_Secret(t *testing.T) {
+	t.Parallel()
+	token := "token-a"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, token, r.Header.Get("X-Vault-Token"))
+		assert.Equal(t, "team-a", r.Header.Get("X-Vault-Namespace"))
+		if r.URL.Path != "/v1/kv/data/nvd/api" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(`{"data":{"data":{"value":"nvd-key","key":"other-key","ttl":60},"metadata":{"version":3}}}`))
+	}))
+	defer server.Close()
+
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	require.NoError(t, os.WriteFile(tokenFile, []byte(token+"\n"), 0o600))
+	v := &Vault{Addr: server.URL, Mount: "kv", Namespace: "team-a", TokenFile: tokenFile, client: server.Client()}
+	ctx := context.Background()
+
+	secret, err := v.Secret(ctx, "nvd/api")
+	require.NoError(t, err)
+	assert.Equal(t, "nvd-key", secret)
+
+	// The token file is read again once renewed
+	token = "token-b"
+	require.NoError(t, os.WriteFile(tokenFile, []byte(token), 0o600))
+	secret, err = v.Secret(ctx, "nvd/api#key")
+	require.NoError(t, err)
+	assert.Equal(t, "other-key", secret)
+
+	_, err = v.Secret(ctx, "nvd/api#missing")
+	assert.ErrorIs(t, err, ErrNotFound)
+	_, err = v.Secret(ctx, "nvd/api#ttl")
+	assert.Error(t, err)
+	_, err = v.Secret(ctx, "missing")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestNewVaultFromEnv(t *testing.T) {
+	t.Setenv("VAULT_ADDR", "https://vault:8200/")
+	t.Setenv("VAULT_TOKEN", "")
+
+	_, err := NewVaultFromEnv("", "")
+	assert.Error(t, err)
+
+	v, err := NewVaultFromEnv("", "/vault/token")
+	require.NoError(t, err)
+	assert.Equal(t, "https://vault:8200", v.Addr)
+	assert.Equal(t, "secret", v.Mount)
+}
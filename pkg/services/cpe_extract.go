@@ -0,0 +1,39 @@
+package services
+
+import (
+	"log/slog"
+
+	"github.com/Ullaakut/nmap/v2"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/cpeextract"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/results"
+)
+
+// extractCPE returns the first valid CPE the extractors derive from the
+// evidence of port, with its provenance, or an empty CPE.
+func (s *NmapService) extractCPE(port nmap.Port) (string, results.Provenance) {
+	for _, candidate := range s.extractors.Candidates(cpeextract.PortEvidence(port)) {
+		standardizedCPE, trace, err := standardizeCPEWithTrace(candidate.CPE)
+		if err == nil {
+			err = isValidCPE(standardizedCPE)
+		}
+		if err != nil {
+			slog.Debug("Extracted invalid CPE, skipping to next candidate",
+				slog.Int("port_id", int(port.ID)),
+				slog.String("service_name", port.Service.Name),
+				slog.String("extractor", candidate.Extractor),
+				slog.String("cpe", candidate.CPE),
+				slog.Any("error", err))
+			continue
+		}
+
+		slog.Debug("Extracted CPE from service evidence",
+			slog.Int("port_id", int(port.ID)),
+			slog.String("service_name", port.Service.Name),
+			slog.String("extractor", candidate.Extractor),
+			slog.String("cpe", standardizedCPE))
+		provenance := s.nvdProvenance(candidate.CPE, standardizedCPE, trace)
+		provenance.Extractor = candidate.Extractor
+		return standardizedCPE, provenance
+	}
+	return "", results.Provenance{}
+}
@@ -0,0 +1,45 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Ullaakut/nmap/v2"
+	"github.com/kptm-tools/vulnerability-analysis/nvd/schema"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/cpeextract"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_processPorts_CPEExtractors(t *testing.T) {
+	t.Parallel()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "cpe:2.3:a:openbsd:openssh:8.2p1:*:*:*:*:*:*:*", r.URL.Query().Get("cpeName"))
+		json.NewEncoder(w).Encode(schema.NvdAPIResponse{TotalResults: 1, ResultsPerPage: 1, Vulnerabilities: []schema.Vulnerability{
+			{Cve: schema.CveDetail{ID: "CVE-2024-0001", Published: "2024-01-01T00:00:00.000", LastModified: "2024-01-01T00:00:00.000"}},
+		}})
+	}))
+	defer server.Close()
+
+	rules, err := cpeextract.NewRuleExtractor(cpeextract.DefaultRules())
+	require.NoError(t, err)
+	s := NewNmapService(newTestNVDClient(server.URL), WithCPEExtractors(cpeextract.NewRegistry(rules)))
+	ports := []nmap.Port{{
+		ID:       22,
+		Protocol: "tcp",
+		Service:  nmap.Service{Name: "ssh"},
+		Scripts:  []nmap.Script{{ID: cpeextract.ScriptBanner, Output: "SSH-2.0-OpenSSH_8.2p1"}},
+	}}
+
+	portData := s.processPorts(context.Background(), "10.0.0.1", ports)
+	require.Len(t, portData, 1)
+	assert.Equal(t, "cpe:2.3:a:openbsd:openssh:8.2p1:*:*:*:*:*:*:*", portData[0].Service.CPE)
+	require.Len(t, portData[0].Vulnerabilities, 1)
+	provenance := portData[0].Vulnerabilities[0].Provenance
+	require.NotNil(t, provenance)
+	assert.Equal(t, "rules", provenance.Extractor)
+	assert.Equal(t, "cpe:/a:openbsd:openssh:8.2p1", provenance.InputCPE)
+}
@@ -0,0 +1,70 @@
+package services
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+
+	cpeutil "github.com/kptm-tools/vulnerability-analysis/nvd/cpe"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/metrics"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/results"
+)
+
+type droppedCPEsKey struct{}
+
+// droppedCPEs collects the CPEs rejected while analyzing a host.
+type droppedCPEs struct {
+	mu   sync.Mutex
+	cpes []results.DroppedCPE
+}
+
+// withDroppedCPEs returns a context collecting the CPEs rejected by the
+// lookups made with it, e.g. for the OS and ports of a host.
+func withDroppedCPEs(ctx context.Context) (context.Context, *droppedCPEs) {
+	dropped := &droppedCPEs{}
+	return context.WithValue(ctx, droppedCPEsKey{}, dropped), dropped
+}
+
+// list returns the CPEs collected so far.
+func (d *droppedCPEs) list() []results.DroppedCPE {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]results.DroppedCPE(nil), d.cpes...)
+}
+
+// dropCPE counts the rejection of cpe by err of standardization or
+// validation, by reason, and adds it to the CPEs collected by ctx.
+func dropCPE(ctx context.Context, cpe string, port uint16, service string, err error) {
+	reason := cpeutil.Reason(err)
+	metrics.CountRejectedCPE(reason)
+
+	dropped, ok := ctx.Value(droppedCPEsKey{}).(*droppedCPEs)
+	if !ok {
+		return
+	}
+	dropped.mu.Lock()
+	defer dropped.mu.Unlock()
+	dropped.cpes = append(dropped.cpes, results.DroppedCPE{
+		CPE:     cpe,
+		Reason:  reason,
+		Error:   err.Error(),
+		Port:    port,
+		Service: service,
+	})
+}
+
+// logDroppedCPEs reports the CPEs of a host rejected during its analysis,
+// counted by reason.
+func logDroppedCPEs(hostAddress string, dropped []results.DroppedCPE) {
+	if len(dropped) == 0 {
+		return
+	}
+	reasons := make(map[string]int)
+	for _, d := range dropped {
+		reasons[d.Reason]++
+	}
+	slog.Warn("Dropped invalid CPEs from the analysis",
+		slog.String("host_address", hostAddress),
+		slog.Int("n_dropped", len(dropped)),
+		slog.Any("reasons", reasons))
+}
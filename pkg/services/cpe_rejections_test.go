@@ -0,0 +1,56 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Ullaakut/nmap/v2"
+	cpeutil "github.com/kptm-tools/vulnerability-analysis/nvd/cpe"
+	"github.com/kptm-tools/vulnerability-analysis/nvd/schema"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/metrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func rejectedCPECount(reason string) int {
+	for _, rejected := range metrics.RejectedCPEs() {
+		if rejected.Reason == reason {
+			return rejected.Count
+		}
+	}
+	return 0
+}
+
+func Test_NmapService_DroppedCPEs(t *testing.T) {
+	t.Parallel()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(schema.NvdAPIResponse{})
+	}))
+	defer server.Close()
+
+	host := nmap.Host{
+		Addresses: []nmap.Address{{Addr: "10.0.0.1", AddrType: "ipv4"}},
+		Ports: []nmap.Port{
+			{ID: 22, Protocol: "tcp", Service: nmap.Service{Name: "ssh", CPEs: []nmap.CPE{"cpe:/a:openbsd:openssh:8.2p1"}}},
+			{ID: 80, Protocol: "tcp", Service: nmap.Service{Name: "http", CPEs: []nmap.CPE{"cpe:/a:apache:http_server"}}},
+			{ID: 443, Protocol: "tcp", Service: nmap.Service{Name: "https", CPEs: []nmap.CPE{"a:apache:http_server:2.4.41"}}},
+		},
+	}
+	missingVersion := rejectedCPECount(cpeutil.ReasonMissingVersion)
+	badPrefix := rejectedCPECount(cpeutil.ReasonBadPrefix)
+
+	result := NewNmapService(newTestNVDClient(server.URL)).enrichHost(context.Background(), host)
+	require.Len(t, result.DroppedCPEs, 2)
+	assert.Equal(t, "cpe:/a:apache:http_server", result.DroppedCPEs[0].CPE)
+	assert.Equal(t, cpeutil.ReasonMissingVersion, result.DroppedCPEs[0].Reason)
+	assert.Equal(t, uint16(80), result.DroppedCPEs[0].Port)
+	assert.Equal(t, "http", result.DroppedCPEs[0].Service)
+	assert.Equal(t, cpeutil.ReasonBadPrefix, result.DroppedCPEs[1].Reason)
+	assert.Equal(t, uint16(443), result.DroppedCPEs[1].Port)
+
+	assert.GreaterOrEqual(t, rejectedCPECount(cpeutil.ReasonMissingVersion), missingVersion+1)
+	assert.GreaterOrEqual(t, rejectedCPECount(cpeutil.ReasonBadPrefix), badPrefix+1)
+}
@@ -0,0 +1,280 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"time"
+
+	"github.com/kptm-tools/vulnerability-analysis/nvd/schema"
+)
+
+var ErrSourceTimeout = errors.New("CVE source did not answer in time")
+
+// NamedCVESource is a CVE source queried alongside the live NVD API.
+type NamedCVESource struct {
+	Name   string
+	Source CVESource
+}
+
+// nvdCVESource looks CVE records up in the live NVD API, falling back to the
+// offline source during maintenance windows.
+type nvdCVESource struct {
+	client *NVDClient
+}
+
+func (s nvdCVESource) LookupCVE(id string) (*schema.NvdAPIResponse, error) {
+	return s.LookupCVEContext(context.Background(), id)
+}
+
+func (s nvdCVESource) LookupCVEContext(ctx context.Context, id string) (*schema.NvdAPIResponse, error) {
+	query := url.Values{}
+	query.Set("cveId", id)
+
+	return s.client.fetch(ctx, query, func() (*schema.NvdAPIResponse, error) {
+		return s.client.lookupOfflineCVE(id)
+	})
+}
+
+// contextCVESource is a CVESource whose lookups can be cancelled.
+type contextCVESource interface {
+	LookupCVEContext(ctx context.Context, id string) (*schema.NvdAPIResponse, error)
+}
+
+type sourceAnswer struct {
+	index int
+	resp  *schema.NvdAPIResponse
+	err   error
+}
+
+// sourceLookup queries a source, e.g. for a CVE ID or the CVEs of a CPE.
+type sourceLookup func(ctx context.Context) (*schema.NvdAPIResponse, error)
+
+// raceSources runs the lookups of the named sources concurrently and returns
+// the answers returned before the timeout, nil for the others, with the
+// errors of the sources that failed or were abandoned. Sources taking a
+// context stop their requests once the race is over.
+func raceSources(ctx context.Context, names []string, lookups []sourceLookup, timeout time.Duration) ([]*schema.NvdAPIResponse, []error) {
+	raceCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	answers := make(chan sourceAnswer, len(lookups))
+	for i, lookup := range lookups {
+		go func(i int, lookup sourceLookup) {
+			resp, err := lookup(raceCtx)
+			answers <- sourceAnswer{index: i, resp: resp, err: err}
+		}(i, lookup)
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	resps := make([]*schema.NvdAPIResponse, len(lookups))
+	errs := make([]error, len(lookups))
+	for pending := len(lookups); pending > 0; pending-- {
+		select {
+		case answer := <-answers:
+			if answer.err != nil {
+				errs[answer.index] = fmt.Errorf("%s: %w", names[answer.index], answer.err)
+			} else if answer.resp != nil {
+				resps[answer.index] = answer.resp
+			}
+			continue
+		case <-timer.C:
+		case <-ctx.Done():
+		}
+		for i := range lookups {
+			if resps[i] == nil && errs[i] == nil {
+				errs[i] = fmt.Errorf("%s: %w", names[i], ErrSourceTimeout)
+			}
+		}
+		break
+	}
+	return resps, errs
+}
+
+// raceCVESources queries every source concurrently and merges the records
+// returned before the timeout. Sources still running at the deadline are
+// abandoned; their answer is discarded. The error is only set when no source
+// returned a record.
+func raceCVESources(ctx context.Context, cveID string, sources []NamedCVESource, timeout time.Duration) (*schema.NvdAPIResponse, error) {
+	names := make([]string, len(sources))
+	lookups := make([]sourceLookup, len(sources))
+	for i, src := range sources {
+		names[i] = src.Name
+		lookups[i] = func(ctx context.Context) (*schema.NvdAPIResponse, error) {
+			if ctxSrc, ok := src.Source.(contextCVESource); ok {
+				return ctxSrc.LookupCVEContext(ctx, cveID)
+			}
+			return src.Source.LookupCVE(cveID)
+		}
+	}
+	resps, errs := raceSources(ctx, names, lookups, timeout)
+
+	records := make([]*schema.Vulnerability, len(sources))
+	for i, resp := range resps {
+		if resp != nil && len(resp.Vulnerabilities) > 0 {
+			records[i] = &resp.Vulnerabilities[0]
+		}
+	}
+	merged := mergeCVERecords(records)
+	if merged == nil {
+		if err := errors.Join(errs...); err != nil {
+			return nil, err
+		}
+		return &schema.NvdAPIResponse{}, nil
+	}
+	logSourceErrors(slog.String("cve_id", cveID), errs)
+	return &schema.NvdAPIResponse{
+		ResultsPerPage:  1,
+		TotalResults:    1,
+		Format:          "NVD_CVE",
+		Version:         "2.0",
+		Vulnerabilities: []schema.Vulnerability{*merged},
+	}, nil
+}
+
+// raceCPESources runs the lookups of the CVEs of a CPE in the named sources
+// concurrently and merges the answers returned before the timeout. The
+// records of a CVE answered by several sources are merged like those of
+// raceCVESources, sources listed by priority. The error is only set when no
+// source answered.
+func raceCPESources(ctx context.Context, cpe string, names []string, lookups []sourceLookup, timeout time.Duration) (*schema.NvdAPIResponse, error) {
+	resps, errs := raceSources(ctx, names, lookups, timeout)
+
+	var ids []string
+	byID := make(map[string][]*schema.Vulnerability)
+	answered := false
+	for i, resp := range resps {
+		if resp == nil {
+			continue
+		}
+		answered = true
+		for j := range resp.Vulnerabilities {
+			vuln := &resp.Vulnerabilities[j]
+			if _, ok := byID[vuln.Cve.ID]; !ok {
+				ids = append(ids, vuln.Cve.ID)
+			}
+			records := byID[vuln.Cve.ID]
+			if records == nil {
+				records = make([]*schema.Vulnerability, len(resps))
+				byID[vuln.Cve.ID] = records
+			}
+			records[i] = vuln
+		}
+	}
+	if !answered {
+		return nil, errors.Join(errs...)
+	}
+	logSourceErrors(slog.String("cpe", cpe), errs)
+
+	vulns := make([]schema.Vulnerability, 0, len(ids))
+	for _, id := range ids {
+		vulns = append(vulns, *mergeCVERecords(byID[id]))
+	}
+	return &schema.NvdAPIResponse{
+		ResultsPerPage:  len(vulns),
+		TotalResults:    len(vulns),
+		Format:          "NVD_CVE",
+		Version:         "2.0",
+		Vulnerabilities: vulns,
+	}, nil
+}
+
+// logSourceErrors logs the failures of the sources whose answers were merged
+// without them.
+func logSourceErrors(query slog.Attr, errs []error) {
+	for _, err := range errs {
+		if err != nil {
+			slog.Warn("CVE source failed, merging the remaining answers", query, slog.Any("error", err))
+		}
+	}
+}
+
+// mergeCVERecords returns the most recently modified record, ties going to
+// the higher priority source, completed with the fields only the other
+// records carry. Nil records are skipped.
+func mergeCVERecords(records []*schema.Vulnerability) *schema.Vulnerability {
+	var base *schema.Vulnerability
+	for _, r := range records {
+		if r == nil {
+			continue
+		}
+		if base == nil || newerRecord(r.Cve.LastModified, base.Cve.LastModified) {
+			base = r
+		}
+	}
+	if base == nil {
+		return nil
+	}
+
+	merged := *base
+	cve := &merged.Cve
+	for _, r := range records {
+		if r == nil || r == base {
+			continue
+		}
+		other := r.Cve
+		if len(cve.Descriptions) == 0 {
+			cve.Descriptions = other.Descriptions
+		}
+		cve.Metrics = mergeMetrics(cve.Metrics, other.Metrics)
+		if len(cve.Weaknesses) == 0 {
+			cve.Weaknesses = other.Weaknesses
+		}
+		if len(cve.Configurations) == 0 {
+			cve.Configurations = other.Configurations
+		}
+		if len(cve.VendorComments) == 0 {
+			cve.VendorComments = other.VendorComments
+		}
+		cve.References = mergeReferences(cve.References, other.References)
+	}
+	return &merged
+}
+
+func newerRecord(a, b string) bool {
+	ta, errA := parseNvdDateTime(a)
+	tb, errB := parseNvdDateTime(b)
+	if errA != nil || errB != nil {
+		return errB != nil && errA == nil
+	}
+	return ta.After(tb)
+}
+
+func mergeMetrics(base, other *schema.Metrics) *schema.Metrics {
+	if other == nil {
+		return base
+	}
+	if base == nil {
+		return other
+	}
+	merged := *base
+	if len(merged.CvssMetricV31) == 0 {
+		merged.CvssMetricV31 = other.CvssMetricV31
+	}
+	if len(merged.CvssMetricV30) == 0 {
+		merged.CvssMetricV30 = other.CvssMetricV30
+	}
+	if len(merged.CvssMetricV2) == 0 {
+		merged.CvssMetricV2 = other.CvssMetricV2
+	}
+	return &merged
+}
+
+func mergeReferences(base, other []schema.Reference) []schema.Reference {
+	seen := make(map[string]bool, len(base))
+	for _, ref := range base {
+		seen[ref.URL] = true
+	}
+	merged := append([]schema.Reference(nil), base...)
+	for _, ref := range other {
+		if !seen[ref.URL] {
+			seen[ref.URL] = true
+			merged = append(merged, ref)
+		}
+	}
+	return merged
+}
@@ -0,0 +1,157 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/kptm-tools/vulnerability-analysis/nvd/schema"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type stubCVESource struct {
+	delay time.Duration
+	cve   *schema.CveDetail
+	err   error
+}
+
+func (s stubCVESource) LookupCVE(id string) (*schema.NvdAPIResponse, error) {
+	time.Sleep(s.delay)
+	if s.err != nil {
+		return nil, s.err
+	}
+	if s.cve == nil {
+		return &schema.NvdAPIResponse{}, nil
+	}
+	return &schema.NvdAPIResponse{Vulnerabilities: []schema.Vulnerability{{Cve: *s.cve}}}, nil
+}
+
+func testCVE(lastModified string, refs ...string) *schema.CveDetail {
+	cve := &schema.CveDetail{ID: "CVE-2024-0001", LastModified: lastModified}
+	for _, ref := range refs {
+		cve.References = append(cve.References, schema.Reference{URL: ref})
+	}
+	return cve
+}
+
+func Test_raceCVESources(t *testing.T) {
+	t.Parallel()
+	older := testCVE("2024-01-01T00:00:00.000", "https://a.example", "https://b.example")
+	older.Metrics = &schema.Metrics{CvssMetricV2: []schema.CvssMetricV2{{Source: "nvd@nist.gov"}}}
+	newer := testCVE("2024-06-01T00:00:00.000", "https://b.example", "https://c.example")
+	newer.Metrics = &schema.Metrics{CvssMetricV31: []schema.CvssMetricV31{{Source: "nvd@nist.gov"}}}
+
+	t.Run("Merges every answer, newest record first", func(t *testing.T) {
+		t.Parallel()
+		resp, err := raceCVESources(context.Background(), "CVE-2024-0001", []NamedCVESource{
+			{Name: "mirror", Source: stubCVESource{cve: older}},
+			{Name: "nvd", Source: stubCVESource{cve: newer}},
+		}, time.Second)
+		require.NoError(t, err)
+		require.Len(t, resp.Vulnerabilities, 1)
+
+		got := resp.Vulnerabilities[0].Cve
+		assert.Equal(t, newer.LastModified, got.LastModified)
+		assert.Len(t, got.Metrics.CvssMetricV31, 1)
+		assert.Len(t, got.Metrics.CvssMetricV2, 1, "Expected the v2 metrics of the older record to fill the gap")
+		var urls []string
+		for _, ref := range got.References {
+			urls = append(urls, ref.URL)
+		}
+		assert.Equal(t, []string{"https://b.example", "https://c.example", "https://a.example"}, urls)
+		assert.Len(t, newer.References, 2, "Expected the source records to be left untouched")
+	})
+
+	t.Run("Slow sources are abandoned at the timeout", func(t *testing.T) {
+		t.Parallel()
+		start := time.Now()
+		resp, err := raceCVESources(context.Background(), "CVE-2024-0001", []NamedCVESource{
+			{Name: "mirror", Source: stubCVESource{cve: older}},
+			{Name: "nvd", Source: stubCVESource{cve: newer, delay: time.Second}},
+		}, 50*time.Millisecond)
+		require.NoError(t, err)
+		assert.Less(t, time.Since(start), 500*time.Millisecond)
+		assert.Equal(t, older.LastModified, resp.Vulnerabilities[0].Cve.LastModified)
+	})
+
+	t.Run("Failures are reported when no source answers", func(t *testing.T) {
+		t.Parallel()
+		boom := errors.New("boom")
+		_, err := raceCVESources(context.Background(), "CVE-2024-0001", []NamedCVESource{
+			{Name: "mirror", Source: stubCVESource{err: boom}},
+			{Name: "nvd", Source: stubCVESource{delay: time.Second}},
+		}, 50*time.Millisecond)
+		assert.ErrorIs(t, err, boom)
+		assert.ErrorIs(t, err, ErrSourceTimeout)
+	})
+
+	t.Run("Unknown CVE is an empty response", func(t *testing.T) {
+		t.Parallel()
+		resp, err := raceCVESources(context.Background(), "CVE-2024-0001", []NamedCVESource{
+			{Name: "mirror", Source: stubCVESource{}},
+		}, time.Second)
+		require.NoError(t, err)
+		assert.Empty(t, resp.Vulnerabilities)
+	})
+}
+
+// stubMirrorSource answers CVE ID lookups and, like a mirror, CPE lookups.
+type stubMirrorSource struct {
+	stubCVESource
+	stubCPESource
+}
+
+func Test_NVDClient_lookupCPE_ParallelSources(t *testing.T) {
+	t.Parallel()
+	cpe := "cpe:2.3:a:openbsd:openssh:8.2p1:*:*:*:*:*:*:*"
+	older := testCVE("2024-01-01T00:00:00.000", "https://a.example")
+	mirrored := &schema.CveDetail{ID: "CVE-2024-0002", LastModified: "2024-01-01T00:00:00.000"}
+	mirror := stubMirrorSource{stubCPESource: stubCPESource{resp: &schema.NvdAPIResponse{
+		Vulnerabilities: []schema.Vulnerability{{Cve: *older}, {Cve: *mirrored}},
+	}}}
+
+	t.Run("Merges the live and mirror answers", func(t *testing.T) {
+		t.Parallel()
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			json.NewEncoder(w).Encode(schema.NvdAPIResponse{
+				TotalResults:    1,
+				ResultsPerPage:  1,
+				Vulnerabilities: []schema.Vulnerability{{Cve: *testCVE("2024-06-01T00:00:00.000", "https://b.example")}},
+			})
+		}))
+		defer server.Close()
+
+		nvd := newTestNVDClient(server.URL, WithCVESources(time.Second, NamedCVESource{Name: "mirror", Source: mirror}))
+		resp, err := nvd.lookupCPE(context.Background(), cpe)
+		require.NoError(t, err)
+		require.Len(t, resp.Vulnerabilities, 2)
+		got := resp.Vulnerabilities[0].Cve
+		assert.Equal(t, "CVE-2024-0001", got.ID)
+		assert.Equal(t, "2024-06-01T00:00:00.000", got.LastModified, "Expected the newest record of the CVE to win")
+		assert.Len(t, got.References, 2)
+		assert.Equal(t, "CVE-2024-0002", resp.Vulnerabilities[1].Cve.ID)
+	})
+
+	t.Run("Serves the mirror answer when NVD is slow", func(t *testing.T) {
+		t.Parallel()
+		release := make(chan struct{})
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case <-release:
+			case <-r.Context().Done():
+			}
+		}))
+		defer server.Close()
+		defer close(release)
+
+		nvd := newTestNVDClient(server.URL, WithCVESources(50*time.Millisecond, NamedCVESource{Name: "mirror", Source: mirror}))
+		resp, err := nvd.lookupCPE(context.Background(), cpe)
+		require.NoError(t, err)
+		assert.Len(t, resp.Vulnerabilities, 2)
+	})
+}
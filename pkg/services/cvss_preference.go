@@ -0,0 +1,49 @@
+package services
+
+import (
+	"log/slog"
+
+	"github.com/kptm-tools/vulnerability-analysis/nvd/cvss"
+	"github.com/kptm-tools/vulnerability-analysis/nvd/schema"
+)
+
+// CVSSVersion is a version of the CVSS metrics published by NVD.
+type CVSSVersion = cvss.Version
+
+const (
+	CVSSVersion40 = cvss.Version40
+	CVSSVersion31 = cvss.Version31
+	CVSSVersion30 = cvss.Version30
+	CVSSVersion2  = cvss.Version2
+)
+
+// DefaultCVSSOrder is the order in which the CVSS versions of a CVE are
+// preferred unless configured otherwise. CVSS v4.0 is left out of it.
+var DefaultCVSSOrder = cvss.DefaultOrder
+
+// CVSSPreference is the order in which the metrics of each CVSS version are
+// used to score a finding, the first version a CVE has metrics of wins. The
+// zero value prefers the versions of DefaultCVSSOrder.
+type CVSSPreference = cvss.Preference
+
+// ParseCVSSPreference parses semicolon separated orders of comma separated
+// CVSS versions, the ones prefixed with `tenant=` applying to that tenant
+// only, e.g. "3.1,3.0,2.0;acme=4.0,3.1,3.0,2.0".
+func ParseCVSSPreference(spec string) (CVSSPreference, error) {
+	return cvss.ParsePreference(spec)
+}
+
+// preferMetrics returns the metrics of the first version of order that
+// metrics has, alone, so that the extraction of the finding metrics uses it.
+// CVSS v4.0 metrics are returned in the v3.1 structure. It falls back to
+// DefaultCVSSOrder when metrics has none of the versions of order.
+func preferMetrics(cveID string, metrics *schema.Metrics, order []CVSSVersion) *schema.Metrics {
+	preferred, err := cvss.Prefer(metrics, order)
+	if err != nil {
+		slog.Warn("Failed to parse CVSS v4.0 vector, using its score only",
+			slog.String("cve_id", cveID),
+			slog.String("vector", metrics.CvssMetricV40[0].CvssData.VectorString),
+			slog.Any("error", err))
+	}
+	return preferred
+}
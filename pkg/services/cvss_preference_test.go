@@ -0,0 +1,57 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"github.com/kptm-tools/common/common/pkg/enums"
+	"github.com/kptm-tools/vulnerability-analysis/nvd/schema"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/results"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/tenant"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_preferMetrics(t *testing.T) {
+	t.Parallel()
+	metrics := createMockNvdVulnerabilityWithV31().Cve.Metrics
+	metrics.CvssMetricV2 = []schema.CvssMetricV2{{CvssData: schema.CvssDataV2{BaseScore: 5.0}}}
+
+	assert.Equal(t, metrics.CvssMetricV31, preferMetrics("CVE-TEST-V31", metrics, DefaultCVSSOrder).CvssMetricV31)
+
+	v2 := preferMetrics("CVE-TEST-V31", metrics, []CVSSVersion{CVSSVersion40, CVSSVersion2, CVSSVersion31})
+	assert.Empty(t, v2.CvssMetricV31, "Expected v4.0 to be skipped when missing")
+	assert.Len(t, v2.CvssMetricV2, 1)
+
+	fallback := preferMetrics("CVE-TEST-V31", metrics, []CVSSVersion{CVSSVersion30})
+	require.NotNil(t, fallback, "Expected a fallback to the default order")
+	assert.Equal(t, metrics.CvssMetricV31, fallback.CvssMetricV31)
+}
+
+func TestEnrichment_CVSSPreferencePerTenant(t *testing.T) {
+	t.Parallel()
+	nvdVuln := createMockNvdVulnerabilityWithV31()
+	nvdVuln.Cve.Metrics.CvssMetricV40 = []schema.CvssMetricV40{{CvssData: schema.CvssDataV40{
+		Version:      "4.0",
+		VectorString: "CVSS:4.0/AV:L/AC:L/AT:N/PR:L/UI:N/VC:H/VI:H/VA:H/SC:N/SI:N/SA:N",
+		BaseScore:    9.3,
+		BaseSeverity: schema.SeverityTypeCritical,
+	}}}
+
+	pref, err := ParseCVSSPreference("acme=4.0,3.1")
+	require.NoError(t, err)
+	e := DefaultEnrichment()
+	e.CVSSPreference = pref
+
+	var byDefault results.Vulnerability
+	require.NoError(t, e.enrichVulnerabilityWithNvdData(context.Background(), &byDefault, nvdVuln))
+	assert.Equal(t, 7.5, byDefault.BaseCVSSScore)
+	assert.Equal(t, enums.AccessTypeNetwork, byDefault.Access)
+
+	var v4 results.Vulnerability
+	require.NoError(t, e.enrichVulnerabilityWithNvdData(tenant.WithID(context.Background(), "acme"), &v4, nvdVuln))
+	assert.Equal(t, 9.3, v4.BaseCVSSScore)
+	assert.Equal(t, enums.SeverityTypeCritical, v4.BaseSeverity)
+	assert.Equal(t, enums.AccessTypeLocal, v4.Access)
+	assert.Equal(t, enums.PrivilegesRequiredLow, v4.PrivilegesRequired)
+}
@@ -0,0 +1,152 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/kptm-tools/vulnerability-analysis/pkg/features"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/intel"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/results"
+)
+
+// Signals of the optional sources whose failures degrade a result rather
+// than fail it. KEV status and exploit references come with the NVD record
+// of a CVE, so they are missing from the findings built from an advisory
+// alone. The ICS and MSRC indexes degrade a result once they stop being
+// refreshed.
+const (
+	SignalEPSS             = "epss"
+	SignalVendorAdvisories = "vendor_advisories"
+	SignalKEV              = "kev"
+	SignalExploitIntel     = "exploit_intel"
+	SignalICSAdvisories    = "ics_advisories"
+	SignalMSRCUpdates      = "msrc_updates"
+)
+
+// Ages of the newest document of an advisory index past which it is
+// reported stale. CISA publishes ICS advisories every week and Microsoft its
+// security updates every month.
+const (
+	ICSAdvisoriesMaxAge = 30 * 24 * time.Hour
+	MSRCUpdatesMaxAge   = 45 * 24 * time.Hour
+)
+
+// EPSSSource scores CVEs in bulk, leaving out the ones it hasn't scored, e.g.
+// an intel.EPSSClient.
+type EPSSSource interface {
+	Scores(ctx context.Context, cveIDs []string) (map[string]intel.EPSSScore, error)
+}
+
+// WithEPSSScores adds the EPSS probability of the findings of the tenants
+// with the epss feature on. Hosts are still published when source fails,
+// with a degradation notice.
+func WithEPSSScores(source EPSSSource) NmapServiceOption {
+	return func(s *NmapService) {
+		s.epss = source
+	}
+}
+
+type degradationKey struct{}
+
+// degradation collects the optional sources that failed during the analysis
+// of a host.
+type degradation struct {
+	mu      sync.Mutex
+	missing []results.MissingSignal
+}
+
+// withDegradation returns a context collecting the failures of the optional
+// sources queried with it.
+func withDegradation(ctx context.Context) (context.Context, *degradation) {
+	d := &degradation{}
+	return context.WithValue(ctx, degradationKey{}, d), d
+}
+
+// degrade records a failed lookup of signal in the degradation collected by
+// ctx, keeping the first error of each signal.
+func degrade(ctx context.Context, signal string, err error) {
+	d, ok := ctx.Value(degradationKey{}).(*degradation)
+	if !ok {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for i := range d.missing {
+		if d.missing[i].Signal == signal {
+			d.missing[i].Failures++
+			return
+		}
+	}
+	d.missing = append(d.missing, results.MissingSignal{Signal: signal, Failures: 1, Error: err.Error()})
+}
+
+// degradeStale records signal as missing in the degradation collected by ctx
+// when the newest document of its index, released at latest, is older than
+// maxAge or when the index holds no dated document.
+func degradeStale(ctx context.Context, signal string, latest time.Time, maxAge time.Duration) {
+	switch {
+	case latest.IsZero():
+		degrade(ctx, signal, errors.New("the index holds no dated document"))
+	case time.Since(latest) > maxAge:
+		degrade(ctx, signal, fmt.Errorf("the newest indexed document was released on %s", latest.Format(time.DateOnly)))
+	}
+}
+
+// notice returns the degradation notice of the host, nil when every source
+// answered.
+func (d *degradation) notice() *results.Degradation {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if len(d.missing) == 0 {
+		return nil
+	}
+	return &results.Degradation{Missing: append([]results.MissingSignal(nil), d.missing...)}
+}
+
+// scoreEPSS sets the EPSS probability of the findings of result, in a single
+// bulk lookup.
+func (s *NmapService) scoreEPSS(ctx context.Context, result *results.NmapResult) {
+	if s.epss == nil || !features.Enabled(ctx, features.FlagEPSS) {
+		return
+	}
+
+	var vulns []*results.Vulnerability
+	for i := range result.MostLikelyOS.Vulnerabilities {
+		vulns = append(vulns, &result.MostLikelyOS.Vulnerabilities[i])
+	}
+	for i := range result.ScannedPorts {
+		for j := range result.ScannedPorts[i].Vulnerabilities {
+			vulns = append(vulns, &result.ScannedPorts[i].Vulnerabilities[j])
+		}
+	}
+	seen := make(map[string]bool)
+	var ids []string
+	for _, v := range vulns {
+		if v.ID != "" && !seen[v.ID] {
+			seen[v.ID] = true
+			ids = append(ids, v.ID)
+		}
+	}
+	if len(ids) == 0 {
+		return
+	}
+
+	scores, err := s.epss.Scores(ctx, ids)
+	if err != nil {
+		slog.Warn("Failed to fetch EPSS scores, keeping NVD findings only",
+			slog.String("host_address", result.HostAddress),
+			slog.Any("error", err))
+		degrade(ctx, SignalEPSS, err)
+		return
+	}
+	for _, v := range vulns {
+		if score, ok := scores[v.ID]; ok {
+			probability := score.Probability
+			v.EPSS = &probability
+		}
+	}
+}
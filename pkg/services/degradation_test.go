@@ -0,0 +1,90 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/kptm-tools/common/common/pkg/results/tools"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/features"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/intel"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/results"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/tenant"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type stubEPSSSource struct {
+	scores map[string]intel.EPSSScore
+	err    error
+}
+
+func (s stubEPSSSource) Scores(ctx context.Context, cveIDs []string) (map[string]intel.EPSSScore, error) {
+	return s.scores, s.err
+}
+
+func Test_NmapService_scoreEPSS(t *testing.T) {
+	features.SetDefault(features.NewStaticProvider(map[features.Flag]features.Rule{
+		features.FlagEPSS: {Tenants: map[string]features.Mode{"acme": features.ModeOn}},
+	}))
+	t.Cleanup(func() { features.SetDefault(features.NewStaticProvider(nil)) })
+
+	newResult := func() *results.NmapResult {
+		return &results.NmapResult{
+			HostAddress: "10.0.0.1",
+			ScannedPorts: []results.PortData{{ID: 443, Vulnerabilities: []results.Vulnerability{
+				{Vulnerability: tools.Vulnerability{ID: "CVE-2021-44228"}},
+				{Vulnerability: tools.Vulnerability{ID: "CVE-2024-0001"}},
+			}}},
+		}
+	}
+	source := stubEPSSSource{scores: map[string]intel.EPSSScore{"CVE-2021-44228": {Probability: 0.94}}}
+
+	ctx, degraded := withDegradation(tenant.WithID(context.Background(), "acme"))
+	result := newResult()
+	NewNmapService(nil, WithEPSSScores(source)).scoreEPSS(ctx, result)
+	vulns := result.ScannedPorts[0].Vulnerabilities
+	require.NotNil(t, vulns[0].EPSS)
+	assert.Equal(t, 0.94, *vulns[0].EPSS)
+	assert.Nil(t, vulns[1].EPSS, "Expected CVEs FIRST hasn't scored to keep no EPSS")
+	assert.Nil(t, degraded.notice())
+
+	// Tenants without the feature aren't scored
+	result = newResult()
+	NewNmapService(nil, WithEPSSScores(source)).scoreEPSS(tenant.WithID(context.Background(), "globex"), result)
+	assert.Nil(t, result.ScannedPorts[0].Vulnerabilities[0].EPSS)
+
+	// The host is kept with a degradation notice when EPSS is down
+	ctx, degraded = withDegradation(tenant.WithID(context.Background(), "acme"))
+	result = newResult()
+	NewNmapService(nil, WithEPSSScores(stubEPSSSource{err: errors.New("EPSS API returned 503 Service Unavailable")})).scoreEPSS(ctx, result)
+	assert.Len(t, result.ScannedPorts[0].Vulnerabilities, 2)
+	assert.Equal(t, &results.Degradation{Missing: []results.MissingSignal{
+		{Signal: SignalEPSS, Failures: 1, Error: "EPSS API returned 503 Service Unavailable"},
+	}}, degraded.notice())
+}
+
+func Test_degrade(t *testing.T) {
+	t.Parallel()
+	degrade(context.Background(), SignalEPSS, errors.New("ignored without a collector"))
+
+	ctx, degraded := withDegradation(context.Background())
+	degrade(ctx, SignalVendorAdvisories, errors.New("timeout"))
+	degrade(ctx, SignalVendorAdvisories, errors.New("connection refused"))
+	assert.Equal(t, []results.MissingSignal{{Signal: SignalVendorAdvisories, Failures: 2, Error: "timeout"}}, degraded.notice().Missing)
+}
+
+func Test_degradeStale(t *testing.T) {
+	t.Parallel()
+	ctx, degraded := withDegradation(context.Background())
+	degradeStale(ctx, SignalICSAdvisories, time.Now().Add(-24*time.Hour), ICSAdvisoriesMaxAge)
+	assert.Nil(t, degraded.notice(), "Expected a recent index not to degrade the result")
+
+	degradeStale(ctx, SignalICSAdvisories, time.Date(2023, 2, 14, 0, 0, 0, 0, time.UTC), ICSAdvisoriesMaxAge)
+	degradeStale(ctx, SignalMSRCUpdates, time.Time{}, MSRCUpdatesMaxAge)
+	assert.Equal(t, []results.MissingSignal{
+		{Signal: SignalICSAdvisories, Failures: 1, Error: "the newest indexed document was released on 2023-02-14"},
+		{Signal: SignalMSRCUpdates, Failures: 1, Error: "the index holds no dated document"},
+	}, degraded.notice().Missing)
+}
@@ -0,0 +1,112 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/kptm-tools/vulnerability-analysis/nvd/schema"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/advisory"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/interfaces"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/results"
+)
+
+var ErrCVENotFound = errors.New("CVE not found in NVD")
+
+// IdentifierResolver maps an advisory identifier (CVE, GHSA, DSA, RHSA...)
+// to the CVE IDs it refers to.
+type IdentifierResolver interface {
+	ResolveToCVEs(ctx context.Context, id string) ([]string, error)
+}
+
+type EnrichmentService struct {
+	resolver   IdentifierResolver
+	nvd        *NVDClient
+	enrichment Enrichment
+}
+
+var _ interfaces.IEnrichmentService = (*EnrichmentService)(nil)
+
+// NewEnrichmentService returns a service enriching CVEs through nvd. A nil
+// resolver uses the default advisory chain and a nil client the public API.
+func NewEnrichmentService(resolver IdentifierResolver, nvd *NVDClient) *EnrichmentService {
+	if resolver == nil {
+		resolver = advisory.NewDefaultChain("")
+	}
+	if nvd == nil {
+		nvd = NewNVDClient()
+	}
+	return &EnrichmentService{resolver: resolver, nvd: nvd, enrichment: DefaultEnrichment()}
+}
+
+// EnrichByIdentifiers resolves each identifier to its CVE IDs and returns the
+// NVD enriched vulnerabilities. The CVEs are fetched as a batch, see
+// NVDClient.FetchByCVEIDs. Identifiers that fail to resolve or enrich are
+// reported in the returned error while the remaining ones are still processed.
+func (s *EnrichmentService) EnrichByIdentifiers(ctx context.Context, ids []string) ([]results.Vulnerability, error) {
+	var (
+		vulns  []results.Vulnerability
+		errs   []error
+		cveIDs []string
+		origin = make(map[string]string) // The identifier each CVE was resolved from
+	)
+
+	for _, id := range ids {
+		resolved, err := s.resolver.ResolveToCVEs(ctx, id)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		slog.Debug("Resolved advisory identifier",
+			slog.String("identifier", id),
+			slog.Any("cve_ids", resolved))
+
+		for _, cveID := range resolved {
+			cveID = strings.ToUpper(strings.TrimSpace(cveID))
+			if _, seen := origin[cveID]; seen {
+				continue
+			}
+			origin[cveID] = id
+			cveIDs = append(cveIDs, cveID)
+		}
+	}
+
+	records, err := s.nvd.FetchByCVEIDs(ctx, cveIDs)
+	var batchErr *CVEBatchError
+	if err != nil && !errors.As(err, &batchErr) {
+		return nil, errors.Join(append(errs, err)...)
+	}
+	for _, cveID := range cveIDs {
+		vuln, err := s.enrichCVE(ctx, cveID, records, batchErr)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to enrich %s (from %s): %w", cveID, origin[cveID], err))
+			continue
+		}
+		vulns = append(vulns, *vuln)
+	}
+
+	s.nvd.nameAssigners(ctx, vulns)
+	return vulns, errors.Join(errs...)
+}
+
+// enrichCVE enriches the record of cveID fetched in records, or returns the
+// error of its lookup.
+func (s *EnrichmentService) enrichCVE(ctx context.Context, cveID string, records map[string]schema.Vulnerability, batchErr *CVEBatchError) (*results.Vulnerability, error) {
+	if batchErr != nil && batchErr.Failed[cveID] != nil {
+		return nil, batchErr.Failed[cveID]
+	}
+	record, ok := records[cveID]
+	if !ok {
+		return nil, ErrCVENotFound
+	}
+
+	var vuln results.Vulnerability
+	if err := s.enrichment.enrichVulnerabilityWithNvdData(ctx, &vuln, record); err != nil {
+		return nil, err
+	}
+	vuln.Provenance = &results.Provenance{Source: "nvd"}
+	applyRiskModel(ctx, "", &vuln)
+	return &vuln, nil
+}
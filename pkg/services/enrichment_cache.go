@@ -0,0 +1,133 @@
+package services
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+
+	"github.com/kptm-tools/vulnerability-analysis/nvd/schema"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/results"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/risk"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/tenant"
+)
+
+// EnrichmentCache keeps the findings enriched from NVD records, so that CVEs
+// unchanged since a previous scan skip parsing and scoring. Findings are
+// keyed by CVE, NVD lastModified and risk model, and by the other inputs of
+// the enrichment: the CVSS versions preferred by the tenant and the
+// exposure. The least recently used findings are evicted past the maximum
+// number of entries. It is safe for concurrent use.
+type EnrichmentCache struct {
+	mu         sync.Mutex
+	maxEntries int
+	entries    map[enrichmentKey]*list.Element
+	lru        *list.List
+	stats      EnrichmentCacheStats
+}
+
+// EnrichmentCacheStats counts the lookups of an EnrichmentCache.
+type EnrichmentCacheStats struct {
+	Entries int `json:"entries"`
+	Hits    int `json:"hits"`
+	Misses  int `json:"misses"`
+	Evicted int `json:"evicted"`
+}
+
+type enrichmentKey struct {
+	cveID        string
+	lastModified string
+	riskModel    string
+	cvssOrder    string
+	exposure     results.ExposureType
+}
+
+type enrichedEntry struct {
+	key  enrichmentKey
+	vuln results.Vulnerability
+}
+
+// NewEnrichmentCache returns a cache of at most maxEntries findings, or of
+// every finding when maxEntries isn't positive.
+func NewEnrichmentCache(maxEntries int) *EnrichmentCache {
+	return &EnrichmentCache{
+		maxEntries: maxEntries,
+		entries:    make(map[enrichmentKey]*list.Element),
+		lru:        list.New(),
+	}
+}
+
+// Stats returns the counters of the cache.
+func (c *EnrichmentCache) Stats() EnrichmentCacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := c.stats
+	stats.Entries = c.lru.Len()
+	return stats
+}
+
+func (c *EnrichmentCache) get(key enrichmentKey) (results.Vulnerability, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[key]
+	if !ok {
+		c.stats.Misses++
+		return results.Vulnerability{}, false
+	}
+	c.stats.Hits++
+	c.lru.MoveToFront(elem)
+	return cloneVulnerability(elem.Value.(*enrichedEntry).vuln), true
+}
+
+func (c *EnrichmentCache) put(key enrichmentKey, vuln results.Vulnerability) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry := &enrichedEntry{key: key, vuln: cloneVulnerability(vuln)}
+	if elem, ok := c.entries[key]; ok {
+		elem.Value = entry
+		c.lru.MoveToFront(elem)
+		return
+	}
+	c.entries[key] = c.lru.PushFront(entry)
+	for c.maxEntries > 0 && c.lru.Len() > c.maxEntries {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*enrichedEntry).key)
+		c.stats.Evicted++
+	}
+}
+
+// enrichmentKeyOf returns the key of the finding enriched from nvdVuln into
+// vuln, and false for records without lastModified, whose versions can't be
+// told apart.
+func (e Enrichment) enrichmentKeyOf(ctx context.Context, vuln *results.Vulnerability, nvdVuln schema.Vulnerability) (enrichmentKey, bool) {
+	if nvdVuln.Cve.ID == "" || nvdVuln.Cve.LastModified == "" {
+		return enrichmentKey{}, false
+	}
+	return enrichmentKey{
+		cveID:        nvdVuln.Cve.ID,
+		lastModified: nvdVuln.Cve.LastModified,
+		riskModel:    risk.Current.Name(),
+		cvssOrder:    fmt.Sprint(e.CVSSPreference.Order(tenant.FromContext(ctx))),
+		exposure:     vuln.Exposure,
+	}, true
+}
+
+// cloneVulnerability copies the slices and maps of an enriched finding, so
+// that callers appending to a cached finding don't change it.
+func cloneVulnerability(vuln results.Vulnerability) results.Vulnerability {
+	vuln.References = slices.Clone(vuln.References)
+	vuln.VendorComments = slices.Clone(vuln.VendorComments)
+	vuln.CWEs = slices.Clone(vuln.CWEs)
+	vuln.RawMetrics = maps.Clone(vuln.RawMetrics)
+	if vuln.CVSSv2Flags != nil {
+		flags := *vuln.CVSSv2Flags
+		vuln.CVSSv2Flags = &flags
+	}
+	return vuln
+}
@@ -0,0 +1,51 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"github.com/kptm-tools/vulnerability-analysis/pkg/results"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/tenant"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEnrichment_Cache(t *testing.T) {
+	t.Parallel()
+	pref, err := ParseCVSSPreference("acme=2.0")
+	require.NoError(t, err)
+	e := DefaultEnrichment()
+	e.CVSSPreference = pref
+	e.Cache = NewEnrichmentCache(0)
+	nvdVuln := createMockNvdVulnerabilityWithV31()
+
+	var first results.Vulnerability
+	require.NoError(t, e.enrichVulnerabilityWithNvdData(context.Background(), &first, nvdVuln))
+	first.References = append(first.References, "https://advisory.example/1")
+
+	var second results.Vulnerability
+	require.NoError(t, e.enrichVulnerabilityWithNvdData(context.Background(), &second, nvdVuln))
+	assert.Equal(t, first.RiskScore, second.RiskScore)
+	assert.NotContains(t, second.References, "https://advisory.example/1", "Expected cached findings to be copied")
+	assert.Equal(t, EnrichmentCacheStats{Entries: 1, Hits: 1, Misses: 1}, e.Cache.Stats())
+
+	// Another version of the record, exposure or CVSS preference is enriched again
+	nvdVuln.Cve.LastModified = "2030-01-01T00:00:00.000"
+	require.NoError(t, e.enrichVulnerabilityWithNvdData(context.Background(), &results.Vulnerability{}, nvdVuln))
+	require.NoError(t, e.enrichVulnerabilityWithNvdData(context.Background(), &results.Vulnerability{Exposure: results.ExposureInternal}, nvdVuln))
+	require.NoError(t, e.enrichVulnerabilityWithNvdData(tenant.WithID(context.Background(), "acme"), &results.Vulnerability{}, nvdVuln))
+	assert.Equal(t, EnrichmentCacheStats{Entries: 4, Hits: 1, Misses: 4}, e.Cache.Stats())
+}
+
+func TestEnrichmentCache_Evicts(t *testing.T) {
+	t.Parallel()
+	c := NewEnrichmentCache(1)
+	c.put(enrichmentKey{cveID: "CVE-2024-0001"}, results.Vulnerability{})
+	c.put(enrichmentKey{cveID: "CVE-2024-0002"}, results.Vulnerability{})
+
+	_, hit := c.get(enrichmentKey{cveID: "CVE-2024-0001"})
+	assert.False(t, hit)
+	_, hit = c.get(enrichmentKey{cveID: "CVE-2024-0002"})
+	assert.True(t, hit)
+	assert.Equal(t, 1, c.Stats().Evicted)
+}
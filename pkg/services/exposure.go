@@ -0,0 +1,84 @@
+package services
+
+import (
+	"context"
+	"net/netip"
+
+	"github.com/Ullaakut/nmap/v2"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/results"
+)
+
+// sharedAddressSpace is the carrier-grade NAT range (RFC 6598), which is not
+// reachable from the internet but isn't covered by netip.Addr.IsPrivate.
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// isPublicAddress reports whether address is a globally routable IP.
+func isPublicAddress(address string) (public bool, ok bool) {
+	ip, err := netip.ParseAddr(address)
+	if err != nil {
+		return false, false
+	}
+	ip = ip.Unmap()
+
+	if ip.IsPrivate() || ip.IsLoopback() || ip.IsLinkLocalUnicast() ||
+		ip.IsUnspecified() || sharedAddressSpace.Contains(ip) {
+		return false, true
+	}
+	return ip.IsGlobalUnicast(), true
+}
+
+// publicHost reports whether a host known by addresses has a globally
+// routable one, e.g. a dual-stack host with a private IPv4 and a global IPv6
+// address, and whether any of them is an IP.
+func publicHost(addresses []string) (public bool, ok bool) {
+	for _, address := range addresses {
+		p, isIP := isPublicAddress(address)
+		public = public || p
+		ok = ok || isIP
+	}
+	return public, ok
+}
+
+// portExposure classifies a scanned port: it is internet-facing when one of
+// the addresses of the host is public and the port was found open.
+func portExposure(addresses []string, port nmap.Port) results.ExposureType {
+	public, ok := publicHost(addresses)
+	if !ok {
+		return results.ExposureUnknown
+	}
+	if public && port.State.State == "open" {
+		return results.ExposureInternetFacing
+	}
+	return results.ExposureInternal
+}
+
+// hostExposure classifies a host: it is internet-facing when one of its
+// addresses is public and it has at least one open port.
+func hostExposure(addresses []string, ports []nmap.Port) results.ExposureType {
+	if _, ok := publicHost(addresses); !ok {
+		return results.ExposureUnknown
+	}
+	for _, port := range ports {
+		if portExposure(addresses, port) == results.ExposureInternetFacing {
+			return results.ExposureInternetFacing
+		}
+	}
+	return results.ExposureInternal
+}
+
+type hostAddressesKey struct{}
+
+// withHostAddresses returns a context carrying every address of the host
+// being enriched, which its port lookups classify exposure over.
+func withHostAddresses(ctx context.Context, addresses []string) context.Context {
+	return context.WithValue(ctx, hostAddressesKey{}, addresses)
+}
+
+// hostAddresses returns the addresses of the host carried by ctx, or only
+// hostAddress when it carries none.
+func hostAddresses(ctx context.Context, hostAddress string) []string {
+	if addresses, ok := ctx.Value(hostAddressesKey{}).([]string); ok && len(addresses) > 0 {
+		return addresses
+	}
+	return []string{hostAddress}
+}
@@ -0,0 +1,57 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/Ullaakut/nmap/v2"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/results"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_portExposure(t *testing.T) {
+	t.Parallel()
+	open := nmap.Port{State: nmap.State{State: "open"}}
+	filtered := nmap.Port{State: nmap.State{State: "filtered"}}
+
+	testCases := []struct {
+		name        string
+		hostAddress string
+		port        nmap.Port
+		expected    results.ExposureType
+	}{
+		{name: "Public open port", hostAddress: "8.8.8.8", port: open, expected: results.ExposureInternetFacing},
+		{name: "Public filtered port", hostAddress: "8.8.8.8", port: filtered, expected: results.ExposureInternal},
+		{name: "RFC1918 address", hostAddress: "192.168.1.10", port: open, expected: results.ExposureInternal},
+		{name: "Carrier-grade NAT address", hostAddress: "100.72.0.1", port: open, expected: results.ExposureInternal},
+		{name: "Loopback address", hostAddress: "127.0.0.1", port: open, expected: results.ExposureInternal},
+		{name: "Public IPv6 address", hostAddress: "2001:4860:4860::8888", port: open, expected: results.ExposureInternetFacing},
+		{name: "Unique local IPv6 address", hostAddress: "fd00::1", port: open, expected: results.ExposureInternal},
+		{name: "Not an IP", hostAddress: "scanme.nmap.org", port: open, expected: results.ExposureUnknown},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, tc.expected, portExposure([]string{tc.hostAddress}, tc.port))
+		})
+	}
+}
+
+func Test_hostExposure(t *testing.T) {
+	t.Parallel()
+	ports := []nmap.Port{
+		{State: nmap.State{State: "filtered"}},
+		{State: nmap.State{State: "open"}},
+	}
+
+	assert.Equal(t, results.ExposureInternetFacing, hostExposure([]string{"8.8.8.8"}, ports))
+	assert.Equal(t, results.ExposureInternal, hostExposure([]string{"8.8.8.8"}, ports[:1]))
+	assert.Equal(t, results.ExposureInternal, hostExposure([]string{"10.0.0.1"}, ports))
+	assert.Equal(t, results.ExposureUnknown, hostExposure([]string{""}, ports))
+
+	// Dual-stack hosts are classified over all of their addresses
+	assert.Equal(t, results.ExposureInternetFacing, hostExposure([]string{"192.168.1.10", "2001:4860:4860::8888"}, ports))
+	assert.Equal(t, results.ExposureInternetFacing, portExposure([]string{"192.168.1.10", "2001:4860:4860::8888"}, ports[1]))
+	assert.Equal(t, results.ExposureInternal, hostExposure([]string{"192.168.1.10", "fd00::1"}, ports))
+	assert.Equal(t, results.ExposureInternal, hostExposure([]string{"192.168.1.10", "scanme.nmap.org"}, ports))
+}
@@ -0,0 +1,59 @@
+package services
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/kptm-tools/vulnerability-analysis/pkg/results"
+)
+
+// appendICSFindings attaches the ICS advisories covering cpe to the matching
+// findings, adding the advisory CVEs NVD didn't match. Lookups in a stale
+// index degrade the result.
+func (s *NmapService) appendICSFindings(ctx context.Context, hostAddress string, exposure results.ExposureType, cpe string, vulns []results.Vulnerability) []results.Vulnerability {
+	if s.ics == nil || cpe == "" {
+		return vulns
+	}
+	degradeStale(ctx, SignalICSAdvisories, s.ics.Latest(), ICSAdvisoriesMaxAge)
+	findings := s.ics.Lookup(cpe)
+	if len(findings) == 0 {
+		return vulns
+	}
+
+	index := make(map[string]int, len(vulns))
+	for i, vuln := range vulns {
+		index[vuln.ID] = i
+	}
+
+	added := 0
+	for _, f := range findings {
+		i, ok := index[f.CVE]
+		if !ok {
+			vuln := s.advisoryVulnerability(ctx, f.CVE, advisoryRecord{
+				Type:      "ics-cert",
+				Title:     f.AdvisoryTitle,
+				URL:       f.URL,
+				CVSSScore: f.CVSSScore,
+				Severity:  f.Severity,
+			}, exposure)
+			applyRiskModel(ctx, hostAddress, &vuln)
+			vuln.Provenance = &results.Provenance{Source: "ics-cert", InputCPE: cpe, MatchedCPE: cpe}
+			i = len(vulns)
+			index[f.CVE] = i
+			vulns = append(vulns, vuln)
+			added++
+		}
+		vulns[i].ICSAdvisories = append(vulns[i].ICSAdvisories, results.ICSAdvisory{
+			ID:               f.AdvisoryID,
+			URL:              f.URL,
+			Mitigations:      f.Mitigations,
+			AffectedVersions: f.AffectedVersions,
+		})
+	}
+
+	slog.Info("Matched ICS advisories",
+		slog.Int("findings", len(findings)),
+		slog.Int("n_vulners_added", added),
+		slog.String("cpe", cpe))
+	return vulns
+}
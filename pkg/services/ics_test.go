@@ -0,0 +1,46 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"github.com/kptm-tools/common/common/pkg/results/tools"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/ics"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/results"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_appendICSFindings(t *testing.T) {
+	t.Parallel()
+	idx := ics.NewIndex()
+	idx.Add(ics.Advisory{
+		ID:       "ICSA-23-045-01",
+		Title:    "Siemens SCALANCE X-200 Switch Family",
+		URL:      "https://www.cisa.gov/news-events/ics-advisories/icsa-23-045-01",
+		Products: []ics.Product{{ID: "P1", Vendor: "Siemens", Name: "SCALANCE X204-2", Version: "vers:intdot/<5.2.6"}},
+		Vulns: []ics.Vuln{
+			{CVE: "CVE-2022-46140", Affected: []string{"P1"}, Remediations: []ics.Remediation{{Category: "vendor_fix", Details: "Update to V5.2.6"}}},
+			{CVE: "CVE-2022-46141", Affected: []string{"P1"}, CVSSScore: 5.3, Severity: "MEDIUM"},
+		},
+	})
+	s := NewNmapService(newTestNVDClient("http://127.0.0.1:0"), WithICSIndex(idx))
+
+	cpe := "cpe:2.3:h:siemens:scalance_x204-2:-:*:*:*:*:*:*:*"
+	nvdVulns := []results.Vulnerability{{Vulnerability: tools.Vulnerability{ID: "CVE-2022-46140"}}}
+
+	vulns := s.appendICSFindings(context.Background(), "10.0.0.1", results.ExposureInternal, cpe, nvdVulns)
+	require.Len(t, vulns, 2)
+
+	assert.Equal(t, []results.ICSAdvisory{{
+		ID:               "ICSA-23-045-01",
+		URL:              "https://www.cisa.gov/news-events/ics-advisories/icsa-23-045-01",
+		Mitigations:      []string{"Update to V5.2.6"},
+		AffectedVersions: []string{"vers:intdot/<5.2.6"},
+	}}, vulns[0].ICSAdvisories)
+
+	assert.Equal(t, "CVE-2022-46141", vulns[1].ID)
+	assert.Equal(t, 5.3, vulns[1].BaseCVSSScore)
+	assert.Equal(t, "ics-cert", vulns[1].Provenance.Source)
+	assert.Len(t, vulns[1].ICSAdvisories, 1)
+}
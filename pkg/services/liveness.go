@@ -0,0 +1,118 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kptm-tools/vulnerability-analysis/pkg/results"
+)
+
+// ErrProbeUnsupported is returned by probers which can't check a protocol,
+// the findings of its services are published unmarked.
+var ErrProbeUnsupported = errors.New("protocol not supported by prober")
+
+// Prober checks that a service of a host still answers.
+type Prober interface {
+	Probe(ctx context.Context, host string, port uint16, protocol string) error
+}
+
+// TCPProber checks TCP services by connecting to them.
+type TCPProber struct {
+	Timeout time.Duration
+}
+
+var _ Prober = TCPProber{}
+
+func (p TCPProber) Probe(ctx context.Context, host string, port uint16, protocol string) error {
+	if !strings.EqualFold(protocol, "tcp") {
+		return fmt.Errorf("%w: %s", ErrProbeUnsupported, protocol)
+	}
+	if p.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.Timeout)
+		defer cancel()
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(host, strconv.Itoa(int(port))))
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// WithLivenessCheck re-probes the services of a host with findings once it
+// is analyzed, marking the findings of the ones no longer answering as
+// stale detections. The OS findings are marked when no service answers.
+func WithLivenessCheck(prober Prober) NmapServiceOption {
+	return func(s *NmapService) {
+		s.prober = prober
+	}
+}
+
+// checkLiveness probes the open ports of result with findings in parallel
+// and marks the findings of the ones which don't answer.
+func (s *NmapService) checkLiveness(ctx context.Context, result *results.NmapResult) {
+	if s.prober == nil || result.HostAddress == "" {
+		return
+	}
+
+	type probe struct {
+		done bool
+		err  error
+	}
+	probes := make([]probe, len(result.ScannedPorts))
+	var wg sync.WaitGroup
+	for i, port := range result.ScannedPorts {
+		if len(port.Vulnerabilities) == 0 || port.State != "open" {
+			continue
+		}
+		wg.Add(1)
+		go func(i int, port results.PortData) {
+			defer wg.Done()
+			err := s.prober.Probe(ctx, result.HostAddress, port.ID, port.Protocol)
+			probes[i] = probe{done: !errors.Is(err, ErrProbeUnsupported), err: err}
+		}(i, port)
+	}
+	wg.Wait()
+
+	// A cancelled scan says nothing about the services
+	if ctx.Err() != nil {
+		return
+	}
+
+	probed, stale := 0, 0
+	for i, p := range probes {
+		if !p.done {
+			continue
+		}
+		probed++
+		if p.err == nil {
+			continue
+		}
+		stale++
+		port := &result.ScannedPorts[i]
+		markStale(port.Vulnerabilities)
+		slog.Info("Service no longer reachable, marking its findings as stale detections",
+			slog.String("host_address", result.HostAddress),
+			slog.Int("port_id", int(port.ID)),
+			slog.Int("n_vulners", len(port.Vulnerabilities)),
+			slog.Any("error", p.err))
+	}
+	if stale > 0 && stale == probed {
+		markStale(result.MostLikelyOS.Vulnerabilities)
+	}
+}
+
+func markStale(vulns []results.Vulnerability) {
+	for i := range vulns {
+		vulns[i].StaleDetection = true
+	}
+}
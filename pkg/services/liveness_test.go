@@ -0,0 +1,77 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/kptm-tools/common/common/pkg/results/tools"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/results"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stubProber answers for the ports of up and fails for the others.
+type stubProber struct {
+	up map[uint16]bool
+}
+
+func (p stubProber) Probe(ctx context.Context, host string, port uint16, protocol string) error {
+	if protocol == "udp" {
+		return ErrProbeUnsupported
+	}
+	if !p.up[port] {
+		return errors.New("connection refused")
+	}
+	return nil
+}
+
+func livenessResult() *results.NmapResult {
+	vulns := func() []results.Vulnerability {
+		return []results.Vulnerability{{Vulnerability: tools.Vulnerability{ID: "CVE-2024-0001"}}}
+	}
+	return &results.NmapResult{
+		HostAddress:  "192.0.2.10",
+		MostLikelyOS: results.OSData{Vulnerabilities: vulns()},
+		ScannedPorts: []results.PortData{
+			{ID: 22, Protocol: "tcp", State: "open", Vulnerabilities: vulns()},
+			{ID: 80, Protocol: "tcp", State: "open", Vulnerabilities: vulns()},
+			{ID: 161, Protocol: "udp", State: "open", Vulnerabilities: vulns()},
+		},
+	}
+}
+
+func TestNmapService_checkLiveness(t *testing.T) {
+	t.Parallel()
+	s := NewNmapService(nil, WithLivenessCheck(stubProber{up: map[uint16]bool{22: true}}))
+	result := livenessResult()
+	s.checkLiveness(context.Background(), result)
+
+	assert.False(t, result.ScannedPorts[0].Vulnerabilities[0].StaleDetection)
+	assert.True(t, result.ScannedPorts[1].Vulnerabilities[0].StaleDetection)
+	assert.False(t, result.ScannedPorts[2].Vulnerabilities[0].StaleDetection, "Expected unprobed services to be left unmarked")
+	assert.False(t, result.MostLikelyOS.Vulnerabilities[0].StaleDetection, "Expected the OS findings to stand while a service answers")
+
+	// No service answers, the host is gone
+	s = NewNmapService(nil, WithLivenessCheck(stubProber{}))
+	result = livenessResult()
+	s.checkLiveness(context.Background(), result)
+	assert.True(t, result.ScannedPorts[0].Vulnerabilities[0].StaleDetection)
+	assert.True(t, result.MostLikelyOS.Vulnerabilities[0].StaleDetection)
+}
+
+func TestTCPProber_Probe(t *testing.T) {
+	t.Parallel()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	port := uint16(listener.Addr().(*net.TCPAddr).Port)
+
+	prober := TCPProber{Timeout: time.Second}
+	assert.NoError(t, prober.Probe(context.Background(), "127.0.0.1", port, "tcp"))
+	assert.ErrorIs(t, prober.Probe(context.Background(), "127.0.0.1", port, "udp"), ErrProbeUnsupported)
+
+	require.NoError(t, listener.Close())
+	assert.Error(t, prober.Probe(context.Background(), "127.0.0.1", port, "tcp"))
+}
@@ -0,0 +1,61 @@
+package services
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+
+	"github.com/kptm-tools/vulnerability-analysis/pkg/msrc"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/results"
+)
+
+// degradeStaleKBs reports a stale MSRC index in the degradation notice of
+// Windows hosts, whose missing KBs it may understate.
+func (s *NmapService) degradeStaleKBs(ctx context.Context, cpe string) {
+	if s.msrc == nil || !msrc.IsWindows(cpe) {
+		return
+	}
+	degradeStale(ctx, SignalMSRCUpdates, s.msrc.Latest(), MSRCUpdatesMaxAge)
+}
+
+// attachKBs attaches the KBs fixing the OS findings of a Windows host and
+// lists the KBs the host is missing.
+func (s *NmapService) attachKBs(result *results.NmapResult) {
+	cpe := result.MostLikelyOS.CPE
+	if s.msrc == nil || !msrc.IsWindows(cpe) {
+		return
+	}
+
+	var missing []string
+	superseded := make(map[string]bool)
+	vulns := result.MostLikelyOS.Vulnerabilities
+	for i := range vulns {
+		for _, kb := range s.msrc.Lookup(cpe, vulns[i].ID) {
+			vulns[i].KBs = append(vulns[i].KBs, results.KBUpdate{
+				ID:         kb.ID,
+				URL:        kb.URL,
+				Supersedes: kb.Supersedes,
+				Products:   kb.Products,
+			})
+			if !slices.Contains(missing, kb.ID) {
+				missing = append(missing, kb.ID)
+			}
+			for _, old := range kb.Supersedes {
+				superseded[old] = true
+			}
+		}
+	}
+	if len(missing) == 0 {
+		return
+	}
+
+	// Installing the newer cumulative update fixes the CVEs of both
+	missing = slices.DeleteFunc(missing, func(kb string) bool { return superseded[kb] })
+	slices.Sort(missing)
+	result.MissingKBs = missing
+
+	slog.Info("Mapped Windows findings to KBs",
+		slog.String("host_address", result.HostAddress),
+		slog.String("cpe", cpe),
+		slog.Any("missing_kbs", missing))
+}
@@ -0,0 +1,80 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/kptm-tools/common/common/pkg/results/tools"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/msrc"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/results"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_attachKBs(t *testing.T) {
+	t.Parallel()
+	idx := msrc.NewIndex()
+	idx.Add(msrc.Update{
+		ID:       "2023-Dec",
+		Products: map[string]string{"10852": "Windows 10 Version 1607 for x64-based Systems"},
+		Vulns: []msrc.Vuln{
+			{CVE: "CVE-2023-35628", Fixes: []msrc.Fix{{KB: "KB5033373", ProductIDs: []string{"10852"}}}},
+			{CVE: "CVE-2023-36005", Fixes: []msrc.Fix{{KB: "KB5033373", ProductIDs: []string{"10852"}}}},
+		},
+	})
+	idx.Add(msrc.Update{
+		ID:       "2024-Jan",
+		Products: map[string]string{"10852": "Windows 10 Version 1607 for x64-based Systems"},
+		Vulns: []msrc.Vuln{
+			{CVE: "CVE-2024-20674", Fixes: []msrc.Fix{{KB: "KB5034119", Supersedes: []string{"KB5033373"}, ProductIDs: []string{"10852"}}}},
+			{CVE: "CVE-2024-20700", Fixes: []msrc.Fix{{KB: "KB5034767", ProductIDs: []string{"10852"}}}},
+		},
+	})
+	s := NewNmapService(newTestNVDClient("http://127.0.0.1:0"), WithMSRCIndex(idx))
+
+	newResult := func(cpe string) *results.NmapResult {
+		return &results.NmapResult{
+			HostAddress: "10.0.0.1",
+			MostLikelyOS: results.OSData{CPE: cpe, Vulnerabilities: []results.Vulnerability{
+				{Vulnerability: tools.Vulnerability{ID: "CVE-2023-35628"}},
+				{Vulnerability: tools.Vulnerability{ID: "CVE-2024-20674"}},
+				{Vulnerability: tools.Vulnerability{ID: "CVE-2024-20700"}},
+				{Vulnerability: tools.Vulnerability{ID: "CVE-2024-0001"}},
+			}},
+		}
+	}
+
+	result := newResult("cpe:2.3:o:microsoft:windows_10:1607:*:*:*:*:*:*:*")
+	s.attachKBs(result)
+
+	vulns := result.MostLikelyOS.Vulnerabilities
+	require.Len(t, vulns[0].KBs, 1)
+	assert.Equal(t, "KB5033373", vulns[0].KBs[0].ID)
+	assert.Equal(t, []string{"Windows 10 Version 1607 for x64-based Systems"}, vulns[0].KBs[0].Products)
+	assert.Equal(t, []string{"KB5033373"}, vulns[1].KBs[0].Supersedes)
+	assert.Empty(t, vulns[3].KBs)
+
+	// KB5034119 supersedes KB5033373, fixing CVE-2023-35628 as well
+	assert.Equal(t, []string{"KB5034119", "KB5034767"}, result.MissingKBs)
+
+	linux := newResult("cpe:2.3:o:linux:linux_kernel:5.10:*:*:*:*:*:*:*")
+	s.attachKBs(linux)
+	assert.Nil(t, linux.MissingKBs)
+	assert.Empty(t, linux.MostLikelyOS.Vulnerabilities[0].KBs)
+}
+
+func Test_degradeStaleKBs(t *testing.T) {
+	t.Parallel()
+	idx := msrc.NewIndex()
+	idx.Add(msrc.Update{ID: "2024-Jan", Released: time.Date(2024, 1, 9, 0, 0, 0, 0, time.UTC)})
+	s := NewNmapService(newTestNVDClient("http://127.0.0.1:0"), WithMSRCIndex(idx))
+
+	ctx, degraded := withDegradation(context.Background())
+	s.degradeStaleKBs(ctx, "cpe:2.3:o:linux:linux_kernel:5.10:*:*:*:*:*:*:*")
+	assert.Nil(t, degraded.notice(), "Expected hosts other than Windows ones not to depend on the MSRC index")
+
+	s.degradeStaleKBs(ctx, "cpe:2.3:o:microsoft:windows_10:1607:*:*:*:*:*:*:*")
+	require.NotNil(t, degraded.notice())
+	assert.Equal(t, SignalMSRCUpdates, degraded.notice().Missing[0].Signal)
+}
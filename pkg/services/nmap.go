@@ -4,21 +4,172 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
-	"net"
+	"slices"
 	"time"
 
 	"github.com/Ullaakut/nmap/v2"
 	"github.com/kptm-tools/common/common/pkg/enums"
 	"github.com/kptm-tools/common/common/pkg/results/tools"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/asset"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/classify"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/cpeextract"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/failure"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/ics"
 	"github.com/kptm-tools/vulnerability-analysis/pkg/interfaces"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/msrc"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/psirt"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/references"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/results"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/scans"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/spill"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/titles"
 )
 
-type NmapService struct{}
+type NmapService struct {
+	nvd        *NVDClient
+	enrichment Enrichment
+
+	// spillThreshold is the number of enriched vulnerabilities per host kept
+	// in memory before the remainder is spilled to a file in spillDir.
+	spillThreshold int
+	spillDir       string
+
+	// extendedErrorCodes publishes the error codes of the policy and storage
+	// failure categories instead of the generic tool error code.
+	extendedErrorCodes bool
+
+	// cpeTrace attaches the CPE standardization trace to the provenance of
+	// every finding. It is disabled by default since the trace is repeated
+	// for each vulnerability matched through the same CPE.
+	cpeTrace bool
+
+	// keywordFallback searches NVD by keyword for CPEs without a version
+	keywordFallback *keywordFallback
+
+	// cpeResolution resolves services without a valid CPE with the NVD
+	// Products API
+	cpeResolution bool
+
+	// priority looks the services likely to yield critical or known
+	// exploited findings up first
+	priority *priorityIndex
+
+	// Optional stages, skipped when nil
+	references *references.Checker
+	classifier *classify.Engine
+	psirt      *psirt.Registry
+	ics        *ics.Index
+	msrc       *msrc.Index
+	extractors *cpeextract.Registry
+	epss       EPSSSource
+
+	// scans records the analyzed hosts for reanalysis
+	scans *scans.Store
+
+	// prober re-checks the services with findings before they are
+	// published, skipped when nil
+	prober Prober
+}
+
+// NmapServiceOption configures an NmapService.
+type NmapServiceOption func(*NmapService)
+
+var (
+	_ interfaces.INmapService       = (*NmapService)(nil)
+	_ interfaces.IReanalysisService = (*NmapService)(nil)
+)
+
+// NewNmapService returns a service looking the detected CPEs up through nvd,
+// or through a client of the public NVD API when nil.
+func NewNmapService(nvd *NVDClient, opts ...NmapServiceOption) *NmapService {
+	if nvd == nil {
+		nvd = NewNVDClient()
+	}
+	s := &NmapService{
+		nvd:            nvd,
+		enrichment:     DefaultEnrichment(),
+		spillThreshold: 5000,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// WithEnrichment replaces the settings used to turn NVD records into findings.
+func WithEnrichment(e Enrichment) NmapServiceOption {
+	return func(s *NmapService) {
+		s.enrichment = e
+	}
+}
+
+// WithResultSpill sets the in-memory threshold and temp directory used when
+// accumulating enriched results. A threshold <= 0 disables spilling.
+func WithResultSpill(threshold int, dir string) NmapServiceOption {
+	return func(s *NmapService) {
+		s.spillThreshold = threshold
+		s.spillDir = dir
+	}
+}
 
-var _ interfaces.INmapService = (*NmapService)(nil)
+// WithCPETrace toggles the CPE standardization trace in findings.
+func WithCPETrace(enabled bool) NmapServiceOption {
+	return func(s *NmapService) {
+		s.cpeTrace = enabled
+	}
+}
 
-func NewNmapService() *NmapService {
-	return &NmapService{}
+// WithExtendedErrorCodes publishes failure.PolicyErrorCode and
+// failure.StorageErrorCode in the errors of tool results, which consumers
+// predating them don't know about, rather than the generic tool error code.
+func WithExtendedErrorCodes(enabled bool) NmapServiceOption {
+	return func(s *NmapService) {
+		s.extendedErrorCodes = enabled
+	}
+}
+
+// WithReferenceChecker enables reference reachability annotations.
+func WithReferenceChecker(checker *references.Checker) NmapServiceOption {
+	return func(s *NmapService) {
+		s.references = checker
+	}
+}
+
+// WithHostClassifier tags hosts with asset classes and weighs their risk.
+func WithHostClassifier(engine *classify.Engine) NmapServiceOption {
+	return func(s *NmapService) {
+		s.classifier = engine
+	}
+}
+
+// WithPSIRTRegistry enables enrichment from vendor PSIRT feeds.
+func WithPSIRTRegistry(registry *psirt.Registry) NmapServiceOption {
+	return func(s *NmapService) {
+		s.psirt = registry
+	}
+}
+
+// WithICSIndex enables enrichment from CISA ICS advisories.
+func WithICSIndex(index *ics.Index) NmapServiceOption {
+	return func(s *NmapService) {
+		s.ics = index
+	}
+}
+
+// WithCPEExtractors derives the CPEs of the services nmap reported none for
+// from their raw evidence, e.g. banners and headers, with the extractors of
+// registry.
+func WithCPEExtractors(registry *cpeextract.Registry) NmapServiceOption {
+	return func(s *NmapService) {
+		s.extractors = registry
+	}
+}
+
+// WithMSRCIndex maps the findings of Windows hosts to the KBs fixing them.
+func WithMSRCIndex(index *msrc.Index) NmapServiceOption {
+	return func(s *NmapService) {
+		s.msrc = index
+	}
 }
 
 func (s *NmapService) RunScan(ctx context.Context, target string) (tools.ToolResult, error) {
@@ -31,7 +182,7 @@ func (s *NmapService) RunScan(ctx context.Context, target string) (tools.ToolRes
 	)
 	defer cancel()
 
-	scanner, err := nmap.NewScanner(
+	scanOpts := []nmap.Option{
 		nmap.WithTargets(target),
 		nmap.WithMostCommonPorts(100),
 		nmap.WithServiceInfo(),
@@ -39,7 +190,15 @@ func (s *NmapService) RunScan(ctx context.Context, target string) (tools.ToolRes
 		nmap.WithOSDetection(),
 		nmap.WithOSScanGuess(),
 		nmap.WithContext(ctxWithTimeout),
-	)
+	}
+	if asset.KindOf(target) == asset.KindIPv6 {
+		scanOpts = append(scanOpts, nmap.WithIPv6Scanning())
+	}
+	if s.extractors != nil {
+		// Collect the evidence the CPE extractors work from
+		scanOpts = append(scanOpts, nmap.WithScripts(cpeextract.Scripts...))
+	}
+	scanner, err := nmap.NewScanner(scanOpts...)
 	if err != nil {
 		return s.errorResult(
 				err,
@@ -59,12 +218,20 @@ func (s *NmapService) RunScan(ctx context.Context, target string) (tools.ToolRes
 		slog.Int("hosts_up", len(res.Hosts)),
 		slog.Any("time_elapsed", res.Stats.Finished.Elapsed))
 
-	return s.procesScanResults(res, target), nil
+	return s.procesScanResults(ctx, res, target), nil
+}
+
+// AnalyzeHost runs the vulnerability detection pipeline on an already scanned
+// host, skipping the nmap scan itself.
+func (s *NmapService) AnalyzeHost(ctx context.Context, host nmap.Host) *results.NmapResult {
+	return s.createNmapResult(ctx, host)
 }
 
-func (s *NmapService) procesScanResults(res *nmap.Run, target string) tools.ToolResult {
+func (s *NmapService) procesScanResults(ctx context.Context, res *nmap.Run, target string) tools.ToolResult {
+	// Empty scans are outcomes of the scan rather than failures of a
+	// dependency, analyzing the target again finds the same
 	if len(res.Hosts) == 0 {
-		return s.errorResult(fmt.Errorf("no hosts found in scan results"), "No hosts found")
+		return s.errorResult(&failure.InputError{Err: fmt.Errorf("no hosts found in scan results")}, "No hosts found")
 	}
 
 	host := res.Hosts[0]
@@ -72,18 +239,18 @@ func (s *NmapService) procesScanResults(res *nmap.Run, target string) tools.Tool
 	if len(host.Ports) == 0 || len(host.Addresses) == 0 {
 		slog.Warn("No ports or addresses found", slog.Any("host", host))
 		return s.errorResult(
-			fmt.Errorf("no ports or addresses found for host %s", target),
+			&failure.InputError{Err: fmt.Errorf("no ports or addresses found for host %s", target)},
 			"No ports or addresses found")
 	}
 
 	if !s.matchHostToTarget(host, target) {
 		slog.Warn("Unmatched host in scan results", slog.Any("host", host))
 		return s.errorResult(
-			fmt.Errorf("unmatched host in scan results"),
+			&failure.InputError{Err: fmt.Errorf("unmatched host in scan results")},
 			"Unmatched host")
 	}
 
-	nmapResult := createNmapResult(host)
+	nmapResult := s.createNmapResult(ctx, host)
 	slog.Debug("Nmap scan for host completed", slog.Any("nmap_result", nmapResult))
 
 	return tools.ToolResult{
@@ -93,13 +260,15 @@ func (s *NmapService) procesScanResults(res *nmap.Run, target string) tools.Tool
 	}
 }
 
-// getMostLikelyOS checks for most likely OS considering TCP matches
-func getMostLikelyOS(host nmap.Host) tools.OSData {
+// getMostLikelyOS checks for most likely OS considering TCP matches. It also
+// returns the provenance of the OS CPE for the findings matched through it.
+func (s *NmapService) getMostLikelyOS(ctx context.Context, host nmap.Host) (results.OSData, results.Provenance) {
 	if len(host.OS.Matches) == 0 {
-		return tools.OSData{}
+		return results.OSData{}, results.Provenance{}
 	}
 
-	var mostLikelyOS tools.OSData
+	var mostLikelyOS results.OSData
+	var provenance results.Provenance
 	maxAccuracy := 0
 	fingerprint := ""
 
@@ -120,7 +289,7 @@ func getMostLikelyOS(host nmap.Host) tools.OSData {
 		class := match.Classes[0]
 
 		// Populate OSData with available class information, CPE might be empty
-		currentOSData := tools.OSData{
+		currentOSData := results.OSData{
 			Name:        match.Name,
 			Accuracy:    match.Accuracy,
 			Family:      class.Family,
@@ -129,21 +298,25 @@ func getMostLikelyOS(host nmap.Host) tools.OSData {
 			CPE:         "", // Initialize CPE as empty string, will be populated if available
 		}
 
+		var currentProvenance results.Provenance
 		if len(class.CPEs) > 0 {
-			standardizedCPE, err := standardizeCPE(string(class.CPEs[0]))
+			standardizedCPE, trace, err := standardizeCPEWithTrace(string(class.CPEs[0]))
 			if err != nil {
 				slog.Error("Failed to standardize OS CPE, skipping to next match",
 					slog.String("cpe", string(class.CPEs[0])),
 					slog.Any("error", err))
+				dropCPE(ctx, string(class.CPEs[0]), 0, match.Name, err)
 				continue
 			}
 			if err := isValidCPE(standardizedCPE); err != nil {
 				slog.Error("OS CPE is invalid, skipping to next match",
 					slog.String("cpe", standardizedCPE),
 					slog.Any("error", err))
+				dropCPE(ctx, string(class.CPEs[0]), 0, match.Name, err)
 				continue
 			}
 			currentOSData.CPE = standardizedCPE
+			currentProvenance = s.nvdProvenance(string(class.CPEs[0]), standardizedCPE, trace)
 		} else { // Skip if no CPEs in class
 			slog.Debug("OS Class found without CPEs", slog.String("os_name", match.Name))
 			continue
@@ -151,31 +324,39 @@ func getMostLikelyOS(host nmap.Host) tools.OSData {
 
 		// Found a more accurate match with classes and CPEs, populate OSData
 		mostLikelyOS = currentOSData
+		provenance = currentProvenance
 		maxAccuracy = match.Accuracy
 	}
 
-	return mostLikelyOS
+	return mostLikelyOS, provenance
 }
 
-func parseHostName(host nmap.Host) string {
-	// If host type is IP, we won't get a Hostname
-	var hostName string
-
-	if len(host.Hostnames) > 0 {
-		hostName = host.Hostnames[0].Name
+// nvdProvenance describes a match of the NVD API by CPE.
+func (s *NmapService) nvdProvenance(inputCPE, matchedCPE string, trace []string) results.Provenance {
+	provenance := results.Provenance{
+		Source:     "nvd",
+		InputCPE:   inputCPE,
+		MatchedCPE: matchedCPE,
 	}
-
-	return hostName
+	if s.cpeTrace {
+		provenance.CPETrace = trace
+	}
+	return provenance
 }
 
-func parseHostAddress(host nmap.Host) string {
-	var hostAddress string
-
-	if len(host.Addresses) > 0 {
-		hostAddress = host.Addresses[0].Addr
+// hostIdentity resolves the identity of a scanned host from its IP
+// addresses, leaving out MAC addresses, and hostnames.
+func hostIdentity(host nmap.Host) asset.Identity {
+	var addresses, hostnames []string
+	for _, address := range host.Addresses {
+		if address.AddrType != "mac" {
+			addresses = append(addresses, address.Addr)
+		}
 	}
-
-	return hostAddress
+	for _, hostname := range host.Hostnames {
+		hostnames = append(hostnames, hostname.Name)
+	}
+	return asset.Resolve(addresses, hostnames)
 }
 
 // handleScanErrors logs warnings and processes potential scan errors.
@@ -185,7 +366,7 @@ func handleScanErrors(ctx context.Context, err error, warnings []string, targetC
 	}
 	if err != nil {
 		if ctx.Err() == context.DeadlineExceeded {
-			return fmt.Errorf("scan timeout after %d seconds", 240*targetCount)
+			return &failure.UpstreamError{Err: fmt.Errorf("scan timeout after %d seconds", 240*targetCount)}
 		}
 		return fmt.Errorf("scan error: %w", err)
 	}
@@ -200,51 +381,131 @@ func calculateTimeout(targets []string) time.Duration {
 }
 
 // createNmapResult builds the NmapResult for a given host.
-func createNmapResult(host nmap.Host) *tools.NmapResult {
-	osData := getMostLikelyOS(host)
-	osVulns := processNVDDataForOS(osData)
+func (s *NmapService) createNmapResult(ctx context.Context, host nmap.Host) *results.NmapResult {
+	result := s.enrichHost(ctx, host)
+	enriched := s.snapshot(ctx, result)
+	s.finishResult(result)
+	s.checkLiveness(ctx, result)
+	s.remember(ctx, host, enriched, result)
+
+	return result
+}
+
+// enrichHost looks the vulnerabilities of the OS and ports of host up.
+func (s *NmapService) enrichHost(ctx context.Context, host nmap.Host) *results.NmapResult {
+	identity := hostIdentity(host)
+	hostAddress := identity.Key
+	ctx = withHostAddresses(ctx, identity.Addresses)
+	exposure := hostExposure(hostAddresses(ctx, hostAddress), host.Ports)
+	ctx, rejected := withRejectedCount(ctx)
+	ctx, dropped := withDroppedCPEs(ctx)
+	ctx, degraded := withDegradation(ctx)
+
+	result := &results.NmapResult{
+		HostAddress:  hostAddress,
+		Addresses:    identity.Addresses,
+		HostNames:    identity.Hostnames,
+		Exposure:     exposure,
+		MostLikelyOS: s.enrichOS(ctx, host, hostAddress, exposure),
+	}
+	if len(identity.Hostnames) > 0 {
+		result.HostName = identity.Hostnames[0]
+	}
+	result.ScannedPorts = s.processPorts(withPriorityHost(ctx, result), hostAddress, host.Ports)
+	s.nvd.nameAssigners(ctx, result.MostLikelyOS.Vulnerabilities)
+	for i := range result.ScannedPorts {
+		s.nvd.nameAssigners(ctx, result.ScannedPorts[i].Vulnerabilities)
+	}
+	s.scoreEPSS(ctx, result)
+	s.degradeStaleKBs(ctx, result.MostLikelyOS.CPE)
+	result.RejectedCVEs = int(rejected.Load())
+	result.DroppedCPEs = dropped.list()
+	result.Degradation = degraded.notice()
+	logDroppedCPEs(hostAddress, result.DroppedCPEs)
+	return result
+}
+
+// enrichOS looks the vulnerabilities of the most likely OS of host up.
+func (s *NmapService) enrichOS(ctx context.Context, host nmap.Host, hostAddress string, exposure results.ExposureType) results.OSData {
+	osData, osProvenance := s.getMostLikelyOS(ctx, host)
+	osVulns := s.processNVDDataForOS(ctx, hostAddress, exposure, osData, osProvenance)
+	osVulns = s.appendPSIRTFindings(ctx, hostAddress, exposure, osData.CPE, osVulns)
+	osVulns = s.appendICSFindings(ctx, hostAddress, exposure, osData.CPE, osVulns)
 	osData.Vulnerabilities = append(osData.Vulnerabilities, osVulns...)
+	return osData
+}
 
-	return &tools.NmapResult{
-		HostName:     parseHostName(host),
-		HostAddress:  parseHostAddress(host),
-		MostLikelyOS: osData,
-		ScannedPorts: processPorts(host.Ports),
+// finishResult runs the stages working on the findings of the whole host.
+func (s *NmapService) finishResult(result *results.NmapResult) {
+	s.attachKBs(result)
+	s.annotateReferences(result)
+	titleFindings(result)
+	if s.classifier != nil {
+		s.classifier.Apply(result)
 	}
 }
 
-// processPorts extracts port information from the scan result and uses CPEs to query NVD API.
-func processPorts(ports []nmap.Port) []tools.PortData {
-	portDataSlice := make([]tools.PortData, 0, len(ports))
-	rateLimiter := time.Tick(7 * time.Second)
-
-	for _, port := range ports {
-		var validCPE string
-		for _, cpe := range port.Service.CPEs {
-			standardizedCPE, err := standardizeCPE(string(cpe))
-			if err != nil {
-				slog.Warn("Could not standardize CPE, skipping to next CPE",
-					slog.Int("port_id", int(port.ID)),
-					slog.String("service_name", port.Service.Name),
-					slog.String("cpe", string(cpe)),
-					slog.Any("error", err))
-				continue
-			}
-			// Validate CPE before assigning it
-			if err := isValidCPE(standardizedCPE); err != nil {
-				slog.Debug("Parsed invalid CPE, skipping to next CPE",
-					slog.Int("port_id", int(port.ID)),
-					slog.String("service_name", port.Service.Name),
-					slog.String("cpe", string(cpe)),
-					slog.String("standardized_cpe", string(standardizedCPE)),
-					slog.Any("error", err))
-				continue
-			}
-			validCPE = standardizedCPE
-			break // Exit after the first valid CPE
+// annotateReferences flags dead reference URLs with the checks done so far.
+func (s *NmapService) annotateReferences(result *results.NmapResult) {
+	if s.references == nil {
+		return
+	}
+	for i := range result.MostLikelyOS.Vulnerabilities {
+		s.references.Annotate(&result.MostLikelyOS.Vulnerabilities[i])
+	}
+	for i := range result.ScannedPorts {
+		for j := range result.ScannedPorts[i].Vulnerabilities {
+			s.references.Annotate(&result.ScannedPorts[i].Vulnerabilities[j])
 		}
+	}
+}
+
+// titleFindings names the findings after the OS or service they were found on.
+func titleFindings(result *results.NmapResult) {
+	for i := range result.MostLikelyOS.Vulnerabilities {
+		v := &result.MostLikelyOS.Vulnerabilities[i]
+		v.Title = titles.Generate(result.MostLikelyOS.Name, "", v.CWEs, v.Description, v.ID)
+	}
+	for i := range result.ScannedPorts {
+		p := &result.ScannedPorts[i]
+		for j := range p.Vulnerabilities {
+			v := &p.Vulnerabilities[j]
+			v.Title = titles.Generate(p.Product, p.Service.Version, v.CWEs, v.Description, v.ID)
+		}
+	}
+}
 
-		p := tools.PortData{
+// processPorts extracts port information from the scan result and uses CPEs to query NVD API.
+func (s *NmapService) processPorts(ctx context.Context, hostAddress string, ports []nmap.Port) []results.PortData {
+	portDataSlice := make([]results.PortData, len(ports))
+	var rateLimiter <-chan time.Time
+	if s.nvd.requestInterval > 0 {
+		rateLimiter = time.Tick(s.nvd.requestInterval)
+	}
+
+	// Enriched results are accumulated in a spillable buffer so that hosts with
+	// thousands of CVEs don't have to be held entirely in memory
+	acc := spill.New[portVulnerability](s.spillThreshold, s.spillDir)
+	defer acc.Close()
+	annotations := make(map[portFinding]results.Vulnerability)
+
+	cpes := make([]string, len(ports))
+	provenances := make([]results.Provenance, len(ports))
+	for i, port := range ports {
+		cpes[i], provenances[i] = s.portCPE(ctx, port)
+	}
+
+	// Ports are looked up by priority, their results keep the scan order
+	order, prioritized := identityOrder(len(ports)), 0
+	if s.priority != nil {
+		order, prioritized = s.priority.order(cpes)
+	}
+	var priorityPorts []results.PortData
+
+	for n, i := range order {
+		port, validCPE, provenance := ports[i], cpes[i], provenances[i]
+
+		p := results.PortData{
 			ID:       port.ID,
 			Protocol: port.Protocol,
 			Service: tools.Service{
@@ -257,22 +518,223 @@ func processPorts(ports []nmap.Port) []tools.PortData {
 			State:   port.State.State,
 		}
 
-		<-rateLimiter // Wait for rate limiter to allow the next request
-		vulns := processNVDDataForPort(port, validCPE)
-		p.Vulnerabilities = vulns
+		if rateLimiter != nil {
+			// Wait for rate limiter to allow the next request
+			select {
+			case <-rateLimiter:
+			case <-ctx.Done():
+			}
+		}
+		p.Vulnerabilities = []results.Vulnerability{}
+		sink := &portSink{index: i, port: &p, acc: acc}
+		s.processNVDDataForPort(ctx, hostAddress, port, validCPE, provenance, sink.add)
+		if validCPE == "" {
+			for _, vuln := range s.processKeywordFallback(ctx, hostAddress, port) {
+				sink.add(vuln)
+			}
+		}
+		s.appendPortAdvisories(ctx, hostAddress, port, validCPE, sink, annotations)
+
+		portDataSlice[i] = p
+
+		if s.priority != nil {
+			s.priority.observe(validCPE, sink.priority)
+			if n < prioritized {
+				reported := p
+				reported.Vulnerabilities = append([]results.Vulnerability{}, sink.priority...)
+				priorityPorts = append(priorityPorts, reported)
+			}
+			// Reported early only when lower priority ports remain
+			if n == prioritized-1 && prioritized < len(order) {
+				reportPriorityFindings(ctx, priorityPorts)
+			}
+		}
+	}
 
-		portDataSlice = append(portDataSlice, p)
+	if err := assemblePortVulnerabilities(portDataSlice, acc, annotations); err != nil {
+		slog.Error("Failed to assemble accumulated vulnerabilities", slog.Any("error", err))
 	}
 
 	return portDataSlice
 }
 
-func processNVDDataForPort(port nmap.Port, validCPE string) []tools.Vulnerability {
+// portCPE returns the first valid CPE of port, derived by the CPE extractors
+// or resolved with the Products API when nmap reported none, and its
+// provenance.
+func (s *NmapService) portCPE(ctx context.Context, port nmap.Port) (string, results.Provenance) {
+	for _, cpe := range port.Service.CPEs {
+		standardizedCPE, trace, err := standardizeCPEWithTrace(string(cpe))
+		if err != nil {
+			slog.Warn("Could not standardize CPE, skipping to next CPE",
+				slog.Int("port_id", int(port.ID)),
+				slog.String("service_name", port.Service.Name),
+				slog.String("cpe", string(cpe)),
+				slog.Any("error", err))
+			dropCPE(ctx, string(cpe), port.ID, port.Service.Name, err)
+			continue
+		}
+		// Validate CPE before assigning it
+		if err := isValidCPE(standardizedCPE); err != nil {
+			slog.Debug("Parsed invalid CPE, skipping to next CPE",
+				slog.Int("port_id", int(port.ID)),
+				slog.String("service_name", port.Service.Name),
+				slog.String("cpe", string(cpe)),
+				slog.String("standardized_cpe", string(standardizedCPE)),
+				slog.Any("error", err))
+			dropCPE(ctx, string(cpe), port.ID, port.Service.Name, err)
+			continue
+		}
+		// The first valid CPE is looked up
+		return standardizedCPE, s.nvdProvenance(string(cpe), standardizedCPE, trace)
+	}
+
+	var validCPE string
+	var provenance results.Provenance
+	if s.extractors != nil {
+		validCPE, provenance = s.extractCPE(port)
+	}
+	if validCPE == "" && s.cpeResolution {
+		validCPE, provenance = s.resolveCPE(ctx, port)
+	}
+	return validCPE, provenance
+}
+
+// identityOrder returns the indexes 0 to n-1.
+func identityOrder(n int) []int {
+	order := make([]int, n)
+	for i := range order {
+		order[i] = i
+	}
+	return order
+}
+
+// portVulnerability is an enriched vulnerability tagged with the index of the
+// port it belongs to, so it can be accumulated outside of the port slice.
+type portVulnerability struct {
+	PortIndex     int                   `json:"port_index"`
+	Vulnerability results.Vulnerability `json:"vulnerability"`
+}
+
+// portFinding identifies a CVE found on a port.
+type portFinding struct {
+	portIndex int
+	cve       string
+}
+
+// portSink streams the findings of a port into the accumulator as they are
+// enriched, keeping only their IDs and the priority findings in memory.
+type portSink struct {
+	index    int
+	port     *results.PortData
+	acc      *spill.Buffer[portVulnerability]
+	ids      []string
+	priority []results.Vulnerability
+}
+
+func (k *portSink) add(vuln results.Vulnerability) {
+	k.ids = append(k.ids, vuln.ID)
+	if isPriorityFinding(vuln) {
+		k.priority = append(k.priority, vuln)
+	}
+	if err := k.acc.Add(portVulnerability{PortIndex: k.index, Vulnerability: vuln}); err != nil {
+		slog.Warn("Failed to accumulate vulnerability, keeping it in memory",
+			slog.Int("port_id", int(k.port.ID)),
+			slog.Any("error", err))
+		k.port.Vulnerabilities = append(k.port.Vulnerabilities, vuln)
+	}
+}
+
+// appendPortAdvisories adds the vendor and ICS advisory findings of a port to
+// sink. The advisories are matched against stubs of the findings already
+// streamed, the references and ICS advisories they add to those are kept in
+// annotations until the findings are assembled.
+func (s *NmapService) appendPortAdvisories(ctx context.Context, hostAddress string, port nmap.Port, cpe string, sink *portSink, annotations map[portFinding]results.Vulnerability) {
+	if (s.psirt == nil && s.ics == nil) || cpe == "" {
+		return
+	}
+	stubs := make([]results.Vulnerability, len(sink.ids))
+	for j, id := range sink.ids {
+		stubs[j].ID = id
+	}
+	found := len(stubs)
+	stubs = s.appendPSIRTFindings(ctx, hostAddress, portExposure(hostAddresses(ctx, hostAddress), port), cpe, stubs)
+	stubs = s.appendICSFindings(ctx, hostAddress, portExposure(hostAddresses(ctx, hostAddress), port), cpe, stubs)
+
+	for _, stub := range stubs[:found] {
+		if len(stub.References) > 0 || len(stub.ICSAdvisories) > 0 {
+			annotations[portFinding{portIndex: sink.index, cve: stub.ID}] = stub
+		}
+	}
+	for _, vuln := range stubs[found:] {
+		sink.add(vuln)
+	}
+}
+
+// assemblePortVulnerabilities drains the accumulator into the ports, adding
+// the advisory annotations, and logs a severity summary computed while
+// streaming over the results.
+func assemblePortVulnerabilities(ports []results.PortData, acc *spill.Buffer[portVulnerability], annotations map[portFinding]results.Vulnerability) error {
+	var counts tools.SeverityCounts
+	err := acc.Range(func(pv portVulnerability) error {
+		if pv.PortIndex < 0 || pv.PortIndex >= len(ports) {
+			return fmt.Errorf("accumulated vulnerability references unknown port index %d", pv.PortIndex)
+		}
+		ports[pv.PortIndex].Vulnerabilities = append(ports[pv.PortIndex].Vulnerabilities, pv.Vulnerability)
+		countSeverity(&counts, pv.Vulnerability.BaseSeverity)
+		return nil
+	})
+
+	if len(annotations) > 0 {
+		for i := range ports {
+			for j := range ports[i].Vulnerabilities {
+				vuln := &ports[i].Vulnerabilities[j]
+				annotation, ok := annotations[portFinding{portIndex: i, cve: vuln.ID}]
+				if !ok {
+					continue
+				}
+				for _, ref := range annotation.References {
+					if !slices.Contains(vuln.References, ref) {
+						vuln.References = append(vuln.References, ref)
+					}
+				}
+				vuln.ICSAdvisories = append(vuln.ICSAdvisories, annotation.ICSAdvisories...)
+			}
+		}
+	}
+
+	slog.Debug("Accumulated port vulnerabilities",
+		slog.Int("total", acc.Len()),
+		slog.Bool("spilled_to_disk", acc.Spilled()),
+		slog.Any("severity_counts", counts))
+
+	return err
+}
+
+func countSeverity(counts *tools.SeverityCounts, severity enums.SeverityType) {
+	switch severity {
+	case enums.SeverityTypeNone:
+		counts.None++
+	case enums.SeverityTypeLow:
+		counts.Low++
+	case enums.SeverityTypeMedium:
+		counts.Medium++
+	case enums.SeverityTypeHigh:
+		counts.High++
+	case enums.SeverityTypeCritical:
+		counts.Critical++
+	default:
+		counts.Unknown++
+	}
+}
+
+// processNVDDataForPort passes the findings of the CVEs NVD matches to
+// validCPE to emit, one by one as they are enriched.
+func (s *NmapService) processNVDDataForPort(ctx context.Context, hostAddress string, port nmap.Port, validCPE string, provenance results.Provenance, emit func(results.Vulnerability)) {
 	if validCPE == "" {
-		return []tools.Vulnerability{}
+		return
 	}
 
-	nvdData, err := fetchNvdDataByCPE(validCPE, baseNvdAPIURL)
+	nvdData, err := s.nvd.fetchByCPE(ctx, validCPE)
 	if err != nil {
 		slog.Warn("Failed to fetch data by CPE, returning empty Vulnerabilities",
 			slog.String("service_name", port.Service.Name),
@@ -280,7 +742,7 @@ func processNVDDataForPort(port nmap.Port, validCPE string) []tools.Vulnerabilit
 			slog.String("valid_cpe", validCPE),
 			slog.Any("error", err),
 		)
-		return []tools.Vulnerability{}
+		return
 	}
 	slog.Info("Found vulnerabilities for Service from NVD",
 		slog.Int("n_vulners", len(nvdData.Vulnerabilities)),
@@ -290,11 +752,11 @@ func processNVDDataForPort(port nmap.Port, validCPE string) []tools.Vulnerabilit
 		slog.Any("error", err),
 	)
 
-	vulns := make([]tools.Vulnerability, 0, len(nvdData.Vulnerabilities))
 	for _, nvdVuln := range nvdData.Vulnerabilities {
-		var vuln tools.Vulnerability
+		// Exposure is set first as it is an input of the likelihood
+		vuln := results.Vulnerability{Exposure: portExposure(hostAddresses(ctx, hostAddress), port)}
 
-		if err := enrichVulnerabilityWithNvdData(&vuln, nvdVuln); err != nil {
+		if err := s.enrichment.enrichVulnerabilityWithNvdData(ctx, &vuln, nvdVuln); err != nil {
 			slog.Error("Failed to enrich vulnerability with nvd data, skipping to next vulnerability",
 				slog.String("host_name", port.Service.Hostname),
 				slog.Int("port_id", int(port.ID)),
@@ -302,18 +764,20 @@ func processNVDDataForPort(port nmap.Port, validCPE string) []tools.Vulnerabilit
 				slog.Any("error", err))
 			continue
 		}
-		vulns = append(vulns, vuln)
+		applyRiskModel(ctx, hostAddress, &vuln)
+		vulnProvenance := provenance
+		vuln.Provenance = &vulnProvenance
+		emit(vuln)
 	}
-	return vulns
 }
 
-func processNVDDataForOS(os tools.OSData) []tools.Vulnerability {
+func (s *NmapService) processNVDDataForOS(ctx context.Context, hostAddress string, exposure results.ExposureType, os results.OSData, provenance results.Provenance) []results.Vulnerability {
 	if os.CPE == "" {
 		slog.Debug("OSData has empty CPE, returning empty Vulnerabilities")
-		return []tools.Vulnerability{}
+		return []results.Vulnerability{}
 	}
 
-	nvdData, err := fetchNvdDataByCPE(os.CPE, baseNvdAPIURL)
+	nvdData, err := s.nvd.fetchByCPE(ctx, os.CPE)
 	if err != nil {
 		slog.Warn("Failed to fetch data by CPE, returning empty Vulnerabilities",
 			slog.String("os_name", os.Name),
@@ -321,16 +785,17 @@ func processNVDDataForOS(os tools.OSData) []tools.Vulnerability {
 			slog.String("cpe", os.CPE),
 			slog.Any("error", err),
 		)
-		return []tools.Vulnerability{}
+		return []results.Vulnerability{}
 	}
 	slog.Info("Found vulnerabilities for OS from NVD",
 		slog.Int("n_vulners", len(nvdData.Vulnerabilities)))
 
-	vulns := make([]tools.Vulnerability, 0, len(nvdData.Vulnerabilities))
+	vulns := make([]results.Vulnerability, 0, len(nvdData.Vulnerabilities))
 	for _, nvdVuln := range nvdData.Vulnerabilities {
-		var vuln tools.Vulnerability
+		// Exposure is set first as it is an input of the likelihood
+		vuln := results.Vulnerability{Exposure: exposure}
 
-		if err := enrichVulnerabilityWithNvdData(&vuln, nvdVuln); err != nil {
+		if err := s.enrichment.enrichVulnerabilityWithNvdData(ctx, &vuln, nvdVuln); err != nil {
 			slog.Error("Failed to enrich OS vulnerability with nvd data, skipping to next vulnerability",
 				slog.String("os_name", os.Name),
 				slog.String("os_family", os.Family),
@@ -339,40 +804,27 @@ func processNVDDataForOS(os tools.OSData) []tools.Vulnerability {
 			)
 			continue
 		}
+		applyRiskModel(ctx, hostAddress, &vuln)
+		vulnProvenance := provenance
+		vuln.Provenance = &vulnProvenance
 		vulns = append(vulns, vuln)
 	}
 	return vulns
 }
 
 func (s *NmapService) matchHostToTarget(host nmap.Host, target string) bool {
-	// Check addresses (IPv4, IPv6)
-	for _, address := range host.Addresses {
-		ip := net.ParseIP(address.Addr)
-		if ip != nil {
-			if ip.String() == target {
-				return true
-			}
-		}
-	}
-
-	// Check hostnames (Domains) if no match was found with address
-	for _, hostname := range host.Hostnames {
-		if hostname.Name == target {
-			return true
-		}
-	}
-
-	return false
+	return hostIdentity(host).Matches(target)
 }
 
-// errorResult is a helper function to create an error ToolResult.
+// errorResult is a helper function to create an error ToolResult. The error
+// code reflects the failure category of err, see WithExtendedErrorCodes.
 func (s *NmapService) errorResult(err error, message string) tools.ToolResult {
 	slog.Error(message, slog.Any("error", err))
 	return tools.ToolResult{
 		Tool:   enums.ToolNmap,
-		Result: &tools.NmapResult{},
+		Result: &results.NmapResult{},
 		Err: &tools.ToolError{
-			Code:    enums.ToolError,
+			Code:    failure.Code(failure.CategoryOf(err), s.extendedErrorCodes),
 			Message: message,
 		},
 		Timestamp: time.Now().UTC(),
@@ -1 +1,101 @@
 package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/Ullaakut/nmap/v2"
+	"github.com/kptm-tools/vulnerability-analysis/nvd/schema"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/psirt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_hostIdentity(t *testing.T) {
+	t.Parallel()
+	host := nmap.Host{
+		Addresses: []nmap.Address{
+			{Addr: "2001:DB8::10", AddrType: "ipv6"},
+			{Addr: "00:11:22:33:44:55", AddrType: "mac"},
+		},
+		Hostnames: []nmap.Hostname{{Name: "Web.Example.com", Type: "user"}, {Name: "web.example.com.", Type: "PTR"}},
+	}
+
+	identity := hostIdentity(host)
+	assert.Equal(t, "2001:db8::10", identity.Key)
+	assert.Equal(t, []string{"2001:db8::10"}, identity.Addresses, "Expected MAC addresses to be left out")
+	assert.Equal(t, []string{"web.example.com"}, identity.Hostnames)
+
+	s := &NmapService{}
+	assert.True(t, s.matchHostToTarget(host, "2001:db8:0:0:0:0:0:10"))
+	assert.True(t, s.matchHostToTarget(host, "WEB.example.com"))
+	assert.False(t, s.matchHostToTarget(host, "2001:db8::11"))
+}
+
+// spillCheckConnector reports the files of the spill directory when looked
+// up, after the NVD findings of the port were streamed.
+type spillCheckConnector struct {
+	dir        string
+	spilled    *[]os.DirEntry
+	advisories []psirt.Advisory
+}
+
+func (c spillCheckConnector) Vendor() string { return "cisco" }
+
+func (c spillCheckConnector) Lookup(ctx context.Context, cpe psirt.CPE) ([]psirt.Advisory, error) {
+	entries, err := os.ReadDir(c.dir)
+	*c.spilled = entries
+	return c.advisories, err
+}
+
+func Test_processPorts_SpillsFindings(t *testing.T) {
+	t.Parallel()
+	var records []schema.Vulnerability
+	for i := 1; i <= 5; i++ {
+		records = append(records, schema.Vulnerability{Cve: schema.CveDetail{
+			ID:           fmt.Sprintf("CVE-2024-000%d", i),
+			Published:    "2024-01-01T00:00:00.000",
+			LastModified: "2024-01-01T00:00:00.000",
+		}})
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(schema.NvdAPIResponse{TotalResults: len(records), ResultsPerPage: len(records), Vulnerabilities: records})
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	var spilled []os.DirEntry
+	advisoryURL := "https://sec.cloudapps.cisco.com/security/center/content/CiscoSecurityAdvisory/cisco-sa-1"
+	connector := spillCheckConnector{dir: dir, spilled: &spilled, advisories: []psirt.Advisory{{
+		ID:     "cisco-sa-1",
+		Vendor: "cisco",
+		URL:    advisoryURL,
+		CVEs:   []string{"CVE-2024-0005", "CVE-2024-0006"},
+	}}}
+	s := NewNmapService(newTestNVDClient(server.URL), WithResultSpill(2, dir), WithPSIRTRegistry(psirt.NewRegistry(connector)))
+	ports := []nmap.Port{{
+		ID:       443,
+		Protocol: "tcp",
+		Service:  nmap.Service{Name: "https", CPEs: []nmap.CPE{"cpe:/o:cisco:adaptive_security_appliance_software:9.8"}},
+	}}
+
+	portData := s.processPorts(context.Background(), "10.0.0.1", ports)
+	require.Len(t, spilled, 1, "Expected the findings beyond the threshold to be spilled while the port was processed")
+
+	require.Len(t, portData, 1)
+	var ids []string
+	for _, vuln := range portData[0].Vulnerabilities {
+		ids = append(ids, vuln.ID)
+	}
+	assert.Equal(t, []string{"CVE-2024-0001", "CVE-2024-0002", "CVE-2024-0003", "CVE-2024-0004", "CVE-2024-0005", "CVE-2024-0006"}, ids)
+	assert.Contains(t, portData[0].Vulnerabilities[4].References, advisoryURL, "Expected the advisory to annotate the spilled finding")
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Empty(t, entries, "Expected the spill file to be removed")
+}
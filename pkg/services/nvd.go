@@ -1,208 +1,483 @@
 package services
 
 import (
-	"encoding/json"
+	"context"
 	"errors"
 	"fmt"
+	"io"
 	"log/slog"
-	"net/http"
+	"net"
 	"net/url"
+	"regexp"
+	"slices"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/kptm-tools/common/common/pkg/enums"
 	"github.com/kptm-tools/common/common/pkg/results/tools"
-	"github.com/kptm-tools/vulnerability-analysis/pkg/dto"
+	"github.com/kptm-tools/vulnerability-analysis/nvd/client"
+	cpeutil "github.com/kptm-tools/vulnerability-analysis/nvd/cpe"
+	"github.com/kptm-tools/vulnerability-analysis/nvd/cvss"
+	"github.com/kptm-tools/vulnerability-analysis/nvd/schema"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/failure"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/features"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/results"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/risk"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/tenant"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/titles"
 )
 
-var baseNvdAPIURL = "https://services.nvd.nist.gov/rest/json/cves/2.0"
+var (
+	ErrInvalidCPE   = cpeutil.ErrInvalid
+	ErrInvalidCVEID = errors.New("invalid CVE ID")
+)
+
+var cveIDPattern = regexp.MustCompile(`^CVE-\d{4}-\d{4,}$`)
 
-var ErrInvalidCPE = errors.New("invalid CPE name")
+// Enrichment configures how NVD records are turned into findings.
+type Enrichment struct {
+	// Likelihood maps CVSS exploitability metrics to a likelihood.
+	Likelihood risk.LikelihoodMatrix
+
+	// CVSSv2Flags attaches the CVSS v2 auxiliary booleans to findings and
+	// flags the ones granting full privileges as elevated impact.
+	CVSSv2Flags bool
+
+	// CVSSPreference is the order in which the CVSS versions of a CVE are
+	// used to score its findings, per tenant.
+	CVSSPreference CVSSPreference
+
+	// Cache, when set, keeps enriched findings, so that records unchanged
+	// since they were last enriched aren't parsed and scored again.
+	Cache *EnrichmentCache
+}
+
+// DefaultEnrichment returns the enrichment used unless configured otherwise.
+func DefaultEnrichment() Enrichment {
+	return Enrichment{Likelihood: risk.DefaultLikelihoodMatrix}
+}
 
 // Custom error types for NVD Api interactions
 var (
-	ErrNVDServiceUnavailable = errors.New("NVD API service unavailable (503)")
-	ErrNVDAPIStatus          = errors.New("NVD API status error")
-	ErrNVDDecode             = errors.New("failed to decode NVD API response")
+	ErrNVDServiceUnavailable = client.ErrServiceUnavailable
+	ErrNVDAPIStatus          = client.ErrStatus
+	ErrNVDDecode             = client.ErrDecode
+	ErrNVDRateLimited        = client.ErrRateLimited
 )
 
-func createNVDHTTPClient() *http.Client {
-	return &http.Client{
-		Timeout: 60 * time.Second,
+// fetchByCPE fetches the CVEs matching cpe, up to the per-CPE cap and within
+// the per-CPE deadline, leaving out the ones which don't apply to it when
+// match criteria expansion is enabled.
+func (c *NVDClient) fetchByCPE(ctx context.Context, cpe string) (*schema.NvdAPIResponse, error) {
+	if c.cpeCache != nil || c.shared != nil {
+		return c.fetchCachedCPE(ctx, cpe)
 	}
+	return c.lookupCPE(ctx, cpe)
 }
 
-const (
-	maxRetries        = 3
-	initialRetryDelay = 5 * time.Second
-)
+// lookupCPE fetches the CVEs of fetchByCPE, bypassing the CPE cache.
+func (c *NVDClient) lookupCPE(ctx context.Context, cpe string) (*schema.NvdAPIResponse, error) {
+	scanCtx := ctx
+	if c.cpeTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.cpeTimeout)
+		defer cancel()
+	}
+
+	query := c.cpeQuery(cpe)
+	var resp *schema.NvdAPIResponse
+	var err error
+	switch {
+	case c.localLookups:
+		resp, err = c.lookupLocal(ctx, cpe)
+	case c.sync != nil:
+		resp, err = c.syncCPE(ctx, cpe, query)
+	case slices.ContainsFunc(c.sources, isCPESource):
+		resp, err = c.raceCPE(ctx, cpe, query)
+	default:
+		resp, err = c.fetchCPE(ctx, cpe, query, c.queryFilter())
+	}
+	if err != nil {
+		known, ok := c.lookupKnowledgeCPE(scanCtx, cpe, err)
+		if !ok {
+			return nil, err
+		}
+		resp = known
+	}
+	return c.dropInapplicable(ctx, cpe, resp), nil
+}
+
+// raceCPE fetches the CVEs of cpe from the live API, raced against the
+// parallel sources also indexing CPEs, whose answers get the filters and cap
+// of the client.
+func (c *NVDClient) raceCPE(ctx context.Context, cpe string, query url.Values) (*schema.NvdAPIResponse, error) {
+	var names []string
+	var lookups []sourceLookup
+	for _, src := range c.sources {
+		cpeSrc, ok := src.Source.(CPESource)
+		if !ok {
+			continue
+		}
+		names = append(names, src.Name)
+		lookups = append(lookups, func(ctx context.Context) (*schema.NvdAPIResponse, error) {
+			resp, err := cpeSrc.LookupCPE(cpe)
+			if err != nil {
+				return nil, err
+			}
+			return c.localResponse(ctx, resp), nil
+		})
+	}
+	names = append(names, "nvd")
+	lookups = append(lookups, func(ctx context.Context) (*schema.NvdAPIResponse, error) {
+		return c.fetchCPE(ctx, cpe, query, c.queryFilter())
+	})
+
+	resp, err := raceCPESources(ctx, cpe, names, lookups, c.sourceTimeout)
+	if err != nil || c.maxCVEsPerCPE <= 0 || len(resp.Vulnerabilities) <= c.maxCVEsPerCPE {
+		return resp, err
+	}
+	resp.Vulnerabilities = resp.Vulnerabilities[:c.maxCVEsPerCPE]
+	resp.ResultsPerPage = c.maxCVEsPerCPE
+	return resp, nil
+}
+
+func isCPESource(src NamedCVESource) bool {
+	_, ok := src.Source.(CPESource)
+	return ok
+}
 
-func fetchNvdDataByCPE(cpe string, baseNvdAPIURL string) (*dto.NvdAPIResponse, error) {
-	// Use custom http client with a timeout
-	client := createNVDHTTPClient()
+// lookupKnowledgeCPE serves the CVEs of cpe from the knowledge cache, when it
+// also indexes CPEs, after the live API failed with cause, e.g. retries
+// exhausted or the per-CPE deadline expired before the breaker opened. The
+// cache may only hold part of the CVEs of cpe, e.g. a seeded mirror, so
+// unlike on the CVE ID path it is never consulted first. Cancelled scans and
+// lookups already served offline by the open breaker are not retried.
+func (c *NVDClient) lookupKnowledgeCPE(ctx context.Context, cpe string, cause error) (*schema.NvdAPIResponse, bool) {
+	src, ok := c.knowledge.(CPESource)
+	if !ok || c.localLookups || ctx.Err() != nil || errors.Is(cause, ErrNVDCircuitOpen) {
+		return nil, false
+	}
+	resp, err := src.LookupCPE(cpe)
+	if err != nil || len(resp.Vulnerabilities) == 0 {
+		return nil, false
+	}
 
-	// Build URL
+	slog.Warn("NVD API unavailable, serving CPE from the knowledge cache",
+		slog.String("cpe", cpe),
+		slog.Int("n_cves", len(resp.Vulnerabilities)),
+		slog.Any("error", cause))
+	return c.localResponse(ctx, resp), true
+}
+
+// cpeQuery returns the cpeName query of cpe, in precision mode when enabled
+// and cpe has a version.
+func (c *NVDClient) cpeQuery(cpe string) url.Values {
 	query := url.Values{}
 	query.Set("cpeName", cpe)
-	apiURL := baseNvdAPIURL + "?" + query.Encode()
+	if c.vulnerableOnly && cpeutil.HasVersion(cpe) {
+		query.Set(client.ParamIsVulnerable, "")
+	}
+	return query
+}
+
+// fetchCPE fetches the results of query, the CVEs matching cpe, kept by
+// filter.
+func (c *NVDClient) fetchCPE(ctx context.Context, cpe string, query url.Values, filter NVDFilter) (*schema.NvdAPIResponse, error) {
+	if filter.IsZero() {
+		return c.fetchAllPages(ctx, query, c.maxCVEsPerCPE, func() (*schema.NvdAPIResponse, error) {
+			return c.lookupOffline(cpe)
+		})
+	}
+
+	// NVD takes a single severity per query, the queries of each are merged.
+	// Rejected CVEs are only suppressed when the filter leaves them out, the
+	// CPE sync fetches them to drop them from the stored CVEs.
+	suppress := slices.Contains(filter.Flags, client.FlagNoRejected)
+	merged := &schema.NvdAPIResponse{}
+	for _, filter := range filter.Split() {
+		limit := 0
+		if c.maxCVEsPerCPE > 0 {
+			if limit = c.maxCVEsPerCPE - len(merged.Vulnerabilities); limit <= 0 {
+				break
+			}
+		}
+		resp, err := c.fetchAllPages(ctx, filter.Apply(query), limit, func() (*schema.NvdAPIResponse, error) {
+			resp, err := c.lookupOffline(cpe)
+			if err != nil {
+				return nil, err
+			}
+			if suppress {
+				c.suppressRejected(ctx, resp)
+			}
+			return filterResponse(resp, filter), nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		client.MergeResponse(merged, resp)
+	}
+	if suppress {
+		c.suppressRejected(ctx, merged)
+	}
+	return merged, nil
+}
+
+// ParseCVSSFilter returns the filter of the comma separated CVSS v3 and v4
+// severities and the partial CVSS v3 vector, e.g. "HIGH,CRITICAL", "" and
+// "AV:N".
+func ParseCVSSFilter(v3Severities, v4Severities, v3Metrics string) (NVDFilter, error) {
+	return ParseNVDFilter(v3Severities, v4Severities, v3Metrics, "")
+}
+
+// ParseNVDFilter is ParseCVSSFilter with the comma separated boolean
+// parameters of the CVE API, e.g. "hasKev" for known exploited CVEs only.
+func ParseNVDFilter(v3Severities, v4Severities, v3Metrics, flags string) (NVDFilter, error) {
+	return NVDFilter{
+		CVSSV3Severities: strings.Split(v3Severities, ","),
+		CVSSV4Severities: strings.Split(v4Severities, ","),
+		CVSSV3Metrics:    v3Metrics,
+		Flags:            strings.Split(flags, ","),
+	}.Normalize()
+}
+
+// filterResponse returns a copy of resp with the CVEs kept by filter.
+func filterResponse(resp *schema.NvdAPIResponse, filter NVDFilter) *schema.NvdAPIResponse {
+	filtered := *resp
+	filtered.Vulnerabilities = nil
+	for _, vuln := range resp.Vulnerabilities {
+		if filter.Matches(vuln) {
+			filtered.Vulnerabilities = append(filtered.Vulnerabilities, vuln)
+		}
+	}
+	filtered.TotalResults = len(filtered.Vulnerabilities)
+	filtered.ResultsPerPage = len(filtered.Vulnerabilities)
+	return &filtered
+}
+
+// FetchByCVEID fetches a single CVE record using the cveId parameter, so that
+// findings of scanners reporting CVE IDs rather than CPEs can be enriched.
+// Records held by the knowledge cache are served without calling the API.
+// With parallel sources configured, they are raced against the live API.
+func (c *NVDClient) FetchByCVEID(ctx context.Context, cveID string) (*schema.NvdAPIResponse, error) {
+	cveID = strings.ToUpper(strings.TrimSpace(cveID))
+	if !cveIDPattern.MatchString(cveID) {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidCVEID, cveID)
+	}
+
+	if c.knowledge != nil {
+		if resp, err := c.knowledge.LookupCVE(cveID); err == nil && len(resp.Vulnerabilities) > 0 {
+			return resp, nil
+		}
+	}
+	return c.lookupCVE(ctx, cveID)
+}
 
-	var nvdResponse *dto.NvdAPIResponse
+// lookupCVE fetches the record of a valid CVE ID from the live API, raced
+// against the parallel sources, bypassing the knowledge cache.
+func (c *NVDClient) lookupCVE(ctx context.Context, cveID string) (*schema.NvdAPIResponse, error) {
+	live := nvdCVESource{client: c}
+	if len(c.sources) > 0 {
+		sources := append(append([]NamedCVESource(nil), c.sources...), NamedCVESource{Name: "nvd", Source: live})
+		return raceCVESources(ctx, cveID, sources, c.sourceTimeout)
+	}
+	return live.LookupCVEContext(ctx, cveID)
+}
+
+// fetch queries the NVD CVE API with retries. While NVD is in a
+// maintenance window, or the circuit breaker is open, the offline function
+// is used instead. Requests and retry delays are abandoned when ctx is done.
+func (c *NVDClient) fetch(ctx context.Context, query url.Values, offline func() (*schema.NvdAPIResponse, error)) (*schema.NvdAPIResponse, error) {
+	// Skip the retry ladder entirely during a known NVD outage
+	if c.status.inMaintenance() {
+		return offline()
+	}
+	// Or during an outage the breaker detected first
+	if !c.breaker.allow() {
+		return c.failFast(offline)
+	}
+
+	encodedQuery := query.Encode()
+
+	// Every exit that didn't tell the breaker whether NVD is up, e.g. a
+	// throttled trial request running out of time, lets another trial
+	// through rather than leaving the circuit half-open
+	reported := false
+	defer func() {
+		if !reported {
+			c.breaker.abandon()
+		}
+	}()
+
+	var nvdResponse *schema.NvdAPIResponse
 	var err error
 
-	for attempt := 0; attempt <= maxRetries; attempt++ {
-		nvdResponse, err = attemptFetch(client, apiURL)
+	for attempt := 0; attempt <= c.retry.MaxRetries; attempt++ {
+		nvdResponse, err = c.api.Fetch(ctx, query)
 
 		// Success case
 		if err == nil {
+			c.breaker.success()
+			reported = true
 			return nvdResponse, nil
 		}
 
+		// Cancelled scan or expired deadline
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("NVD API request abandoned for query %s: %w", encodedQuery, err)
+		}
+
 		// Non-retriable error
 		if !shouldRetry(err) {
-			return nil, fmt.Errorf("non-retriable error for CPE %s: %w", cpe, err)
+			return nil, &failure.UpstreamError{Err: fmt.Errorf("non-retriable error for query %s: %w", encodedQuery, err)}
+		}
+
+		retryDelay := c.retry.delay(attempt)
+		var rateLimitErr *client.RateLimitError
+		if errors.As(err, &rateLimitErr) {
+			// Throttled rather than down: wait as long as NVD asked for
+			c.throttled.Add(1)
+			if rateLimitErr.RetryAfter > 0 {
+				retryDelay = rateLimitErr.RetryAfter
+			}
+		} else {
+			// Let the status monitor check whether this is a prolonged outage
+			c.status.requestProbe()
+			if c.status.inMaintenance() {
+				return offline()
+			}
+			c.breaker.failure(err)
+			reported = true
+			if !c.breaker.allow() {
+				return c.failFast(offline)
+			}
 		}
 
-		retryDelay := calculateRetryDelay(attempt)
 		slog.Warn("NVD API request failed, retrying",
 			slog.Int("attempt", attempt),
 			slog.Duration("delay", retryDelay),
-			slog.String("cpe", cpe))
-		time.Sleep(retryDelay)
+			slog.String("query", encodedQuery))
+		if err := sleepContext(ctx, retryDelay); err != nil {
+			return nil, fmt.Errorf("NVD API retry abandoned for query %s: %w", encodedQuery, err)
+		}
 	}
 
 	slog.Error("NVD API request failed after max retries",
-		slog.Int("max_retries", maxRetries),
-		slog.String("cpe", cpe),
+		slog.Int("max_retries", c.retry.MaxRetries),
+		slog.String("query", encodedQuery),
 		slog.Any("error", err))
 
-	return nil, fmt.Errorf("failed NVD API request after %d retries: %w", maxRetries, err)
+	return nil, &failure.UpstreamError{Err: fmt.Errorf("failed NVD API request after %d retries: %w", c.retry.MaxRetries, err)}
 }
 
-func attemptFetch(client *http.Client, apiURL string) (*dto.NvdAPIResponse, error) {
-	req, err := http.NewRequest("GET", apiURL, nil)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create NVD API request: %w", err)
-	}
+// sleepContext waits for d or until ctx is done, whichever comes first.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
 
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("failed NVD API request: %w", err)
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
 	}
-	defer resp.Body.Close()
+}
 
-	if resp.StatusCode == http.StatusServiceUnavailable {
-		return nil, ErrNVDServiceUnavailable
-	}
+func shouldRetry(err error) bool {
+	return errors.Is(err, ErrNVDServiceUnavailable) || errors.Is(err, ErrNVDRateLimited) || isTransientNetworkError(err)
+}
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("%w: %d %s", ErrNVDAPIStatus, resp.StatusCode, resp.Status)
+// isTransientNetworkError reports whether err is a network failure likely to
+// succeed on retry: timeouts, responses cut short, dropped or refused
+// connections and temporary DNS failures. Unknown hosts, TLS errors and a
+// plain io.EOF are left to fail fast.
+func isTransientNetworkError(err error) bool {
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return dnsErr.IsTimeout || dnsErr.IsTemporary
 	}
 
-	var nvdResponse dto.NvdAPIResponse
-	if err := json.NewDecoder(resp.Body).Decode(&nvdResponse); err != nil {
-		return nil, fmt.Errorf("%w: %w", ErrNVDDecode, err)
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
 	}
 
-	return &nvdResponse, nil
+	return errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED)
 }
 
-func shouldRetry(err error) bool {
-	return errors.Is(err, ErrNVDServiceUnavailable)
+func isValidCPE(cpe string) error {
+	return cpeutil.Validate(cpe)
 }
 
-func calculateRetryDelay(attempt int) time.Duration {
-	// Exponential backoff with jitter
-	delay := initialRetryDelay * time.Duration(1<<uint(attempt))
-	jitter := time.Duration(int64(float64(delay) * 0.2)) // +/- 20% jitter
-	delay += jitter
+// standardizeCPE transforms an incomplete CPE from nmap output into a incomplete
+// CPE v2.3 format to be consumed by the NVD API
+func standardizeCPE(cpe string) (string, error) {
+	return cpeutil.Standardize(cpe)
+}
 
-	if delay > 15*time.Second {
-		delay = 15 * time.Second
-	}
-	return delay
+// standardizeCPEWithTrace behaves like standardizeCPE and also returns a
+// human-readable description of every transformation applied to the input.
+func standardizeCPEWithTrace(cpe string) (string, []string, error) {
+	return cpeutil.StandardizeWithTrace(cpe)
 }
 
-func isValidCPE(cpe string) error {
-	parts := strings.Split(cpe, ":")
+// Enrich turns an NVD record into a finding, scored with the CVSS version
+// preferred by the tenant of ctx.
+func (e Enrichment) Enrich(ctx context.Context, nvdVuln schema.Vulnerability) (results.Vulnerability, error) {
+	var vuln results.Vulnerability
+	err := e.enrichVulnerabilityWithNvdData(ctx, &vuln, nvdVuln)
+	return vuln, err
+}
 
-	if len(parts) != 13 {
-		return fmt.Errorf("%w: must have 13 colon-separated parts, got %d", ErrInvalidCPE, len(parts))
+func (e Enrichment) enrichVulnerabilityWithNvdData(ctx context.Context, vuln *results.Vulnerability, nvdVuln schema.Vulnerability) error {
+	if vuln == nil {
+		return fmt.Errorf("expected a non-nil vulnerability")
 	}
-
-	if parts[0] != "cpe" {
-		return fmt.Errorf("%w: must start with 'cpe', got '%s'", ErrInvalidCPE, parts[0])
+	if e.Cache == nil {
+		return e.enrich(ctx, vuln, nvdVuln)
 	}
 
-	if parts[1] != "2.3" {
-		return fmt.Errorf("%w: must have '2.3' as the second part (CPE Version), got '%s'", ErrInvalidCPE, parts[1])
+	key, ok := e.enrichmentKeyOf(ctx, vuln, nvdVuln)
+	if !ok {
+		return e.enrich(ctx, vuln, nvdVuln)
 	}
-
-	componentsToCheck := []struct {
-		index int
-		name  string
-	}{
-		{index: 2, name: "part"},
-		{index: 3, name: "vendor"},
-		{index: 4, name: "product"},
-		{index: 5, name: "version"},
+	if cached, hit := e.Cache.get(key); hit {
+		*vuln = cached
+		return nil
 	}
-
-	for _, comp := range componentsToCheck {
-		if parts[comp.index] == "*" {
-			return fmt.Errorf("%w: %s component must not be '*'", ErrInvalidCPE, parts[comp.index])
-		}
+	if err := e.enrich(ctx, vuln, nvdVuln); err != nil {
+		return err
 	}
-
+	e.Cache.put(key, *vuln)
 	return nil
 }
 
-// standardizeCPE transforms an incomplete CPE from nmap output into a incomplete
-// CPE v2.3 format to be consumed by the NVD API
-func standardizeCPE(cpe string) (string, error) {
-	if !strings.HasPrefix(cpe, "cpe:/") {
-		return "", fmt.Errorf("CPE does not start with 'cpe:/': %s", cpe)
-	}
-
-	cpeWithoutPrefix := strings.TrimPrefix(cpe, "cpe:/")
-	parts := strings.Split(cpeWithoutPrefix, ":")
-
-	if len(parts) < 4 { // We need part, vendor, product and version as minimum
-		return "", fmt.Errorf("CPE is too short, needs at least part, vendor, product and version: %s", cpe)
-	}
-
-	// Remove leading slash from 'part' component if present
-	parts[0] = strings.TrimPrefix(parts[0], "/")
-
-	// Pad with "*" to reach 11 components after "cpe" and "2.3"
-	paddingNeeded := 11 - len(parts)
-	if paddingNeeded > 0 {
-		for i := 0; i < paddingNeeded; i++ {
-			parts = append(parts, "*")
-		}
-	} else if paddingNeeded < 0 {
-		parts = parts[:11]
-	}
-
-	standardizedCPE := "cpe:2.3:" + strings.Join(parts, ":")
-	return standardizedCPE, nil
-}
-
-func enrichVulnerabilityWithNvdData(vuln *tools.Vulnerability, nvdVuln dto.Vulnerability) error {
-	if vuln == nil {
-		return fmt.Errorf("expected a non-nil vulnerability")
-	}
+// enrich fills vuln from the NVD record, parsing its metrics and scoring it.
+func (e Enrichment) enrich(ctx context.Context, vuln *results.Vulnerability, nvdVuln schema.Vulnerability) error {
 
 	vuln.ID = nvdVuln.Cve.ID
-	vuln.Type = nvdVuln.Cve.SourceIdentifier // This may be the incorrect field...
+	// The identifier of the CNA, named after its NVD source when enabled
+	vuln.Type = nvdVuln.Cve.SourceIdentifier
 
 	// Descriptions - first english description
 	vuln.Description = getEnglishDescription(nvdVuln.Cve.Descriptions)
 
 	// References
 	vuln.References = getReferences(nvdVuln.Cve.References)
+	vuln.ExploitReferences = getExploitReferences(nvdVuln.Cve.References)
+
+	// Weaknesses, and a title without the product until the finding is
+	// attributed to a scanned service
+	vuln.CWEs = getWeaknesses(nvdVuln.Cve.Weaknesses)
+	vuln.Title = titles.Generate("", "", vuln.CWEs, vuln.Description, vuln.ID)
 
-	// Metrics - Prioritize CVSS v3.1, then v3.0, then v2
-	baseCVSSScore, baseSeverity, impactScore, access, complexity, privilegesRequired, integrityImpact, availabilityImpact, exploitability := extractMetrics(nvdVuln.Cve.Metrics)
+	// Metrics - of the CVSS version preferred by the tenant, by default v3.1,
+	// then v3.0, then v2
+	metrics := completeMetrics(nvdVuln.Cve.ID, nvdVuln.Cve.Metrics)
+	metrics = preferMetrics(nvdVuln.Cve.ID, metrics, e.CVSSPreference.Order(tenant.FromContext(ctx)))
+	baseCVSSScore, baseSeverity, impactScore, access, complexity, privilegesRequired, integrityImpact, availabilityImpact, exploitability := extractMetrics(metrics)
 
 	vuln.BaseCVSSScore = baseCVSSScore
 	vuln.BaseSeverity = baseSeverity
@@ -214,6 +489,15 @@ func enrichVulnerabilityWithNvdData(vuln *tools.Vulnerability, nvdVuln dto.Vulne
 	vuln.IntegrityImpact = integrityImpact
 	vuln.AvailabilityImpact = availabilityImpact
 	vuln.Exploit = exploitability
+	vuln.KnownExploited = nvdVuln.Cve.CisaExploitAdd != nil
+	vuln.ConfidentialityImpact, vuln.Scope, vuln.UserInteraction = extractExtendedMetrics(metrics)
+	fallbackUnmapped(vuln, metrics)
+
+	if e.CVSSv2Flags {
+		vuln.CVSSv2Flags = extractCVSSv2Flags(nvdVuln.Cve.Metrics)
+		vuln.ElevatedImpact = vuln.CVSSv2Flags != nil &&
+			vuln.CVSSv2Flags.ObtainAllPrivilege != nil && *vuln.CVSSv2Flags.ObtainAllPrivilege
+	}
 
 	// Published and Updated Dates
 	publishedTime, err := parseNvdDateTime(nvdVuln.Cve.Published)
@@ -228,11 +512,11 @@ func enrichVulnerabilityWithNvdData(vuln *tools.Vulnerability, nvdVuln dto.Vulne
 	}
 	vuln.LastUpdated = updatedTime
 
-	// Likelihood - Derive from CVSS Complexity and Access Vector
-	vuln.Likelihood = calculateLikelihoodSimple(*vuln)
+	// Likelihood - Derive from CVSS Access Vector, Complexity and User Interaction
+	vuln.Likelihood = e.calculateLikelihood(*vuln)
 
 	// Risk Score
-	vuln.RiskScore = enums.CalculateRiskScore(vuln.Likelihood, vuln.IntegrityImpact, vuln.AvailabilityImpact)
+	vuln.RiskScore = risk.Current.Score(*vuln)
 
 	// Vendor comments
 	vuln.VendorComments = parseVendorComments(nvdVuln.Cve.VendorComments)
@@ -240,7 +524,28 @@ func enrichVulnerabilityWithNvdData(vuln *tools.Vulnerability, nvdVuln dto.Vulne
 	return nil
 }
 
-func extractMetrics(metrics *dto.Metrics) (
+// applyRiskModel rolls out the candidate risk model according to the tenant's
+// feature flag: when on, its score replaces the current one; in shadow mode
+// both are computed, the current one is kept and the candidate is recorded.
+func applyRiskModel(ctx context.Context, hostAddress string, vuln *results.Vulnerability) {
+	switch features.ModeFor(ctx, features.FlagRiskModelV2) {
+	case features.ModeOn:
+		vuln.RiskScore = risk.Candidate.Score(*vuln)
+	case features.ModeShadow:
+		risk.RecordShadow(risk.ShadowScore{
+			TenantID:       tenant.FromContext(ctx),
+			Host:           hostAddress,
+			CVEID:          vuln.ID,
+			CurrentModel:   risk.Current.Name(),
+			CurrentScore:   vuln.RiskScore,
+			CandidateModel: risk.Candidate.Name(),
+			CandidateScore: risk.Candidate.Score(*vuln),
+			RecordedAt:     time.Now().UTC(),
+		})
+	}
+}
+
+func extractMetrics(metrics *schema.Metrics) (
 	baseCVSSScore float64,
 	baseSeverity enums.SeverityType,
 	impactScore float64,
@@ -328,7 +633,93 @@ func extractMetrics(metrics *dto.Metrics) (
 	return
 }
 
-func getEnglishDescription(descriptions []dto.Description) string {
+// completeMetrics returns a copy of metrics where the structured fields NVD
+// left blank are parsed from the vector strings. Explicit fields win over the
+// vector, conflicts between both are logged.
+func completeMetrics(cveID string, metrics *schema.Metrics) *schema.Metrics {
+	completed, issues := cvss.Complete(metrics)
+	for _, issue := range issues {
+		if issue.Err != nil {
+			slog.Warn("Failed to parse CVSS vector, using the structured metrics only",
+				slog.String("cve_id", cveID),
+				slog.String("vector", issue.Vector),
+				slog.Any("error", issue.Err))
+		}
+		for _, c := range issue.Conflicts {
+			slog.Warn("CVSS metric disagrees with its vector string, keeping the structured value",
+				slog.String("cve_id", cveID),
+				slog.String("vector", issue.Vector),
+				slog.String("metric", c.Metric),
+				slog.String("structured", c.Structured),
+				slog.String("vector_value", c.Vector))
+		}
+	}
+	return completed
+}
+
+// extractExtendedMetrics returns the metrics which are not part of the common
+// vulnerability, following the same CVSS version priority as extractMetrics.
+func extractExtendedMetrics(metrics *schema.Metrics) (
+	confidentialityImpact enums.ImpactType,
+	scope results.ScopeType,
+	userInteraction results.UserInteractionType,
+) {
+	confidentialityImpact = enums.ImpactTypeUnknown
+	scope = results.ScopeTypeUnknown
+	userInteraction = results.UserInteractionUnknown
+
+	if metrics == nil {
+		return
+	}
+
+	if len(metrics.CvssMetricV31) > 0 {
+		cvssDataV31 := metrics.CvssMetricV31[0].CvssData
+		confidentialityImpact = mapImpactTypeV31AndV30(cvssDataV31.ConfidentialityImpact)
+		scope = mapScopeType(cvssDataV31.Scope)
+		userInteraction = mapUserInteractionType(cvssDataV31.UserInteraction)
+	} else if len(metrics.CvssMetricV30) > 0 {
+		cvssDataV30 := metrics.CvssMetricV30[0].CvssData
+		confidentialityImpact = mapImpactTypeV31AndV30(cvssDataV30.ConfidentialityImpact)
+		scope = mapScopeType(cvssDataV30.Scope)
+		userInteraction = mapUserInteractionType(cvssDataV30.UserInteraction)
+	} else if len(metrics.CvssMetricV2) > 0 {
+		// CVSS v2 has no scope metric, user interaction is a flag set by NVD
+		confidentialityImpact = mapImpactTypeV2(metrics.CvssMetricV2[0].CvssData.ConfidentialityImpact)
+		if required := metrics.CvssMetricV2[0].UserInteractionRequired; required != nil {
+			userInteraction = results.UserInteractionNone
+			if *required {
+				userInteraction = results.UserInteractionRequired
+			}
+		}
+	}
+
+	return
+}
+
+// extractCVSSv2Flags returns the auxiliary booleans of the CVSS v2 metric.
+// They are read even when a CVSS v3 metric takes priority, since NVD only
+// publishes them with v2.
+func extractCVSSv2Flags(metrics *schema.Metrics) *results.CVSSv2Flags {
+	if metrics == nil || len(metrics.CvssMetricV2) == 0 {
+		return nil
+	}
+
+	v2 := metrics.CvssMetricV2[0]
+	if v2.AcInsufInfo == nil && v2.ObtainAllPrivilege == nil && v2.ObtainUserPrivilege == nil &&
+		v2.ObtainOtherPrivilege == nil && v2.UserInteractionRequired == nil {
+		return nil
+	}
+
+	return &results.CVSSv2Flags{
+		ACInsufInfo:             v2.AcInsufInfo,
+		ObtainAllPrivilege:      v2.ObtainAllPrivilege,
+		ObtainUserPrivilege:     v2.ObtainUserPrivilege,
+		ObtainOtherPrivilege:    v2.ObtainOtherPrivilege,
+		UserInteractionRequired: v2.UserInteractionRequired,
+	}
+}
+
+func getEnglishDescription(descriptions []schema.Description) string {
 	for _, desc := range descriptions {
 		if desc.Lang == "en" {
 			return desc.Value
@@ -337,7 +728,7 @@ func getEnglishDescription(descriptions []dto.Description) string {
 	return ""
 }
 
-func getReferences(vulnReferences []dto.Reference) []string {
+func getReferences(vulnReferences []schema.Reference) []string {
 	var refs []string
 	for _, ref := range vulnReferences {
 		refs = append(refs, ref.URL)
@@ -345,6 +736,32 @@ func getReferences(vulnReferences []dto.Reference) []string {
 	return refs
 }
 
+// getExploitReferences returns the URLs of the references NVD tags as
+// exploits.
+func getExploitReferences(vulnReferences []schema.Reference) []string {
+	var refs []string
+	for _, ref := range vulnReferences {
+		if slices.Contains(ref.Tags, "Exploit") && !slices.Contains(refs, ref.URL) {
+			refs = append(refs, ref.URL)
+		}
+	}
+	return refs
+}
+
+// getWeaknesses returns the distinct CWE IDs of the weaknesses, skipping the
+// NVD-CWE-Other and NVD-CWE-noinfo placeholders.
+func getWeaknesses(weaknesses []schema.Weakness) []string {
+	var cwes []string
+	for _, w := range weaknesses {
+		for _, d := range w.Description {
+			if strings.HasPrefix(d.Value, "CWE-") && !slices.Contains(cwes, d.Value) {
+				cwes = append(cwes, d.Value)
+			}
+		}
+	}
+	return cwes
+}
+
 func parseNvdDateTime(dateStr string) (time.Time, error) {
 	customLayout := "2006-01-02T15:04:05.000"
 
@@ -367,173 +784,184 @@ func parseNvdVendorCommentDateTime(dateStr string) (time.Time, error) {
 
 // Mapping functions to convert NVD API strings to common enums ---
 
-func mapAccessTypeV31AndV30(attackVector dto.AttackVectorType) enums.AccessType {
+func mapAccessTypeV31AndV30(attackVector schema.AttackVectorType) enums.AccessType {
 	switch attackVector {
-	case dto.AttackVectorTypeNetwork:
+	case schema.AttackVectorTypeNetwork:
 		return enums.AccessTypeNetwork
-	case dto.AttackVectorTypeAdjacentNetwork:
+	case schema.AttackVectorTypeAdjacentNetwork:
 		return enums.AccessTypeAdjacentNetwork
-	case dto.AttackVectorTypeLocal:
+	case schema.AttackVectorTypeLocal:
 		return enums.AccessTypeLocal
-	case dto.AttackVectorTypePhysical:
+	case schema.AttackVectorTypePhysical:
 		return enums.AccesTypePhysical
 	default:
 		return enums.AccessTypeUnknown
 	}
 }
 
-func mapAccessTypeV2(accessVector dto.AccessVectorTypeV2) enums.AccessType {
+func mapAccessTypeV2(accessVector schema.AccessVectorTypeV2) enums.AccessType {
 	switch accessVector {
-	case dto.AccessVectorTypeV2Network:
+	case schema.AccessVectorTypeV2Network:
 		return enums.AccessTypeNetwork
-	case dto.AccessVectorTypeV2AdjacentNetwork:
+	case schema.AccessVectorTypeV2AdjacentNetwork:
 		return enums.AccessTypeAdjacentNetwork
-	case dto.AccessVectorTypeV2Local:
+	case schema.AccessVectorTypeV2Local:
 		return enums.AccessTypeLocal
 	default:
 		return enums.AccessTypeUnknown
 	}
 }
 
-func mapComplexityTypeV31AndV30(complexity dto.AttackComplexityType) enums.ComplexityType {
+func mapComplexityTypeV31AndV30(complexity schema.AttackComplexityType) enums.ComplexityType {
 	switch complexity {
-	case dto.AttackComplexityTypeLow:
+	case schema.AttackComplexityTypeLow:
 		return enums.ComplexityTypeLow
-	case dto.AttackComplexityTypeHigh:
+	case schema.AttackComplexityTypeHigh:
 		return enums.ComplexityTypeHigh
 	default:
 		return enums.ComplexityTypeUnknown
 	}
 }
 
-func mapComplexityTypeV2(complexity dto.AccessComplexityTypeV2) enums.ComplexityType {
+func mapComplexityTypeV2(complexity schema.AccessComplexityTypeV2) enums.ComplexityType {
 	switch complexity {
-	case dto.AccessComplexityTypeV2High:
+	case schema.AccessComplexityTypeV2High:
 		return enums.ComplexityTypeHigh
-	case dto.AccessComplexityTypeV2Medium:
+	case schema.AccessComplexityTypeV2Medium:
 		return enums.ComplexityTypeMedium
-	case dto.AccessComplexityTypeV2Low:
+	case schema.AccessComplexityTypeV2Low:
 		return enums.ComplexityTypeLow
 	default:
 		return enums.ComplexityTypeUnknown
 	}
 }
 
-func mapPrivilegesRequiredTypeV31AndV30(privReq dto.PrivilegesRequiredType) enums.PrivilegesRequiredType {
+func mapPrivilegesRequiredTypeV31AndV30(privReq schema.PrivilegesRequiredType) enums.PrivilegesRequiredType {
 	switch privReq {
-	case dto.PrivilegesRequiredTypeHigh:
+	case schema.PrivilegesRequiredTypeHigh:
 		return enums.PrivilegesRequiredHigh
-	case dto.PrivilegesRequiredTypeLow:
+	case schema.PrivilegesRequiredTypeLow:
 		return enums.PrivilegesRequiredLow
-	case dto.PrivilegesRequiredTypeNone:
+	case schema.PrivilegesRequiredTypeNone:
 		return enums.PrivilegesRequiredNone
 	default:
 		return enums.PrivilegesRequiredUnknown
 	}
 }
 
-func mapImpactTypeV31AndV30(cia dto.CiaType) enums.ImpactType {
+func mapImpactTypeV31AndV30(cia schema.CiaType) enums.ImpactType {
 	switch cia {
-	case dto.CiaTypeHigh:
+	case schema.CiaTypeHigh:
 		return enums.ImpactTypeHigh
-	case dto.CiaTypeLow:
+	case schema.CiaTypeLow:
 		return enums.ImpactTypeLow
-	case dto.CiaTypeNone:
+	case schema.CiaTypeNone:
 		return enums.ImpactTypeNone
 	default:
 		return enums.ImpactTypeUnknown
 	}
 }
 
-func mapImpactTypeV2(cia dto.CiaTypeV2) enums.ImpactType {
+func mapImpactTypeV2(cia schema.CiaTypeV2) enums.ImpactType {
 	switch cia {
-	case dto.CiaTypeV2Complete:
+	case schema.CiaTypeV2Complete:
 		return enums.ImpactTypeHigh
-	case dto.CiaTypeV2Partial:
+	case schema.CiaTypeV2Partial:
 		return enums.ImpactTypeLow
-	case dto.CiaTypeV2None:
+	case schema.CiaTypeV2None:
 		return enums.ImpactTypeNone
 	default:
 		return enums.ImpactTypeUnknown
 	}
 }
 
-func mapSeverityType(severity dto.SeverityType) enums.SeverityType {
+func mapScopeType(scope schema.ScopeType) results.ScopeType {
+	switch scope {
+	case schema.ScopeTypeUnchanged:
+		return results.ScopeTypeUnchanged
+	case schema.ScopeTypeChanged:
+		return results.ScopeTypeChanged
+	default:
+		return results.ScopeTypeUnknown
+	}
+}
+
+func mapUserInteractionType(userInteraction schema.UserInteractionType) results.UserInteractionType {
+	switch userInteraction {
+	case schema.UserInteractionTypeNone:
+		return results.UserInteractionNone
+	case schema.UserInteractionTypeRequired:
+		return results.UserInteractionRequired
+	default:
+		return results.UserInteractionUnknown
+	}
+}
+
+func mapSeverityType(severity schema.SeverityType) enums.SeverityType {
 	switch severity {
-	case dto.SeverityTypeCritical:
+	case schema.SeverityTypeCritical:
 		return enums.SeverityTypeCritical
-	case dto.SeverityTypeHigh:
+	case schema.SeverityTypeHigh:
 		return enums.SeverityTypeHigh
-	case dto.SeverityTypeMedium:
+	case schema.SeverityTypeMedium:
 		return enums.SeverityTypeMedium
-	case dto.SeverityTypeLow:
+	case schema.SeverityTypeLow:
 		return enums.SeverityTypeLow
-	case dto.SeverityTypeNone:
+	case schema.SeverityTypeNone:
 		return enums.SeverityTypeNone
 	default:
 		return enums.SeverityTypeUnknown
 	}
 }
 
-func mapExploitabilityV31AndV30(exploitability *dto.ExploitCodeMaturityType) enums.ExploitabilityType {
+func mapExploitabilityV31AndV30(exploitability *schema.ExploitCodeMaturityType) enums.ExploitabilityType {
 	if exploitability == nil {
 		return enums.ExploitabilityTypeUnknown
 	}
 
 	switch *exploitability {
-	case dto.ExploitCodeMaturityTypeHigh:
+	case schema.ExploitCodeMaturityTypeHigh:
 		return enums.ExploitabilityTypeHigh
-	case dto.ExploitCodeMaturityTypeFunctional:
+	case schema.ExploitCodeMaturityTypeFunctional:
 		return enums.ExploitabilityTypeFunctional
-	case dto.ExploitCodeMaturityTypeProofOfConcept:
+	case schema.ExploitCodeMaturityTypeProofOfConcept:
 		return enums.ExploitabilityTypeProofOfConcept
-	case dto.ExploitCodeMaturityTypeUnproven:
+	case schema.ExploitCodeMaturityTypeUnproven:
 		return enums.ExploitabilityTypeUnproven
-	case dto.ExploitCodeMaturityTypeNotDefined:
+	case schema.ExploitCodeMaturityTypeNotDefined:
 		return enums.ExploitabilityTypeUndefined
 	default:
 		return enums.ExploitabilityTypeUnknown
 	}
 }
 
-func mapExploitabilityV2(exploitability *dto.ExploitabilityTypeV2) enums.ExploitabilityType {
+func mapExploitabilityV2(exploitability *schema.ExploitabilityTypeV2) enums.ExploitabilityType {
 	if exploitability == nil {
 		return enums.ExploitabilityTypeUnknown
 	}
 	switch *exploitability {
-	case dto.ExploitabilityTypeV2Unproven:
+	case schema.ExploitabilityTypeV2Unproven:
 		return enums.ExploitabilityTypeUnproven
-	case dto.ExploitabilityTypeV2ProofOfConcept:
+	case schema.ExploitabilityTypeV2ProofOfConcept:
 		return enums.ExploitabilityTypeProofOfConcept
-	case dto.ExploitabilityTypeV2Functional:
+	case schema.ExploitabilityTypeV2Functional:
 		return enums.ExploitabilityTypeFunctional
-	case dto.ExploitabilityTypeV2High:
+	case schema.ExploitabilityTypeV2High:
 		return enums.ExploitabilityTypeHigh
-	case dto.ExploitabilityTypeV2NotDefined:
+	case schema.ExploitabilityTypeV2NotDefined:
 		return enums.ExploitabilityTypeUndefined
 	default:
 		return enums.ExploitabilityTypeUnknown
 	}
 }
 
-func calculateLikelihoodSimple(vuln tools.Vulnerability) enums.LikelyhoodType {
-	switch vuln.Access {
-	case enums.AccessTypeNetwork:
-		if vuln.Complexity == enums.ComplexityTypeLow {
-			return enums.LikelyhoodTypeVeryHigh
-		} else {
-			return enums.LikelyhoodTypeHigh
-		}
-	case enums.AccessTypeAdjacentNetwork:
-		return enums.LikelyhoodTypeMedium
-	case enums.AccessTypeUnknown:
-		return enums.LikelyhoodTypeUnknown
-	default:
-		return enums.LikelyhoodTypeLow
-	}
+// calculateLikelihood derives the likelihood of exploitation using the
+// configured likelihood matrix.
+func (e Enrichment) calculateLikelihood(vuln results.Vulnerability) enums.LikelyhoodType {
+	return e.Likelihood.Likelihood(vuln)
 }
 
-func parseVendorComments(nvdComments []dto.VendorComment) []tools.VendorComment {
+func parseVendorComments(nvdComments []schema.VendorComment) []tools.VendorComment {
 	resultComments := make([]tools.VendorComment, 0, len(nvdComments))
 
 	for _, comment := range nvdComments {
@@ -0,0 +1,166 @@
+package services
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/kptm-tools/vulnerability-analysis/nvd/client"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/scans"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/tenant"
+)
+
+// NVDRequest is an NVD API request recorded by the access log of
+// WithAccessLog. Latency runs until the response headers, Queued is the time
+// the request waited for the rate limiter before being sent.
+type NVDRequest struct {
+	Time      time.Time `json:"time"`
+	Endpoint  string    `json:"endpoint"`
+	Query     string    `json:"query,omitempty"`
+	Status    int       `json:"status,omitempty"` // Zero when no response was received
+	Error     string    `json:"error,omitempty"`
+	LatencyMS float64   `json:"latency_ms"`
+	QueuedMS  float64   `json:"queued_ms"`
+	Tenant    string    `json:"tenant,omitempty"`
+	ScanID    string    `json:"scan_id,omitempty"`
+}
+
+// NVDQuota estimates the NVD requests left in the rolling window of the rate
+// limit, from the requests taken from the limiter. A limiter shared with
+// other clients counts their requests too.
+type NVDQuota struct {
+	Keyed         bool          `json:"keyed"`
+	Requests      int           `json:"requests"`
+	WindowSeconds float64       `json:"window_seconds"`
+	Sent          int           `json:"sent"`
+	Remaining     int           `json:"remaining"`
+	ResetsAt      time.Time     `json:"resets_at"` // Zero when no request was sent within the window
+	SpacingMS     float64       `json:"spacing_ms"`
+	Keys          []NVDKeyUsage `json:"keys,omitempty"`
+}
+
+// NVDAccessReport is the state of the NVD client for debugging slow
+// enrichments: the quota left and the latest requests, newest first.
+type NVDAccessReport struct {
+	Quota    *NVDQuota    `json:"quota,omitempty"` // Nil when requests aren't rate limited
+	Requests []NVDRequest `json:"requests"`
+}
+
+// accessLog keeps the latest requests in a ring buffer.
+type accessLog struct {
+	mu      sync.Mutex
+	entries []NVDRequest
+	next    int
+	full    bool
+}
+
+func newAccessLog(size int) *accessLog {
+	return &accessLog{entries: make([]NVDRequest, size)}
+}
+
+func (l *accessLog) add(req NVDRequest) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.entries[l.next] = req
+	l.next = (l.next + 1) % len(l.entries)
+	if l.next == 0 {
+		l.full = true
+	}
+}
+
+// recent returns the latest n requests, or every one kept when n isn't
+// positive, newest first.
+func (l *accessLog) recent(n int) []NVDRequest {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	kept := l.next
+	if l.full {
+		kept = len(l.entries)
+	}
+	if n <= 0 || n > kept {
+		n = kept
+	}
+	recent := make([]NVDRequest, n)
+	for i := range recent {
+		recent[i] = l.entries[(l.next-1-i+len(l.entries))%len(l.entries)]
+	}
+	return recent
+}
+
+// accessLogTransport records the requests sent through next, with the tenant
+// and scan they were sent for.
+type accessLogTransport struct {
+	next http.RoundTripper
+	log  *accessLog
+}
+
+func (t *accessLogTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	next := t.next
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	start := time.Now()
+	resp, err := next.RoundTrip(req)
+
+	ctx := req.Context()
+	entry := NVDRequest{
+		Time:      start.UTC(),
+		Endpoint:  req.URL.Path,
+		Query:     req.URL.RawQuery,
+		LatencyMS: milliseconds(time.Since(start)),
+		QueuedMS:  milliseconds(client.Queued(ctx)),
+		Tenant:    tenant.FromContext(ctx),
+	}
+	if scanID, ok := scans.ScanIDFromContext(ctx); ok {
+		entry.ScanID = scanID.String()
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	} else {
+		entry.Status = resp.StatusCode
+	}
+	t.log.add(entry)
+	return resp, err
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+// WithAccessLog keeps the latest size NVD requests, availability probes
+// included, for AccessReport.
+func WithAccessLog(size int) NVDClientOption {
+	return func(c *NVDClient) {
+		if size > 0 {
+			c.accessLog = newAccessLog(size)
+		}
+	}
+}
+
+// AccessReport returns the latest n requests of the access log of
+// WithAccessLog, every one kept when n isn't positive, and the quota left.
+func (c *NVDClient) AccessReport(n int) NVDAccessReport {
+	report := NVDAccessReport{Requests: []NVDRequest{}}
+	if c.accessLog != nil {
+		report.Requests = c.accessLog.recent(n)
+	}
+	if c.api.Limiter == nil {
+		return report
+	}
+
+	limit := c.api.RateLimit()
+	sent, resetsAt := c.api.Limiter.Usage(limit)
+	report.Quota = &NVDQuota{
+		Keyed:         limit.Keyed,
+		Requests:      limit.Requests,
+		WindowSeconds: limit.Window.Seconds(),
+		Sent:          sent,
+		Remaining:     max(limit.Requests-sent, 0),
+		ResetsAt:      resetsAt.UTC(),
+		SpacingMS:     milliseconds(c.api.Limiter.Spacing()),
+		Keys:          c.KeyUsage(),
+	}
+	return report
+}
@@ -0,0 +1,56 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/kptm-tools/vulnerability-analysis/nvd/client"
+	"github.com/kptm-tools/vulnerability-analysis/nvd/schema"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/scans"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/tenant"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_NVDClient_AccessReport(t *testing.T) {
+	t.Parallel()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("cveId") == "CVE-2024-0404" {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(schema.NvdAPIResponse{})
+	}))
+	defer server.Close()
+
+	nvd := newTestNVDClient(server.URL, WithAccessLog(2), WithRetryPolicy(RetryPolicy{}), WithRateLimiter(client.NewLimiter()))
+	scanID := uuid.New()
+	ctx := scans.WithScanID(tenant.WithID(context.Background(), "acme"), scanID)
+	for _, id := range []string{"CVE-2024-0001", "CVE-2024-0002", "CVE-2024-0404"} {
+		_, _ = nvd.FetchByCVEID(ctx, id)
+	}
+
+	report := nvd.AccessReport(0)
+	require.Len(t, report.Requests, 2, "Expected the log to keep the latest requests only")
+	latest := report.Requests[0]
+	assert.Equal(t, "cveId=CVE-2024-0404", latest.Query)
+	assert.Equal(t, http.StatusNotFound, latest.Status)
+	assert.Equal(t, "acme", latest.Tenant)
+	assert.Equal(t, scanID.String(), latest.ScanID)
+	assert.Equal(t, "cveId=CVE-2024-0002", report.Requests[1].Query)
+	assert.Len(t, nvd.AccessReport(1).Requests, 1)
+
+	require.NotNil(t, report.Quota)
+	assert.Equal(t, client.UnkeyedRateLimit.Requests, report.Quota.Requests)
+	assert.Equal(t, 3, report.Quota.Sent)
+	assert.Equal(t, client.UnkeyedRateLimit.Requests-3, report.Quota.Remaining)
+	assert.False(t, report.Quota.ResetsAt.IsZero())
+
+	unlimited := newTestNVDClient(server.URL).AccessReport(10)
+	assert.Nil(t, unlimited.Quota)
+	assert.Empty(t, unlimited.Requests)
+}
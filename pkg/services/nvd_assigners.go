@@ -0,0 +1,163 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kptm-tools/vulnerability-analysis/nvd/schema"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/results"
+)
+
+// assignerRetryDelay spaces the attempts to refresh the directory of sources
+// while the Source API fails.
+const assignerRetryDelay = 10 * time.Minute
+
+// assignerDirectory maps the source identifiers of CVEs to the sources of the
+// NVD Source API, fetched at most once per ttl and kept in a file at path
+// across restarts when set.
+type assignerDirectory struct {
+	path string
+	ttl  time.Duration
+
+	mu        sync.Mutex
+	byID      map[string]results.Assigner
+	fetchedAt time.Time
+	failedAt  time.Time
+}
+
+// assignerCache is the file format of the directory.
+type assignerCache struct {
+	FetchedAt time.Time       `json:"fetched_at"`
+	Sources   []schema.Source `json:"sources"`
+}
+
+// WithAssignerNames names the CNAs which published the CVEs found, whose
+// findings only carry a source identifier such as an email address or a
+// UUID, after the sources of the NVD Source API. The sources are fetched at
+// most once per ttl, or once when ttl isn't positive, and cached in the file
+// at path when not empty.
+func WithAssignerNames(path string, ttl time.Duration) NVDClientOption {
+	return func(c *NVDClient) {
+		c.assigners = &assignerDirectory{path: path, ttl: ttl}
+	}
+}
+
+// WithSourceURL points the client at another Source API. An empty URL keeps
+// the default.
+func WithSourceURL(sourceURL string) NVDClientOption {
+	return func(c *NVDClient) {
+		if sourceURL != "" {
+			c.api.SourceURL = sourceURL
+		}
+	}
+}
+
+// nameAssigners names the assigners of vulns whose Type is the identifier of
+// an NVD source, when enabled. Findings of unknown sources are left as is.
+func (c *NVDClient) nameAssigners(ctx context.Context, vulns []results.Vulnerability) {
+	if c.assigners == nil || len(vulns) == 0 {
+		return
+	}
+	byID := c.assigners.load(ctx, c)
+	for i := range vulns {
+		assigner, ok := byID[strings.ToLower(vulns[i].Type)]
+		if !ok {
+			continue
+		}
+		vulns[i].Assigner = &assigner
+		vulns[i].Type = assigner.Name
+	}
+}
+
+// load returns the directory, refreshing it when older than the ttl. The
+// stale directory is kept while the Source API fails.
+func (d *assignerDirectory) load(ctx context.Context, c *NVDClient) map[string]results.Assigner {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := time.Now()
+	if d.byID == nil && d.path != "" {
+		if cache, err := readAssignerCache(d.path); err == nil {
+			d.index(cache)
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			slog.Warn("Failed to read the cached NVD sources", slog.String("path", d.path), slog.Any("error", err))
+		}
+	}
+	fresh := !d.fetchedAt.IsZero() && (d.ttl <= 0 || now.Sub(d.fetchedAt) < d.ttl)
+	if fresh || now.Sub(d.failedAt) < assignerRetryDelay || c.status.inMaintenance() {
+		return d.byID
+	}
+
+	resp, err := c.api.FetchAllSources(ctx, nil)
+	if err != nil {
+		d.failedAt = now
+		slog.Warn("Failed to fetch the NVD sources, keeping the cached ones",
+			slog.Int("n_sources", len(d.byID)),
+			slog.Any("error", err))
+		return d.byID
+	}
+	cache := assignerCache{FetchedAt: now.UTC(), Sources: resp.Sources}
+	d.index(cache)
+	if d.path != "" {
+		if err := writeAssignerCache(d.path, cache); err != nil {
+			slog.Warn("Failed to cache the NVD sources", slog.String("path", d.path), slog.Any("error", err))
+		}
+	}
+	slog.Info("Fetched the NVD sources", slog.Int("n_sources", len(resp.Sources)))
+	return d.byID
+}
+
+// index replaces the directory with the sources of cache.
+func (d *assignerDirectory) index(cache assignerCache) {
+	d.byID = make(map[string]results.Assigner)
+	for _, source := range cache.Sources {
+		for _, id := range source.SourceIdentifiers {
+			d.byID[strings.ToLower(id)] = results.Assigner{Identifier: id, Name: source.Name, ContactEmail: source.ContactEmail}
+		}
+	}
+	d.fetchedAt = cache.FetchedAt
+}
+
+func readAssignerCache(path string) (assignerCache, error) {
+	var cache assignerCache
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cache, err
+	}
+	if err := json.Unmarshal(data, &cache); err != nil {
+		return cache, fmt.Errorf("failed to decode cached NVD sources: %w", err)
+	}
+	return cache, nil
+}
+
+// writeAssignerCache replaces the file at path, through a temporary file so
+// that readers never see a partial cache.
+func writeAssignerCache(path string, cache assignerCache) error {
+	data, err := json.Marshal(cache)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,69 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/kptm-tools/vulnerability-analysis/nvd/schema"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/results"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_NVDClient_nameAssigners(t *testing.T) {
+	t.Parallel()
+	var fetches atomic.Int32
+	var fail atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.True(t, strings.HasSuffix(r.URL.Path, "/source/2.0"))
+		fetches.Add(1)
+		if fail.Load() {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(schema.SourceResponse{TotalResults: 1, ResultsPerPage: 1, Sources: []schema.Source{{
+			Name:              "MITRE",
+			ContactEmail:      "cve@mitre.org",
+			SourceIdentifiers: []string{"cve@mitre.org", "8254265b-2729-46b6-b9e3-3dfca2d5bfca"},
+		}}})
+	}))
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "sources.json")
+	c := newTestNVDClient(server.URL+"/rest/json/cves/2.0", WithAssignerNames(path, time.Hour))
+	vulns := []results.Vulnerability{{}, {}}
+	vulns[0].Type = "8254265B-2729-46B6-B9E3-3DFCA2D5BFCA"
+	vulns[1].Type = "psirt@example.com"
+
+	c.nameAssigners(context.Background(), vulns)
+	assert.Equal(t, "MITRE", vulns[0].Type)
+	require.NotNil(t, vulns[0].Assigner)
+	assert.Equal(t, results.Assigner{Identifier: "8254265b-2729-46b6-b9e3-3dfca2d5bfca", Name: "MITRE", ContactEmail: "cve@mitre.org"}, *vulns[0].Assigner)
+	assert.Equal(t, "psirt@example.com", vulns[1].Type, "Expected unknown sources to be kept")
+	assert.Nil(t, vulns[1].Assigner)
+
+	// Served from memory within the ttl, then from the file after a restart
+	c.nameAssigners(context.Background(), []results.Vulnerability{{}})
+	assert.EqualValues(t, 1, fetches.Load())
+	fail.Store(true)
+	restarted := newTestNVDClient(server.URL+"/rest/json/cves/2.0", WithAssignerNames(path, time.Hour))
+	vulns = []results.Vulnerability{{}}
+	vulns[0].Type = "cve@mitre.org"
+	restarted.nameAssigners(context.Background(), vulns)
+	assert.Equal(t, "MITRE", vulns[0].Type)
+	assert.EqualValues(t, 1, fetches.Load())
+
+	// Stale sources are kept while the Source API fails
+	expired := newTestNVDClient(server.URL+"/rest/json/cves/2.0", WithAssignerNames(path, time.Nanosecond))
+	vulns[0].Type = "cve@mitre.org"
+	expired.nameAssigners(context.Background(), vulns)
+	assert.Equal(t, "MITRE", vulns[0].Type)
+	assert.GreaterOrEqual(t, fetches.Load(), int32(2))
+}
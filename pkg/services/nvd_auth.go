@@ -0,0 +1,23 @@
+package services
+
+import (
+	"github.com/kptm-tools/vulnerability-analysis/nvd/client"
+)
+
+// DefaultNVDAPIKeyHeader is the request header NVD reads the API key from.
+const DefaultNVDAPIKeyHeader = client.DefaultAPIKeyHeader
+
+// NVDRateLimit is the rolling window rate limit the NVD API enforces.
+type NVDRateLimit = client.RateLimit
+
+// NVDFilter restricts NVD queries by CVSS severity or metrics, or to the CVEs
+// known exploited or with CERT alerts, notes or OVAL definitions.
+type NVDFilter = client.Filter
+
+// NVDKeyUsage counts the requests sent with one of several NVD API keys.
+type NVDKeyUsage = client.KeyUsage
+
+var (
+	nvdKeyedRateLimit   = client.KeyedRateLimit
+	nvdUnkeyedRateLimit = client.UnkeyedRateLimit
+)
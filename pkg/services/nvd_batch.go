@@ -0,0 +1,185 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kptm-tools/vulnerability-analysis/nvd/schema"
+)
+
+// syncedCVESource is a knowledge source holding every CVE published until
+// SyncedUntil, e.g. a mirror.Store.
+type syncedCVESource interface {
+	SyncedUntil() time.Time
+}
+
+// CVEBatchError reports the CVEs of a FetchByCVEIDs call which couldn't be
+// looked up, by ID.
+type CVEBatchError struct {
+	Failed map[string]error
+}
+
+func (e *CVEBatchError) Error() string {
+	ids := slices.Sorted(maps.Keys(e.Failed))
+	msgs := make([]string, len(ids))
+	for i, id := range ids {
+		msgs[i] = fmt.Sprintf("%s: %s", id, e.Failed[id])
+	}
+	return fmt.Sprintf("failed to fetch %d CVEs: %s", len(ids), strings.Join(msgs, "; "))
+}
+
+func (e *CVEBatchError) Unwrap() []error {
+	errs := make([]error, 0, len(e.Failed))
+	for _, err := range e.Failed {
+		errs = append(errs, err)
+	}
+	return errs
+}
+
+// WithCVEBatchConcurrency bounds the cveId requests of FetchByCVEIDs in
+// flight at once, still paced by the rate limiter.
+func WithCVEBatchConcurrency(n int) NVDClientOption {
+	return func(c *NVDClient) {
+		c.cveBatchConcurrency = max(n, 1)
+	}
+}
+
+// FetchByCVEIDs fetches the records of several CVEs, e.g. the ones of an
+// advisory, in fewer round trips than FetchByCVEID for each: records are
+// served from the knowledge cache, the CVEs published since it was last
+// synced with a single published date query, and the others with concurrent
+// cveId requests, since NVD takes a single ID per query. The records are
+// returned by CVE ID, leaving out the CVEs NVD doesn't know. Invalid IDs and
+// failed lookups are reported in a *CVEBatchError, with the other records
+// still returned.
+func (c *NVDClient) FetchByCVEIDs(ctx context.Context, cveIDs []string) (map[string]schema.Vulnerability, error) {
+	records := make(map[string]schema.Vulnerability, len(cveIDs))
+	failed := make(map[string]error)
+
+	var missing []string
+	seen := make(map[string]bool, len(cveIDs))
+	for _, id := range cveIDs {
+		id = strings.ToUpper(strings.TrimSpace(id))
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		if !cveIDPattern.MatchString(id) {
+			failed[id] = fmt.Errorf("%w: %q", ErrInvalidCVEID, id)
+			continue
+		}
+		if c.knowledge != nil {
+			if resp, err := c.knowledge.LookupCVE(id); err == nil {
+				if record, ok := findCVE(resp, id); ok {
+					records[id] = record
+					continue
+				}
+			}
+		}
+		missing = append(missing, id)
+	}
+
+	missing = c.fetchPublishedSinceSync(ctx, missing, records)
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, max(c.cveBatchConcurrency, 1))
+	for _, id := range missing {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func() {
+			defer func() {
+				<-slots
+				wg.Done()
+			}()
+			resp, err := c.lookupCVE(ctx, id)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				failed[id] = err
+			} else if record, ok := findCVE(resp, id); ok {
+				records[id] = record
+			}
+		}()
+	}
+	wg.Wait()
+
+	slog.Debug("Fetched CVE batch",
+		slog.Int("n_cves", len(seen)),
+		slog.Int("n_requested", len(missing)),
+		slog.Int("n_found", len(records)),
+		slog.Int("n_failed", len(failed)))
+	if len(failed) > 0 {
+		return records, &CVEBatchError{Failed: failed}
+	}
+	return records, nil
+}
+
+// fetchPublishedSinceSync adds to records the CVEs of missing published
+// since the knowledge cache was last synced, which it can't hold, and
+// returns the ones still missing. The query is capped to fewer pages than
+// the cveId requests it replaces, the CVEs left out of it are still missing.
+func (c *NVDClient) fetchPublishedSinceSync(ctx context.Context, missing []string, records map[string]schema.Vulnerability) []string {
+	synced, ok := c.knowledge.(syncedCVESource)
+	if !ok || len(missing) < 2 || c.status.inMaintenance() {
+		return missing
+	}
+	since := synced.SyncedUntil()
+	now := time.Now().UTC()
+	if since.IsZero() || now.Sub(since) > nvdMaxDateRange {
+		return missing
+	}
+
+	query := url.Values{}
+	query.Set("pubStartDate", since.UTC().Format(nvdDateFormat))
+	query.Set("pubEndDate", now.Format(nvdDateFormat))
+	query.Set("resultsPerPage", strconv.Itoa(nvdMaxResultsPerPage))
+	limit := (len(missing) - 1) * nvdMaxResultsPerPage
+	resp, err := c.fetchAllPages(ctx, query, limit, func() (*schema.NvdAPIResponse, error) {
+		return nil, fmt.Errorf("%w: date range queries need the live API", c.status.unavailable())
+	})
+	if err != nil {
+		slog.Warn("Failed to fetch the CVEs published since the last sync, fetching them one by one",
+			slog.Time("since", since),
+			slog.Any("error", err))
+		return missing
+	}
+
+	wanted := make(map[string]bool, len(missing))
+	for _, id := range missing {
+		wanted[id] = true
+	}
+	for _, vuln := range resp.Vulnerabilities {
+		id := strings.ToUpper(vuln.Cve.ID)
+		if wanted[id] {
+			records[id] = vuln
+			delete(wanted, id)
+		}
+	}
+	return slices.DeleteFunc(missing, func(id string) bool {
+		return !wanted[id]
+	})
+}
+
+// findCVE returns the record of cveID in resp.
+func findCVE(resp *schema.NvdAPIResponse, cveID string) (schema.Vulnerability, bool) {
+	if resp == nil {
+		return schema.Vulnerability{}, false
+	}
+	i := slices.IndexFunc(resp.Vulnerabilities, func(v schema.Vulnerability) bool {
+		return strings.EqualFold(v.Cve.ID, cveID)
+	})
+	if i < 0 {
+		return schema.Vulnerability{}, false
+	}
+	return resp.Vulnerabilities[i], true
+}
@@ -0,0 +1,115 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kptm-tools/vulnerability-analysis/nvd/schema"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// syncedMirror is a knowledge source synced until a given time.
+type syncedMirror struct {
+	records     map[string]schema.Vulnerability
+	syncedUntil time.Time
+}
+
+func (m syncedMirror) LookupCVE(id string) (*schema.NvdAPIResponse, error) {
+	record, ok := m.records[id]
+	if !ok {
+		return &schema.NvdAPIResponse{}, nil
+	}
+	return &schema.NvdAPIResponse{TotalResults: 1, Vulnerabilities: []schema.Vulnerability{record}}, nil
+}
+
+func (m syncedMirror) SyncedUntil() time.Time {
+	return m.syncedUntil
+}
+
+// batchServer serves the records of known by cveId, and the ones of
+// published to published date queries, recording the queries.
+func batchServer(t *testing.T, known []string, published []string) (*httptest.Server, func() []string) {
+	t.Helper()
+	var mu sync.Mutex
+	var queries []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		var ids []string
+		if q.Has("pubStartDate") {
+			mu.Lock()
+			queries = append(queries, "published")
+			mu.Unlock()
+			ids = published
+		} else {
+			id := q.Get("cveId")
+			mu.Lock()
+			queries = append(queries, id)
+			mu.Unlock()
+			for _, k := range known {
+				if k == id {
+					ids = []string{id}
+				}
+			}
+		}
+		resp := schema.NvdAPIResponse{TotalResults: len(ids), ResultsPerPage: len(ids)}
+		for _, id := range ids {
+			resp.Vulnerabilities = append(resp.Vulnerabilities, schema.Vulnerability{Cve: schema.CveDetail{ID: id}})
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+	t.Cleanup(server.Close)
+	return server, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), queries...)
+	}
+}
+
+func Test_NVDClient_FetchByCVEIDs(t *testing.T) {
+	t.Parallel()
+	server, queries := batchServer(t, []string{"CVE-2024-0001", "CVE-2024-0002"}, nil)
+	nvd := newTestNVDClient(server.URL, WithCVEBatchConcurrency(2))
+
+	records, err := nvd.FetchByCVEIDs(context.Background(), []string{"CVE-2024-0001", "cve-2024-0002 ", "CVE-2024-0001", "CVE-2024-9999", "GHSA-xxxx"})
+	assert.Len(t, records, 2)
+	assert.Equal(t, "CVE-2024-0002", records["CVE-2024-0002"].Cve.ID)
+	assert.NotContains(t, records, "CVE-2024-9999", "Expected unknown CVEs to be left out")
+	assert.ElementsMatch(t, []string{"CVE-2024-0001", "CVE-2024-0002", "CVE-2024-9999"}, queries(), "Expected a request per distinct CVE")
+
+	var batchErr *CVEBatchError
+	require.ErrorAs(t, err, &batchErr)
+	assert.Len(t, batchErr.Failed, 1)
+	assert.ErrorIs(t, err, ErrInvalidCVEID)
+}
+
+func Test_NVDClient_FetchByCVEIDs_PublishedSinceSync(t *testing.T) {
+	t.Parallel()
+	server, queries := batchServer(t,
+		[]string{"CVE-2023-0001"},
+		[]string{"CVE-2024-1000", "CVE-2024-1001", "CVE-2024-1002"})
+	mirror := syncedMirror{
+		records:     map[string]schema.Vulnerability{"CVE-2021-44228": {Cve: schema.CveDetail{ID: "CVE-2021-44228"}}},
+		syncedUntil: time.Now().Add(-24 * time.Hour),
+	}
+	nvd := newTestNVDClient(server.URL, WithKnowledgeCache(mirror))
+
+	records, err := nvd.FetchByCVEIDs(context.Background(), []string{"CVE-2021-44228", "CVE-2024-1000", "CVE-2024-1002", "CVE-2023-0001"})
+	require.NoError(t, err)
+	assert.Len(t, records, 4)
+	assert.ElementsMatch(t, []string{"published", "CVE-2023-0001"}, queries(),
+		"Expected the CVEs published since the sync to be fetched with a single query")
+
+	// Too long since the sync for a date query
+	mirror.syncedUntil = time.Now().Add(-365 * 24 * time.Hour)
+	nvd = newTestNVDClient(server.URL, WithKnowledgeCache(mirror))
+	_, err = nvd.FetchByCVEIDs(context.Background(), []string{"CVE-2024-1000", "CVE-2024-1001"})
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"CVE-2024-1000", "CVE-2024-1001"}, queries()[2:],
+		"Expected the CVEs to be fetched one by one")
+}
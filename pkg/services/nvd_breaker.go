@@ -0,0 +1,206 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/kptm-tools/vulnerability-analysis/nvd/schema"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/failure"
+)
+
+// ErrNVDCircuitOpen is returned by the lookups failing fast while the circuit
+// breaker is open and no offline source could serve them.
+var ErrNVDCircuitOpen = errors.New("NVD circuit breaker is open")
+
+// CircuitState is the state of the circuit breaker around the NVD API.
+type CircuitState string
+
+const (
+	// CircuitClosed lets every request through.
+	CircuitClosed CircuitState = "closed"
+	// CircuitOpen fails requests fast until the cool-down is over.
+	CircuitOpen CircuitState = "open"
+	// CircuitHalfOpen lets a single trial request through, closing the
+	// circuit when it succeeds and opening it again when it fails.
+	CircuitHalfOpen CircuitState = "half-open"
+)
+
+// CircuitChange describes the circuit breaker opening or closing again.
+type CircuitChange struct {
+	From     CircuitState
+	To       CircuitState
+	Since    time.Time
+	Failures int
+	// RetryAt is when an open circuit lets a trial request through.
+	RetryAt   time.Time
+	LastError error
+}
+
+// circuitBreaker stops the requests to NVD once consecutive attempts failed,
+// so that lookups don't each go through the retry ladder during an outage.
+// Unlike the status monitor it reacts to the requests themselves, before
+// probes confirm a maintenance window. A nil breaker lets every request
+// through.
+type circuitBreaker struct {
+	mu        sync.Mutex
+	threshold int
+	coolDown  time.Duration
+	onChange  func(CircuitChange)
+	now       func() time.Time
+
+	state    CircuitState
+	failures int
+	openedAt time.Time
+}
+
+func newCircuitBreaker(threshold int, coolDown time.Duration, onChange func(CircuitChange)) *circuitBreaker {
+	return &circuitBreaker{
+		threshold: threshold,
+		coolDown:  coolDown,
+		onChange:  onChange,
+		now:       time.Now,
+		state:     CircuitClosed,
+	}
+}
+
+// WithCircuitBreaker opens the circuit after threshold consecutive failed
+// attempts to reach NVD, serving lookups from the offline sources or failing
+// them fast for coolDown before a trial request is let through. onChange is
+// called when the circuit opens and closes again, it may be nil. A threshold
+// below 1 disables the breaker.
+func WithCircuitBreaker(threshold int, coolDown time.Duration, onChange func(CircuitChange)) NVDClientOption {
+	return func(c *NVDClient) {
+		if threshold < 1 {
+			c.breaker = nil
+			return
+		}
+		c.breaker = newCircuitBreaker(threshold, coolDown, onChange)
+	}
+}
+
+// CircuitState returns the state of the circuit breaker, closed when it is
+// disabled.
+func (c *NVDClient) CircuitState() CircuitState {
+	if c.breaker == nil {
+		return CircuitClosed
+	}
+	c.breaker.mu.Lock()
+	defer c.breaker.mu.Unlock()
+	return c.breaker.state
+}
+
+// allow reports whether a request may be sent, turning an open circuit
+// half-open for the first request past the cool-down.
+func (b *circuitBreaker) allow() bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case CircuitClosed:
+		return true
+	case CircuitOpen:
+		if b.now().Sub(b.openedAt) < b.coolDown {
+			return false
+		}
+		b.state = CircuitHalfOpen
+		return true
+	default:
+		// A trial request is in flight
+		return false
+	}
+}
+
+// retryAt returns when an open circuit lets a trial request through.
+func (b *circuitBreaker) retryAt() time.Time {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.openedAt.Add(b.coolDown)
+}
+
+// success records NVD answering, closing the circuit.
+func (b *circuitBreaker) success() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	var change *CircuitChange
+	if b.state != CircuitClosed {
+		change = &CircuitChange{From: b.state, To: CircuitClosed, Since: b.now().UTC(), Failures: b.failures}
+		b.state = CircuitClosed
+	}
+	b.failures = 0
+	b.mu.Unlock()
+	b.notify(change)
+}
+
+// failure records an attempt failing to reach NVD, opening the circuit at
+// the threshold or when the trial request failed.
+func (b *circuitBreaker) failure(err error) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	b.failures++
+	var change *CircuitChange
+	switch {
+	case b.state == CircuitHalfOpen:
+		// Still down, no need to alert again
+		b.state = CircuitOpen
+		b.openedAt = b.now()
+	case b.state == CircuitClosed && b.failures >= b.threshold:
+		b.state = CircuitOpen
+		b.openedAt = b.now()
+		change = &CircuitChange{
+			From:      CircuitClosed,
+			To:        CircuitOpen,
+			Since:     b.openedAt.UTC(),
+			Failures:  b.failures,
+			RetryAt:   b.openedAt.Add(b.coolDown).UTC(),
+			LastError: err,
+		}
+	}
+	b.mu.Unlock()
+	b.notify(change)
+}
+
+// abandon records a request ending without telling whether NVD is up, e.g.
+// cancelled, so that a half-open circuit lets another trial through.
+func (b *circuitBreaker) abandon() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == CircuitHalfOpen {
+		b.state = CircuitOpen
+	}
+}
+
+func (b *circuitBreaker) notify(change *CircuitChange) {
+	if change == nil {
+		return
+	}
+	slog.Warn("NVD circuit breaker changed",
+		slog.String("from", string(change.From)),
+		slog.String("to", string(change.To)),
+		slog.Int("failures", change.Failures),
+		slog.Any("error", change.LastError))
+	if b.onChange != nil {
+		b.onChange(*change)
+	}
+}
+
+// failFast serves a lookup from offline while the circuit is open.
+func (c *NVDClient) failFast(offline func() (*schema.NvdAPIResponse, error)) (*schema.NvdAPIResponse, error) {
+	resp, err := offline()
+	if err != nil {
+		return nil, &failure.UpstreamError{Err: fmt.Errorf("%w until %s: %w", ErrNVDCircuitOpen, c.breaker.retryAt().UTC().Format(time.RFC3339), err)}
+	}
+	return resp, nil
+}
@@ -0,0 +1,106 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_circuitBreaker(t *testing.T) {
+	t.Parallel()
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	var changes []CircuitChange
+	b := newCircuitBreaker(2, time.Minute, func(c CircuitChange) { changes = append(changes, c) })
+	b.now = func() time.Time { return now }
+
+	b.failure(ErrNVDServiceUnavailable)
+	assert.True(t, b.allow(), "Expected a single failure to keep the circuit closed")
+	b.failure(ErrNVDServiceUnavailable)
+	assert.False(t, b.allow(), "Expected the circuit to open at the threshold")
+
+	// A single trial request past the cool-down
+	now = now.Add(time.Minute)
+	assert.True(t, b.allow())
+	assert.False(t, b.allow(), "Expected a single trial request while half-open")
+
+	// A failed trial opens the circuit again without alerting again
+	b.failure(ErrNVDServiceUnavailable)
+	assert.False(t, b.allow())
+
+	// An abandoned trial lets another one through
+	now = now.Add(time.Minute)
+	assert.True(t, b.allow())
+	b.abandon()
+	assert.True(t, b.allow())
+
+	b.success()
+	assert.True(t, b.allow())
+	assert.True(t, b.allow())
+
+	require.Len(t, changes, 2)
+	assert.Equal(t, CircuitOpen, changes[0].To)
+	assert.Equal(t, 2, changes[0].Failures)
+	assert.Equal(t, now.Add(-time.Minute), changes[0].RetryAt)
+	assert.ErrorIs(t, changes[0].LastError, ErrNVDServiceUnavailable)
+	assert.Equal(t, CircuitHalfOpen, changes[1].From)
+	assert.Equal(t, CircuitClosed, changes[1].To)
+}
+
+func Test_NVDClient_fetch_CircuitBreakerFailsFast(t *testing.T) {
+	t.Parallel()
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	var opened atomic.Int32
+	nvd := newTestNVDClient(server.URL,
+		WithRetryPolicy(testRetryPolicy),
+		WithCircuitBreaker(2, time.Hour, func(c CircuitChange) {
+			if c.To == CircuitOpen {
+				opened.Add(1)
+			}
+		}))
+	cpe := "cpe:2.3:o:microsoft:windows_10:1607:*:*:*:*:*:*:*"
+
+	_, err := nvd.fetchByCPE(context.Background(), cpe)
+	assert.ErrorIs(t, err, ErrNVDCircuitOpen)
+	assert.Equal(t, int32(2), requests.Load(), "Expected the retries to stop once the circuit opened")
+	assert.Equal(t, CircuitOpen, nvd.CircuitState())
+
+	_, err = nvd.fetchByCPE(context.Background(), cpe)
+	assert.ErrorIs(t, err, ErrNVDCircuitOpen)
+	assert.Equal(t, int32(2), requests.Load(), "Expected lookups to fail fast while the circuit is open")
+	assert.Equal(t, int32(1), opened.Load())
+}
+
+func Test_NVDClient_fetch_ThrottledTrialAbandoned(t *testing.T) {
+	t.Parallel()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "60")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	nvd := newTestNVDClient(server.URL, WithRetryPolicy(testRetryPolicy), WithCircuitBreaker(1, time.Millisecond, nil))
+	nvd.breaker.failure(ErrNVDServiceUnavailable)
+	time.Sleep(2 * time.Millisecond)
+
+	// The trial request is throttled, then runs out of time waiting for the
+	// retry NVD asked for
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err := nvd.fetchByCPE(ctx, "cpe:2.3:o:microsoft:windows_10:1607:*:*:*:*:*:*:*")
+	require.Error(t, err)
+
+	assert.Equal(t, CircuitOpen, nvd.CircuitState(), "Expected the abandoned trial not to leave the circuit half-open")
+	assert.True(t, nvd.breaker.allow(), "Expected another trial request to be let through")
+}
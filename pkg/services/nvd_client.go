@@ -0,0 +1,446 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"sync/atomic"
+	"time"
+
+	"github.com/kptm-tools/vulnerability-analysis/nvd/client"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/cache"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/cpesync"
+)
+
+// RetryPolicy bounds the retries of NVD requests failing with a 503, throttled
+// or interrupted by a transient network error. Delays grow exponentially from
+// InitialDelay and are capped at MaxDelay, unless NVD asks to retry after a
+// given delay.
+type RetryPolicy struct {
+	MaxRetries   int
+	InitialDelay time.Duration
+	MaxDelay     time.Duration
+}
+
+// DefaultRetryPolicy retries three times, backing off from 5s up to 15s.
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxRetries:   3,
+		InitialDelay: 5 * time.Second,
+		MaxDelay:     15 * time.Second,
+	}
+}
+
+// delay returns the wait before retrying after the given failed attempt.
+func (p RetryPolicy) delay(attempt int) time.Duration {
+	// Exponential backoff with jitter
+	delay := p.InitialDelay * time.Duration(1<<uint(attempt))
+	jitter := time.Duration(int64(float64(delay) * 0.2)) // +/- 20% jitter
+	delay += jitter
+
+	if delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	return delay
+}
+
+// NVDClient queries the NVD CVE API for the enrichment pipeline, retrying
+// transient failures and serving lookups from the offline sources while NVD
+// is in a maintenance window. The zero value is not usable, use NewNVDClient.
+type NVDClient struct {
+	api   *client.Client
+	retry RetryPolicy
+
+	// requestInterval paces consecutive requests for the pages of a query
+	// and the ports of a host. Zero disables the pacing.
+	requestInterval time.Duration
+
+	// maxCVEsPerCPE caps the CVEs fetched for a single CPE, zero fetches
+	// every CVE NVD matches.
+	maxCVEsPerCPE int
+
+	// cpeTimeout bounds the lookups of a single CPE, retries and pages
+	// included. Zero only stops on the scan context.
+	cpeTimeout time.Duration
+
+	// filter restricts the CVEs fetched for a CPE by CVSS severity or
+	// metrics, the zero value keeps every CVE.
+	filter client.Filter
+
+	// noRejected leaves the CVEs rejected by their CNA out of CPE and keyword
+	// lookups, asking NVD for noRejected and dropping any returned anyway.
+	noRejected bool
+
+	// vulnerableOnly sends isVulnerable with the cpeName of versioned CPEs,
+	// only fetching the CVEs whose configurations mark the CPE vulnerable.
+	vulnerableOnly bool
+
+	// maxOffset is the highest startIndex paged through for a single query.
+	// Date ranges with more results are split into smaller windows instead.
+	maxOffset int
+
+	// minDateRange stops date range splitting, so a burst of modifications
+	// within a few minutes can't split a window indefinitely.
+	minDateRange time.Duration
+
+	// status tracks whether NVD is in a maintenance window, during which
+	// lookups are served by offline, or fail fast when it is nil.
+	status  *nvdStatusMonitor
+	offline CPESource
+
+	// breaker fails lookups fast after consecutive failed attempts, nil
+	// when disabled.
+	breaker *circuitBreaker
+
+	// cpeCache serves CPEs looked up again within its TTL, nil when
+	// disabled.
+	cpeCache *CPECache
+
+	// shared shares the CPE lookups with the other workers for sharedTTL,
+	// nil when disabled.
+	shared    cache.Cache
+	sharedTTL time.Duration
+
+	// accessLog keeps the latest requests, nil when disabled.
+	accessLog *accessLog
+
+	// negativeTTL shortens the TTL of the cached lookups of the CPEs
+	// without CVEs, zero keeps them as long as the others.
+	negativeTTL time.Duration
+
+	// localLookups serves every CPE lookup from offline, e.g. a mirror
+	// synced from the NVD data feeds, instead of the live API.
+	localLookups bool
+
+	// knowledge serves CVE records before the live API is queried, e.g. a
+	// mirror seeded from a snapshot.
+	knowledge CVESource
+
+	// sources are raced against the live API for every CVE lookup, each
+	// waited for at most sourceTimeout.
+	sources       []NamedCVESource
+	sourceTimeout time.Duration
+
+	// cveBatchConcurrency bounds the cveId requests of FetchByCVEIDs in
+	// flight at once.
+	cveBatchConcurrency int
+
+	// sync stores the CVEs of each CPE, so that later lookups only fetch
+	// the ones modified since. Checkpoints older than syncMaxAge are
+	// refetched in full.
+	sync       *cpesync.Store
+	syncMaxAge time.Duration
+
+	// matchCriteria, when set, checks that the CVEs of versioned CPEs apply
+	// to them by expanding the criteria of their configurations.
+	matchCriteria *matchCriteriaCache
+
+	// assigners, when set, names the CNAs of the findings after the sources
+	// of the Source API.
+	assigners *assignerDirectory
+
+	// throttled counts the requests NVD answered with a rate limit error.
+	throttled atomic.Uint64
+}
+
+// NVDClientOption configures an NVDClient.
+type NVDClientOption func(*NVDClient)
+
+// NewNVDClient returns a client of the public NVD API with the default retry
+// policy and pacing, keeping its requests within the unauthenticated rate
+// limit until configured otherwise.
+func NewNVDClient(opts ...NVDClientOption) *NVDClient {
+	c := &NVDClient{
+		api:             client.New("", ""),
+		retry:           DefaultRetryPolicy(),
+		requestInterval: 7 * time.Second,
+		maxOffset:       10000,
+		minDateRange:    time.Hour,
+		status:          newNVDStatusMonitor(),
+		sourceTimeout:   10 * time.Second,
+
+		cveBatchConcurrency: 4,
+	}
+	c.api.Limiter = client.NewLimiter()
+	for _, opt := range opts {
+		opt(c)
+	}
+	// Wrapped last, around the transport of WithTransport
+	if c.accessLog != nil {
+		httpClient := *c.api.HTTPClient
+		httpClient.Transport = &accessLogTransport{next: httpClient.Transport, log: c.accessLog}
+		c.api.HTTPClient = &httpClient
+	}
+	return c
+}
+
+// WithBaseURL points the client at another CVE API, such as a mirror or a
+// mock, and at the CVE Change History, Products, Match Criteria and Source
+// APIs next to it unless set by WithHistoryURL, WithProductsURL,
+// WithMatchCriteriaURL and WithSourceURL. An empty URL keeps the NVD
+// endpoints.
+func WithBaseURL(baseURL string) NVDClientOption {
+	return func(c *NVDClient) {
+		if baseURL != "" {
+			c.api.BaseURL = baseURL
+			if c.api.HistoryURL == client.DefaultHistoryURL {
+				c.api.HistoryURL = ""
+			}
+			if c.api.ProductsURL == client.DefaultProductsURL {
+				c.api.ProductsURL = ""
+			}
+			if c.api.MatchCriteriaURL == client.DefaultMatchCriteriaURL {
+				c.api.MatchCriteriaURL = ""
+			}
+			if c.api.SourceURL == client.DefaultSourceURL {
+				c.api.SourceURL = ""
+			}
+		}
+	}
+}
+
+// WithHistoryURL points the client at another CVE Change History API. An
+// empty URL keeps the default.
+func WithHistoryURL(historyURL string) NVDClientOption {
+	return func(c *NVDClient) {
+		if historyURL != "" {
+			c.api.HistoryURL = historyURL
+		}
+	}
+}
+
+// WithProductsURL points the client at another Products API. An empty URL
+// keeps the default.
+func WithProductsURL(productsURL string) NVDClientOption {
+	return func(c *NVDClient) {
+		if productsURL != "" {
+			c.api.ProductsURL = productsURL
+		}
+	}
+}
+
+// WithHTTPClient replaces the HTTP client issuing the requests.
+func WithHTTPClient(httpClient *http.Client) NVDClientOption {
+	return func(c *NVDClient) {
+		c.api.HTTPClient = httpClient
+	}
+}
+
+// WithAPIKey sends key with every request, in header or in the apiKey header
+// when empty. Gateways in front of NVD may expect the key under another name.
+func WithAPIKey(key, header string) NVDClientOption {
+	return func(c *NVDClient) {
+		if header == "" {
+			header = DefaultNVDAPIKeyHeader
+		}
+		c.api.APIKey = key
+		c.api.APIKeyHeader = header
+	}
+}
+
+// WithAPIKeys rotates requests over several API keys sent in header, failing
+// over to the next key when NVD throttles or rejects one. It replaces the key
+// of WithAPIKey and a single key behaves the same.
+func WithAPIKeys(keys []string, header string) NVDClientOption {
+	return func(c *NVDClient) {
+		if header == "" {
+			header = DefaultNVDAPIKeyHeader
+		}
+		c.api.APIKey = ""
+		c.api.Keys = client.NewKeyRing(keys...)
+		c.api.APIKeyHeader = header
+	}
+}
+
+// WithResponseCache keeps up to maxEntries NVD responses sent with an ETag or
+// Last-Modified header, revalidating them with conditional requests so that
+// repeated lookups of a CPE get a 304 instead of the whole body again.
+func WithResponseCache(maxEntries int) NVDClientOption {
+	return func(c *NVDClient) {
+		c.api.Cache = client.NewResponseCache(maxEntries)
+	}
+}
+
+// WithRetryPolicy replaces the retries of requests failing transiently.
+func WithRetryPolicy(policy RetryPolicy) NVDClientOption {
+	return func(c *NVDClient) {
+		c.retry = policy
+	}
+}
+
+// WithRateLimiter shares limiter between clients, so that together they stay
+// within the NVD rate limit. A nil limiter disables rate limiting, e.g. for
+// clients of a mock.
+func WithRateLimiter(limiter *client.Limiter) NVDClientOption {
+	return func(c *NVDClient) {
+		c.api.Limiter = limiter
+	}
+}
+
+// WithAdaptivePacing replaces the fixed request interval with a limiter
+// learning the pace NVD sustains from its throttled responses, widening the
+// spacing of requests when NVD throttles and narrowing it while it doesn't.
+func WithAdaptivePacing() NVDClientOption {
+	return func(c *NVDClient) {
+		c.api.Limiter = client.NewAdaptiveLimiter()
+		c.requestInterval = 0
+	}
+}
+
+// WithRequestInterval sets the minimum delay between consecutive requests
+// issued for the pages of a query or the ports of a host.
+func WithRequestInterval(interval time.Duration) NVDClientOption {
+	return func(c *NVDClient) {
+		c.requestInterval = interval
+	}
+}
+
+// WithMaxCVEsPerCPE caps the CVEs fetched for a single CPE, so that broad CPEs
+// matching thousands of CVEs don't page through the whole result set.
+func WithMaxCVEsPerCPE(n int) NVDClientOption {
+	return func(c *NVDClient) {
+		c.maxCVEsPerCPE = max(n, 0)
+	}
+}
+
+// WithCPETimeout sets the deadline of the NVD lookups of a single CPE.
+func WithCPETimeout(timeout time.Duration) NVDClientOption {
+	return func(c *NVDClient) {
+		c.cpeTimeout = timeout
+	}
+}
+
+// WithCVSSFilter only fetches the CVEs of a CPE kept by filter, as returned
+// by ParseCVSSFilter, e.g. of HIGH and CRITICAL severity, cutting the requests
+// for products with thousands of low CVEs. Offline lookups are filtered
+// locally.
+func WithCVSSFilter(filter NVDFilter) NVDClientOption {
+	return func(c *NVDClient) {
+		c.filter = filter
+	}
+}
+
+// WithRejectedSuppression leaves the CVEs rejected by their CNA, which only
+// clutter reports, out of CPE and keyword lookups. The rejected CVEs dropped
+// from the responses, e.g. of offline sources, are counted in the
+// RejectedCVEs of the host results.
+func WithRejectedSuppression() NVDClientOption {
+	return func(c *NVDClient) {
+		c.noRejected = true
+	}
+}
+
+// WithVulnerableOnly looks up the CPEs with a version in precision mode,
+// with isVulnerable, leaving out the CVEs which only reference the CPE in
+// their configurations, e.g. an operating system a vulnerable application
+// runs on. Versionless CPEs are looked up as before.
+func WithVulnerableOnly() NVDClientOption {
+	return func(c *NVDClient) {
+		c.vulnerableOnly = true
+	}
+}
+
+// WithIncrementalSync keeps the CVEs of each CPE looked up in store, so that
+// recurring scans of the same assets only fetch the CVEs modified since the
+// previous lookup, with lastModStartDate, and merge them into the stored ones.
+// CPEs last synced longer than maxAge ago, or than the longest date range NVD
+// accepts, are fetched in full again, which also drops the CVEs rejected or
+// no longer matching the CPE since.
+func WithIncrementalSync(store *cpesync.Store, maxAge time.Duration) NVDClientOption {
+	return func(c *NVDClient) {
+		c.sync = store
+		c.syncMaxAge = maxAge
+	}
+}
+
+// WithOfflineSource configures the source serving CPE lookups, and CVE
+// lookups when it implements CVESource, while NVD is unavailable.
+func WithOfflineSource(src CPESource) NVDClientOption {
+	return func(c *NVDClient) {
+		c.offline = src
+	}
+}
+
+// WithKnowledgeCache configures the source consulted first for CVE lookups.
+// When it implements CPESource, it also serves the CPE lookups the live API
+// fails.
+func WithKnowledgeCache(src CVESource) NVDClientOption {
+	return func(c *NVDClient) {
+		c.knowledge = src
+	}
+}
+
+// WithCVESources enables parallel CVE lookups: the sources and the live NVD
+// API are queried concurrently and the records returned within timeout are
+// merged. Sources are listed by priority. CPE lookups are raced as well
+// against the sources that also index CPEs, e.g. a mirror.
+func WithCVESources(timeout time.Duration, sources ...NamedCVESource) NVDClientOption {
+	return func(c *NVDClient) {
+		if timeout > 0 {
+			c.sourceTimeout = timeout
+		}
+		c.sources = sources
+	}
+}
+
+// RateLimit returns the limit applying to the client's API key, so callers
+// can size their concurrency and pacing.
+func (c *NVDClient) RateLimit() NVDRateLimit {
+	return c.api.RateLimit()
+}
+
+// KeyUsage returns the requests sent with each key configured by WithAPIKeys.
+func (c *NVDClient) KeyUsage() []NVDKeyUsage {
+	if c.api.Keys == nil {
+		return nil
+	}
+	return c.api.Keys.Usage()
+}
+
+// ReplaceAPIKeys rotates requests over keys instead of the keys of
+// WithAPIKeys, e.g. once rotated in a secret manager. It returns false when
+// the client wasn't created with WithAPIKeys.
+func (c *NVDClient) ReplaceAPIKeys(keys []string) bool {
+	if c.api.Keys == nil {
+		return false
+	}
+	c.api.Keys.Replace(keys...)
+	return true
+}
+
+// ResponseCacheStats returns the counters of the cache of WithResponseCache,
+// and false when it isn't enabled.
+func (c *NVDClient) ResponseCacheStats() (client.ResponseCacheStats, bool) {
+	if c.api.Cache == nil {
+		return client.ResponseCacheStats{}, false
+	}
+	return c.api.Cache.Stats(), true
+}
+
+// RequestSpacing returns the spacing of requests learned with
+// WithAdaptivePacing, zero while NVD hasn't throttled any.
+func (c *NVDClient) RequestSpacing() time.Duration {
+	if c.api.Limiter == nil {
+		return 0
+	}
+	return c.api.Limiter.Spacing()
+}
+
+// Throttled returns the number of requests NVD throttled since the client was
+// created, retried ones included.
+func (c *NVDClient) Throttled() uint64 {
+	return c.throttled.Load()
+}
+
+// RateLimited reports whether the client waits on a rate limiter.
+func (c *NVDClient) RateLimited() bool {
+	return c.api.Limiter != nil
+}
+
+// probe issues a minimal request to the NVD API to check its availability.
+func (c *NVDClient) probe(ctx context.Context, httpClient *http.Client) error {
+	api := *c.api
+	api.HTTPClient = httpClient
+	_, err := api.Fetch(ctx, url.Values{"resultsPerPage": {"1"}})
+	return err
+}
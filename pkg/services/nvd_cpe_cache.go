@@ -0,0 +1,259 @@
+package services
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/kptm-tools/vulnerability-analysis/nvd/schema"
+)
+
+// CPECache keeps the CVEs looked up for each CPE for a TTL, so that the same
+// CPE enriched again within it, e.g. on every host of a fleet, skips NVD.
+// Lookups are keyed by the normalized CPE; the least recently used are
+// evicted past the maximum number of entries. CPEs NVD knows no CVE for are
+// kept as empty markers. It is safe for concurrent use.
+type CPECache struct {
+	mu         sync.Mutex
+	maxEntries int
+	ttl        time.Duration
+	now        func() time.Time
+	entries    map[string]*list.Element
+	lru        *list.List
+	stats      CPECacheStats
+}
+
+// CPECacheStats counts the lookups of a CPECache. NegativeHits are the hits
+// on CPEs without CVEs, also counted in Hits.
+type CPECacheStats struct {
+	Entries      int `json:"entries"`
+	Hits         int `json:"hits"`
+	NegativeHits int `json:"negative_hits"`
+	Misses       int `json:"misses"`
+	Expired      int `json:"expired"`
+	Evicted      int `json:"evicted"`
+}
+
+type cpeEntry struct {
+	key      string
+	resp     *schema.NvdAPIResponse // Nil for the CPEs without CVEs
+	rejected int64
+	expires  time.Time
+}
+
+// NewCPECache returns a cache of the lookups of at most maxEntries CPEs, or
+// of every CPE when maxEntries isn't positive, each kept for ttl.
+func NewCPECache(maxEntries int, ttl time.Duration) *CPECache {
+	return &CPECache{
+		maxEntries: maxEntries,
+		ttl:        ttl,
+		now:        time.Now,
+		entries:    make(map[string]*list.Element),
+		lru:        list.New(),
+	}
+}
+
+// Stats returns the counters of the cache.
+func (c *CPECache) Stats() CPECacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := c.stats
+	stats.Entries = c.lru.Len()
+	return stats
+}
+
+// cpeCacheKey normalizes cpe, whose components NVD matches case-insensitively.
+func cpeCacheKey(cpe string) string {
+	return strings.ToLower(strings.TrimSpace(cpe))
+}
+
+// get returns the lookup of cpe and the rejected CVEs suppressed from it.
+func (c *CPECache) get(cpe string) (*schema.NvdAPIResponse, int64, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := cpeCacheKey(cpe)
+	elem, ok := c.entries[key]
+	if !ok {
+		c.stats.Misses++
+		return nil, 0, false
+	}
+	entry := elem.Value.(*cpeEntry)
+	if !c.now().Before(entry.expires) {
+		c.lru.Remove(elem)
+		delete(c.entries, key)
+		c.stats.Expired++
+		c.stats.Misses++
+		return nil, 0, false
+	}
+	c.stats.Hits++
+	c.lru.MoveToFront(elem)
+	if entry.resp == nil {
+		c.stats.NegativeHits++
+		return &schema.NvdAPIResponse{}, entry.rejected, true
+	}
+	return cloneResponse(entry.resp), entry.rejected, true
+}
+
+// put keeps the lookup of cpe for the TTL of the cache, or for negativeTTL
+// when it is shorter and NVD knows no CVE for cpe.
+func (c *CPECache) put(cpe string, resp *schema.NvdAPIResponse, rejected int64, negativeTTL time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := cpeCacheKey(cpe)
+	entry := &cpeEntry{key: key, rejected: rejected, expires: c.now().Add(c.ttl)}
+	if isEmptyLookup(resp) {
+		entry.expires = c.now().Add(emptyLookupTTL(c.ttl, negativeTTL))
+	} else {
+		entry.resp = cloneResponse(resp)
+	}
+	if elem, ok := c.entries[key]; ok {
+		elem.Value = entry
+		c.lru.MoveToFront(elem)
+		return
+	}
+	c.entries[key] = c.lru.PushFront(entry)
+	for c.maxEntries > 0 && c.lru.Len() > c.maxEntries {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cpeEntry).key)
+		c.stats.Evicted++
+	}
+}
+
+func (c *CPECache) invalidate(cpe string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := cpeCacheKey(cpe)
+	if elem, ok := c.entries[key]; ok {
+		c.lru.Remove(elem)
+		delete(c.entries, key)
+	}
+}
+
+// isEmptyLookup reports whether resp holds no CVE for the CPE looked up.
+func isEmptyLookup(resp *schema.NvdAPIResponse) bool {
+	return resp.TotalResults == 0 && len(resp.Vulnerabilities) == 0
+}
+
+// emptyLookupTTL returns the TTL of an empty lookup in a cache keeping the
+// others for ttl, where zero or less means forever.
+func emptyLookupTTL(ttl, negativeTTL time.Duration) time.Duration {
+	if negativeTTL > 0 && (ttl <= 0 || negativeTTL < ttl) {
+		return negativeTTL
+	}
+	return ttl
+}
+
+// cloneResponse copies the CVE list of resp, so that callers filtering a
+// cached lookup don't change it.
+func cloneResponse(resp *schema.NvdAPIResponse) *schema.NvdAPIResponse {
+	clone := *resp
+	clone.Vulnerabilities = slices.Clone(resp.Vulnerabilities)
+	return &clone
+}
+
+// WithCPECache serves the CPEs looked up again within ttl from memory, for
+// up to maxEntries CPEs. Lookups answered while NVD is down aren't cached.
+func WithCPECache(maxEntries int, ttl time.Duration) NVDClientOption {
+	return func(c *NVDClient) {
+		c.cpeCache = NewCPECache(maxEntries, ttl)
+	}
+}
+
+// WithNegativeCPECacheTTL keeps the lookups of the CPEs NVD knows no CVE for
+// in the caches of WithCPECache and WithSharedCache for ttl, when shorter
+// than theirs, so that the CVEs published for them since are found sooner
+// while still skipping NVD for them on most scans.
+func WithNegativeCPECacheTTL(ttl time.Duration) NVDClientOption {
+	return func(c *NVDClient) {
+		c.negativeTTL = ttl
+	}
+}
+
+// CPECacheStats returns the counters of the cache of WithCPECache, and false
+// when it isn't enabled.
+func (c *NVDClient) CPECacheStats() (CPECacheStats, bool) {
+	if c.cpeCache == nil {
+		return CPECacheStats{}, false
+	}
+	return c.cpeCache.Stats(), true
+}
+
+// fetchCachedCPE serves cpe from the cache of WithCPECache, then from the
+// cache of WithSharedCache, looking it up on misses. The rejected CVEs
+// suppressed from a lookup are counted again on the hits, as the hosts
+// sharing the CPE would have had them suppressed too.
+func (c *NVDClient) fetchCachedCPE(ctx context.Context, cpe string) (*schema.NvdAPIResponse, error) {
+	count, _ := ctx.Value(rejectedCountKey{}).(*atomic.Int64)
+	if resp, rejected, ok := c.cachedCPE(ctx, cpe); ok {
+		if count != nil {
+			count.Add(rejected)
+		}
+		return resp, nil
+	}
+
+	lookupCtx, rejected := withRejectedCount(ctx)
+	resp, err := c.lookupCPE(lookupCtx, cpe)
+	if count != nil {
+		count.Add(rejected.Load())
+	}
+	if err != nil {
+		return nil, err
+	}
+	c.storeCPE(ctx, cpe, resp, rejected.Load())
+	return resp, nil
+}
+
+// storeCPE keeps the lookup of cpe in the cache of WithCPECache and in the
+// one of WithSharedCache, and reports whether it did.
+func (c *NVDClient) storeCPE(ctx context.Context, cpe string, resp *schema.NvdAPIResponse, rejected int64) bool {
+	// Lookups which may have been answered by the offline source would
+	// outlive the outage
+	if c.status.inMaintenance() || c.CircuitState() != CircuitClosed {
+		return false
+	}
+	if c.cpeCache != nil {
+		c.cpeCache.put(cpe, resp, rejected, c.negativeTTL)
+	}
+	c.shareCPE(ctx, cpe, resp, rejected)
+	return true
+}
+
+// cachedCPE returns the cached lookup of cpe and its rejected CVEs, keeping
+// the lookups found in the shared cache in memory too.
+func (c *NVDClient) cachedCPE(ctx context.Context, cpe string) (*schema.NvdAPIResponse, int64, bool) {
+	if c.cpeCache != nil {
+		if resp, rejected, ok := c.cpeCache.get(cpe); ok {
+			return resp, rejected, true
+		}
+	}
+	resp, rejected, ok := c.sharedCPE(ctx, cpe)
+	if ok && c.cpeCache != nil {
+		c.cpeCache.put(cpe, resp, rejected, c.negativeTTL)
+	}
+	return resp, rejected, ok
+}
+
+// InvalidateCPE drops the cached lookups of cpe, from the shared cache too,
+// so that the next one queries NVD.
+func (c *NVDClient) InvalidateCPE(ctx context.Context, cpe string) error {
+	if c.cpeCache != nil {
+		c.cpeCache.invalidate(cpe)
+	}
+	if c.shared == nil {
+		return nil
+	}
+	if err := c.shared.Invalidate(ctx, c.sharedCPEKey(cpe)); err != nil {
+		return fmt.Errorf("failed to invalidate shared lookup of %s: %w", cpe, err)
+	}
+	return nil
+}
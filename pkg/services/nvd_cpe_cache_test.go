@@ -0,0 +1,121 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/kptm-tools/vulnerability-analysis/nvd/client"
+	"github.com/kptm-tools/vulnerability-analysis/nvd/schema"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_NVDClient_fetchByCPE_CPECache(t *testing.T) {
+	t.Parallel()
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		json.NewEncoder(w).Encode(schema.NvdAPIResponse{TotalResults: 2, ResultsPerPage: 2, Vulnerabilities: []schema.Vulnerability{
+			{Cve: schema.CveDetail{ID: "CVE-2024-0001", VulnStatus: "Analyzed"}},
+			{Cve: schema.CveDetail{ID: "CVE-2024-0002", VulnStatus: client.StatusRejected}},
+		}})
+	}))
+	defer server.Close()
+
+	nvd := newTestNVDClient(server.URL, WithRejectedSuppression(), WithCPECache(10, time.Hour))
+	ctx, rejected := withRejectedCount(context.Background())
+
+	resp, err := nvd.fetchByCPE(ctx, "cpe:2.3:a:apache:http_server:2.4.41:*:*:*:*:*:*:*")
+	require.NoError(t, err)
+	require.Len(t, resp.Vulnerabilities, 1)
+	resp.Vulnerabilities[0].Cve.ID = "CVE-0000-0000"
+
+	// The same CPE, whatever its case, is served from memory
+	resp, err = nvd.fetchByCPE(ctx, "cpe:2.3:a:Apache:HTTP_Server:2.4.41:*:*:*:*:*:*:*")
+	require.NoError(t, err)
+	require.Len(t, resp.Vulnerabilities, 1)
+	assert.Equal(t, "CVE-2024-0001", resp.Vulnerabilities[0].Cve.ID, "Expected cached lookups to be copied")
+	assert.Equal(t, int32(1), requests.Load())
+	assert.Equal(t, int64(2), rejected.Load(), "Expected the rejected CVEs of cached lookups to be counted")
+
+	stats, ok := nvd.CPECacheStats()
+	require.True(t, ok)
+	assert.Equal(t, CPECacheStats{Entries: 1, Hits: 1, Misses: 1}, stats)
+
+	_, ok = newTestNVDClient(server.URL).CPECacheStats()
+	assert.False(t, ok)
+}
+
+func Test_NVDClient_fetchByCPE_CPECacheSkipsOutages(t *testing.T) {
+	t.Parallel()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	offline := stubCPESource{resp: &schema.NvdAPIResponse{TotalResults: 1, Vulnerabilities: []schema.Vulnerability{
+		{Cve: schema.CveDetail{ID: "CVE-2024-0001"}},
+	}}}
+	nvd := newTestNVDClient(server.URL,
+		WithRetryPolicy(testRetryPolicy),
+		WithOfflineSource(offline),
+		WithCircuitBreaker(1, time.Hour, nil),
+		WithCPECache(10, time.Hour))
+
+	resp, err := nvd.fetchByCPE(context.Background(), "cpe:2.3:a:apache:http_server:2.4.41:*:*:*:*:*:*:*")
+	require.NoError(t, err)
+	assert.Len(t, resp.Vulnerabilities, 1)
+	stats, _ := nvd.CPECacheStats()
+	assert.Zero(t, stats.Entries, "Expected offline lookups not to be cached")
+}
+
+func TestCPECache_Expires(t *testing.T) {
+	t.Parallel()
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := NewCPECache(1, 24*time.Hour)
+	c.now = func() time.Time { return now }
+	found := &schema.NvdAPIResponse{TotalResults: 1, Vulnerabilities: []schema.Vulnerability{{}}}
+	c.put("cpe:2.3:a:apache:log4j:2.14.1", found, 0, 0)
+
+	now = now.Add(23 * time.Hour)
+	_, _, hit := c.get("cpe:2.3:a:apache:log4j:2.14.1")
+	assert.True(t, hit)
+	now = now.Add(time.Hour)
+	_, _, hit = c.get("cpe:2.3:a:apache:log4j:2.14.1")
+	assert.False(t, hit)
+
+	c.put("cpe:2.3:a:apache:log4j:2.14.1", found, 0, 0)
+	c.put("cpe:2.3:a:apache:log4j:2.15.0", found, 0, 0)
+	_, _, hit = c.get("cpe:2.3:a:apache:log4j:2.14.1")
+	assert.False(t, hit)
+	assert.Equal(t, CPECacheStats{Entries: 1, Hits: 1, Misses: 2, Expired: 1, Evicted: 1}, c.Stats())
+}
+
+func TestCPECache_Negative(t *testing.T) {
+	t.Parallel()
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := NewCPECache(10, 24*time.Hour)
+	c.now = func() time.Time { return now }
+	c.put("cpe:2.3:a:acme:widget:1.0", &schema.NvdAPIResponse{Format: "NVD_CVE", Version: "2.0"}, 0, time.Hour)
+
+	resp, _, hit := c.get("cpe:2.3:a:acme:widget:1.0")
+	require.True(t, hit)
+	assert.Zero(t, resp.TotalResults)
+	assert.Empty(t, resp.Vulnerabilities)
+
+	now = now.Add(time.Hour)
+	_, _, hit = c.get("cpe:2.3:a:acme:widget:1.0")
+	assert.False(t, hit, "Expected empty lookups to expire after the negative TTL")
+	assert.Equal(t, CPECacheStats{Hits: 1, NegativeHits: 1, Misses: 1, Expired: 1}, c.Stats())
+
+	// Longer negative TTLs don't outlive the others
+	c.put("cpe:2.3:a:acme:widget:1.0", &schema.NvdAPIResponse{}, 0, 48*time.Hour)
+	now = now.Add(24 * time.Hour)
+	_, _, hit = c.get("cpe:2.3:a:acme:widget:1.0")
+	assert.False(t, hit)
+}
@@ -0,0 +1,161 @@
+package services
+
+import (
+	"log/slog"
+	"strings"
+	"unicode"
+
+	"github.com/kptm-tools/common/common/pkg/enums"
+	"github.com/kptm-tools/common/common/pkg/results/tools"
+	"github.com/kptm-tools/vulnerability-analysis/nvd/schema"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/metrics"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/results"
+)
+
+// rawCVSS holds the NVD values of the metrics mapped to the enums of a
+// finding, taken from the same CVSS version as extractMetrics.
+type rawCVSS struct {
+	severity, attackVector, complexity, privilegesRequired string
+	userInteraction, scope                                 string
+	confidentiality, integrity, availability               string
+	exploitability                                         string
+}
+
+func rawMetrics(metrics *schema.Metrics) rawCVSS {
+	var raw rawCVSS
+	switch {
+	case metrics == nil:
+	case len(metrics.CvssMetricV31) > 0:
+		d := metrics.CvssMetricV31[0].CvssData
+		raw = rawCVSS{
+			severity: string(d.BaseSeverity), attackVector: string(d.AttackVector),
+			complexity: string(d.AttackComplexity), privilegesRequired: string(d.PrivilegesRequired),
+			userInteraction: string(d.UserInteraction), scope: string(d.Scope),
+			confidentiality: string(d.ConfidentialityImpact), integrity: string(d.IntegrityImpact),
+			availability: string(d.AvailabilityImpact),
+		}
+		if d.ExploitCodeMaturity != nil {
+			raw.exploitability = string(*d.ExploitCodeMaturity)
+		}
+	case len(metrics.CvssMetricV30) > 0:
+		d := metrics.CvssMetricV30[0].CvssData
+		raw = rawCVSS{
+			severity: string(d.BaseSeverity), attackVector: string(d.AttackVector),
+			complexity: string(d.AttackComplexity), privilegesRequired: string(d.PrivilegesRequired),
+			userInteraction: string(d.UserInteraction), scope: string(d.Scope),
+			confidentiality: string(d.ConfidentialityImpact), integrity: string(d.IntegrityImpact),
+			availability: string(d.AvailabilityImpact),
+		}
+		if d.ExploitCodeMaturity != nil {
+			raw.exploitability = string(*d.ExploitCodeMaturity)
+		}
+	case len(metrics.CvssMetricV2) > 0:
+		// The v2 severity is derived from the score, never unmapped
+		d := metrics.CvssMetricV2[0].CvssData
+		raw = rawCVSS{
+			attackVector: string(d.AccessVector), complexity: string(d.AccessComplexity),
+			confidentiality: string(d.ConfidentialityImpact), integrity: string(d.IntegrityImpact),
+			availability: string(d.AvailabilityImpact),
+		}
+		if d.Exploitability != nil {
+			raw.exploitability = string(*d.Exploitability)
+		}
+	}
+	return raw
+}
+
+// fallbackUnmapped replaces the Unknown enums of vuln whose NVD value is set
+// but not covered by the common enums with the nearest enum value, keeping
+// the NVD value in RawMetrics and counting it so new upstream values are
+// noticed.
+func fallbackUnmapped(vuln *results.Vulnerability, metrics *schema.Metrics) {
+	raw := rawMetrics(metrics)
+
+	if unmapped(vuln, "base_severity", raw.severity, vuln.BaseSeverity == enums.SeverityTypeUnknown) {
+		if vuln.BaseCVSSScore > 0 {
+			vuln.BaseSeverity = tools.MapCVSS(vuln.BaseCVSSScore)
+		} else {
+			vuln.BaseSeverity = nearestEnum(raw.severity, enums.SeverityTypeUnknown,
+				enums.SeverityTypeCritical, enums.SeverityTypeHigh, enums.SeverityTypeMedium,
+				enums.SeverityTypeLow, enums.SeverityTypeNone)
+		}
+	}
+	if unmapped(vuln, "attack_vector", raw.attackVector, vuln.Access == enums.AccessTypeUnknown) {
+		vuln.Access = nearestEnum(raw.attackVector, enums.AccessTypeUnknown,
+			enums.AccessTypeNetwork, enums.AccessTypeAdjacentNetwork, enums.AccessTypeLocal, enums.AccesTypePhysical)
+	}
+	if unmapped(vuln, "attack_complexity", raw.complexity, vuln.Complexity == enums.ComplexityTypeUnknown) {
+		vuln.Complexity = nearestEnum(raw.complexity, enums.ComplexityTypeUnknown,
+			enums.ComplexityTypeLow, enums.ComplexityTypeMedium, enums.ComplexityTypeHigh)
+	}
+	if unmapped(vuln, "privileges_required", raw.privilegesRequired, vuln.PrivilegesRequired == enums.PrivilegesRequiredUnknown) {
+		vuln.PrivilegesRequired = nearestEnum(raw.privilegesRequired, enums.PrivilegesRequiredUnknown,
+			enums.PrivilegesRequiredNone, enums.PrivilegesRequiredLow, enums.PrivilegesRequiredHigh)
+	}
+	if unmapped(vuln, "user_interaction", raw.userInteraction, vuln.UserInteraction == results.UserInteractionUnknown) {
+		vuln.UserInteraction = nearestEnum(raw.userInteraction, results.UserInteractionUnknown,
+			results.UserInteractionNone, results.UserInteractionRequired)
+	}
+	if unmapped(vuln, "scope", raw.scope, vuln.Scope == results.ScopeTypeUnknown) {
+		vuln.Scope = nearestEnum(raw.scope, results.ScopeTypeUnknown,
+			results.ScopeTypeUnchanged, results.ScopeTypeChanged)
+	}
+	impacts := []enums.ImpactType{enums.ImpactTypeHigh, enums.ImpactTypeLow, enums.ImpactTypeNone}
+	if unmapped(vuln, "confidentiality_impact", raw.confidentiality, vuln.ConfidentialityImpact == enums.ImpactTypeUnknown) {
+		vuln.ConfidentialityImpact = nearestEnum(raw.confidentiality, enums.ImpactTypeUnknown, impacts...)
+	}
+	if unmapped(vuln, "integrity_impact", raw.integrity, vuln.IntegrityImpact == enums.ImpactTypeUnknown) {
+		vuln.IntegrityImpact = nearestEnum(raw.integrity, enums.ImpactTypeUnknown, impacts...)
+	}
+	if unmapped(vuln, "availability_impact", raw.availability, vuln.AvailabilityImpact == enums.ImpactTypeUnknown) {
+		vuln.AvailabilityImpact = nearestEnum(raw.availability, enums.ImpactTypeUnknown, impacts...)
+	}
+	if unmapped(vuln, "exploitability", raw.exploitability, vuln.Exploit.Exploitability == enums.ExploitabilityTypeUnknown) {
+		vuln.Exploit.Exploitability = nearestEnum(raw.exploitability, enums.ExploitabilityTypeUnknown,
+			enums.ExploitabilityTypeUnproven, enums.ExploitabilityTypeProofOfConcept, enums.ExploitabilityTypeFunctional,
+			enums.ExploitabilityTypeHigh, enums.ExploitabilityTypeUndefined)
+	}
+}
+
+// unmapped reports whether NVD set field to a value the enums don't cover,
+// recording it on vuln and in the metrics when so.
+func unmapped(vuln *results.Vulnerability, field, value string, unknown bool) bool {
+	if value == "" || !unknown {
+		return false
+	}
+	if vuln.RawMetrics == nil {
+		vuln.RawMetrics = make(map[string]string)
+	}
+	vuln.RawMetrics[field] = value
+	metrics.CountUnmapped(field, value)
+	slog.Warn("NVD metric value not covered by the enums, using the nearest one",
+		slog.String("cve_id", vuln.ID),
+		slog.String("field", field),
+		slog.String("value", value))
+	return true
+}
+
+// nearestEnum returns the value of values one of whose names starts with
+// the other, ignoring case and separators, e.g. Adjacent Network for
+// ADJACENT, or unknown when there is none.
+func nearestEnum[T ~string](raw string, unknown T, values ...T) T {
+	key := enumKey(raw)
+	if key == "" {
+		return unknown
+	}
+	for _, v := range values {
+		if k := enumKey(string(v)); strings.HasPrefix(k, key) || strings.HasPrefix(key, k) {
+			return v
+		}
+	}
+	return unknown
+}
+
+func enumKey(s string) string {
+	return strings.Map(func(r rune) rune {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			return -1
+		}
+		return unicode.ToLower(r)
+	}, s)
+}
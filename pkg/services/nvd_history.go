@@ -0,0 +1,56 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/kptm-tools/vulnerability-analysis/nvd/client"
+	"github.com/kptm-tools/vulnerability-analysis/nvd/schema"
+)
+
+// FetchCVEHistory returns the changes of a CVE, oldest first, e.g. to show
+// when NVD changed its score or status.
+func (c *NVDClient) FetchCVEHistory(ctx context.Context, cveID string) (*schema.CveHistoryResponse, error) {
+	cveID = strings.ToUpper(strings.TrimSpace(cveID))
+	if !cveIDPattern.MatchString(cveID) {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidCVEID, cveID)
+	}
+	if c.status.inMaintenance() {
+		return nil, fmt.Errorf("%w: the history of %s needs the live API", c.status.unavailable(), cveID)
+	}
+	resp, err := c.api.HistoryOf(ctx, cveID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch the history of %s: %w", cveID, err)
+	}
+	return resp, nil
+}
+
+// ChangedCVEs returns the time of the last change of every CVE changed
+// between since and until, as told by the CVE Change History API.
+func (c *NVDClient) ChangedCVEs(ctx context.Context, since, until time.Time) (map[string]time.Time, error) {
+	if c.status.inMaintenance() {
+		return nil, fmt.Errorf("%w: change history queries need the live API", c.status.unavailable())
+	}
+	resp, err := c.api.ChangedBetween(ctx, client.Changed(since, until), 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch the CVEs changed since %s: %w", since.Format(time.RFC3339), err)
+	}
+
+	changed := make(map[string]time.Time)
+	for _, item := range resp.CveChanges {
+		created, err := parseNvdDateTime(item.Change.Created)
+		if err != nil {
+			slog.Warn("Ignoring NVD change without a valid creation time",
+				slog.String("cve_id", item.Change.CveID),
+				slog.String("created", item.Change.Created))
+			continue
+		}
+		if created.After(changed[item.Change.CveID]) {
+			changed[item.Change.CveID] = created
+		}
+	}
+	return changed, nil
+}
@@ -0,0 +1,44 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/kptm-tools/vulnerability-analysis/nvd/schema"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_NVDClient_CVEHistory(t *testing.T) {
+	t.Parallel()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/cvehistory/2.0", r.URL.Path, "Expected the history API next to the CVE API")
+		changes := []schema.CveChangeItem{
+			{Change: schema.CveChange{CveID: "CVE-2024-0001", CveChangeID: "a", Created: "2024-05-01T10:00:00.000"}},
+			{Change: schema.CveChange{CveID: "CVE-2024-0001", CveChangeID: "b", Created: "2024-05-02T10:00:00.000"}},
+			{Change: schema.CveChange{CveID: "CVE-2024-0002", CveChangeID: "c", Created: "not a date"}},
+		}
+		if id := r.URL.Query().Get("cveId"); id != "" {
+			changes = changes[:2]
+		}
+		json.NewEncoder(w).Encode(schema.CveHistoryResponse{TotalResults: len(changes), CveChanges: changes})
+	}))
+	defer server.Close()
+	nvd := newTestNVDClient(server.URL + "/cves/2.0")
+
+	history, err := nvd.FetchCVEHistory(context.Background(), " cve-2024-0001")
+	require.NoError(t, err)
+	assert.Len(t, history.CveChanges, 2)
+	_, err = nvd.FetchCVEHistory(context.Background(), "CVE-2024-1")
+	assert.ErrorIs(t, err, ErrInvalidCVEID)
+
+	since := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	changed, err := nvd.ChangedCVEs(context.Background(), since, since.Add(72*time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]time.Time{"CVE-2024-0001": time.Date(2024, 5, 2, 10, 0, 0, 0, time.UTC)}, changed,
+		"Expected the last valid change of each CVE")
+}
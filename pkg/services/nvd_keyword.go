@@ -0,0 +1,173 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Ullaakut/nmap/v2"
+	"github.com/kptm-tools/vulnerability-analysis/nvd/schema"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/results"
+)
+
+// ConfidenceLow flags findings matched by keyword rather than by CPE, which
+// may not affect the detected version.
+const ConfidenceLow = "low"
+
+// keywordFallback searches NVD by vendor and product for the services whose
+// CPEs lack a version, e.g. cpe:/a:dovecot:dovecot.
+type keywordFallback struct {
+	severity string // CVSS v3 severity the results are restricted to, if any
+	limit    int
+}
+
+// WithKeywordFallback enables keyword searches for services reported without
+// a versioned CPE, keeping up to limit of the latest CVEs of the given CVSS v3
+// severity, or of any severity when empty.
+func WithKeywordFallback(severity string, limit int) NmapServiceOption {
+	return func(s *NmapService) {
+		s.keywordFallback = &keywordFallback{severity: strings.ToUpper(severity), limit: limit}
+	}
+}
+
+// fetchByKeyword searches the CVE descriptions for keyword, within the
+// per-CPE deadline, and returns up to limit of the CVEs published last. NVD
+// returns the oldest CVEs first, so every page is fetched before truncating.
+func (c *NVDClient) fetchByKeyword(ctx context.Context, keyword, severity string, limit int) (*schema.NvdAPIResponse, error) {
+	if c.cpeTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.cpeTimeout)
+		defer cancel()
+	}
+
+	query := url.Values{}
+	query.Set("keywordSearch", keyword)
+	if severity != "" {
+		query.Set("cvssV3Severity", severity)
+	}
+	// Known exploited only scans don't fall back to every matching CVE
+	query = NVDFilter{Flags: c.queryFilter().Flags}.Apply(query)
+
+	resp, err := c.fetchAllPages(ctx, query, 0, func() (*schema.NvdAPIResponse, error) {
+		return nil, fmt.Errorf("%w: no offline keyword search for %q", c.status.unavailable(), keyword)
+	})
+	if err != nil {
+		return nil, err
+	}
+	c.suppressRejected(ctx, resp)
+
+	sortNewestFirst(resp.Vulnerabilities)
+	if limit > 0 && len(resp.Vulnerabilities) > limit {
+		slog.Info("NVD keyword search exceeds the result cap, keeping the latest CVEs",
+			slog.String("keyword", keyword),
+			slog.Int("total_results", len(resp.Vulnerabilities)),
+			slog.Int("limit", limit))
+		resp.Vulnerabilities = resp.Vulnerabilities[:limit]
+		resp.ResultsPerPage = limit
+	}
+	return resp, nil
+}
+
+// sortNewestFirst orders vulnerabilities by published date, newest first.
+// Those with an unparsable date come last.
+func sortNewestFirst(vulns []schema.Vulnerability) {
+	published := func(v schema.Vulnerability) time.Time {
+		t, _ := parseNvdDateTime(v.Cve.Published)
+		return t
+	}
+	sort.SliceStable(vulns, func(i, j int) bool {
+		return published(vulns[i]).After(published(vulns[j]))
+	})
+}
+
+// cpeKeyword returns the vendor and product of a CPE 2.2 URI or 2.3 name as
+// search keywords, e.g. "apache http server" for cpe:/a:apache:http_server.
+func cpeKeyword(cpe string) (string, bool) {
+	var parts []string
+	switch {
+	case strings.HasPrefix(cpe, "cpe:/"):
+		parts = strings.Split(strings.TrimPrefix(cpe, "cpe:/"), ":")
+	case strings.HasPrefix(cpe, "cpe:2.3:"):
+		parts = strings.Split(strings.TrimPrefix(cpe, "cpe:2.3:"), ":")
+	default:
+		return "", false
+	}
+	if len(parts) < 3 {
+		return "", false
+	}
+
+	vendor, product := keywordField(parts[1]), keywordField(parts[2])
+	if vendor == "" || product == "" {
+		return "", false
+	}
+	if strings.HasPrefix(product, vendor) {
+		return product, true
+	}
+	return vendor + " " + product, true
+}
+
+func keywordField(field string) string {
+	if field == "*" || field == "-" {
+		return ""
+	}
+	return strings.TrimSpace(strings.ReplaceAll(strings.ToLower(field), "_", " "))
+}
+
+// processKeywordFallback enriches a port without a valid CPE with the CVEs
+// NVD matches by keyword, flagged as low confidence findings.
+func (s *NmapService) processKeywordFallback(ctx context.Context, hostAddress string, port nmap.Port) []results.Vulnerability {
+	if s.keywordFallback == nil {
+		return nil
+	}
+
+	var inputCPE, keyword string
+	for _, cpe := range port.Service.CPEs {
+		if k, ok := cpeKeyword(string(cpe)); ok {
+			inputCPE, keyword = string(cpe), k
+			break
+		}
+	}
+	if keyword == "" {
+		return nil
+	}
+
+	nvdData, err := s.nvd.fetchByKeyword(ctx, keyword, s.keywordFallback.severity, s.keywordFallback.limit)
+	if err != nil {
+		slog.Warn("Failed to search NVD by keyword, returning empty Vulnerabilities",
+			slog.String("service_name", port.Service.Name),
+			slog.Int("port_id", int(port.ID)),
+			slog.String("keyword", keyword),
+			slog.Any("error", err))
+		return nil
+	}
+	slog.Info("Found low confidence vulnerabilities for Service by keyword",
+		slog.Int("n_vulners", len(nvdData.Vulnerabilities)),
+		slog.String("service_name", port.Service.Name),
+		slog.Int("port_id", int(port.ID)),
+		slog.String("keyword", keyword))
+
+	vulns := make([]results.Vulnerability, 0, len(nvdData.Vulnerabilities))
+	for _, nvdVuln := range nvdData.Vulnerabilities {
+		vuln := results.Vulnerability{Exposure: portExposure(hostAddresses(ctx, hostAddress), port)}
+		if err := s.enrichment.enrichVulnerabilityWithNvdData(ctx, &vuln, nvdVuln); err != nil {
+			slog.Error("Failed to enrich vulnerability with nvd data, skipping to next vulnerability",
+				slog.Int("port_id", int(port.ID)),
+				slog.String("keyword", keyword),
+				slog.Any("error", err))
+			continue
+		}
+		applyRiskModel(ctx, hostAddress, &vuln)
+		vuln.Provenance = &results.Provenance{
+			Source:     "nvd-keyword",
+			InputCPE:   inputCPE,
+			Keyword:    keyword,
+			Confidence: ConfidenceLow,
+		}
+		vulns = append(vulns, vuln)
+	}
+	return vulns
+}
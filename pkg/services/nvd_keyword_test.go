@@ -0,0 +1,109 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/Ullaakut/nmap/v2"
+	"github.com/kptm-tools/vulnerability-analysis/nvd/schema"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_cpeKeyword(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		cpe  string
+		want string
+	}{
+		{cpe: "cpe:/a:dovecot:dovecot", want: "dovecot"},
+		{cpe: "cpe:/a:apache:http_server", want: "apache http server"},
+		{cpe: "cpe:/a:Exim:exim_mta", want: "exim mta"},
+		{cpe: "cpe:2.3:a:isc:bind:*:*:*:*:*:*:*:*", want: "isc bind"},
+		{cpe: "cpe:/a:dovecot"},
+		{cpe: "cpe:2.3:a:*:*:*:*:*:*:*:*:*:*"},
+		{cpe: "dovecot"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.cpe, func(t *testing.T) {
+			t.Parallel()
+			got, ok := cpeKeyword(tt.cpe)
+			assert.Equal(t, tt.want != "", ok)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_processPorts_KeywordFallback(t *testing.T) {
+	t.Parallel()
+	var mu sync.Mutex
+	var queries []map[string][]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		queries = append(queries, r.URL.Query())
+		mu.Unlock()
+
+		content, err := os.ReadFile("testdata/nvd_api_success.json")
+		if err != nil {
+			t.Fatalf("Failed to read test data file: %v", err)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(content)
+	}))
+	defer server.Close()
+
+	ports := []nmap.Port{{
+		ID:       143,
+		Protocol: "tcp",
+		Service:  nmap.Service{Name: "imap", CPEs: []nmap.CPE{"cpe:/a:dovecot:dovecot"}},
+	}}
+
+	// Without the fallback, the service isn't looked up
+	s := NewNmapService(newTestNVDClient(server.URL))
+	portData := s.processPorts(context.Background(), "10.0.0.1", ports)
+	assert.Empty(t, portData[0].Vulnerabilities)
+	assert.Empty(t, queries)
+
+	s = NewNmapService(newTestNVDClient(server.URL), WithKeywordFallback("high", 5))
+	portData = s.processPorts(context.Background(), "10.0.0.1", ports)
+	require.NotEmpty(t, portData[0].Vulnerabilities)
+	assert.Empty(t, portData[0].Service.CPE)
+
+	provenance := portData[0].Vulnerabilities[0].Provenance
+	require.NotNil(t, provenance)
+	assert.Equal(t, "nvd-keyword", provenance.Source)
+	assert.Equal(t, "cpe:/a:dovecot:dovecot", provenance.InputCPE)
+	assert.Equal(t, "dovecot", provenance.Keyword)
+	assert.Equal(t, ConfidenceLow, provenance.Confidence)
+
+	require.NotEmpty(t, queries)
+	assert.Equal(t, []string{"dovecot"}, queries[0]["keywordSearch"])
+	assert.Equal(t, []string{"HIGH"}, queries[0]["cvssV3Severity"])
+	assert.Empty(t, queries[0]["resultsPerPage"], "Expected every page to be fetched before truncating")
+}
+
+func Test_NVDClient_fetchByKeyword_Latest(t *testing.T) {
+	t.Parallel()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Oldest first, like NVD
+		var vulns []schema.Vulnerability
+		for _, published := range []string{"2019-03-01T10:00:00.000", "2021-06-01T10:00:00.000", "2024-01-01T10:00:00.000", "not a date"} {
+			vulns = append(vulns, schema.Vulnerability{Cve: schema.CveDetail{ID: "CVE-" + published[:4], Published: published}})
+		}
+		json.NewEncoder(w).Encode(schema.NvdAPIResponse{ResultsPerPage: len(vulns), TotalResults: len(vulns), Vulnerabilities: vulns})
+	}))
+	defer server.Close()
+
+	resp, err := newTestNVDClient(server.URL).fetchByKeyword(context.Background(), "dovecot", "", 2)
+	require.NoError(t, err)
+	require.Len(t, resp.Vulnerabilities, 2)
+	assert.Equal(t, "CVE-2024", resp.Vulnerabilities[0].Cve.ID)
+	assert.Equal(t, "CVE-2021", resp.Vulnerabilities[1].Cve.ID)
+	assert.Equal(t, 2, resp.ResultsPerPage)
+}
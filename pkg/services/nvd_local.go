@@ -0,0 +1,53 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/kptm-tools/vulnerability-analysis/nvd/schema"
+)
+
+// ErrNoLocalSource is returned by CPE lookups served locally without an
+// offline source to serve them.
+var ErrNoLocalSource = errors.New("no local source configured")
+
+// WithLocalLookups serves the CPE lookups of the client from its offline
+// source instead of the live API, so that large fleets can be enriched
+// against a local mirror without a request per CPE. CVE, keyword and date
+// range queries still use the live API.
+func WithLocalLookups() NVDClientOption {
+	return func(c *NVDClient) {
+		c.localLookups = true
+	}
+}
+
+// lookupLocal looks cpe up in the offline source, applying the CVSS filter,
+// the rejected CVE suppression and the per-CPE cap of live lookups.
+func (c *NVDClient) lookupLocal(ctx context.Context, cpe string) (*schema.NvdAPIResponse, error) {
+	if c.offline == nil {
+		return nil, fmt.Errorf("%w for CPE %s", ErrNoLocalSource, cpe)
+	}
+	resp, err := c.offline.LookupCPE(cpe)
+	if err != nil {
+		return nil, fmt.Errorf("local lookup failed for CPE %s: %w", cpe, err)
+	}
+	return c.localResponse(ctx, resp), nil
+}
+
+// localResponse applies to resp, the CVEs of a CPE looked up without the live
+// API, the CVSS filter, the rejected CVE suppression and the per-CPE cap of
+// live lookups.
+func (c *NVDClient) localResponse(ctx context.Context, resp *schema.NvdAPIResponse) *schema.NvdAPIResponse {
+	c.suppressRejected(ctx, resp)
+	if !c.filter.IsZero() {
+		resp = filterResponse(resp, c.filter)
+	}
+	if c.maxCVEsPerCPE > 0 && len(resp.Vulnerabilities) > c.maxCVEsPerCPE {
+		capped := *resp
+		capped.Vulnerabilities = resp.Vulnerabilities[:c.maxCVEsPerCPE]
+		capped.ResultsPerPage = c.maxCVEsPerCPE
+		resp = &capped
+	}
+	return resp
+}
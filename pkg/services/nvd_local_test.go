@@ -0,0 +1,43 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/kptm-tools/vulnerability-analysis/nvd/schema"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_NVDClient_fetchByCPE_LocalLookups(t *testing.T) {
+	t.Parallel()
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	local := &schema.NvdAPIResponse{TotalResults: 3, Vulnerabilities: []schema.Vulnerability{
+		{Cve: schema.CveDetail{ID: "CVE-2024-0001"}},
+		{Cve: schema.CveDetail{ID: "CVE-2024-0002"}},
+		{Cve: schema.CveDetail{ID: "CVE-2024-0003"}},
+	}}
+	nvd := newTestNVDClient(server.URL, WithOfflineSource(stubCPESource{resp: local}), WithLocalLookups(), WithMaxCVEsPerCPE(2))
+
+	resp, err := nvd.fetchByCPE(context.Background(), "cpe:2.3:o:microsoft:windows_10:1607:*:*:*:*:*:*:*")
+	require.NoError(t, err)
+	assert.Len(t, resp.Vulnerabilities, 2, "Expected the per-CPE cap to apply")
+	assert.Zero(t, requests.Load(), "Expected no request to the live API")
+}
+
+func Test_NVDClient_fetchByCPE_LocalLookupsWithoutSource(t *testing.T) {
+	t.Parallel()
+	nvd := newTestNVDClient("http://127.0.0.1:0", WithLocalLookups())
+
+	_, err := nvd.fetchByCPE(context.Background(), "cpe:2.3:o:microsoft:windows_10:1607:*:*:*:*:*:*:*")
+	assert.ErrorIs(t, err, ErrNoLocalSource)
+}
@@ -0,0 +1,138 @@
+package services
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"sync"
+
+	cpeutil "github.com/kptm-tools/vulnerability-analysis/nvd/cpe"
+	"github.com/kptm-tools/vulnerability-analysis/nvd/schema"
+)
+
+// matchCriteriaCache keeps the expansions of the match criteria fetched, which
+// are shared by the CVEs of a product and only change with the dictionary.
+type matchCriteriaCache struct {
+	mu       sync.Mutex
+	criteria map[string]*schema.MatchString
+}
+
+// WithMatchCriteriaExpansion checks that the CVEs of versioned CPEs apply to
+// them, expanding the range-based criteria of their configurations into the
+// CPE names of the dictionary with the Match Criteria API. CVEs none of
+// whose vulnerable criteria cover the CPE are left out of the lookup.
+func WithMatchCriteriaExpansion() NVDClientOption {
+	return func(c *NVDClient) {
+		c.matchCriteria = &matchCriteriaCache{criteria: make(map[string]*schema.MatchString)}
+	}
+}
+
+// WithMatchCriteriaURL points the client at another Match Criteria API. An
+// empty URL keeps the default.
+func WithMatchCriteriaURL(matchCriteriaURL string) NVDClientOption {
+	return func(c *NVDClient) {
+		if matchCriteriaURL != "" {
+			c.api.MatchCriteriaURL = matchCriteriaURL
+		}
+	}
+}
+
+// expandCriteria returns the expansion of the match criteria id, fetched once.
+func (c *NVDClient) expandCriteria(ctx context.Context, id string) (*schema.MatchString, error) {
+	c.matchCriteria.mu.Lock()
+	match, ok := c.matchCriteria.criteria[id]
+	c.matchCriteria.mu.Unlock()
+	if ok {
+		return match, nil
+	}
+
+	match, err := c.api.MatchCriteria(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	c.matchCriteria.mu.Lock()
+	c.matchCriteria.criteria[id] = match
+	c.matchCriteria.mu.Unlock()
+	return match, nil
+}
+
+// dropInapplicable returns a copy of resp without the CVEs whose
+// configurations don't make cpe vulnerable, when match criteria expansion is
+// enabled and cpe has a version.
+func (c *NVDClient) dropInapplicable(ctx context.Context, cpe string, resp *schema.NvdAPIResponse) *schema.NvdAPIResponse {
+	if c.matchCriteria == nil || !cpeutil.HasVersion(cpe) || c.status.inMaintenance() {
+		return resp
+	}
+
+	applicable := *resp
+	applicable.Vulnerabilities = nil
+	for _, vuln := range resp.Vulnerabilities {
+		if c.applies(ctx, vuln.Cve, cpe) {
+			applicable.Vulnerabilities = append(applicable.Vulnerabilities, vuln)
+		}
+	}
+	if dropped := len(resp.Vulnerabilities) - len(applicable.Vulnerabilities); dropped > 0 {
+		slog.Debug("Dropped CVEs whose configurations don't apply to the CPE",
+			slog.String("cpe", cpe),
+			slog.Int("n_dropped", dropped))
+		applicable.TotalResults -= dropped
+		applicable.ResultsPerPage = len(applicable.Vulnerabilities)
+	}
+	return &applicable
+}
+
+// applies reports whether a vulnerable criteria of the configurations of cve
+// covers cpe. CVEs without configurations, awaiting analysis, and criteria
+// which can't be expanded are given the benefit of the doubt.
+func (c *NVDClient) applies(ctx context.Context, cve schema.CveDetail, cpe string) bool {
+	if len(cve.Configurations) == 0 {
+		return true
+	}
+	for _, config := range cve.Configurations {
+		for _, node := range config.Nodes {
+			if node.Negate {
+				continue
+			}
+			for _, match := range node.CpeMatch {
+				if !match.Vulnerable {
+					continue
+				}
+				if !match.Ranged() {
+					if criteriaCovers(match.Criteria, cpe) {
+						return true
+					}
+					continue
+				}
+				expanded, err := c.expandCriteria(ctx, match.MatchCriteriaID)
+				if err != nil {
+					slog.Warn("Failed to expand match criteria, keeping the CVE",
+						slog.String("cve_id", cve.ID),
+						slog.String("match_criteria_id", match.MatchCriteriaID),
+						slog.Any("error", err))
+					return true
+				}
+				if expanded.Covers(cpe) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// criteriaCovers reports whether the components of the criteria, a CPE 2.3
+// match string without a version range, are wildcards or equal to the ones
+// of cpe.
+func criteriaCovers(criteria, cpe string) bool {
+	want := strings.Split(strings.ToLower(criteria), ":")
+	got := strings.Split(strings.ToLower(cpe), ":")
+	if len(want) != len(got) {
+		return false
+	}
+	for i := range want {
+		if want[i] != "*" && want[i] != got[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,80 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/kptm-tools/vulnerability-analysis/nvd/schema"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_criteriaCovers(t *testing.T) {
+	t.Parallel()
+	cpe := "cpe:2.3:a:openbsd:openssh:8.2:p1:*:*:*:*:*:*"
+	assert.True(t, criteriaCovers("cpe:2.3:a:openbsd:openssh:8.2:p1:*:*:*:*:*:*", cpe))
+	assert.True(t, criteriaCovers("cpe:2.3:a:OpenBSD:openssh:*:*:*:*:*:*:*:*", cpe))
+	assert.False(t, criteriaCovers("cpe:2.3:a:openbsd:openssh:8.3:*:*:*:*:*:*:*", cpe))
+	assert.False(t, criteriaCovers("cpe:2.3:o:linux:linux_kernel:*:*:*:*:*:*:*:*", cpe))
+}
+
+func Test_NVDClient_fetchByCPE_MatchCriteriaExpansion(t *testing.T) {
+	t.Parallel()
+	end := "8.3"
+	ranged := func(id string) schema.CpeMatch {
+		return schema.CpeMatch{Vulnerable: true, Criteria: "cpe:2.3:a:openbsd:openssh:*:*:*:*:*:*:*:*", MatchCriteriaID: id, VersionEndExcluding: &end}
+	}
+	vuln := func(id string, matches ...schema.CpeMatch) schema.Vulnerability {
+		cve := schema.CveDetail{ID: id, Published: "2024-01-01T00:00:00.000", LastModified: "2024-01-01T00:00:00.000"}
+		if len(matches) > 0 {
+			cve.Configurations = []schema.Configuration{{Nodes: []schema.Node{{Operator: "OR", CpeMatch: matches}}}}
+		}
+		return schema.Vulnerability{Cve: cve}
+	}
+	vulns := []schema.Vulnerability{
+		vuln("CVE-2024-0001", ranged("RANGE-IN")),
+		vuln("CVE-2024-0002", ranged("RANGE-OUT")),
+		vuln("CVE-2024-0003", schema.CpeMatch{Vulnerable: true, Criteria: "cpe:2.3:a:openbsd:openssh:8.2:p1:*:*:*:*:*:*"}),
+		vuln("CVE-2024-0004", schema.CpeMatch{Vulnerable: false, Criteria: "cpe:2.3:a:openbsd:openssh:8.2:p1:*:*:*:*:*:*"}),
+		vuln("CVE-2024-0005"),
+		vuln("CVE-2024-0006", ranged("RANGE-IN")),
+	}
+
+	var expansions atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/cpematch/2.0") {
+			expansions.Add(1)
+			id := r.URL.Query().Get("matchCriteriaId")
+			match := schema.MatchString{MatchCriteriaID: id, Matches: []schema.CpeNameRef{{CpeName: "cpe:2.3:a:openbsd:openssh:8.1:*:*:*:*:*:*:*"}}}
+			if id == "RANGE-IN" {
+				match.Matches = append(match.Matches, schema.CpeNameRef{CpeName: "cpe:2.3:a:openbsd:openssh:8.2:p1:*:*:*:*:*:*"})
+			}
+			json.NewEncoder(w).Encode(schema.MatchCriteriaResponse{TotalResults: 1, ResultsPerPage: 1, MatchStrings: []schema.MatchStringItem{{MatchString: match}}})
+			return
+		}
+		json.NewEncoder(w).Encode(schema.NvdAPIResponse{TotalResults: len(vulns), ResultsPerPage: len(vulns), Vulnerabilities: vulns})
+	}))
+	defer server.Close()
+
+	c := newTestNVDClient(server.URL+"/rest/json/cves/2.0", WithMatchCriteriaExpansion())
+	resp, err := c.fetchByCPE(context.Background(), "cpe:2.3:a:openbsd:openssh:8.2:p1:*:*:*:*:*:*")
+	require.NoError(t, err)
+
+	var ids []string
+	for _, v := range resp.Vulnerabilities {
+		ids = append(ids, v.Cve.ID)
+	}
+	assert.Equal(t, []string{"CVE-2024-0001", "CVE-2024-0003", "CVE-2024-0005", "CVE-2024-0006"}, ids)
+	assert.Equal(t, 4, resp.TotalResults)
+	assert.EqualValues(t, 2, expansions.Load(), "Expected each criteria to be expanded once")
+
+	// Versionless CPEs can't be covered by a range and are kept as before
+	resp, err = c.fetchByCPE(context.Background(), "cpe:2.3:a:openbsd:openssh:*:*:*:*:*:*:*:*")
+	require.NoError(t, err)
+	assert.Len(t, resp.Vulnerabilities, len(vulns))
+}
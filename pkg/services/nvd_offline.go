@@ -0,0 +1,17 @@
+package services
+
+import "time"
+
+// WithOfflineMode keeps the client off the live API for air-gapped
+// deployments: CPE and CVE lookups are served by the offline source, e.g. a
+// mirror synced elsewhere and loaded from disk, with the output of online
+// lookups. The lookups only the live API answers, such as keyword searches
+// or CPE resolution, fail with ErrNVDOffline and their stages are skipped.
+func WithOfflineMode() NVDClientOption {
+	return func(c *NVDClient) {
+		c.status.mu.Lock()
+		defer c.status.mu.Unlock()
+		c.status.status = NVDStatusOffline
+		c.status.since = time.Now().UTC()
+	}
+}
@@ -0,0 +1,90 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/kptm-tools/vulnerability-analysis/nvd/schema"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/mirror"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNVDClient_OfflineMode(t *testing.T) {
+	t.Parallel()
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	store := mirror.NewStore()
+	store.Put(schema.Vulnerability{Cve: schema.CveDetail{
+		ID:           "CVE-2021-41773",
+		LastModified: "2024-01-01T00:00:00.000",
+		Configurations: []schema.Configuration{{Nodes: []schema.Node{{Operator: "OR", CpeMatch: []schema.CpeMatch{{
+			Vulnerable: true,
+			Criteria:   "cpe:2.3:a:apache:http_server:2.4.49:*:*:*:*:*:*:*",
+		}}}}}},
+	}})
+	nvd := newTestNVDClient(server.URL, WithOfflineSource(store), WithOfflineMode())
+	nvd.StartStatusMonitor(context.Background(), time.Millisecond, 1, nil)
+	nvd.status.requestProbe()
+
+	resp, err := nvd.fetchByCPE(context.Background(), "cpe:2.3:a:apache:http_server:2.4.49:*:*:*:*:*:*:*")
+	require.NoError(t, err)
+	assert.Len(t, resp.Vulnerabilities, 1)
+
+	resp, err = nvd.FetchByCVEID(context.Background(), "CVE-2021-41773")
+	require.NoError(t, err)
+	assert.Len(t, resp.Vulnerabilities, 1)
+
+	_, err = nvd.fetchByKeyword(context.Background(), "apache http_server", "", 10)
+	assert.ErrorIs(t, err, ErrNVDOffline)
+	_, err = nvd.FetchCVEHistory(context.Background(), "CVE-2021-41773")
+	assert.ErrorIs(t, err, ErrNVDOffline)
+
+	time.Sleep(10 * time.Millisecond)
+	assert.Equal(t, NVDStatusOffline, nvd.Status())
+	assert.Zero(t, requests.Load(), "Expected no request to the live API")
+}
+
+func Test_nvdStatusMonitor_OfflineIgnoresProbes(t *testing.T) {
+	t.Parallel()
+	nvd := NewNVDClient(WithOfflineMode())
+	nvd.status.recordProbe(nil)
+	assert.Equal(t, NVDStatusOffline, nvd.Status())
+}
+
+func TestNVDClient_KnowledgeCacheServesCPEsWhileNVDIsDown(t *testing.T) {
+	t.Parallel()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	store := mirror.NewStore()
+	store.Put(schema.Vulnerability{Cve: schema.CveDetail{
+		ID:           "CVE-2021-41773",
+		LastModified: "2024-01-01T00:00:00.000",
+		Configurations: []schema.Configuration{{Nodes: []schema.Node{{Operator: "OR", CpeMatch: []schema.CpeMatch{{
+			Vulnerable: true,
+			Criteria:   "cpe:2.3:a:apache:http_server:2.4.49:*:*:*:*:*:*:*",
+		}}}}}},
+	}})
+	nvd := newTestNVDClient(server.URL, WithKnowledgeCache(store), WithRetryPolicy(testRetryPolicy))
+
+	resp, err := nvd.fetchByCPE(context.Background(), "cpe:2.3:a:apache:http_server:2.4.49:*:*:*:*:*:*:*")
+	require.NoError(t, err)
+	require.Len(t, resp.Vulnerabilities, 1)
+	assert.Equal(t, "CVE-2021-41773", resp.Vulnerabilities[0].Cve.ID)
+
+	// CPEs the cache doesn't know still fail
+	_, err = nvd.fetchByCPE(context.Background(), "cpe:2.3:a:nginx:nginx:1.25.0:*:*:*:*:*:*:*")
+	assert.Error(t, err)
+}
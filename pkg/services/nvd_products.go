@@ -0,0 +1,153 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strings"
+
+	"github.com/Ullaakut/nmap/v2"
+	cpeutil "github.com/kptm-tools/vulnerability-analysis/nvd/cpe"
+	"github.com/kptm-tools/vulnerability-analysis/nvd/schema"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/results"
+)
+
+// maxResolvedProducts bounds the dictionary entries fetched to resolve the
+// CPE of a single service.
+const maxResolvedProducts = 20
+
+// WithCPEResolution resolves the services left without a valid CPE, whose
+// nmap CPE lacks a version or which only have a product name and version,
+// to the canonical CPE name of the NVD dictionary with the Products API
+// before their CVEs are looked up.
+func WithCPEResolution() NmapServiceOption {
+	return func(s *NmapService) {
+		s.cpeResolution = true
+	}
+}
+
+// resolveProduct returns the canonical CPE name of version among the
+// dictionary entries matching query, within the per-CPE deadline. Entries
+// replaced by another are resolved to it, and entries without an update,
+// e.g. not rc1, are preferred.
+func (c *NVDClient) resolveProduct(ctx context.Context, query url.Values, version string) (string, error) {
+	if c.status.inMaintenance() {
+		return "", fmt.Errorf("%w: no offline CPE resolution", c.status.unavailable())
+	}
+	if c.cpeTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.cpeTimeout)
+		defer cancel()
+	}
+
+	resp, err := c.api.FetchAllProducts(ctx, query, maxResolvedProducts)
+	if err != nil {
+		return "", err
+	}
+	if name := pickProduct(resp.Products, version); name != "" {
+		return name, nil
+	}
+	return "", fmt.Errorf("no dictionary entry of version %q among %d products", version, len(resp.Products))
+}
+
+// pickProduct returns the canonical name of the first product of version,
+// preferring the ones without an update.
+func pickProduct(products []schema.CpeProduct, version string) string {
+	var fallback string
+	for _, product := range products {
+		name := product.Cpe.CpeName
+		if product.Cpe.Deprecated {
+			if len(product.Cpe.DeprecatedBy) == 0 {
+				continue
+			}
+			name = product.Cpe.DeprecatedBy[0].CpeName
+		}
+		if cpeutil.Validate(name) != nil || !cpeutil.HasVersion(name) {
+			continue
+		}
+		fields := strings.Split(name, ":")
+		if !strings.EqualFold(fields[5], version) {
+			continue
+		}
+		if fields[6] == "*" || fields[6] == "-" {
+			return name
+		}
+		if fallback == "" {
+			fallback = name
+		}
+	}
+	return fallback
+}
+
+// resolveCPE returns the CPE the Products API resolves the service of port
+// to, with its provenance, or an empty CPE. The versionless CPEs of the
+// service are completed with its version and matched first, then its product
+// name and version are searched by keyword.
+func (s *NmapService) resolveCPE(ctx context.Context, port nmap.Port) (string, results.Provenance) {
+	version, _, _ := strings.Cut(strings.TrimSpace(port.Service.Version), " ")
+	if version == "" {
+		return "", results.Provenance{}
+	}
+
+	type attempt struct {
+		inputCPE string
+		query    url.Values
+	}
+	var attempts []attempt
+	for _, cpe := range port.Service.CPEs {
+		if part, vendor, product, ok := cpeFields(string(cpe)); ok {
+			matchString := strings.Join([]string{"cpe", "2.3", part, vendor, product, version}, ":")
+			attempts = append(attempts, attempt{inputCPE: string(cpe), query: url.Values{"cpeMatchString": {matchString}}})
+		}
+	}
+	if product := strings.TrimSpace(port.Service.Product); product != "" {
+		attempts = append(attempts, attempt{query: url.Values{"keywordSearch": {product + " " + version}}})
+	}
+
+	for _, a := range attempts {
+		name, err := s.nvd.resolveProduct(ctx, a.query, version)
+		if err != nil {
+			slog.Debug("Could not resolve CPE with the NVD Products API",
+				slog.Int("port_id", int(port.ID)),
+				slog.String("service_name", port.Service.Name),
+				slog.String("query", a.query.Encode()),
+				slog.Any("error", err))
+			continue
+		}
+
+		slog.Debug("Resolved CPE with the NVD Products API",
+			slog.Int("port_id", int(port.ID)),
+			slog.String("service_name", port.Service.Name),
+			slog.String("query", a.query.Encode()),
+			slog.String("cpe", name))
+		provenance := s.nvdProvenance(a.inputCPE, name, nil)
+		provenance.Resolution = a.query.Encode()
+		return name, provenance
+	}
+	return "", results.Provenance{}
+}
+
+// cpeFields returns the part, lowercased vendor and product of a CPE 2.2 URI
+// or 2.3 name, e.g. a, dovecot and dovecot for cpe:/a:dovecot:dovecot.
+func cpeFields(cpe string) (part, vendor, product string, ok bool) {
+	var fields []string
+	switch {
+	case strings.HasPrefix(cpe, "cpe:/"):
+		fields = strings.Split(strings.TrimPrefix(cpe, "cpe:/"), ":")
+	case strings.HasPrefix(cpe, "cpe:2.3:"):
+		fields = strings.Split(strings.TrimPrefix(cpe, "cpe:2.3:"), ":")
+	default:
+		return "", "", "", false
+	}
+	if len(fields) < 3 {
+		return "", "", "", false
+	}
+	part, vendor, product = fields[0], strings.ToLower(fields[1]), strings.ToLower(fields[2])
+	for _, f := range []string{part, vendor, product} {
+		if f == "" || f == "*" || f == "-" {
+			return "", "", "", false
+		}
+	}
+	return part, vendor, product, true
+}
@@ -0,0 +1,128 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/Ullaakut/nmap/v2"
+	"github.com/kptm-tools/vulnerability-analysis/nvd/schema"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_pickProduct(t *testing.T) {
+	t.Parallel()
+	product := func(name string, deprecatedBy ...string) schema.CpeProduct {
+		item := schema.CpeItem{CpeName: name, Deprecated: len(deprecatedBy) > 0}
+		for _, by := range deprecatedBy {
+			item.DeprecatedBy = append(item.DeprecatedBy, schema.CpeNameRef{CpeName: by})
+		}
+		return schema.CpeProduct{Cpe: item}
+	}
+
+	tests := []struct {
+		name     string
+		products []schema.CpeProduct
+		version  string
+		want     string
+	}{
+		{
+			name: "Prefers the release",
+			products: []schema.CpeProduct{
+				product("cpe:2.3:a:dovecot:dovecot:2.3.16:rc1:*:*:*:*:*:*"),
+				product("cpe:2.3:a:dovecot:dovecot:2.3.16:*:*:*:*:*:*:*"),
+			},
+			version: "2.3.16",
+			want:    "cpe:2.3:a:dovecot:dovecot:2.3.16:*:*:*:*:*:*:*",
+		},
+		{
+			name:     "Falls back to an update",
+			products: []schema.CpeProduct{product("cpe:2.3:a:dovecot:dovecot:2.3.16:rc1:*:*:*:*:*:*")},
+			version:  "2.3.16",
+			want:     "cpe:2.3:a:dovecot:dovecot:2.3.16:rc1:*:*:*:*:*:*",
+		},
+		{
+			name: "Follows deprecations",
+			products: []schema.CpeProduct{
+				product("cpe:2.3:a:openbsd:openssh:8.2p1:*:*:*:*:*:*:*", "cpe:2.3:a:openbsd:openssh:8.2:p1:*:*:*:*:*:*"),
+				product("cpe:2.3:a:openbsd:openssh:8.2p1:*:*:*:*:*:*:*"),
+			},
+			version: "8.2p1",
+			want:    "cpe:2.3:a:openbsd:openssh:8.2p1:*:*:*:*:*:*:*",
+		},
+		{
+			name:     "Skips other versions",
+			products: []schema.CpeProduct{product("cpe:2.3:a:openbsd:openssh:8.3p1:*:*:*:*:*:*:*")},
+			version:  "8.2p1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, tt.want, pickProduct(tt.products, tt.version))
+		})
+	}
+}
+
+func Test_processPorts_CPEResolution(t *testing.T) {
+	t.Parallel()
+	var mu sync.Mutex
+	var productQueries, cveQueries []map[string][]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+
+		if strings.HasSuffix(r.URL.Path, "/cpes/2.0") {
+			productQueries = append(productQueries, r.URL.Query())
+			var products []schema.CpeProduct
+			if r.URL.Query().Get("keywordSearch") == "OpenSSH 8.2p1" {
+				products = append(products, schema.CpeProduct{Cpe: schema.CpeItem{CpeName: "cpe:2.3:a:openbsd:openssh:8.2p1:*:*:*:*:*:*:*"}})
+			}
+			json.NewEncoder(w).Encode(schema.CpeProductsResponse{TotalResults: len(products), Products: products})
+			return
+		}
+
+		cveQueries = append(cveQueries, r.URL.Query())
+		content, err := os.ReadFile("testdata/nvd_api_success.json")
+		if err != nil {
+			t.Errorf("Failed to read test data file: %v", err)
+			return
+		}
+		w.Write(content)
+	}))
+	defer server.Close()
+
+	ports := []nmap.Port{{
+		ID:       22,
+		Protocol: "tcp",
+		Service: nmap.Service{
+			Name:    "ssh",
+			Product: "OpenSSH",
+			Version: "8.2p1 Ubuntu 4ubuntu0.5",
+			CPEs:    []nmap.CPE{"cpe:/a:openbsd:openssh"},
+		},
+	}}
+
+	s := NewNmapService(newTestNVDClient(server.URL+"/rest/json/cves/2.0"), WithCPEResolution())
+	portData := s.processPorts(context.Background(), "10.0.0.1", ports)
+	assert.Equal(t, "cpe:2.3:a:openbsd:openssh:8.2p1:*:*:*:*:*:*:*", portData[0].Service.CPE)
+	require.NotEmpty(t, portData[0].Vulnerabilities)
+
+	provenance := portData[0].Vulnerabilities[0].Provenance
+	require.NotNil(t, provenance)
+	assert.Equal(t, "nvd", provenance.Source)
+	assert.Equal(t, "keywordSearch=OpenSSH+8.2p1", provenance.Resolution)
+
+	require.Len(t, productQueries, 2, "Expected the CPE to be matched before the keyword search")
+	assert.Equal(t, []string{"cpe:2.3:a:openbsd:openssh:8.2p1"}, productQueries[0]["cpeMatchString"])
+	require.NotEmpty(t, cveQueries)
+	assert.Equal(t, []string{"cpe:2.3:a:openbsd:openssh:8.2p1:*:*:*:*:*:*:*"}, cveQueries[0]["cpeName"])
+}
@@ -0,0 +1,259 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kptm-tools/vulnerability-analysis/nvd/client"
+	"github.com/kptm-tools/vulnerability-analysis/nvd/schema"
+)
+
+const (
+	// nvdMaxDateRange is the longest date range the CVE API accepts.
+	nvdMaxDateRange = client.MaxDateRange
+	// nvdMaxResultsPerPage is the largest page the CVE API returns.
+	nvdMaxResultsPerPage = client.MaxResultsPerPage
+	// nvdDateFormat is the ISO-8601 format expected by the date parameters.
+	nvdDateFormat = client.DateFormat
+)
+
+var ErrInvalidDateRange = client.ErrInvalidDateRange
+
+// ErrDateRangeTruncated is returned when a date range window can't be split
+// any further and still holds more results than the pagination cap.
+var ErrDateRangeTruncated = errors.New("NVD date range holds more results than can be paged through")
+
+// fetchAllPages follows startIndex until every result of query has been
+// fetched, or until the client maxOffset or limit is reached, and merges the pages
+// into a single response. A limit of zero fetches every result. TotalResults
+// is kept from NVD, so callers can tell when the merged response is
+// truncated.
+func (c *NVDClient) fetchAllPages(ctx context.Context, query url.Values, limit int, offline func() (*schema.NvdAPIResponse, error)) (*schema.NvdAPIResponse, error) {
+	if limit > 0 && limit < nvdMaxResultsPerPage {
+		query = cloneQuery(query)
+		query.Set("resultsPerPage", strconv.Itoa(limit))
+	}
+
+	merged, err := c.fetch(ctx, query, offline)
+	if err != nil {
+		return nil, err
+	}
+
+	for next := merged.StartIndex + len(merged.Vulnerabilities); next < merged.TotalResults; {
+		if limit > 0 && len(merged.Vulnerabilities) >= limit {
+			break
+		}
+		if next >= c.maxOffset {
+			slog.Warn("NVD query exceeds the pagination cap, results are truncated",
+				slog.String("query", query.Encode()),
+				slog.Int("total_results", merged.TotalResults),
+				slog.Int("max_offset", c.maxOffset))
+			break
+		}
+		if c.requestInterval > 0 {
+			if err := sleepContext(ctx, c.requestInterval); err != nil {
+				return nil, err
+			}
+		}
+
+		pageQuery := cloneQuery(query)
+		pageQuery.Set("startIndex", strconv.Itoa(next))
+		page, err := c.fetch(ctx, pageQuery, offline)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch NVD page at index %d: %w", next, err)
+		}
+		if len(page.Vulnerabilities) == 0 {
+			break
+		}
+		// A page that doesn't start at the requested index is a complete
+		// answer, e.g. from the offline source once NVD went into maintenance
+		if page.StartIndex != next {
+			merged = page
+			break
+		}
+
+		merged.Vulnerabilities = append(merged.Vulnerabilities, page.Vulnerabilities...)
+		next += len(page.Vulnerabilities)
+	}
+
+	if limit > 0 && len(merged.Vulnerabilities) > limit {
+		merged.Vulnerabilities = merged.Vulnerabilities[:limit]
+	}
+	if limit > 0 && merged.TotalResults > limit {
+		slog.Info("NVD query exceeds the result cap, results are truncated",
+			slog.String("query", query.Encode()),
+			slog.Int("total_results", merged.TotalResults),
+			slog.Int("limit", limit))
+	}
+
+	merged.StartIndex = 0
+	merged.ResultsPerPage = len(merged.Vulnerabilities)
+	return merged, nil
+}
+
+// FetchModifiedRange returns every CVE last modified between start and end.
+func (c *NVDClient) FetchModifiedRange(ctx context.Context, start, end time.Time) (*schema.NvdAPIResponse, error) {
+	return c.fetchDateRange(ctx, "lastModStartDate", "lastModEndDate", start, end)
+}
+
+// FetchPublishedRange returns every CVE published between start and end.
+func (c *NVDClient) FetchPublishedRange(ctx context.Context, start, end time.Time) (*schema.NvdAPIResponse, error) {
+	return c.fetchDateRange(ctx, "pubStartDate", "pubEndDate", start, end)
+}
+
+// NVDVersionRange bounds the versions of a FetchVersionRange query.
+type NVDVersionRange = client.VersionRange
+
+// FetchVersionRange returns the CVEs affecting the products matching the CPE
+// match string within r, e.g. every CVE of cpe:2.3:a:openbsd:openssh from 8.0
+// up to 8.4, up to limit when positive. Unlike fetchByCPE, it finds the CVEs
+// whose configurations are version ranges rather than exact CPEs.
+func (c *NVDClient) FetchVersionRange(ctx context.Context, matchString string, r NVDVersionRange, limit int) (*schema.NvdAPIResponse, error) {
+	query, err := r.Query(matchString)
+	if err != nil {
+		return nil, err
+	}
+	return c.fetchAllPages(ctx, query, limit, func() (*schema.NvdAPIResponse, error) {
+		return nil, fmt.Errorf("%w: no offline version range search for %q", c.status.unavailable(), matchString)
+	})
+}
+
+// FetchByCWE returns, per CPE, the CVEs of cpes assigned the weakness cweID,
+// e.g. CWE-89 or 89, for hunting a weakness class across the CPEs of the
+// scanned hosts. The client's filter still applies and CPE 2.2 URIs, as
+// reported by nmap, are standardized. CPEs without such CVEs are left out.
+func (c *NVDClient) FetchByCWE(ctx context.Context, cweID string, cpes []string) (map[string]*schema.NvdAPIResponse, error) {
+	filter := c.queryFilter()
+	var err error
+	if filter.CWEID, err = client.NormalizeCWEID(cweID); err != nil {
+		return nil, err
+	}
+	if filter.CWEID == "" {
+		return nil, fmt.Errorf("%w: a CWE ID is required", client.ErrInvalidFilter)
+	}
+
+	found := make(map[string]*schema.NvdAPIResponse)
+	seen := make(map[string]bool)
+	for _, cpe := range cpes {
+		if strings.HasPrefix(cpe, "cpe:/") {
+			if cpe, err = standardizeCPE(cpe); err != nil {
+				return nil, err
+			}
+		}
+		if err := isValidCPE(cpe); err != nil {
+			return nil, err
+		}
+		if seen[cpe] {
+			continue
+		}
+		seen[cpe] = true
+
+		resp, err := c.fetchCPE(ctx, cpe, c.cpeQuery(cpe), filter)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch the %s CVEs of %s: %w", filter.CWEID, cpe, err)
+		}
+		if len(resp.Vulnerabilities) > 0 {
+			found[cpe] = resp
+		}
+	}
+	return found, nil
+}
+
+// FetchTotalCVEs returns the number of CVE records published by NVD.
+func (c *NVDClient) FetchTotalCVEs(ctx context.Context) (int, error) {
+	query := url.Values{}
+	query.Set("resultsPerPage", "1")
+
+	resp, err := c.fetch(ctx, query, func() (*schema.NvdAPIResponse, error) {
+		return nil, fmt.Errorf("%w: the CVE count needs the live API", c.status.unavailable())
+	})
+	if err != nil {
+		return 0, err
+	}
+	return resp.TotalResults, nil
+}
+
+// fetchDateRange queries a date range of any length. The range is split in
+// windows no longer than nvdMaxDateRange, and windows holding more results
+// than the pagination cap are halved, so callers get one merged result set.
+// It fails with ErrDateRangeTruncated rather than return a partial set when a
+// window of minDateRange still holds too many results.
+func (c *NVDClient) fetchDateRange(ctx context.Context, startParam, endParam string, start, end time.Time) (*schema.NvdAPIResponse, error) {
+	if !end.After(start) {
+		return nil, fmt.Errorf("%w: %s is not after %s", ErrInvalidDateRange, end, start)
+	}
+
+	merged := &schema.NvdAPIResponse{Format: "NVD_CVE", Version: "2.0"}
+	seen := make(map[string]bool)
+
+	windows := splitDateRange(start.UTC(), end.UTC(), nvdMaxDateRange)
+	for len(windows) > 0 {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		window := windows[0]
+		windows = windows[1:]
+
+		query := url.Values{}
+		query.Set(startParam, window[0].Format(nvdDateFormat))
+		query.Set(endParam, window[1].Format(nvdDateFormat))
+		query.Set("resultsPerPage", strconv.Itoa(nvdMaxResultsPerPage))
+
+		resp, err := c.fetchAllPages(ctx, query, 0, func() (*schema.NvdAPIResponse, error) {
+			return nil, fmt.Errorf("%w: date range queries need the live API", c.status.unavailable())
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		if resp.TotalResults > len(resp.Vulnerabilities) {
+			if window[1].Sub(window[0]) <= c.minDateRange {
+				return nil, fmt.Errorf("%w: %d of %d results between %s and %s",
+					ErrDateRangeTruncated, len(resp.Vulnerabilities), resp.TotalResults,
+					window[0].Format(nvdDateFormat), window[1].Format(nvdDateFormat))
+			}
+			windows = append(splitDateRange(window[0], window[1], window[1].Sub(window[0])/2), windows...)
+			continue
+		}
+
+		for _, v := range resp.Vulnerabilities {
+			// Window bounds are inclusive, so records on a boundary come twice
+			if !seen[v.Cve.ID] {
+				seen[v.Cve.ID] = true
+				merged.Vulnerabilities = append(merged.Vulnerabilities, v)
+			}
+		}
+		merged.Timestamp = resp.Timestamp
+	}
+
+	merged.ResultsPerPage = len(merged.Vulnerabilities)
+	merged.TotalResults = len(merged.Vulnerabilities)
+	return merged, nil
+}
+
+// splitDateRange splits [start, end] into consecutive windows of at most size.
+func splitDateRange(start, end time.Time, size time.Duration) [][2]time.Time {
+	var windows [][2]time.Time
+	for from := start; from.Before(end); from = from.Add(size) {
+		to := from.Add(size)
+		if to.After(end) {
+			to = end
+		}
+		windows = append(windows, [2]time.Time{from, to})
+	}
+	return windows
+}
+
+func cloneQuery(query url.Values) url.Values {
+	clone := make(url.Values, len(query))
+	for k, v := range query {
+		clone[k] = append([]string(nil), v...)
+	}
+	return clone
+}
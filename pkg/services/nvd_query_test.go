@@ -0,0 +1,246 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kptm-tools/vulnerability-analysis/nvd/client"
+	"github.com/kptm-tools/vulnerability-analysis/nvd/schema"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newPagedNVDServer serves one CVE per hour between the requested dates,
+// paged by startIndex and resultsPerPage like the CVE API.
+func newPagedNVDServer(t *testing.T, pageSize int, requests *[]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*requests = append(*requests, r.URL.RawQuery)
+		q := r.URL.Query()
+
+		start, err := time.Parse(nvdDateFormat, q.Get("lastModStartDate"))
+		require.NoError(t, err)
+		end, err := time.Parse(nvdDateFormat, q.Get("lastModEndDate"))
+		require.NoError(t, err)
+		if end.Sub(start) > nvdMaxDateRange {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		var all []schema.Vulnerability
+		for ts := start.Truncate(time.Hour); !ts.After(end); ts = ts.Add(time.Hour) {
+			if !ts.Before(start) {
+				all = append(all, schema.Vulnerability{Cve: schema.CveDetail{ID: fmt.Sprintf("CVE-%d", ts.Unix())}})
+			}
+		}
+
+		startIndex, _ := strconv.Atoi(q.Get("startIndex"))
+		if startIndex > len(all) {
+			startIndex = len(all)
+		}
+		stop := min(startIndex+pageSize, len(all))
+
+		json.NewEncoder(w).Encode(schema.NvdAPIResponse{
+			ResultsPerPage:  stop - startIndex,
+			StartIndex:      startIndex,
+			TotalResults:    len(all),
+			Vulnerabilities: all[startIndex:stop],
+		})
+	}))
+}
+
+func Test_NVDClient_fetchDateRange(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name      string
+		days      int
+		pageSize  int
+		maxOffset int
+	}{
+		{"Single window, single page", 3, 1000, 10000},
+		{"Several windows", 300, 5000, 10000},
+		{"Paged windows", 10, 50, 10000},
+		{"Windows over the offset cap are split", 10, 50, 100},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			var requests []string
+			server := newPagedNVDServer(t, tc.pageSize, &requests)
+			defer server.Close()
+
+			start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+			end := start.Add(time.Duration(tc.days) * 24 * time.Hour)
+
+			nvd := newTestNVDClient(server.URL)
+			nvd.maxOffset = tc.maxOffset
+			resp, err := nvd.fetchDateRange(context.Background(), "lastModStartDate", "lastModEndDate", start, end)
+			require.NoError(t, err)
+
+			// One CVE per hour, both bounds included
+			want := tc.days*24 + 1
+			assert.Equal(t, want, resp.TotalResults)
+			assert.Len(t, resp.Vulnerabilities, want)
+			assert.NotEmpty(t, requests)
+		})
+	}
+}
+
+func Test_NVDClient_fetchDateRange_Truncated(t *testing.T) {
+	t.Parallel()
+	var requests []string
+	server := newPagedNVDServer(t, 50, &requests)
+	defer server.Close()
+
+	// 121 CVEs in the smallest window, over the cap of 100
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	nvd := newTestNVDClient(server.URL)
+	nvd.maxOffset = 100
+	nvd.minDateRange = 5 * 24 * time.Hour
+	resp, err := nvd.fetchDateRange(context.Background(), "lastModStartDate", "lastModEndDate", start, start.Add(10*24*time.Hour))
+	assert.ErrorIs(t, err, ErrDateRangeTruncated)
+	assert.Nil(t, resp)
+}
+
+func Test_NVDClient_fetchDateRange_Invalid(t *testing.T) {
+	t.Parallel()
+	now := time.Now()
+	_, err := newTestNVDClient("http://127.0.0.1:0").fetchDateRange(context.Background(), "pubStartDate", "pubEndDate", now, now.Add(-time.Hour))
+	assert.ErrorIs(t, err, ErrInvalidDateRange)
+}
+
+func Test_splitDateRange(t *testing.T) {
+	t.Parallel()
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	windows := splitDateRange(start, start.Add(250*24*time.Hour), nvdMaxDateRange)
+
+	require.Len(t, windows, 3)
+	assert.Equal(t, start, windows[0][0])
+	assert.Equal(t, windows[0][1], windows[1][0])
+	assert.Equal(t, start.Add(250*24*time.Hour), windows[2][1])
+	for _, w := range windows {
+		assert.LessOrEqual(t, w[1].Sub(w[0]), nvdMaxDateRange)
+	}
+}
+
+func Test_NVDClient_fetchByCPE_Pagination(t *testing.T) {
+	t.Parallel()
+	const total = 4500
+	testCases := []struct {
+		name         string
+		limit        int
+		wantCVEs     int
+		wantRequests int
+	}{
+		{"Every page", 0, total, 3},
+		{"Capped mid page", 2500, 2500, 2},
+		{"Capped below a page", 100, 100, 1},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			var pageSizes []string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				q := r.URL.Query()
+				pageSizes = append(pageSizes, q.Get("resultsPerPage"))
+				pageSize := nvdMaxResultsPerPage
+				if n, err := strconv.Atoi(q.Get("resultsPerPage")); err == nil {
+					pageSize = n
+				}
+				startIndex, _ := strconv.Atoi(q.Get("startIndex"))
+				stop := min(startIndex+pageSize, total)
+
+				resp := schema.NvdAPIResponse{ResultsPerPage: stop - startIndex, StartIndex: startIndex, TotalResults: total}
+				for i := startIndex; i < stop; i++ {
+					resp.Vulnerabilities = append(resp.Vulnerabilities, schema.Vulnerability{Cve: schema.CveDetail{ID: fmt.Sprintf("CVE-2024-%d", i)}})
+				}
+				json.NewEncoder(w).Encode(resp)
+			}))
+			defer server.Close()
+
+			nvd := newTestNVDClient(server.URL, WithMaxCVEsPerCPE(tc.limit))
+			resp, err := nvd.fetchByCPE(context.Background(), "cpe:2.3:o:linux:linux_kernel:-:*:*:*:*:*:*:*")
+			require.NoError(t, err)
+
+			assert.Len(t, resp.Vulnerabilities, tc.wantCVEs)
+			assert.Equal(t, total, resp.TotalResults, "Expected TotalResults to reveal the truncation")
+			assert.Equal(t, "CVE-2024-0", resp.Vulnerabilities[0].Cve.ID)
+			assert.Len(t, pageSizes, tc.wantRequests)
+			if tc.limit > 0 && tc.limit < nvdMaxResultsPerPage {
+				assert.Equal(t, strconv.Itoa(tc.limit), pageSizes[0])
+			}
+		})
+	}
+}
+
+func Test_NVDClient_FetchVersionRange(t *testing.T) {
+	t.Parallel()
+	var queries []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		queries = append(queries, r.URL.RawQuery)
+		json.NewEncoder(w).Encode(schema.NvdAPIResponse{
+			ResultsPerPage:  1,
+			TotalResults:    1,
+			Vulnerabilities: []schema.Vulnerability{{Cve: schema.CveDetail{ID: "CVE-2021-41617"}}},
+		})
+	}))
+	defer server.Close()
+
+	nvd := newTestNVDClient(server.URL)
+	resp, err := nvd.FetchVersionRange(context.Background(), "cpe:2.3:a:openbsd:openssh", NVDVersionRange{Start: "8.0", End: "8.4", EndType: "including"}, 0)
+	require.NoError(t, err)
+	require.Len(t, resp.Vulnerabilities, 1)
+	assert.Equal(t, []string{"versionEnd=8.4&versionEndType=including&versionStart=8.0&versionStartType=including&virtualMatchString=cpe%3A2.3%3Aa%3Aopenbsd%3Aopenssh"}, queries)
+
+	_, err = nvd.FetchVersionRange(context.Background(), "cpe:/a:openbsd:openssh", NVDVersionRange{Start: "8.0"}, 0)
+	assert.ErrorIs(t, err, client.ErrInvalidVersionRange)
+	assert.Len(t, queries, 1, "Expected invalid ranges to be rejected before querying NVD")
+}
+
+func Test_NVDClient_FetchByCWE(t *testing.T) {
+	t.Parallel()
+	var mu sync.Mutex
+	var queries []url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		queries = append(queries, r.URL.Query())
+		mu.Unlock()
+		resp := schema.NvdAPIResponse{}
+		if strings.Contains(r.URL.Query().Get("cpeName"), "mysql") {
+			resp.Vulnerabilities = []schema.Vulnerability{{Cve: schema.CveDetail{ID: "CVE-2024-0001"}}}
+		}
+		resp.TotalResults, resp.ResultsPerPage = len(resp.Vulnerabilities), len(resp.Vulnerabilities)
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer server.Close()
+
+	nvd := newTestNVDClient(server.URL)
+	found, err := nvd.FetchByCWE(context.Background(), "89", []string{
+		"cpe:/a:oracle:mysql:8.0.30",
+		"cpe:2.3:a:oracle:mysql:8.0.30:*:*:*:*:*:*:*",
+		"cpe:2.3:a:openbsd:openssh:8.2p1:*:*:*:*:*:*:*",
+	})
+	require.NoError(t, err)
+	assert.Len(t, queries, 2, "Expected each CPE to be queried once")
+	for _, q := range queries {
+		assert.Equal(t, "CWE-89", q.Get("cweId"))
+	}
+	require.Len(t, found, 1)
+	assert.Equal(t, "CVE-2024-0001", found["cpe:2.3:a:oracle:mysql:8.0.30:*:*:*:*:*:*:*"].Vulnerabilities[0].Cve.ID)
+
+	_, err = nvd.FetchByCWE(context.Background(), "SQLi", []string{"cpe:/a:oracle:mysql:8.0.30"})
+	assert.ErrorIs(t, err, client.ErrInvalidFilter)
+	_, err = nvd.FetchByCWE(context.Background(), "", nil)
+	assert.ErrorIs(t, err, client.ErrInvalidFilter)
+}
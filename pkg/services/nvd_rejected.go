@@ -0,0 +1,46 @@
+package services
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+	"sync/atomic"
+
+	"github.com/kptm-tools/vulnerability-analysis/nvd/client"
+	"github.com/kptm-tools/vulnerability-analysis/nvd/schema"
+)
+
+type rejectedCountKey struct{}
+
+// withRejectedCount returns a context counting the rejected CVEs suppressed
+// from the lookups made with it, e.g. for the ports of a host.
+func withRejectedCount(ctx context.Context) (context.Context, *atomic.Int64) {
+	count := &atomic.Int64{}
+	return context.WithValue(ctx, rejectedCountKey{}, count), count
+}
+
+// queryFilter returns the filter of CPE and keyword lookups, with noRejected
+// when rejected CVEs are suppressed.
+func (c *NVDClient) queryFilter() NVDFilter {
+	filter := c.filter
+	if c.noRejected {
+		filter.Flags = append(slices.Clone(filter.Flags), client.FlagNoRejected)
+	}
+	return filter
+}
+
+// suppressRejected drops the rejected CVEs of resp, when enabled, adding them
+// to the count of ctx.
+func (c *NVDClient) suppressRejected(ctx context.Context, resp *schema.NvdAPIResponse) {
+	if !c.noRejected {
+		return
+	}
+	n := client.SuppressRejected(resp)
+	if n == 0 {
+		return
+	}
+	if count, ok := ctx.Value(rejectedCountKey{}).(*atomic.Int64); ok {
+		count.Add(int64(n))
+	}
+	slog.Debug("Suppressed rejected CVEs from NVD response", slog.Int("n_rejected", n))
+}
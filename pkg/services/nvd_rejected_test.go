@@ -0,0 +1,55 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+
+	"github.com/Ullaakut/nmap/v2"
+	"github.com/kptm-tools/vulnerability-analysis/nvd/client"
+	"github.com/kptm-tools/vulnerability-analysis/nvd/schema"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_NmapService_RejectedSuppression(t *testing.T) {
+	t.Parallel()
+	var mu sync.Mutex
+	var queries []url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		queries = append(queries, r.URL.Query())
+		mu.Unlock()
+		json.NewEncoder(w).Encode(schema.NvdAPIResponse{TotalResults: 2, ResultsPerPage: 2, Vulnerabilities: []schema.Vulnerability{
+			{Cve: schema.CveDetail{ID: "CVE-2024-0001", VulnStatus: "Analyzed", Published: "2024-01-01T00:00:00.000", LastModified: "2024-01-01T00:00:00.000"}},
+			{Cve: schema.CveDetail{ID: "CVE-2024-0002", VulnStatus: client.StatusRejected, Published: "2024-01-01T00:00:00.000", LastModified: "2024-01-01T00:00:00.000"}},
+		}})
+	}))
+	defer server.Close()
+
+	host := nmap.Host{
+		Addresses: []nmap.Address{{Addr: "10.0.0.1", AddrType: "ipv4"}},
+		Ports: []nmap.Port{
+			{ID: 22, Protocol: "tcp", Service: nmap.Service{Name: "ssh", CPEs: []nmap.CPE{"cpe:/a:openbsd:openssh:8.2p1"}}},
+			{ID: 80, Protocol: "tcp", Service: nmap.Service{Name: "http", CPEs: []nmap.CPE{"cpe:/a:apache:http_server:2.4.41"}}},
+		},
+	}
+
+	// Without suppression, rejected CVEs are enriched like any other
+	result := NewNmapService(newTestNVDClient(server.URL)).enrichHost(context.Background(), host)
+	assert.Len(t, result.ScannedPorts[0].Vulnerabilities, 2)
+	assert.Zero(t, result.RejectedCVEs)
+	assert.False(t, queries[0].Has(client.FlagNoRejected))
+
+	result = NewNmapService(newTestNVDClient(server.URL, WithRejectedSuppression())).enrichHost(context.Background(), host)
+	for _, port := range result.ScannedPorts {
+		require.Len(t, port.Vulnerabilities, 1)
+		assert.Equal(t, "CVE-2024-0001", port.Vulnerabilities[0].ID)
+	}
+	assert.Equal(t, 2, result.RejectedCVEs)
+	assert.True(t, queries[len(queries)-1].Has(client.FlagNoRejected))
+}
@@ -0,0 +1,35 @@
+package services
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/kptm-tools/vulnerability-analysis/pkg/nvdreplay"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test_NVDClient_fetchByCPE_Replay replays testdata/nvd_api_success.json,
+// the first page of the CVEs of Windows 10 1607. Regenerate it from NVD with
+//
+//	NVD_REPLAY_MODE=record NVD_API_KEY=... go test ./pkg/services -run Test_NVDClient_fetchByCPE_Replay
+//
+// and copy testdata/recorded/nvd_api_success.json over it once reviewed.
+func Test_NVDClient_fetchByCPE_Replay(t *testing.T) {
+	t.Parallel()
+	transport := nvdreplay.New("testdata")
+	transport.Name = nvdreplay.Named("nvd_api_success.json")
+	// A single page, the fixture holds one response
+	nvd := NewNVDClient(
+		WithTransport(transport),
+		WithAPIKey(os.Getenv("NVD_API_KEY"), ""),
+		WithMaxCVEsPerCPE(nvdMaxResultsPerPage),
+		WithRateLimiter(nil),
+		WithRequestInterval(0))
+
+	resp, err := nvd.fetchByCPE(context.Background(), "cpe:2.3:o:microsoft:windows_10:1607:*:*:*:*:*:*:*")
+	require.NoError(t, err)
+	assert.Greater(t, resp.TotalResults, nvdMaxResultsPerPage)
+	assert.Len(t, resp.Vulnerabilities, nvdMaxResultsPerPage)
+}
@@ -0,0 +1,84 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log/slog"
+	"time"
+
+	"github.com/kptm-tools/vulnerability-analysis/nvd/schema"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/cache"
+)
+
+// sharedLookup is a CPE lookup as stored in the shared cache. The lookups of
+// the CPEs without CVEs are stored as Empty markers, without a Response.
+type sharedLookup struct {
+	Response *schema.NvdAPIResponse `json:"response,omitempty"`
+	Rejected int64                  `json:"rejected"`
+	Empty    bool                   `json:"empty,omitempty"`
+}
+
+// WithSharedCache shares the CPE lookups with the workers using the same
+// cache, e.g. Redis, for ttl, so that a CPE is queried once across them.
+// Lookups are only shared between clients fetching the same CVEs for a CPE:
+// the filters, caps and precision options are part of the key. Failures of
+// the cache are logged and fall back to NVD.
+func WithSharedCache(shared cache.Cache, ttl time.Duration) NVDClientOption {
+	return func(c *NVDClient) {
+		c.shared = shared
+		c.sharedTTL = ttl
+	}
+}
+
+// sharedCPEKey returns the key of the lookup of cpe in the shared cache.
+func (c *NVDClient) sharedCPEKey(cpe string) string {
+	h := fnv.New32a()
+	fmt.Fprint(h, c.queryFilter(), c.maxCVEsPerCPE, c.vulnerableOnly, c.matchCriteria != nil)
+	return fmt.Sprintf("nvd:cpe:%08x:%s", h.Sum32(), cpeCacheKey(cpe))
+}
+
+// sharedCPE returns the lookup of cpe shared by another worker.
+func (c *NVDClient) sharedCPE(ctx context.Context, cpe string) (*schema.NvdAPIResponse, int64, bool) {
+	if c.shared == nil {
+		return nil, 0, false
+	}
+	data, err := c.shared.Get(ctx, c.sharedCPEKey(cpe))
+	if err != nil {
+		if !errors.Is(err, cache.ErrMiss) {
+			slog.Warn("Failed to read shared CPE lookup", slog.String("cpe", cpe), slog.Any("error", err))
+		}
+		return nil, 0, false
+	}
+	var lookup sharedLookup
+	if err := json.Unmarshal(data, &lookup); err != nil || (lookup.Response == nil && !lookup.Empty) {
+		slog.Warn("Ignoring invalid shared CPE lookup", slog.String("cpe", cpe), slog.Any("error", err))
+		return nil, 0, false
+	}
+	if lookup.Empty {
+		return &schema.NvdAPIResponse{}, lookup.Rejected, true
+	}
+	return lookup.Response, lookup.Rejected, true
+}
+
+// shareCPE stores the lookup of cpe for the other workers.
+func (c *NVDClient) shareCPE(ctx context.Context, cpe string, resp *schema.NvdAPIResponse, rejected int64) {
+	if c.shared == nil {
+		return
+	}
+	lookup, ttl := sharedLookup{Response: resp, Rejected: rejected}, c.sharedTTL
+	if isEmptyLookup(resp) {
+		lookup = sharedLookup{Rejected: rejected, Empty: true}
+		ttl = emptyLookupTTL(ttl, c.negativeTTL)
+	}
+	data, err := json.Marshal(lookup)
+	if err != nil {
+		slog.Warn("Failed to encode shared CPE lookup", slog.String("cpe", cpe), slog.Any("error", err))
+		return
+	}
+	if err := c.shared.Set(ctx, c.sharedCPEKey(cpe), data, ttl); err != nil {
+		slog.Warn("Failed to share CPE lookup", slog.String("cpe", cpe), slog.Any("error", err))
+	}
+}
@@ -0,0 +1,123 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/kptm-tools/vulnerability-analysis/nvd/schema"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/cache"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_NVDClient_fetchByCPE_SharedCache(t *testing.T) {
+	t.Parallel()
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		json.NewEncoder(w).Encode(schema.NvdAPIResponse{TotalResults: 1, ResultsPerPage: 1, Vulnerabilities: []schema.Vulnerability{
+			{Cve: schema.CveDetail{ID: "CVE-2024-0001"}},
+		}})
+	}))
+	defer server.Close()
+
+	// Two workers sharing a cache
+	shared := cache.NewMemory()
+	first := newTestNVDClient(server.URL, WithSharedCache(shared, time.Hour))
+	second := newTestNVDClient(server.URL, WithSharedCache(shared, time.Hour), WithCPECache(10, time.Hour))
+	cpe := "cpe:2.3:a:apache:http_server:2.4.41:*:*:*:*:*:*:*"
+
+	_, err := first.fetchByCPE(context.Background(), cpe)
+	require.NoError(t, err)
+	resp, err := second.fetchByCPE(context.Background(), cpe)
+	require.NoError(t, err)
+	require.Len(t, resp.Vulnerabilities, 1)
+	assert.Equal(t, "CVE-2024-0001", resp.Vulnerabilities[0].Cve.ID)
+	assert.Equal(t, int32(1), requests.Load(), "Expected the second worker to reuse the lookup of the first")
+	stats, _ := second.CPECacheStats()
+	assert.Equal(t, 1, stats.Entries, "Expected shared lookups to be kept in memory")
+
+	// Other filters fetch other CVEs
+	_, err = newTestNVDClient(server.URL, WithSharedCache(shared, time.Hour), WithRejectedSuppression()).fetchByCPE(context.Background(), cpe)
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), requests.Load())
+
+	require.NoError(t, second.InvalidateCPE(context.Background(), cpe))
+	_, err = first.fetchByCPE(context.Background(), cpe)
+	require.NoError(t, err)
+	assert.Equal(t, int32(3), requests.Load(), "Expected invalidated lookups to query NVD")
+}
+
+// failingCache fails every operation, as an unreachable Redis would.
+type failingCache struct{}
+
+func (failingCache) Get(context.Context, string) ([]byte, error) {
+	return nil, assert.AnError
+}
+
+func (failingCache) Set(context.Context, string, []byte, time.Duration) error {
+	return assert.AnError
+}
+
+func (failingCache) Invalidate(context.Context, string) error {
+	return assert.AnError
+}
+
+func Test_NVDClient_fetchByCPE_SharedCacheDown(t *testing.T) {
+	t.Parallel()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(schema.NvdAPIResponse{TotalResults: 1, ResultsPerPage: 1, Vulnerabilities: []schema.Vulnerability{
+			{Cve: schema.CveDetail{ID: "CVE-2024-0001"}},
+		}})
+	}))
+	defer server.Close()
+
+	nvd := newTestNVDClient(server.URL, WithSharedCache(failingCache{}, time.Hour))
+	resp, err := nvd.fetchByCPE(context.Background(), "cpe:2.3:a:apache:http_server:2.4.41:*:*:*:*:*:*:*")
+	require.NoError(t, err)
+	assert.Len(t, resp.Vulnerabilities, 1)
+	assert.ErrorIs(t, nvd.InvalidateCPE(context.Background(), "cpe:2.3:a:apache:http_server:2.4.41:*:*:*:*:*:*:*"), assert.AnError)
+}
+
+// ttlCache records the TTLs of the payloads stored in a Memory cache.
+type ttlCache struct {
+	*cache.Memory
+	ttls map[string]time.Duration
+}
+
+func (c *ttlCache) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	c.ttls[key] = ttl
+	return c.Memory.Set(ctx, key, value, ttl)
+}
+
+func Test_NVDClient_fetchByCPE_NegativeSharedCache(t *testing.T) {
+	t.Parallel()
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		json.NewEncoder(w).Encode(schema.NvdAPIResponse{})
+	}))
+	defer server.Close()
+
+	shared := &ttlCache{Memory: cache.NewMemory(), ttls: make(map[string]time.Duration)}
+	nvd := newTestNVDClient(server.URL, WithSharedCache(shared, 24*time.Hour), WithNegativeCPECacheTTL(time.Hour))
+	cpe := "cpe:2.3:a:acme:widget:1.0:*:*:*:*:*:*:*"
+	key := nvd.sharedCPEKey(cpe)
+
+	_, err := nvd.fetchByCPE(context.Background(), cpe)
+	require.NoError(t, err)
+	data, err := shared.Get(context.Background(), key)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"rejected":0,"empty":true}`, string(data), "Expected empty lookups to be stored as markers")
+	assert.Equal(t, time.Hour, shared.ttls[key])
+
+	resp, err := nvd.fetchByCPE(context.Background(), cpe)
+	require.NoError(t, err)
+	assert.Empty(t, resp.Vulnerabilities)
+	assert.Equal(t, int32(1), requests.Load(), "Expected known-empty CPEs to skip NVD")
+}
@@ -0,0 +1,217 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/kptm-tools/vulnerability-analysis/nvd/schema"
+)
+
+var ErrNVDMaintenance = errors.New("NVD API is in a maintenance window")
+
+// ErrNVDOffline is returned instead of ErrNVDMaintenance in offline mode.
+var ErrNVDOffline = errors.New("NVD API is not used in offline mode")
+
+// CPESource resolves NVD data for a CPE without calling the live API, e.g.
+// from a cache or a local mirror. It is used while NVD is unavailable.
+type CPESource interface {
+	LookupCPE(cpe string) (*schema.NvdAPIResponse, error)
+}
+
+// CVESource resolves a single CVE record without calling the live API.
+type CVESource interface {
+	LookupCVE(id string) (*schema.NvdAPIResponse, error)
+}
+
+// NVDStatus is the availability state of the NVD API as seen by the probe.
+type NVDStatus string
+
+const (
+	NVDStatusAvailable   NVDStatus = "available"
+	NVDStatusMaintenance NVDStatus = "maintenance"
+	// NVDStatusOffline is the status of clients in offline mode, which never
+	// use the live API.
+	NVDStatusOffline NVDStatus = "offline"
+)
+
+// NVDStatusChange describes a transition between NVD availability states.
+type NVDStatusChange struct {
+	From      NVDStatus
+	To        NVDStatus
+	Since     time.Time
+	LastError error
+}
+
+// nvdStatusMonitor tracks whether the NVD API is in a prolonged outage.
+// Individual fetch failures only trigger a probe; the pipeline switches to
+// offline-only mode once failureThreshold consecutive probes have failed.
+type nvdStatusMonitor struct {
+	mu                  sync.RWMutex
+	status              NVDStatus
+	since               time.Time
+	consecutiveFailures int
+	lastErr             error
+
+	failureThreshold int
+	onChange         func(NVDStatusChange)
+	probeNow         chan struct{}
+}
+
+func newNVDStatusMonitor() *nvdStatusMonitor {
+	return &nvdStatusMonitor{
+		status:           NVDStatusAvailable,
+		since:            time.Now().UTC(),
+		failureThreshold: 3,
+		probeNow:         make(chan struct{}, 1),
+	}
+}
+
+// Status returns the last known NVD availability state.
+func (c *NVDClient) Status() NVDStatus {
+	c.status.mu.RLock()
+	defer c.status.mu.RUnlock()
+	return c.status.status
+}
+
+// inMaintenance reports whether lookups are served offline, during a
+// maintenance window or in offline mode.
+func (m *nvdStatusMonitor) inMaintenance() bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.status == NVDStatusMaintenance || m.status == NVDStatusOffline
+}
+
+// unavailable returns the error of the lookups the live API is needed for.
+func (m *nvdStatusMonitor) unavailable() error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.status == NVDStatusOffline {
+		return ErrNVDOffline
+	}
+	return ErrNVDMaintenance
+}
+
+// requestProbe asks the monitor to probe NVD as soon as possible.
+func (m *nvdStatusMonitor) requestProbe() {
+	select {
+	case m.probeNow <- struct{}{}:
+	default:
+	}
+}
+
+func (m *nvdStatusMonitor) recordProbe(err error) {
+	m.mu.Lock()
+	if m.status == NVDStatusOffline {
+		m.mu.Unlock()
+		return
+	}
+
+	var change *NVDStatusChange
+	now := time.Now().UTC()
+
+	if err == nil {
+		m.consecutiveFailures = 0
+		m.lastErr = nil
+		if m.status != NVDStatusAvailable {
+			change = &NVDStatusChange{From: m.status, To: NVDStatusAvailable, Since: now}
+			m.status = NVDStatusAvailable
+			m.since = now
+		}
+	} else {
+		m.consecutiveFailures++
+		m.lastErr = err
+		if m.status != NVDStatusMaintenance && m.consecutiveFailures >= m.failureThreshold {
+			change = &NVDStatusChange{From: m.status, To: NVDStatusMaintenance, Since: now, LastError: err}
+			m.status = NVDStatusMaintenance
+			m.since = now
+		}
+	}
+	onChange := m.onChange
+	m.mu.Unlock()
+
+	if change != nil {
+		slog.Warn("NVD API status changed",
+			slog.String("from", string(change.From)),
+			slog.String("to", string(change.To)),
+			slog.Any("error", change.LastError))
+		if onChange != nil {
+			onChange(*change)
+		}
+	}
+}
+
+// StartStatusMonitor probes the NVD API every interval (and whenever a fetch
+// exhausts its retries) until ctx is done. After failureThreshold consecutive
+// failed probes the client switches to offline-only mode and onChange is
+// called so operators can be alerted. Without a positive interval the API
+// isn't monitored.
+func (c *NVDClient) StartStatusMonitor(ctx context.Context, interval time.Duration, failureThreshold int, onChange func(NVDStatusChange)) {
+	if interval <= 0 {
+		slog.Info("NVD API status monitor disabled", slog.Duration("interval", interval))
+		return
+	}
+	c.status.mu.Lock()
+	// Offline clients never reach NVD, not even to probe it
+	if c.status.status == NVDStatusOffline {
+		c.status.mu.Unlock()
+		return
+	}
+	if failureThreshold > 0 {
+		c.status.failureThreshold = failureThreshold
+	}
+	c.status.onChange = onChange
+	c.status.mu.Unlock()
+
+	// Probes go through the proxy and gateways of the requests
+	client := &http.Client{Timeout: 15 * time.Second, Transport: c.api.HTTPClient.Transport}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			case <-c.status.probeNow:
+			}
+			c.status.recordProbe(c.probe(ctx, client))
+		}
+	}()
+}
+
+// lookupOffline serves a CPE lookup while NVD is in maintenance, from the
+// offline source or else from the knowledge cache when it also indexes CPEs.
+func (c *NVDClient) lookupOffline(cpe string) (*schema.NvdAPIResponse, error) {
+	src := c.offline
+	if src == nil {
+		src, _ = c.knowledge.(CPESource)
+	}
+	if src == nil {
+		return nil, fmt.Errorf("%w: no offline source configured for CPE %s", c.status.unavailable(), cpe)
+	}
+	resp, err := src.LookupCPE(cpe)
+	if err != nil {
+		return nil, fmt.Errorf("%w: offline lookup failed for CPE %s: %w", c.status.unavailable(), cpe, err)
+	}
+	return resp, nil
+}
+
+// lookupOfflineCVE serves a CVE lookup while NVD is in maintenance, using the
+// offline source when it also indexes CVE IDs.
+func (c *NVDClient) lookupOfflineCVE(cveID string) (*schema.NvdAPIResponse, error) {
+	src, ok := c.offline.(CVESource)
+	if !ok {
+		return nil, fmt.Errorf("%w: no offline lookup available for %s", c.status.unavailable(), cveID)
+	}
+	resp, err := src.LookupCVE(cveID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: offline lookup failed for %s: %w", c.status.unavailable(), cveID, err)
+	}
+	return resp, nil
+}
@@ -0,0 +1,118 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/kptm-tools/vulnerability-analysis/nvd/schema"
+	"github.com/stretchr/testify/assert"
+)
+
+type stubCPESource struct {
+	resp *schema.NvdAPIResponse
+	err  error
+}
+
+func (s stubCPESource) LookupCPE(cpe string) (*schema.NvdAPIResponse, error) {
+	return s.resp, s.err
+}
+
+func newTestStatusMonitor(threshold int) *nvdStatusMonitor {
+	return &nvdStatusMonitor{
+		status:           NVDStatusAvailable,
+		failureThreshold: threshold,
+		probeNow:         make(chan struct{}, 1),
+	}
+}
+
+func Test_nvdStatusMonitor_recordProbe(t *testing.T) {
+	t.Parallel()
+	m := newTestStatusMonitor(2)
+	var changes []NVDStatusChange
+	m.onChange = func(c NVDStatusChange) { changes = append(changes, c) }
+
+	m.recordProbe(ErrNVDServiceUnavailable)
+	assert.False(t, m.inMaintenance(), "Expected a single failure not to trigger maintenance mode")
+
+	m.recordProbe(ErrNVDServiceUnavailable)
+	assert.True(t, m.inMaintenance())
+
+	m.recordProbe(ErrNVDServiceUnavailable)
+	m.recordProbe(nil)
+	assert.False(t, m.inMaintenance())
+
+	if assert.Len(t, changes, 2) {
+		assert.Equal(t, NVDStatusMaintenance, changes[0].To)
+		assert.ErrorIs(t, changes[0].LastError, ErrNVDServiceUnavailable)
+		assert.Equal(t, NVDStatusAvailable, changes[1].To)
+	}
+}
+
+func Test_NVDClient_fetchByCPE_MaintenanceUsesOfflineSource(t *testing.T) {
+	t.Parallel()
+	cpe := "cpe:2.3:o:microsoft:windows_10:1607:*:*:*:*:*:*:*"
+	inMaintenance := func(offline CPESource) *NVDClient {
+		nvd := newTestNVDClient("http://127.0.0.1:0", WithOfflineSource(offline))
+		nvd.status = newTestStatusMonitor(1)
+		nvd.status.recordProbe(ErrNVDServiceUnavailable)
+		return nvd
+	}
+
+	// No offline source: fail fast
+	resp, err := inMaintenance(nil).fetchByCPE(context.Background(), cpe)
+	assert.ErrorIs(t, err, ErrNVDMaintenance)
+	assert.Nil(t, resp)
+
+	// Offline source configured
+	resp, err = inMaintenance(stubCPESource{resp: &schema.NvdAPIResponse{TotalResults: 1}}).fetchByCPE(context.Background(), cpe)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, resp.TotalResults)
+
+	// Offline source failure
+	_, err = inMaintenance(stubCPESource{err: errors.New("not found")}).fetchByCPE(context.Background(), cpe)
+	assert.ErrorIs(t, err, ErrNVDMaintenance)
+}
+
+func Test_NVDClient_fetchByCPE_MaintenanceFiltersOfflineSource(t *testing.T) {
+	t.Parallel()
+	scored := func(id string, severities ...schema.SeverityType) schema.Vulnerability {
+		vuln := schema.Vulnerability{Cve: schema.CveDetail{ID: id, Metrics: &schema.Metrics{}}}
+		for _, severity := range severities {
+			vuln.Cve.Metrics.CvssMetricV31 = append(vuln.Cve.Metrics.CvssMetricV31, schema.CvssMetricV31{CvssData: schema.CvssDataV31{BaseSeverity: severity}})
+		}
+		return vuln
+	}
+	offline := &schema.NvdAPIResponse{TotalResults: 3, Vulnerabilities: []schema.Vulnerability{
+		scored("CVE-2024-0001", schema.SeverityTypeLow),
+		scored("CVE-2024-0002", schema.SeverityTypeHigh, schema.SeverityTypeCritical),
+		scored("CVE-2024-0003", schema.SeverityTypeCritical),
+	}}
+	filter, err := ParseCVSSFilter("HIGH,CRITICAL", "", "")
+	assert.NoError(t, err)
+
+	nvd := newTestNVDClient("http://127.0.0.1:0", WithOfflineSource(stubCPESource{resp: offline}), WithCVSSFilter(filter))
+	nvd.status = newTestStatusMonitor(1)
+	nvd.status.recordProbe(ErrNVDServiceUnavailable)
+
+	resp, err := nvd.fetchByCPE(context.Background(), "cpe:2.3:o:microsoft:windows_10:1607:*:*:*:*:*:*:*")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, resp.TotalResults)
+	if assert.Len(t, resp.Vulnerabilities, 2) {
+		assert.Equal(t, "CVE-2024-0002", resp.Vulnerabilities[0].Cve.ID)
+		assert.Equal(t, "CVE-2024-0003", resp.Vulnerabilities[1].Cve.ID)
+	}
+	assert.Len(t, offline.Vulnerabilities, 3, "Expected the offline response not to be modified")
+}
+
+func TestNVDClient_StartStatusMonitor_Disabled(t *testing.T) {
+	t.Parallel()
+	for _, interval := range []time.Duration{0, -time.Minute} {
+		nvd := newTestNVDClient("http://127.0.0.1:0")
+		assert.NotPanics(t, func() {
+			nvd.StartStatusMonitor(context.Background(), interval, 1, nil)
+		})
+		assert.Nil(t, nvd.status.onChange, "Expected interval %s not to monitor the API", interval)
+	}
+}
@@ -0,0 +1,64 @@
+package services
+
+import (
+	"context"
+	"log/slog"
+	"net/url"
+	"time"
+
+	"github.com/kptm-tools/vulnerability-analysis/nvd/client"
+	"github.com/kptm-tools/vulnerability-analysis/nvd/schema"
+)
+
+// syncCPE fetches the CVEs of cpe modified since its checkpoint and merges
+// them into the stored ones, or fetches them all when cpe has no recent
+// checkpoint. Modified CVEs are fetched without the filters records can be
+// checked against, which apply once merged so that stored CVEs since rejected
+// or rescored out of them are dropped. Lookups served offline during a
+// maintenance window leave the checkpoint untouched.
+func (c *NVDClient) syncCPE(ctx context.Context, cpe string, query url.Values) (*schema.NvdAPIResponse, error) {
+	// Modifications made while the lookup runs are fetched again next time
+	now := time.Now().UTC()
+
+	since, ok := c.sync.SyncedUntil(cpe)
+	maxAge := nvdMaxDateRange
+	if c.syncMaxAge > 0 {
+		maxAge = min(c.syncMaxAge, maxAge)
+	}
+	delta := ok && now.Sub(since) <= maxAge && now.After(since)
+	filter := c.queryFilter()
+	fetchFilter := filter
+	if delta {
+		var err error
+		if query, err = client.Modified(since, now).Apply(query); err != nil {
+			return nil, err
+		}
+		fetchFilter = filter.Remote()
+	}
+
+	resp, err := c.fetchCPE(ctx, cpe, query, fetchFilter)
+	if err != nil {
+		return nil, err
+	}
+	if c.status.inMaintenance() {
+		if delta {
+			c.suppressRejected(ctx, resp)
+			resp = filterResponse(resp, filter)
+		}
+		return resp, nil
+	}
+
+	if !delta {
+		return c.sync.Replace(cpe, resp, now)
+	}
+	merged, err := c.sync.Merge(cpe, resp, now, filter.Matches)
+	if err != nil {
+		return nil, err
+	}
+	slog.Debug("Synced CPE incrementally",
+		slog.String("cpe", cpe),
+		slog.Time("since", since),
+		slog.Int("modified", len(resp.Vulnerabilities)),
+		slog.Int("cves", len(merged.Vulnerabilities)))
+	return merged, nil
+}
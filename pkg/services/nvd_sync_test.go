@@ -0,0 +1,109 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kptm-tools/vulnerability-analysis/nvd/schema"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/cpesync"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_NVDClient_IncrementalSync(t *testing.T) {
+	t.Parallel()
+	var mu sync.Mutex
+	var queries []url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		queries = append(queries, r.URL.Query())
+		mu.Unlock()
+
+		// The delta only holds the CVE modified since the first lookup
+		resp := schema.NvdAPIResponse{Vulnerabilities: []schema.Vulnerability{
+			{Cve: schema.CveDetail{ID: "CVE-2024-0002", LastModified: "2024-05-02T00:00:00.000"}},
+		}}
+		if !r.URL.Query().Has("lastModStartDate") {
+			resp.Vulnerabilities = append(resp.Vulnerabilities, schema.Vulnerability{Cve: schema.CveDetail{ID: "CVE-2024-0001", LastModified: "2024-01-01T00:00:00.000"}})
+		}
+		resp.TotalResults, resp.ResultsPerPage = len(resp.Vulnerabilities), len(resp.Vulnerabilities)
+		require.NoError(t, json.NewEncoder(w).Encode(resp))
+	}))
+	defer server.Close()
+
+	cpe := "cpe:2.3:a:openbsd:openssh:8.2:p1:*:*:*:*:*:*"
+	store := cpesync.NewStore()
+	c := newTestNVDClient(server.URL, WithIncrementalSync(store, time.Hour))
+
+	resp, err := c.fetchByCPE(context.Background(), cpe)
+	require.NoError(t, err)
+	assert.Len(t, resp.Vulnerabilities, 2)
+	assert.False(t, queries[0].Has("lastModStartDate"), "Expected the first lookup to fetch every CVE")
+	synced, ok := store.SyncedUntil(cpe)
+	require.True(t, ok)
+
+	resp, err = c.fetchByCPE(context.Background(), cpe)
+	require.NoError(t, err)
+	assert.Equal(t, synced.Format(nvdDateFormat), queries[1].Get("lastModStartDate"))
+	assert.Equal(t, cpe, queries[1].Get("cpeName"))
+	assert.Len(t, resp.Vulnerabilities, 2, "Expected the delta to be merged into the stored CVEs")
+	assert.Equal(t, 2, resp.TotalResults)
+
+	// Checkpoints older than the max age are fetched in full
+	stale := cpesync.NewStore()
+	_, err = stale.Replace(cpe, resp, time.Now().Add(-2*time.Hour))
+	require.NoError(t, err)
+	_, err = newTestNVDClient(server.URL, WithIncrementalSync(stale, time.Hour)).fetchByCPE(context.Background(), cpe)
+	require.NoError(t, err)
+	assert.False(t, queries[2].Has("lastModStartDate"))
+}
+
+func Test_NVDClient_IncrementalSync_Rejected(t *testing.T) {
+	t.Parallel()
+	var mu sync.Mutex
+	var queries []url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		queries = append(queries, r.URL.Query())
+		mu.Unlock()
+
+		// NVD rejects CVE-2024-0001 after the first lookup
+		resp := schema.NvdAPIResponse{Vulnerabilities: []schema.Vulnerability{
+			{Cve: schema.CveDetail{ID: "CVE-2024-0001", LastModified: "2024-01-01T00:00:00.000"}},
+			{Cve: schema.CveDetail{ID: "CVE-2024-0002", LastModified: "2024-01-01T00:00:00.000"}},
+		}}
+		if r.URL.Query().Has("lastModStartDate") {
+			resp.Vulnerabilities = []schema.Vulnerability{
+				{Cve: schema.CveDetail{ID: "CVE-2024-0001", LastModified: "2024-05-02T00:00:00.000", VulnStatus: "Rejected"}},
+			}
+		}
+		resp.TotalResults, resp.ResultsPerPage = len(resp.Vulnerabilities), len(resp.Vulnerabilities)
+		require.NoError(t, json.NewEncoder(w).Encode(resp))
+	}))
+	defer server.Close()
+
+	cpe := "cpe:2.3:a:openbsd:openssh:8.2:p1:*:*:*:*:*:*"
+	store := cpesync.NewStore()
+	c := newTestNVDClient(server.URL, WithIncrementalSync(store, time.Hour), WithRejectedSuppression())
+
+	resp, err := c.fetchByCPE(context.Background(), cpe)
+	require.NoError(t, err)
+	assert.Len(t, resp.Vulnerabilities, 2)
+	assert.True(t, queries[0].Has("noRejected"))
+
+	resp, err = c.fetchByCPE(context.Background(), cpe)
+	require.NoError(t, err)
+	assert.False(t, queries[1].Has("noRejected"), "Expected the delta to fetch rejected CVEs")
+	require.Len(t, resp.Vulnerabilities, 1, "Expected the rejected CVE to be dropped from the stored ones")
+	assert.Equal(t, "CVE-2024-0002", resp.Vulnerabilities[0].Cve.ID)
+
+	resp, err = c.fetchByCPE(context.Background(), cpe)
+	require.NoError(t, err)
+	assert.Len(t, resp.Vulnerabilities, 1)
+}
@@ -1,20 +1,36 @@
 package services
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"os"
 	"strings"
+	"sync"
+	"syscall"
 	"testing"
+	"time"
 
 	"github.com/kptm-tools/common/common/pkg/enums"
 	"github.com/kptm-tools/common/common/pkg/results/tools"
-	"github.com/kptm-tools/vulnerability-analysis/pkg/dto"
+	"github.com/kptm-tools/vulnerability-analysis/nvd/client"
+	"github.com/kptm-tools/vulnerability-analysis/nvd/schema"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/features"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/metrics"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/results"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/risk"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/tenant"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func Test_isValidCPE(t *testing.T) {
+	t.Parallel()
 	testCases := []struct {
 		name     string
 		inputCPE string
@@ -59,6 +75,7 @@ func Test_isValidCPE(t *testing.T) {
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
 			err := isValidCPE(tc.inputCPE)
 			if tc.wantErr {
 				assert.Error(t, err)
@@ -69,7 +86,18 @@ func Test_isValidCPE(t *testing.T) {
 	}
 }
 
-func Test_fetchNvdDataByCPE_SuccessWithResults(t *testing.T) {
+// newTestNVDClient returns a client of the mock NVD API at baseURL, neither
+// rate limited nor paced.
+func newTestNVDClient(baseURL string, opts ...NVDClientOption) *NVDClient {
+	defaults := []NVDClientOption{WithBaseURL(baseURL), WithRateLimiter(nil), WithRequestInterval(0)}
+	return NewNVDClient(append(defaults, opts...)...)
+}
+
+// testRetryPolicy keeps the retry tests from waiting on the real backoff.
+var testRetryPolicy = RetryPolicy{MaxRetries: 3, InitialDelay: time.Millisecond, MaxDelay: 5 * time.Millisecond}
+
+func Test_NVDClient_fetchByCPE_SuccessWithResults(t *testing.T) {
+	t.Parallel()
 	// 1. Mock HTTP server
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// Assert request parameters (CPE in query)
@@ -88,19 +116,96 @@ func Test_fetchNvdDataByCPE_SuccessWithResults(t *testing.T) {
 	}))
 	defer server.Close()
 
-	// 2. Modifyt base API URL for testing
-	baseNvdAPIURL = server.URL // Set to mock server URL
+	// 2. Point a client at the mock server
+	nvd := newTestNVDClient(server.URL)
 
-	// 3. Call fetchNvdDataByCPE with a valid CPE
+	// 3. Call fetchByCPE with a valid CPE
 	cpe := "cpe:2.3:o:microsoft:windows_10:1607:*:*:*:*:*:*:*"
-	response, err := fetchNvdDataByCPE(cpe, baseNvdAPIURL)
+	response, err := nvd.fetchByCPE(context.Background(), cpe)
 	// 4. Assertions
 	assert.NoError(t, err, "Expected no error for successful request")
 	assert.NotNil(t, response, "Expected non-nil NvdAPIResponse")
 	assert.Greater(t, response.TotalResults, 0, "Expected TotalResults > 0")
 }
 
-func Test_fetchNvdDataByCPE_ServiceUnavailableMaxRetriesFail(t *testing.T) {
+func Test_NVDClient_fetchByCPE_APIKey(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		name          string
+		key           string
+		header        string
+		wantHeader    string
+		wantRateLimit NVDRateLimit
+	}{
+		{name: "No key", wantHeader: DefaultNVDAPIKeyHeader, wantRateLimit: nvdUnkeyedRateLimit},
+		{name: "Default header", key: "secret", wantHeader: DefaultNVDAPIKeyHeader, wantRateLimit: nvdKeyedRateLimit},
+		{name: "Custom header", key: "secret", header: "X-Api-Key", wantHeader: "X-Api-Key", wantRateLimit: nvdKeyedRateLimit},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			var got string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = r.Header.Get(tc.wantHeader)
+				w.Write([]byte(`{"resultsPerPage":0,"startIndex":0,"totalResults":0,"vulnerabilities":[]}`))
+			}))
+			defer server.Close()
+
+			nvd := newTestNVDClient(server.URL, WithAPIKey(tc.key, tc.header))
+
+			_, err := nvd.fetchByCPE(context.Background(), "cpe:2.3:o:microsoft:windows_10:1607:*:*:*:*:*:*:*")
+			assert.NoError(t, err)
+			assert.Equal(t, tc.key, got)
+			assert.Equal(t, tc.wantRateLimit, nvd.RateLimit())
+		})
+	}
+
+	assert.Equal(t, 600*time.Millisecond, nvdKeyedRateLimit.Interval())
+	assert.Equal(t, 6*time.Second, nvdUnkeyedRateLimit.Interval())
+}
+
+func Test_NVDClient_fetchByCPE_APIKeys(t *testing.T) {
+	t.Parallel()
+	var mu sync.Mutex
+	var got []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("X-Api-Key")
+		mu.Lock()
+		got = append(got, key)
+		mu.Unlock()
+		if key == "revoked" {
+			w.Header().Set("message", "Invalid apiKey.")
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(`{"resultsPerPage":0,"startIndex":0,"totalResults":0,"vulnerabilities":[]}`))
+	}))
+	defer server.Close()
+
+	nvd := newTestNVDClient(server.URL, WithAPIKey("single", ""), WithAPIKeys([]string{"revoked", "key-a", "key-b"}, "X-Api-Key"))
+	for i := 0; i < 3; i++ {
+		_, err := nvd.fetchByCPE(context.Background(), "cpe:2.3:o:microsoft:windows_10:1607:*:*:*:*:*:*:*")
+		require.NoError(t, err)
+	}
+	assert.Equal(t, []string{"revoked", "key-a", "key-b", "key-a"}, got)
+
+	usage := nvd.KeyUsage()
+	require.Len(t, usage, 3)
+	assert.True(t, usage[0].Rejected)
+	assert.Equal(t, 2, usage[1].Requests)
+	assert.Equal(t, 2*nvdKeyedRateLimit.Requests, nvd.RateLimit().Requests)
+
+	// Rotated keys replace the previous ones
+	require.True(t, nvd.ReplaceAPIKeys([]string{"key-c"}))
+	_, err := nvd.fetchByCPE(context.Background(), "cpe:2.3:o:microsoft:windows_10:1607:*:*:*:*:*:*:*")
+	require.NoError(t, err)
+	assert.Equal(t, "key-c", got[len(got)-1])
+	assert.False(t, newTestNVDClient(server.URL).ReplaceAPIKeys([]string{"key-c"}))
+}
+
+func Test_NVDClient_fetchByCPE_ServiceUnavailableMaxRetriesFail(t *testing.T) {
+	t.Parallel()
 	invalidCPE := "cpe:2.4:o:microsoft:windows_10:1607:*:*:*:*:*:*:*"
 	retryCount := 0 // Counter to track mock server responses
 
@@ -112,7 +217,7 @@ func Test_fetchNvdDataByCPE_ServiceUnavailableMaxRetriesFail(t *testing.T) {
 			t.Errorf("Expected CPE query parameter in request URL %s, got %v", encodedCPE, r.URL.RawQuery)
 		}
 
-		if retryCount < maxRetries+1 {
+		if retryCount < testRetryPolicy.MaxRetries+1 {
 
 			content, err := os.ReadFile("testdata/nvd_service_unavailable.html")
 			if err != nil {
@@ -138,19 +243,20 @@ func Test_fetchNvdDataByCPE_ServiceUnavailableMaxRetriesFail(t *testing.T) {
 	}))
 	defer server.Close()
 
-	// 2. Modify base API URL for testing
-	baseNvdAPIURL = server.URL
+	// 2. Point a client at the mock server
+	nvd := newTestNVDClient(server.URL, WithRetryPolicy(testRetryPolicy))
 
-	// 3. Call fetchNvdDataByCPE with an invalid CPE
-	resp, err := fetchNvdDataByCPE(invalidCPE, baseNvdAPIURL)
+	// 3. Call fetchByCPE with an invalid CPE
+	resp, err := nvd.fetchByCPE(context.Background(), invalidCPE)
 	assert.Error(t, err)
 	assert.ErrorIs(t, err, ErrNVDServiceUnavailable, "Expected ErrNVDServiceUnavailable")
 	assert.Nil(t, resp)
 
-	assert.Equal(t, maxRetries+1, retryCount, "Expected function to attempt max retries")
+	assert.Equal(t, testRetryPolicy.MaxRetries+1, retryCount, "Expected function to attempt max retries")
 }
 
-func Test_fetchNvdDataByCPE_ServiceUnavailableMaxRetriesSuccess(t *testing.T) {
+func Test_NVDClient_fetchByCPE_ServiceUnavailableMaxRetriesSuccess(t *testing.T) {
+	t.Parallel()
 	cpe := "cpe:2.4:o:microsoft:windows_10:1607:*:*:*:*:*:*:*"
 	retryCount := 0 // Counter to track mock server responses
 
@@ -162,7 +268,7 @@ func Test_fetchNvdDataByCPE_ServiceUnavailableMaxRetriesSuccess(t *testing.T) {
 			t.Errorf("Expected CPE query parameter in request URL %s, got %v", encodedCPE, r.URL.RawQuery)
 		}
 
-		if retryCount < maxRetries {
+		if retryCount < testRetryPolicy.MaxRetries {
 
 			content, err := os.ReadFile("testdata/nvd_service_unavailable.html")
 			if err != nil {
@@ -188,19 +294,184 @@ func Test_fetchNvdDataByCPE_ServiceUnavailableMaxRetriesSuccess(t *testing.T) {
 	}))
 	defer server.Close()
 
-	// 2. Modify base API URL for testing
-	baseNvdAPIURL = server.URL
+	// 2. Point a client at the mock server
+	nvd := newTestNVDClient(server.URL, WithRetryPolicy(testRetryPolicy))
 
-	// 3. Call fetchNvdDataByCPE with an invalid CPE
-	resp, err := fetchNvdDataByCPE(cpe, baseNvdAPIURL)
+	// 3. Call fetchByCPE with an invalid CPE
+	resp, err := nvd.fetchByCPE(context.Background(), cpe)
 	assert.NoError(t, err, "Expected no error for successful request")
 	assert.NotNil(t, resp, "Expected non-nil NvdAPIResponse")
 	assert.Greater(t, resp.TotalResults, 0, "Expected TotalResults > 0")
 
-	assert.Equal(t, maxRetries, retryCount, "Expected function to attempt max retries")
+	assert.Equal(t, testRetryPolicy.MaxRetries, retryCount, "Expected function to attempt max retries")
+}
+
+func Test_NVDClient_fetchByCPE_RateLimitedRetryAfter(t *testing.T) {
+	t.Parallel()
+	cpe := "cpe:2.3:o:microsoft:windows_10:1607:*:*:*:*:*:*:*"
+
+	tests := []struct {
+		name    string
+		status  int
+		headers map[string]string
+	}{
+		{name: "429", status: http.StatusTooManyRequests, headers: map[string]string{"Retry-After": "1"}},
+		{name: "throttling 403", status: http.StatusForbidden, headers: map[string]string{"Retry-After": "1", "X-RateLimit-Remaining": "0"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			throttled := false
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if !throttled {
+					throttled = true
+					for k, v := range tt.headers {
+						w.Header().Set(k, v)
+					}
+					w.WriteHeader(tt.status)
+					return
+				}
+
+				content, err := os.ReadFile("testdata/nvd_api_success.json")
+				if err != nil {
+					t.Fatalf("Failed to read test data file: %v", err)
+				}
+				w.Header().Set("Content-Type", "application/json")
+				w.Write(content)
+			}))
+			defer server.Close()
+
+			// The policy delay would outlast the deadline, so only the
+			// server-provided delay lets the retry succeed
+			nvd := newTestNVDClient(server.URL, WithRetryPolicy(RetryPolicy{MaxRetries: 1, InitialDelay: time.Hour, MaxDelay: time.Hour}))
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+
+			start := time.Now()
+			resp, err := nvd.fetchByCPE(ctx, cpe)
+			require.NoError(t, err)
+			assert.Greater(t, resp.TotalResults, 0)
+			assert.GreaterOrEqual(t, time.Since(start), time.Second, "Expected the retry to wait for Retry-After")
+			assert.True(t, throttled)
+			assert.Equal(t, uint64(1), nvd.Throttled())
+		})
+	}
+}
+
+func Test_NVDClient_fetchByCPE_ForbiddenNotRetried(t *testing.T) {
+	t.Parallel()
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte("Access denied by policy"))
+	}))
+	defer server.Close()
+
+	nvd := newTestNVDClient(server.URL, WithRetryPolicy(testRetryPolicy))
+	_, err := nvd.fetchByCPE(context.Background(), "cpe:2.3:o:microsoft:windows_10:1607:*:*:*:*:*:*:*")
+	assert.ErrorIs(t, err, ErrNVDAPIStatus)
+	assert.Equal(t, 1, requests, "Expected an explained 403 without rate limit headers not to be retried")
+}
+
+func Test_NVDClient_fetchByCPE_DroppedConnectionRetried(t *testing.T) {
+	t.Parallel()
+	var mu sync.Mutex
+	dropped := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		drop := dropped < 2
+		if drop {
+			dropped++
+		}
+		mu.Unlock()
+
+		if drop {
+			// Promise a body and close the connection before sending it
+			w.Header().Set("Content-Length", "1024")
+			w.WriteHeader(http.StatusOK)
+			conn, _, err := w.(http.Hijacker).Hijack()
+			require.NoError(t, err)
+			conn.Close()
+			return
+		}
+
+		content, err := os.ReadFile("testdata/nvd_api_success.json")
+		if err != nil {
+			t.Fatalf("Failed to read test data file: %v", err)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(content)
+	}))
+	defer server.Close()
+
+	nvd := newTestNVDClient(server.URL, WithRetryPolicy(testRetryPolicy))
+	resp, err := nvd.fetchByCPE(context.Background(), "cpe:2.3:o:microsoft:windows_10:1607:*:*:*:*:*:*:*")
+	require.NoError(t, err)
+	assert.Greater(t, resp.TotalResults, 0)
+	assert.Equal(t, 2, dropped)
+}
+
+func Test_isTransientNetworkError(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "client timeout", err: &url.Error{Op: "Get", URL: "https://nvd", Err: &net.OpError{Op: "dial", Err: os.ErrDeadlineExceeded}}, want: true},
+		{name: "truncated body", err: fmt.Errorf("%w: %w", ErrNVDDecode, io.ErrUnexpectedEOF), want: true},
+		{name: "EOF", err: fmt.Errorf("%w: %w", ErrNVDDecode, io.EOF)},
+		{name: "connection reset", err: &url.Error{Op: "Get", URL: "https://nvd", Err: &net.OpError{Op: "read", Err: os.NewSyscallError("read", syscall.ECONNRESET)}}, want: true},
+		{name: "connection refused", err: &url.Error{Op: "Get", URL: "https://nvd", Err: &net.OpError{Op: "dial", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}}, want: true},
+		{name: "temporary DNS failure", err: &net.DNSError{Err: "server misbehaving", Name: "nvd", IsTemporary: true}, want: true},
+		{name: "unknown host", err: &net.DNSError{Err: "no such host", Name: "nvd", IsNotFound: true}},
+		{name: "status error", err: fmt.Errorf("%w: 404", ErrNVDAPIStatus)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, tt.want, isTransientNetworkError(tt.err))
+			assert.Equal(t, tt.want, shouldRetry(tt.err))
+		})
+	}
+}
+
+func Test_NVDClient_FetchByCVEID(t *testing.T) {
+	t.Parallel()
+	var mu sync.Mutex
+	var queries []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		queries = append(queries, r.URL.Query().Get("cveId"))
+		mu.Unlock()
+
+		content, err := os.ReadFile("testdata/nvd_api_success.json")
+		if err != nil {
+			t.Fatalf("Failed to read test data file: %v", err)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(content)
+	}))
+	defer server.Close()
+
+	nvd := newTestNVDClient(server.URL, WithRetryPolicy(testRetryPolicy))
+
+	resp, err := nvd.FetchByCVEID(context.Background(), " cve-2024-1234 ")
+	require.NoError(t, err)
+	assert.NotEmpty(t, resp.Vulnerabilities)
+
+	for _, id := range []string{"", "CVE-2024-12", "GHSA-jfh8-c2jp-5v3q", "CVE-2024-1234&cpeName=x"} {
+		_, err := nvd.FetchByCVEID(context.Background(), id)
+		assert.ErrorIs(t, err, ErrInvalidCVEID, id)
+	}
+	assert.Equal(t, []string{"CVE-2024-1234"}, queries)
 }
 
 func Test_standardizeCPE(t *testing.T) {
+	t.Parallel()
 	tests := []struct {
 		name string // description of this test case
 		// Named input parameters for target function.
@@ -273,6 +544,7 @@ func Test_standardizeCPE(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
 			got, gotErr := standardizeCPE(tt.cpe)
 			if tt.wantErr {
 				assert.Error(t, gotErr)
@@ -285,54 +557,103 @@ func Test_standardizeCPE(t *testing.T) {
 	}
 }
 
-func Test_calculateLikelihoodSimple(t *testing.T) {
+func Test_standardizeCPEWithTrace(t *testing.T) {
+	t.Parallel()
+	got, trace, err := standardizeCPEWithTrace("cpe:/a:OpenBSD:openssh:8.0")
+	assert.NoError(t, err)
+	assert.Equal(t, "cpe:2.3:a:openbsd:openssh:8.0:*:*:*:*:*:*:*", got)
+	assert.Equal(t, []string{
+		`stripped CPE 2.2 prefix "cpe:/"`,
+		`lowercased vendor "OpenBSD" to "openbsd"`,
+		`padded 7 fields with "*"`,
+		`added CPE 2.3 prefix "cpe:2.3:"`,
+	}, trace)
+
+	_, trace, err = standardizeCPEWithTrace("cpe:/a:test")
+	assert.Error(t, err)
+	assert.Len(t, trace, 1, "Expected the trace to stop at the failing step")
+}
+
+func Test_calculateLikelihood(t *testing.T) {
+	t.Parallel()
 	testCases := []struct {
 		name      string
-		vulnInput tools.Vulnerability
+		vulnInput results.Vulnerability
 		expected  enums.LikelyhoodType
 	}{
 		{
 			name: "Network Access, Low Complexity",
-			vulnInput: tools.Vulnerability{
+			vulnInput: results.Vulnerability{Vulnerability: tools.Vulnerability{
 				Access:     enums.AccessTypeNetwork,
 				Complexity: enums.ComplexityTypeLow,
-			},
+			}},
 			expected: enums.LikelyhoodTypeVeryHigh,
 		},
 		{
 			name: "Network Access, High Complexity",
-			vulnInput: tools.Vulnerability{
+			vulnInput: results.Vulnerability{Vulnerability: tools.Vulnerability{
 				Access:     enums.AccessTypeNetwork,
 				Complexity: enums.ComplexityTypeHigh,
-			},
+			}},
 			expected: enums.LikelyhoodTypeHigh,
 		},
 		{
 			name: "Adjacent Network Access",
-			vulnInput: tools.Vulnerability{
+			vulnInput: results.Vulnerability{Vulnerability: tools.Vulnerability{
 				Access: enums.AccessTypeAdjacentNetwork,
-			},
+			}},
 			expected: enums.LikelyhoodTypeMedium,
 		},
 		{
 			name: "Local Access",
-			vulnInput: tools.Vulnerability{
+			vulnInput: results.Vulnerability{Vulnerability: tools.Vulnerability{
 				Access: enums.AccessTypeLocal,
+			}},
+			expected: enums.LikelyhoodTypeLow,
+		},
+		{
+			name: "Network Access, Low Complexity, User Interaction Required",
+			vulnInput: results.Vulnerability{
+				Vulnerability: tools.Vulnerability{
+					Access:     enums.AccessTypeNetwork,
+					Complexity: enums.ComplexityTypeLow,
+				},
+				UserInteraction: results.UserInteractionRequired,
+			},
+			expected: enums.LikelyhoodTypeHigh,
+		},
+		{
+			name: "Local Access, User Interaction Required",
+			vulnInput: results.Vulnerability{
+				Vulnerability:   tools.Vulnerability{Access: enums.AccessTypeLocal},
+				UserInteraction: results.UserInteractionRequired,
 			},
 			expected: enums.LikelyhoodTypeLow,
 		},
+		{
+			name: "Network Access, Low Complexity, Internal",
+			vulnInput: results.Vulnerability{
+				Vulnerability: tools.Vulnerability{
+					Access:     enums.AccessTypeNetwork,
+					Complexity: enums.ComplexityTypeLow,
+				},
+				Exposure: results.ExposureInternal,
+			},
+			expected: enums.LikelyhoodTypeHigh,
+		},
 		{
 			name: "Unknown AccessType",
-			vulnInput: tools.Vulnerability{
+			vulnInput: results.Vulnerability{Vulnerability: tools.Vulnerability{
 				Access: enums.AccessTypeUnknown,
-			},
+			}},
 			expected: enums.LikelyhoodTypeUnknown,
 		},
 	}
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			got := calculateLikelihoodSimple(tc.vulnInput)
+			t.Parallel()
+			got := DefaultEnrichment().calculateLikelihood(tc.vulnInput)
 
 			assert.Equal(t, tc.expected, got)
 		})
@@ -340,17 +661,18 @@ func Test_calculateLikelihoodSimple(t *testing.T) {
 }
 
 func Test_EnrichVulnerabilityWithNvdData(t *testing.T) {
+	t.Parallel()
 	testCases := []struct {
 		name         string
-		nvdVulnInput dto.Vulnerability                                     // Mocked dto.Vulnerability input
-		wantErr      bool                                                  // Expect an error?
-		assertFunc   func(t *testing.T, enrichedVuln *tools.Vulnerability) // Custom assertion function
+		nvdVulnInput schema.Vulnerability                                    // Mocked schema.Vulnerability input
+		wantErr      bool                                                    // Expect an error?
+		assertFunc   func(t *testing.T, enrichedVuln *results.Vulnerability) // Custom assertion function
 	}{
 		{
 			name:         "Enrich with CVSS v3.1 Data",
 			nvdVulnInput: createMockNvdVulnerabilityWithV31(), // Helper to create mock data
 			wantErr:      false,
-			assertFunc: func(t *testing.T, enrichedVuln *tools.Vulnerability) {
+			assertFunc: func(t *testing.T, enrichedVuln *results.Vulnerability) {
 				if enrichedVuln.BaseCVSSScore != 7.5 { // Example assertion based on mock data
 					t.Errorf("Expected BaseCVSSScore to be 7.5, got %f", enrichedVuln.BaseCVSSScore)
 				}
@@ -375,13 +697,24 @@ func Test_EnrichVulnerabilityWithNvdData(t *testing.T) {
 				if enrichedVuln.BaseSeverity != enums.SeverityTypeHigh {
 					t.Errorf("Expected BaseSeverity High, got %v", enrichedVuln.BaseSeverity)
 				}
+				if enrichedVuln.ConfidentialityImpact != enums.ImpactTypeHigh {
+					t.Errorf("Expected ConfidentialityImpact High, got %v", enrichedVuln.ConfidentialityImpact)
+				}
+				if enrichedVuln.Scope != results.ScopeTypeUnchanged {
+					t.Errorf("Expected Scope Unchanged, got %v", enrichedVuln.Scope)
+				}
+				if enrichedVuln.UserInteraction != results.UserInteractionNone {
+					t.Errorf("Expected UserInteraction None, got %v", enrichedVuln.UserInteraction)
+				}
+				assert.Equal(t, []string{"CWE-787"}, enrichedVuln.CWEs)
+				assert.Equal(t, "Out-of-Bounds Write — CVE-TEST-V31", enrichedVuln.Title)
 			},
 		},
 		{
 			name:         "Enrich with CVSS v3.0 Data (no v3.1)",
 			nvdVulnInput: createMockNvdVulnerabilityWithV30Only(), // Helper for v3.0 data
 			wantErr:      false,
-			assertFunc: func(t *testing.T, enrichedVuln *tools.Vulnerability) {
+			assertFunc: func(t *testing.T, enrichedVuln *results.Vulnerability) {
 				if enrichedVuln.BaseCVSSScore != 6.8 {
 					t.Errorf("Expected BaseCVSSScore to be 6.8, got %f", enrichedVuln.BaseCVSSScore)
 				}
@@ -409,10 +742,16 @@ func Test_EnrichVulnerabilityWithNvdData(t *testing.T) {
 			name:         "Enrich with CVSS v2 Data (no v3.x)",
 			nvdVulnInput: createMockNvdVulnerabilityWithV2Only(), // Helper for v2 data
 			wantErr:      false,
-			assertFunc: func(t *testing.T, enrichedVuln *tools.Vulnerability) {
+			assertFunc: func(t *testing.T, enrichedVuln *results.Vulnerability) {
 				if enrichedVuln.BaseCVSSScore != 5.0 {
 					t.Errorf("Expected BaseCVSSScore to be 5.0, got %f", enrichedVuln.BaseCVSSScore)
 				}
+				if enrichedVuln.ConfidentialityImpact != enums.ImpactTypeLow {
+					t.Errorf("Expected ConfidentialityImpact Low, got %v", enrichedVuln.ConfidentialityImpact)
+				}
+				if enrichedVuln.Scope != results.ScopeTypeUnknown {
+					t.Errorf("Expected Scope Unknown for CVSS v2, got %v", enrichedVuln.Scope)
+				}
 				if enrichedVuln.Access != enums.AccessTypeNetwork {
 					t.Errorf("Expected AccessTypeNetwork, got %v", enrichedVuln.Access)
 				}
@@ -434,7 +773,7 @@ func Test_EnrichVulnerabilityWithNvdData(t *testing.T) {
 			name:         "Handle Missing Metrics",
 			nvdVulnInput: createMockNvdVulnerabilityNoMetrics(), // Helper for no metrics
 			wantErr:      false,
-			assertFunc: func(t *testing.T, enrichedVuln *tools.Vulnerability) {
+			assertFunc: func(t *testing.T, enrichedVuln *results.Vulnerability) {
 				if enrichedVuln.BaseCVSSScore != 0.0 {
 					t.Errorf("Expected BaseCVSSScore to be 0.0 when metrics are missing, got %f", enrichedVuln.BaseCVSSScore)
 				}
@@ -459,8 +798,9 @@ func Test_EnrichVulnerabilityWithNvdData(t *testing.T) {
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			vuln := &tools.Vulnerability{} // Create a new vuln for each test
-			err := enrichVulnerabilityWithNvdData(vuln, tc.nvdVulnInput)
+			t.Parallel()
+			vuln := &results.Vulnerability{} // Create a new vuln for each test
+			err := DefaultEnrichment().enrichVulnerabilityWithNvdData(context.Background(), vuln, tc.nvdVulnInput)
 
 			if tc.wantErr {
 				if err == nil {
@@ -479,25 +819,29 @@ func Test_EnrichVulnerabilityWithNvdData(t *testing.T) {
 	}
 }
 
-// --- Helper functions to create mock dto.Vulnerability data ---
+// --- Helper functions to create mock schema.Vulnerability data ---
 
-func createMockNvdVulnerabilityWithV31() dto.Vulnerability {
-	maturityFunctional := dto.ExploitCodeMaturityTypeFunctional
+func createMockNvdVulnerabilityWithV31() schema.Vulnerability {
+	maturityFunctional := schema.ExploitCodeMaturityTypeFunctional
 
-	return dto.Vulnerability{
-		Cve: dto.CveDetail{
+	return schema.Vulnerability{
+		Cve: schema.CveDetail{
 			ID:               "CVE-TEST-V31",
 			SourceIdentifier: "TestSource",
-			Descriptions: []dto.Description{
+			Descriptions: []schema.Description{
 				{Lang: "en", Value: "Test Description v3.1"},
 			},
-			References: []dto.Reference{
+			References: []schema.Reference{
 				{URL: "http://example.com/ref1"},
 			},
-			Metrics: &dto.Metrics{
-				CvssMetricV31: []dto.CvssMetricV31{
+			Weaknesses: []schema.Weakness{
+				{Source: "nvd@nist.gov", Type: "Primary", Description: []schema.Description{{Lang: "en", Value: "CWE-787"}}},
+				{Source: "TestSource", Type: "Secondary", Description: []schema.Description{{Lang: "en", Value: "NVD-CWE-noinfo"}, {Lang: "en", Value: "CWE-787"}}},
+			},
+			Metrics: &schema.Metrics{
+				CvssMetricV31: []schema.CvssMetricV31{
 					{
-						CvssData: dto.CvssDataV31{
+						CvssData: schema.CvssDataV31{
 							BaseScore:             7.5,
 							BaseSeverity:          "HIGH",
 							AttackVector:          "NETWORK",
@@ -524,21 +868,21 @@ func createMockNvdVulnerabilityWithV31() dto.Vulnerability {
 	}
 }
 
-func createMockNvdVulnerabilityWithV30Only() dto.Vulnerability {
-	return dto.Vulnerability{
-		Cve: dto.CveDetail{
+func createMockNvdVulnerabilityWithV30Only() schema.Vulnerability {
+	return schema.Vulnerability{
+		Cve: schema.CveDetail{
 			ID:               "CVE-TEST-V30",
 			SourceIdentifier: "TestSource",
-			Descriptions: []dto.Description{
+			Descriptions: []schema.Description{
 				{Lang: "en", Value: "Test Description v3.0 Only"},
 			},
-			References: []dto.Reference{
+			References: []schema.Reference{
 				{URL: "http://example.com/ref-v30"},
 			},
-			Metrics: &dto.Metrics{
-				CvssMetricV30: []dto.CvssMetricV30{
+			Metrics: &schema.Metrics{
+				CvssMetricV30: []schema.CvssMetricV30{
 					{
-						CvssData: dto.CvssDataV30{
+						CvssData: schema.CvssDataV30{
 							Version:               "3.0",
 							VectorString:          "CVSS:3.0/AV:N/AC:L/PR:N/UI:R/S:U/C:L/I:L/A:L",
 							AttackVector:          "NETWORK",
@@ -563,21 +907,21 @@ func createMockNvdVulnerabilityWithV30Only() dto.Vulnerability {
 	}
 }
 
-func createMockNvdVulnerabilityWithV2Only() dto.Vulnerability {
-	return dto.Vulnerability{
-		Cve: dto.CveDetail{
+func createMockNvdVulnerabilityWithV2Only() schema.Vulnerability {
+	return schema.Vulnerability{
+		Cve: schema.CveDetail{
 			ID:               "CVE-TEST-V2",
 			SourceIdentifier: "TestSource",
-			Descriptions: []dto.Description{
+			Descriptions: []schema.Description{
 				{Lang: "en", Value: "Test Description v2 Only"},
 			},
-			References: []dto.Reference{
+			References: []schema.Reference{
 				{URL: "http://example.com/ref-v2"},
 			},
-			Metrics: &dto.Metrics{
-				CvssMetricV2: []dto.CvssMetricV2{
+			Metrics: &schema.Metrics{
+				CvssMetricV2: []schema.CvssMetricV2{
 					{
-						CvssData: dto.CvssDataV2{
+						CvssData: schema.CvssDataV2{
 							Version:               "2.0",
 							VectorString:          "(AV:N/AC:L/Au:N/C:P/I:N/A:N)",
 							AccessVector:          "NETWORK",
@@ -600,15 +944,15 @@ func createMockNvdVulnerabilityWithV2Only() dto.Vulnerability {
 	}
 }
 
-func createMockNvdVulnerabilityNoMetrics() dto.Vulnerability {
-	return dto.Vulnerability{
-		Cve: dto.CveDetail{
+func createMockNvdVulnerabilityNoMetrics() schema.Vulnerability {
+	return schema.Vulnerability{
+		Cve: schema.CveDetail{
 			ID:               "CVE-TEST-NO-METRICS",
 			SourceIdentifier: "TestSource",
-			Descriptions: []dto.Description{
+			Descriptions: []schema.Description{
 				{Lang: "en", Value: "Test Description No Metrics"},
 			},
-			References: []dto.Reference{
+			References: []schema.Reference{
 				{URL: "http://example.com/ref-no-metrics"},
 			},
 			Metrics:      nil, // Metrics are nil/missing
@@ -619,6 +963,7 @@ func createMockNvdVulnerabilityNoMetrics() dto.Vulnerability {
 }
 
 func Test_parseVendorComments(t *testing.T) {
+	t.Parallel()
 	date1Str := "2008-12-18T00:00:00"
 	date1, err := parseNvdVendorCommentDateTime(date1Str)
 	if err != nil {
@@ -628,12 +973,12 @@ func Test_parseVendorComments(t *testing.T) {
 	testsCases := []struct {
 		name string
 		// Named input parameters for target function.
-		nvdComments []dto.VendorComment
+		nvdComments []schema.VendorComment
 		want        []tools.VendorComment
 	}{
 		{
 			name: "Valid nvd vendor comments",
-			nvdComments: []dto.VendorComment{
+			nvdComments: []schema.VendorComment{
 				{
 					Organization: "Red Hat",
 					Comment:      "Not vulnerable. This issue did not affect the versions of the util-linux packages (providing /bin/login), as shipped with Red Hat Enterprise Linux 2.1, 3, 4 or 5.",
@@ -660,7 +1005,7 @@ func Test_parseVendorComments(t *testing.T) {
 		},
 		{
 			name: "Valid and invalid nvd vendor comments",
-			nvdComments: []dto.VendorComment{
+			nvdComments: []schema.VendorComment{
 				{
 					Organization: "Red Hat",
 					Comment:      "Not vulnerable. This issue did not affect the versions of the util-linux packages (providing /bin/login), as shipped with Red Hat Enterprise Linux 2.1, 3, 4 or 5.",
@@ -682,12 +1027,13 @@ func Test_parseVendorComments(t *testing.T) {
 		},
 		{
 			name:        "Empty vendor comments",
-			nvdComments: []dto.VendorComment{},
+			nvdComments: []schema.VendorComment{},
 			want:        []tools.VendorComment{},
 		},
 	}
 	for _, tc := range testsCases {
 		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
 			got := parseVendorComments(tc.nvdComments)
 
 			assert.Equal(t, len(tc.want), len(got))
@@ -699,3 +1045,333 @@ func Test_parseVendorComments(t *testing.T) {
 		})
 	}
 }
+
+func Test_extractCVSSv2Flags(t *testing.T) {
+	t.Parallel()
+	yes, no := true, false
+
+	testCases := []struct {
+		name    string
+		metrics *schema.Metrics
+		want    *results.CVSSv2Flags
+	}{
+		{
+			name:    "No metrics",
+			metrics: nil,
+			want:    nil,
+		},
+		{
+			name:    "No CVSS v2 metric",
+			metrics: &schema.Metrics{CvssMetricV31: []schema.CvssMetricV31{{}}},
+			want:    nil,
+		},
+		{
+			name:    "CVSS v2 metric without flags",
+			metrics: &schema.Metrics{CvssMetricV2: []schema.CvssMetricV2{{}}},
+			want:    nil,
+		},
+		{
+			name: "Flags read alongside CVSS v3.1",
+			metrics: &schema.Metrics{
+				CvssMetricV31: []schema.CvssMetricV31{{}},
+				CvssMetricV2: []schema.CvssMetricV2{{
+					AcInsufInfo:        &no,
+					ObtainAllPrivilege: &yes,
+				}},
+			},
+			want: &results.CVSSv2Flags{ACInsufInfo: &no, ObtainAllPrivilege: &yes},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, tc.want, extractCVSSv2Flags(tc.metrics))
+		})
+	}
+}
+
+func Test_EnrichVulnerabilityWithNvdData_ElevatedImpact(t *testing.T) {
+	t.Parallel()
+	yes := true
+
+	nvdVuln := createMockNvdVulnerabilityWithV31()
+	nvdVuln.Cve.Metrics.CvssMetricV2 = []schema.CvssMetricV2{{ObtainAllPrivilege: &yes}}
+
+	var disabled results.Vulnerability
+	assert.NoError(t, DefaultEnrichment().enrichVulnerabilityWithNvdData(context.Background(), &disabled, nvdVuln))
+	assert.Nil(t, disabled.CVSSv2Flags)
+	assert.False(t, disabled.ElevatedImpact)
+
+	historical := DefaultEnrichment()
+	historical.CVSSv2Flags = true
+	var enabled results.Vulnerability
+	assert.NoError(t, historical.enrichVulnerabilityWithNvdData(context.Background(), &enabled, nvdVuln))
+	assert.NotNil(t, enabled.CVSSv2Flags)
+	assert.True(t, enabled.ElevatedImpact)
+}
+
+func Test_getExploitReferences(t *testing.T) {
+	t.Parallel()
+	refs := []schema.Reference{
+		{URL: "https://example.com/advisory", Tags: []string{"Vendor Advisory"}},
+		{URL: "https://www.exploit-db.com/exploits/50383", Tags: []string{"Exploit", "Third Party Advisory"}},
+		{URL: "https://www.exploit-db.com/exploits/50383", Tags: []string{"Exploit"}},
+	}
+	assert.Equal(t, []string{"https://www.exploit-db.com/exploits/50383"}, getExploitReferences(refs))
+	assert.Empty(t, getExploitReferences(refs[:1]))
+}
+
+func Test_EnrichVulnerabilityWithNvdData_VectorFallback(t *testing.T) {
+	t.Parallel()
+	nvdVuln := createMockNvdVulnerabilityWithV31()
+	data := &nvdVuln.Cve.Metrics.CvssMetricV31[0].CvssData
+	data.AttackVector = ""
+	data.UserInteraction = ""
+	data.ConfidentialityImpact = ""
+	data.AvailabilityImpact = "HIGH" // Conflicts with A:N, the explicit field wins
+
+	var vuln results.Vulnerability
+	require.NoError(t, DefaultEnrichment().enrichVulnerabilityWithNvdData(context.Background(), &vuln, nvdVuln))
+
+	assert.Equal(t, enums.AccessTypeNetwork, vuln.Access)
+	assert.Equal(t, results.UserInteractionNone, vuln.UserInteraction)
+	assert.Equal(t, enums.ImpactTypeHigh, vuln.ConfidentialityImpact)
+	assert.Equal(t, enums.ImpactTypeHigh, vuln.AvailabilityImpact)
+	assert.Empty(t, data.AttackVector, "Expected the NVD record to be left untouched")
+}
+
+func Test_EnrichVulnerabilityWithNvdData_UnmappedValues(t *testing.T) {
+	t.Parallel()
+	nvdVuln := createMockNvdVulnerabilityWithV31()
+	data := &nvdVuln.Cve.Metrics.CvssMetricV31[0].CvssData
+	data.BaseSeverity = "EXTREME"
+	data.AttackVector = "ADJACENT"
+
+	var vuln results.Vulnerability
+	require.NoError(t, DefaultEnrichment().enrichVulnerabilityWithNvdData(context.Background(), &vuln, nvdVuln))
+
+	assert.Equal(t, tools.MapCVSS(data.BaseScore), vuln.BaseSeverity, "Expected the severity of the score")
+	assert.Equal(t, enums.AccessTypeAdjacentNetwork, vuln.Access)
+	assert.Equal(t, map[string]string{"base_severity": "EXTREME", "attack_vector": "ADJACENT"}, vuln.RawMetrics)
+	assert.Contains(t, metrics.Unmapped(), metrics.UnmappedValue{Field: "base_severity", Value: "EXTREME", Count: 1})
+
+	var mapped results.Vulnerability
+	require.NoError(t, DefaultEnrichment().enrichVulnerabilityWithNvdData(context.Background(), &mapped, createMockNvdVulnerabilityWithV31()))
+	assert.Nil(t, mapped.RawMetrics)
+}
+
+func Test_NVDClient_fetchByCPE_Cancellation(t *testing.T) {
+	t.Parallel()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(server.Close)
+	cpe := "cpe:2.3:o:microsoft:windows_10:1607:*:*:*:*:*:*:*"
+
+	t.Run("Scan context", func(t *testing.T) {
+		t.Parallel()
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		defer cancel()
+
+		start := time.Now()
+		_, err := newTestNVDClient(server.URL).fetchByCPE(ctx, cpe)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.Less(t, time.Since(start), DefaultRetryPolicy().InitialDelay, "Expected the retry delay to be abandoned")
+	})
+
+	t.Run("Per-CPE deadline", func(t *testing.T) {
+		t.Parallel()
+		nvd := newTestNVDClient(server.URL, WithCPETimeout(200*time.Millisecond))
+
+		start := time.Now()
+		_, err := nvd.fetchByCPE(context.Background(), cpe)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.Less(t, time.Since(start), DefaultRetryPolicy().InitialDelay)
+	})
+}
+
+func Test_NVDClient_fetchByCPE_VulnerableOnly(t *testing.T) {
+	t.Parallel()
+	var mu sync.Mutex
+	vulnerable := map[string]bool{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		_, vulnerable[r.URL.Query().Get("cpeName")] = r.URL.Query()[client.ParamIsVulnerable]
+		mu.Unlock()
+		json.NewEncoder(w).Encode(schema.NvdAPIResponse{})
+	}))
+	t.Cleanup(server.Close)
+
+	versioned := "cpe:2.3:a:openbsd:openssh:8.2p1:*:*:*:*:*:*:*"
+	versionless := "cpe:2.3:o:linux:linux_kernel:-:*:*:*:*:*:*:*"
+	for _, cpe := range []string{versioned, versionless} {
+		_, err := newTestNVDClient(server.URL, WithVulnerableOnly()).fetchByCPE(context.Background(), cpe)
+		require.NoError(t, err)
+	}
+	assert.True(t, vulnerable[versioned])
+	assert.False(t, vulnerable[versionless], "Expected versionless CPEs to be looked up as before")
+
+	_, err := newTestNVDClient(server.URL).fetchByCPE(context.Background(), versioned)
+	require.NoError(t, err)
+	assert.False(t, vulnerable[versioned], "Expected precision mode to be opt-in")
+}
+
+func Test_NVDClient_fetchByCPE_CVSSFilter(t *testing.T) {
+	t.Parallel()
+	var mu sync.Mutex
+	var queries []url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		queries = append(queries, r.URL.Query())
+		mu.Unlock()
+		severity := r.URL.Query().Get("cvssV3Severity")
+		json.NewEncoder(w).Encode(schema.NvdAPIResponse{
+			TotalResults:    1,
+			ResultsPerPage:  1,
+			Vulnerabilities: []schema.Vulnerability{{Cve: schema.CveDetail{ID: "CVE-2024-" + severity}}},
+		})
+	}))
+	defer server.Close()
+
+	filter, err := ParseCVSSFilter("high, critical", "", "AV:N")
+	require.NoError(t, err)
+	nvd := newTestNVDClient(server.URL, WithCVSSFilter(filter))
+	resp, err := nvd.fetchByCPE(context.Background(), "cpe:2.3:a:openbsd:openssh:8.2p1:*:*:*:*:*:*:*")
+	require.NoError(t, err)
+
+	require.Len(t, queries, 2)
+	for i, severity := range []string{"HIGH", "CRITICAL"} {
+		assert.Equal(t, severity, queries[i].Get("cvssV3Severity"))
+		assert.Equal(t, "AV:N", queries[i].Get("cvssV3Metrics"))
+		assert.Equal(t, "cpe:2.3:a:openbsd:openssh:8.2p1:*:*:*:*:*:*:*", queries[i].Get("cpeName"))
+	}
+	assert.Equal(t, 2, resp.TotalResults)
+	assert.Len(t, resp.Vulnerabilities, 2)
+
+	_, err = ParseCVSSFilter("", "HIGH", "AV:N")
+	assert.ErrorIs(t, err, client.ErrInvalidFilter)
+}
+
+func Test_NVDClient_AdaptivePacing(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name   string
+		status int
+	}{
+		{name: "429", status: http.StatusTooManyRequests},
+		{name: "bare 403", status: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+			}))
+			defer server.Close()
+
+			nvd := newTestNVDClient(server.URL, WithRequestInterval(time.Second), WithAdaptivePacing(), WithAPIKey("key", ""), WithRetryPolicy(RetryPolicy{}))
+			assert.Zero(t, nvd.requestInterval, "Expected the limiter to replace the fixed interval")
+			assert.True(t, nvd.RateLimited())
+			assert.Zero(t, nvd.RequestSpacing())
+
+			_, err := nvd.fetchByCPE(context.Background(), "cpe:2.3:a:openbsd:openssh:8.2p1:*:*:*:*:*:*:*")
+			assert.ErrorIs(t, err, client.ErrRateLimited)
+			assert.Equal(t, client.KeyedRateLimit.Interval(), nvd.RequestSpacing(), "Expected the throttled response to widen the spacing")
+			assert.Equal(t, uint64(1), nvd.Throttled())
+		})
+	}
+}
+
+func Test_NVDClient_KnownExploitedOnly(t *testing.T) {
+	t.Parallel()
+	var mu sync.Mutex
+	var queries []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		queries = append(queries, r.URL.RawQuery)
+		mu.Unlock()
+		json.NewEncoder(w).Encode(schema.NvdAPIResponse{})
+	}))
+	defer server.Close()
+
+	filter, err := ParseNVDFilter("", "", "", "haskev, hasOval")
+	require.NoError(t, err)
+	nvd := newTestNVDClient(server.URL, WithCVSSFilter(filter))
+	_, err = nvd.fetchByCPE(context.Background(), "cpe:2.3:a:apache:log4j:2.14.1:*:*:*:*:*:*:*")
+	require.NoError(t, err)
+	_, err = nvd.fetchByKeyword(context.Background(), "log4j", "", 0)
+	require.NoError(t, err)
+
+	require.Len(t, queries, 2)
+	for _, query := range queries {
+		assert.Contains(t, query, "hasKev&hasOval")
+		assert.NotContains(t, query, "hasKev=", "Expected the flags to be sent without value")
+	}
+
+	_, err = ParseNVDFilter("", "", "", "hasExploit")
+	assert.ErrorIs(t, err, client.ErrInvalidFilter)
+}
+
+type shadowRecorder struct {
+	mu     sync.Mutex
+	scores []risk.ShadowScore
+}
+
+func (r *shadowRecorder) Record(score risk.ShadowScore) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.scores = append(r.scores, score)
+	return nil
+}
+
+func Test_applyRiskModel(t *testing.T) {
+	recorder := &shadowRecorder{}
+	risk.SetRecorder(recorder)
+	t.Cleanup(func() {
+		risk.SetRecorder(risk.LogRecorder{})
+		features.SetDefault(features.NewStaticProvider(nil))
+	})
+
+	ctx := tenant.WithID(context.Background(), "acme")
+	newVuln := func() results.Vulnerability {
+		return results.Vulnerability{Vulnerability: tools.Vulnerability{
+			ID:            "CVE-2021-44228",
+			RiskScore:     0.2,
+			BaseCVSSScore: 10,
+			Exploit:       tools.Exploit{Exploitability: enums.ExploitabilityTypeHigh},
+		}}
+	}
+	candidate := risk.Candidate.Score(newVuln())
+	require.NotEqual(t, 0.2, candidate, "Expected the candidate model to score differently")
+
+	// In shadow mode the current score is kept and the candidate recorded
+	features.SetDefault(features.NewStaticProvider(map[features.Flag]features.Rule{
+		features.FlagRiskModelV2: {Tenants: map[string]features.Mode{"acme": features.ModeShadow}},
+	}))
+	vuln := newVuln()
+	applyRiskModel(ctx, "10.0.0.1", &vuln)
+	assert.Equal(t, 0.2, vuln.RiskScore)
+	require.Len(t, recorder.scores, 1)
+	assert.Equal(t, "acme", recorder.scores[0].TenantID)
+	assert.Equal(t, "10.0.0.1", recorder.scores[0].Host)
+	assert.Equal(t, "CVE-2021-44228", recorder.scores[0].CVEID)
+	assert.Equal(t, 0.2, recorder.scores[0].CurrentScore)
+	assert.Equal(t, candidate, recorder.scores[0].CandidateScore)
+
+	// Once on, the candidate score is published and nothing more recorded
+	features.SetDefault(features.NewStaticProvider(map[features.Flag]features.Rule{
+		features.FlagRiskModelV2: {Tenants: map[string]features.Mode{"acme": features.ModeOn}},
+	}))
+	vuln = newVuln()
+	applyRiskModel(ctx, "10.0.0.1", &vuln)
+	assert.Equal(t, candidate, vuln.RiskScore)
+	assert.Len(t, recorder.scores, 1)
+
+	// Other tenants keep the current model
+	vuln = newVuln()
+	applyRiskModel(tenant.WithID(context.Background(), "globex"), "10.0.0.1", &vuln)
+	assert.Equal(t, 0.2, vuln.RiskScore)
+	assert.Len(t, recorder.scores, 1)
+}
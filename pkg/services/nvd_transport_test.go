@@ -0,0 +1,69 @@
+package services
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/kptm-tools/vulnerability-analysis/nvd/schema"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNVDClient_WithTransportProxy(t *testing.T) {
+	t.Parallel()
+	// Plain HTTP requests reach the proxy with the absolute URL of NVD
+	var proxied []string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Proxy-Authorization") != "Basic "+base64.StdEncoding.EncodeToString([]byte("scanner:s3cret")) {
+			w.WriteHeader(http.StatusProxyAuthRequired)
+			return
+		}
+		proxied = append(proxied, r.URL.Host)
+		require.NoError(t, json.NewEncoder(w).Encode(schema.NvdAPIResponse{}))
+	}))
+	defer proxy.Close()
+
+	transport, err := NewNVDTransport(NVDTransportConfig{ProxyURL: "http://scanner:s3cret@" + proxy.Listener.Addr().String()})
+	require.NoError(t, err)
+	nvd := newTestNVDClient("http://nvd.invalid/rest/json/cves/2.0", WithTransport(transport))
+
+	_, err = nvd.FetchByCVEID(context.Background(), "CVE-2021-44228")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"nvd.invalid"}, proxied)
+}
+
+func TestNewNVDTransport_CABundle(t *testing.T) {
+	t.Parallel()
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, json.NewEncoder(w).Encode(schema.NvdAPIResponse{}))
+	}))
+	defer server.Close()
+
+	bundle := filepath.Join(t.TempDir(), "gateway.pem")
+	require.NoError(t, os.WriteFile(bundle, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0o600))
+
+	transport, err := NewNVDTransport(NVDTransportConfig{CABundle: bundle, MinTLSVersion: "1.2"})
+	require.NoError(t, err)
+	_, err = newTestNVDClient(server.URL, WithTransport(transport)).FetchByCVEID(context.Background(), "CVE-2021-44228")
+	assert.NoError(t, err)
+
+	_, err = newTestNVDClient(server.URL).FetchByCVEID(context.Background(), "CVE-2021-44228")
+	assert.Error(t, err, "Expected the gateway certificate to be untrusted without the bundle")
+
+	for _, cfg := range []NVDTransportConfig{
+		{ProxyURL: "proxy:3128"},
+		{MinTLSVersion: "1.1"},
+		{CABundle: filepath.Join(t.TempDir(), "missing.pem")},
+		{ClientCert: bundle},
+	} {
+		_, err := NewNVDTransport(cfg)
+		assert.Error(t, err, cfg)
+	}
+}
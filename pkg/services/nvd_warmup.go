@@ -0,0 +1,83 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+)
+
+// ErrNoCPECache is returned by WarmCache when the client keeps no CPE lookup.
+var ErrNoCPECache = errors.New("no CPE cache to warm")
+
+// CacheWarmReport counts the CPEs of a WarmCache run. Empty counts the CPEs
+// warmed without CVEs.
+type CacheWarmReport struct {
+	CPEs    int `json:"cpes"`
+	Warmed  int `json:"warmed"`
+	Empty   int `json:"empty"`
+	Invalid int `json:"invalid"`
+	Failed  int `json:"failed"`
+}
+
+// WarmCache looks up cpes, e.g. the CPE inventory of an organization during
+// off-hours, into the caches of WithCPECache, WithSharedCache and
+// WithIncrementalSync, so that the scans of the assets are served from them.
+// CPEs are either CPE 2.3 names or formatted as reported by nmap, which are
+// standardized. They are looked up again even when cached, restarting their
+// TTL. It stops when ctx is done or NVD becomes unavailable, returning the
+// report so far with the error.
+func (c *NVDClient) WarmCache(ctx context.Context, cpes []string) (CacheWarmReport, error) {
+	if c.cpeCache == nil && c.shared == nil && c.sync == nil {
+		return CacheWarmReport{}, ErrNoCPECache
+	}
+
+	var report CacheWarmReport
+	var valid []string
+	seen := make(map[string]bool, len(cpes))
+	for _, raw := range cpes {
+		cpe, err := raw, error(nil)
+		if !strings.HasPrefix(raw, "cpe:2.3:") {
+			cpe, err = standardizeCPE(raw)
+		}
+		if err == nil {
+			err = isValidCPE(cpe)
+		}
+		if err != nil {
+			report.Invalid++
+			continue
+		}
+		if key := cpeCacheKey(cpe); !seen[key] {
+			seen[key] = true
+			valid = append(valid, cpe)
+		}
+	}
+	report.CPEs = len(valid)
+
+	for _, cpe := range valid {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+		if c.CircuitState() == CircuitOpen {
+			return report, ErrNVDCircuitOpen
+		}
+		if c.status.inMaintenance() {
+			return report, c.status.unavailable()
+		}
+
+		lookupCtx, rejected := withRejectedCount(ctx)
+		resp, err := c.lookupCPE(lookupCtx, cpe)
+		if err != nil {
+			report.Failed++
+			slog.Warn("Failed to warm CPE lookup", slog.String("cpe", cpe), slog.Any("error", err))
+			continue
+		}
+		if c.storeCPE(ctx, cpe, resp, rejected.Load()) {
+			report.Warmed++
+			if isEmptyLookup(resp) {
+				report.Empty++
+			}
+		}
+	}
+	return report, nil
+}
@@ -0,0 +1,65 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/kptm-tools/vulnerability-analysis/nvd/schema"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_NVDClient_WarmCache(t *testing.T) {
+	t.Parallel()
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		resp := schema.NvdAPIResponse{}
+		if strings.Contains(r.URL.Query().Get("cpeName"), "openssh") {
+			resp = schema.NvdAPIResponse{TotalResults: 1, ResultsPerPage: 1, Vulnerabilities: []schema.Vulnerability{
+				{Cve: schema.CveDetail{ID: "CVE-2024-6387", VulnStatus: "Analyzed"}},
+			}}
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer server.Close()
+
+	nvd := newTestNVDClient(server.URL, WithCPECache(10, time.Hour))
+	report, err := nvd.WarmCache(context.Background(), []string{
+		"cpe:/a:openbsd:openssh:8.9p1",
+		"cpe:2.3:a:OpenBSD:OpenSSH:8.9p1:*:*:*:*:*:*:*",
+		"cpe:2.3:a:example:unknown:1.0:*:*:*:*:*:*:*",
+		"not a cpe",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, CacheWarmReport{CPEs: 2, Warmed: 2, Empty: 1, Invalid: 1}, report)
+	assert.Equal(t, int32(2), requests.Load())
+
+	resp, err := nvd.fetchByCPE(context.Background(), "cpe:2.3:a:openbsd:openssh:8.9p1:*:*:*:*:*:*:*")
+	require.NoError(t, err)
+	require.Len(t, resp.Vulnerabilities, 1)
+	assert.Equal(t, int32(2), requests.Load(), "Expected warmed CPEs to be served from the cache")
+}
+
+func Test_NVDClient_WarmCache_NoCache(t *testing.T) {
+	t.Parallel()
+	_, err := newTestNVDClient("http://127.0.0.1:0").WarmCache(context.Background(), []string{"cpe:/a:openbsd:openssh:8.9p1"})
+	assert.ErrorIs(t, err, ErrNoCPECache)
+}
+
+func Test_NVDClient_WarmCache_Canceled(t *testing.T) {
+	t.Parallel()
+	nvd := newTestNVDClient("http://127.0.0.1:0", WithCPECache(10, time.Hour))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	report, err := nvd.WarmCache(ctx, []string{"cpe:/a:openbsd:openssh:8.9p1"})
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, CacheWarmReport{CPEs: 1}, report)
+}
@@ -0,0 +1,200 @@
+package services
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/kptm-tools/common/common/pkg/enums"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/results"
+)
+
+// DefaultPriorityProducts are the vendor:product pairs of the CPE dictionary
+// most represented in the CISA Known Exploited Vulnerabilities catalog,
+// whose services are looked up first by WithPriorityEnrichment.
+var DefaultPriorityProducts = []string{
+	"apache:http_server",
+	"apache:tomcat",
+	"atlassian:confluence_data_center",
+	"atlassian:confluence_server",
+	"citrix:netscaler_application_delivery_controller",
+	"citrix:netscaler_gateway",
+	"f5:big-ip_local_traffic_manager",
+	"fortinet:fortios",
+	"ivanti:connect_secure",
+	"microsoft:exchange_server",
+	"oracle:weblogic_server",
+	"paloaltonetworks:pan-os",
+	"vmware:esxi",
+	"vmware:vcenter_server",
+}
+
+// Priorities of a CPE lookup, higher ones are looked up first.
+const (
+	priorityNone = iota
+	priorityProduct
+	priorityHistory
+)
+
+// priorityIndex ranks the CPEs of a host by how likely they are to yield
+// critical or known exploited findings: products which did so in earlier
+// lookups first, then the products of the list.
+type priorityIndex struct {
+	products map[string]bool
+
+	mu      sync.Mutex
+	history map[string]bool
+}
+
+// WithPriorityEnrichment looks the services of a host up starting with the
+// ones likely to yield critical or known exploited findings: the products
+// which did so in earlier scans, then the vendor:product pairs of products,
+// or DefaultPriorityProducts when nil. Once they are looked up, the
+// callback of NotifyPriorityFindings receives their findings before the
+// remaining services are.
+func WithPriorityEnrichment(products []string) NmapServiceOption {
+	if products == nil {
+		products = DefaultPriorityProducts
+	}
+	index := &priorityIndex{products: make(map[string]bool), history: make(map[string]bool)}
+	for _, product := range products {
+		index.products[strings.ToLower(strings.TrimSpace(product))] = true
+	}
+	return func(s *NmapService) {
+		s.priority = index
+	}
+}
+
+// rank returns the priority of the lookup of cpe.
+func (p *priorityIndex) rank(cpe string) int {
+	_, vendor, product, ok := cpeFields(cpe)
+	if !ok {
+		return priorityNone
+	}
+	key := vendor + ":" + product
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	switch {
+	case p.history[key]:
+		return priorityHistory
+	case p.products[key]:
+		return priorityProduct
+	default:
+		return priorityNone
+	}
+}
+
+// observe records whether the lookup of cpe yielded priority findings, so
+// that later scans look the product up first.
+func (p *priorityIndex) observe(cpe string, vulns []results.Vulnerability) {
+	_, vendor, product, ok := cpeFields(cpe)
+	if !ok {
+		return
+	}
+	for _, vuln := range vulns {
+		if isPriorityFinding(vuln) {
+			p.mu.Lock()
+			p.history[vendor+":"+product] = true
+			p.mu.Unlock()
+			return
+		}
+	}
+}
+
+// order returns the indexes of cpes by decreasing priority, keeping the
+// order of the ones of equal priority, and how many have any priority.
+func (p *priorityIndex) order(cpes []string) ([]int, int) {
+	ranks := make([]int, len(cpes))
+	order := make([]int, len(cpes))
+	prioritized := 0
+	for i, cpe := range cpes {
+		order[i] = i
+		if cpe != "" {
+			ranks[i] = p.rank(cpe)
+		}
+		if ranks[i] > priorityNone {
+			prioritized++
+		}
+	}
+	sort.SliceStable(order, func(i, j int) bool { return ranks[order[i]] > ranks[order[j]] })
+	return order, prioritized
+}
+
+// isPriorityFinding reports whether responders act on the finding first.
+func isPriorityFinding(vuln results.Vulnerability) bool {
+	return vuln.KnownExploited || vuln.BaseSeverity == enums.SeverityTypeCritical
+}
+
+// PriorityFindingsFunc receives the preliminary result of a host, holding
+// the critical and known exploited findings of its OS and of the services
+// looked up first.
+type PriorityFindingsFunc func(result *results.NmapResult)
+
+type priorityFindingsKey struct{}
+
+// priorityReport is the callback of a scan and, within the analysis of a
+// host, the part of its result known before its ports are looked up.
+type priorityReport struct {
+	notify PriorityFindingsFunc
+	host   *results.NmapResult
+}
+
+// NotifyPriorityFindings returns a context calling fn with the priority
+// findings of the hosts analyzed with it, when priority enrichment is
+// enabled and lower priority services remain to be looked up.
+func NotifyPriorityFindings(ctx context.Context, fn PriorityFindingsFunc) context.Context {
+	return context.WithValue(ctx, priorityFindingsKey{}, &priorityReport{notify: fn})
+}
+
+// withPriorityHost returns a context reporting the priority findings of the
+// ports of host, if ctx has a callback.
+func withPriorityHost(ctx context.Context, host *results.NmapResult) context.Context {
+	report, ok := ctx.Value(priorityFindingsKey{}).(*priorityReport)
+	if !ok {
+		return ctx
+	}
+	return context.WithValue(ctx, priorityFindingsKey{}, &priorityReport{notify: report.notify, host: host})
+}
+
+// reportPriorityFindings calls the callback of ctx with the priority
+// findings of the OS of the host and of ports, unless there are none.
+func reportPriorityFindings(ctx context.Context, ports []results.PortData) {
+	report, ok := ctx.Value(priorityFindingsKey{}).(*priorityReport)
+	if !ok || report.host == nil {
+		return
+	}
+
+	preliminary := &results.NmapResult{
+		HostName:     report.host.HostName,
+		HostAddress:  report.host.HostAddress,
+		Exposure:     report.host.Exposure,
+		MostLikelyOS: report.host.MostLikelyOS,
+		ScannedPorts: []results.PortData{},
+		Preliminary:  true,
+	}
+	preliminary.MostLikelyOS.Vulnerabilities = priorityFindings(report.host.MostLikelyOS.Vulnerabilities)
+	found := len(preliminary.MostLikelyOS.Vulnerabilities)
+	for _, port := range ports {
+		port.Vulnerabilities = priorityFindings(port.Vulnerabilities)
+		if len(port.Vulnerabilities) > 0 {
+			preliminary.ScannedPorts = append(preliminary.ScannedPorts, port)
+			found += len(port.Vulnerabilities)
+		}
+	}
+	if found == 0 {
+		return
+	}
+	report.notify(preliminary)
+}
+
+func priorityFindings(vulns []results.Vulnerability) []results.Vulnerability {
+	found := []results.Vulnerability{}
+	for _, vuln := range vulns {
+		if isPriorityFinding(vuln) {
+			found = append(found, vuln)
+		}
+	}
+	return found
+}
@@ -0,0 +1,91 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/Ullaakut/nmap/v2"
+	"github.com/kptm-tools/vulnerability-analysis/nvd/schema"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/results"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_priorityIndex_order(t *testing.T) {
+	t.Parallel()
+	s := NewNmapService(nil, WithPriorityEnrichment([]string{"apache:http_server"}))
+	cpes := []string{
+		"cpe:2.3:a:openbsd:openssh:8.2p1:*:*:*:*:*:*:*",
+		"",
+		"cpe:2.3:a:apache:http_server:2.4.41:*:*:*:*:*:*:*",
+		"cpe:2.3:a:dovecot:dovecot:2.3.16:*:*:*:*:*:*:*",
+	}
+
+	order, prioritized := s.priority.order(cpes)
+	assert.Equal(t, []int{2, 0, 1, 3}, order)
+	assert.Equal(t, 1, prioritized)
+
+	// Products which yielded known exploited findings come first next time
+	s.priority.observe(cpes[3], []results.Vulnerability{{KnownExploited: true}})
+	s.priority.observe(cpes[0], []results.Vulnerability{{}})
+	order, prioritized = s.priority.order(cpes)
+	assert.Equal(t, []int{3, 2, 0, 1}, order)
+	assert.Equal(t, 2, prioritized)
+}
+
+func Test_NmapService_PriorityEnrichment(t *testing.T) {
+	t.Parallel()
+	kevAdded := "2024-01-10"
+	var mu sync.Mutex
+	var lookups []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cpe := r.URL.Query().Get("cpeName")
+		mu.Lock()
+		lookups = append(lookups, cpe)
+		mu.Unlock()
+		cve := schema.CveDetail{ID: "CVE-2024-0001", Published: "2024-01-01T00:00:00.000", LastModified: "2024-01-01T00:00:00.000"}
+		if strings.Contains(cpe, "http_server") {
+			cve.ID, cve.CisaExploitAdd = "CVE-2024-0002", &kevAdded
+		}
+		json.NewEncoder(w).Encode(schema.NvdAPIResponse{TotalResults: 1, ResultsPerPage: 1, Vulnerabilities: []schema.Vulnerability{{Cve: cve}}})
+	}))
+	defer server.Close()
+
+	host := nmap.Host{
+		Addresses: []nmap.Address{{Addr: "10.0.0.1", AddrType: "ipv4"}},
+		Ports: []nmap.Port{
+			{ID: 22, Protocol: "tcp", Service: nmap.Service{Name: "ssh", CPEs: []nmap.CPE{"cpe:/a:openbsd:openssh:8.2p1"}}},
+			{ID: 80, Protocol: "tcp", Service: nmap.Service{Name: "http", CPEs: []nmap.CPE{"cpe:/a:apache:http_server:2.4.41"}}},
+		},
+	}
+
+	var preliminary []*results.NmapResult
+	ctx := NotifyPriorityFindings(context.Background(), func(result *results.NmapResult) {
+		mu.Lock()
+		defer mu.Unlock()
+		// The remaining ports are looked up after the priority findings are reported
+		assert.Len(t, lookups, 1)
+		preliminary = append(preliminary, result)
+	})
+	s := NewNmapService(newTestNVDClient(server.URL), WithPriorityEnrichment(nil))
+	result := s.enrichHost(ctx, host)
+
+	require.Len(t, lookups, 2)
+	assert.Contains(t, lookups[0], "http_server")
+	require.Len(t, result.ScannedPorts, 2, "Expected the ports to keep the scan order")
+	assert.Equal(t, uint16(22), result.ScannedPorts[0].ID)
+	require.Len(t, result.ScannedPorts[1].Vulnerabilities, 1)
+	assert.True(t, result.ScannedPorts[1].Vulnerabilities[0].KnownExploited)
+
+	require.Len(t, preliminary, 1)
+	assert.True(t, preliminary[0].Preliminary)
+	assert.Equal(t, "10.0.0.1", preliminary[0].HostAddress)
+	require.Len(t, preliminary[0].ScannedPorts, 1)
+	assert.Equal(t, uint16(80), preliminary[0].ScannedPorts[0].ID)
+	assert.Equal(t, "CVE-2024-0002", preliminary[0].ScannedPorts[0].Vulnerabilities[0].ID)
+}
@@ -0,0 +1,124 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/kptm-tools/vulnerability-analysis/nvd/schema"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/results"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/risk"
+)
+
+// appendPSIRTFindings adds the CVEs of the vendor advisories for cpe that NVD
+// didn't match. CVEs already found get the advisory as a reference. New CVEs
+// are built from the knowledge cache record when available, otherwise from
+// the advisory itself.
+func (s *NmapService) appendPSIRTFindings(ctx context.Context, hostAddress string, exposure results.ExposureType, cpe string, vulns []results.Vulnerability) []results.Vulnerability {
+	if s.psirt == nil || cpe == "" {
+		return vulns
+	}
+
+	advisories, err := s.psirt.Lookup(ctx, cpe)
+	if err != nil {
+		slog.Warn("Failed to fetch vendor advisories, keeping NVD findings only",
+			slog.String("cpe", cpe),
+			slog.Any("error", err))
+		degrade(ctx, SignalVendorAdvisories, err)
+		return vulns
+	}
+
+	index := make(map[string]int, len(vulns))
+	for i, vuln := range vulns {
+		index[vuln.ID] = i
+	}
+
+	added := 0
+	for _, advisory := range advisories {
+		for _, cveID := range advisory.CVEs {
+			if i, ok := index[cveID]; ok {
+				if advisory.URL != "" && !slices.Contains(vulns[i].References, advisory.URL) {
+					vulns[i].References = append(vulns[i].References, advisory.URL)
+				}
+				continue
+			}
+
+			vuln := s.advisoryVulnerability(ctx, cveID, advisoryRecord{
+				Type:      advisory.Vendor,
+				Title:     advisory.Title,
+				URL:       advisory.URL,
+				CVSSScore: advisory.CVSSScore,
+				Severity:  advisory.Severity,
+				Published: advisory.Published,
+			}, exposure)
+			applyRiskModel(ctx, hostAddress, &vuln)
+			vuln.Provenance = &results.Provenance{
+				Source:     "psirt:" + advisory.Vendor,
+				InputCPE:   cpe,
+				MatchedCPE: cpe,
+			}
+			index[cveID] = len(vulns)
+			vulns = append(vulns, vuln)
+			added++
+		}
+	}
+
+	if added > 0 {
+		slog.Info("Found vulnerabilities missing from NVD in vendor advisories",
+			slog.Int("n_vulners", added),
+			slog.String("cpe", cpe))
+	}
+	return vulns
+}
+
+// advisoryRecord is the part of a vendor or ICS advisory used to report a
+// CVE NVD didn't match.
+type advisoryRecord struct {
+	Type      string
+	Title     string
+	URL       string
+	CVSSScore float64
+	Severity  string
+	Published time.Time
+}
+
+// advisoryVulnerability builds the finding of a CVE found through an
+// advisory, from the knowledge cache record when available. Built from the
+// advisory alone, it lacks the KEV status and exploit references of the NVD
+// record, which degrades the result.
+func (s *NmapService) advisoryVulnerability(ctx context.Context, cveID string, advisory advisoryRecord, exposure results.ExposureType) results.Vulnerability {
+	vuln := results.Vulnerability{Exposure: exposure}
+
+	if s.nvd.knowledge != nil {
+		if resp, err := s.nvd.knowledge.LookupCVE(cveID); err == nil && len(resp.Vulnerabilities) > 0 {
+			if err := s.enrichment.enrichVulnerabilityWithNvdData(ctx, &vuln, resp.Vulnerabilities[0]); err == nil {
+				if advisory.URL != "" && !slices.Contains(vuln.References, advisory.URL) {
+					vuln.References = append(vuln.References, advisory.URL)
+				}
+				return vuln
+			}
+			vuln = results.Vulnerability{Exposure: exposure}
+		}
+	}
+
+	err := fmt.Errorf("no NVD record of %s, only the %s advisory", cveID, advisory.Type)
+	degrade(ctx, SignalKEV, err)
+	degrade(ctx, SignalExploitIntel, err)
+
+	vuln.ID = cveID
+	vuln.Type = advisory.Type
+	vuln.Description = advisory.Title
+	if advisory.URL != "" {
+		vuln.References = []string{advisory.URL}
+	}
+	vuln.BaseCVSSScore = advisory.CVSSScore
+	vuln.BaseSeverity = mapSeverityType(schema.SeverityType(strings.ToUpper(advisory.Severity)))
+	vuln.Published = advisory.Published
+	vuln.LastUpdated = advisory.Published
+	vuln.Likelihood = s.enrichment.calculateLikelihood(vuln)
+	vuln.RiskScore = risk.Current.Score(vuln)
+	return vuln
+}
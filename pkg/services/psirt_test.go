@@ -0,0 +1,65 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"github.com/kptm-tools/common/common/pkg/enums"
+	"github.com/kptm-tools/common/common/pkg/results/tools"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/psirt"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/results"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type stubPSIRTConnector struct {
+	advisories []psirt.Advisory
+}
+
+func (s stubPSIRTConnector) Vendor() string { return "cisco" }
+
+func (s stubPSIRTConnector) Lookup(ctx context.Context, cpe psirt.CPE) ([]psirt.Advisory, error) {
+	return s.advisories, nil
+}
+
+func Test_appendPSIRTFindings(t *testing.T) {
+	t.Parallel()
+	s := NewNmapService(newTestNVDClient("http://127.0.0.1:0"), WithPSIRTRegistry(psirt.NewRegistry(stubPSIRTConnector{advisories: []psirt.Advisory{{
+		ID:        "cisco-sa-1",
+		Vendor:    "cisco",
+		Title:     "Cisco ASA Software VPN Denial of Service Vulnerability",
+		URL:       "https://sec.cloudapps.cisco.com/security/center/content/CiscoSecurityAdvisory/cisco-sa-1",
+		CVEs:      []string{"CVE-2024-0001", "CVE-2024-0002"},
+		Severity:  "High",
+		CVSSScore: 8.6,
+	}}})))
+
+	cpe := "cpe:2.3:o:cisco:adaptive_security_appliance_software:9.8:*:*:*:*:*:*:*"
+	nvdVulns := []results.Vulnerability{{Vulnerability: tools.Vulnerability{ID: "CVE-2024-0001"}}}
+
+	ctx, degraded := withDegradation(context.Background())
+	vulns := s.appendPSIRTFindings(ctx, "10.0.0.1", results.ExposureInternal, cpe, nvdVulns)
+	require.Len(t, vulns, 2)
+
+	assert.Contains(t, vulns[0].References, "https://sec.cloudapps.cisco.com/security/center/content/CiscoSecurityAdvisory/cisco-sa-1")
+	assert.Nil(t, vulns[0].Provenance, "Expected the NVD finding to keep its provenance")
+
+	added := vulns[1]
+	assert.Equal(t, "CVE-2024-0002", added.ID)
+	assert.Equal(t, enums.SeverityTypeHigh, added.BaseSeverity)
+	assert.Equal(t, 8.6, added.BaseCVSSScore)
+	assert.Equal(t, results.ExposureInternal, added.Exposure)
+	require.NotNil(t, added.Provenance)
+	assert.Equal(t, "psirt:cisco", added.Provenance.Source)
+
+	// Without an NVD record, the KEV status and exploits of the CVE are unknown
+	missing := "no NVD record of CVE-2024-0002, only the cisco advisory"
+	assert.Equal(t, []results.MissingSignal{
+		{Signal: SignalKEV, Failures: 1, Error: missing},
+		{Signal: SignalExploitIntel, Failures: 1, Error: missing},
+	}, degraded.notice().Missing)
+
+	// Application CPEs are not looked up
+	vulns = s.appendPSIRTFindings(context.Background(), "10.0.0.1", results.ExposureInternal, "cpe:2.3:a:cisco:webex:1.0:*:*:*:*:*:*:*", nil)
+	assert.Empty(t, vulns)
+}
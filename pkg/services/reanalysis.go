@@ -0,0 +1,164 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/Ullaakut/nmap/v2"
+	"github.com/google/uuid"
+	"github.com/kptm-tools/common/common/pkg/enums"
+	"github.com/kptm-tools/common/common/pkg/results/tools"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/results"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/scans"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/tenant"
+)
+
+// WithScanStore records the analyzed hosts of every scan in store, so that
+// they can be analyzed again with Reanalyze.
+func WithScanStore(store *scans.Store) NmapServiceOption {
+	return func(s *NmapService) {
+		s.scans = store
+	}
+}
+
+// snapshot copies the enrichment of a host, before it is classified and
+// prepared in place, when the scan is known and hosts are recorded. It
+// returns nil otherwise.
+func (s *NmapService) snapshot(ctx context.Context, result *results.NmapResult) *results.NmapResult {
+	if s.scans == nil {
+		return nil
+	}
+	if _, ok := scans.ScanIDFromContext(ctx); !ok {
+		return nil
+	}
+	clone, err := cloneResult(result)
+	if err != nil {
+		slog.Warn("Failed to record the scanned host for reanalysis",
+			slog.String("host_address", result.HostAddress),
+			slog.Any("error", err))
+		return nil
+	}
+	return clone
+}
+
+// remember records a revision of host with its enrichment, as returned by
+// snapshot, and its final result, which is copied since it is later prepared
+// for publication in place.
+func (s *NmapService) remember(ctx context.Context, host nmap.Host, enriched, final *results.NmapResult) {
+	if enriched == nil {
+		return
+	}
+	scanID, _ := scans.ScanIDFromContext(ctx)
+	clone, err := cloneResult(final)
+	if err != nil {
+		slog.Warn("Failed to record the result of the scanned host",
+			slog.String("host_address", final.HostAddress),
+			slog.Any("error", err))
+		return
+	}
+	now := time.Now().UTC()
+	s.scans.Save(scans.Record{
+		ScanID:     scanID,
+		TenantID:   tenant.FromContext(ctx),
+		Host:       host,
+		ScannedAt:  now,
+		Result:     enriched,
+		Final:      clone,
+		AnalyzedAt: now,
+	})
+}
+
+// Reanalyze runs the enrichment of a host of a recent scan of tenantID again,
+// of every CPE detected on it, or only of cpe when set, and returns the
+// updated result. Hosts scanned for another tenant are reported as not found.
+func (s *NmapService) Reanalyze(ctx context.Context, scanID uuid.UUID, tenantID, hostAddress, cpe string) (tools.ToolResult, error) {
+	if s.scans == nil {
+		return tools.ToolResult{}, scans.ErrNotFound
+	}
+	record, err := s.scans.Get(scanID, hostAddress)
+	if err != nil {
+		return tools.ToolResult{}, err
+	}
+	if record.TenantID != tenant.FromContext(tenant.WithID(ctx, tenantID)) {
+		return tools.ToolResult{}, scans.ErrNotFound
+	}
+	ctx = scans.WithScanID(tenant.WithID(ctx, record.TenantID), scanID)
+
+	var result *results.NmapResult
+	if cpe == "" {
+		result = s.enrichHost(ctx, record.Host)
+	} else {
+		if result, err = s.reanalyzeCPE(ctx, record, cpe); err != nil {
+			return tools.ToolResult{}, err
+		}
+	}
+	enriched := s.snapshot(ctx, result)
+	s.finishResult(result)
+	s.remember(ctx, record.Host, enriched, result)
+
+	slog.Info("Reanalyzed host",
+		slog.String("scan_id", scanID.String()),
+		slog.String("host_address", hostAddress),
+		slog.String("cpe", cpe),
+		slog.Any("summary", result))
+
+	return tools.ToolResult{
+		Tool:      enums.ToolNmap,
+		Result:    result,
+		Timestamp: time.Now().UTC(),
+	}, nil
+}
+
+// reanalyzeCPE enriches again the OS and ports of a recorded host detected
+// with cpe, keeping the findings of the other ports. The cached lookups of
+// cpe are dropped, the CVEs of the product having likely changed.
+func (s *NmapService) reanalyzeCPE(ctx context.Context, record scans.Record, cpe string) (*results.NmapResult, error) {
+	if standardized, err := standardizeCPE(cpe); err == nil {
+		cpe = standardized
+	}
+	if err := s.nvd.InvalidateCPE(ctx, cpe); err != nil {
+		slog.Warn("Reanalyzing with a cached CPE lookup", slog.String("cpe", cpe), slog.Any("error", err))
+	}
+	result, err := cloneResult(record.Result)
+	if err != nil {
+		return nil, err
+	}
+
+	matched := false
+	if result.MostLikelyOS.CPE == cpe {
+		matched = true
+		result.MostLikelyOS = s.enrichOS(ctx, record.Host, result.HostAddress, result.Exposure)
+	}
+	for i, p := range result.ScannedPorts {
+		if p.Service.CPE != cpe {
+			continue
+		}
+		for _, port := range record.Host.Ports {
+			if port.ID == p.ID && port.Protocol == p.Protocol {
+				matched = true
+				result.ScannedPorts[i] = s.processPorts(ctx, result.HostAddress, []nmap.Port{port})[0]
+				break
+			}
+		}
+	}
+	if !matched {
+		return nil, fmt.Errorf("%w: %s", scans.ErrCPENotFound, cpe)
+	}
+	return result, nil
+}
+
+// cloneResult deep copies a result through its JSON encoding.
+func cloneResult(result *results.NmapResult) (*results.NmapResult, error) {
+	data, err := json.Marshal(result)
+	if err != nil {
+		return nil, fmt.Errorf("failed to copy result: %w", err)
+	}
+	var clone results.NmapResult
+	if err := json.Unmarshal(data, &clone); err != nil {
+		return nil, fmt.Errorf("failed to copy result: %w", err)
+	}
+	return &clone, nil
+}
@@ -0,0 +1,106 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/Ullaakut/nmap/v2"
+	"github.com/google/uuid"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/results"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/scans"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/tenant"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_NmapService_Reanalyze(t *testing.T) {
+	t.Parallel()
+	var mu sync.Mutex
+	var cpes []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		cpes = append(cpes, r.URL.Query().Get("cpeName"))
+		mu.Unlock()
+
+		content, err := os.ReadFile("testdata/nvd_api_success.json")
+		if err != nil {
+			t.Fatalf("Failed to read test data file: %v", err)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(content)
+	}))
+	defer server.Close()
+
+	host := nmap.Host{
+		Addresses: []nmap.Address{{Addr: "10.0.0.1", AddrType: "ipv4"}},
+		Ports: []nmap.Port{
+			{ID: 22, Protocol: "tcp", Service: nmap.Service{Name: "ssh", CPEs: []nmap.CPE{"cpe:/a:openbsd:openssh:8.2p1"}}},
+			{ID: 80, Protocol: "tcp", Service: nmap.Service{Name: "http", CPEs: []nmap.CPE{"cpe:/a:apache:http_server:2.4.41"}}},
+		},
+	}
+	store := scans.NewStore(10)
+	s := NewNmapService(newTestNVDClient(server.URL), WithScanStore(store))
+	scanID := uuid.New()
+
+	// Hosts are only recorded when the scan is known
+	s.createNmapResult(tenant.WithID(context.Background(), "acme"), host)
+	assert.Zero(t, store.Len())
+
+	ctx := scans.WithScanID(tenant.WithID(context.Background(), "acme"), scanID)
+	scanned := s.createNmapResult(ctx, host)
+	require.Equal(t, 1, store.Len())
+
+	mu.Lock()
+	cpes = nil
+	mu.Unlock()
+
+	t.Run("Single CPE", func(t *testing.T) {
+		result, err := s.Reanalyze(context.Background(), scanID, "acme", "10.0.0.1", "cpe:/a:apache:http_server:2.4.41")
+		require.NoError(t, err)
+
+		mu.Lock()
+		assert.NotEmpty(t, cpes)
+		for _, cpe := range cpes {
+			assert.Equal(t, "cpe:2.3:a:apache:http_server:2.4.41:*:*:*:*:*:*:*", cpe, "Expected only the CPE to be looked up again")
+		}
+		cpes = nil
+		mu.Unlock()
+
+		nmapResult, ok := result.Result.(*results.NmapResult)
+		require.True(t, ok)
+		require.Len(t, nmapResult.ScannedPorts, 2)
+		assert.Equal(t, vulnerabilityIDs(scanned.ScannedPorts[0].Vulnerabilities), vulnerabilityIDs(nmapResult.ScannedPorts[0].Vulnerabilities))
+		assert.NotEmpty(t, nmapResult.ScannedPorts[1].Vulnerabilities)
+	})
+
+	t.Run("Whole host", func(t *testing.T) {
+		_, err := s.Reanalyze(context.Background(), scanID, "acme", "10.0.0.1", "")
+		require.NoError(t, err)
+
+		mu.Lock()
+		assert.Contains(t, cpes, "cpe:2.3:a:openbsd:openssh:8.2p1:*:*:*:*:*:*:*")
+		assert.Contains(t, cpes, "cpe:2.3:a:apache:http_server:2.4.41:*:*:*:*:*:*:*")
+		mu.Unlock()
+	})
+
+	t.Run("Not found", func(t *testing.T) {
+		_, err := s.Reanalyze(context.Background(), scanID, "globex", "10.0.0.1", "")
+		assert.ErrorIs(t, err, scans.ErrNotFound)
+		_, err = s.Reanalyze(context.Background(), uuid.New(), "acme", "10.0.0.1", "")
+		assert.ErrorIs(t, err, scans.ErrNotFound)
+		_, err = s.Reanalyze(context.Background(), scanID, "acme", "10.0.0.1", "cpe:/a:isc:bind:9.16.1")
+		assert.ErrorIs(t, err, scans.ErrCPENotFound)
+	})
+}
+
+func vulnerabilityIDs(vulns []results.Vulnerability) []string {
+	ids := make([]string, 0, len(vulns))
+	for _, v := range vulns {
+		ids = append(ids, v.ID)
+	}
+	return ids
+}
@@ -0,0 +1,117 @@
+package spill
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Buffer accumulates values in memory until a threshold is reached, after
+// which further values are appended as JSON lines to a temporary file.
+// Values are always yielded back in insertion order.
+type Buffer[T any] struct {
+	threshold int
+	dir       string
+
+	mem     []T
+	file    *os.File
+	writer  *bufio.Writer
+	enc     *json.Encoder
+	spilled int
+}
+
+// New creates a Buffer that keeps up to threshold values in memory.
+// A threshold <= 0 never spills. Temporary files are created in dir,
+// or in the default temp directory when dir is empty.
+func New[T any](threshold int, dir string) *Buffer[T] {
+	return &Buffer[T]{
+		threshold: threshold,
+		dir:       dir,
+	}
+}
+
+// Add appends a value to the buffer.
+func (b *Buffer[T]) Add(v T) error {
+	if b.threshold <= 0 || len(b.mem) < b.threshold {
+		b.mem = append(b.mem, v)
+		return nil
+	}
+
+	if b.file == nil {
+		f, err := os.CreateTemp(b.dir, "vuln-spill-*.jsonl")
+		if err != nil {
+			return fmt.Errorf("failed to create spill file: %w", err)
+		}
+		b.file = f
+		b.writer = bufio.NewWriter(f)
+		b.enc = json.NewEncoder(b.writer)
+	}
+
+	if err := b.enc.Encode(v); err != nil {
+		return fmt.Errorf("failed to spill value: %w", err)
+	}
+	b.spilled++
+	return nil
+}
+
+// Len returns the number of values in the buffer.
+func (b *Buffer[T]) Len() int {
+	return len(b.mem) + b.spilled
+}
+
+// Spilled reports whether any value was written to disk.
+func (b *Buffer[T]) Spilled() bool {
+	return b.spilled > 0
+}
+
+// Range calls fn for each value in insertion order, stopping at the first error.
+func (b *Buffer[T]) Range(fn func(v T) error) error {
+	for _, v := range b.mem {
+		if err := fn(v); err != nil {
+			return err
+		}
+	}
+
+	if b.file == nil {
+		return nil
+	}
+
+	if err := b.writer.Flush(); err != nil {
+		return fmt.Errorf("failed to flush spill file: %w", err)
+	}
+	if _, err := b.file.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to rewind spill file: %w", err)
+	}
+	// Restore the append position once reading is done
+	defer b.file.Seek(0, io.SeekEnd)
+
+	dec := json.NewDecoder(bufio.NewReader(b.file))
+	for i := 0; i < b.spilled; i++ {
+		var v T
+		if err := dec.Decode(&v); err != nil {
+			return fmt.Errorf("failed to read spilled value %d: %w", i, err)
+		}
+		if err := fn(v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close releases the in-memory values and removes the spill file, if any.
+func (b *Buffer[T]) Close() error {
+	b.mem = nil
+	if b.file == nil {
+		return nil
+	}
+
+	name := b.file.Name()
+	closeErr := b.file.Close()
+	b.file = nil
+	if err := os.Remove(name); err != nil {
+		return fmt.Errorf("failed to remove spill file: %w", err)
+	}
+	return closeErr
+}
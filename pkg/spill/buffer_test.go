@@ -0,0 +1,78 @@
+package spill
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type item struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+func collect(t *testing.T, b *Buffer[item]) []item {
+	t.Helper()
+	var got []item
+	err := b.Range(func(v item) error {
+		got = append(got, v)
+		return nil
+	})
+	assert.NoError(t, err)
+	return got
+}
+
+func Test_Buffer(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		name        string
+		threshold   int
+		n           int
+		wantSpilled bool
+	}{
+		{name: "Below threshold", threshold: 10, n: 5, wantSpilled: false},
+		{name: "Above threshold", threshold: 3, n: 10, wantSpilled: true},
+		{name: "Spilling disabled", threshold: 0, n: 10, wantSpilled: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			b := New[item](tc.threshold, t.TempDir())
+			defer b.Close()
+
+			want := make([]item, 0, tc.n)
+			for i := 0; i < tc.n; i++ {
+				v := item{ID: i, Name: "vuln"}
+				want = append(want, v)
+				assert.NoError(t, b.Add(v))
+			}
+
+			assert.Equal(t, tc.n, b.Len())
+			assert.Equal(t, tc.wantSpilled, b.Spilled())
+			assert.Equal(t, want, collect(t, b))
+
+			// Ranging twice must yield the same values
+			assert.Equal(t, want, collect(t, b))
+		})
+	}
+}
+
+func Test_Buffer_CloseRemovesSpillFile(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	b := New[item](1, dir)
+
+	assert.NoError(t, b.Add(item{ID: 1}))
+	assert.NoError(t, b.Add(item{ID: 2}))
+
+	entries, err := os.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+
+	assert.NoError(t, b.Close())
+
+	entries, err = os.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+}
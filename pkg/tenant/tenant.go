@@ -0,0 +1,27 @@
+package tenant
+
+import "context"
+
+// DefaultID is used when a scan does not specify the tenant it belongs to.
+const DefaultID = "default"
+
+type contextKey struct{}
+
+// WithID returns a copy of ctx carrying the given tenant ID.
+func WithID(ctx context.Context, id string) context.Context {
+	if id == "" {
+		id = DefaultID
+	}
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext returns the tenant ID stored in ctx, or DefaultID.
+func FromContext(ctx context.Context) string {
+	if ctx == nil {
+		return DefaultID
+	}
+	if id, ok := ctx.Value(contextKey{}).(string); ok && id != "" {
+		return id
+	}
+	return DefaultID
+}
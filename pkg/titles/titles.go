@@ -0,0 +1,133 @@
+// Package titles generates readable headings for findings, which NVD doesn't
+// publish, from the affected product, the weaknesses and the description of
+// the CVE, e.g. "OpenSSH 8.0 Remote Code Execution — CVE-2024-6387".
+package titles
+
+import (
+	"strings"
+)
+
+// fallbackImpact is used when neither the description nor the CWEs tell the
+// kind of vulnerability.
+const fallbackImpact = "Vulnerability"
+
+// impactPhrases map description wording to an impact, in priority order: NVD
+// descriptions often list several outcomes, e.g. "cause a denial of service
+// or possibly execute arbitrary code", and the worst one names the finding.
+var impactPhrases = []struct {
+	impact  string
+	phrases []string
+}{
+	{"Code Execution", []string{"execute arbitrary code", "arbitrary code execution", "remote code execution", "execute arbitrary commands", "execution of arbitrary code", "code execution"}},
+	{"SQL Injection", []string{"sql injection", "execute arbitrary sql"}},
+	{"Command Injection", []string{"command injection", "inject arbitrary commands"}},
+	{"Cross-Site Scripting", []string{"cross-site scripting", "cross site scripting", "(xss)", "inject arbitrary web script"}},
+	{"Server-Side Request Forgery", []string{"server-side request forgery", "(ssrf)"}},
+	{"Cross-Site Request Forgery", []string{"cross-site request forgery", "(csrf)"}},
+	{"Path Traversal", []string{"directory traversal", "path traversal"}},
+	{"Privilege Escalation", []string{"gain privileges", "escalate privileges", "privilege escalation", "elevation of privilege", "gain root", "elevated privileges"}},
+	{"Authentication Bypass", []string{"bypass authentication", "authentication bypass", "bypass the authentication"}},
+	{"Security Bypass", []string{"bypass intended access restrictions", "bypass access restrictions", "security bypass", "bypass security restrictions"}},
+	{"Information Disclosure", []string{"obtain sensitive information", "information disclosure", "read arbitrary files", "disclose sensitive information", "information leak"}},
+	{"Denial of Service", []string{"denial of service", "crash", "resource exhaustion"}},
+}
+
+// remotePhrases tell a code execution is reachable over the network.
+var remotePhrases = []string{"remote attacker", "remote unauthenticated", "remotely", "unauthenticated attacker", "over the network", "via a crafted request", "via crafted packets"}
+
+// cweImpacts name the most common weaknesses, for descriptions that don't
+// state the impact.
+var cweImpacts = map[string]string{
+	"CWE-20":  "Improper Input Validation",
+	"CWE-22":  "Path Traversal",
+	"CWE-77":  "Command Injection",
+	"CWE-78":  "OS Command Injection",
+	"CWE-79":  "Cross-Site Scripting",
+	"CWE-89":  "SQL Injection",
+	"CWE-94":  "Code Injection",
+	"CWE-119": "Memory Corruption",
+	"CWE-120": "Buffer Overflow",
+	"CWE-121": "Stack Buffer Overflow",
+	"CWE-122": "Heap Buffer Overflow",
+	"CWE-125": "Out-of-Bounds Read",
+	"CWE-190": "Integer Overflow",
+	"CWE-200": "Information Disclosure",
+	"CWE-269": "Privilege Escalation",
+	"CWE-287": "Authentication Bypass",
+	"CWE-295": "Improper Certificate Validation",
+	"CWE-306": "Missing Authentication",
+	"CWE-352": "Cross-Site Request Forgery",
+	"CWE-362": "Race Condition",
+	"CWE-400": "Resource Exhaustion",
+	"CWE-416": "Use After Free",
+	"CWE-434": "Unrestricted File Upload",
+	"CWE-476": "NULL Pointer Dereference",
+	"CWE-502": "Insecure Deserialization",
+	"CWE-611": "XML External Entity Injection",
+	"CWE-787": "Out-of-Bounds Write",
+	"CWE-798": "Hard-Coded Credentials",
+	"CWE-862": "Missing Authorization",
+	"CWE-863": "Incorrect Authorization",
+	"CWE-918": "Server-Side Request Forgery",
+}
+
+// Generate returns the title of the finding id on product and version, both
+// optional. The impact is taken from the description, then from the first
+// known CWE.
+func Generate(product, version string, cwes []string, description, id string) string {
+	parts := make([]string, 0, 3)
+	if label := productLabel(product, version); label != "" {
+		parts = append(parts, label)
+	}
+	parts = append(parts, Impact(cwes, description))
+
+	title := strings.Join(parts, " ")
+	if id != "" {
+		title += " — " + id
+	}
+	return title
+}
+
+// Impact returns the kind of vulnerability the description or CWEs describe.
+func Impact(cwes []string, description string) string {
+	desc := strings.ToLower(description)
+	for _, p := range impactPhrases {
+		if !containsAny(desc, p.phrases) {
+			continue
+		}
+		if p.impact == "Code Execution" {
+			if containsAny(desc, remotePhrases) {
+				return "Remote Code Execution"
+			}
+			return "Arbitrary Code Execution"
+		}
+		return p.impact
+	}
+
+	for _, cwe := range cwes {
+		if impact, ok := cweImpacts[strings.ToUpper(strings.TrimSpace(cwe))]; ok {
+			return impact
+		}
+	}
+	return fallbackImpact
+}
+
+// productLabel joins the product with the first word of the version, as nmap
+// appends the distribution patch level, e.g. "8.2p1 Ubuntu 4ubuntu0.5".
+func productLabel(product, version string) string {
+	product = strings.TrimSpace(product)
+	fields := strings.Fields(version)
+	if product == "" || len(fields) == 0 || strings.Contains(product, fields[0]) {
+		return product
+	}
+	return product + " " + fields[0]
+}
+
+func containsAny(s string, substrs []string) bool {
+	for _, substr := range substrs {
+		if strings.Contains(s, substr) {
+			return true
+		}
+	}
+	return false
+}
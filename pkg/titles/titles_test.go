@@ -0,0 +1,93 @@
+package titles
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenerate(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name        string
+		product     string
+		version     string
+		cwes        []string
+		description string
+		id          string
+		want        string
+	}{
+		{
+			name:        "remote code execution",
+			product:     "OpenSSH",
+			version:     "8.0",
+			cwes:        []string{"CWE-364"},
+			description: "A signal handler race condition was found in sshd, which allows a remote attacker to execute arbitrary code as root.",
+			id:          "CVE-2024-6387",
+			want:        "OpenSSH 8.0 Remote Code Execution — CVE-2024-6387",
+		},
+		{
+			name:        "worst impact of the description",
+			product:     "Apache httpd",
+			version:     "2.4.41",
+			description: "Local users can cause a denial of service or possibly execute arbitrary code via a crafted configuration file.",
+			id:          "CVE-2024-0001",
+			want:        "Apache httpd 2.4.41 Arbitrary Code Execution — CVE-2024-0001",
+		},
+		{
+			name:        "distribution patch level dropped",
+			product:     "OpenSSH",
+			version:     "8.2p1 Ubuntu 4ubuntu0.5",
+			description: "ssh-agent allows remote attackers to obtain sensitive information from memory.",
+			id:          "CVE-2024-0002",
+			want:        "OpenSSH 8.2p1 Information Disclosure — CVE-2024-0002",
+		},
+		{
+			name:        "version already in the product",
+			product:     "Microsoft Windows 10 1607",
+			version:     "1607",
+			description: "Windows Kernel Elevation of Privilege Vulnerability",
+			id:          "CVE-2024-0003",
+			want:        "Microsoft Windows 10 1607 Privilege Escalation — CVE-2024-0003",
+		},
+		{
+			name:        "impact from the CWE",
+			product:     "nginx",
+			cwes:        []string{"NVD-CWE-Other", "CWE-416"},
+			description: "A vulnerability in the resolver of nginx.",
+			id:          "CVE-2024-0004",
+			want:        "nginx Use After Free — CVE-2024-0004",
+		},
+		{
+			name: "nothing known",
+			id:   "CVE-2024-0005",
+			want: "Vulnerability — CVE-2024-0005",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, Generate(tt.product, tt.version, tt.cwes, tt.description, tt.id))
+		})
+	}
+}
+
+func TestImpact(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		description string
+		want        string
+	}{
+		{"SQL injection vulnerability in login.php allows remote attackers to execute arbitrary SQL commands.", "SQL Injection"},
+		{"Cross-site scripting (XSS) vulnerability in the admin panel.", "Cross-Site Scripting"},
+		{"Directory traversal vulnerability allows reading files outside the web root.", "Path Traversal"},
+		{"Allows remote attackers to bypass authentication via a crafted cookie.", "Authentication Bypass"},
+		{"A NULL pointer dereference allows attackers to cause a denial of service (daemon crash).", "Denial of Service"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			assert.Equal(t, tt.want, Impact(nil, tt.description))
+		})
+	}
+}
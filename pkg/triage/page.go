@@ -0,0 +1,64 @@
+package triage
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+)
+
+// Page is a window of the findings matching a filter. Total counts every
+// matching finding, and NextCursor is empty on the last page.
+type Page struct {
+	Findings   []Finding `json:"findings"`
+	Total      int       `json:"total"`
+	NextCursor string    `json:"next_cursor,omitempty"`
+}
+
+// ListPage returns up to limit findings matching filter, following the ones
+// before cursor in List order. An empty cursor starts at the first finding
+// and a limit <= 0 returns every remaining finding.
+//
+// The cursor is the key of the last finding returned rather than an offset,
+// so findings created or transitioned between two requests neither shift
+// nor repeat the following pages.
+func (s *Store) ListPage(filter Filter, cursor string, limit int) (Page, error) {
+	var after *Key
+	if cursor != "" {
+		key, err := decodeCursor(cursor)
+		if err != nil {
+			return Page{}, err
+		}
+		after = &key
+	}
+
+	findings := s.List(filter)
+	page := Page{Findings: []Finding{}, Total: len(findings)}
+	for _, f := range findings {
+		if after != nil && !after.less(f.Key) {
+			continue
+		}
+		if limit > 0 && len(page.Findings) == limit {
+			page.NextCursor = encodeCursor(page.Findings[limit-1].Key)
+			break
+		}
+		page.Findings = append(page.Findings, f)
+	}
+	return page, nil
+}
+
+func encodeCursor(key Key) string {
+	raw, _ := json.Marshal(key)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func decodeCursor(cursor string) (Key, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return Key{}, fmt.Errorf("%w: %w", ErrInvalidCursor, err)
+	}
+	var key Key
+	if err := json.Unmarshal(raw, &key); err != nil {
+		return Key{}, fmt.Errorf("%w: %w", ErrInvalidCursor, err)
+	}
+	return key, nil
+}
@@ -0,0 +1,236 @@
+package triage
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/kptm-tools/vulnerability-analysis/pkg/failure"
+)
+
+// Store holds the findings of every tenant. Stores opened on a journal
+// append each transition to it, so the workflow survives restarts.
+type Store struct {
+	mu       sync.RWMutex
+	findings map[Key]*Finding
+	journal  *os.File
+}
+
+// journalEntry is a line of the journal.
+type journalEntry struct {
+	Key
+	Transition
+}
+
+func NewStore() *Store {
+	return &Store{findings: make(map[Key]*Finding)}
+}
+
+// Open replays the journal at path, creating it when it doesn't exist. A
+// torn last line, left by a crash while a transition was journaled, is cut
+// off.
+func Open(path string) (*Store, error) {
+	s := NewStore()
+
+	f, err := os.Open(path)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+	case err != nil:
+		return nil, fmt.Errorf("failed to open finding journal: %w", err)
+	default:
+		err := s.replay(f, path)
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	s.journal, err = os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open finding journal: %w", err)
+	}
+	return s, nil
+}
+
+// replay applies the transitions of the journal f at path.
+func (s *Store) replay(f *os.File, path string) error {
+	reader := bufio.NewReader(f)
+	var offset int64
+	for line := 1; ; line++ {
+		data, err := reader.ReadBytes('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("failed to read finding journal: %w", err)
+		}
+		if len(bytes.TrimSpace(data)) > 0 {
+			if err != nil {
+				// The transition of the torn line wasn't acknowledged
+				if err := os.Truncate(path, offset); err != nil {
+					return &failure.StorageError{Err: fmt.Errorf("failed to truncate torn finding journal line %d: %w", line, err)}
+				}
+				return nil
+			}
+			var entry journalEntry
+			if err := json.Unmarshal(data, &entry); err != nil {
+				return fmt.Errorf("failed to decode finding journal line %d: %w", line, err)
+			}
+			s.apply(entry.Key, entry.Transition)
+		}
+		offset += int64(len(data))
+		if err != nil {
+			return nil
+		}
+	}
+}
+
+// Close closes the journal.
+func (s *Store) Close() error {
+	if s.journal == nil {
+		return nil
+	}
+	return s.journal.Close()
+}
+
+// Observe records the CVEs detected on a host by a scan. Unknown CVEs are
+// created as new, and CVEs that were fixed or closed are reopened.
+func (s *Store) Observe(tenant, host string, detections []Detection, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, d := range detections {
+		key := Key{Tenant: tenant, Host: host, CVE: d.CVE}
+		f, ok := s.findings[key]
+		switch {
+		case !ok:
+			if err := s.record(key, Transition{To: StateNew, Actor: ScannerActor, CPEs: d.CPEs, At: at}); err != nil {
+				return err
+			}
+		case f.State == StateVerifiedFixed || f.State == StateClosed:
+			t := Transition{From: f.State, To: StateNew, Actor: ScannerActor, Note: "detected again", CPEs: d.CPEs, At: at}
+			if err := s.record(key, t); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Transition moves a finding to another state on behalf of actor.
+func (s *Store) Transition(key Key, to State, actor, note string, at time.Time) (Finding, error) {
+	return s.TransitionJustified(key, to, "", actor, note, at)
+}
+
+// TransitionJustified is Transition with the justification of an analyst
+// closing a finding as not affecting the host, only accepted when moving to
+// closed.
+func (s *Store) TransitionJustified(key Key, to State, justification Justification, actor, note string, at time.Time) (Finding, error) {
+	if actor == "" {
+		return Finding{}, ErrMissingActor
+	}
+	if justification != "" {
+		if _, err := ParseJustification(string(justification)); err != nil {
+			return Finding{}, err
+		}
+		if to != StateClosed {
+			return Finding{}, fmt.Errorf("%w: only closed findings are justified, not %s", ErrInvalidJustification, to)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, ok := s.findings[key]
+	if !ok {
+		return Finding{}, fmt.Errorf("%w: %s", ErrUnknownFinding, key)
+	}
+	if !CanTransition(f.State, to) {
+		return Finding{}, fmt.Errorf("%w: %s to %s", ErrInvalidTransition, f.State, to)
+	}
+	if err := s.record(key, Transition{From: f.State, To: to, Actor: actor, Note: note, Justification: justification, At: at}); err != nil {
+		return Finding{}, err
+	}
+	return clone(s.findings[key]), nil
+}
+
+// Get returns a finding.
+func (s *Store) Get(key Key) (Finding, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	f, ok := s.findings[key]
+	if !ok {
+		return Finding{}, false
+	}
+	return clone(f), true
+}
+
+// Filter selects findings. Empty fields match every finding.
+type Filter struct {
+	Tenant string
+	Host   string
+	State  State
+}
+
+// List returns the findings matching filter, sorted by host and CVE.
+func (s *Store) List(filter Filter) []Finding {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	findings := []Finding{}
+	for key, f := range s.findings {
+		if (filter.Tenant != "" && key.Tenant != filter.Tenant) ||
+			(filter.Host != "" && key.Host != filter.Host) ||
+			(filter.State != "" && f.State != filter.State) {
+			continue
+		}
+		findings = append(findings, clone(f))
+	}
+	sort.Slice(findings, func(i, j int) bool {
+		return findings[i].Key.less(findings[j].Key)
+	})
+	return findings
+}
+
+// record journals a transition and applies it. The caller holds the lock.
+func (s *Store) record(key Key, t Transition) error {
+	t.At = t.At.UTC()
+	if s.journal != nil {
+		line, err := json.Marshal(journalEntry{Key: key, Transition: t})
+		if err != nil {
+			return fmt.Errorf("failed to encode finding transition: %w", err)
+		}
+		if _, err := s.journal.Write(append(line, '\n')); err != nil {
+			return &failure.StorageError{Err: fmt.Errorf("failed to journal finding transition: %w", err)}
+		}
+	}
+	s.apply(key, t)
+	return nil
+}
+
+func (s *Store) apply(key Key, t Transition) {
+	f, ok := s.findings[key]
+	if !ok {
+		f = &Finding{Key: key, CreatedAt: t.At}
+		s.findings[key] = f
+	}
+	f.State = t.To
+	f.UpdatedAt = t.At
+	if len(t.CPEs) > 0 {
+		f.CPEs = t.CPEs
+	}
+	f.History = append(f.History, t)
+}
+
+func clone(f *Finding) Finding {
+	c := *f
+	c.History = append([]Transition(nil), f.History...)
+	c.CPEs = append([]string(nil), f.CPEs...)
+	return c
+}
@@ -0,0 +1,143 @@
+// Package triage tracks the lifecycle of findings, from their first
+// detection to their remediation or risk acceptance, with the actor and time
+// of every transition.
+package triage
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// State is a step of the finding lifecycle.
+type State string
+
+const (
+	StateNew           State = "new"
+	StateTriaged       State = "triaged"
+	StateInRemediation State = "in_remediation"
+	StateVerifiedFixed State = "verified_fixed"
+	StateClosed        State = "closed"
+	StateRiskAccepted  State = "risk_accepted"
+)
+
+// Justification is the reason an analyst closed a finding as not affecting
+// the host, with the codes of the OpenVEX and CSAF specifications.
+type Justification string
+
+const (
+	JustificationComponentNotPresent                         Justification = "component_not_present"
+	JustificationVulnerableCodeNotPresent                    Justification = "vulnerable_code_not_present"
+	JustificationVulnerableCodeNotInExecutePath              Justification = "vulnerable_code_not_in_execute_path"
+	JustificationVulnerableCodeCannotBeControlledByAdversary Justification = "vulnerable_code_cannot_be_controlled_by_adversary"
+	JustificationInlineMitigationsAlreadyExist               Justification = "inline_mitigations_already_exist"
+)
+
+// ScannerActor is the actor of the transitions made by the pipeline, when a
+// finding is first detected or detected again after being fixed.
+const ScannerActor = "scanner"
+
+var (
+	ErrInvalidState      = errors.New("invalid finding state")
+	ErrInvalidTransition = errors.New("invalid finding transition")
+	ErrUnknownFinding    = errors.New("unknown finding")
+	ErrMissingActor      = errors.New("transition actor is required")
+	ErrInvalidCursor     = errors.New("invalid findings cursor")
+
+	ErrInvalidJustification = errors.New("invalid finding justification")
+)
+
+// transitions lists the states reachable from each state. Fixed and closed
+// findings go back to new when a scan detects them again.
+var transitions = map[State][]State{
+	StateNew:           {StateTriaged, StateRiskAccepted, StateClosed},
+	StateTriaged:       {StateInRemediation, StateRiskAccepted, StateClosed},
+	StateInRemediation: {StateVerifiedFixed, StateRiskAccepted},
+	StateVerifiedFixed: {StateClosed, StateNew},
+	StateRiskAccepted:  {StateTriaged, StateClosed},
+	StateClosed:        {StateNew},
+}
+
+// ParseState validates a state name.
+func ParseState(s string) (State, error) {
+	if _, ok := transitions[State(s)]; !ok {
+		return "", fmt.Errorf("%w: %q", ErrInvalidState, s)
+	}
+	return State(s), nil
+}
+
+// ParseJustification validates a justification code.
+func ParseJustification(s string) (Justification, error) {
+	switch j := Justification(s); j {
+	case JustificationComponentNotPresent, JustificationVulnerableCodeNotPresent,
+		JustificationVulnerableCodeNotInExecutePath, JustificationVulnerableCodeCannotBeControlledByAdversary,
+		JustificationInlineMitigationsAlreadyExist:
+		return j, nil
+	}
+	return "", fmt.Errorf("%w: %q", ErrInvalidJustification, s)
+}
+
+// CanTransition reports whether a finding in state from may move to to.
+func CanTransition(from, to State) bool {
+	for _, s := range transitions[from] {
+		if s == to {
+			return true
+		}
+	}
+	return false
+}
+
+// Key identifies a finding: a CVE on a host of a tenant.
+type Key struct {
+	Tenant string `json:"tenant"`
+	Host   string `json:"host"`
+	CVE    string `json:"cve"`
+}
+
+func (k Key) String() string {
+	return k.Tenant + "/" + k.Host + "/" + k.CVE
+}
+
+// less orders keys by tenant, host and CVE, the order findings are listed in.
+func (k Key) less(o Key) bool {
+	if k.Tenant != o.Tenant {
+		return k.Tenant < o.Tenant
+	}
+	if k.Host != o.Host {
+		return k.Host < o.Host
+	}
+	return k.CVE < o.CVE
+}
+
+// Transition is a state change of a finding. From is empty for the
+// detection that created it. Justification is only set when an analyst
+// closed the finding as not affecting the host, and CPEs on the detections
+// of the scanner.
+type Transition struct {
+	From          State         `json:"from,omitempty"`
+	To            State         `json:"to"`
+	Actor         string        `json:"actor"`
+	Note          string        `json:"note,omitempty"`
+	Justification Justification `json:"justification,omitempty"`
+	CPEs          []string      `json:"cpes,omitempty"`
+	At            time.Time     `json:"at"`
+}
+
+// Detection is a CVE detected on a host by a scan, with the CPEs of the OS
+// and services of the host it was found on.
+type Detection struct {
+	CVE  string
+	CPEs []string
+}
+
+// Finding is the workflow state of a finding with its transition history,
+// oldest first. CPEs are the components of the host the CVE was last
+// detected on, when known.
+type Finding struct {
+	Key
+	State     State        `json:"state"`
+	CPEs      []string     `json:"cpes,omitempty"`
+	CreatedAt time.Time    `json:"created_at"`
+	UpdatedAt time.Time    `json:"updated_at"`
+	History   []Transition `json:"history"`
+}
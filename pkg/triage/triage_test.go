@@ -0,0 +1,190 @@
+package triage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCanTransition(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		from, to State
+		want     bool
+	}{
+		{StateNew, StateTriaged, true},
+		{StateTriaged, StateInRemediation, true},
+		{StateInRemediation, StateVerifiedFixed, true},
+		{StateVerifiedFixed, StateClosed, true},
+		{StateNew, StateRiskAccepted, true},
+		{StateRiskAccepted, StateTriaged, true},
+		{StateNew, StateVerifiedFixed, false},
+		{StateClosed, StateTriaged, false},
+		{StateInRemediation, StateNew, false},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.from)+"->"+string(tt.to), func(t *testing.T) {
+			assert.Equal(t, tt.want, CanTransition(tt.from, tt.to))
+		})
+	}
+}
+
+func TestStore_Workflow(t *testing.T) {
+	t.Parallel()
+	at := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	key := Key{Tenant: "acme", Host: "10.0.0.1", CVE: "CVE-2024-0001"}
+	s := NewStore()
+
+	require.NoError(t, s.Observe("acme", "10.0.0.1", detections("CVE-2024-0001", "CVE-2024-0002"), at))
+	f, ok := s.Get(key)
+	require.True(t, ok)
+	assert.Equal(t, StateNew, f.State)
+	assert.Equal(t, at, f.CreatedAt)
+
+	_, err := s.Transition(key, StateVerifiedFixed, "alice", "", at)
+	assert.ErrorIs(t, err, ErrInvalidTransition)
+	_, err = s.Transition(key, StateTriaged, "", "", at)
+	assert.ErrorIs(t, err, ErrMissingActor)
+	_, err = s.Transition(Key{Tenant: "acme", Host: "10.0.0.9", CVE: "CVE-2024-0001"}, StateTriaged, "alice", "", at)
+	assert.ErrorIs(t, err, ErrUnknownFinding)
+
+	for i, to := range []State{StateTriaged, StateInRemediation, StateVerifiedFixed} {
+		f, err = s.Transition(key, to, "alice", "", at.Add(time.Duration(i+1)*time.Hour))
+		require.NoError(t, err)
+	}
+	assert.Equal(t, StateVerifiedFixed, f.State)
+	assert.Equal(t, at.Add(3*time.Hour), f.UpdatedAt)
+	require.Len(t, f.History, 4)
+	assert.Equal(t, Transition{From: StateTriaged, To: StateInRemediation, Actor: "alice", At: at.Add(2 * time.Hour)}, f.History[2])
+
+	// A fixed finding detected again is reopened, known open ones are kept
+	require.NoError(t, s.Observe("acme", "10.0.0.1", detections("CVE-2024-0001", "CVE-2024-0002"), at.Add(4*time.Hour)))
+	f, _ = s.Get(key)
+	assert.Equal(t, StateNew, f.State)
+	assert.Equal(t, ScannerActor, f.History[4].Actor)
+	other, _ := s.Get(Key{Tenant: "acme", Host: "10.0.0.1", CVE: "CVE-2024-0002"})
+	assert.Len(t, other.History, 1)
+
+	assert.Len(t, s.List(Filter{Tenant: "acme", State: StateNew}), 2)
+	assert.Empty(t, s.List(Filter{Tenant: "globex"}))
+}
+
+func TestOpen_ReplaysJournal(t *testing.T) {
+	t.Parallel()
+	path := filepath.Join(t.TempDir(), "findings.jsonl")
+	at := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	key := Key{Tenant: "acme", Host: "10.0.0.1", CVE: "CVE-2024-0001"}
+
+	cpe := "cpe:2.3:a:apache:http_server:2.4.49:*:*:*:*:*:*:*"
+	s, err := Open(path)
+	require.NoError(t, err)
+	require.NoError(t, s.Observe("acme", "10.0.0.1", []Detection{{CVE: key.CVE, CPEs: []string{cpe}}}, at))
+	_, err = s.Transition(key, StateRiskAccepted, "bob", "compensating control in place", at.Add(time.Hour))
+	require.NoError(t, err)
+	require.NoError(t, s.Close())
+
+	reopened, err := Open(path)
+	require.NoError(t, err)
+	defer reopened.Close()
+
+	f, ok := reopened.Get(key)
+	require.True(t, ok)
+	assert.Equal(t, StateRiskAccepted, f.State)
+	assert.Equal(t, at, f.CreatedAt)
+	assert.Equal(t, "compensating control in place", f.History[1].Note)
+	assert.Equal(t, []string{cpe}, f.CPEs, "Expected the components of the detection to be kept")
+}
+
+func TestOpen_TornJournalLine(t *testing.T) {
+	t.Parallel()
+	path := filepath.Join(t.TempDir(), "findings.jsonl")
+	at := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	key := Key{Tenant: "acme", Host: "10.0.0.1", CVE: "CVE-2024-0001"}
+
+	s, err := Open(path)
+	require.NoError(t, err)
+	require.NoError(t, s.Observe("acme", "10.0.0.1", detections(key.CVE), at))
+	require.NoError(t, s.Close())
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o644)
+	require.NoError(t, err)
+	_, err = f.WriteString(`{"tenant":"acme","host":"10.0.0.1","cve":"CVE-2024-0001","to":"tri`)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	reopened, err := Open(path)
+	require.NoError(t, err)
+	_, err = reopened.Transition(key, StateTriaged, "bob", "", at.Add(time.Hour))
+	require.NoError(t, err)
+	require.NoError(t, reopened.Close())
+
+	// The transition after the torn line is replayed on a line of its own
+	reopened, err = Open(path)
+	require.NoError(t, err)
+	defer reopened.Close()
+	finding, ok := reopened.Get(key)
+	require.True(t, ok)
+	assert.Equal(t, StateTriaged, finding.State)
+	assert.Len(t, finding.History, 2)
+}
+
+func TestStore_ListPage(t *testing.T) {
+	t.Parallel()
+	at := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	s := NewStore()
+	require.NoError(t, s.Observe("acme", "10.0.0.1", detections("CVE-2024-0001", "CVE-2024-0003", "CVE-2024-0005"), at))
+	require.NoError(t, s.Observe("globex", "10.0.0.1", detections("CVE-2024-0001"), at))
+
+	page, err := s.ListPage(Filter{Tenant: "acme"}, "", 2)
+	require.NoError(t, err)
+	assert.Equal(t, 3, page.Total)
+	require.Len(t, page.Findings, 2)
+	require.NotEmpty(t, page.NextCursor)
+
+	// A finding sorted before the cursor doesn't shift the next page
+	require.NoError(t, s.Observe("acme", "10.0.0.1", detections("CVE-2024-0002"), at))
+
+	page, err = s.ListPage(Filter{Tenant: "acme"}, page.NextCursor, 2)
+	require.NoError(t, err)
+	assert.Equal(t, 4, page.Total)
+	require.Len(t, page.Findings, 1)
+	assert.Equal(t, "CVE-2024-0005", page.Findings[0].CVE)
+	assert.Empty(t, page.NextCursor)
+
+	page, err = s.ListPage(Filter{Tenant: "acme"}, "", 0)
+	require.NoError(t, err)
+	assert.Len(t, page.Findings, 4)
+
+	_, err = s.ListPage(Filter{Tenant: "acme"}, "not a cursor", 2)
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+}
+
+func TestStore_TransitionJustified(t *testing.T) {
+	t.Parallel()
+	at := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	key := Key{Tenant: "acme", Host: "10.0.0.1", CVE: "CVE-2024-0001"}
+	s := NewStore()
+	require.NoError(t, s.Observe("acme", "10.0.0.1", detections("CVE-2024-0001"), at))
+
+	_, err := s.TransitionJustified(key, StateTriaged, JustificationComponentNotPresent, "alice", "", at)
+	assert.ErrorIs(t, err, ErrInvalidJustification)
+	_, err = s.TransitionJustified(key, StateClosed, "not_exploitable", "alice", "", at)
+	assert.ErrorIs(t, err, ErrInvalidJustification)
+
+	f, err := s.TransitionJustified(key, StateClosed, JustificationComponentNotPresent, "alice", "no IIS", at)
+	require.NoError(t, err)
+	assert.Equal(t, StateClosed, f.State)
+	assert.Equal(t, JustificationComponentNotPresent, f.History[1].Justification)
+}
+
+func detections(cves ...string) []Detection {
+	found := make([]Detection, 0, len(cves))
+	for _, cve := range cves {
+		found = append(found, Detection{CVE: cve})
+	}
+	return found
+}
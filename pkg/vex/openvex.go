@@ -0,0 +1,172 @@
+// Package vex exports the verdicts of the finding workflow as OpenVEX
+// documents, so that the triage decisions on a host can be consumed by
+// supply chain tooling downstream.
+package vex
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/triage"
+)
+
+// Context is the OpenVEX specification version of the documents.
+const Context = "https://openvex.dev/ns/v0.2.0"
+
+// DefaultAuthor signs the documents of callers not naming an author.
+const DefaultAuthor = "vulnerability-analysis"
+
+// Status of a statement.
+type Status string
+
+const (
+	StatusNotAffected        Status = "not_affected"
+	StatusAffected           Status = "affected"
+	StatusFixed              Status = "fixed"
+	StatusUnderInvestigation Status = "under_investigation"
+)
+
+// Document is an OpenVEX document.
+type Document struct {
+	Context    string      `json:"@context"`
+	ID         string      `json:"@id"`
+	Author     string      `json:"author"`
+	Timestamp  time.Time   `json:"timestamp"`
+	Version    int         `json:"version"`
+	Tooling    string      `json:"tooling,omitempty"`
+	Statements []Statement `json:"statements"`
+}
+
+// Statement is the status of a vulnerability on the products it lists.
+// Statements not_affected carry a justification or an impact statement, and
+// statements affected an action statement.
+type Statement struct {
+	Vulnerability   Vulnerability        `json:"vulnerability"`
+	Products        []Product            `json:"products"`
+	Status          Status               `json:"status"`
+	StatusNotes     string               `json:"status_notes,omitempty"`
+	Justification   triage.Justification `json:"justification,omitempty"`
+	ImpactStatement string               `json:"impact_statement,omitempty"`
+	ActionStatement string               `json:"action_statement,omitempty"`
+	Timestamp       time.Time            `json:"timestamp"`
+}
+
+type Vulnerability struct {
+	Name string `json:"name"`
+}
+
+// Product is a component of a scanned host, identified by its CPE, with the
+// host as subcomponent. Findings of unknown components name the host.
+type Product struct {
+	ID            string            `json:"@id"`
+	Identifiers   map[string]string `json:"identifiers,omitempty"`
+	Subcomponents []Product         `json:"subcomponents,omitempty"`
+}
+
+// impactTemplates explain each justification, with the CVE and host.
+var impactTemplates = map[triage.Justification]string{
+	triage.JustificationComponentNotPresent:                         "The component affected by %s is not present on %s.",
+	triage.JustificationVulnerableCodeNotPresent:                    "The code vulnerable to %s is not present in the version deployed on %s.",
+	triage.JustificationVulnerableCodeNotInExecutePath:              "The code vulnerable to %s is not executed by the configuration of %s.",
+	triage.JustificationVulnerableCodeCannotBeControlledByAdversary: "The input exploiting %s cannot be controlled by an adversary on %s.",
+	triage.JustificationInlineMitigationsAlreadyExist:               "Mitigations in place on %[2]s prevent the exploitation of %[1]s.",
+}
+
+// actionTemplates tell the consumers of affected statements what is done
+// about the CVE on the host, by workflow state.
+var actionTemplates = map[triage.State]string{
+	triage.StateTriaged:       "%s was confirmed on %s and is scheduled for remediation. Apply the vendor update or mitigation.",
+	triage.StateInRemediation: "The remediation of %s on %s is in progress. Apply the vendor update or mitigation.",
+	triage.StateRiskAccepted:  "The risk of %s on %s was accepted, no remediation is planned. Restrict the exposure of the affected service.",
+}
+
+// Generate builds the document of the verdicts on findings, each a
+// statement about its CVE on its host. Findings closed without a
+// justification after being fixed are stated fixed, and otherwise as not
+// affected with the note of the analyst as impact statement.
+func Generate(findings []triage.Finding, author string, at time.Time) *Document {
+	if author == "" {
+		author = DefaultAuthor
+	}
+	doc := &Document{
+		Context:    Context,
+		ID:         "urn:uuid:" + uuid.NewString(),
+		Author:     author,
+		Timestamp:  at.UTC(),
+		Version:    1,
+		Tooling:    DefaultAuthor,
+		Statements: make([]Statement, 0, len(findings)),
+	}
+	for _, f := range findings {
+		doc.Statements = append(doc.Statements, statement(f))
+	}
+	return doc
+}
+
+// HostID identifies a scanned host in the statements.
+func HostID(host string) string {
+	return "urn:kptm:host:" + host
+}
+
+// products returns the components of the host a finding was detected on,
+// or the host when they aren't known.
+func products(f triage.Finding) []Product {
+	host := Product{ID: HostID(f.Host)}
+	if len(f.CPEs) == 0 {
+		return []Product{host}
+	}
+	products := make([]Product, 0, len(f.CPEs))
+	for _, cpe := range f.CPEs {
+		scheme := "cpe23"
+		if strings.HasPrefix(cpe, "cpe:/") {
+			scheme = "cpe22"
+		}
+		products = append(products, Product{
+			ID:            cpe,
+			Identifiers:   map[string]string{scheme: cpe},
+			Subcomponents: []Product{host},
+		})
+	}
+	return products
+}
+
+func statement(f triage.Finding) Statement {
+	st := Statement{
+		Vulnerability: Vulnerability{Name: f.CVE},
+		Products:      products(f),
+		Timestamp:     f.UpdatedAt.UTC(),
+	}
+	var last triage.Transition
+	if len(f.History) > 0 {
+		last = f.History[len(f.History)-1]
+		st.StatusNotes = last.Note
+	}
+
+	switch f.State {
+	case triage.StateNew:
+		st.Status = StatusUnderInvestigation
+	case triage.StateTriaged, triage.StateInRemediation, triage.StateRiskAccepted:
+		st.Status = StatusAffected
+		st.ActionStatement = fmt.Sprintf(actionTemplates[f.State], f.CVE, f.Host)
+	case triage.StateVerifiedFixed:
+		st.Status = StatusFixed
+	case triage.StateClosed:
+		switch {
+		case last.Justification != "":
+			st.Status = StatusNotAffected
+			st.Justification = last.Justification
+			st.ImpactStatement = fmt.Sprintf(impactTemplates[last.Justification], f.CVE, f.Host)
+		case last.From == triage.StateVerifiedFixed:
+			st.Status = StatusFixed
+		default:
+			st.Status = StatusNotAffected
+			st.ImpactStatement = last.Note
+			if st.ImpactStatement == "" {
+				st.ImpactStatement = fmt.Sprintf("%s was dismissed on %s after analysis by %s.", f.CVE, f.Host, last.Actor)
+			}
+		}
+	}
+	return st
+}
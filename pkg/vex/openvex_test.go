@@ -0,0 +1,79 @@
+package vex
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/kptm-tools/vulnerability-analysis/pkg/triage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerate(t *testing.T) {
+	t.Parallel()
+	at := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	s := triage.NewStore()
+	cpe := "cpe:2.3:a:apache:http_server:2.4.49:*:*:*:*:*:*:*"
+	var detections []triage.Detection
+	for _, cve := range []string{"CVE-2024-0001", "CVE-2024-0002", "CVE-2024-0003", "CVE-2024-0004", "CVE-2024-0005"} {
+		detections = append(detections, triage.Detection{CVE: cve, CPEs: []string{cpe}})
+	}
+	detections = append(detections, triage.Detection{CVE: "CVE-2024-0006"})
+	require.NoError(t, s.Observe("acme", "10.0.0.1", detections, at))
+	key := func(cve string) triage.Key { return triage.Key{Tenant: "acme", Host: "10.0.0.1", CVE: cve} }
+	move := func(cve string, states ...triage.State) {
+		for _, to := range states {
+			_, err := s.Transition(key(cve), to, "alice", "", at)
+			require.NoError(t, err)
+		}
+	}
+
+	_, err := s.TransitionJustified(key("CVE-2024-0001"), triage.StateClosed, triage.JustificationVulnerableCodeNotInExecutePath, "alice", "mod_proxy is disabled", at)
+	require.NoError(t, err)
+	move("CVE-2024-0002", triage.StateTriaged, triage.StateInRemediation)
+	move("CVE-2024-0003", triage.StateTriaged, triage.StateInRemediation, triage.StateVerifiedFixed, triage.StateClosed)
+	move("CVE-2024-0004", triage.StateRiskAccepted)
+	move("CVE-2024-0005", triage.StateClosed)
+
+	doc := Generate(s.List(triage.Filter{Tenant: "acme"}), "", at)
+	assert.Equal(t, DefaultAuthor, doc.Author)
+	assert.Equal(t, Context, doc.Context)
+	require.Len(t, doc.Statements, len(detections))
+
+	byCVE := make(map[string]Statement)
+	for _, st := range doc.Statements {
+		byCVE[st.Vulnerability.Name] = st
+	}
+	host := Product{ID: "urn:kptm:host:10.0.0.1"}
+	assert.Equal(t, []Product{{ID: cpe, Identifiers: map[string]string{"cpe23": cpe}, Subcomponents: []Product{host}}}, byCVE["CVE-2024-0001"].Products)
+	assert.Equal(t, []Product{host}, byCVE["CVE-2024-0006"].Products, "Expected findings of unknown components to name the host")
+
+	notAffected := byCVE["CVE-2024-0001"]
+	assert.Equal(t, StatusNotAffected, notAffected.Status)
+	assert.Equal(t, triage.JustificationVulnerableCodeNotInExecutePath, notAffected.Justification)
+	assert.Equal(t, "The code vulnerable to CVE-2024-0001 is not executed by the configuration of 10.0.0.1.", notAffected.ImpactStatement)
+	assert.Equal(t, "mod_proxy is disabled", notAffected.StatusNotes)
+
+	assert.Equal(t, StatusAffected, byCVE["CVE-2024-0002"].Status)
+	assert.Equal(t, "The remediation of CVE-2024-0002 on 10.0.0.1 is in progress. Apply the vendor update or mitigation.", byCVE["CVE-2024-0002"].ActionStatement)
+	assert.Equal(t, StatusFixed, byCVE["CVE-2024-0003"].Status)
+	assert.Equal(t, StatusAffected, byCVE["CVE-2024-0004"].Status)
+	assert.NotEmpty(t, byCVE["CVE-2024-0004"].ActionStatement)
+	assert.Equal(t, StatusNotAffected, byCVE["CVE-2024-0005"].Status)
+	assert.Equal(t, "CVE-2024-0005 was dismissed on 10.0.0.1 after analysis by alice.", byCVE["CVE-2024-0005"].ImpactStatement)
+	assert.Equal(t, StatusUnderInvestigation, byCVE["CVE-2024-0006"].Status)
+
+	// Every justification has an impact statement template
+	for _, j := range []triage.Justification{
+		triage.JustificationComponentNotPresent, triage.JustificationVulnerableCodeNotPresent,
+		triage.JustificationVulnerableCodeNotInExecutePath, triage.JustificationVulnerableCodeCannotBeControlledByAdversary,
+		triage.JustificationInlineMitigationsAlreadyExist,
+	} {
+		assert.Contains(t, impactTemplates, j)
+	}
+
+	raw, err := json.Marshal(doc)
+	require.NoError(t, err)
+	assert.Contains(t, string(raw), `"@context":"https://openvex.dev/ns/v0.2.0"`)
+}
@@ -0,0 +1,94 @@
+package vulnanalysis_test
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/Ullaakut/nmap/v2"
+	"github.com/google/uuid"
+	"github.com/kptm-tools/common/common/pkg/enums"
+	"github.com/kptm-tools/common/common/pkg/results/tools"
+	"github.com/kptm-tools/vulnerability-analysis/nvd/schema"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/nvdmock"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/services"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/vulnanalysis"
+)
+
+// mirror serves CVE records from memory, as a local mirror would.
+type mirror map[string]schema.Vulnerability
+
+func (m mirror) LookupCVE(id string) (*schema.NvdAPIResponse, error) {
+	vuln, ok := m[id]
+	if !ok {
+		return &schema.NvdAPIResponse{}, nil
+	}
+	return &schema.NvdAPIResponse{TotalResults: 1, Vulnerabilities: []schema.Vulnerability{vuln}}, nil
+}
+
+// printer publishes results to stdout.
+type printer struct{}
+
+func (printer) Publish(subject string, payload []byte) error {
+	fmt.Println("published on", subject)
+	return nil
+}
+
+func Example() {
+	// A mock of NVD, use WithAPIKey rather than WithBaseURL in production
+	server := nvdmock.NewServer(nvdmock.Options{MaxVulnsPerCPE: 5})
+	defer server.Close()
+
+	analyzer, err := vulnanalysis.New(
+		vulnanalysis.WithBaseURL(server.URL),
+		vulnanalysis.WithEnrichmentCache(1000),
+		vulnanalysis.WithNVDOptions(services.WithRequestInterval(0), services.WithRateLimiter(nil)),
+	)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	host := nmap.Host{
+		Addresses: []nmap.Address{{Addr: "10.0.0.1", AddrType: "ipv4"}},
+		Ports: []nmap.Port{{
+			ID:       443,
+			Protocol: "tcp",
+			State:    nmap.State{State: "open"},
+			Service:  nmap.Service{Name: "https", CPEs: []nmap.CPE{"cpe:/a:apache:http_server:2.4.49"}},
+		}},
+	}
+	result := analyzer.AnalyzeHost(context.Background(), host)
+	fmt.Println(result.HostAddress, len(result.ScannedPorts[0].Vulnerabilities) > 0)
+	// Output: 10.0.0.1 true
+}
+
+func ExampleAnalyzer_EnrichCVE() {
+	record := nvdmock.BuildResponse("cpe:2.3:a:apache:log4j:2.14.1:*:*:*:*:*:*:*", 3).Vulnerabilities[0]
+	analyzer, err := vulnanalysis.New(
+		vulnanalysis.WithKnowledgeSource(mirror{record.Cve.ID: record}),
+	)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	vuln, err := analyzer.EnrichCVE(context.Background(), record.Cve.ID)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println(vuln.ID == record.Cve.ID, vuln.BaseCVSSScore == record.Cve.Metrics.CvssMetricV31[0].CvssData.BaseScore)
+	// Output: true true
+}
+
+func ExampleAnalyzer_Publish() {
+	analyzer, err := vulnanalysis.New(vulnanalysis.WithPublisher(printer{}, "scans.nmap"))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	result := tools.ToolResult{Tool: enums.ToolNmap, Result: analyzer.AnalyzeHost(context.Background(), nmap.Host{}), Timestamp: time.Now().UTC()}
+	if err := analyzer.Publish(context.Background(), uuid.New(), result); err != nil {
+		log.Fatal(err)
+	}
+	// Output: published on scans.nmap
+}
@@ -0,0 +1,279 @@
+// Package vulnanalysis embeds the vulnerability analysis pipeline in other
+// services: it looks the CPEs of scanned hosts up in NVD and the configured
+// sources, turns the CVEs found into scored findings and optionally
+// publishes the results, without the wiring of the standalone service.
+//
+// An Analyzer is configured with functional options:
+//
+//	analyzer, err := vulnanalysis.New(
+//		vulnanalysis.WithAPIKey(os.Getenv("NVD_API_KEY")),
+//		vulnanalysis.WithEnrichmentCache(20000),
+//		vulnanalysis.WithPublisher(bus, ""),
+//	)
+//
+// Options not covered here are passed through WithNVDOptions and
+// WithScanOptions. The risk model scoring the findings, risk.Current, is
+// shared by every analyzer of the process.
+package vulnanalysis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Ullaakut/nmap/v2"
+	"github.com/google/uuid"
+	"github.com/kptm-tools/common/common/pkg/enums"
+	"github.com/kptm-tools/common/common/pkg/results/tools"
+	"github.com/kptm-tools/vulnerability-analysis/nvd/schema"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/cache"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/output"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/results"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/risk"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/services"
+)
+
+// ErrNotFound is returned by EnrichCVE for CVEs NVD has no record of.
+var ErrNotFound = errors.New("CVE not found")
+
+// ErrNoPublisher is returned by Publish when the analyzer has no publisher.
+var ErrNoPublisher = errors.New("no publisher configured")
+
+// Analyzer runs the enrichment pipeline. It is safe for concurrent use.
+type Analyzer struct {
+	nvd        *services.NVDClient
+	scanner    *services.NmapService
+	enrichment services.Enrichment
+	publisher  output.Publisher
+	subject    string
+	output     output.Options
+}
+
+type settings struct {
+	nvdOpts    []services.NVDClientOption
+	scanOpts   []services.NmapServiceOption
+	enrichment services.Enrichment
+	publisher  output.Publisher
+	subject    string
+	output     output.Options
+}
+
+// Option configures an Analyzer.
+type Option func(*settings) error
+
+// WithAPIKey sends an NVD API key with every request, raising the rate limit
+// the requests are paced to.
+func WithAPIKey(key string) Option {
+	return func(s *settings) error {
+		if strings.TrimSpace(key) == "" {
+			return errors.New("empty NVD API key")
+		}
+		s.nvdOpts = append(s.nvdOpts, services.WithAPIKey(key, ""))
+		return nil
+	}
+}
+
+// WithBaseURL points the analyzer at another CVE API, e.g. a mirror or a
+// mock of NVD.
+func WithBaseURL(baseURL string) Option {
+	return func(s *settings) error {
+		s.nvdOpts = append(s.nvdOpts, services.WithBaseURL(baseURL))
+		return nil
+	}
+}
+
+// WithOfflineSource serves the CPE lookups from src while NVD is down, e.g. a
+// local mirror.
+func WithOfflineSource(src services.CPESource) Option {
+	return func(s *settings) error {
+		s.nvdOpts = append(s.nvdOpts, services.WithOfflineSource(src))
+		return nil
+	}
+}
+
+// WithKnowledgeSource serves the CVE records known to src before querying
+// NVD, e.g. a mirror seeded from a snapshot, and the CPE lookups NVD fails
+// when src also implements services.CPESource.
+func WithKnowledgeSource(src services.CVESource) Option {
+	return func(s *settings) error {
+		s.nvdOpts = append(s.nvdOpts, services.WithKnowledgeCache(src))
+		return nil
+	}
+}
+
+// WithEPSS adds the EPSS probability of the findings of the tenants with the
+// epss feature on, e.g. from an intel.EPSSClient.
+func WithEPSS(src services.EPSSSource) Option {
+	return func(s *settings) error {
+		s.scanOpts = append(s.scanOpts, services.WithEPSSScores(src))
+		return nil
+	}
+}
+
+// WithResponseCache revalidates up to entries NVD responses with conditional
+// requests instead of downloading them again.
+func WithResponseCache(entries int) Option {
+	return func(s *settings) error {
+		if entries <= 0 {
+			return fmt.Errorf("invalid response cache size %d", entries)
+		}
+		s.nvdOpts = append(s.nvdOpts, services.WithResponseCache(entries))
+		return nil
+	}
+}
+
+// WithEnrichmentCache keeps up to entries enriched findings, so that CVEs
+// unchanged since they were last seen aren't parsed and scored again.
+func WithEnrichmentCache(entries int) Option {
+	return func(s *settings) error {
+		if entries <= 0 {
+			return fmt.Errorf("invalid enrichment cache size %d", entries)
+		}
+		s.enrichment.Cache = services.NewEnrichmentCache(entries)
+		return nil
+	}
+}
+
+// WithDiskCache keeps the CPE lookups in dir for ttl, so that they survive
+// restarts of the program without a Redis server.
+func WithDiskCache(dir string, ttl time.Duration) Option {
+	return func(s *settings) error {
+		disk, err := cache.NewDisk(dir)
+		if err != nil {
+			return err
+		}
+		s.nvdOpts = append(s.nvdOpts, services.WithSharedCache(disk, ttl))
+		return nil
+	}
+}
+
+// WithLikelihoodMatrix replaces the matrix mapping the CVSS exploitability
+// metrics of the findings to the likelihood of the risk model.
+func WithLikelihoodMatrix(matrix risk.LikelihoodMatrix) Option {
+	return func(s *settings) error {
+		s.enrichment.Likelihood = matrix
+		return nil
+	}
+}
+
+// WithCVSSPreference sets the order in which the CVSS versions of a CVE
+// score its findings, per tenant.
+func WithCVSSPreference(preference services.CVSSPreference) Option {
+	return func(s *settings) error {
+		s.enrichment.CVSSPreference = preference
+		return nil
+	}
+}
+
+// WithPublisher publishes results with Publish on subject, or on the nmap
+// subject of the platform when empty.
+func WithPublisher(publisher output.Publisher, subject string) Option {
+	return func(s *settings) error {
+		if publisher == nil {
+			return errors.New("nil publisher")
+		}
+		s.publisher = publisher
+		if subject != "" {
+			s.subject = subject
+		}
+		return nil
+	}
+}
+
+// WithOutput applies the publication policies, compression and size limit
+// of opts to the results published with Publish.
+func WithOutput(opts output.Options) Option {
+	return func(s *settings) error {
+		s.output = opts
+		return nil
+	}
+}
+
+// WithNVDOptions configures the NVD client beyond the options of this
+// package.
+func WithNVDOptions(opts ...services.NVDClientOption) Option {
+	return func(s *settings) error {
+		s.nvdOpts = append(s.nvdOpts, opts...)
+		return nil
+	}
+}
+
+// WithScanOptions configures the host analysis beyond the options of this
+// package, e.g. with vendor advisories or a host classifier.
+func WithScanOptions(opts ...services.NmapServiceOption) Option {
+	return func(s *settings) error {
+		s.scanOpts = append(s.scanOpts, opts...)
+		return nil
+	}
+}
+
+// New returns an analyzer of the public NVD API, paced to its
+// unauthenticated rate limit, unless configured otherwise.
+func New(opts ...Option) (*Analyzer, error) {
+	s := &settings{
+		enrichment: services.DefaultEnrichment(),
+		subject:    string(enums.NmapEventSubject),
+	}
+	for _, opt := range opts {
+		if err := opt(s); err != nil {
+			return nil, fmt.Errorf("invalid vulnanalysis option: %w", err)
+		}
+	}
+
+	nvd := services.NewNVDClient(s.nvdOpts...)
+	scanOpts := append([]services.NmapServiceOption{services.WithEnrichment(s.enrichment)}, s.scanOpts...)
+	return &Analyzer{
+		nvd:        nvd,
+		scanner:    services.NewNmapService(nvd, scanOpts...),
+		enrichment: s.enrichment,
+		publisher:  s.publisher,
+		subject:    s.subject,
+		output:     s.output,
+	}, nil
+}
+
+// NVD returns the NVD client of the analyzer, e.g. to query its rate limit
+// or start its availability monitor.
+func (a *Analyzer) NVD() *services.NVDClient {
+	return a.nvd
+}
+
+// Scan runs nmap against target and analyzes the host found. Scan failures
+// are also reported in the error of the result, as published.
+func (a *Analyzer) Scan(ctx context.Context, target string) (tools.ToolResult, error) {
+	return a.scanner.RunScan(ctx, target)
+}
+
+// AnalyzeHost analyzes a host scanned beforehand, e.g. parsed from the XML
+// output of nmap.
+func (a *Analyzer) AnalyzeHost(ctx context.Context, host nmap.Host) *results.NmapResult {
+	return a.scanner.AnalyzeHost(ctx, host)
+}
+
+// EnrichCVE returns the finding of a single CVE, scored for the tenant of
+// ctx, before any host context.
+func (a *Analyzer) EnrichCVE(ctx context.Context, cveID string) (results.Vulnerability, error) {
+	resp, err := a.nvd.FetchByCVEID(ctx, cveID)
+	if err != nil {
+		return results.Vulnerability{}, fmt.Errorf("failed to fetch %s: %w", cveID, err)
+	}
+	i := slices.IndexFunc(resp.Vulnerabilities, func(v schema.Vulnerability) bool {
+		return strings.EqualFold(v.Cve.ID, cveID)
+	})
+	if i < 0 {
+		return results.Vulnerability{}, fmt.Errorf("%w: %s", ErrNotFound, cveID)
+	}
+	return a.enrichment.Enrich(ctx, resp.Vulnerabilities[i])
+}
+
+// Publish publishes the result of a scan the way the platform consumes
+// them, after applying the publication policies of the tenant of ctx.
+func (a *Analyzer) Publish(ctx context.Context, scanID uuid.UUID, result tools.ToolResult) error {
+	if a.publisher == nil {
+		return ErrNoPublisher
+	}
+	return a.output.PublishResult(ctx, a.publisher, a.subject, scanID, result)
+}
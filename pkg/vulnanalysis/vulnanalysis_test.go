@@ -0,0 +1,35 @@
+package vulnanalysis
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kptm-tools/common/common/pkg/results/tools"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNew_InvalidOptions(t *testing.T) {
+	t.Parallel()
+	for name, opt := range map[string]Option{
+		"empty API key":    WithAPIKey(" "),
+		"response cache":   WithResponseCache(0),
+		"enrichment cache": WithEnrichmentCache(-1),
+		"nil publisher":    WithPublisher(nil, ""),
+		"disk cache":       WithDiskCache("", time.Hour),
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := New(opt)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestAnalyzer_Publish_NoPublisher(t *testing.T) {
+	t.Parallel()
+	analyzer, err := New()
+	require.NoError(t, err)
+	assert.ErrorIs(t, analyzer.Publish(context.Background(), uuid.New(), tools.ToolResult{}), ErrNoPublisher)
+}
@@ -0,0 +1,139 @@
+package vulnstore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kptm-tools/common/common/pkg/enums"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/asset"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/failure"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/results"
+)
+
+// Compare classifies the findings of a scan of a host against those of its
+// previous scan as new, fixed or persistent. Findings are matched by CVE,
+// protocol and port, and listed in that order.
+func Compare(previous, current []Finding) results.ScanDiff {
+	before := make(map[string]bool, len(previous))
+	for _, f := range previous {
+		before[findingKey(f)] = true
+	}
+	after := make(map[string]bool, len(current))
+
+	diff := results.ScanDiff{New: []results.DiffFinding{}, Fixed: []results.DiffFinding{}, Persistent: []results.DiffFinding{}}
+	for _, f := range current {
+		key := findingKey(f)
+		if after[key] {
+			continue
+		}
+		after[key] = true
+		if before[key] {
+			diff.Persistent = append(diff.Persistent, diffFinding(f))
+		} else {
+			diff.New = append(diff.New, diffFinding(f))
+		}
+	}
+	for _, f := range previous {
+		key := findingKey(f)
+		if !after[key] {
+			after[key] = true
+			diff.Fixed = append(diff.Fixed, diffFinding(f))
+		}
+	}
+	for _, findings := range [][]results.DiffFinding{diff.New, diff.Fixed, diff.Persistent} {
+		sort.Slice(findings, func(i, j int) bool {
+			a, b := findings[i], findings[j]
+			if a.CVE != b.CVE {
+				return a.CVE < b.CVE
+			}
+			if a.Protocol != b.Protocol {
+				return a.Protocol < b.Protocol
+			}
+			return a.Port < b.Port
+		})
+	}
+	return diff
+}
+
+func findingKey(f Finding) string {
+	return f.Vulnerability.ID + "|" + f.Protocol + "|" + strconv.Itoa(int(f.Port))
+}
+
+func diffFinding(f Finding) results.DiffFinding {
+	return results.DiffFinding{
+		CVE:       f.Vulnerability.ID,
+		Port:      f.Port,
+		Protocol:  f.Protocol,
+		Severity:  f.Vulnerability.BaseSeverity,
+		CVSSScore: f.Vulnerability.BaseCVSSScore,
+		EPSS:      f.Vulnerability.EPSS,
+	}
+}
+
+// DiffPrevious compares the result of a host to the latest scan of the host
+// stored before at, other than scanID, so that a reanalysis compares to the
+// scan before. It returns nil when the host has no earlier scan.
+func (s *Store) DiffPrevious(ctx context.Context, scanID uuid.UUID, tenantID string, result *results.NmapResult, at time.Time) (*results.ScanDiff, error) {
+	host := asset.Canonical(result.HostAddress)
+	var previousID uuid.UUID
+	var previousAt time.Time
+	err := s.db.QueryRowContext(ctx,
+		`SELECT scan_id, scanned_at FROM vulnstore_scans
+		 WHERE tenant_id = $1 AND host_address = $2 AND scan_id <> $3 AND scanned_at <= $4
+		 ORDER BY scanned_at DESC LIMIT 1`,
+		tenantID, host, scanID, at.UTC()).Scan(&previousID, &previousAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, &failure.StorageError{Err: fmt.Errorf("failed to select previous scan: %w", err)}
+	}
+
+	previous, err := s.scanFindings(ctx, previousID, host)
+	if err != nil {
+		return nil, err
+	}
+	diff := Compare(previous, findings(scanID, tenantID, result, at))
+	diff.PreviousScanID = previousID.String()
+	diff.PreviousScanAt = previousAt.UTC()
+	return &diff, nil
+}
+
+// scanFindings returns the CVEs, ports, severities and scores of every
+// finding of a stored scan of a host.
+func (s *Store) scanFindings(ctx context.Context, scanID uuid.UUID, host string) ([]Finding, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT protocol, port, cve_id, severity, cvss_score, (vulnerability->>'epss')::DOUBLE PRECISION
+		 FROM vulnstore_findings WHERE scan_id = $1 AND host_address = $2`,
+		scanID, host)
+	if err != nil {
+		return nil, &failure.StorageError{Err: fmt.Errorf("failed to select previous findings: %w", err)}
+	}
+	defer rows.Close()
+	var found []Finding
+	for rows.Next() {
+		f := Finding{ScanID: scanID, HostAddress: host}
+		var port int
+		var severity string
+		var epss sql.NullFloat64
+		if err := rows.Scan(&f.Protocol, &port, &f.Vulnerability.ID, &severity, &f.Vulnerability.BaseCVSSScore, &epss); err != nil {
+			return nil, fmt.Errorf("failed to scan finding: %w", err)
+		}
+		f.Port = uint16(port)
+		f.Vulnerability.BaseSeverity = enums.SeverityType(severity)
+		if epss.Valid {
+			f.Vulnerability.EPSS = &epss.Float64
+		}
+		found = append(found, f)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, &failure.StorageError{Err: fmt.Errorf("failed to read previous findings: %w", err)}
+	}
+	return found, nil
+}
@@ -0,0 +1,78 @@
+package vulnstore
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kptm-tools/common/common/pkg/enums"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/failure"
+	"github.com/lib/pq"
+)
+
+// CriticalCVEs calls fn with the distinct critical CVEs found by every
+// stored scan of a host since the given time, oldest scan first, e.g. to
+// rebuild the repeat offenders on startup. Scans without critical CVEs are
+// replayed too, they end the runs of their hosts. Severities are the NVD
+// ones, before the severity remapping of the tenant.
+func (s *Store) CriticalCVEs(ctx context.Context, since time.Time, fn func(tenantID, hostAddress string, scanID uuid.UUID, cves []string, at time.Time)) error {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT s.tenant_id, s.host_address, s.scan_id, s.scanned_at,
+				COALESCE(array_agg(DISTINCT f.cve_id ORDER BY f.cve_id) FILTER (WHERE
+					COALESCE(NULLIF(f.vulnerability->'provenance'->>'original_severity', ''), f.severity) = $2), '{}')
+			FROM vulnstore_scans s LEFT JOIN vulnstore_findings f USING (scan_id, host_address)
+			WHERE s.scanned_at >= $1
+			GROUP BY s.tenant_id, s.host_address, s.scan_id, s.scanned_at
+			ORDER BY s.scanned_at`,
+		since.UTC(), string(enums.SeverityTypeCritical))
+	if err != nil {
+		return &failure.StorageError{Err: fmt.Errorf("failed to select critical CVEs: %w", err)}
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var tenantID, host string
+		var scanID uuid.UUID
+		var at time.Time
+		var cves pq.StringArray
+		if err := rows.Scan(&tenantID, &host, &scanID, &at, &cves); err != nil {
+			return fmt.Errorf("failed to scan critical CVEs: %w", err)
+		}
+		fn(tenantID, host, scanID, cves, at.UTC())
+	}
+	if err := rows.Err(); err != nil {
+		return &failure.StorageError{Err: fmt.Errorf("failed to read critical CVEs: %w", err)}
+	}
+	return nil
+}
+
+// FindingCounts calls fn with the number of distinct CVEs found by every
+// stored scan of a host since the given time, oldest scan first, e.g. to
+// rebuild the baselines of the volume anomaly detection on startup.
+func (s *Store) FindingCounts(ctx context.Context, since time.Time, fn func(tenantID, hostAddress string, scanID uuid.UUID, findings int, at time.Time)) error {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT s.tenant_id, s.host_address, s.scan_id, s.scanned_at, COUNT(DISTINCT f.cve_id)
+			FROM vulnstore_scans s LEFT JOIN vulnstore_findings f USING (scan_id, host_address)
+			WHERE s.scanned_at >= $1
+			GROUP BY s.tenant_id, s.host_address, s.scan_id, s.scanned_at
+			ORDER BY s.scanned_at`,
+		since.UTC())
+	if err != nil {
+		return &failure.StorageError{Err: fmt.Errorf("failed to select finding counts: %w", err)}
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var tenantID, host string
+		var scanID uuid.UUID
+		var at time.Time
+		var findings int
+		if err := rows.Scan(&tenantID, &host, &scanID, &at, &findings); err != nil {
+			return fmt.Errorf("failed to scan finding count: %w", err)
+		}
+		fn(tenantID, host, scanID, findings, at.UTC())
+	}
+	if err := rows.Err(); err != nil {
+		return &failure.StorageError{Err: fmt.Errorf("failed to read finding counts: %w", err)}
+	}
+	return nil
+}
@@ -0,0 +1,27 @@
+-- A row per host of a scan, and per finding on the host, its OS or a port
+CREATE TABLE vulnstore_scans (
+	scan_id      UUID NOT NULL,
+	host_address TEXT NOT NULL,
+	tenant_id    TEXT NOT NULL DEFAULT '',
+	host_name    TEXT NOT NULL DEFAULT '',
+	os           TEXT NOT NULL DEFAULT '',
+	scanned_at   TIMESTAMPTZ NOT NULL,
+	findings     INTEGER NOT NULL,
+	PRIMARY KEY (scan_id, host_address)
+);
+CREATE INDEX vulnstore_scans_host ON vulnstore_scans (tenant_id, host_address, scanned_at DESC);
+
+CREATE TABLE vulnstore_findings (
+	scan_id       UUID NOT NULL,
+	host_address  TEXT NOT NULL,
+	protocol      TEXT NOT NULL DEFAULT '',
+	port          INTEGER NOT NULL DEFAULT 0,
+	cve_id        TEXT NOT NULL,
+	cpe           TEXT NOT NULL DEFAULT '',
+	severity      TEXT NOT NULL DEFAULT '',
+	cvss_score    DOUBLE PRECISION NOT NULL DEFAULT 0,
+	vulnerability JSONB NOT NULL,
+	PRIMARY KEY (scan_id, host_address, protocol, port, cve_id),
+	FOREIGN KEY (scan_id, host_address) REFERENCES vulnstore_scans ON DELETE CASCADE
+);
+CREATE INDEX vulnstore_findings_cve ON vulnstore_findings (cve_id);
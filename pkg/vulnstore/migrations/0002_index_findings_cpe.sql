@@ -0,0 +1,5 @@
+-- Timelines select the findings of a CPE. Migrations run in a single
+-- transaction, which rules out CREATE INDEX CONCURRENTLY: building the index
+-- locks vulnstore_findings against writes, so results stored meanwhile wait
+-- for it. On a large table, create the index concurrently by hand first.
+CREATE INDEX IF NOT EXISTS vulnstore_findings_cpe ON vulnstore_findings (cpe);
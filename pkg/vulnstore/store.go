@@ -0,0 +1,297 @@
+// Package vulnstore persists the enriched vulnerabilities of every published
+// result into Postgres, per host and scan, so that they can be queried
+// historically rather than only consumed once from the event bus. The schema
+// is created and upgraded by the migrations embedded in the package.
+package vulnstore
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/asset"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/failure"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/results"
+	"github.com/lib/pq"
+)
+
+// Query limits of Findings and Scans.
+const (
+	DefaultLimit = 500
+	MaxLimit     = 5000
+)
+
+// Finding is a stored vulnerability with the host and port it was found on.
+type Finding struct {
+	ScanID      uuid.UUID `json:"scan_id"`
+	TenantID    string    `json:"tenant_id,omitempty"`
+	HostAddress string    `json:"host_address"`
+	ScannedAt   time.Time `json:"scanned_at"`
+
+	// Port is zero for findings of the operating system
+	Port     uint16 `json:"port,omitempty"`
+	Protocol string `json:"protocol,omitempty"`
+	CPE      string `json:"cpe,omitempty"`
+
+	Vulnerability results.Vulnerability `json:"vulnerability"`
+}
+
+// HostScan summarizes a stored scan of a host.
+type HostScan struct {
+	ScanID      uuid.UUID `json:"scan_id"`
+	TenantID    string    `json:"tenant_id,omitempty"`
+	HostAddress string    `json:"host_address"`
+	HostName    string    `json:"host_name,omitempty"`
+	OS          string    `json:"os,omitempty"`
+	ScannedAt   time.Time `json:"scanned_at"`
+	Findings    int       `json:"findings"`
+}
+
+// Filter selects stored findings. Zero fields select every finding, Since
+// and Until bound the scan times and Limit defaults to DefaultLimit.
+type Filter struct {
+	TenantID string
+	Host     string
+	CVE      string
+	ScanID   uuid.UUID
+	Since    time.Time
+	Until    time.Time
+	Limit    int
+}
+
+// Store persists findings in Postgres.
+type Store struct {
+	db *sql.DB
+}
+
+// Open connects to the database of dsn and applies the migrations it is
+// missing.
+func Open(ctx context.Context, dsn string) (*Store, error) {
+	migrations, err := loadMigrations(migrationFiles)
+	if err != nil {
+		return nil, err
+	}
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open postgres: %w", err)
+	}
+	applied, err := migrate(ctx, db, migrations)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	if applied > 0 {
+		slog.Info("Migrated vulnerability store", slog.Int("n_migrations", applied), slog.Int("version", migrations[len(migrations)-1].version))
+	}
+	return &Store{db: db}, nil
+}
+
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// findings flattens the vulnerabilities of result, dropping the repeated
+// findings of a port so that they fit the primary key of the table.
+func findings(scanID uuid.UUID, tenantID string, result *results.NmapResult, at time.Time) []Finding {
+	host := Finding{ScanID: scanID, TenantID: tenantID, HostAddress: asset.Canonical(result.HostAddress), ScannedAt: at.UTC()}
+	seen := make(map[string]bool)
+	var flat []Finding
+	add := func(f Finding, vuln results.Vulnerability) {
+		key := f.Protocol + "|" + strconv.Itoa(int(f.Port)) + "|" + vuln.ID
+		if vuln.ID == "" || seen[key] {
+			return
+		}
+		seen[key] = true
+		f.Vulnerability = vuln
+		flat = append(flat, f)
+	}
+
+	osFinding := host
+	osFinding.CPE = result.MostLikelyOS.CPE
+	for _, vuln := range result.MostLikelyOS.Vulnerabilities {
+		add(osFinding, vuln)
+	}
+	for _, port := range result.ScannedPorts {
+		portFinding := host
+		portFinding.Port = port.ID
+		portFinding.Protocol = port.Protocol
+		portFinding.CPE = port.Service.CPE
+		for _, vuln := range port.Vulnerabilities {
+			add(portFinding, vuln)
+		}
+	}
+	return flat
+}
+
+// Save stores the findings of the result of a host, replacing those stored
+// for the same scan, e.g. by a reanalysis, and returns how many it stored.
+// Hosts are stored in the canonical form of asset.Canonical.
+func (s *Store) Save(ctx context.Context, scanID uuid.UUID, tenantID string, result *results.NmapResult, at time.Time) (int, error) {
+	host := asset.Canonical(result.HostAddress)
+	flat := findings(scanID, tenantID, result, at)
+	err := s.inTx(ctx, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx,
+			`INSERT INTO vulnstore_scans (scan_id, host_address, tenant_id, host_name, os, scanned_at, findings)
+			 VALUES ($1, $2, $3, $4, $5, $6, $7)
+			 ON CONFLICT (scan_id, host_address) DO UPDATE SET tenant_id = EXCLUDED.tenant_id, host_name = EXCLUDED.host_name,
+			 os = EXCLUDED.os, scanned_at = EXCLUDED.scanned_at, findings = EXCLUDED.findings`,
+			scanID, host, tenantID, result.HostName, result.MostLikelyOS.Name, at.UTC(), len(flat)); err != nil {
+			return fmt.Errorf("failed to upsert scan: %w", err)
+		}
+		if _, err := tx.ExecContext(ctx,
+			`DELETE FROM vulnstore_findings WHERE scan_id = $1 AND host_address = $2`, scanID, host); err != nil {
+			return fmt.Errorf("failed to delete previous findings: %w", err)
+		}
+		return copyFindings(ctx, tx, flat)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(flat), nil
+}
+
+// copyFindings inserts flat with a single COPY.
+func copyFindings(ctx context.Context, tx *sql.Tx, flat []Finding) error {
+	if len(flat) == 0 {
+		return nil
+	}
+	stmt, err := tx.PrepareContext(ctx, pq.CopyIn("vulnstore_findings",
+		"scan_id", "host_address", "protocol", "port", "cve_id", "cpe", "severity", "cvss_score", "vulnerability"))
+	if err != nil {
+		return fmt.Errorf("failed to start copy: %w", err)
+	}
+	for _, f := range flat {
+		data, err := json.Marshal(f.Vulnerability)
+		if err != nil {
+			stmt.Close()
+			return fmt.Errorf("failed to encode %s: %w", f.Vulnerability.ID, err)
+		}
+		if _, err := stmt.ExecContext(ctx, f.ScanID, f.HostAddress, f.Protocol, int(f.Port), f.Vulnerability.ID, f.CPE,
+			string(f.Vulnerability.BaseSeverity), f.Vulnerability.BaseCVSSScore, string(data)); err != nil {
+			stmt.Close()
+			return fmt.Errorf("failed to copy %s: %w", f.Vulnerability.ID, err)
+		}
+	}
+	if _, err := stmt.ExecContext(ctx); err != nil {
+		stmt.Close()
+		return fmt.Errorf("failed to flush copy: %w", err)
+	}
+	if err := stmt.Close(); err != nil {
+		return fmt.Errorf("failed to end copy: %w", err)
+	}
+	return nil
+}
+
+// Findings returns the stored findings selected by filter, the latest scans
+// first.
+func (s *Store) Findings(ctx context.Context, filter Filter) ([]Finding, error) {
+	var where []string
+	var args []any
+	arg := func(cond string, value any) {
+		args = append(args, value)
+		where = append(where, strings.ReplaceAll(cond, "?", "$"+strconv.Itoa(len(args))))
+	}
+	if filter.TenantID != "" {
+		arg("s.tenant_id = ?", filter.TenantID)
+	}
+	if filter.Host != "" {
+		arg("s.host_address = ?", asset.Canonical(filter.Host))
+	}
+	if filter.CVE != "" {
+		arg("f.cve_id = ?", strings.ToUpper(filter.CVE))
+	}
+	if filter.ScanID != uuid.Nil {
+		arg("s.scan_id = ?", filter.ScanID)
+	}
+	if !filter.Since.IsZero() {
+		arg("s.scanned_at >= ?", filter.Since.UTC())
+	}
+	if !filter.Until.IsZero() {
+		arg("s.scanned_at < ?", filter.Until.UTC())
+	}
+	query := `SELECT s.scan_id, s.tenant_id, s.host_address, s.scanned_at, f.port, f.protocol, f.cpe, f.vulnerability
+		FROM vulnstore_findings f JOIN vulnstore_scans s USING (scan_id, host_address)`
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	args = append(args, limit(filter.Limit))
+	query += ` ORDER BY s.scanned_at DESC, s.host_address, f.protocol, f.port, f.cve_id LIMIT $` + strconv.Itoa(len(args))
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, &failure.StorageError{Err: fmt.Errorf("failed to select findings: %w", err)}
+	}
+	defer rows.Close()
+	var found []Finding
+	for rows.Next() {
+		var f Finding
+		var port int
+		var data []byte
+		if err := rows.Scan(&f.ScanID, &f.TenantID, &f.HostAddress, &f.ScannedAt, &port, &f.Protocol, &f.CPE, &data); err != nil {
+			return nil, fmt.Errorf("failed to scan finding: %w", err)
+		}
+		if err := json.Unmarshal(data, &f.Vulnerability); err != nil {
+			return nil, fmt.Errorf("corrupt finding: %w", err)
+		}
+		f.Port = uint16(port)
+		f.ScannedAt = f.ScannedAt.UTC()
+		found = append(found, f)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, &failure.StorageError{Err: fmt.Errorf("failed to read findings: %w", err)}
+	}
+	return found, nil
+}
+
+// Scans returns the stored scans of a host of a tenant, the latest first.
+func (s *Store) Scans(ctx context.Context, tenantID, host string, n int) ([]HostScan, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT scan_id, tenant_id, host_address, host_name, os, scanned_at, findings FROM vulnstore_scans
+		 WHERE tenant_id = $1 AND host_address = $2 ORDER BY scanned_at DESC LIMIT $3`,
+		tenantID, asset.Canonical(host), limit(n))
+	if err != nil {
+		return nil, &failure.StorageError{Err: fmt.Errorf("failed to select scans: %w", err)}
+	}
+	defer rows.Close()
+	var scans []HostScan
+	for rows.Next() {
+		var scan HostScan
+		if err := rows.Scan(&scan.ScanID, &scan.TenantID, &scan.HostAddress, &scan.HostName, &scan.OS, &scan.ScannedAt, &scan.Findings); err != nil {
+			return nil, fmt.Errorf("failed to scan host scan: %w", err)
+		}
+		scan.ScannedAt = scan.ScannedAt.UTC()
+		scans = append(scans, scan)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, &failure.StorageError{Err: fmt.Errorf("failed to read scans: %w", err)}
+	}
+	return scans, nil
+}
+
+func limit(n int) int {
+	if n <= 0 {
+		return DefaultLimit
+	}
+	return min(n, MaxLimit)
+}
+
+func (s *Store) inTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return &failure.StorageError{Err: fmt.Errorf("failed to begin vulnerability store transaction: %w", err)}
+	}
+	if err := fn(tx); err != nil {
+		_ = tx.Rollback()
+		return &failure.StorageError{Err: err}
+	}
+	if err := tx.Commit(); err != nil {
+		return &failure.StorageError{Err: fmt.Errorf("failed to commit vulnerability store transaction: %w", err)}
+	}
+	return nil
+}
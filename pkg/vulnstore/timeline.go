@@ -0,0 +1,199 @@
+package vulnstore
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/kptm-tools/common/common/pkg/enums"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/asset"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/failure"
+	"github.com/lib/pq"
+)
+
+// TimelineFilter selects the CVEs of Timeline: those of a host, or found on
+// the OS or services identified by a CPE, or both. Empty fields select every
+// host or CPE of the tenant.
+type TimelineFilter struct {
+	TenantID string
+	Host     string
+	CPE      string
+}
+
+// CVETimeline is the history of a CVE on a host across its stored scans, for
+// SLA and remediation tracking. It is built on the enriched findings, before
+// the publication thresholds and severity remapping of the tenant, so that
+// policy changes don't read as fixes or rescoring. Severity and CVSSScore are
+// the NVD ones of the latest scan finding it, SeverityChanges lists every
+// change since the first.
+// Open is set while the latest scan of the host finds it; otherwise FixedAt is
+// the time of the first scan of the host after LastSeen.
+type CVETimeline struct {
+	HostAddress     string             `json:"host_address"`
+	CVE             string             `json:"cve_id"`
+	FirstSeen       time.Time          `json:"first_seen"`
+	LastSeen        time.Time          `json:"last_seen"`
+	Scans           int                `json:"scans"`
+	Severity        enums.SeverityType `json:"severity"`
+	CVSSScore       float64            `json:"cvss_score"`
+	SeverityChanges []SeverityChange   `json:"severity_changes"`
+	Open            bool               `json:"open"`
+	FixedAt         *time.Time         `json:"fixed_at,omitempty"`
+}
+
+// SeverityChange is a change of the severity of a CVE between two scans,
+// e.g. after NVD rescored it.
+type SeverityChange struct {
+	At        time.Time          `json:"at"`
+	From      enums.SeverityType `json:"from"`
+	To        enums.SeverityType `json:"to"`
+	CVSSScore float64            `json:"cvss_score"`
+}
+
+// sighting is a CVE found by a stored scan of a host.
+type sighting struct {
+	host     string
+	at       time.Time
+	cve      string
+	severity enums.SeverityType
+	score    float64
+}
+
+// Timeline returns the history of the CVEs selected by filter, by host and
+// then by first sighting.
+func (s *Store) Timeline(ctx context.Context, filter TimelineFilter) ([]CVETimeline, error) {
+	// Findings are stored before the tenant policies apply, the provenance
+	// only holds an NVD severity for those stored remapped by earlier versions
+	query := `SELECT s.host_address, s.scanned_at, f.cve_id,
+			COALESCE(NULLIF(f.vulnerability->'provenance'->>'original_severity', ''), f.severity), f.cvss_score
+		FROM vulnstore_findings f JOIN vulnstore_scans s USING (scan_id, host_address)
+		WHERE s.tenant_id = $1`
+	args := []any{filter.TenantID}
+	if filter.Host != "" {
+		args = append(args, asset.Canonical(filter.Host))
+		query += fmt.Sprintf(" AND s.host_address = $%d", len(args))
+	}
+	if filter.CPE != "" {
+		args = append(args, filter.CPE)
+		query += fmt.Sprintf(" AND f.cpe = $%d", len(args))
+	}
+	query += " ORDER BY s.scanned_at"
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, &failure.StorageError{Err: fmt.Errorf("failed to select timeline findings: %w", err)}
+	}
+	defer rows.Close()
+	var sightings []sighting
+	hosts := make(map[string]bool)
+	for rows.Next() {
+		var found sighting
+		var severity string
+		if err := rows.Scan(&found.host, &found.at, &found.cve, &severity, &found.score); err != nil {
+			return nil, fmt.Errorf("failed to scan timeline finding: %w", err)
+		}
+		found.at = found.at.UTC()
+		found.severity = enums.SeverityType(severity)
+		sightings = append(sightings, found)
+		hosts[found.host] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, &failure.StorageError{Err: fmt.Errorf("failed to read timeline findings: %w", err)}
+	}
+	if len(sightings) == 0 {
+		return []CVETimeline{}, nil
+	}
+
+	scans, err := s.scanTimes(ctx, filter.TenantID, hosts)
+	if err != nil {
+		return nil, err
+	}
+	return timelines(sightings, scans), nil
+}
+
+// scanTimes returns the times of the stored scans of hosts, in order.
+func (s *Store) scanTimes(ctx context.Context, tenantID string, hosts map[string]bool) (map[string][]time.Time, error) {
+	names := make([]string, 0, len(hosts))
+	for host := range hosts {
+		names = append(names, host)
+	}
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT host_address, scanned_at FROM vulnstore_scans
+		 WHERE tenant_id = $1 AND host_address = ANY($2) ORDER BY scanned_at`,
+		tenantID, pq.Array(names))
+	if err != nil {
+		return nil, &failure.StorageError{Err: fmt.Errorf("failed to select scan times: %w", err)}
+	}
+	defer rows.Close()
+	times := make(map[string][]time.Time, len(hosts))
+	for rows.Next() {
+		var host string
+		var at time.Time
+		if err := rows.Scan(&host, &at); err != nil {
+			return nil, fmt.Errorf("failed to scan scan time: %w", err)
+		}
+		times[host] = append(times[host], at.UTC())
+	}
+	if err := rows.Err(); err != nil {
+		return nil, &failure.StorageError{Err: fmt.Errorf("failed to read scan times: %w", err)}
+	}
+	return times, nil
+}
+
+// timelines folds sightings, in scan order, into the timeline of each CVE of
+// each host. scans are the times of every scan of the hosts, in order.
+func timelines(sightings []sighting, scans map[string][]time.Time) []CVETimeline {
+	byKey := make(map[string]*CVETimeline)
+	var keys []string
+	for _, found := range sightings {
+		key := found.host + "|" + found.cve
+		t, ok := byKey[key]
+		if !ok {
+			t = &CVETimeline{
+				HostAddress:     found.host,
+				CVE:             found.cve,
+				FirstSeen:       found.at,
+				Severity:        found.severity,
+				CVSSScore:       found.score,
+				SeverityChanges: []SeverityChange{},
+			}
+			byKey[key] = t
+			keys = append(keys, key)
+		} else if found.at.Equal(t.LastSeen) {
+			// Found on another port by the same scan
+			continue
+		}
+		if found.severity != t.Severity {
+			t.SeverityChanges = append(t.SeverityChanges, SeverityChange{At: found.at, From: t.Severity, To: found.severity, CVSSScore: found.score})
+		}
+		t.Severity, t.CVSSScore = found.severity, found.score
+		t.LastSeen = found.at
+		t.Scans++
+	}
+
+	result := make([]CVETimeline, 0, len(keys))
+	for _, key := range keys {
+		t := byKey[key]
+		times := scans[t.HostAddress]
+		i := sort.Search(len(times), func(i int) bool { return times[i].After(t.LastSeen) })
+		if i < len(times) {
+			fixedAt := times[i]
+			t.FixedAt = &fixedAt
+		} else {
+			t.Open = true
+		}
+		result = append(result, *t)
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		a, b := result[i], result[j]
+		if a.HostAddress != b.HostAddress {
+			return a.HostAddress < b.HostAddress
+		}
+		if !a.FirstSeen.Equal(b.FirstSeen) {
+			return a.FirstSeen.Before(b.FirstSeen)
+		}
+		return a.CVE < b.CVE
+	})
+	return result
+}
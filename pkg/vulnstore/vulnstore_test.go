@@ -0,0 +1,177 @@
+package vulnstore
+
+import (
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kptm-tools/common/common/pkg/enums"
+	"github.com/kptm-tools/common/common/pkg/results/tools"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/results"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadMigrations(t *testing.T) {
+	t.Parallel()
+	migrations, err := loadMigrations(migrationFiles)
+	require.NoError(t, err)
+	require.NotEmpty(t, migrations)
+	for i, m := range migrations {
+		assert.Equal(t, i+1, m.version, "Expected migration versions without gaps")
+		assert.NotEmpty(t, m.sql)
+	}
+
+	migrations, err = loadMigrations(fstest.MapFS{
+		"migrations/0002_add_index.sql":     {Data: []byte("CREATE INDEX")},
+		"migrations/0001_create_tables.sql": {Data: []byte("CREATE TABLE")},
+		"migrations/README.md":              {Data: []byte("Not a migration")},
+	})
+	require.NoError(t, err)
+	require.Len(t, migrations, 2)
+	assert.Equal(t, migration{version: 1, name: "0001_create_tables", sql: "CREATE TABLE"}, migrations[0])
+	assert.Equal(t, "0002_add_index", migrations[1].name)
+
+	_, err = loadMigrations(fstest.MapFS{"migrations/create_tables.sql": {}})
+	assert.Error(t, err)
+	_, err = loadMigrations(fstest.MapFS{
+		"migrations/0001_create_tables.sql": {},
+		"migrations/001_create_indexes.sql": {},
+	})
+	assert.Error(t, err, "Expected repeated versions to be rejected")
+}
+
+func TestFindings(t *testing.T) {
+	t.Parallel()
+	scanID := uuid.New()
+	at := time.Date(2024, 6, 1, 12, 0, 0, 0, time.FixedZone("CEST", 2*60*60))
+	critical := results.Vulnerability{Vulnerability: tools.Vulnerability{ID: "CVE-2023-38408", BaseCVSSScore: 9.8, BaseSeverity: enums.SeverityTypeCritical}}
+	result := &results.NmapResult{
+		HostAddress: "DC01.example.com.",
+		MostLikelyOS: results.OSData{
+			CPE:             "cpe:2.3:o:microsoft:windows_server_2016:-:*:*:*:*:*:*:*",
+			Vulnerabilities: []results.Vulnerability{{Vulnerability: tools.Vulnerability{ID: "CVE-2024-20674"}}},
+		},
+		ScannedPorts: []results.PortData{{
+			ID:              22,
+			Protocol:        "tcp",
+			Service:         tools.Service{Name: "ssh", CPE: "cpe:2.3:a:openbsd:openssh:8.2:*:*:*:*:*:*:*"},
+			Vulnerabilities: []results.Vulnerability{critical, critical, {}},
+		}},
+	}
+
+	flat := findings(scanID, "acme", result, at)
+	require.Len(t, flat, 2, "Expected repeated findings and findings without ID to be dropped")
+
+	assert.Equal(t, "CVE-2024-20674", flat[0].Vulnerability.ID)
+	assert.Zero(t, flat[0].Port)
+	assert.Equal(t, result.MostLikelyOS.CPE, flat[0].CPE)
+
+	assert.Equal(t, Finding{
+		ScanID:        scanID,
+		TenantID:      "acme",
+		HostAddress:   "dc01.example.com",
+		ScannedAt:     at.UTC(),
+		Port:          22,
+		Protocol:      "tcp",
+		CPE:           "cpe:2.3:a:openbsd:openssh:8.2:*:*:*:*:*:*:*",
+		Vulnerability: critical,
+	}, flat[1])
+}
+
+func TestLimit(t *testing.T) {
+	t.Parallel()
+	assert.Equal(t, DefaultLimit, limit(0))
+	assert.Equal(t, 10, limit(10))
+	assert.Equal(t, MaxLimit, limit(MaxLimit+1))
+}
+
+func TestCompare(t *testing.T) {
+	t.Parallel()
+	finding := func(cve, protocol string, port uint16, severity enums.SeverityType) Finding {
+		return Finding{Protocol: protocol, Port: port, Vulnerability: results.Vulnerability{Vulnerability: tools.Vulnerability{ID: cve, BaseSeverity: severity}}}
+	}
+	previous := []Finding{
+		finding("CVE-2023-38408", "tcp", 22, enums.SeverityTypeCritical),
+		finding("CVE-2024-20674", "", 0, enums.SeverityTypeHigh),
+		finding("CVE-2021-41773", "tcp", 80, enums.SeverityTypeHigh),
+	}
+	current := []Finding{
+		finding("CVE-2024-6387", "tcp", 22, enums.SeverityTypeHigh),
+		finding("CVE-2023-38408", "tcp", 22, enums.SeverityTypeCritical),
+		finding("CVE-2023-38408", "tcp", 22, enums.SeverityTypeCritical),
+		// The same CVE on another port is another finding
+		finding("CVE-2021-41773", "tcp", 8080, enums.SeverityTypeHigh),
+		finding("CVE-2024-20674", "", 0, enums.SeverityTypeHigh),
+	}
+
+	diff := Compare(previous, current)
+	assert.Equal(t, []results.DiffFinding{
+		{CVE: "CVE-2021-41773", Protocol: "tcp", Port: 8080, Severity: enums.SeverityTypeHigh},
+		{CVE: "CVE-2024-6387", Protocol: "tcp", Port: 22, Severity: enums.SeverityTypeHigh},
+	}, diff.New)
+	assert.Equal(t, []results.DiffFinding{
+		{CVE: "CVE-2021-41773", Protocol: "tcp", Port: 80, Severity: enums.SeverityTypeHigh},
+	}, diff.Fixed)
+	assert.Equal(t, []results.DiffFinding{
+		{CVE: "CVE-2023-38408", Protocol: "tcp", Port: 22, Severity: enums.SeverityTypeCritical},
+		{CVE: "CVE-2024-20674", Severity: enums.SeverityTypeHigh},
+	}, diff.Persistent)
+
+	empty := Compare(nil, nil)
+	assert.NotNil(t, empty.New, "Expected empty lists rather than null in the payload")
+	assert.Empty(t, empty.Fixed)
+}
+
+func TestTimelines(t *testing.T) {
+	t.Parallel()
+	day := func(d int) time.Time { return time.Date(2024, 6, d, 2, 0, 0, 0, time.UTC) }
+	sightings := []sighting{
+		{host: "10.0.0.5", at: day(1), cve: "CVE-2024-6387", severity: enums.SeverityTypeHigh, score: 8.1},
+		{host: "10.0.0.5", at: day(1), cve: "CVE-2023-38408", severity: enums.SeverityTypeCritical, score: 9.8},
+		// Found on a second port by the same scan
+		{host: "10.0.0.5", at: day(1), cve: "CVE-2023-38408", severity: enums.SeverityTypeCritical, score: 9.8},
+		{host: "10.0.0.4", at: day(2), cve: "CVE-2024-6387", severity: enums.SeverityTypeHigh, score: 8.1},
+		{host: "10.0.0.5", at: day(2), cve: "CVE-2024-6387", severity: enums.SeverityTypeHigh, score: 8.1},
+		{host: "10.0.0.5", at: day(3), cve: "CVE-2024-6387", severity: enums.SeverityTypeCritical, score: 9.1},
+	}
+	scans := map[string][]time.Time{
+		"10.0.0.4": {day(2)},
+		"10.0.0.5": {day(1), day(2), day(3)},
+	}
+
+	got := timelines(sightings, scans)
+	require.Len(t, got, 3)
+
+	assert.Equal(t, CVETimeline{
+		HostAddress:     "10.0.0.4",
+		CVE:             "CVE-2024-6387",
+		FirstSeen:       day(2),
+		LastSeen:        day(2),
+		Scans:           1,
+		Severity:        enums.SeverityTypeHigh,
+		CVSSScore:       8.1,
+		SeverityChanges: []SeverityChange{},
+		Open:            true,
+	}, got[0])
+
+	fixedAt := day(2)
+	assert.Equal(t, CVETimeline{
+		HostAddress:     "10.0.0.5",
+		CVE:             "CVE-2023-38408",
+		FirstSeen:       day(1),
+		LastSeen:        day(1),
+		Scans:           1,
+		Severity:        enums.SeverityTypeCritical,
+		CVSSScore:       9.8,
+		SeverityChanges: []SeverityChange{},
+		FixedAt:         &fixedAt,
+	}, got[1], "Expected the CVE to be fixed by the next scan of the host")
+
+	assert.Equal(t, "CVE-2024-6387", got[2].CVE)
+	assert.Equal(t, 3, got[2].Scans)
+	assert.True(t, got[2].Open)
+	assert.Equal(t, enums.SeverityTypeCritical, got[2].Severity)
+	assert.Equal(t, []SeverityChange{{At: day(3), From: enums.SeverityTypeHigh, To: enums.SeverityTypeCritical, CVSSScore: 9.1}}, got[2].SeverityChanges)
+}
@@ -0,0 +1,177 @@
+// Package warmup looks up the CPE inventory of the organization into the NVD
+// caches during off-hours, so that the interactive scans of its assets
+// complete from cache instead of waiting on the NVD rate limit.
+package warmup
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/kptm-tools/vulnerability-analysis/pkg/scans"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/services"
+)
+
+// Warmer looks up CPEs into the caches of the NVD client, e.g. a
+// services.NVDClient.
+type Warmer interface {
+	WarmCache(ctx context.Context, cpes []string) (services.CacheWarmReport, error)
+}
+
+// Inventory lists the CPEs of the known assets. Duplicates are fine, they are
+// looked up once.
+type Inventory interface {
+	CPEs(ctx context.Context) ([]string, error)
+}
+
+// FileInventory reads the CPEs of the file it names, one per line. Blank
+// lines and lines starting with # are ignored.
+type FileInventory string
+
+func (f FileInventory) CPEs(context.Context) ([]string, error) {
+	file, err := os.Open(string(f))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open CPE inventory: %w", err)
+	}
+	defer file.Close()
+
+	var cpes []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		cpes = append(cpes, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read CPE inventory: %w", err)
+	}
+	return cpes, nil
+}
+
+// ScanInventory lists the CPEs detected on the hosts of the recent scans
+// held by a scan store: the CPEs nmap reported for their services and the
+// CPE of their most likely OS.
+type ScanInventory struct {
+	Store *scans.Store
+}
+
+func (s ScanInventory) CPEs(context.Context) ([]string, error) {
+	var cpes []string
+	for _, record := range s.Store.Latest() {
+		for _, port := range record.Host.Ports {
+			for _, cpe := range port.Service.CPEs {
+				cpes = append(cpes, string(cpe))
+			}
+		}
+		if record.Result != nil && record.Result.MostLikelyOS.CPE != "" {
+			cpes = append(cpes, record.Result.MostLikelyOS.CPE)
+		}
+	}
+	return cpes, nil
+}
+
+// Inventories merges the CPEs of several inventories.
+func Inventories(inventories ...Inventory) Inventory {
+	return multiInventory(inventories)
+}
+
+type multiInventory []Inventory
+
+func (m multiInventory) CPEs(ctx context.Context) ([]string, error) {
+	var cpes []string
+	for _, inventory := range m {
+		more, err := inventory.CPEs(ctx)
+		if err != nil {
+			return nil, err
+		}
+		cpes = append(cpes, more...)
+	}
+	return cpes, nil
+}
+
+// ParseTimeOfDay parses a time of day such as 02:30 into the time elapsed
+// since midnight.
+func ParseTimeOfDay(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day %q, expected HH:MM", s)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// Job warms the caches with the CPEs of an inventory every day at a time of
+// day, in the local time zone, for at most a maximum duration so that the
+// NVD quota is left to the scans of the working day.
+type Job struct {
+	warmer      Warmer
+	inventory   Inventory
+	at          time.Duration
+	maxDuration time.Duration
+	now         func() time.Time
+}
+
+// NewJob returns a job warming the CPEs of inventory every day at, the time
+// elapsed since midnight, for at most maxDuration, or until done when zero.
+func NewJob(warmer Warmer, inventory Inventory, at, maxDuration time.Duration) *Job {
+	return &Job{warmer: warmer, inventory: inventory, at: at, maxDuration: maxDuration, now: time.Now}
+}
+
+// Next returns the first time the job runs after t.
+func (j *Job) Next(t time.Time) time.Time {
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	next := midnight.Add(j.at)
+	if !next.After(t) {
+		next = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location()).Add(j.at)
+	}
+	return next
+}
+
+// Start runs the job every day until ctx is done.
+func (j *Job) Start(ctx context.Context) {
+	go func() {
+		for {
+			next := j.Next(j.now())
+			slog.Info("Scheduled CPE cache warm-up", slog.Time("at", next))
+			timer := time.NewTimer(time.Until(next))
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+			if _, err := j.Run(ctx); err != nil {
+				slog.Warn("CPE cache warm-up stopped early", slog.Any("error", err))
+			}
+		}
+	}()
+}
+
+// Run warms the caches with the CPEs of the inventory once.
+func (j *Job) Run(ctx context.Context) (services.CacheWarmReport, error) {
+	if j.maxDuration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, j.maxDuration)
+		defer cancel()
+	}
+
+	cpes, err := j.inventory.CPEs(ctx)
+	if err != nil {
+		return services.CacheWarmReport{}, err
+	}
+	start := j.now()
+	report, err := j.warmer.WarmCache(ctx, cpes)
+	slog.Info("Warmed CPE cache",
+		slog.Int("n_cpes", report.CPEs),
+		slog.Int("n_warmed", report.Warmed),
+		slog.Int("n_empty", report.Empty),
+		slog.Int("n_invalid", report.Invalid),
+		slog.Int("n_failed", report.Failed),
+		slog.Duration("duration", j.now().Sub(start).Round(time.Second)))
+	return report, err
+}
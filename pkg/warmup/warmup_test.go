@@ -0,0 +1,91 @@
+package warmup
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Ullaakut/nmap/v2"
+	"github.com/google/uuid"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/results"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/scans"
+	"github.com/kptm-tools/vulnerability-analysis/pkg/services"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type stubWarmer struct {
+	cpes []string
+}
+
+func (s *stubWarmer) WarmCache(ctx context.Context, cpes []string) (services.CacheWarmReport, error) {
+	s.cpes = cpes
+	if _, ok := ctx.Deadline(); !ok {
+		return services.CacheWarmReport{}, context.DeadlineExceeded
+	}
+	return services.CacheWarmReport{CPEs: len(cpes), Warmed: len(cpes)}, nil
+}
+
+func TestFileInventory(t *testing.T) {
+	t.Parallel()
+	path := filepath.Join(t.TempDir(), "inventory.txt")
+	require.NoError(t, os.WriteFile(path, []byte("# Web servers\ncpe:/a:apache:http_server:2.4.41\n\n  cpe:/a:openbsd:openssh:8.9p1  \n"), 0o644))
+
+	cpes, err := FileInventory(path).CPEs(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"cpe:/a:apache:http_server:2.4.41", "cpe:/a:openbsd:openssh:8.9p1"}, cpes)
+
+	_, err = FileInventory(filepath.Join(t.TempDir(), "missing.txt")).CPEs(context.Background())
+	assert.Error(t, err)
+}
+
+func TestScanInventory(t *testing.T) {
+	t.Parallel()
+	store := scans.NewStore(10)
+	store.Save(scans.Record{
+		ScanID: uuid.New(),
+		Host: nmap.Host{Ports: []nmap.Port{
+			{ID: 22, Service: nmap.Service{Name: "ssh", CPEs: []nmap.CPE{"cpe:/a:openbsd:openssh:8.9p1"}}},
+			{ID: 80, Service: nmap.Service{Name: "http"}},
+		}},
+		Result: &results.NmapResult{MostLikelyOS: results.OSData{CPE: "cpe:2.3:o:linux:linux_kernel:5.4:*:*:*:*:*:*:*"}},
+	})
+
+	cpes, err := Inventories(ScanInventory{Store: store}).CPEs(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"cpe:/a:openbsd:openssh:8.9p1", "cpe:2.3:o:linux:linux_kernel:5.4:*:*:*:*:*:*:*"}, cpes)
+}
+
+func TestParseTimeOfDay(t *testing.T) {
+	t.Parallel()
+	at, err := ParseTimeOfDay("02:30")
+	require.NoError(t, err)
+	assert.Equal(t, 2*time.Hour+30*time.Minute, at)
+
+	_, err = ParseTimeOfDay("25:00")
+	assert.Error(t, err)
+}
+
+func TestJob_Next(t *testing.T) {
+	t.Parallel()
+	job := NewJob(&stubWarmer{}, Inventories(), 2*time.Hour, 0)
+	loc := time.FixedZone("UTC-3", -3*60*60)
+
+	assert.Equal(t, time.Date(2024, 1, 1, 2, 0, 0, 0, loc), job.Next(time.Date(2024, 1, 1, 1, 0, 0, 0, loc)))
+	assert.Equal(t, time.Date(2024, 1, 2, 2, 0, 0, 0, loc), job.Next(time.Date(2024, 1, 1, 2, 0, 0, 0, loc)))
+	assert.Equal(t, time.Date(2024, 1, 1, 2, 0, 0, 0, loc), job.Next(time.Date(2023, 12, 31, 15, 0, 0, 0, loc)))
+}
+
+func TestJob_Run(t *testing.T) {
+	t.Parallel()
+	path := filepath.Join(t.TempDir(), "inventory.txt")
+	require.NoError(t, os.WriteFile(path, []byte("cpe:/a:openbsd:openssh:8.9p1\n"), 0o644))
+	warmer := &stubWarmer{}
+
+	report, err := NewJob(warmer, FileInventory(path), 2*time.Hour, time.Hour).Run(context.Background())
+	require.NoError(t, err, "Expected the run to be bounded by the maximum duration")
+	assert.Equal(t, services.CacheWarmReport{CPEs: 1, Warmed: 1}, report)
+	assert.Equal(t, []string{"cpe:/a:openbsd:openssh:8.9p1"}, warmer.cpes)
+}